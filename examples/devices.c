@@ -0,0 +1,147 @@
+// Made up hardware on a machine from libchip8.a: a serial port, banked RAM and machine code routines
+// None of it needs changes to the core, the devices and the 0NNN hook are registered from outside
+//
+// Build from src/ with "make devices" and run ./devices. The Octo program below prints a greeting
+// through the serial port, checks that the RAM banks hold different values at the same address and
+// prints the result with a routine of the host
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "octo.h"
+
+#define SERIAL_ADDR 0xFF0       // Writes send a byte to stdout, reads return the next byte of stdin
+#define BANK_ADDR   0xFF1       // Selects the bank seen in the window
+#define WINDOW_ADDR 0xE00       // 256 bytes of whichever bank is selected
+#define BANK_SIZE   256
+#define BANKS       4
+
+// 0NNN routines the program can call
+#define SYS_PRINT_V0 0x010      // Print V0 in decimal
+#define SYS_HALT     0x000      // Stop the machine
+
+typedef struct {
+    chip8_t *chip8;
+    uint8_t bank;
+    uint8_t banks[BANKS][BANK_SIZE];
+} hardware_t;
+
+static const char *const program =
+    ": main\n"
+    "    v1 := 0\n"
+    "    loop\n"
+    "        i := message\n"
+    "        i += v1\n"
+    "        load v0\n"
+    "        while v0 != 0\n"
+    "        i := 0xFF0\n"              // SERIAL_ADDR
+    "        save v0\n"
+    "        v1 += 1\n"
+    "    again\n"
+    "\n"
+    "    # 42 into bank 1, then bank 0 is selected again and has its own byte there\n"
+    "    v0 := 1   i := 0xFF1   save v0\n"
+    "    v0 := 42  i := 0xE00   save v0\n"
+    "    v0 := 0   i := 0xFF1   save v0\n"
+    "    i := 0xE00   load v0\n"
+    "    native 0x010\n"
+    "    v0 := 1   i := 0xFF1   save v0\n"
+    "    i := 0xE00   load v0\n"
+    "    native 0x010\n"
+    "    native 0x000\n"
+    "\n"
+    ": message\n"
+    "    0x48 0x65 0x6C 0x6C 0x6F 0x2C 0x20 0x73 0x65 0x72 0x69 0x61 0x6C 0x0A 0x00\n";
+
+static uint8_t serial_read(void *userdata, uint16_t addr, uint8_t value) {
+    (void)userdata;
+    (void)addr;
+    (void)value;
+
+    const int c = getchar();
+    return c == EOF ? 0 : (uint8_t)c;
+}
+
+static uint8_t serial_write(void *userdata, uint16_t addr, uint8_t value) {
+    (void)userdata;
+    (void)addr;
+
+    putchar(value);
+    return value;
+}
+
+static uint8_t bank_write(void *userdata, uint16_t addr, uint8_t value) {
+    hardware_t *hardware = userdata;
+    (void)addr;
+
+    hardware->bank = value % BANKS;
+    return value;
+}
+
+// Memory under the window isn't used, what the instructions see comes from the bank
+static uint8_t window_read(void *userdata, uint16_t addr, uint8_t value) {
+    const hardware_t *hardware = userdata;
+    (void)value;
+
+    return hardware->banks[hardware->bank][addr - WINDOW_ADDR];
+}
+
+static uint8_t window_write(void *userdata, uint16_t addr, uint8_t value) {
+    hardware_t *hardware = userdata;
+
+    hardware->banks[hardware->bank][addr - WINDOW_ADDR] = value;
+    return value;
+}
+
+static bool sys_routine(void *userdata, uint16_t addr) {
+    hardware_t *hardware = userdata;
+
+    switch(addr) {
+        case SYS_PRINT_V0:
+            printf("V0 = %u\n", hardware->chip8->V[0]);
+            return true;
+
+        case SYS_HALT:
+            hardware->chip8->state = QUIT;
+            return true;
+    }
+
+    return false;
+}
+
+int main(void) {
+    uint8_t *rom;
+    size_t rom_size;
+    if(!octo_assemble(program, "devices.o8", &rom, &rom_size, NULL)) return EXIT_FAILURE;
+
+    chip8_t *chip8 = malloc(sizeof *chip8);
+    hardware_t *hardware = calloc(1, sizeof *hardware);
+    if(!chip8 || !hardware) return EXIT_FAILURE;
+
+    chip8_init(chip8);
+    const bool loaded = chip8_load_rom(chip8, rom, rom_size);
+    free(rom);
+    if(!loaded) return EXIT_FAILURE;
+
+    hardware->chip8 = chip8;
+    const chip8_device_t devices[] = {
+        {.first = SERIAL_ADDR, .last = SERIAL_ADDR, .read = serial_read, .write = serial_write},
+        {.first = BANK_ADDR, .last = BANK_ADDR, .write = bank_write, .userdata = hardware},
+        {.first = WINDOW_ADDR, .last = WINDOW_ADDR + BANK_SIZE - 1, .read = window_read, .write = window_write,
+         .userdata = hardware},
+    };
+    for(size_t i = 0; i < sizeof devices / sizeof devices[0]; i++) chip8_add_device(chip8, &devices[i]);
+    chip8_set_sys_hook(chip8, sys_routine, hardware);
+
+    // Timers don't matter here, the program runs until it halts or faults
+    while(chip8->state != QUIT) chip8_step(chip8);
+
+    const int status = chip8->fault == CHIP8_FAULT_NONE ? EXIT_SUCCESS : EXIT_FAILURE;
+    if(chip8->fault != CHIP8_FAULT_NONE) chip8_print_fault(chip8, stderr);
+
+    free(hardware);
+    free(chip8);
+    return status;
+}
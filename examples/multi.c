@@ -0,0 +1,208 @@
+// Several ROMs side by side in one window, each on its own machine from libchip8.a
+// Machines share nothing, so this is all it takes to run them together: one chip8_t each,
+// stepped in turn every frame. Handy for comparing quirks or filling a wall with demos
+//
+// Build from src/ with "make multi", then for example:
+//   ./multi --quirks cosmac ../roms/BLINKY --quirks modern ../roms/BLINKY
+// Options apply to the ROMs after them. Keys 1234/QWER/ASDF/ZXCV are the keypad, they go to every
+// machine until Tab picks one, Tab again moves on to the next and after the last back to all of them
+// Escape quits. There is no sound
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <math.h>
+#include <SDL.h>
+
+#include "chip8.h"
+
+#define MAX_MACHINES 64
+#define CELL_WIDTH   512     // Window pixels per machine
+#define CELL_HEIGHT  256
+#define BORDER       4
+
+typedef struct {
+    chip8_t *chip8;
+} machine_t;
+
+// Plane bitmask to color: background, plane 1, plane 2, both
+static const uint32_t colors[4] = {0x000000, 0xFFFFFF, 0xFF6600, 0x662200};
+
+// Host keys for CHIP8 keys 0x0 - 0xF
+static const SDL_Keycode keys[16] = {
+    SDLK_x, SDLK_1, SDLK_2, SDLK_3, SDLK_q, SDLK_w, SDLK_e, SDLK_a,
+    SDLK_s, SDLK_d, SDLK_z, SDLK_c, SDLK_4, SDLK_r, SDLK_f, SDLK_v,
+};
+
+static void usage(const char *program) {
+    fprintf(stderr, "Usage: %s [--quirks <preset>] [--xochip] [--speed <n>] [--columns <n>] <rom_path> ...\n"
+                    "Options apply to the ROMs after them\n", program);
+}
+
+// Load every ROM on the command line, returns how many machines there are or 0 on errors
+static size_t load_machines(machine_t *machines, uint32_t *columns, int argc, char **argv) {
+    const char *quirks = "modern";
+    bool xochip = false;
+    uint32_t speed = 700;
+    size_t count = 0;
+
+    for(int i = 1; i < argc; i++) {
+        const bool has_value = i + 1 < argc;
+
+        if(strcmp(argv[i], "--quirks") == 0 && has_value) {
+            quirks = argv[++i];
+        } else if(strcmp(argv[i], "--speed") == 0 && has_value) {
+            speed = (uint32_t)strtoul(argv[++i], NULL, 10);
+            if(speed < 60) speed = 60;
+        } else if(strcmp(argv[i], "--columns") == 0 && has_value) {
+            *columns = (uint32_t)strtoul(argv[++i], NULL, 10);
+        } else if(strcmp(argv[i], "--xochip") == 0) {
+            xochip = true;
+        } else if(strncmp(argv[i], "--", 2) == 0) {
+            usage(argv[0]);
+            return 0;
+        } else if(count == MAX_MACHINES) {
+            fprintf(stderr, "At most %d ROMs\n", MAX_MACHINES);
+            return 0;
+        } else {
+            machine_t *machine = &machines[count];
+            if(!(machine->chip8 = malloc(sizeof *machine->chip8))) return 0;
+            count++;
+
+            chip8_init(machine->chip8);
+            chip8_set_xochip(machine->chip8, xochip);
+            if(!chip8_quirks_preset(quirks, &machine->chip8->quirks)) {
+                fprintf(stderr, "Unknown quirks preset %s\n", quirks);
+                return 0;
+            }
+            if(!chip8_load_rom_file(machine->chip8, argv[i])) return 0;
+
+            chip8_set_speed(machine->chip8, speed);
+        }
+    }
+
+    if(count == 0) usage(argv[0]);
+    return count;
+}
+
+static void set_color(SDL_Renderer *renderer, uint32_t rgb) {
+    SDL_SetRenderDrawColor(renderer, rgb >> 16, (rgb >> 8) & 0xFF, rgb & 0xFF, 0xFF);
+}
+
+// Machine screen scaled into its cell, the focused one gets a frame, stopped ones a red frame
+static void draw_machine(SDL_Renderer *renderer, const chip8_t *chip8, int x0, int y0, bool focused) {
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t height = chip8_display_height(chip8);
+    const int pixel_w = (CELL_WIDTH - 2 * BORDER) / width;
+    const int pixel_h = (CELL_HEIGHT - 2 * BORDER) / height;
+    const int size = pixel_w < pixel_h ? pixel_w : pixel_h;
+    const int left = x0 + (CELL_WIDTH - size * (int)width) / 2;
+    const int top = y0 + (CELL_HEIGHT - size * (int)height) / 2;
+
+    set_color(renderer, chip8->state == QUIT ? 0xCC2222 : focused ? 0x3388FF : 0x202020);
+    SDL_Rect frame = {x0, y0, CELL_WIDTH, CELL_HEIGHT};
+    SDL_RenderFillRect(renderer, &frame);
+
+    set_color(renderer, colors[0]);
+    SDL_Rect screen = {left, top, size * (int)width, size * (int)height};
+    SDL_RenderFillRect(renderer, &screen);
+
+    for(uint32_t y = 0; y < height; y++) {
+        for(uint32_t x = 0; x < width; x++) {
+            const uint8_t planes = chip8_pixel_planes(chip8, x, y) & 3;
+            if(!planes) continue;
+
+            set_color(renderer, colors[planes]);
+            SDL_Rect pixel = {left + (int)x * size, top + (int)y * size, size, size};
+            SDL_RenderFillRect(renderer, &pixel);
+        }
+    }
+}
+
+// Keypad goes to the focused machine, or all of them when focus is -1
+static void set_key(machine_t *machines, size_t count, int focus, SDL_Keycode sym, bool pressed) {
+    for(uint8_t key = 0; key < 16; key++) {
+        if(keys[key] != sym) continue;
+
+        for(size_t i = 0; i < count; i++)
+            if(focus < 0 || (size_t)focus == i) chip8_set_key(machines[i].chip8, key, pressed);
+    }
+}
+
+static void release_keys(machine_t *machines, size_t count) {
+    for(size_t i = 0; i < count; i++)
+        for(uint8_t key = 0; key < 16; key++) chip8_set_key(machines[i].chip8, key, false);
+}
+
+// Run the machines in a grid until the window is closed
+static bool run_window(machine_t *machines, size_t count, uint32_t columns) {
+    // As square a grid as possible unless --columns says otherwise
+    if(columns == 0 || columns > count) columns = (uint32_t)ceil(sqrt((double)count));
+    const uint32_t rows = (uint32_t)((count + columns - 1) / columns);
+
+    if(SDL_Init(SDL_INIT_VIDEO) != 0) {
+        fprintf(stderr, "Could not initialize SDL: %s\n", SDL_GetError());
+        return false;
+    }
+
+    SDL_Window *window = SDL_CreateWindow("CHIP8 machines", SDL_WINDOWPOS_CENTERED, SDL_WINDOWPOS_CENTERED,
+                                          columns * CELL_WIDTH, rows * CELL_HEIGHT, 0);
+    SDL_Renderer *renderer = window ? SDL_CreateRenderer(window, -1, SDL_RENDERER_ACCELERATED) : NULL;
+    if(!renderer) {
+        fprintf(stderr, "Could not create the window: %s\n", SDL_GetError());
+        if(window) SDL_DestroyWindow(window);
+        SDL_Quit();
+        return false;
+    }
+
+    int focus = -1;
+    bool running = true;
+    const uint32_t start = SDL_GetTicks();
+
+    for(uint32_t frames = 0; running; frames++) {
+        SDL_Event event;
+        while(SDL_PollEvent(&event)) {
+            if(event.type == SDL_QUIT) {
+                running = false;
+            } else if(event.type == SDL_KEYDOWN && event.key.keysym.sym == SDLK_ESCAPE) {
+                running = false;
+            } else if(event.type == SDL_KEYDOWN && event.key.keysym.sym == SDLK_TAB) {
+                // Keys held for the old focus would stay down forever
+                release_keys(machines, count);
+                focus = focus + 1 == (int)count ? -1 : focus + 1;
+            } else if(event.type == SDL_KEYDOWN || event.type == SDL_KEYUP) {
+                set_key(machines, count, focus, event.key.keysym.sym, event.type == SDL_KEYDOWN);
+            }
+        }
+
+        for(size_t i = 0; i < count; i++) chip8_run_frame(machines[i].chip8);
+
+        SDL_SetRenderDrawColor(renderer, 0, 0, 0, 0xFF);
+        SDL_RenderClear(renderer);
+        for(size_t i = 0; i < count; i++)
+            draw_machine(renderer, machines[i].chip8, (i % columns) * CELL_WIDTH, (i / columns) * CELL_HEIGHT,
+                         focus == (int)i);
+        SDL_RenderPresent(renderer);
+
+        // 60 frames a second, counted from the start so rounding doesn't add up
+        const uint32_t due = start + (uint32_t)((uint64_t)(frames + 1) * 1000 / 60);
+        const uint32_t now = SDL_GetTicks();
+        if(due > now) SDL_Delay(due - now);
+    }
+
+    SDL_DestroyRenderer(renderer);
+    SDL_DestroyWindow(window);
+    SDL_Quit();
+    return true;
+}
+
+int main(int argc, char **argv) {
+    static machine_t machines[MAX_MACHINES];
+    uint32_t columns = 0;
+    const size_t count = load_machines(machines, &columns, argc, argv);
+    const bool ok = count > 0 && run_window(machines, count, columns);
+
+    for(size_t i = 0; i < MAX_MACHINES; i++) free(machines[i].chip8);
+    return ok ? EXIT_SUCCESS : EXIT_FAILURE;
+}
@@ -0,0 +1,182 @@
+// CHIP8 on a Raspberry Pi Pico (RP2040) with a 128x64 SSD1306 OLED on SPI, buttons and a buzzer
+// The core is the same chip8.c as on the desktop, built with -DCHIP8_NO_MEGACHIP so the machine fits
+// in the RP2040's 264KB of RAM. The ROM is compiled into the firmware, see CMakeLists.txt
+//
+// Build with the Pico SDK:
+//   mkdir build && cd build && cmake .. -DCHIP8_ROM=/path/to/game.ch8 && make
+// then copy chip8_pico.uf2 to the Pico in BOOTSEL mode
+//
+// The pins below match a common SSD1306 SPI module wired to SPI0, change them for your board
+// SUPER-CHIP hires is 128x64 and fills the screen, lores games are drawn at twice the size
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "pico/stdlib.h"
+#include "hardware/clocks.h"
+#include "hardware/spi.h"
+#include "hardware/pwm.h"
+
+#include "chip8.h"
+#include "rom.h"
+
+#define PIN_SCK    18
+#define PIN_MOSI   19
+#define PIN_CS     17
+#define PIN_DC     20
+#define PIN_RESET  21
+#define PIN_BUZZER 15
+
+#define SCREEN_WIDTH  128
+#define SCREEN_HEIGHT 64
+#define BUZZER_HZ     440
+
+// Buttons pull their pin to ground, each one presses a keypad key
+// 2/4/6/8 and 5 are what most games use for movement and fire
+static const struct {
+    uint8_t pin;
+    uint8_t key;
+} buttons[] = {
+    {2, 0x2},   // Up
+    {3, 0x8},   // Down
+    {4, 0x4},   // Left
+    {5, 0x6},   // Right
+    {6, 0x5},   // A
+    {7, 0x1},   // B
+};
+
+// SSD1306 setup for a 128x64 panel, the column and row order is flipped so the picture
+// isn't mirrored on the usual modules
+static const uint8_t ssd1306_init[] = {
+    0xAE,               // Display off
+    0xD5, 0x80,         // Clock divider
+    0xA8, 0x3F,         // 64 rows
+    0xD3, 0x00,         // No vertical offset
+    0x40,               // Start at row 0
+    0x8D, 0x14,         // Charge pump on
+    0x20, 0x00,         // Horizontal addressing, the frame goes out in one write
+    0xA1, 0xC8,         // Flip columns and rows
+    0xDA, 0x12,         // COM pin layout of 128x64 panels
+    0x81, 0xCF,         // Contrast
+    0xD9, 0xF1,         // Precharge
+    0xDB, 0x40,         // VCOM level
+    0xA4, 0xA6,         // Show RAM, not inverted
+    0xAF,               // Display on
+};
+
+// 8 pages of 128 columns, each byte is 8 pixels down with bit 0 on top
+static uint8_t frame[SCREEN_WIDTH * SCREEN_HEIGHT / 8];
+
+// Static, the machine is too big for the stack
+static chip8_t chip8;
+
+static void ssd1306_write(bool data, const uint8_t *bytes, size_t count) {
+    gpio_put(PIN_DC, data);
+    gpio_put(PIN_CS, 0);
+    spi_write_blocking(spi0, bytes, count);
+    gpio_put(PIN_CS, 1);
+}
+
+static void display_init(void) {
+    spi_init(spi0, 8000000);
+    gpio_set_function(PIN_SCK, GPIO_FUNC_SPI);
+    gpio_set_function(PIN_MOSI, GPIO_FUNC_SPI);
+
+    const uint8_t outputs[] = {PIN_CS, PIN_DC, PIN_RESET};
+    for(size_t i = 0; i < sizeof outputs; i++) {
+        gpio_init(outputs[i]);
+        gpio_set_dir(outputs[i], GPIO_OUT);
+        gpio_put(outputs[i], 1);
+    }
+
+    gpio_put(PIN_RESET, 0);
+    sleep_ms(10);
+    gpio_put(PIN_RESET, 1);
+    sleep_ms(10);
+
+    ssd1306_write(false, ssd1306_init, sizeof ssd1306_init);
+}
+
+// Copy the CHIP8 screen into the frame buffer and send it, any XO-CHIP plane lights a pixel
+static void display_draw(void) {
+    const uint32_t scale = SCREEN_WIDTH / chip8_display_width(&chip8);
+
+    for(uint32_t page = 0; page < SCREEN_HEIGHT / 8; page++) {
+        for(uint32_t x = 0; x < SCREEN_WIDTH; x++) {
+            uint8_t bits = 0;
+            for(uint32_t bit = 0; bit < 8; bit++)
+                if(chip8_pixel(&chip8, x / scale, (page * 8 + bit) / scale)) bits |= 1 << bit;
+            frame[page * SCREEN_WIDTH + x] = bits;
+        }
+    }
+
+    const uint8_t window[] = {0x21, 0, SCREEN_WIDTH - 1, 0x22, 0, SCREEN_HEIGHT / 8 - 1};
+    ssd1306_write(false, window, sizeof window);
+    ssd1306_write(true, frame, sizeof frame);
+}
+
+static void input_init(void) {
+    for(size_t i = 0; i < sizeof buttons / sizeof buttons[0]; i++) {
+        gpio_init(buttons[i].pin);
+        gpio_set_dir(buttons[i].pin, GPIO_IN);
+        gpio_pull_up(buttons[i].pin);
+    }
+}
+
+// Several buttons can press the same key, it's down while any of them is
+static void input_read(void) {
+    bool keys[16] = {false};
+
+    for(size_t i = 0; i < sizeof buttons / sizeof buttons[0]; i++)
+        if(!gpio_get(buttons[i].pin)) keys[buttons[i].key] = true;
+
+    for(uint8_t key = 0; key < 16; key++) chip8_set_key(&chip8, key, keys[key]);
+}
+
+// A square wave from PWM, switched on while the sound timer runs
+static void buzzer_init(void) {
+    gpio_set_function(PIN_BUZZER, GPIO_FUNC_PWM);
+
+    const uint slice = pwm_gpio_to_slice_num(PIN_BUZZER);
+    const uint32_t wrap = 10000;
+    pwm_set_clkdiv(slice, (float)clock_get_hz(clk_sys) / (BUZZER_HZ * wrap));
+    pwm_set_wrap(slice, wrap - 1);
+    pwm_set_gpio_level(PIN_BUZZER, 0);
+    pwm_set_enabled(slice, true);
+}
+
+static void buzzer_set(bool on) {
+    pwm_set_gpio_level(PIN_BUZZER, on ? 5000 : 0);
+}
+
+int main(void) {
+    display_init();
+    input_init();
+    buzzer_init();
+
+    chip8_init(&chip8);
+    if(!chip8_load_rom(&chip8, rom_data, sizeof rom_data)) {
+        // Too big for 4KB, most likely an XO-CHIP ROM
+        chip8_set_xochip(&chip8, true);
+        if(!chip8_load_rom(&chip8, rom_data, sizeof rom_data)) return 1;
+    }
+
+    // 60 frames a second, 16667us each, at the default 700 instructions per second
+    absolute_time_t next_frame = get_absolute_time();
+    while(chip8.fault == CHIP8_FAULT_NONE) {
+        input_read();
+        if(chip8.state == QUIT) chip8_reset(&chip8);
+
+        if(chip8_run_frame(&chip8)) {
+            display_draw();
+            chip8_clear_dirty(&chip8);
+        }
+        buzzer_set(chip8_sound_active(&chip8));
+
+        next_frame = delayed_by_us(next_frame, 16667);
+        sleep_until(next_frame);
+    }
+
+    // Faulted, leave the last screen up with the buzzer off
+    buzzer_set(false);
+    for(;;) tight_loop_contents();
+}
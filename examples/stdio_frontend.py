@@ -0,0 +1,149 @@
+#!/usr/bin/env python3
+# Reference frontend for the stdio protocol, in plain Python with Tkinter and nothing to build
+# It starts the emulator with --renderer stdio, shows its frames in a window and sends the keyboard back.
+# The protocol is described in src/render_stdio.c and src/input_stdio.c
+#
+#   python3 examples/stdio_frontend.py [--chip8 src/chip8] [--scale 10] <rom> [emulator options]
+#
+# Keys are the usual 1234/QWER/ASDF/ZXCV keypad, Escape quits, Space pauses, F2 resets,
+# Backspace rewinds and Tab fast forwards while held
+import argparse
+import queue
+import subprocess
+import sys
+import threading
+import tkinter
+
+PROTOCOL_VERSION = 1
+
+KEYPAD = {
+    "1": 0x1, "2": 0x2, "3": 0x3, "4": 0xC,
+    "q": 0x4, "w": 0x5, "e": 0x6, "r": 0xD,
+    "a": 0x7, "s": 0x8, "d": 0x9, "f": 0xE,
+    "z": 0xA, "x": 0x0, "c": 0xB, "v": 0xF,
+}
+
+HOTKEYS = {"Escape": "quit", "space": "pause", "F2": "reset", "F5": "save-state", "F9": "load-state",
+           "F12": "screenshot", "bracketright": "speed-up", "bracketleft": "speed-down"}
+HELD = {"BackSpace": "rewind", "Tab": "turbo"}
+
+
+def read_messages(stream, messages):
+    """Emulator output as (kind, value) tuples on the queue, a None once it closes stdout"""
+    header = stream.readline().split()
+    if len(header) != 2 or header[0] != b"chip8-frontend" or int(header[1]) > PROTOCOL_VERSION:
+        print("Not a chip8 frontend stream, or a newer protocol version", file=sys.stderr)
+        messages.put(None)
+        return
+
+    for line in iter(stream.readline, b""):
+        kind, _, rest = line.rstrip(b"\n").partition(b" ")
+        if kind == b"frame":
+            width, height = (int(n) for n in rest.split())
+            messages.put(("frame", (width, height, stream.read(width * height * 3))))
+        elif kind == b"title":
+            messages.put(("title", rest.decode(errors="replace")))
+        elif kind == b"sound":
+            messages.put(("sound", rest == b"1"))
+        elif kind == b"bye":
+            break
+        # Anything else is from a newer version, skip it
+    messages.put(None)
+
+
+class Frontend:
+    def __init__(self, emulator, scale):
+        self.emulator = emulator
+        self.scale = scale
+        self.messages = queue.Queue()
+        self.held = set()
+        self.image = None
+
+        self.root = tkinter.Tk()
+        self.root.title("CHIP8 Emulator")
+        self.label = tkinter.Label(self.root, bg="black", borderwidth=0)
+        self.label.pack()
+        self.root.bind("<KeyPress>", lambda event: self.key(event, True))
+        self.root.bind("<KeyRelease>", lambda event: self.key(event, False))
+        self.root.bind("<FocusIn>", lambda event: self.send("focus down"))
+        self.root.bind("<FocusOut>", lambda event: self.send("focus up"))
+        self.root.protocol("WM_DELETE_WINDOW", lambda: self.send("quit"))
+
+        threading.Thread(target=read_messages, args=(emulator.stdout, self.messages), daemon=True).start()
+        self.root.after(5, self.poll)
+
+    def send(self, command):
+        try:
+            self.emulator.stdin.write(command.encode() + b"\n")
+            self.emulator.stdin.flush()
+        except BrokenPipeError:
+            pass
+
+    def key(self, event, pressed):
+        # Tk repeats held keys as release and press pairs, only changes go to the emulator
+        name = event.keysym.lower() if len(event.keysym) == 1 else event.keysym
+        if pressed == (name in self.held):
+            return
+        if pressed:
+            self.held.add(name)
+        else:
+            self.held.discard(name)
+
+        if name in KEYPAD:
+            self.send(f"key {KEYPAD[name]:x} {'down' if pressed else 'up'}")
+        elif name in HELD:
+            self.send(f"{HELD[name]} {'down' if pressed else 'up'}")
+        elif name in HOTKEYS and pressed:
+            self.send(HOTKEYS[name])
+
+    def show(self, width, height, rgb):
+        # A PPM image is the one format Tk reads without anything extra
+        ppm = b"P6 %d %d 255\n" % (width, height) + rgb
+        image = tkinter.PhotoImage(data=ppm, format="PPM")
+        zoom = max(1, self.scale * 64 // width)
+        self.image = image.zoom(zoom, zoom)
+        self.label.configure(image=self.image, width=width * zoom, height=height * zoom)
+
+    def poll(self):
+        # Only the newest frame is worth drawing when several came in between
+        frame = None
+        while True:
+            try:
+                message = self.messages.get_nowait()
+            except queue.Empty:
+                break
+            if message is None:
+                self.root.destroy()
+                return
+
+            kind, value = message
+            if kind == "frame":
+                frame = value
+            elif kind == "title":
+                self.root.title(value)
+            elif kind == "sound" and value:
+                self.root.bell()
+
+        if frame:
+            self.show(*frame)
+        self.root.after(5, self.poll)
+
+
+def main():
+    parser = argparse.ArgumentParser(description="CHIP8 frontend over the stdio protocol")
+    parser.add_argument("--chip8", default="./chip8", help="emulator to run (default ./chip8)")
+    parser.add_argument("--scale", type=int, default=10, help="window pixels per CHIP8 pixel (default 10)")
+    parser.add_argument("rom")
+    parser.add_argument("options", nargs=argparse.REMAINDER, help="passed on to the emulator")
+    args = parser.parse_args()
+
+    emulator = subprocess.Popen([args.chip8, "--renderer", "stdio", *args.options, args.rom],
+                                stdin=subprocess.PIPE, stdout=subprocess.PIPE)
+    Frontend(emulator, args.scale).root.mainloop()
+
+    emulator.stdin.close()
+    sys.exit(emulator.wait())
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,477 @@
+// libretro core for RetroArch and other libretro frontends, built with "make libretro" in src/
+// The frontend owns the window, timing, shaders, save state slots, rewind and netplay, this wraps
+// the emulator core and turns its display, buzzer and keypad into libretro video, audio and input
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <stdarg.h>
+#include <math.h>
+
+#include "libretro.h"
+#include "chip8.h"
+#include "romdb.h"
+#include "cheat.h"
+#include "octo.h"
+
+#define SAMPLE_RATE 44100
+#define FRAME_SAMPLES (SAMPLE_RATE / 60)
+#define TONE_HZ 440
+#define VOLUME 3000
+
+static retro_environment_t environment;
+static retro_video_refresh_t video_refresh;
+static retro_audio_sample_batch_t audio_batch;
+static retro_input_poll_t input_poll;
+static retro_input_state_t input_state;
+static retro_log_printf_t log_printf;
+
+static chip8_t chip8;
+static cheat_list_t cheats;
+static const romdb_entry_t *rom_entry;  // Database settings for the loaded ROM, NULL if it isn't known
+static bool mega_geometry;              // The frontend was last told about the Mega-Chip screen size
+static chip8_fault_t reported_fault;    // Only logged once
+
+static uint32_t pixels[CHIP8_MEGA_WIDTH*CHIP8_MEGA_HEIGHT];
+static int16_t samples[FRAME_SAMPLES * 2];
+
+// Buzzer state, the frontend's audio isn't part of save states
+static uint32_t tone_phase;         // Position in the tone period, a full period is 2^32
+static uint32_t pattern_pos;        // Position in the XO-CHIP pattern in 1/65536 samples
+static uint32_t sound_serial;       // Mega-Chip sound being played, see chip8_sound_t
+static uint64_t sound_pos;          // Position in it in 1/65536 samples
+
+// Background, foreground, XO-CHIP plane 2 and both planes, 0xRRGGBB like the frontend wants them
+static uint32_t colors[4] = {0x000000, 0xFFFFFF, 0xFF6600, 0x662200};
+
+// Core options, "auto" takes the ROM database's settings and the emulator defaults for unknown ROMs
+static const struct retro_variable variables[] = {
+    {"chip8_quirks", "Quirks; auto|modern|cosmac|schip|xochip"},
+    {"chip8_speed", "Instructions per second; auto|600|700|1000|1800|3000|10000|30000|60000"},
+    {NULL, NULL},
+};
+
+// Controllers get the usual directions 2/4/6/8 on the D-pad, 5 on A and 0 on B like the desktop build
+static const struct {
+    unsigned id;
+    uint8_t key;
+} buttons[] = {
+    {RETRO_DEVICE_ID_JOYPAD_UP, 0x2},
+    {RETRO_DEVICE_ID_JOYPAD_DOWN, 0x8},
+    {RETRO_DEVICE_ID_JOYPAD_LEFT, 0x4},
+    {RETRO_DEVICE_ID_JOYPAD_RIGHT, 0x6},
+    {RETRO_DEVICE_ID_JOYPAD_A, 0x5},
+    {RETRO_DEVICE_ID_JOYPAD_B, 0x0},
+};
+
+static const struct retro_input_descriptor input_descriptors[] = {
+    {0, RETRO_DEVICE_JOYPAD, 0, RETRO_DEVICE_ID_JOYPAD_UP, "Key 2"},
+    {0, RETRO_DEVICE_JOYPAD, 0, RETRO_DEVICE_ID_JOYPAD_DOWN, "Key 8"},
+    {0, RETRO_DEVICE_JOYPAD, 0, RETRO_DEVICE_ID_JOYPAD_LEFT, "Key 4"},
+    {0, RETRO_DEVICE_JOYPAD, 0, RETRO_DEVICE_ID_JOYPAD_RIGHT, "Key 6"},
+    {0, RETRO_DEVICE_JOYPAD, 0, RETRO_DEVICE_ID_JOYPAD_A, "Key 5"},
+    {0, RETRO_DEVICE_JOYPAD, 0, RETRO_DEVICE_ID_JOYPAD_B, "Key 0"},
+    {0, 0, 0, 0, NULL},
+};
+
+// The whole keypad on the keyboard, the same QWERTY layout as the desktop build
+// 123C         1234
+// 456D         qwer
+// 789E         asdf
+// A0BF         zxcv
+static const char keyboard[16] = {
+    [0x1] = '1', [0x2] = '2', [0x3] = '3', [0xC] = '4',
+    [0x4] = 'q', [0x5] = 'w', [0x6] = 'e', [0xD] = 'r',
+    [0x7] = 'a', [0x8] = 's', [0x9] = 'd', [0xE] = 'f',
+    [0xA] = 'z', [0x0] = 'x', [0xB] = 'c', [0xF] = 'v',
+};
+
+static void log_hook(void *userdata, chip8_log_level_t level, const char *subsystem, const char *message) {
+    (void)userdata;
+    static const enum retro_log_level levels[] = {
+        [CHIP8_LOG_DEBUG] = RETRO_LOG_DEBUG,
+        [CHIP8_LOG_INFO] = RETRO_LOG_INFO,
+        [CHIP8_LOG_WARN] = RETRO_LOG_WARN,
+        [CHIP8_LOG_ERROR] = RETRO_LOG_ERROR,
+    };
+
+    if(log_printf) log_printf(levels[level], "[CHIP-8] %s: %s\n", subsystem, message);
+    else fprintf(stderr, "[CHIP-8] %s: %s\n", subsystem, message);
+}
+
+static void log_core(enum retro_log_level level, const char *format, ...) {
+    char message[256];
+    va_list args;
+    va_start(args, format);
+    vsnprintf(message, sizeof message, format, args);
+    va_end(args);
+
+    if(log_printf) log_printf(level, "[CHIP-8] %s\n", message);
+    else fprintf(stderr, "[CHIP-8] %s\n", message);
+}
+
+// Value of a core option, NULL if the frontend doesn't have one
+static const char *option(const char *key) {
+    struct retro_variable variable = {.key = key};
+    if(!environment(RETRO_ENVIRONMENT_GET_VARIABLE, &variable)) return NULL;
+    return variable.value;
+}
+
+// Quirks and speed from the options, the ROM database or the defaults, in that order
+// Changing an option in the frontend's menu applies it to the running game
+static void apply_options(void) {
+    const char *quirks = option("chip8_quirks");
+    if(!quirks || strcmp(quirks, "auto") == 0) quirks = rom_entry ? rom_entry->quirks : chip8.xochip ? "xochip" : "modern";
+    chip8_quirks_preset(quirks, &chip8.quirks);
+
+    const char *speed = option("chip8_speed");
+    uint32_t insts_per_second = rom_entry && rom_entry->insts_per_second ? rom_entry->insts_per_second : 700;
+    if(speed && strcmp(speed, "auto") != 0) insts_per_second = (uint32_t)strtoul(speed, NULL, 10);
+    chip8_set_speed(&chip8, insts_per_second);
+}
+
+RETRO_API void retro_set_environment(retro_environment_t callback) {
+    environment = callback;
+    environment(RETRO_ENVIRONMENT_SET_VARIABLES, (void *)variables);
+}
+
+RETRO_API void retro_set_video_refresh(retro_video_refresh_t callback) {
+    video_refresh = callback;
+}
+
+// The buzzer goes out a frame at a time through the batch callback
+RETRO_API void retro_set_audio_sample(retro_audio_sample_t callback) {
+    (void)callback;
+}
+
+RETRO_API void retro_set_audio_sample_batch(retro_audio_sample_batch_t callback) {
+    audio_batch = callback;
+}
+
+RETRO_API void retro_set_input_poll(retro_input_poll_t callback) {
+    input_poll = callback;
+}
+
+RETRO_API void retro_set_input_state(retro_input_state_t callback) {
+    input_state = callback;
+}
+
+RETRO_API void retro_init(void) {
+    struct retro_log_callback log;
+    log_printf = environment && environment(RETRO_ENVIRONMENT_GET_LOG_INTERFACE, &log) ? log.log : NULL;
+}
+
+RETRO_API void retro_deinit(void) {
+    log_printf = NULL;
+}
+
+RETRO_API unsigned retro_api_version(void) {
+    return RETRO_API_VERSION;
+}
+
+RETRO_API void retro_get_system_info(struct retro_system_info *info) {
+    *info = (struct retro_system_info) {
+        .library_name = "CHIP-8",
+        .library_version = "1.0",
+        .valid_extensions = "ch8|c8|sc8|xo8|mc8|o8",
+        .need_fullpath = false,
+        .block_extract = false,
+    };
+}
+
+// Mega-Chip ROMs get its 256x192 screen, everything else the SUPER-CHIP 128x64 one, lores is drawn at that size
+static struct retro_game_geometry geometry(void) {
+    if(chip8.megachip && chip8.mega) {
+        return (struct retro_game_geometry) {
+            .base_width = CHIP8_MEGA_WIDTH,
+            .base_height = CHIP8_MEGA_HEIGHT,
+            .max_width = CHIP8_MEGA_WIDTH,
+            .max_height = CHIP8_MEGA_HEIGHT,
+            .aspect_ratio = (float)CHIP8_MEGA_WIDTH / CHIP8_MEGA_HEIGHT,
+        };
+    }
+
+    return (struct retro_game_geometry) {
+        .base_width = CHIP8_HIRES_WIDTH,
+        .base_height = CHIP8_HIRES_HEIGHT,
+        .max_width = chip8.megachip ? CHIP8_MEGA_WIDTH : CHIP8_HIRES_WIDTH,
+        .max_height = chip8.megachip ? CHIP8_MEGA_HEIGHT : CHIP8_HIRES_HEIGHT,
+        .aspect_ratio = 2.0f,
+    };
+}
+
+RETRO_API void retro_get_system_av_info(struct retro_system_av_info *info) {
+    info->geometry = geometry();
+    info->timing = (struct retro_system_timing) {.fps = 60.0, .sample_rate = SAMPLE_RATE};
+}
+
+RETRO_API void retro_set_controller_port_device(unsigned port, unsigned device) {
+    (void)port;
+    (void)device;
+}
+
+RETRO_API void retro_reset(void) {
+    chip8_reset(&chip8);
+    cheat_attach(&cheats, &chip8);
+}
+
+static void read_input(void) {
+    input_poll();
+
+    bool keys[16] = {false};
+    for(size_t i = 0; i < sizeof buttons / sizeof buttons[0]; i++)
+        if(input_state(0, RETRO_DEVICE_JOYPAD, 0, buttons[i].id)) keys[buttons[i].key] = true;
+    for(uint8_t key = 0; key < 16; key++)
+        if(input_state(0, RETRO_DEVICE_KEYBOARD, 0, (unsigned char)keyboard[key])) keys[key] = true;
+
+    for(uint8_t key = 0; key < 16; key++) chip8_set_key(&chip8, key, keys[key]);
+}
+
+// The display is sent as it is, SUPER-CHIP hires at 128x64 and lores at 64x32, the frontend scales both
+// to the same geometry. Mega-Chip screens tell the frontend about their size when they switch on and off
+static void draw_screen(void) {
+    const uint32_t width = chip8_display_width(&chip8);
+    const uint32_t height = chip8_display_height(&chip8);
+
+    if(chip8.mega != mega_geometry) {
+        struct retro_game_geometry new_geometry = geometry();
+        environment(RETRO_ENVIRONMENT_SET_GEOMETRY, &new_geometry);
+        mega_geometry = chip8.mega;
+    }
+
+    for(uint32_t y = 0; y < height; y++) {
+        uint32_t *row = &pixels[y * width];
+        if(chip8.mega) {
+            // RGBA8888 to XRGB8888
+            for(uint32_t x = 0; x < width; x++) row[x] = chip8_mega_color(&chip8, x, y, colors[0] << 8 | 0xFF) >> 8;
+        } else {
+            const uint8_t *display = &chip8_display(&chip8)[y * width];
+            for(uint32_t x = 0; x < width; x++) row[x] = colors[display[x] & 0x3];
+        }
+    }
+
+    video_refresh(pixels, width, height, width * sizeof pixels[0]);
+}
+
+// One frame of the buzzer: the tone, or the XO-CHIP pattern once the ROM loaded one, while the sound timer
+// runs, with Mega-Chip digitized sounds mixed in
+static void play_audio(void) {
+    static const uint8_t empty[sizeof chip8.pattern] = {0};
+    const bool buzzer = chip8_sound_active(&chip8);
+    const bool pattern = chip8.xochip && memcmp(chip8.pattern, empty, sizeof empty) != 0;
+    const uint32_t pattern_step = (uint32_t)(4000.0 * pow(2.0, (chip8.pitch - 64) / 48.0) * 65536 / SAMPLE_RATE);
+
+    const chip8_sound_t *sound = &chip8.sound;
+    if(sound->serial != sound_serial) {
+        sound_serial = sound->serial;
+        sound_pos = 0;
+    }
+
+    for(uint32_t i = 0; i < FRAME_SAMPLES; i++) {
+        int32_t value = 0;
+
+        if(buzzer && pattern) {
+            // 128 one bit samples, the high bit of the first byte first
+            const uint32_t bit = (pattern_pos >> 16) & 127;
+            pattern_pos += pattern_step;
+            value = chip8.pattern[bit / 8] >> (7 - bit % 8) & 1 ? VOLUME : -VOLUME;
+        } else if(buzzer) {
+            value = tone_phase < 0x80000000u ? VOLUME : -VOLUME;
+            tone_phase += (uint32_t)(((uint64_t)TONE_HZ << 32) / SAMPLE_RATE);
+        }
+
+        if(sound->playing && sound->length > 0) {
+            uint64_t index = sound_pos >> 16;
+            if(index >= sound->length && sound->loop) {
+                sound_pos %= (uint64_t)sound->length << 16;
+                index = sound_pos >> 16;
+            }
+            if(index < sound->length) {
+                value += (chip8.ram[sound->addr + index] - 128) * VOLUME / 128;
+                sound_pos += ((uint64_t)sound->rate << 16) / SAMPLE_RATE;
+            }
+        }
+
+        const int16_t sample = value > INT16_MAX ? INT16_MAX : value < INT16_MIN ? INT16_MIN : value;
+        samples[i * 2] = sample;
+        samples[i * 2 + 1] = sample;
+    }
+
+    audio_batch(samples, FRAME_SAMPLES);
+}
+
+RETRO_API void retro_run(void) {
+    bool updated = false;
+    if(environment(RETRO_ENVIRONMENT_GET_VARIABLE_UPDATE, &updated) && updated) apply_options();
+
+    read_input();
+
+    // A ROM that exits starts over, one that faulted stays on its last screen
+    if(chip8.state == QUIT && chip8.fault == CHIP8_FAULT_NONE) chip8_reset(&chip8);
+    chip8_run_frame(&chip8);
+    cheat_apply(&cheats, &chip8);
+
+    if(chip8.fault != reported_fault) {
+        if(chip8.fault != CHIP8_FAULT_NONE) log_core(RETRO_LOG_ERROR, "Machine fault: %s", chip8_fault_name(chip8.fault));
+        reported_fault = chip8.fault;
+    }
+
+    draw_screen();
+    chip8_clear_dirty(&chip8);
+    play_audio();
+}
+
+// The size only depends on the memory size and Mega-Chip, both fixed while a game runs, as rewind and
+// netplay need
+RETRO_API size_t retro_serialize_size(void) {
+    return chip8_state_size(&chip8);
+}
+
+RETRO_API bool retro_serialize(void *data, size_t size) {
+    return chip8_serialize(&chip8, data, size) != 0;
+}
+
+RETRO_API bool retro_unserialize(const void *data, size_t size) {
+    if(!chip8_deserialize(&chip8, data, size)) return false;
+
+    cheat_apply(&cheats, &chip8);
+    return true;
+}
+
+RETRO_API void retro_cheat_reset(void) {
+    cheat_init(&cheats);
+}
+
+// Codes are "<addr>:<value>" in hex and hold the address at the value, several can be joined with +
+RETRO_API void retro_cheat_set(unsigned index, bool enabled, const char *code) {
+    char name[CHEAT_NAME_SIZE];
+    snprintf(name, sizeof name, "Cheat %u", index);
+    if(!enabled || !code) return;
+
+    while(*code) {
+        char *end = NULL;
+        const unsigned long addr = strtoul(code, &end, 16);
+        if(end == code || *end != ':') break;
+
+        const char *value_start = end + 1;
+        const unsigned long value = strtoul(value_start, &end, 16);
+        if(end == value_start || addr >= CHIP8_XO_RAM_SIZE || value > 0xFF) break;
+
+        if(!cheat_add(&cheats, true, (uint16_t)addr, (uint8_t)value, name)) {
+            log_core(RETRO_LOG_WARN, "Only %u cheats fit, %s is left out", CHEAT_MAX, name);
+            return;
+        }
+
+        code = *end == '+' ? end + 1 : end;
+    }
+
+    if(*code) log_core(RETRO_LOG_WARN, "Invalid cheat code %s, expected <addr>:<value> in hex", code);
+    cheat_apply(&cheats, &chip8);
+}
+
+// Octo source is assembled first, the assembler needs it as a string
+static bool load_source(const struct retro_game_info *game) {
+    char *source = malloc(game->size + 1);
+    if(!source) return false;
+    memcpy(source, game->data, game->size);
+    source[game->size] = '\0';
+
+    uint8_t *rom = NULL;
+    size_t rom_size = 0;
+    const bool ok = octo_assemble(source, game->path ? game->path : "game.o8", &rom, &rom_size, NULL) &&
+                    chip8_load_rom(&chip8, rom, rom_size);
+    free(source);
+    free(rom);
+    return ok;
+}
+
+static bool has_extension(const char *path, const char *extension) {
+    const char *dot = path ? strrchr(path, '.') : NULL;
+    if(!dot) return false;
+
+    for(size_t i = 0; dot[i] || extension[i]; i++)
+        if((dot[i] | 0x20) != (extension[i] | 0x20)) return false;
+    return true;
+}
+
+RETRO_API bool retro_load_game(const struct retro_game_info *game) {
+    if(!game || !game->data) return false;
+
+    enum retro_pixel_format format = RETRO_PIXEL_FORMAT_XRGB8888;
+    if(!environment(RETRO_ENVIRONMENT_SET_PIXEL_FORMAT, &format)) {
+        log_core(RETRO_LOG_ERROR, "The frontend doesn't support XRGB8888");
+        return false;
+    }
+    environment(RETRO_ENVIRONMENT_SET_INPUT_DESCRIPTORS, (void *)input_descriptors);
+
+    const bool source = octo_is_source(game->path ? game->path : "");
+    rom_entry = source ? NULL : romdb_find(game->data, game->size);
+
+    // Platform from the database, else from the extension, ROMs too big for 4KB are XO-CHIP
+    const char *platform = rom_entry ? rom_entry->platform : "";
+    const bool megachip = strcmp(platform, "megachip") == 0 || has_extension(game->path, ".mc8");
+    const bool xochip = strcmp(platform, "xochip") == 0 || has_extension(game->path, ".xo8") ||
+                        (!source && game->size > CHIP8_RAM_SIZE - CHIP8_ENTRY_POINT);
+
+    chip8_init(&chip8);
+    chip8_set_log(&chip8, log_hook, NULL);
+    chip8_set_megachip(&chip8, megachip);
+    chip8_set_xochip(&chip8, xochip);
+    apply_options();
+
+    if(rom_entry && rom_entry->has_colors) {
+        colors[0] = rom_entry->bg_color >> 8;
+        colors[1] = rom_entry->fg_color >> 8;
+    } else {
+        colors[0] = 0x000000;
+        colors[1] = 0xFFFFFF;
+    }
+
+    if(!(source ? load_source(game) : chip8_load_rom(&chip8, game->data, game->size))) return false;
+
+    cheat_init(&cheats);
+    cheat_attach(&cheats, &chip8);
+    mega_geometry = false;
+    reported_fault = CHIP8_FAULT_NONE;
+    tone_phase = pattern_pos = 0;
+    sound_serial = chip8.sound.serial;
+    sound_pos = 0;
+
+    if(rom_entry) log_core(RETRO_LOG_INFO, "%s, %s quirks", rom_entry->title, rom_entry->quirks);
+    return true;
+}
+
+RETRO_API bool retro_load_game_special(unsigned game_type, const struct retro_game_info *info, size_t num_info) {
+    (void)game_type;
+    (void)info;
+    (void)num_info;
+    return false;
+}
+
+RETRO_API void retro_unload_game(void) {
+    chip8_init(&chip8);
+    rom_entry = NULL;
+}
+
+RETRO_API unsigned retro_get_region(void) {
+    return RETRO_REGION_NTSC;
+}
+
+// SUPER-CHIP high scores live in the RPL flags, as save RAM the frontend keeps them in the game's .srm file
+// System RAM is for the frontend's cheat search and achievements
+RETRO_API void *retro_get_memory_data(unsigned id) {
+    switch(id) {
+        case RETRO_MEMORY_SAVE_RAM: return chip8.rpl;
+        case RETRO_MEMORY_SYSTEM_RAM: return chip8.ram;
+    }
+    return NULL;
+}
+
+RETRO_API size_t retro_get_memory_size(unsigned id) {
+    switch(id) {
+        case RETRO_MEMORY_SAVE_RAM: return sizeof chip8.rpl;
+        case RETRO_MEMORY_SYSTEM_RAM: return chip8.ram_size;
+    }
+    return 0;
+}
@@ -0,0 +1,569 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <stdarg.h>
+#include <string.h>
+#include <ctype.h>
+
+#include "chip8.h"
+#include "asm.h"
+
+// Source syntax, one statement per line:
+//
+//   label:                 Labels end with a colon and may share a line with an instruction
+//   LD V0, 0x0C            Mnemonics and register names are case insensitive
+//   JP label               Addresses and constants are numbers (12, 0x0C, 0b1100) or labels
+//   LD I, LONG label       XO-CHIP 16 bit index load (F000 NNNN)
+//   LDHI 0x12345           Mega-Chip 24 bit index load (01NN NNNN)
+//   db 0xFF, 0x81          Data bytes
+//   dw 0x1234              Data words, big endian
+//   ; comment              Comments run to the end of the line
+
+#define MAX_OPERANDS   16
+#define MAX_LABEL_LEN  32
+
+typedef struct {
+    char name[MAX_LABEL_LEN];
+    uint16_t addr;
+} asm_label_t;
+
+// Assembler state, the source is assembled twice
+// Pass 1 only collects label addresses, pass 2 emits code and reports errors
+typedef struct {
+    const char *file_name;
+    int line;
+    int pass;
+    uint32_t pc;                // Address of the next emitted byte
+    uint32_t end;               // One past the highest emitted address
+    uint8_t *ram;
+    asm_label_t *labels;
+    size_t label_count;
+    size_t label_cap;
+    symbols_t *symbols;         // Lines are added in pass 2, NULL if not wanted
+    int errors;
+} asm_t;
+
+static void asm_error(asm_t *as, const char *fmt, ...) {
+    // Pass 1 sees the same problems again in pass 2, only report them once
+    if(as->pass != 2) return;
+
+    va_list args;
+    va_start(args, fmt);
+    fprintf(stderr, "%s:%d: error: ", as->file_name, as->line);
+    vfprintf(stderr, fmt, args);
+    fputc('\n', stderr);
+    va_end(args);
+
+    as->errors++;
+}
+
+static bool streq_nocase(const char *a, const char *b) {
+    while(*a && *b) {
+        if(toupper((unsigned char)*a) != toupper((unsigned char)*b)) return false;
+        a++;
+        b++;
+    }
+
+    return *a == *b;
+}
+
+static bool is_identifier(const char *str) {
+    if(!(isalpha((unsigned char)*str) || *str == '_')) return false;
+
+    for(str++; *str; str++)
+        if(!(isalnum((unsigned char)*str) || *str == '_')) return false;
+
+    return true;
+}
+
+static char *trim(char *str) {
+    while(isspace((unsigned char)*str)) str++;
+
+    char *end = str + strlen(str);
+    while(end > str && isspace((unsigned char)end[-1])) end--;
+    *end = '\0';
+
+    return str;
+}
+
+static const asm_label_t *find_label(const asm_t *as, const char *name) {
+    for(size_t i = 0; i < as->label_count; i++)
+        if(strcmp(as->labels[i].name, name) == 0) return &as->labels[i];
+
+    return NULL;
+}
+
+static void define_label(asm_t *as, const char *name) {
+    // Labels already have their address from pass 1
+    if(as->pass != 1) return;
+
+    if(strlen(name) >= MAX_LABEL_LEN) {
+        fprintf(stderr, "%s:%d: error: label %s is longer than %d characters\n",
+                as->file_name, as->line, name, MAX_LABEL_LEN - 1);
+        as->errors++;
+        return;
+    }
+
+    if(find_label(as, name)) {
+        fprintf(stderr, "%s:%d: error: label %s is already defined\n", as->file_name, as->line, name);
+        as->errors++;
+        return;
+    }
+
+    if(as->label_count >= as->label_cap) {
+        const size_t cap = as->label_cap ? as->label_cap * 2 : 64;
+        asm_label_t *labels = realloc(as->labels, cap * sizeof *labels);
+        if(!labels) {
+            fprintf(stderr, "Out of memory\n");
+            as->errors++;
+            return;
+        }
+
+        as->labels = labels;
+        as->label_cap = cap;
+    }
+
+    asm_label_t *label = &as->labels[as->label_count++];
+    strcpy(label->name, name);
+    label->addr = as->pc;
+}
+
+// V0-VF, returns -1 if str is not a register
+static int parse_register(const char *str) {
+    if((str[0] != 'V' && str[0] != 'v') || !isxdigit((unsigned char)str[1]) || str[2] != '\0') return -1;
+
+    return isdigit((unsigned char)str[1]) ? str[1] - '0' : toupper((unsigned char)str[1]) - 'A' + 10;
+}
+
+static int expect_register(asm_t *as, const char *str) {
+    const int reg = parse_register(str);
+    if(reg < 0) asm_error(as, "expected a register V0-VF, got '%s'", str);
+
+    return reg < 0 ? 0 : reg;
+}
+
+// Number or label, checked against max
+static uint32_t parse_value(asm_t *as, const char *str, uint32_t max) {
+    uint32_t value = 0;
+
+    if(is_identifier(str)) {
+        const asm_label_t *label = find_label(as, str);
+
+        // Forward references are unknown in pass 1, the size of the instruction doesn't depend on them
+        if(!label) {
+            asm_error(as, "undefined label %s", str);
+            return 0;
+        }
+
+        value = label->addr;
+    } else {
+        char *end = NULL;
+        const bool binary = str[0] == '0' && (str[1] == 'b' || str[1] == 'B');
+        const unsigned long num = strtoul(binary ? str + 2 : str, &end, binary ? 2 : 0);
+
+        if(str[0] == '\0' || str[0] == '-' || *end != '\0' || (binary && str[2] == '\0')) {
+            asm_error(as, "expected a number or label, got '%s'", str);
+            return 0;
+        }
+
+        value = num > UINT32_MAX ? UINT32_MAX : (uint32_t)num;
+    }
+
+    if(value > max) {
+        asm_error(as, "value %s (0x%X) out of range, maximum is 0x%X", str, value, max);
+        return 0;
+    }
+
+    return value;
+}
+
+static void emit_byte(asm_t *as, uint8_t byte) {
+    if(as->pc >= CHIP8_XO_RAM_SIZE) {
+        asm_error(as, "program does not fit in memory");
+        return;
+    }
+
+    as->ram[as->pc++] = byte;
+    if(as->pc > as->end) as->end = as->pc;
+}
+
+static void emit_word(asm_t *as, uint16_t word) {
+    emit_byte(as, word >> 8);
+    emit_byte(as, word & 0xFF);
+}
+
+static bool expect_operands(asm_t *as, const char *mnemonic, int count, int min, int max) {
+    if(count >= min && count <= max) return true;
+
+    if(min == max) asm_error(as, "%s takes %d operand%s, got %d", mnemonic, min, min == 1 ? "" : "s", count);
+    else           asm_error(as, "%s takes %d to %d operands, got %d", mnemonic, min, max, count);
+
+    return false;
+}
+
+// Register range "VX-VY" for SAVE/LOAD
+static uint16_t parse_range(asm_t *as, char *str) {
+    char *dash = strchr(str, '-');
+    if(!dash) {
+        asm_error(as, "expected a register range VX-VY, got '%s'", str);
+        return 0;
+    }
+
+    *dash = '\0';
+    const int x = expect_register(as, trim(str));
+    const int y = expect_register(as, trim(dash + 1));
+
+    return (x << 8) | (y << 4);
+}
+
+// LD has the most operand forms, dispatch on the destination and source
+static void assemble_ld(asm_t *as, char **ops) {
+    const int x = parse_register(ops[0]);
+    const int y = parse_register(ops[1]);
+
+    if(x >= 0) {
+        if(y >= 0)                           emit_word(as, 0x8000 | x << 8 | y << 4);
+        else if(streq_nocase(ops[1], "DT"))  emit_word(as, 0xF007 | x << 8);
+        else if(streq_nocase(ops[1], "K"))   emit_word(as, 0xF00A | x << 8);
+        else if(streq_nocase(ops[1], "[I]")) emit_word(as, 0xF065 | x << 8);
+        else if(streq_nocase(ops[1], "R"))   emit_word(as, 0xF085 | x << 8);
+        else                                 emit_word(as, 0x6000 | x << 8 | parse_value(as, ops[1], 0xFF));
+        return;
+    }
+
+    if(streq_nocase(ops[0], "I")) {
+        if((strncmp(ops[1], "LONG", 4) == 0 || strncmp(ops[1], "long", 4) == 0) && isspace((unsigned char)ops[1][4])) {
+            emit_word(as, 0xF000);
+            emit_word(as, parse_value(as, trim(ops[1] + 4), 0xFFFF));
+        } else {
+            emit_word(as, 0xA000 | parse_value(as, ops[1], 0xFFF));
+        }
+        return;
+    }
+
+    static const struct {
+        const char *dest;
+        uint16_t opcode;
+    } sources[] = {
+        {"DT",  0xF015},
+        {"ST",  0xF018},
+        {"F",   0xF029},
+        {"HF",  0xF030},
+        {"B",   0xF033},
+        {"[I]", 0xF055},
+        {"R",   0xF075},
+    };
+
+    for(size_t i = 0; i < sizeof sources / sizeof sources[0]; i++) {
+        if(streq_nocase(ops[0], sources[i].dest)) {
+            emit_word(as, sources[i].opcode | expect_register(as, ops[1]) << 8);
+            return;
+        }
+    }
+
+    asm_error(as, "invalid LD destination '%s'", ops[0]);
+    emit_word(as, 0);
+}
+
+static void assemble_instruction(asm_t *as, const char *mnemonic, char **ops, int count) {
+    // Instructions without operands
+    static const struct {
+        const char *name;
+        uint16_t opcode;
+    } plain[] = {
+        {"CLS",   0x00E0},
+        {"RET",   0x00EE},
+        {"SCR",   0x00FB},
+        {"SCL",   0x00FC},
+        {"EXIT",  0x00FD},
+        {"LOW",   0x00FE},
+        {"HIGH",  0x00FF},
+        {"AUDIO", 0xF002},
+        {"MEGAOFF", 0x0010},
+        {"MEGAON",  0x0011},
+        {"STOPSND", 0x0700},
+    };
+
+    // Mega-Chip instructions with a constant
+    static const struct {
+        const char *name;
+        uint16_t opcode;
+        uint32_t max;
+    } constant[] = {
+        {"SCRU",    0x00B0, 0xF},
+        {"LDPAL",   0x0200, 0xFF},
+        {"SPRW",    0x0300, 0xFF},
+        {"SPRH",    0x0400, 0xFF},
+        {"ALPHA",   0x0500, 0xFF},
+        {"DIGISND", 0x0600, 0x1},
+        {"BMODE",   0x0800, 0x5},
+        {"CCOL",    0x0900, 0xFF},
+    };
+
+    // VX, VY arithmetic
+    static const struct {
+        const char *name;
+        uint16_t opcode;
+    } alu[] = {
+        {"OR",   0x8001},
+        {"AND",  0x8002},
+        {"XOR",  0x8003},
+        {"SUB",  0x8005},
+        {"SUBN", 0x8007},
+    };
+
+    // Single register instructions
+    static const struct {
+        const char *name;
+        uint16_t opcode;
+    } single[] = {
+        {"SKP",   0xE09E},
+        {"SKNP",  0xE0A1},
+        {"PITCH", 0xF03A},
+    };
+
+    for(size_t i = 0; i < sizeof plain / sizeof plain[0]; i++) {
+        if(streq_nocase(mnemonic, plain[i].name)) {
+            if(expect_operands(as, mnemonic, count, 0, 0)) emit_word(as, plain[i].opcode);
+            else emit_word(as, 0);
+            return;
+        }
+    }
+
+    for(size_t i = 0; i < sizeof alu / sizeof alu[0]; i++) {
+        if(streq_nocase(mnemonic, alu[i].name)) {
+            if(expect_operands(as, mnemonic, count, 2, 2))
+                emit_word(as, alu[i].opcode | expect_register(as, ops[0]) << 8 | expect_register(as, ops[1]) << 4);
+            else emit_word(as, 0);
+            return;
+        }
+    }
+
+    for(size_t i = 0; i < sizeof constant / sizeof constant[0]; i++) {
+        if(streq_nocase(mnemonic, constant[i].name)) {
+            if(expect_operands(as, mnemonic, count, 1, 1))
+                emit_word(as, constant[i].opcode | parse_value(as, ops[0], constant[i].max));
+            else emit_word(as, 0);
+            return;
+        }
+    }
+
+    if(streq_nocase(mnemonic, "LDHI")) {
+        const uint32_t addr = expect_operands(as, mnemonic, count, 1, 1) ? parse_value(as, ops[0], 0xFFFFFF) : 0;
+        emit_word(as, 0x0100 | addr >> 16);
+        emit_word(as, addr & 0xFFFF);
+        return;
+    }
+
+    for(size_t i = 0; i < sizeof single / sizeof single[0]; i++) {
+        if(streq_nocase(mnemonic, single[i].name)) {
+            if(expect_operands(as, mnemonic, count, 1, 1))
+                emit_word(as, single[i].opcode | expect_register(as, ops[0]) << 8);
+            else emit_word(as, 0);
+            return;
+        }
+    }
+
+    // Everything else has operand dependent forms, each one emits exactly one instruction
+    // so addresses in pass 1 match pass 2 even with errors
+    uint16_t opcode = 0;
+
+    if(streq_nocase(mnemonic, "SCD") || streq_nocase(mnemonic, "SCU")) {
+        if(expect_operands(as, mnemonic, count, 1, 1))
+            opcode = (streq_nocase(mnemonic, "SCD") ? 0x00C0 : 0x00D0) | parse_value(as, ops[0], 0xF);
+    } else if(streq_nocase(mnemonic, "SYS") || streq_nocase(mnemonic, "CALL")) {
+        if(expect_operands(as, mnemonic, count, 1, 1))
+            opcode = (streq_nocase(mnemonic, "SYS") ? 0x0000 : 0x2000) | parse_value(as, ops[0], 0xFFF);
+    } else if(streq_nocase(mnemonic, "JP")) {
+        if(expect_operands(as, mnemonic, count, 1, 2)) {
+            if(count == 1)                       opcode = 0x1000 | parse_value(as, ops[0], 0xFFF);
+            else if(parse_register(ops[0]) == 0) opcode = 0xB000 | parse_value(as, ops[1], 0xFFF);
+            else asm_error(as, "JP with 2 operands only takes V0, got '%s'", ops[0]);
+        }
+    } else if(streq_nocase(mnemonic, "SE") || streq_nocase(mnemonic, "SNE")) {
+        const bool equal = streq_nocase(mnemonic, "SE");
+
+        if(expect_operands(as, mnemonic, count, 2, 2)) {
+            const int x = expect_register(as, ops[0]);
+            const int y = parse_register(ops[1]);
+
+            if(y >= 0) opcode = (equal ? 0x5000 : 0x9000) | x << 8 | y << 4;
+            else       opcode = (equal ? 0x3000 : 0x4000) | x << 8 | parse_value(as, ops[1], 0xFF);
+        }
+    } else if(streq_nocase(mnemonic, "SAVE") || streq_nocase(mnemonic, "LOAD")) {
+        if(expect_operands(as, mnemonic, count, 1, 1))
+            opcode = (streq_nocase(mnemonic, "SAVE") ? 0x5002 : 0x5003) | parse_range(as, ops[0]);
+    } else if(streq_nocase(mnemonic, "ADD")) {
+        if(expect_operands(as, mnemonic, count, 2, 2) && streq_nocase(ops[0], "I")) {
+            opcode = 0xF01E | expect_register(as, ops[1]) << 8;
+        } else if(count == 2) {
+            const int x = expect_register(as, ops[0]);
+            const int y = parse_register(ops[1]);
+
+            if(y >= 0) opcode = 0x8004 | x << 8 | y << 4;
+            else       opcode = 0x7000 | x << 8 | parse_value(as, ops[1], 0xFF);
+        }
+    } else if(streq_nocase(mnemonic, "SHR") || streq_nocase(mnemonic, "SHL")) {
+        // VY defaults to VX so the result doesn't depend on the shift quirk
+        if(expect_operands(as, mnemonic, count, 1, 2)) {
+            const int x = expect_register(as, ops[0]);
+            const int y = count == 2 ? expect_register(as, ops[1]) : x;
+
+            opcode = (streq_nocase(mnemonic, "SHR") ? 0x8006 : 0x800E) | x << 8 | y << 4;
+        }
+    } else if(streq_nocase(mnemonic, "RND")) {
+        if(expect_operands(as, mnemonic, count, 2, 2))
+            opcode = 0xC000 | expect_register(as, ops[0]) << 8 | parse_value(as, ops[1], 0xFF);
+    } else if(streq_nocase(mnemonic, "DRW")) {
+        if(expect_operands(as, mnemonic, count, 3, 3))
+            opcode = 0xD000 | expect_register(as, ops[0]) << 8 | expect_register(as, ops[1]) << 4 |
+                     parse_value(as, ops[2], 0xF);
+    } else if(streq_nocase(mnemonic, "PLANE")) {
+        if(expect_operands(as, mnemonic, count, 1, 1))
+            opcode = 0xF001 | parse_value(as, ops[0], 0x3) << 8;
+    } else if(streq_nocase(mnemonic, "LD")) {
+        if(expect_operands(as, mnemonic, count, 2, 2)) {
+            assemble_ld(as, ops);
+            return;
+        }
+    } else {
+        asm_error(as, "unknown instruction %s", mnemonic);
+    }
+
+    emit_word(as, opcode);
+}
+
+static void assemble_line(asm_t *as, char *line) {
+    // Strip comments
+    char *comment = strchr(line, ';');
+    if(comment) *comment = '\0';
+    line = trim(line);
+
+    // Optional label
+    char *colon = strchr(line, ':');
+    if(colon) {
+        *colon = '\0';
+        char *name = trim(line);
+
+        if(!is_identifier(name)) asm_error(as, "invalid label name '%s'", name);
+        else define_label(as, name);
+
+        line = trim(colon + 1);
+    }
+
+    if(*line == '\0') return;
+
+    // Mnemonic, then comma separated operands
+    char *mnemonic = line;
+    char *rest = line;
+    while(*rest && !isspace((unsigned char)*rest)) rest++;
+    if(*rest) *rest++ = '\0';
+    rest = trim(rest);
+
+    char *ops[MAX_OPERANDS];
+    int count = 0;
+
+    if(*rest) {
+        for(char *op = rest; op; ) {
+            char *comma = strchr(op, ',');
+            if(comma) *comma = '\0';
+
+            if(count == MAX_OPERANDS) {
+                asm_error(as, "too many operands, maximum is %d", MAX_OPERANDS);
+                break;
+            }
+
+            ops[count++] = trim(op);
+            op = comma ? comma + 1 : NULL;
+        }
+    }
+
+    for(int i = 0; i < count; i++) {
+        if(*ops[i] == '\0') {
+            asm_error(as, "empty operand");
+            return;
+        }
+    }
+
+    if(streq_nocase(mnemonic, "db")) {
+        if(count == 0) asm_error(as, "db needs at least one byte");
+        for(int i = 0; i < count; i++) emit_byte(as, parse_value(as, ops[i], 0xFF));
+    } else if(streq_nocase(mnemonic, "dw")) {
+        if(count == 0) asm_error(as, "dw needs at least one word");
+        for(int i = 0; i < count; i++) emit_word(as, parse_value(as, ops[i], 0xFFFF));
+    } else {
+        assemble_instruction(as, mnemonic, ops, count);
+    }
+}
+
+static void assemble_pass(asm_t *as, const char *source, int pass) {
+    as->pass = pass;
+    as->line = 0;
+    as->pc = CHIP8_ENTRY_POINT;
+    as->end = CHIP8_ENTRY_POINT;
+
+    for(const char *start = source; *start; ) {
+        const char *newline = strchr(start, '\n');
+        const size_t len = newline ? (size_t)(newline - start) : strlen(start);
+        char line[256];
+
+        as->line++;
+
+        if(len >= sizeof line) {
+            asm_error(as, "line is longer than %zu characters", sizeof line - 1);
+        } else {
+            memcpy(line, start, len);
+            line[len] = '\0';
+
+            const uint32_t line_pc = as->pc;
+            assemble_line(as, line);
+            if(pass == 2 && as->symbols && as->pc != line_pc && !symbols_add_line(as->symbols, line_pc, as->line))
+                as->errors++;
+        }
+
+        start += len + (newline ? 1 : 0);
+    }
+}
+
+bool asm_assemble(const char *source, const char *file_name, uint8_t **rom, size_t *rom_size, symbols_t *symbols) {
+    asm_t as = {
+        .file_name = file_name,
+        .ram = calloc(CHIP8_XO_RAM_SIZE, 1),
+        .symbols = symbols,
+    };
+
+    if(symbols) {
+        symbols_init(symbols);
+        snprintf(symbols->source, sizeof symbols->source, "%s", file_name);
+    }
+
+    if(!as.ram) {
+        fprintf(stderr, "Out of memory\n");
+        return false;
+    }
+
+    assemble_pass(&as, source, 1);
+    if(as.errors == 0) assemble_pass(&as, source, 2);
+
+    for(size_t i = 0; symbols && as.errors == 0 && i < as.label_count; i++)
+        if(!symbols_add_label(symbols, as.labels[i].addr, as.labels[i].name)) as.errors++;
+
+    if(as.errors > 0) {
+        fprintf(stderr, "%s: %d error%s\n", file_name, as.errors, as.errors == 1 ? "" : "s");
+        free(as.ram);
+        free(as.labels);
+        if(symbols) symbols_free(symbols);
+        return false;
+    }
+
+    if(symbols) symbols_sort(symbols);
+
+    *rom_size = as.end - CHIP8_ENTRY_POINT;
+    *rom = malloc(*rom_size ? *rom_size : 1);
+    if(*rom) memcpy(*rom, &as.ram[CHIP8_ENTRY_POINT], *rom_size);
+
+    free(as.ram);
+    free(as.labels);
+    return *rom != NULL;
+}
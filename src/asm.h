@@ -0,0 +1,16 @@
+#ifndef ASM_H
+#define ASM_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "symbols.h"
+
+// Assemble source in the raw mnemonic syntax written by disasm_program(), see asm.c
+// file_name is only used in error messages, errors are printed to stderr with line numbers
+// On success *rom is a malloc'd binary to be loaded at the entry point
+// symbols gets the labels and the line of each statement unless it's NULL, it's initialized here
+bool asm_assemble(const char *source, const char *file_name, uint8_t **rom, size_t *rom_size, symbols_t *symbols);
+
+#endif // ASM_H
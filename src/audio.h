@@ -0,0 +1,35 @@
+#ifndef AUDIO_H
+#define AUDIO_H
+
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "config.h"
+
+// Buzzer audio backend
+// Each backend fills out the function table, data holds the backend private state
+typedef struct audio audio_t;
+
+struct audio {
+    const char *name;
+    bool (*init)(audio_t *audio, const config_t *config);
+    void (*set_playing)(audio_t *audio, bool playing);  // Start/stop the buzzer
+    // Optional, may be NULL: play 8 bit unsigned samples along with the buzzer, NULL samples stop it
+    // The samples are copied, they only have to stay around for the call
+    void (*play_sound)(audio_t *audio, const uint8_t *samples, uint32_t length, uint32_t rate, bool loop);
+    // Optional, may be NULL: the buzzer plays the 128 bit XO-CHIP pattern at 4000*2^((pitch-64)/48) Hz
+    // instead of its tone, NULL goes back to the tone
+    void (*set_pattern)(audio_t *audio, const uint8_t pattern[16], uint8_t pitch);
+    void (*set_volume)(audio_t *audio, int16_t volume); // Optional, may be NULL: the volume hotkeys
+    // Optional, may be NULL: a 60Hz frame of emulated time went by, for backends that aren't on a clock of their own
+    void (*frame)(audio_t *audio);
+    void (*cleanup)(audio_t *audio);
+    void *data;
+};
+
+// Available backends
+void sdl_audio(audio_t *audio);
+void null_audio(audio_t *audio);
+void wav_audio(audio_t *audio);     // To config->wav_path
+
+#endif // AUDIO_H
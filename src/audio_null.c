@@ -0,0 +1,28 @@
+#include <stdbool.h>
+
+#include "audio.h"
+
+// Silent backend, for --audio none and as the fallback without an audio device
+static bool null_audio_init(audio_t *audio, const config_t *config) {
+    (void)audio;
+    (void)config;
+    return true;
+}
+
+static void null_audio_set_playing(audio_t *audio, bool playing) {
+    (void)audio;
+    (void)playing;
+}
+
+static void null_audio_cleanup(audio_t *audio) {
+    (void)audio;
+}
+
+void null_audio(audio_t *audio) {
+    *audio = (audio_t) {
+        .name = "none",
+        .init = null_audio_init,
+        .set_playing = null_audio_set_playing,
+        .cleanup = null_audio_cleanup,
+    };
+}
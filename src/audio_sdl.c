@@ -0,0 +1,138 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <SDL.h>
+
+#include "audio.h"
+#include "buzzer.h"
+#include "log.h"
+
+// SDL audio device state, the buzzer is only touched with the device locked
+typedef struct {
+    SDL_AudioDeviceID device;   // 0 if not opened
+    buzzer_t buzzer;
+} sdl_audio_t;
+
+// SDL audio callback, fills the stream with the buzzer tone while it plays and mixes in the sound
+static void audio_callback(void *userdata, uint8_t *stream, int len) {
+    sdl_audio_t *sdl = userdata;
+
+    // 2 bytes per sample (int16_t)
+    buzzer_render(&sdl->buzzer, (int16_t *)stream, len / 2);
+}
+
+// The device only runs while there is something to play, the buzzer fading out counts
+static void update_device(sdl_audio_t *sdl) {
+    SDL_LockAudioDevice(sdl->device);
+    const bool idle = buzzer_idle(&sdl->buzzer);
+    SDL_UnlockAudioDevice(sdl->device);
+
+    SDL_PauseAudioDevice(sdl->device, idle);
+}
+
+static void sdl_audio_cleanup(audio_t *audio) {
+    sdl_audio_t *sdl = audio->data;
+    if(!sdl) return;
+
+    if(sdl->device != 0) SDL_CloseAudioDevice(sdl->device);
+
+    buzzer_free(&sdl->buzzer);
+    free(sdl);
+    audio->data = NULL;
+}
+
+static bool sdl_audio_init(audio_t *audio, const config_t *config) {
+    if(config->square_wave_freq == 0) {
+        log_write(CHIP8_LOG_ERROR, "audio", "Invalid square wave frequency %u", config->square_wave_freq);
+        return false;
+    }
+
+    sdl_audio_t *sdl = calloc(1, sizeof *sdl);
+    if(!sdl) return false;
+    audio->data = sdl;
+
+    SDL_AudioSpec want = {
+        .freq = config->audio_sample_rate,
+        .format = AUDIO_S16SYS,     // Signed 16 bit little/big endian
+        .channels = 1,              // Mono, 1 channel
+        .samples = 512,
+        .callback = audio_callback,
+        .userdata = sdl,
+    };
+    SDL_AudioSpec have = {0};
+
+    // The device starts paused, so the callback can't run before the buzzer is set up
+    sdl->device = SDL_OpenAudioDevice(NULL, 0, &want, &have, 0);
+    if(sdl->device == 0) {
+        log_write(CHIP8_LOG_ERROR, "audio", "Could not get an Audio Device %s", SDL_GetError());
+        sdl_audio_cleanup(audio);
+        return false;
+    }
+
+    if((want.format != have.format) || (want.channels != have.channels)) {
+        log_write(CHIP8_LOG_ERROR, "audio", "Could not get desired Audio Spec");
+        sdl_audio_cleanup(audio);
+        return false;
+    }
+
+    buzzer_init(&sdl->buzzer, config, have.freq);
+    return true;
+}
+
+// Device starts paused, this is called every frame so it also pauses it once a fade out is over
+static void sdl_audio_set_playing(audio_t *audio, bool playing) {
+    sdl_audio_t *sdl = audio->data;
+    if(!sdl) return;
+
+    SDL_LockAudioDevice(sdl->device);
+    sdl->buzzer.playing = playing;
+    SDL_UnlockAudioDevice(sdl->device);
+    update_device(sdl);
+}
+
+static void sdl_audio_set_volume(audio_t *audio, int16_t volume) {
+    sdl_audio_t *sdl = audio->data;
+    if(!sdl) return;
+
+    SDL_LockAudioDevice(sdl->device);
+    sdl->buzzer.volume = volume;
+    SDL_UnlockAudioDevice(sdl->device);
+}
+
+static void sdl_audio_set_pattern(audio_t *audio, const uint8_t pattern[16], uint8_t pitch) {
+    sdl_audio_t *sdl = audio->data;
+    if(!sdl) return;
+
+    SDL_LockAudioDevice(sdl->device);
+    buzzer_set_pattern(&sdl->buzzer, pattern, pitch);
+    SDL_UnlockAudioDevice(sdl->device);
+}
+
+static void sdl_audio_play_sound(audio_t *audio, const uint8_t *samples, uint32_t length, uint32_t rate, bool loop) {
+    sdl_audio_t *sdl = audio->data;
+    if(!sdl) return;
+
+    uint8_t *sound = samples && length > 0 && rate > 0 ? malloc(length) : NULL;
+    if(sound) memcpy(sound, samples, length);
+
+    SDL_LockAudioDevice(sdl->device);
+    uint8_t *old = buzzer_play_sound(&sdl->buzzer, sound, length, rate, loop);
+    SDL_UnlockAudioDevice(sdl->device);
+
+    free(old);
+    update_device(sdl);
+}
+
+void sdl_audio(audio_t *audio) {
+    *audio = (audio_t) {
+        .name = "sdl",
+        .init = sdl_audio_init,
+        .set_playing = sdl_audio_set_playing,
+        .play_sound = sdl_audio_play_sound,
+        .set_pattern = sdl_audio_set_pattern,
+        .set_volume = sdl_audio_set_volume,
+        .cleanup = sdl_audio_cleanup,
+    };
+}
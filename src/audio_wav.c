@@ -0,0 +1,139 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "audio.h"
+#include "buzzer.h"
+#include "log.h"
+
+// Offsets of the sizes the header leaves for when the file is complete
+#define WAV_RIFF_SIZE_OFFSET 4
+#define WAV_DATA_SIZE_OFFSET 40
+#define WAV_HEADER_SIZE      44
+
+// WAV file backend for --wav, 16 bit mono PCM in emulated time: every frame() renders 1/60 of a second
+typedef struct {
+    FILE *file;
+    const char *path;
+    buzzer_t buzzer;
+    uint32_t remainder;     // Samples per second left over from earlier frames, in 1/60ths
+    uint32_t data_size;     // Bytes of samples written so far
+    bool failed;
+} wav_audio_t;
+
+static void put_u16(uint8_t *out, uint16_t value) {
+    out[0] = value & 0xFF;
+    out[1] = value >> 8;
+}
+
+static void put_u32(uint8_t *out, uint32_t value) {
+    put_u16(out, value & 0xFFFF);
+    put_u16(out + 2, value >> 16);
+}
+
+static bool write_u32_at(FILE *file, long offset, uint32_t value) {
+    uint8_t bytes[4];
+    put_u32(bytes, value);
+    return fseek(file, offset, SEEK_SET) == 0 && fwrite(bytes, 1, sizeof bytes, file) == sizeof bytes;
+}
+
+static void wav_audio_cleanup(audio_t *audio) {
+    wav_audio_t *wav = audio->data;
+    if(!wav) return;
+
+    // The header's sizes were 0 until now, a file cut short still says how far it got
+    if(!wav->failed && (!write_u32_at(wav->file, WAV_RIFF_SIZE_OFFSET, WAV_HEADER_SIZE - 8 + wav->data_size) ||
+                        !write_u32_at(wav->file, WAV_DATA_SIZE_OFFSET, wav->data_size)))
+        wav->failed = true;
+    if(fclose(wav->file) != 0) wav->failed = true;
+    if(wav->failed) log_write(CHIP8_LOG_ERROR, "audio", "Could not write %s", wav->path);
+
+    buzzer_free(&wav->buzzer);
+    free(wav);
+    audio->data = NULL;
+}
+
+static bool wav_audio_init(audio_t *audio, const config_t *config) {
+    wav_audio_t *wav = calloc(1, sizeof *wav);
+    if(!wav) return false;
+
+    wav->path = config->wav_path;
+    wav->file = fopen(config->wav_path, "wb");
+    if(!wav->file) {
+        log_write(CHIP8_LOG_ERROR, "audio", "Could not open %s for writing", config->wav_path);
+        free(wav);
+        return false;
+    }
+
+    const uint32_t rate = config->audio_sample_rate;
+    uint8_t header[WAV_HEADER_SIZE] = "RIFF\0\0\0\0WAVEfmt ";
+    put_u32(&header[16], 16);           // fmt chunk size
+    put_u16(&header[20], 1);            // PCM
+    put_u16(&header[22], 1);            // Mono
+    put_u32(&header[24], rate);
+    put_u32(&header[28], rate * 2);     // Bytes per second
+    put_u16(&header[32], 2);            // Bytes per sample
+    put_u16(&header[34], 16);           // Bits per sample
+    memcpy(&header[36], "data", 4);
+
+    audio->data = wav;
+    buzzer_init(&wav->buzzer, config, rate);
+    if(fwrite(header, 1, sizeof header, wav->file) != sizeof header) wav->failed = true;
+    return true;
+}
+
+static void wav_audio_set_playing(audio_t *audio, bool playing) {
+    wav_audio_t *wav = audio->data;
+    if(wav) wav->buzzer.playing = playing;
+}
+
+static void wav_audio_set_pattern(audio_t *audio, const uint8_t pattern[16], uint8_t pitch) {
+    wav_audio_t *wav = audio->data;
+    if(wav) buzzer_set_pattern(&wav->buzzer, pattern, pitch);
+}
+
+static void wav_audio_play_sound(audio_t *audio, const uint8_t *samples, uint32_t length, uint32_t rate, bool loop) {
+    wav_audio_t *wav = audio->data;
+    if(!wav) return;
+
+    uint8_t *sound = samples && length > 0 && rate > 0 ? malloc(length) : NULL;
+    if(sound) memcpy(sound, samples, length);
+    free(buzzer_play_sound(&wav->buzzer, sound, length, rate, loop));
+}
+
+// Sample rates that aren't a multiple of 60 spread the extra samples over the frames
+static void wav_audio_frame(audio_t *audio) {
+    wav_audio_t *wav = audio->data;
+    if(!wav || wav->failed) return;
+
+    const uint32_t budget = wav->buzzer.sample_rate + wav->remainder;
+    const uint32_t count = budget / 60;
+    wav->remainder = budget % 60;
+
+    int16_t samples[1024];
+    uint8_t bytes[sizeof samples];
+    for(uint32_t done = 0; done < count && !wav->failed;) {
+        const uint32_t chunk = count - done < 1024 ? count - done : 1024;
+        buzzer_render(&wav->buzzer, samples, chunk);
+
+        for(uint32_t i = 0; i < chunk; i++) put_u16(&bytes[i * 2], (uint16_t)samples[i]);
+        if(fwrite(bytes, 2, chunk, wav->file) != chunk) wav->failed = true;
+
+        wav->data_size += chunk * 2;
+        done += chunk;
+    }
+}
+
+void wav_audio(audio_t *audio) {
+    *audio = (audio_t) {
+        .name = "wav",
+        .init = wav_audio_init,
+        .set_playing = wav_audio_set_playing,
+        .play_sound = wav_audio_play_sound,
+        .set_pattern = wav_audio_set_pattern,
+        .frame = wav_audio_frame,
+        .cleanup = wav_audio_cleanup,
+    };
+}
@@ -0,0 +1,20 @@
+#ifndef BUILTIN_H
+#define BUILTIN_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+// ROM compiled into the program, so there is always something to run without any files around
+typedef struct {
+    const char *name;
+    const uint8_t *data;
+    size_t size;
+} builtin_rom_t;
+
+extern const builtin_rom_t builtin_roms[];
+extern const size_t builtin_rom_count;
+
+// Returns NULL for unknown names
+const builtin_rom_t *builtin_find(const char *name);
+
+#endif // BUILTIN_H
@@ -0,0 +1,127 @@
+#include <stdlib.h>
+#include <string.h>
+#include <math.h>
+
+#include "buzzer.h"
+
+#define ENVELOPE_MAX (1u << 24)
+#define TWO_PI 6.28318530717958647692
+
+// Envelope change per sample for a fade over ms milliseconds, 0 is instant
+static uint32_t envelope_step(uint32_t ms, uint32_t sample_rate) {
+    const uint64_t samples = (uint64_t)ms * sample_rate / 1000;
+    return samples > 0 ? (uint32_t)(ENVELOPE_MAX / samples) + 1 : ENVELOPE_MAX;
+}
+
+void buzzer_init(buzzer_t *buzzer, const config_t *config, uint32_t sample_rate) {
+    *buzzer = (buzzer_t) {
+        .sample_rate = sample_rate,
+        .wave_freq = config->square_wave_freq,
+        .volume = config->muted ? 0 : config->volume,
+        .waveform = config->waveform,
+        .noise = 1,
+        .attack_step = envelope_step(config->attack_ms, sample_rate),
+        .release_step = envelope_step(config->release_ms, sample_rate),
+    };
+
+    // A wave above the Nyquist frequency can't be represented
+    if(buzzer->wave_freq * 2 > sample_rate) buzzer->wave_freq = sample_rate / 2;
+}
+
+void buzzer_free(buzzer_t *buzzer) {
+    free(buzzer->sound);
+    buzzer->sound = NULL;
+}
+
+void buzzer_set_pattern(buzzer_t *buzzer, const uint8_t pattern[16], uint8_t pitch) {
+    const double rate = 4000 * pow(2, (pitch - 64) / 48.0);
+
+    buzzer->pattern_on = pattern != NULL;
+    if(pattern) memcpy(buzzer->pattern, pattern, sizeof buzzer->pattern);
+    buzzer->pattern_step = (uint32_t)(rate * 65536 / buzzer->sample_rate);
+}
+
+uint8_t *buzzer_play_sound(buzzer_t *buzzer, uint8_t *sound, uint32_t length, uint32_t rate, bool loop) {
+    uint8_t *old = buzzer->sound;
+
+    buzzer->sound = sound;
+    buzzer->sound_length = length;
+    buzzer->sound_rate = rate;
+    buzzer->sound_loop = loop;
+    buzzer->sound_pos = 0;
+    return old;
+}
+
+bool buzzer_idle(const buzzer_t *buzzer) {
+    return !buzzer->playing && !buzzer->sound && buzzer->envelope == 0;
+}
+
+// Next output sample of the digitized sound, it's resampled by picking the nearest sample
+static int32_t sound_sample(buzzer_t *buzzer) {
+    uint32_t index = buzzer->sound_pos >> 16;
+
+    if(index >= buzzer->sound_length) {
+        if(!buzzer->sound_loop) return 0;
+        buzzer->sound_pos %= (uint64_t)buzzer->sound_length << 16;
+        index = buzzer->sound_pos >> 16;
+    }
+
+    buzzer->sound_pos += ((uint64_t)buzzer->sound_rate << 16) / buzzer->sample_rate;
+    return (buzzer->sound[index] - 128) * buzzer->volume / 128;
+}
+
+// Next sample of the tone or pattern at full volume, -1 to 1
+static double tone_sample(buzzer_t *buzzer) {
+    if(buzzer->pattern_on) {
+        // 128 one bit samples, the high bit of the first byte first
+        const uint32_t bit = (buzzer->pattern_pos >> 16) & 127;
+        buzzer->pattern_pos += buzzer->pattern_step;
+        return buzzer->pattern[bit / 8] >> (7 - bit % 8) & 1 ? 1.0 : -1.0;
+    }
+
+    const uint32_t phase = buzzer->phase;
+    buzzer->phase += (uint32_t)(((uint64_t)buzzer->wave_freq << 32) / buzzer->sample_rate);
+    const double t = phase / 4294967296.0;
+
+    switch(buzzer->waveform) {
+        case WAVE_SINE:
+            return sin(TWO_PI * t);
+        case WAVE_TRIANGLE:
+            return t < 0.5 ? 4 * t - 1 : 3 - 4 * t;
+        case WAVE_NOISE:
+            // A new random level every half period keeps the noise pitched at the tone frequency
+            if((phase ^ buzzer->phase) >> 31) {
+                buzzer->noise = buzzer->noise * 1103515245 + 12345;
+                buzzer->noise_value = (int32_t)(buzzer->noise >> 16 & 0x7FFF) - 0x4000;
+            }
+            return buzzer->noise_value / 16384.0;
+        case WAVE_SQUARE:
+            break;
+    }
+
+    return t < 0.5 ? 1.0 : -1.0;
+}
+
+// Fade in while the buzzer is on and out after it stopped
+static void step_envelope(buzzer_t *buzzer) {
+    if(buzzer->playing) {
+        buzzer->envelope = ENVELOPE_MAX - buzzer->envelope <= buzzer->attack_step ? ENVELOPE_MAX
+                                                                                  : buzzer->envelope + buzzer->attack_step;
+    } else {
+        buzzer->envelope = buzzer->envelope <= buzzer->release_step ? 0 : buzzer->envelope - buzzer->release_step;
+    }
+}
+
+// The buzzer tone while it plays with the sound mixed in
+void buzzer_render(buzzer_t *buzzer, int16_t *samples, size_t count) {
+    for(size_t i = 0; i < count; i++) {
+        int32_t value = 0;
+
+        step_envelope(buzzer);
+        if(buzzer->envelope > 0)
+            value = (int32_t)(tone_sample(buzzer) * buzzer->volume * buzzer->envelope / ENVELOPE_MAX);
+        if(buzzer->sound) value += sound_sample(buzzer);
+
+        samples[i] = value > INT16_MAX ? INT16_MAX : value < INT16_MIN ? INT16_MIN : value;
+    }
+}
@@ -0,0 +1,50 @@
+#ifndef BUZZER_H
+#define BUZZER_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "config.h"
+
+// Sample generator behind the audio backends: the buzzer tone or XO-CHIP pattern with its fade in and
+// out, and a Mega-Chip sound mixed in. Backends set playing and volume directly and call buzzer_render()
+// for as many samples as the output needs, the SDL one from its device callback
+typedef struct {
+    uint32_t sample_rate;
+    uint32_t wave_freq;         // Tone frequency in Hz
+    int16_t volume;             // Tone amplitude
+    waveform_t waveform;
+    uint32_t phase;             // Position in the current wave period, a full period is 2^32
+    uint32_t noise;             // Noise generator state
+    int32_t noise_value;        // Noise level for the current half period
+    uint32_t attack_step;       // Envelope change per sample, the envelope goes from 0 to 2^24
+    uint32_t release_step;
+    uint32_t envelope;
+    bool pattern_on;            // Play the XO-CHIP pattern instead of the tone
+    uint8_t pattern[16];
+    uint32_t pattern_step;      // Pattern samples per output sample, in 1/65536
+    uint32_t pattern_pos;       // Position in the pattern in 1/65536 samples
+    bool playing;
+    uint8_t *sound;             // Digitized sound being played, NULL for none
+    uint32_t sound_length;
+    uint32_t sound_rate;
+    bool sound_loop;
+    uint64_t sound_pos;         // Position in the sound in 1/65536 samples
+} buzzer_t;
+
+// Tone, volume and fades from the config, at the sample rate the output runs at
+void buzzer_init(buzzer_t *buzzer, const config_t *config, uint32_t sample_rate);
+void buzzer_free(buzzer_t *buzzer);
+
+// See set_pattern and play_sound in audio.h. play_sound takes over a malloc'd copy of the samples and hands
+// back the sound played before, so it can be freed outside of the device lock
+void buzzer_set_pattern(buzzer_t *buzzer, const uint8_t pattern[16], uint8_t pitch);
+uint8_t *buzzer_play_sound(buzzer_t *buzzer, uint8_t *sound, uint32_t length, uint32_t rate, bool loop);
+
+// Nothing playing and the fade out is over, the output can be silent
+bool buzzer_idle(const buzzer_t *buzzer);
+
+void buzzer_render(buzzer_t *buzzer, int16_t *samples, size_t count);
+
+#endif // BUZZER_H
@@ -0,0 +1,127 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <ctype.h>
+
+#include "cheat.h"
+
+void cheat_init(cheat_list_t *list) {
+    *list = (cheat_list_t) {0};
+}
+
+bool cheat_add(cheat_list_t *list, bool freeze, uint16_t addr, uint8_t value, const char *name) {
+    if(list->count == CHEAT_MAX) return false;
+
+    cheat_t *cheat = &list->cheats[list->count++];
+    *cheat = (cheat_t) {.addr = addr, .value = value, .freeze = freeze, .enabled = true};
+    snprintf(cheat->name, sizeof cheat->name, "%s", name ? name : "");
+    return true;
+}
+
+bool cheat_delete(cheat_list_t *list, size_t index) {
+    if(index >= list->count) return false;
+
+    // Kept in order, cheats are listed by their position
+    memmove(&list->cheats[index], &list->cheats[index + 1], (list->count - index - 1) * sizeof list->cheats[0]);
+    list->count--;
+    return true;
+}
+
+bool cheat_set_enabled(cheat_list_t *list, size_t index, bool enabled) {
+    if(index >= list->count) return false;
+
+    // Enabling a poke again writes it again
+    if(enabled && !list->cheats[index].enabled) list->cheats[index].applied = false;
+    list->cheats[index].enabled = enabled;
+    return true;
+}
+
+// The last enabled freeze of an address wins
+static uint8_t cheat_write_hook(void *userdata, uint16_t addr, uint8_t value) {
+    const cheat_list_t *list = userdata;
+
+    for(size_t i = 0; i < list->count; i++) {
+        const cheat_t *cheat = &list->cheats[i];
+        if(cheat->freeze && cheat->enabled && cheat->addr == addr) value = cheat->value;
+    }
+
+    return value;
+}
+
+void cheat_attach(cheat_list_t *list, chip8_t *chip8) {
+    chip8_set_memory_hooks(chip8, NULL, cheat_write_hook, list);
+    cheat_apply(list, chip8);
+}
+
+void cheat_apply(cheat_list_t *list, chip8_t *chip8) {
+    for(size_t i = 0; i < list->count; i++) {
+        cheat_t *cheat = &list->cheats[i];
+        if(!cheat->enabled || (!cheat->freeze && cheat->applied)) continue;
+
+        chip8_poke(chip8, cheat->addr, cheat->value);
+        cheat->applied = true;
+    }
+}
+
+bool cheat_load_file(cheat_list_t *list, const char *path, bool required) {
+    FILE *file = fopen(path, "r");
+    if(!file) {
+        if(required) fprintf(stderr, "Could not open cheat file %s\n", path);
+        cheat_init(list);
+        return !required;
+    }
+
+    cheat_list_t loaded;
+    char line[256];
+    uint32_t line_num = 0;
+    bool ok = true;
+
+    cheat_init(&loaded);
+
+    while(ok && fgets(line, sizeof line, file)) {
+        line_num++;
+        line[strcspn(line, "\r\n")] = '\0';
+
+        const char *c = line;
+        while(isspace((unsigned char)*c)) c++;
+        if(*c == '\0' || *c == '#') continue;
+
+        const bool enabled = *c != '-';
+        if(!enabled) c++;
+
+        char kind[8];
+        uint32_t addr, value;
+        int name_start = 0;
+        if(sscanf(c, "%7s %x %x %n", kind, &addr, &value, &name_start) < 3 || addr > 0xFFFF || value > 0xFF ||
+           (strcmp(kind, "freeze") != 0 && strcmp(kind, "poke") != 0)) {
+            fprintf(stderr, "%s:%u: expected freeze|poke <addr> <value> [name]\n", path, line_num);
+            ok = false;
+        } else if(!cheat_add(&loaded, kind[0] == 'f', addr, value, name_start ? &c[name_start] : "")) {
+            fprintf(stderr, "%s:%u: too many cheats, maximum is %d\n", path, line_num, CHEAT_MAX);
+            ok = false;
+        } else {
+            loaded.cheats[loaded.count - 1].enabled = enabled;
+        }
+    }
+
+    fclose(file);
+    if(ok) *list = loaded;
+    return ok;
+}
+
+bool cheat_save_file(const cheat_list_t *list, const char *path) {
+    FILE *file = fopen(path, "w");
+    if(!file) {
+        fprintf(stderr, "Could not open %s for writing\n", path);
+        return false;
+    }
+
+    fprintf(file, "# freeze|poke <addr> <value> [name], numbers in hex, - disables a cheat\n");
+    for(size_t i = 0; i < list->count; i++) {
+        const cheat_t *cheat = &list->cheats[i];
+        fprintf(file, "%s%s %03X %02X%s%s\n", cheat->enabled ? "" : "-", cheat->freeze ? "freeze" : "poke",
+                cheat->addr, cheat->value, cheat->name[0] ? " " : "", cheat->name);
+    }
+
+    return fclose(file) == 0;
+}
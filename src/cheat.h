@@ -0,0 +1,50 @@
+#ifndef CHEAT_H
+#define CHEAT_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+#define CHEAT_MAX       32
+#define CHEAT_NAME_SIZE 48
+
+// Memory cheat, a freeze holds an address at a value and a poke writes it once
+typedef struct {
+    uint16_t addr;
+    uint8_t value;
+    bool freeze;            // Otherwise a poke
+    bool enabled;
+    bool applied;           // The poke was written since it was last enabled
+    char name[CHEAT_NAME_SIZE]; // Description, may be empty
+} cheat_t;
+
+typedef struct {
+    cheat_t cheats[CHEAT_MAX];
+    size_t count;
+} cheat_list_t;
+
+void cheat_init(cheat_list_t *list);
+
+// Returns false if the list is full
+bool cheat_add(cheat_list_t *list, bool freeze, uint16_t addr, uint8_t value, const char *name);
+bool cheat_delete(cheat_list_t *list, size_t index);
+bool cheat_set_enabled(cheat_list_t *list, size_t index, bool enabled);
+
+// Hook the list into the machine's memory writes, so the ROM can't change frozen addresses,
+// and apply it. The list has to stay around until the hook is removed or the machine is reinitialized
+void cheat_attach(cheat_list_t *list, chip8_t *chip8);
+
+// Write pokes not applied yet and the frozen values, for memory changed around the hook
+// by loading a state or rewinding, call once per frame
+void cheat_apply(cheat_list_t *list, chip8_t *chip8);
+
+// Cheat files are text, one cheat per line, numbers in hex:
+//   freeze|poke <addr> <value> [name]
+// A leading - disables a cheat, # starts a comment line
+// A missing file is only an error if required, the list is left empty then
+bool cheat_load_file(cheat_list_t *list, const char *path, bool required);
+bool cheat_save_file(const cheat_list_t *list, const char *path);
+
+#endif // CHEAT_H
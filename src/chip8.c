@@ -1,65 +1,184 @@
+#include <stdarg.h>
 #include <stdio.h>
 #include <stdlib.h>
-#include <stdint.h>
-#include <stdbool.h>
-#include <time.h>
-#include <SDL.h>
+#include <string.h>
+
+#include "chip8.h"
+
+// Interpreter behaviour presets
+static const struct {
+    const char *name;
+    quirks_t quirks;
+} quirk_presets[] = {
+    // Behaviour most modern ROMs expect (default)
+    {"modern", {.shift_vx = true,  .increment_i = false, .jump_vx = false, .vf_reset = false, .clip_sprites = true,  .key_press = false,
+                .display_wait = false}},
+    // Original COSMAC VIP interpreter
+    {"cosmac", {.shift_vx = false, .increment_i = true,  .jump_vx = false, .vf_reset = true,  .clip_sprites = true,  .key_press = false,
+                .display_wait = true}},
+    // CHIP-48 / SUPER-CHIP on HP48 calculators
+    {"schip",  {.shift_vx = true,  .increment_i = false, .jump_vx = true,  .vf_reset = false, .clip_sprites = true,  .key_press = false,
+                .display_wait = false}},
+    // XO-CHIP as implemented by Octo
+    {"xochip", {.shift_vx = false, .increment_i = true,  .jump_vx = false, .vf_reset = false, .clip_sprites = false, .key_press = false,
+                .display_wait = false}},
+};
+
+// Set quirks from a preset name, returns false if there is no such preset
+bool chip8_quirks_preset(const char *name, quirks_t *quirks) {
+    for(size_t i = 0; i < sizeof quirk_presets / sizeof quirk_presets[0]; i++) {
+        if(strcmp(quirk_presets[i].name, name) == 0) {
+            *quirks = quirk_presets[i].quirks;
+            return true;
+        }
+    }
 
-// Emulator configuration
-typedef struct {
-    uint32_t window_width;
-    uint32_t window_height;
-    uint32_t bg_color;      // Background color RGBA
-    uint32_t fg_color;      // Foreground color RGBA
-    uint32_t scale_factor;  // Amount to scale a CHIP8 pixel
-    bool pixel_outlines;    // Sets pixel outlines
-} config_t;
-
-// Emulator states
-typedef enum {
-    QUIT,
-    RUNNING,
-    PAUSED,
-} emulator_state_t;
-
-// CHIP8 instruction format
-typedef struct {
-    uint16_t opcode;
-    uint16_t NNN;       // 12 bit address/constant
-    uint8_t NN;         // 8 bit constant
-    uint8_t N;          // 4 bit constant
-    uint8_t X;          // 4 bit register identifier
-    uint8_t Y;          // 4 bit register identifier
+    return false;
+}
 
-} instruction_t;
+// Machine code calls (0NNN) are counted as VIP instructions, they fault on every platform anyway
+chip8_platform_t chip8_opcode_platform(uint16_t opcode) {
+    const uint8_t X = (opcode >> 8) & 0xF;
 
-// CHIP8 machine 
-typedef struct {
-    emulator_state_t state;
-    uint8_t ram[4096];      // Random access memory
-    bool display[64*32];    // Original CHIP8 resolution 
-    uint16_t stack[12];     // Subrutine stacks
-    uint16_t *stack_ptr;    // Stack pointer
-    uint8_t V[16];          // Registers V0 - VF
-    uint16_t I;             // Index memory register
-    uint16_t PC;            // Program counter
-    uint8_t delay_timer;    // Decrements at 60Hz
-    uint8_t sound_timer;    // Decrements at 60Hz and plays a tone when > 0
-    bool keypad[16];        // Hexadecimal keypad 0x0 - 0xF
-    const char *rom_name;   // Currently running ROM
-    instruction_t inst;     // Currently executing instruction
-} chip8_t;
-
-// SDL container object
+    switch(opcode >> 12) {
+        case 0x0:
+            if((opcode & 0xFFF0) == 0x00C0 || (opcode >= 0x00FB && opcode <= 0x00FF)) return CHIP8_PLATFORM_SCHIP;
+            if((opcode & 0xFFF0) == 0x00D0) return CHIP8_PLATFORM_XOCHIP;
+            break;
+
+        case 0x5:
+            if((opcode & 0xF) == 0x2 || (opcode & 0xF) == 0x3) return CHIP8_PLATFORM_XOCHIP;
+            break;
+
+        case 0xD:
+            // Draws nothing on the VIP, a 16x16 sprite on SUPER-CHIP
+            if((opcode & 0xF) == 0x0) return CHIP8_PLATFORM_SCHIP;
+            break;
+
+        case 0xF:
+            switch(opcode & 0xFF) {
+                case 0x00: case 0x01: case 0x02: case 0x3A: return CHIP8_PLATFORM_XOCHIP;
+                case 0x30: return CHIP8_PLATFORM_SCHIP;
+                case 0x75: case 0x85: return X > 7 ? CHIP8_PLATFORM_XOCHIP : CHIP8_PLATFORM_SCHIP;
+            }
+            break;
+    }
+
+    return CHIP8_PLATFORM_VIP;
+}
+
+const char *chip8_platform_name(chip8_platform_t platform) {
+    switch(platform) {
+        case CHIP8_PLATFORM_ANY: return "any platform";
+        case CHIP8_PLATFORM_VIP: return "COSMAC VIP";
+        case CHIP8_PLATFORM_CHIP48: return "CHIP-48";
+        case CHIP8_PLATFORM_SCHIP: return "SUPER-CHIP";
+        case CHIP8_PLATFORM_XOCHIP: return "XO-CHIP";
+    }
+    return "unknown platform";
+}
+
+// Quirk names in the order of quirks_t
+static const struct {
+    const char *name;
+    size_t offset;
+} quirk_fields[CHIP8_QUIRK_COUNT] = {
+    {"shift",        offsetof(quirks_t, shift_vx)},
+    {"load_store",   offsetof(quirks_t, increment_i)},
+    {"jump",         offsetof(quirks_t, jump_vx)},
+    {"vf_reset",     offsetof(quirks_t, vf_reset)},
+    {"clipping",     offsetof(quirks_t, clip_sprites)},
+    {"key_press",    offsetof(quirks_t, key_press)},
+    {"display_wait", offsetof(quirks_t, display_wait)},
+};
+
+const char *chip8_quirk_name(size_t index) {
+    return index < CHIP8_QUIRK_COUNT ? quirk_fields[index].name : NULL;
+}
+
+bool chip8_quirk_enabled(const quirks_t *quirks, size_t index) {
+    return index < CHIP8_QUIRK_COUNT && *(const bool *)((const char *)quirks + quirk_fields[index].offset);
+}
+
+// Set a single quirk by name, returns false if there is no such quirk
+bool chip8_set_quirk(quirks_t *quirks, const char *name, bool enabled) {
+    for(size_t i = 0; i < CHIP8_QUIRK_COUNT; i++) {
+        if(strcmp(name, quirk_fields[i].name) != 0) continue;
+
+        *(bool *)((char *)quirks + quirk_fields[i].offset) = enabled;
+        return true;
+    }
+
+    return false;
+}
+
+// Opcode handlers, chip8->inst is decoded and PC already points past the instruction
+typedef void (*opcode_handler_t)(chip8_t *chip8);
+
+// Decode cache entry for one address, the handler is NULL until the instruction there is decoded
 typedef struct {
-    SDL_Window *window;
-    SDL_Renderer *renderer;
-} sdl_t;
+    opcode_handler_t handler;
+    instruction_t inst;
+} decoded_t;
+
+struct chip8_decode_cache {
+    decoded_t entries[CHIP8_XO_RAM_SIZE];
+};
+
+// Forget decoded instructions overlapping addr, the one starting at addr and the one before it
+static void invalidate_decoded(chip8_t *chip8, uint32_t addr) {
+    chip8->decode_cache->entries[addr].handler = NULL;
+    chip8->decode_cache->entries[(addr - 1) & (CHIP8_XO_RAM_SIZE - 1)].handler = NULL;
+}
+
+static void flush_decoded(chip8_t *chip8) {
+    if(chip8->decode_cache) memset(chip8->decode_cache, 0, sizeof *chip8->decode_cache);
+}
+
+void chip8_init(chip8_t *chip8) {
+    memset(chip8, 0, sizeof *chip8);    // Not a compound literal, that can end up as a temporary on the stack
+
+    // Settings, these are kept by chip8_reset()
+    chip8->ram_size = CHIP8_RAM_SIZE;
+    chip8->strict_memory = false;
+    chip8->insts_per_second = 700;
+    chip8_quirks_preset("modern", &chip8->quirks);
+    chip8_seed(chip8, 0);
+    memset(chip8->rpl, 0, sizeof chip8->rpl);
+
+    chip8_reset(chip8);
+}
+
+static void mark_written(chip8_t *chip8, uint32_t addr, size_t count) {
+    for(size_t i = 0; i < count; i++, addr++) chip8->written[addr / 8] |= 1 << (addr % 8);
+}
+
+static bool never_written(const chip8_t *chip8, uint32_t addr) {
+    return !(chip8->written[addr / 8] & 1 << (addr % 8));
+}
+
+// Memory at power on, before the fonts and the ROM go in. The random fill has its own generator so
+// CXNN gets the same numbers with any fill
+static void fill_ram(chip8_t *chip8) {
+    if(chip8->ram_fill != CHIP8_RAM_RANDOM) {
+        memset(chip8->ram, chip8->ram_fill == CHIP8_RAM_ONES ? 0xFF : 0, sizeof chip8->ram);
+        return;
+    }
 
-bool init_chip8(chip8_t *chip8, const char *rom_name) {
-    // CHIP8 roms will be loaded at 0x200
-    const uint16_t entry_point = 0x200; 
+    uint32_t x = (chip8->ram_seed + 1) * 2654435761u;
+    if(x == 0) x = 2654435761u;
+    for(size_t i = 0; i < sizeof chip8->ram; i++) {
+        x ^= x << 13;
+        x ^= x >> 17;
+        x ^= x << 5;
+        chip8->ram[i] = x >> 24;
+    }
+}
 
+// Power cycle the machine, the loaded ROM is copied back into memory
+// Quirks, XO-CHIP mode, the random number generator and the RPL flags are kept, the HP48 didn't lose
+// its flags when a program was restarted either
+void chip8_reset(chip8_t *chip8) {
     // Font specified for CHIP8 display
     const uint8_t font[] = {
         0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
@@ -80,306 +199,704 @@ bool init_chip8(chip8_t *chip8, const char *rom_name) {
         0xF0, 0x80, 0xF0, 0x80, 0x80  // F
     };
 
-    // Load font
-    memcpy(&chip8->ram[0], font, sizeof(font));
+    // SUPER-CHIP 8x10 font for digits 0-9
+    const uint8_t big_font[] = {
+        0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+        0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+        0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+        0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+        0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+        0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+        0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+        0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+        0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+        0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+    };
+
+    // Memory is the power on fill apart from the fonts and the ROM, which count as written for strict_init
+    fill_ram(chip8);
+    memset(chip8->written, 0, sizeof chip8->written);
+
+    // Load fonts into low memory (0x000 - 0x04F, big font 0x050 - 0x0B3)
+    memcpy(&chip8->ram[CHIP8_FONT_ADDR], font, sizeof(font));
+    memcpy(&chip8->ram[CHIP8_BIG_FONT_ADDR], big_font, sizeof(big_font));
+    mark_written(chip8, CHIP8_FONT_ADDR, sizeof(font));
+    mark_written(chip8, CHIP8_BIG_FONT_ADDR, sizeof(big_font));
+
+    memcpy(&chip8->ram[CHIP8_ENTRY_POINT], chip8->rom, chip8->rom_size);
+    mark_written(chip8, CHIP8_ENTRY_POINT, chip8->rom_size);
+    flush_decoded(chip8);
+
+    // Set CHIP8 machine defaults
+    memset(chip8->display, 0, sizeof chip8->display);
+    memset(chip8->stack, 0, sizeof chip8->stack);
+    memset(chip8->V, 0, sizeof chip8->V);
+    memset(chip8->keypad, 0, sizeof chip8->keypad);
+    memset(chip8->pattern, 0, sizeof chip8->pattern);
+    chip8->inst = (instruction_t) {0};
+    chip8->state = RUNNING;
+    chip8->fault = CHIP8_FAULT_NONE;
+    chip8->fault_addr = 0;
+    chip8->cycle_balance = 0;
+    chip8->PC = CHIP8_ENTRY_POINT;
+    chip8->I = 0;
+    chip8->delay_timer = 0;
+    chip8->sound_timer = 0;
+    chip8->wait_key = -1;
+    chip8->vblank_wait = false;
+    chip8->vblank = false;
+    chip8->stack_ptr = &chip8->stack[0];
+    chip8_set_dirty(chip8);
+    chip8->hires = false;
+    chip8->planes = 0x1;
+    chip8->pitch = 64;  // 4000Hz pattern playback
+
+    // Mega-Chip starts out in regular CHIP8 mode, colors are gray levels until 02NN loads a palette
+    memset(chip8->mega_display, 0, sizeof chip8->mega_display);
+    memset(chip8->mega_screen, 0, sizeof chip8->mega_screen);
+    for(uint32_t i = 0; i < 256; i++) chip8->palette[i] = 0xFF000000 | i * 0x010101;
+    chip8->mega = false;
+    chip8->sprite_width = 1;
+    chip8->sprite_height = 1;
+    chip8->screen_alpha = 0xFF;
+    chip8->blend = 0;
+    chip8->collision_color = 0;
+    chip8->sound = (chip8_sound_t) {.serial = chip8->sound.serial + 1};
+}
+
+// Pausing only has an effect on frontends, chip8_step() still runs when called
+void chip8_set_paused(chip8_t *chip8, bool paused) {
+    if(chip8->state != QUIT) chip8->state = paused ? PAUSED : RUNNING;
+}
+
+void chip8_seed(chip8_t *chip8, uint32_t seed) {
+    // xorshift gets stuck at 0, scramble the seed so small seeds don't start out similar
+    chip8->rng_state = (seed + 1) * 2654435761u;
+    if(chip8->rng_state == 0) chip8->rng_state = 2654435761u;
+}
+
+void chip8_set_rand_source(chip8_t *chip8, chip8_rand_t source, void *userdata) {
+    chip8->rand_source = source;
+    chip8->rand_userdata = userdata;
+}
+
+void chip8_set_memory_hooks(chip8_t *chip8, chip8_memory_hook_t read, chip8_memory_hook_t write, void *userdata) {
+    chip8->read_hook = read;
+    chip8->write_hook = write;
+    chip8->hook_userdata = userdata;
+}
+
+bool chip8_add_device(chip8_t *chip8, const chip8_device_t *device) {
+    if(device->first > device->last || chip8->device_count == CHIP8_MAX_DEVICES) return false;
+
+    chip8->devices[chip8->device_count++] = *device;
+    return true;
+}
+
+void chip8_clear_devices(chip8_t *chip8) {
+    chip8->device_count = 0;
+}
+
+void chip8_set_sys_hook(chip8_t *chip8, chip8_sys_hook_t hook, void *userdata) {
+    chip8->sys_hook = hook;
+    chip8->sys_userdata = userdata;
+}
+
+void chip8_set_step_hook(chip8_t *chip8, chip8_step_hook_t hook, void *userdata) {
+    chip8->step_hook = hook;
+    chip8->step_userdata = userdata;
+}
+
+void chip8_set_key_hook(chip8_t *chip8, chip8_key_hook_t hook, void *userdata) {
+    chip8->key_hook = hook;
+    chip8->key_userdata = userdata;
+}
+
+void chip8_set_log(chip8_t *chip8, chip8_log_t log, void *userdata) {
+    chip8->log = log;
+    chip8->log_userdata = userdata;
+}
+
+void chip8_set_instruction_log(chip8_t *chip8, bool enabled) {
+    chip8->log_instructions = enabled;
+}
+
+// Message to the log callback, or stdout/stderr like before there was one
+static void chip8_log(const chip8_t *chip8, chip8_log_level_t level, const char *subsystem, const char *fmt, ...) {
+    char message[256];
+    va_list args;
+
+    va_start(args, fmt);
+    vsnprintf(message, sizeof message, fmt, args);
+    va_end(args);
+
+    if(chip8->log) chip8->log(chip8->log_userdata, level, subsystem, message);
+    else fprintf(level == CHIP8_LOG_DEBUG ? stdout : stderr, "%s\n", message);
+}
+
+static uint8_t random_byte(chip8_t *chip8) {
+    if(chip8->rand_source) return chip8->rand_source(chip8->rand_userdata);
+
+    uint32_t x = chip8->rng_state;
+    x ^= x << 13;
+    x ^= x >> 17;
+    x ^= x << 5;
+    chip8->rng_state = x;
+
+    return x >> 24;
+}
+
+// Enable/disable XO-CHIP extensions: 64KB of memory, 2 display planes and audio patterns
+// Has to be called before loading a ROM
+void chip8_set_xochip(chip8_t *chip8, bool enabled) {
+    chip8->xochip = enabled;
+    chip8->ram_size = enabled || chip8->megachip ? CHIP8_XO_RAM_SIZE : CHIP8_RAM_SIZE;
+    flush_decoded(chip8);
+}
+
+// Enable/disable Mega-Chip extensions: 256x192 color mode, palettes and digitized sound
+// Mega-Chip addresses 24 bits of memory, here it gets the 64KB XO-CHIP has and bigger ROMs don't load
+// Has to be called before loading a ROM
+void chip8_set_megachip(chip8_t *chip8, bool enabled) {
+#ifdef CHIP8_NO_MEGACHIP
+    enabled = false;
+#endif
+    chip8->megachip = enabled;
+    chip8->ram_size = enabled || chip8->xochip ? CHIP8_XO_RAM_SIZE : CHIP8_RAM_SIZE;
+    flush_decoded(chip8);
+}
+
+// Strict memory faults on accesses past the end of memory and writes below 0x200 instead of wrapping
+void chip8_set_strict_memory(chip8_t *chip8, bool enabled) {
+    chip8->strict_memory = enabled;
+}
+
+// Power on memory for the next chip8_reset(), which this does right away for the ROM that's loaded
+// Trying ROMs on ones or random bytes finds the ones that only work because emulators clear memory
+void chip8_set_ram_fill(chip8_t *chip8, chip8_ram_fill_t fill, uint32_t seed) {
+    chip8->ram_fill = fill;
+    chip8->ram_seed = seed;
+    chip8_reset(chip8);
+}
+
+const char *chip8_ram_fill_name(chip8_ram_fill_t fill) {
+    switch(fill) {
+        case CHIP8_RAM_ZERO: return "zero";
+        case CHIP8_RAM_ONES: return "ff";
+        case CHIP8_RAM_RANDOM: return "random";
+    }
+    return "unknown";
+}
+
+// Strict init faults on reads of memory from 0x200 up that nothing wrote since the last reset: past the
+// ROM, that's whatever the fill left there. Instruction fetches count as reads
+void chip8_set_strict_init(chip8_t *chip8, bool enabled) {
+    chip8->strict_init = enabled;
+}
+
+// Instructions per second for chip8_run_frame(), kept by chip8_reset()
+void chip8_set_speed(chip8_t *chip8, uint32_t insts_per_second) {
+    chip8->insts_per_second = insts_per_second;
+    chip8->frame_remainder = 0;
+}
+
+// The VIP timing replaces insts_per_second, instructions that take longer make for fewer per frame
+void chip8_set_timing(chip8_t *chip8, chip8_timing_t timing) {
+    chip8->timing = timing;
+    chip8->cycle_balance = 0;
+}
+
+bool chip8_set_decode_cache(chip8_t *chip8, bool enabled) {
+    if(!enabled) {
+        free(chip8->decode_cache);
+        chip8->decode_cache = NULL;
+        return true;
+    }
+
+    if(!chip8->decode_cache) chip8->decode_cache = calloc(1, sizeof *chip8->decode_cache);
+    return chip8->decode_cache != NULL;
+}
+
+// Print why a ROM doesn't fit and what would make it fit, false if it does fit
+static bool rom_too_big(const chip8_t *chip8, const char *name, size_t rom_size) {
+    const size_t max_size = chip8->ram_size - CHIP8_ENTRY_POINT;
+    if(rom_size <= max_size) return false;
+
+    chip8_log(chip8, CHIP8_LOG_ERROR, "rom", "%s is too big: %zu bytes, but only %zu fit in memory from 0x%X", name,
+              rom_size, max_size, CHIP8_ENTRY_POINT);
+    if(rom_size <= CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT)
+        chip8_log(chip8, CHIP8_LOG_ERROR, "rom", "XO-CHIP ROMs can be up to %d bytes, run it with --xochip if it is one",
+                  CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT);
 
+    return true;
+}
+
+bool chip8_load_rom(chip8_t *chip8, const uint8_t *rom, size_t rom_size) {
+    if(rom_too_big(chip8, "ROM", rom_size)) return false;
+
+    // A copy is kept for chip8_reset()
+    memcpy(chip8->rom, rom, rom_size);
+    chip8->rom_size = rom_size;
+    memcpy(&chip8->ram[CHIP8_ENTRY_POINT], rom, rom_size);
+    mark_written(chip8, CHIP8_ENTRY_POINT, rom_size);
+    flush_decoded(chip8);
+
+    return true;
+}
+
+bool chip8_load_rom_file(chip8_t *chip8, const char *rom_name) {
     // Load ROM
     FILE *rom = fopen(rom_name, "rb");
 
     if(!rom) {
-        SDL_Log("Rom file %s is invalid or does not exist\n", rom_name);
+        chip8_log(chip8, CHIP8_LOG_ERROR, "rom", "Rom file %s is invalid or does not exist", rom_name);
         return false;
     }
 
     // Get ROM size
     fseek(rom, 0, SEEK_END);
     const size_t rom_size = ftell(rom); 
-    const size_t max_size = sizeof chip8->ram - entry_point;
     rewind(rom);
 
-    if(rom_size > max_size) {
-        SDL_Log("Rom file %s is too big, Rom size: %zu, Max size allowed: %zu\n", rom_name, rom_size, max_size);
+    if(rom_too_big(chip8, rom_name, rom_size)) {
+        fclose(rom);
         return false;
     }
 
-    if(fread(&chip8->ram[entry_point], rom_size, 1, rom) != 1) {
-        SDL_Log("Could not read ROM file %s into CHIP8 memory", rom_name);
+    // Read into a buffer first so a failed read leaves the machine as it was
+    uint8_t *data = malloc(rom_size + 1);
+    if(!data || (rom_size > 0 && fread(data, rom_size, 1, rom) != 1)) {
+        chip8_log(chip8, CHIP8_LOG_ERROR, "rom", "Could not read ROM file %s into CHIP8 memory", rom_name);
+        free(data);
+        fclose(rom);
         return false;
-    };
+    }
 
     fclose(rom);
 
-    // Set CHIP8 machine defaults
-    chip8->state = RUNNING;
-    chip8->PC = entry_point; 
+    chip8_load_rom(chip8, data, rom_size);
     chip8->rom_name = rom_name;
-    chip8->stack_ptr = &chip8->stack[0];
 
+    free(data);
     return true;
 }
 
-bool init_config(config_t *config, int argc, char **argv) {
+// Load the running ROM file again and reset, picks up changes after reassembling a ROM
+bool chip8_reload_rom_file(chip8_t *chip8) {
+    if(!chip8->rom_name || !chip8_load_rom_file(chip8, chip8->rom_name)) return false;
 
-    // Set defaults
-    *config = (config_t) {
-        .window_width = 64,
-        .window_height = 32,
-        .bg_color = 0x000000FF,
-        .fg_color = 0xFFFFFFFF,
-        .scale_factor = 20,
-        .pixel_outlines = false,
-    };
+    chip8_reset(chip8);
+    return true;
+}
 
-    //Override defaults from arguments
-    for (int i = 1; i < argc; i++) {
-        (void)argv[i]; // Prevent complier error
-    }
+// Clear the framebuffer, only the selected XO-CHIP planes are cleared
+void chip8_clear_display(chip8_t *chip8) {
+    for(size_t i = 0; i < sizeof chip8->display; i++)
+        chip8->display[i] &= ~chip8->planes;
 
-    return true;
+    chip8_set_dirty(chip8);
 }
 
-bool init_sdl(sdl_t *sdl, config_t *config) {
+// Current display resolution, 64x32, SUPER-CHIP 128x64 in hires mode or 256x192 in Mega-Chip mode
+uint32_t chip8_display_width(const chip8_t *chip8) {
+    if(chip8->mega) return CHIP8_MEGA_WIDTH;
+    return chip8->hires ? CHIP8_HIRES_WIDTH : CHIP8_DISPLAY_WIDTH;
+}
 
-    if(SDL_Init(SDL_INIT_VIDEO | SDL_INIT_AUDIO | SDL_INIT_TIMER) != 0) {
-        SDL_Log("Could not initalize SDL subsystems! %s\n", SDL_GetError());
-        return false;
+uint32_t chip8_display_height(const chip8_t *chip8) {
+    if(chip8->mega) return CHIP8_MEGA_HEIGHT;
+    return chip8->hires ? CHIP8_HIRES_HEIGHT : CHIP8_DISPLAY_HEIGHT;
+}
+
+bool chip8_row_dirty(const chip8_t *chip8, uint32_t y) {
+    return y < CHIP8_MEGA_HEIGHT && chip8->dirty_rows[y];
+}
+
+void chip8_clear_dirty(chip8_t *chip8) {
+    memset(chip8->dirty_rows, 0, sizeof chip8->dirty_rows);
+    chip8->draw = false;
+}
+
+void chip8_set_dirty(chip8_t *chip8) {
+    memset(chip8->dirty_rows, true, sizeof chip8->dirty_rows);
+    chip8->draw = true;
+}
+
+// Stop the machine, chip8_step() moves PC back to the faulting instruction
+// Only the first fault of an instruction is kept
+static void set_fault(chip8_t *chip8, chip8_fault_t fault) {
+    if(chip8->fault != CHIP8_FAULT_NONE) return;
+
+    chip8->fault = fault;
+    chip8->state = QUIT;
+}
+
+// Memory access for instructions, addresses past the end of memory wrap around
+// Both memory sizes are powers of two, masking is a lot cheaper than % in the hot path
+// With strict_memory they fault instead, and so do writes to the interpreter area below 0x200
+static uint8_t read_byte(chip8_t *chip8, uint32_t addr) {
+    if(chip8->strict_memory && addr >= chip8->ram_size) {
+        set_fault(chip8, CHIP8_FAULT_MEMORY_BOUNDS);
+        return 0;
     }
 
-    sdl->window = SDL_CreateWindow("CHIP8 Emulator", SDL_WINDOWPOS_CENTERED, SDL_WINDOWPOS_CENTERED, 
-                                    config->window_width * config->scale_factor,
-                                    config->window_height * config->scale_factor,
-                                    0); 
-    if(!sdl->window) {
-        SDL_Log("Could not create window %s\n", SDL_GetError());
-        return false;
+    addr &= chip8->ram_size - 1;
+    if(chip8->strict_init && addr >= CHIP8_ENTRY_POINT && never_written(chip8, addr)) {
+        if(chip8->fault == CHIP8_FAULT_NONE) chip8->fault_addr = addr;
+        set_fault(chip8, CHIP8_FAULT_UNINITIALIZED_READ);
     }
 
-    sdl->renderer = SDL_CreateRenderer(sdl->window, -1, SDL_RENDERER_ACCELERATED);
-    if(!sdl->renderer) {
-        SDL_Log("Could not create renderer %s\n", SDL_GetError());
-        return false;
+    return chip8->ram[addr];
+}
+
+// Devices see data reads on their way from memory, the first one added gets them first
+static uint8_t read_devices(chip8_t *chip8, uint16_t addr, uint8_t value) {
+    for(uint8_t i = 0; i < chip8->device_count; i++) {
+        const chip8_device_t *device = &chip8->devices[i];
+        if(device->read && addr >= device->first && addr <= device->last)
+            value = device->read(device->userdata, addr, value);
     }
 
-    return true;
+    return value;
 }
 
-void final_cleanup(sdl_t sdl) {
-    SDL_DestroyRenderer(sdl.renderer);
-    SDL_DestroyWindow(sdl.window);
-    SDL_Quit();
-}
-
-void clear_screen(const sdl_t sdl, const config_t config) {
-    const uint8_t r = (config.bg_color >> 24) & 0xFF;
-    const uint8_t g = (config.bg_color >> 16) & 0xFF;
-    const uint8_t b = (config.bg_color >>  8) & 0xFF;
-    const uint8_t a = (config.bg_color >>  0) & 0xFF;
-
-    SDL_SetRenderDrawColor(sdl.renderer, r, g, b, a);
-    SDL_RenderClear(sdl.renderer);
-}
-
-void update_screen(const sdl_t sdl, const config_t config, const chip8_t chip8) {
-    
-    // Rectangle to be drawn
-    SDL_Rect rect = {.x = 0, .y = 0, .w = config.scale_factor, .h = config.scale_factor};
-    
-    // Grab color values to draw
-    const uint8_t bg_r = (config.bg_color >> 24) & 0xFF;
-    const uint8_t bg_g = (config.bg_color >> 16) & 0xFF;
-    const uint8_t bg_b = (config.bg_color >>  8) & 0xFF;
-    const uint8_t bg_a = (config.bg_color >>  0) & 0xFF;
-
-    const uint8_t fg_r = (config.fg_color >> 24) & 0xFF;
-    const uint8_t fg_g = (config.fg_color >> 16) & 0xFF;
-    const uint8_t fg_b = (config.fg_color >>  8) & 0xFF;
-    const uint8_t fg_a = (config.fg_color >>  0) & 0xFF;
-
-    for(uint32_t i = 0; i < sizeof chip8.display; i++) {
-        // Translate 1D index i value to 2D X/Y coordinates
-        // X = i % window width
-        // Y = i / window width
-        rect.x = (i % config.window_width) * config.scale_factor;
-        rect.y = (i / config.window_width) * config.scale_factor;
-
-        if(chip8.display[i]) {
-            // Pixel is on, draw foreground color
-            SDL_SetRenderDrawColor(sdl.renderer, fg_r, fg_g, fg_b, fg_a);
-            SDL_RenderFillRect(sdl.renderer, &rect);
-
-            // If user requested drawing pixel outlines, draw those here 
-            if(config.pixel_outlines){
-                SDL_SetRenderDrawColor(sdl.renderer, bg_r, bg_g, bg_b, bg_a);
-                SDL_RenderDrawRect(sdl.renderer, &rect);
-            }
-        } else {
-            // Pixel is off, draw background color
-            SDL_SetRenderDrawColor(sdl.renderer, bg_r, bg_g, bg_b, bg_a);
-            SDL_RenderFillRect(sdl.renderer, &rect);
-        }
+// And writes on their way to memory, in the reverse order
+static uint8_t write_devices(chip8_t *chip8, uint16_t addr, uint8_t value) {
+    for(uint8_t i = chip8->device_count; i-- > 0;) {
+        const chip8_device_t *device = &chip8->devices[i];
+        if(device->write && addr >= device->first && addr <= device->last)
+            value = device->write(device->userdata, addr, value);
     }
 
-    SDL_RenderPresent(sdl.renderer);
+    return value;
 }
 
-// Handle user input
-// CHIP8 Keypad QWERTY 
-// 123C         1234
-// 456D         qwer   
-// 789E         asdf
-// A0BF         zxcv
+// Data reads go through the devices and the read hook, instruction fetches use read_byte() directly
+static uint8_t read_data(chip8_t *chip8, uint32_t addr) {
+    uint8_t value = read_byte(chip8, addr);
+    if(chip8->fault != CHIP8_FAULT_NONE) return value;
+
+    addr &= chip8->ram_size - 1;
+    if(chip8->device_count) value = read_devices(chip8, addr, value);
+    if(chip8->read_hook) value = chip8->read_hook(chip8->hook_userdata, addr, value);
+    return value;
+}
 
-void handle_input(chip8_t *chip8){
+static void write_byte(chip8_t *chip8, uint32_t addr, uint8_t value) {
+    if(chip8->strict_memory && addr >= chip8->ram_size) {
+        set_fault(chip8, CHIP8_FAULT_MEMORY_BOUNDS);
+    } else if(chip8->strict_memory && addr < CHIP8_ENTRY_POINT) {
+        set_fault(chip8, CHIP8_FAULT_PROTECTED_WRITE);
+    } else {
+        addr &= chip8->ram_size - 1;
+        if(chip8->write_hook) value = chip8->write_hook(chip8->hook_userdata, addr, value);
+        if(chip8->device_count) value = write_devices(chip8, addr, value);
+
+        chip8->ram[addr] = value;
+        mark_written(chip8, addr, 1);
+        if(chip8->decode_cache) invalidate_decoded(chip8, addr);
+    }
+}
 
-    SDL_Event event;
+// Switch between lores and hires mode, all planes are cleared on a mode switch
+static void set_hires(chip8_t *chip8, bool hires) {
+    chip8->hires = hires;
+    memset(&chip8->display[0], 0, sizeof chip8->display);
+    chip8_set_dirty(chip8);
+}
 
-    while(SDL_PollEvent(&event)) {
+// SUPER-CHIP scrolling, positive dx scrolls right and positive dy scrolls down
+// Pixels scrolled in from outside the screen are off, only the selected XO-CHIP planes move
+// Done in place, walking away from the direction of the scroll so every source pixel is read before it
+// changes, which keeps an 8KB copy of the screen off the small stacks of microcontrollers
+static void scroll_display(chip8_t *chip8, int32_t dx, int32_t dy) {
+    const int32_t width = chip8_display_width(chip8);
+    const int32_t height = chip8_display_height(chip8);
+
+    for(int32_t row = 0; row < height; row++) {
+        const int32_t y = dy > 0 ? height - 1 - row : row;
+
+        for(int32_t col = 0; col < width; col++) {
+            const int32_t x = dx > 0 ? width - 1 - col : col;
+            const int32_t src_x = x - dx;
+            const int32_t src_y = y - dy;
+            uint8_t *pixel = &chip8->display[y * width + x];
+
+            // Unselected planes stay where they are
+            uint8_t moved = 0;
+            if(src_x >= 0 && src_x < width && src_y >= 0 && src_y < height)
+                moved = chip8->display[src_y * width + src_x] & chip8->planes;
+
+            *pixel = (*pixel & ~chip8->planes) | moved;
+        }
+    }
 
-        switch(event.type) {
-        
-            case SDL_QUIT:
-                //Exit window. End program
-                chip8->state = QUIT;
-                return;
+    chip8_set_dirty(chip8);
+}
 
-            case SDL_KEYDOWN:
-
-                switch(event.key.keysym.sym) {
-
-                    case SDLK_ESCAPE:
-                        chip8->state = QUIT;
-                        return;
-
-                    case SDLK_SPACE:
-                        if(chip8->state == RUNNING) {
-                            chip8->state = PAUSED;
-                            puts("====PAUSED=====");
-                        } else {
-                            chip8->state = RUNNING;
-                            puts("====RESUME=====");
-                        } 
-                        return;
-
-                    // Map qwerty keys to CHIP8 keypad
-                    case SDLK_1: chip8->keypad[0x1] = true; break;
-                    case SDLK_2: chip8->keypad[0x2] = true; break;
-                    case SDLK_3: chip8->keypad[0x3] = true; break;
-                    case SDLK_4: chip8->keypad[0xC] = true; break;
-
-                    case SDLK_q: chip8->keypad[0x4] = true; break;
-                    case SDLK_w: chip8->keypad[0x5] = true; break;
-                    case SDLK_r: chip8->keypad[0x6] = true; break;
-                    case SDLK_t: chip8->keypad[0xD] = true; break;
-
-                    case SDLK_a: chip8->keypad[0x7] = true; break;
-                    case SDLK_s: chip8->keypad[0x8] = true; break;
-                    case SDLK_d: chip8->keypad[0x9] = true; break;
-                    case SDLK_f: chip8->keypad[0xE] = true; break;
-
-                    case SDLK_z: chip8->keypad[0xA] = true; break;
-                    case SDLK_x: chip8->keypad[0x0] = true; break;
-                    case SDLK_c: chip8->keypad[0xB] = true; break;
-                    case SDLK_v: chip8->keypad[0xF] = true; break;
-
-                    default:break;
-                    
+// Draw N-height sprite from memory location I at coords X,Y
+// Sprites are 8 pixels wide, SUPER-CHIP 16x16 sprites (DXY0) are 16 pixels wide with 2 bytes per row
+// Starting coordinates wrap around the screen, the sprite itself is clipped at the edges
+// unless the clip_sprites quirk is off, then it wraps around as well
+// With both XO-CHIP planes selected the plane 2 sprite data follows the plane 1 data
+// Returns true if any screen pixels are set off (collision)
+static bool draw_sprite(chip8_t *chip8, uint8_t x, uint8_t y, uint8_t width, uint8_t height) {
+    const uint32_t display_width = chip8_display_width(chip8);
+    const uint32_t display_height = chip8_display_height(chip8);
+    const uint8_t row_bytes = width / 8;
+    uint16_t sprite_addr = chip8->I;
+    bool collision = false;
+
+    for(uint8_t plane = 0x1; plane <= 0x2; plane <<= 1) {
+        if(!(chip8->planes & plane)) continue;
+
+        uint32_t X_coord = x % display_width;
+        uint32_t Y_coord = y % display_height;
+        const uint32_t orig_X = X_coord;
+
+        for(uint8_t i = 0; i < height; i++) {
+            // Get next row of sprite data, most significant bit is the leftmost pixel
+            uint16_t sprite_data = read_data(chip8, sprite_addr + i * row_bytes);
+            if(row_bytes == 2)
+                sprite_data = (sprite_data << 8) | read_data(chip8, sprite_addr + i * row_bytes + 1);
+
+            X_coord = orig_X; // Reset X for next row to draw
+            if(sprite_data) chip8->dirty_rows[Y_coord] = true;
+
+            for(int8_t j = width - 1; j >= 0; j--) {
+                // If sprite pixel/bit is on and display pixel is on, set collision
+                uint8_t *pixel = &chip8->display[Y_coord * display_width + X_coord];
+
+                const bool sprite_bit = (sprite_data & (1 << j));
+
+                if(sprite_bit && (*pixel & plane)) {
+                    collision = true;
                 }
-                break;
 
-            case SDL_KEYUP:
+                //XOR display pixel with sprite pixel/bit to set it off or  on
+                if(sprite_bit) *pixel ^= plane;
 
-                switch(event.key.keysym.sym) {
-                    // Map qwerty keys to CHIP8 keypad
-                    case SDLK_1: chip8->keypad[0x1] = false; break;
-                    case SDLK_2: chip8->keypad[0x2] = false; break;
-                    case SDLK_3: chip8->keypad[0x3] = false; break;
-                    case SDLK_4: chip8->keypad[0xC] = false; break;
+                // Stop drawing if hit right edge of the screen, or wrap to the left edge
+                if(++X_coord >= display_width) {
+                    if(chip8->quirks.clip_sprites) break;
+                    X_coord = 0;
+                }
 
-                    case SDLK_q: chip8->keypad[0x4] = false; break;
-                    case SDLK_w: chip8->keypad[0x5] = false; break;
-                    case SDLK_r: chip8->keypad[0x6] = false; break;
-                    case SDLK_t: chip8->keypad[0xD] = false; break;
+            }
 
-                    case SDLK_a: chip8->keypad[0x7] = false; break;
-                    case SDLK_s: chip8->keypad[0x8] = false; break;
-                    case SDLK_d: chip8->keypad[0x9] = false; break;
-                    case SDLK_f: chip8->keypad[0xE] = false; break;
+            // Stop drawing if hit bottom edge of the screen, or wrap to the top edge
+            if(++Y_coord >= display_height) {
+                if(chip8->quirks.clip_sprites) break;
+                Y_coord = 0;
+            }
 
-                    case SDLK_z: chip8->keypad[0xA] = false; break;
-                    case SDLK_x: chip8->keypad[0x0] = false; break;
-                    case SDLK_c: chip8->keypad[0xB] = false; break;
-                    case SDLK_v: chip8->keypad[0xF] = false; break;
+        }
 
-                    default: break;
-                }
-                break;
+        sprite_addr += height * row_bytes;
+    }
 
-            default:
-                break;
+    chip8->draw = true;
+
+    return collision;
+}
+
+// Switch Mega-Chip color mode on or off, both the color and the regular display start out blank
+static void set_mega(chip8_t *chip8, bool mega) {
+    chip8->mega = mega;
+    memset(chip8->mega_display, 0, sizeof chip8->mega_display);
+    memset(chip8->mega_screen, 0, sizeof chip8->mega_screen);
+    memset(chip8->display, 0, sizeof chip8->display);
+    chip8_set_dirty(chip8);
+}
+
+// Mega-Chip draws into a back buffer, 00E0 puts the finished frame on screen and starts a new one
+// Games redraw everything every frame, only rows that came out different are marked
+static void show_mega_frame(chip8_t *chip8) {
+    for(uint32_t y = 0; y < CHIP8_MEGA_HEIGHT; y++) {
+        uint8_t *row = &chip8->mega_screen[y * CHIP8_MEGA_WIDTH];
+        const uint8_t *drawn = &chip8->mega_display[y * CHIP8_MEGA_WIDTH];
+        if(memcmp(row, drawn, CHIP8_MEGA_WIDTH) == 0) continue;
+
+        memcpy(row, drawn, CHIP8_MEGA_WIDTH);
+        chip8->dirty_rows[y] = true;
+    }
+    memset(chip8->mega_display, 0, sizeof chip8->mega_display);
+    chip8->draw = true;
+}
+
+// Scroll the Mega-Chip frame being drawn, like scroll_display() pixels scrolled in are transparent
+static void scroll_mega(chip8_t *chip8, int32_t dx, int32_t dy) {
+    uint8_t scrolled[CHIP8_MEGA_WIDTH*CHIP8_MEGA_HEIGHT];
+
+    for(int32_t y = 0; y < CHIP8_MEGA_HEIGHT; y++) {
+        for(int32_t x = 0; x < CHIP8_MEGA_WIDTH; x++) {
+            const int32_t src_x = x - dx;
+            const int32_t src_y = y - dy;
+            const bool inside = src_x >= 0 && src_x < CHIP8_MEGA_WIDTH && src_y >= 0 && src_y < CHIP8_MEGA_HEIGHT;
+
+            scrolled[y * CHIP8_MEGA_WIDTH + x] = inside ? chip8->mega_display[src_y * CHIP8_MEGA_WIDTH + src_x] : 0;
+        }
+    }
+
+    memcpy(chip8->mega_display, scrolled, sizeof chip8->mega_display);
+}
+
+// Draw a Mega-Chip sprite at X,Y: sprite_width x sprite_height palette indexes from I, one byte per pixel
+// Index 0 is transparent and the sprite is clipped at the screen edges
+// Font sprites below 0x200 stay 1 bit sprites, N rows of 8 pixels (16x16 for N = 0) in color 255
+// Returns true if a pixel was drawn over one in the collision color, transparent index 0 never collides
+static bool draw_mega_sprite(chip8_t *chip8, uint8_t x, uint8_t y, uint8_t n) {
+    const bool font = chip8->I < CHIP8_ENTRY_POINT;
+    const uint32_t width = font ? (n == 0 ? 16 : 8) : chip8->sprite_width;
+    const uint32_t height = font ? (n == 0 ? 16 : n) : chip8->sprite_height;
+    bool collision = false;
+
+    for(uint32_t row = 0; row < height && y + row < CHIP8_MEGA_HEIGHT; row++) {
+        for(uint32_t col = 0; col < width && x + col < CHIP8_MEGA_WIDTH; col++) {
+            uint8_t color;
+
+            if(font) {
+                const uint8_t bits = read_data(chip8, chip8->I + row * (width / 8) + col / 8);
+                color = bits & (0x80 >> (col % 8)) ? 0xFF : 0;
+            } else {
+                color = read_data(chip8, chip8->I + row * width + col);
+            }
+            if(!color) continue;
+
+            uint8_t *pixel = &chip8->mega_display[(y + row) * CHIP8_MEGA_WIDTH + x + col];
+            if(chip8->collision_color && *pixel == chip8->collision_color) collision = true;
+            *pixel = color;
         }
     }
+
+    return collision;
+}
+
+// First word of an instruction that takes two words, XO-CHIP F000 NNNN and Mega-Chip 01NN NNNN
+static bool long_instruction(const chip8_t *chip8, uint16_t opcode) {
+    return (chip8->xochip && opcode == 0xF000) || (chip8->megachip && (opcode & 0xFF00) == 0x0100);
+}
+
+// Keypad as instructions see it, through the key hook
+static bool key_down(chip8_t *chip8, uint8_t key) {
+    const bool pressed = chip8->keypad[key & 0xF];
+    return chip8->key_hook ? chip8->key_hook(chip8->key_userdata, key & 0xF, pressed) : pressed;
 }
 
-#ifdef DEBUG
-void print_debug_info(chip8_t *chip8) {
+// Skip the next instruction, long instructions are 4 bytes
+static void skip_instruction(chip8_t *chip8) {
+    const uint32_t mask = chip8->ram_size - 1;
+    const uint16_t next = (chip8->ram[chip8->PC & mask] << 8) | chip8->ram[(chip8->PC + 1) & mask];
+
+    chip8->PC += long_instruction(chip8, next) ? 4 : 2;
+}
 
-    printf("Address: 0x%04X Opcode: 0x%04X Desc: ", chip8->PC-2, chip8->inst.opcode);
+static void print_debug_info(chip8_t *chip8) {
+    char desc[192] = "";
 
     switch ((chip8->inst.opcode >> 12) & 0x0F) {
         case 0x0:
-            if(chip8->inst.NN == 0xE0) {
-                // 0x0E0 Clear the screen
-                printf("Clear screen\n");
+            if(chip8->inst.opcode == 0x00E0) {
+                // 0x00E0 Clear the screen
+                snprintf(desc, sizeof desc, "Clear screen");
 
-            } else if (chip8->inst.NN == 0xEE) {
+            } else if (chip8->inst.opcode == 0x00EE) {
                 // 0x00EE Return from subrutine
                 //  Set program counter to last address on subrutine stack ("pop" it off the stack)
                 //  so that next opcode will be gotten from that address
-                printf("Return from subrutine address 0x%04X\n", *(chip8->stack_ptr-1));
+                // An empty stack faults instead, there's no address to print
+                if(chip8->stack_ptr == chip8->stack)
+                    snprintf(desc, sizeof desc, "Return from subrutine, stack empty");
+                else
+                    snprintf(desc, sizeof desc, "Return from subrutine address 0x%04X", *(chip8->stack_ptr-1));
+            } else if ((chip8->inst.opcode & 0xFFF0) == 0x00C0) {
+                snprintf(desc, sizeof desc, "Scroll display %u pixels down", chip8->inst.N);
+            } else if ((chip8->inst.opcode & 0xFFF0) == 0x00D0) {
+                snprintf(desc, sizeof desc, "Scroll display %u pixels up", chip8->inst.N);
+            } else if (chip8->inst.opcode == 0x00FB) {
+                snprintf(desc, sizeof desc, "Scroll display 4 pixels right");
+            } else if (chip8->inst.opcode == 0x00FC) {
+                snprintf(desc, sizeof desc, "Scroll display 4 pixels left");
+            } else if (chip8->inst.opcode == 0x00FD) {
+                snprintf(desc, sizeof desc, "Exit interpreter");
+            } else if (chip8->inst.opcode == 0x00FE) {
+                snprintf(desc, sizeof desc, "Disable hires mode (64x32)");
+            } else if (chip8->inst.opcode == 0x00FF) {
+                snprintf(desc, sizeof desc, "Enable hires mode (128x64)");
+            } else if (chip8->megachip && chip8->inst.opcode == 0x0010) {
+                snprintf(desc, sizeof desc, "Disable Mega-Chip mode");
+            } else if (chip8->megachip && chip8->inst.opcode == 0x0011) {
+                snprintf(desc, sizeof desc, "Enable Mega-Chip mode (256x192)");
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFFF0) == 0x00B0) {
+                snprintf(desc, sizeof desc, "Scroll display %u pixels up", chip8->inst.N);
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0100) {
+                snprintf(desc, sizeof desc, "Set I to the 24 bit address 0x%02X in the next word", chip8->inst.NN);
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0200) {
+                snprintf(desc, sizeof desc, "Load %u palette colors from memory at I (0x%04X)", chip8->inst.NN, chip8->I);
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0300) {
+                snprintf(desc, sizeof desc, "Set sprite width = %u", chip8->inst.NN ? chip8->inst.NN : 256);
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0400) {
+                snprintf(desc, sizeof desc, "Set sprite height = %u", chip8->inst.NN ? chip8->inst.NN : 256);
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0500) {
+                snprintf(desc, sizeof desc, "Set screen alpha = 0x%02X", chip8->inst.NN);
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0600) {
+                snprintf(desc, sizeof desc, "Play digitized sound at I (0x%04X)%s", chip8->I, chip8->inst.NN ? " once" : " in a loop");
+            } else if (chip8->megachip && chip8->inst.opcode == 0x0700) {
+                snprintf(desc, sizeof desc, "Stop digitized sound");
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0800) {
+                snprintf(desc, sizeof desc, "Set sprite blend mode %u", chip8->inst.NN);
+            } else if (chip8->megachip && (chip8->inst.opcode & 0xFF00) == 0x0900) {
+                snprintf(desc, sizeof desc, "Set collision color = %u", chip8->inst.NN);
             } else {
-                printf("Uninmplemented Opcode\n");
+                snprintf(desc, sizeof desc, "Uninmplemented Opcode");
             }
             break;
 
         case 0x01:
             //0x1NNN: Jump to the adress NNN
-            printf("Jump to addres NNN (0x%04X)\n", chip8->inst.NNN);
+            snprintf(desc, sizeof desc, "Jump to addres NNN (0x%04X)", chip8->inst.NNN);
             break;
 
         case 0x02:
             // 0x02NNN: Call subrutine at NNN
             // Store current address to return to on subrutine stack ("push" it on the stack)
             // and set program counter to subrutine address so that the next opcode is gotten from there
-            printf("Call subroutine at NNN (0x%04X)\n", chip8->inst.NNN);
+            snprintf(desc, sizeof desc, "Call subroutine at NNN (0x%04X)", chip8->inst.NNN);
             break;
 
         case 0x03:
             // If V[X] == NN, skip the next instruction
-            printf("If V%X (0x%02X) == NN (0x%02X), skip the next instruction\n", 
+            snprintf(desc, sizeof desc, "If V%X (0x%02X) == NN (0x%02X), skip the next instruction", 
                 chip8->inst.X, chip8->V[chip8->inst.X], chip8->inst.NN);
             break;
 
         case 0x04:
             // If V[X] != NN, skip the next instruction
-            printf("If V%X (0x%02X) != NN (0x%02X), skip the next instruction\n", 
+            snprintf(desc, sizeof desc, "If V%X (0x%02X) != NN (0x%02X), skip the next instruction", 
                 chip8->inst.X, chip8->V[chip8->inst.X], chip8->inst.NN);
             break;
             
         case 0x05:
-            // If V[X] != NN, skip the next instruction
-            printf("If V%X (0x%02X) == V%X (0x%02X), skip the next instruction\n", 
-                chip8->inst.X, chip8->V[chip8->inst.X], 
-                chip8->inst.Y, chip8->V[chip8->inst.Y]);
+            if(chip8->inst.N == 2) {
+                snprintf(desc, sizeof desc, "Store V%X-V%X inclusive at memory from I (0x%04X)", chip8->inst.X, chip8->inst.Y, chip8->I);
+            } else if(chip8->inst.N == 3) {
+                snprintf(desc, sizeof desc, "Load V%X-V%X inclusive from memory at I (0x%04X)", chip8->inst.X, chip8->inst.Y, chip8->I);
+            } else {
+                // If V[X] == V[Y], skip the next instruction
+                snprintf(desc, sizeof desc, "If V%X (0x%02X) == V%X (0x%02X), skip the next instruction", 
+                    chip8->inst.X, chip8->V[chip8->inst.X], 
+                    chip8->inst.Y, chip8->V[chip8->inst.Y]);
+            }
             break;
 
         case 0x06:
             // 0x6XNN: Set V[X] to NN
-            printf("Set register V%X = NN (0x%02X)\n", chip8->inst.X, chip8->inst.NN);
+            snprintf(desc, sizeof desc, "Set register V%X = NN (0x%02X)", chip8->inst.X, chip8->inst.NN);
             break;
 
         case 0x07:
             // 0x7XNN: Adds NN to V[X]
-            printf("Set register V%X (0x%02X) += NN (0x%02X). Result: 0x%02X\n", 
+            snprintf(desc, sizeof desc, "Set register V%X (0x%02X) += NN (0x%02X). Result: 0x%02X", 
             chip8->inst.X, chip8->V[chip8->inst.X], chip8->inst.NN, chip8->V[chip8->inst.X] +  chip8->inst.NN);
             break;
 
@@ -387,13 +904,13 @@ void print_debug_info(chip8_t *chip8) {
             switch(chip8->inst.N) {
                 case 0x0:
                     // 0x8XY0: Set register V[X] = V[Y]
-                    printf("Set register V%X = V%X (0x%02X)\n",
+                    snprintf(desc, sizeof desc, "Set register V%X = V%X (0x%02X)",
                     chip8->inst.X, chip8->inst.Y, chip8->V[chip8->inst.Y]);
                     break;
 
                 case 0x1: 
                     // 0x8XY1: Set register V[X] |= V[Y]
-                    printf("Set register V%X (0x%02X) |= V%X (0x%02X); Result: 0x%02X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) |= V%X (0x%02X); Result: 0x%02X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     chip8->inst.Y, chip8->V[chip8->inst.Y],
                     chip8->V[chip8->inst.X] | chip8->V[chip8->inst.Y]);
@@ -401,7 +918,7 @@ void print_debug_info(chip8_t *chip8) {
                 
                 case 0x2: 
                     // 0x8XY2: Set register V[X] &= V[Y]
-                    printf("Set register V%X (0x%02X) &= V%X (0x%02X); Result: 0x%02X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) &= V%X (0x%02X); Result: 0x%02X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     chip8->inst.Y, chip8->V[chip8->inst.Y],
                     chip8->V[chip8->inst.X] & chip8->V[chip8->inst.Y]);
@@ -409,7 +926,7 @@ void print_debug_info(chip8_t *chip8) {
 
                 case 0x3: 
                     // 0x8XY3: Set register V[X] ^= V[Y]
-                    printf("Set register V%X (0x%02X) ^= V%X (0x%02X); Result: 0x%02X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) ^= V%X (0x%02X); Result: 0x%02X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     chip8->inst.Y, chip8->V[chip8->inst.Y],
                     chip8->V[chip8->inst.X] ^ chip8->V[chip8->inst.Y]);
@@ -417,7 +934,7 @@ void print_debug_info(chip8_t *chip8) {
 
                 case 0x4: 
                     // 0x8XY4: Set register V[X] += V[Y]; Set V[F] to 1 if carry
-                    printf("Set register V%X (0x%02X) += V%X (0x%02X), V[0xF] = 1 if carry; Result: 0x%02X, V[0xF] = %X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) += V%X (0x%02X), V[0xF] = 1 if carry; Result: 0x%02X, V[0xF] = %X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     chip8->inst.Y, chip8->V[chip8->inst.Y],
                     chip8->V[chip8->inst.X] + chip8->V[chip8->inst.Y],
@@ -426,7 +943,7 @@ void print_debug_info(chip8_t *chip8) {
 
                 case 0x5:
                     // 0x8XY5: Set register V[X] -= V[Y]; Set V[F] to 1 if there is not a borrow
-                    printf("Set register V%X (0x%02X) -= V%X (0x%02X), V[0xF] = 1 if there is not a borrow; Result: 0x%02X, V[0xF] = %X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) -= V%X (0x%02X), V[0xF] = 1 if there is not a borrow; Result: 0x%02X, V[0xF] = %X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     chip8->inst.Y, chip8->V[chip8->inst.Y],
                     chip8->V[chip8->inst.X] - chip8->V[chip8->inst.Y], 
@@ -435,7 +952,7 @@ void print_debug_info(chip8_t *chip8) {
 
                 case 0x06:
                     //0x8XY6: Shifts V[X] to the right by 1, then stores the least significant bit of V[X] prior to the shift into V[F].
-                    printf("Set register V%X (0x%02X) >>= 1  V[0xF] = shifted off bit (%X); Result: 0x%02X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) >>= 1  V[0xF] = shifted off bit (%X); Result: 0x%02X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     chip8->V[chip8->inst.X] & 0x1,
                     chip8->V[chip8->inst.X] >> 1); 
@@ -443,7 +960,7 @@ void print_debug_info(chip8_t *chip8) {
 
                 case 0x7:
                     // 0x8XY7: Set register V[X] = V[Y] - V[X]; Set V[F] to 1 if there is not a borrow
-                    printf("Set register V%X (0x%02X) = V%X (0x%02X) - V%X (0x%02X), V[0xF] = 1 if there is not a borrow; Result: 0x%02X, V[0xF] = %X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) = V%X (0x%02X) - V%X (0x%02X), V[0xF] = 1 if there is not a borrow; Result: 0x%02X, V[0xF] = %X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     chip8->inst.Y, chip8->V[chip8->inst.Y],
                     chip8->inst.X, chip8->V[chip8->inst.X],
@@ -453,38 +970,39 @@ void print_debug_info(chip8_t *chip8) {
 
                 case 0xE:
                     //0x8XYE: Shifts V[X] to the left by 1, then stores the most significant bit of V[X] prior to the shift into V[F].
-                    printf("Set register V%X (0x%02X) <<= 1  V[0xF] = shifted off bit (%X); Result: 0x%02X\n",
+                    snprintf(desc, sizeof desc, "Set register V%X (0x%02X) <<= 1  V[0xF] = shifted off bit (%X); Result: 0x%02X",
                     chip8->inst.X, chip8->V[chip8->inst.X], 
                     ((chip8->V[chip8->inst.X] & 0x80) >> 7),
                     (chip8->V[chip8->inst.X] << 1)); 
                     break;
 
                 default:
+                    snprintf(desc, sizeof desc, "Uninmplemented Opcode");
                     break; // Uinmplemented/Wrong opcode 
             }
             break;
 
         case 0x09:
             // 0x9XY0: Skips the next instruction if V[X] does not equal V[Y]
-            printf("Check if V%X (0x%02X) == V%X (0x%02X), skip the next instruction if true\n",
+            snprintf(desc, sizeof desc, "Check if V%X (0x%02X) == V%X (0x%02X), skip the next instruction if true",
             chip8->inst.X, chip8->V[chip8->inst.X],
             chip8->inst.Y, chip8->V[chip8->inst.Y]);
             break;
 
         case 0x0A:
-            //  0x0ANN: Set index register I to NNN
-            printf("Set I to NNN (0x%04X)\n", chip8->inst.NNN);
+            // 0xANNN: Set index register I to NNN
+            snprintf(desc, sizeof desc, "Set I to NNN (0x%04X)", chip8->inst.NNN);
             break;
 
         case 0x0B:
             // 0xBNNN: Jumps to the address NNN plus V[0]
-            printf("Set PC to NNN (0x%04X) + V0 (0x%02X). Result: PC = 0x%04X\n", 
+            snprintf(desc, sizeof desc, "Set PC to NNN (0x%04X) + V0 (0x%02X). Result: PC = 0x%04X", 
             chip8->inst.NNN, chip8->V[0x0], chip8->V[0x0] + chip8->inst.NNN);
             break;
 
         case 0x0C:
             // 0xCXNN: Sets V[X] to the result of a bitwise AND operation between a random number (0 to 255) and NN
-            printf("Set V%X = (rand() %% 256) & NN (0x%04X)\n",
+            snprintf(desc, sizeof desc, "Set V%X = random byte & NN (0x%04X)",
             chip8->inst.X, chip8->inst.NN);
             break;
 
@@ -492,8 +1010,8 @@ void print_debug_info(chip8_t *chip8) {
             // 0XDXYN: Draw N-height sprite at coords X,Y; Read from memory location I
             // Screen pixels are XOR'd with sprite bits
             // VF (Carry flag) is set if any screen pixels are set off (This is useful for collision detection)
-            printf("Draw N (%u) height sprite at coords V%X (0x%02X), V%X (0x%02X) "
-                    "from memory location I (0x%04X). Set VF = 1 if any pixels are turned off.\n"
+            snprintf(desc, sizeof desc, "Draw N (%u) height sprite at coords V%X (0x%02X), V%X (0x%02X) "
+                    "from memory location I (0x%04X). Set VF = 1 if any pixels are turned off."
                     , chip8->inst.N, chip8->inst.X, chip8->V[chip8->inst.X], chip8->inst.Y, 
                     chip8->V[chip8->inst.Y], chip8->I);
             break;
@@ -502,13 +1020,15 @@ void print_debug_info(chip8_t *chip8) {
 
             if(chip8->inst.NN == 0x9E) {
                 // 0xEX9E: Skip next instruction if key in V[X] is pressed
-                printf("Skip next instruction if key in V%X (0x%02X) is pressed; Keypad value: %d\n",
-                chip8->inst.X, chip8->V[chip8->inst.X], chip8->keypad[chip8->V[chip8->inst.X]]);
+                snprintf(desc, sizeof desc, "Skip next instruction if key in V%X (0x%02X) is pressed; Keypad value: %d",
+                chip8->inst.X, chip8->V[chip8->inst.X], chip8->keypad[chip8->V[chip8->inst.X] & 0xF]);
 
             } else if(chip8->inst.NN == 0xA1) {
                 // 0xEXA1: Skip next instruction if key in V[X] is not pressed
-                printf("Skip next instruction if key in V%X (0x%02X) is not pressed; Keypad value: %d\n",
-                chip8->inst.X, chip8->V[chip8->inst.X], chip8->keypad[chip8->V[chip8->inst.X]]);
+                snprintf(desc, sizeof desc, "Skip next instruction if key in V%X (0x%02X) is not pressed; Keypad value: %d",
+                chip8->inst.X, chip8->V[chip8->inst.X], chip8->keypad[chip8->V[chip8->inst.X] & 0xF]);
+            } else {
+                snprintf(desc, sizeof desc, "Uninmplemented Opcode");
             }
             break;
 
@@ -516,407 +1036,1375 @@ void print_debug_info(chip8_t *chip8) {
         
             switch(chip8->inst.NN) {
 
+                case 0x00:
+                    snprintf(desc, sizeof desc, "Set I to the 16 bit address in the next word");
+                    break;
+
+                case 0x01:
+                    snprintf(desc, sizeof desc, "Select drawing planes %X", chip8->inst.X & 0x3);
+                    break;
+
+                case 0x02:
+                    snprintf(desc, sizeof desc, "Load audio pattern buffer from memory at I (0x%04X)", chip8->I);
+                    break;
+
+                case 0x3A:
+                    snprintf(desc, sizeof desc, "Set audio pattern pitch = V%X (0x%02X)", chip8->inst.X, chip8->V[chip8->inst.X]);
+                    break;
+
                 case 0x07:
                     // 0xFX07: Sets VX to the value of the delay timer.
-                    printf("Set V%X = delay timer value (0x%02X)\n", chip8->inst.X, chip8->delay_timer);
+                    snprintf(desc, sizeof desc, "Set V%X = delay timer value (0x%02X)", chip8->inst.X, chip8->delay_timer);
                     break;
 
                 case 0x0A:
                     //0xFX0A: A key press is awaited, and then stored in VX (blocking operation, all instruction halted until next key event)
-                    printf("Await until a key is pressed; Store key in V%X\n", chip8->inst.X);                    
+                    snprintf(desc, sizeof desc, "Await until a key is %s; Store key in V%X",
+                           chip8->quirks.key_press ? "pressed" : "pressed and released", chip8->inst.X);
                     break;
 
                 case 0x15:
                     // 0xFX15: Sets the delay timer to VX
-                    printf("Set delay timer value = V%X (0x%02X)\n", chip8->inst.X, chip8->V[chip8->inst.X]);
+                    snprintf(desc, sizeof desc, "Set delay timer value = V%X (0x%02X)", chip8->inst.X, chip8->V[chip8->inst.X]);
                     break;
 
                 case 0x18:
                     // 0xFX18: Sets the sound timer to VX.
-                    printf("Set sound timer value = V%X (0x%02X)\n", chip8->inst.X, chip8->V[chip8->inst.X]);
+                    snprintf(desc, sizeof desc, "Set sound timer value = V%X (0x%02X)", chip8->inst.X, chip8->V[chip8->inst.X]);
                     break;
 
                 case 0x1E:
                     // 0xFX1E: Adds VX to I. VF is not affected.
-                    printf("I (0x%04X) += V%X (0x%04X); Result (I): 0x%04X\n", 
+                    snprintf(desc, sizeof desc, "I (0x%04X) += V%X (0x%04X); Result (I): 0x%04X", 
                     chip8->I, chip8->inst.X, chip8->V[chip8->inst.X], chip8->I + chip8->V[chip8->inst.X]);
                     break;
 
                 case 0x29:
                     // 0xFX29: Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
-                    printf("Set I to sprite location in memory for character in V%X (0x%02X); Result (*5) = (0x%02X)\n",
-                    chip8->inst.X, chip8->V[chip8->inst.X], chip8->V[chip8->inst.X] * 5);
+                    snprintf(desc, sizeof desc, "Set I to sprite location in memory for character in V%X (0x%02X); Result (*5) = (0x%02X)",
+                    chip8->inst.X, chip8->V[chip8->inst.X], CHIP8_FONT_ADDR + (chip8->V[chip8->inst.X] & 0xF) * CHIP8_FONT_HEIGHT);
                     break;
 
                 case 0x33:
                     // 0xFX33: Stores the binary-coded decimal representation of VX
                     // with the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.
-                    printf("Store BCD representation of V%X (0x%02X) at memory from I (0x%04X)\n", 
+                    snprintf(desc, sizeof desc, "Store BCD representation of V%X (0x%02X) at memory from I (0x%04X)", 
                     chip8->inst.X, chip8->V[chip8->inst.X], chip8->I);               
                     break;
 
                 case 0x55:
                     // 0xFX55: Stores from V0 to VX (including VX) in memory, starting at address I. 
                     // The offset from I is increased by 1 for each value written, but I itself is left unmodified.
-                    printf("Resgister dump V0-V%X (0x%02X) inclusive at memory from I (0x%04X)\n", 
+                    snprintf(desc, sizeof desc, "Resgister dump V0-V%X (0x%02X) inclusive at memory from I (0x%04X)", 
                     chip8->inst.X, chip8->V[chip8->inst.X], chip8->I);
                     break;
 
                 case 0x65:
                     // 0xFX65: Fills from V0 to VX (including VX) with values from memory, starting at address I. 
                     // The offset from I is increased by 1 for each value read, but I itself is left unmodified.
-                    printf("Resgister load V0-V%X (0x%02X) inclusive at memory from I (0x%04X)\n", 
+                    snprintf(desc, sizeof desc, "Resgister load V0-V%X (0x%02X) inclusive at memory from I (0x%04X)", 
                     chip8->inst.X, chip8->V[chip8->inst.X], chip8->I);
                     break;
 
+                case 0x30:
+                    // 0xFX30: SUPER-CHIP sets I to the location of the 8x10 sprite for digit VX
+                    snprintf(desc, sizeof desc, "Set I to big sprite location in memory for digit in V%X (0x%02X)",
+                    chip8->inst.X, chip8->V[chip8->inst.X]);
+                    break;
+
+                case 0x75:
+                    // 0xFX75: SUPER-CHIP stores V0 to VX in the HP48 RPL user flags
+                    snprintf(desc, sizeof desc, "Store V0-V%X inclusive in RPL user flags", chip8->inst.X);
+                    break;
+
+                case 0x85:
+                    // 0xFX85: SUPER-CHIP fills V0 to VX from the HP48 RPL user flags
+                    snprintf(desc, sizeof desc, "Load V0-V%X inclusive from RPL user flags", chip8->inst.X);
+                    break;
+
                 default:
+                    snprintf(desc, sizeof desc, "Uninmplemented Opcode");
                     break; // Uinmplemented/Wrong opcode 
             }
             break;
 
         default:
-            printf("Uninmplemented Opcode\n");
+            snprintf(desc, sizeof desc, "Uninmplemented Opcode");
             break; // Unimplemented or invalid opcode
     }
+    chip8_log(chip8, CHIP8_LOG_DEBUG, "cpu", "Address: 0x%04X Opcode: 0x%04X Desc: %s", chip8->PC-2, chip8->inst.opcode,
+              desc);
 }
-#endif
 
-// Emulate CHIP8 instructions
-void emulate_instruction(chip8_t *chip8, const config_t config) {
-    bool carry; // Save carry flag/VF value for some instructions
+const char *chip8_fault_name(chip8_fault_t fault) {
+    switch(fault) {
+        case CHIP8_FAULT_NONE: return "no fault";
+        case CHIP8_FAULT_INVALID_OPCODE: return "invalid opcode";
+        case CHIP8_FAULT_STACK_OVERFLOW: return "stack overflow";
+        case CHIP8_FAULT_STACK_UNDERFLOW: return "stack underflow";
+        case CHIP8_FAULT_MEMORY_BOUNDS: return "memory access out of bounds";
+        case CHIP8_FAULT_PROTECTED_WRITE: return "write to the interpreter area";
+        case CHIP8_FAULT_PLATFORM_OPCODE: return "instruction not available on the platform";
+        case CHIP8_FAULT_UNINITIALIZED_READ: return "read of uninitialized memory";
+    }
+    return "unknown fault";
+}
 
-    chip8->inst.opcode = (chip8->ram[chip8->PC] << 8) | chip8->ram[chip8->PC+1]; // Get next opcode form RAM
-    chip8->PC += 2; // Increment program counter for next opcode
+// Fault, PC, opcode and registers for crash reports
+void chip8_print_fault(const chip8_t *chip8, FILE *out) {
+    fprintf(out, "Machine fault: %s at 0x%04X (opcode %04X) in %s\n", chip8_fault_name(chip8->fault),
+            chip8->PC, chip8->inst.opcode, chip8->rom_name ? chip8->rom_name : "ROM");
 
-    // Fill out instruction format
-    chip8->inst.NNN = chip8->inst.opcode & 0x0FFF;
-    chip8->inst.NN = chip8->inst.opcode & 0x0FF;
-    chip8->inst.N = chip8->inst.opcode & 0x0F;
-    chip8->inst.X = (chip8->inst.opcode >> 8) & 0x0F;
-    chip8->inst.Y = (chip8->inst.opcode >> 4) & 0x0F;
+    for(int i = 0; i < 16; i++)
+        fprintf(out, "V%X=%02X%s", i, chip8->V[i], i == 7 || i == 15 ? "\n" : " ");
 
-#ifdef DEBUG
-    print_debug_info(chip8);
-#endif
+    fprintf(out, "I=%04X SP=%d DT=%02X ST=%02X\n", chip8->I, (int)(chip8->stack_ptr - chip8->stack),
+            chip8->delay_timer, chip8->sound_timer);
 
-    // Emulate opcode
-    switch ((chip8->inst.opcode >> 12) & 0x0F) {
+    if(chip8->fault == CHIP8_FAULT_PLATFORM_OPCODE) {
+        fprintf(out, "%04X is a %s instruction, the ROM runs as %s\n", chip8->inst.opcode,
+                chip8_platform_name(chip8_opcode_platform(chip8->inst.opcode)), chip8_platform_name(chip8->platform));
+    }
+    if(chip8->fault == CHIP8_FAULT_UNINITIALIZED_READ)
+        fprintf(out, "Nothing wrote 0x%04X since the machine was reset\n", chip8->fault_addr);
+}
 
-        case 0x0:
-            if(chip8->inst.NN == 0xE0) {
-                // 0x00E0: Clear the screen
-                memset(&chip8->display[0], false, sizeof chip8->display);
+// The faulting instruction runs again on the next step, so it faults again unless the cause was fixed
+void chip8_clear_fault(chip8_t *chip8) {
+    if(chip8->fault == CHIP8_FAULT_NONE) return;
 
-            } else if (chip8->inst.NN == 0xEE) {
-                // 0x00EE Return from subrutine
-                //  Set program counter to last address on subrutine stack ("pop" it off the stack)
-                //  so that next opcode will be gotten from that address
-                chip8->PC = *--chip8->stack_ptr;
+    chip8->fault = CHIP8_FAULT_NONE;
+    chip8->state = RUNNING;
+}
 
-            } else {
-                // Uninmplemented/invalid opcode, may be 0xNNN for calling machine code routines
-            }
+static void op_invalid(chip8_t *chip8) {
+    set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+}
 
-            break;
+// Mega-Chip 060N: play the digitized sound at I, see chip8_sound_t for the format
+static void start_sound(chip8_t *chip8, bool loop) {
+    const uint16_t rate = (read_data(chip8, chip8->I) << 8) | read_data(chip8, chip8->I + 1);
+    const uint32_t addr = (chip8->I + 6) & (chip8->ram_size - 1);
+    uint32_t length = 0;
+
+    for(int i = 2; i < 5; i++) length = (length << 8) | read_data(chip8, chip8->I + i);
+    if(length > chip8->ram_size - addr) length = chip8->ram_size - addr;
+
+    chip8->sound = (chip8_sound_t) {
+        .addr = addr,
+        .length = length,
+        .rate = rate,
+        .loop = loop,
+        .playing = length > 0 && rate > 0,
+        .serial = chip8->sound.serial + 1,
+    };
+}
 
-        case 0x01:
-            //0x1NNN: Jump to the adress NNN
-            chip8->PC = chip8->inst.NNN; //Set program counter so that next opcode is NNN.
-            break;
+// Mega-Chip instructions 0x0010-0x09NN, returns false if the opcode isn't one of them
+static bool mega_instruction(chip8_t *chip8) {
+    const uint8_t NN = chip8->inst.NN;
+
+    switch(chip8->inst.opcode >> 8) {
+        case 0x00:
+            if(NN == 0x10) set_mega(chip8, false);                          // 0x0010: Back to CHIP8 modes
+            else if(NN == 0x11) set_mega(chip8, true);                      // 0x0011: 256x192 color mode
+            else if((NN & 0xF0) == 0xB0 && chip8->mega) scroll_mega(chip8, 0, -chip8->inst.N); // 0x00BN: Scroll N up
+            else if((NN & 0xF0) == 0xB0) scroll_display(chip8, 0, -chip8->inst.N);
+            else return false;
+            return true;
+
+        case 0x01: {
+            // 0x01NN NNNN: Set I to the 24 bit address NNNNNN, out of memory addresses wrap around
+            const uint32_t addr = (NN << 16) | (read_byte(chip8, chip8->PC) << 8) | read_byte(chip8, chip8->PC + 1);
+            chip8->PC += 2;
+
+            if(chip8->strict_memory && addr >= chip8->ram_size) set_fault(chip8, CHIP8_FAULT_MEMORY_BOUNDS);
+            else chip8->I = addr & (chip8->ram_size - 1);
+            return true;
+        }
 
         case 0x02:
-            // 0x2NNN: Call subrutine at NNN
-            // Store current address to return to on subrutine stack ("push" it on the stack)
-            // and set program counter to subrutine address so that the next opcode is gotten from there
-            *chip8->stack_ptr++ = chip8->PC;
-            chip8->PC = chip8->inst.NNN;
-            break;
+            // 0x02NN: Load NN colors from I into palette indexes 1 to NN, 4 bytes each as ARGB
+            for(uint32_t i = 0; i < NN; i++) {
+                uint32_t color = 0;
+                for(uint32_t byte = 0; byte < 4; byte++) color = (color << 8) | read_data(chip8, chip8->I + i * 4 + byte);
+                chip8->palette[i + 1] = color;
+            }
+            chip8_set_dirty(chip8);
+            return true;
 
         case 0x03:
-            // If V[X] == NN, skip the next instruction
-            if(chip8->V[chip8->inst.X] == chip8->inst.NN)
-                chip8->PC += 2;
+            // 0x03NN: Set the sprite width to NN, 0 is 256
+            chip8->sprite_width = NN ? NN : 256;
+            return true;
 
-            break;
-        
         case 0x04:
-            // If V[X] != NN, skip the next instruction
-            if(chip8->V[chip8->inst.X] != chip8->inst.NN)
-                chip8->PC += 2;
-
-            break;
+            // 0x04NN: Set the sprite height to NN, 0 is 256
+            chip8->sprite_height = NN ? NN : 256;
+            return true;
 
         case 0x05:
-            // If V[X] == V[Y], skip the next instruction
-            if(chip8->inst.N != 0) break; // Wrong opocode
-
-            if(chip8->V[chip8->inst.X] == chip8->V[chip8->inst.Y])
-                chip8->PC += 2;
-            
-            break;
+            // 0x05NN: Set the screen alpha to NN
+            chip8->screen_alpha = NN;
+            chip8_set_dirty(chip8);
+            return true;
 
         case 0x06:
-            // 0x6XNN: Set V[X] to NN
-            chip8->V[chip8->inst.X] = chip8->inst.NN;
-            break;
+            // 0x0600: Play the digitized sound at I in a loop, 0x0601: Play it once
+            if(NN > 0x01) return false;
+            start_sound(chip8, NN == 0x00);
+            return true;
 
         case 0x07:
-            // 0x7XNN: Adds NN to V[X]
-            chip8->V[chip8->inst.X] += chip8->inst.NN;
-            break;
+            // 0x0700: Stop the digitized sound
+            if(NN != 0x00) return false;
+            chip8->sound.playing = false;
+            chip8->sound.serial++;
+            return true;
 
         case 0x08:
-            switch(chip8->inst.N) {
-                case 0x0:
-                    // 0x8XY0: Set register V[X] = V[Y]
-                    chip8->V[chip8->inst.X] = chip8->V[chip8->inst.Y];
-                    break;
+            // 0x080N: Set the sprite blend mode, normal, 25%, 50%, 75%, add or multiply
+            if(NN > 0x05) return false;
+            chip8->blend = NN;
+            return true;
 
-                case 0x1: 
-                    // 0x8XY1: Set register V[X] |= V[Y]
-                    chip8->V[chip8->inst.X] |= chip8->V[chip8->inst.Y];
-                    break;
-                
-                case 0x2: 
-                    // 0x8XY2: Set register V[X] &= V[Y]
-                    chip8->V[chip8->inst.X] &= chip8->V[chip8->inst.Y];
-                    break;
+        case 0x09:
+            // 0x09NN: Set the collision color to palette index NN
+            chip8->collision_color = NN;
+            return true;
+    }
 
-                case 0x3: 
-                    // 0x8XY3: Set register V[X] ^= V[Y]
-                    chip8->V[chip8->inst.X] ^= chip8->V[chip8->inst.Y];
-                    break;
+    return false;
+}
 
-                case 0x4: 
-                    // 0x8XY4: Set register V[X] += V[Y]; Set V[F] to 1 if carry
-                    carry = ((uint16_t) (chip8->V[chip8->inst.X] + chip8->V[chip8->inst.Y]) > 255);
+static void op_0NNN(chip8_t *chip8) {
+    switch(chip8->inst.opcode) {
+        case 0x00E0:
+            // 0x00E0: Clear the screen
+            // Mega-Chip: show the frame drawn since the last 00E0 and start a new one
+            if(chip8->mega) show_mega_frame(chip8);
+            else chip8_clear_display(chip8);
+            return;
+
+        case 0x00EE:
+            // 0x00EE Return from subrutine
+            //  Set program counter to last address on subrutine stack ("pop" it off the stack)
+            //  so that next opcode will be gotten from that address
+            if(chip8->stack_ptr == chip8->stack) {
+                set_fault(chip8, CHIP8_FAULT_STACK_UNDERFLOW);
+                return;
+            }
+            chip8->PC = *--chip8->stack_ptr;
+            return;
+
+        case 0x00FB:
+            // 0x00FB: SUPER-CHIP scroll display 4 pixels right
+            if(chip8->mega) scroll_mega(chip8, 4, 0);
+            else scroll_display(chip8, 4, 0);
+            return;
+
+        case 0x00FC:
+            // 0x00FC: SUPER-CHIP scroll display 4 pixels left
+            if(chip8->mega) scroll_mega(chip8, -4, 0);
+            else scroll_display(chip8, -4, 0);
+            return;
+
+        case 0x00FD:
+            // 0x00FD: SUPER-CHIP exit interpreter
+            chip8->state = QUIT;
+            return;
+
+        case 0x00FE:
+            // 0x00FE: SUPER-CHIP disable hires mode (64x32)
+            set_hires(chip8, false);
+            return;
+
+        case 0x00FF:
+            // 0x00FF: SUPER-CHIP enable hires mode (128x64)
+            set_hires(chip8, true);
+            return;
+    }
 
-                    chip8->V[chip8->inst.X] += chip8->V[chip8->inst.Y];
-                    chip8->V[0xF] = carry; 
-                    break;
+    if((chip8->inst.opcode & 0xFFF0) == 0x00C0) {
+        // 0x00CN: SUPER-CHIP scroll display N pixels down
+        if(chip8->mega) scroll_mega(chip8, 0, chip8->inst.N);
+        else scroll_display(chip8, 0, chip8->inst.N);
+    } else if(chip8->xochip && (chip8->inst.opcode & 0xFFF0) == 0x00D0) {
+        // 0x00DN: XO-CHIP scroll display N pixels up
+        scroll_display(chip8, 0, -chip8->inst.N);
+    } else if((!chip8->megachip || !mega_instruction(chip8)) &&
+              (!chip8->sys_hook || !chip8->sys_hook(chip8->sys_userdata, chip8->inst.NNN))) {
+        // Invalid opcode, 0xNNN calls a machine code routine on the COSMAC VIP which can't be emulated
+        // unless the sys hook knows it
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+    }
+}
 
-                case 0x5:
-                    // 0x8XY5: Set register V[X] -= V[Y]; Set V[F] to 1 if there is not a borrow
-                    carry = (chip8->V[chip8->inst.Y] <= chip8->V[chip8->inst.X]);
+static void op_1NNN(chip8_t *chip8) {
+    //0x1NNN: Jump to the adress NNN
+    chip8->PC = chip8->inst.NNN; //Set program counter so that next opcode is NNN.
+}
 
-                    chip8->V[chip8->inst.X] -= chip8->V[chip8->inst.Y];
-                    chip8->V[0xF] = carry;
-                    break;
+static void op_2NNN(chip8_t *chip8) {
+    // 0x2NNN: Call subrutine at NNN
+    // Store current address to return to on subrutine stack ("push" it on the stack)
+    // and set program counter to subrutine address so that the next opcode is gotten from there
+    if(chip8->stack_ptr == &chip8->stack[sizeof chip8->stack / sizeof chip8->stack[0]]) {
+        set_fault(chip8, CHIP8_FAULT_STACK_OVERFLOW);
+        return;
+    }
+    *chip8->stack_ptr++ = chip8->PC;
+    chip8->PC = chip8->inst.NNN;
+}
 
-                case 0x6:
-                    //0x8XY6: Shifts V[X] to the right by 1, then stores the least significant bit of V[X] prior to the shift into V[F].
-                    chip8->V[0xF] = chip8->V[chip8->inst.X] & 0x1;
-                    chip8->V[chip8->inst.X] >>= 1;
-                    break;
+static void op_3XNN(chip8_t *chip8) {
+    // If V[X] == NN, skip the next instruction
+    if(chip8->V[chip8->inst.X] == chip8->inst.NN)
+        skip_instruction(chip8);
+}
 
-                case 0x7:
-                    // 0x8XY7: Set register V[X] = V[Y] - V[X]; Set V[F] to 1 if there is not a borrow
-                    carry = (chip8->V[chip8->inst.X] <= chip8->V[chip8->inst.Y]);
+static void op_4XNN(chip8_t *chip8) {
+    // If V[X] != NN, skip the next instruction
+    if(chip8->V[chip8->inst.X] != chip8->inst.NN)
+        skip_instruction(chip8);
+}
 
-                    chip8->V[chip8->inst.X] = chip8->V[chip8->inst.Y] - chip8->V[chip8->inst.X];
-                    chip8->V[0xF] = carry;
-                    break;
+static void op_5XYN(chip8_t *chip8) {
+    if(chip8->inst.N == 0) {
+        // 0x5XY0: If V[X] == V[Y], skip the next instruction
+        if(chip8->V[chip8->inst.X] == chip8->V[chip8->inst.Y])
+            skip_instruction(chip8);
 
-                case 0xE:
-                    //0x8XYE: Shifts V[X] to the left by 1, then stores the most significant bit of V[X] prior to the shift into V[F].
-                    chip8->V[0xF] = (chip8->V[chip8->inst.X] & 0x80) >> 7;
-                    chip8->V[chip8->inst.X] <<= 1;
-                    break;
+    } else if(chip8->xochip && (chip8->inst.N == 2 || chip8->inst.N == 3)) {
+        // 0x5XY2: XO-CHIP store V[X] to V[Y] (either direction) in memory starting at I
+        // 0x5XY3: XO-CHIP load V[X] to V[Y] (either direction) from memory starting at I
+        // I is left unmodified
+        const int step = chip8->inst.X <= chip8->inst.Y ? 1 : -1;
 
-                default:
-                    break; // Uinmplemented/Wrong opcode 
+        for(int i = 0, reg = chip8->inst.X; ; i++, reg += step) {
+            if(chip8->inst.N == 2) write_byte(chip8, chip8->I + i, chip8->V[reg]);
+            else chip8->V[reg] = read_data(chip8, chip8->I + i);
 
-            }
-            break;
+            if(reg == chip8->inst.Y) break;
+        }
+    } else {
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+    }
+}
 
-        case 0x09:
-            // 0x9XY0: Skips the next instruction if V[X] does not equal V[Y]
-            if(chip8->V[chip8->inst.X] != chip8->V[chip8->inst.Y])
-                chip8->PC += 2;
-            break;
+static void op_6XNN(chip8_t *chip8) {
+    // 0x6XNN: Set V[X] to NN
+    chip8->V[chip8->inst.X] = chip8->inst.NN;
+}
 
-        case 0x0A:
-            // 0xANNN: Set index register I to NNN
-            chip8->I = chip8->inst.NNN;
-            break;
+static void op_7XNN(chip8_t *chip8) {
+    // 0x7XNN: Adds NN to V[X]
+    chip8->V[chip8->inst.X] += chip8->inst.NN;
+}
 
-        case 0x0B:
-            // 0xBNNN: Jumps to the address NNN plus V[0]
-            chip8->PC = chip8->inst.NNN + chip8->V[0x0];
-            break;
+static void op_8XY0(chip8_t *chip8) {
+    // 0x8XY0: Set register V[X] = V[Y]
+    chip8->V[chip8->inst.X] = chip8->V[chip8->inst.Y];
+}
 
-        case 0x0C:
-            // 0xCXNN: Sets V[X] to the result of a bitwise AND operation between a random number (0 to 255) and NN
-            chip8->V[chip8->inst.X] = (rand() % 256) & chip8->inst.NN;
-            break;
+static void op_8XY1(chip8_t *chip8) {
+    // 0x8XY1: Set register V[X] |= V[Y]
+    chip8->V[chip8->inst.X] |= chip8->V[chip8->inst.Y];
+    if(chip8->quirks.vf_reset) chip8->V[0xF] = 0;
+}
 
-        case 0x0D:
-            // 0XDXYN: Draw N-height sprite at coords X,Y; Read from memory location I
-            // Screen pixels are XOR'd with sprite bits
-            // VF (Carry flag) is set if any screen pixels are set off (This is useful for collision detection)
-            uint8_t X_coord = chip8->V[chip8->inst.X] % config.window_width;
-            uint8_t Y_coord = chip8->V[chip8->inst.Y] % config.window_height;
-            const uint8_t orig_X = X_coord;
+static void op_8XY2(chip8_t *chip8) {
+    // 0x8XY2: Set register V[X] &= V[Y]
+    chip8->V[chip8->inst.X] &= chip8->V[chip8->inst.Y];
+    if(chip8->quirks.vf_reset) chip8->V[0xF] = 0;
+}
 
-            chip8->V[0xF] = 0; // Initialize carry flag to 0
+static void op_8XY3(chip8_t *chip8) {
+    // 0x8XY3: Set register V[X] ^= V[Y]
+    chip8->V[chip8->inst.X] ^= chip8->V[chip8->inst.Y];
+    if(chip8->quirks.vf_reset) chip8->V[0xF] = 0;
+}
 
-            for(uint8_t i = 0; i < chip8->inst.N; i++) {
-                // Get next byte/row of sprite data
-                const uint8_t sprite_data = chip8->ram[chip8->I + i];
-                X_coord = orig_X; // Reset X for next row to draw
+static void op_8XY4(chip8_t *chip8) {
+    // 0x8XY4: Set register V[X] += V[Y]; Set V[F] to 1 if carry
+    const bool carry = ((uint16_t) (chip8->V[chip8->inst.X] + chip8->V[chip8->inst.Y]) > 255);
 
-                for(int8_t j = 7; j >= 0; j--) {
-                    // If sprite pixel/bit is on and display pixel is on, set carry flag
-                    bool *pixel = &chip8->display[Y_coord * config.window_width + X_coord];
+    chip8->V[chip8->inst.X] += chip8->V[chip8->inst.Y];
+    chip8->V[0xF] = carry;
+}
 
-                    const bool sprite_bit = (sprite_data & (1 << j));
+static void op_8XY5(chip8_t *chip8) {
+    // 0x8XY5: Set register V[X] -= V[Y]; Set V[F] to 1 if there is not a borrow
+    const bool carry = (chip8->V[chip8->inst.Y] <= chip8->V[chip8->inst.X]);
 
-                    if(sprite_bit && *pixel) {
-                        chip8->V[0xF] = 1;
-                    }
+    chip8->V[chip8->inst.X] -= chip8->V[chip8->inst.Y];
+    chip8->V[0xF] = carry;
+}
 
-                    //XOR display pixel with sprite pixel/bit to set it off or  on
-                    *pixel ^= sprite_bit;
+static void op_8XY6(chip8_t *chip8) {
+    //0x8XY6: Shifts V[X] to the right by 1, then stores the least significant bit of V[X] prior to the shift into V[F].
+    // Original COSMAC shifts V[Y] into V[X] instead
+    if(!chip8->quirks.shift_vx) chip8->V[chip8->inst.X] = chip8->V[chip8->inst.Y];
 
-                    // Stop drawing if hit right edge of the screen
-                    if(++X_coord >= config.window_width) break;
+    const bool carry = chip8->V[chip8->inst.X] & 0x1;
 
-                }
+    chip8->V[chip8->inst.X] >>= 1;
+    chip8->V[0xF] = carry;
+}
 
-                // Stop drawing if hit bottom edge of the screen
-                if(++Y_coord >= config.window_height) break;
+static void op_8XY7(chip8_t *chip8) {
+    // 0x8XY7: Set register V[X] = V[Y] - V[X]; Set V[F] to 1 if there is not a borrow
+    const bool carry = (chip8->V[chip8->inst.X] <= chip8->V[chip8->inst.Y]);
 
-            }
+    chip8->V[chip8->inst.X] = chip8->V[chip8->inst.Y] - chip8->V[chip8->inst.X];
+    chip8->V[0xF] = carry;
+}
 
-            break;
+static void op_8XYE(chip8_t *chip8) {
+    //0x8XYE: Shifts V[X] to the left by 1, then stores the most significant bit of V[X] prior to the shift into V[F].
+    // Original COSMAC shifts V[Y] into V[X] instead
+    if(!chip8->quirks.shift_vx) chip8->V[chip8->inst.X] = chip8->V[chip8->inst.Y];
 
-        case 0x0E:
+    const bool carry = (chip8->V[chip8->inst.X] & 0x80) >> 7;
 
-            if(chip8->inst.NN == 0x9E) {
-                // 0xEX9E: Skip next instruction if key in V[X] is pressed
-                if(chip8->keypad[chip8->V[chip8->inst.X]])
-                    chip8->PC += 2;
+    chip8->V[chip8->inst.X] <<= 1;
+    chip8->V[0xF] = carry;
+}
 
-            } else if(chip8->inst.NN == 0xA1) {
-                // 0xEXA1: Skip next instruction if key in V[X] is not pressed
-                if(!chip8->keypad[chip8->V[chip8->inst.X]])
-                    chip8->PC += 2;
+// 0x8XYN by N
+static const opcode_handler_t arithmetic_handlers[16] = {
+    op_8XY0, op_8XY1, op_8XY2, op_8XY3, op_8XY4, op_8XY5, op_8XY6, op_8XY7,
+    op_invalid, op_invalid, op_invalid, op_invalid, op_invalid, op_invalid, op_8XYE, op_invalid,
+};
+
+static void op_8XYN(chip8_t *chip8) {
+    arithmetic_handlers[chip8->inst.N](chip8);
+}
+
+static void op_9XY0(chip8_t *chip8) {
+    // 0x9XY0: Skips the next instruction if V[X] does not equal V[Y]
+    if(chip8->inst.N != 0) {
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+        return;
+    }
+
+    if(chip8->V[chip8->inst.X] != chip8->V[chip8->inst.Y])
+        skip_instruction(chip8);
+}
+
+static void op_ANNN(chip8_t *chip8) {
+    // 0xANNN: Set index register I to NNN
+    chip8->I = chip8->inst.NNN;
+}
+
+static void op_BNNN(chip8_t *chip8) {
+    // 0xBNNN: Jumps to the address NNN plus V[0]
+    // CHIP-48/SCHIP quirk: 0xBXNN jumps to XNN plus V[X]
+    if(chip8->quirks.jump_vx)
+        chip8->PC = chip8->inst.NNN + chip8->V[chip8->inst.X];
+    else
+        chip8->PC = chip8->inst.NNN + chip8->V[0x0];
+}
+
+static void op_CXNN(chip8_t *chip8) {
+    // 0xCXNN: Sets V[X] to the result of a bitwise AND operation between a random number (0 to 255) and NN
+    chip8->V[chip8->inst.X] = random_byte(chip8) & chip8->inst.NN;
+}
+
+static void op_DXYN(chip8_t *chip8) {
+    // 0XDXYN: Draw N-height sprite at coords X,Y; Read from memory location I
+    // Screen pixels are XOR'd with sprite bits
+    // VF (Carry flag) is set if any screen pixels are set off (This is useful for collision detection)
+    // SUPER-CHIP: 0xDXY0 draws a 16x16 sprite
+    // Mega-Chip color mode draws a color sprite of the size set by 03NN/04NN, see draw_mega_sprite()
+    // The COSMAC VIP draws after the next display interrupt, so at most one sprite per frame
+    if(chip8->quirks.display_wait) {
+        if(!chip8->vblank_wait) {
+            chip8->vblank_wait = true;
+            chip8->vblank = false;
+        }
+        if(!chip8->vblank) {
+            chip8->PC -= 2;
+            return;
+        }
+        chip8->vblank_wait = false;
+    }
+
+    if(chip8->mega)
+        chip8->V[0xF] = draw_mega_sprite(chip8, chip8->V[chip8->inst.X], chip8->V[chip8->inst.Y], chip8->inst.N);
+    else if(chip8->inst.N == 0)
+        chip8->V[0xF] = draw_sprite(chip8, chip8->V[chip8->inst.X], chip8->V[chip8->inst.Y], 16, 16);
+    else
+        chip8->V[0xF] = draw_sprite(chip8, chip8->V[chip8->inst.X], chip8->V[chip8->inst.Y], 8, chip8->inst.N);
+}
+
+static void op_EXNN(chip8_t *chip8) {
+    if(chip8->inst.NN == 0x9E) {
+        // 0xEX9E: Skip next instruction if key in V[X] is pressed
+        if(key_down(chip8, chip8->V[chip8->inst.X]))
+            skip_instruction(chip8);
+
+    } else if(chip8->inst.NN == 0xA1) {
+        // 0xEXA1: Skip next instruction if key in V[X] is not pressed
+        if(!key_down(chip8, chip8->V[chip8->inst.X]))
+            skip_instruction(chip8);
+
+    } else {
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+    }
+}
+
+static void op_F000(chip8_t *chip8) {
+    // 0xF000 NNNN: XO-CHIP sets I to the 16 bit address NNNN in the next word
+    // Anywhere else it would run NNNN as an instruction of its own, so it has to stop here
+    if(!chip8->xochip || chip8->inst.X != 0) {
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+        return;
+    }
+
+    chip8->I = (read_byte(chip8, chip8->PC) << 8) | read_byte(chip8, chip8->PC + 1);
+    chip8->PC += 2;
+}
+
+static void op_FN01(chip8_t *chip8) {
+    // 0xFN01: XO-CHIP selects the drawing planes N (bit 0 plane 1, bit 1 plane 2)
+    if(!chip8->xochip) {
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+        return;
+    }
+
+    chip8->planes = chip8->inst.X & 0x3;
+}
+
+static void op_F002(chip8_t *chip8) {
+    // 0xF002: XO-CHIP loads 16 bytes from I into the audio pattern buffer
+    if(!chip8->xochip || chip8->inst.X != 0) {
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+        return;
+    }
+
+    for(int i = 0; i < (int)sizeof chip8->pattern; i++)
+        chip8->pattern[i] = read_data(chip8, chip8->I + i);
+}
+
+static void op_FX3A(chip8_t *chip8) {
+    // 0xFX3A: XO-CHIP sets the audio pattern playback pitch to VX
+    if(!chip8->xochip) {
+        set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+        return;
+    }
+
+    chip8->pitch = chip8->V[chip8->inst.X];
+}
+
+static void op_FX07(chip8_t *chip8) {
+    // 0xFX07: Sets VX to the value of the delay timer.
+    chip8->V[chip8->inst.X] = chip8->delay_timer;
+}
+
+static void op_FX0A(chip8_t *chip8) {
+    //0xFX0A: A key press is awaited, and then stored in VX (blocking operation, all instruction halted until next key event)
+    // The COSMAC VIP only stores the key once it's released again, timers keep running meanwhile
+    if(chip8->wait_key < 0) {
+        for(uint8_t i = 0; i < sizeof chip8->keypad; i++) {
+            if(key_down(chip8, i)) {
+                chip8->wait_key = i;
+                break;
             }
-            break;
+        }
+    }
 
-        case 0x0F:
-        
-            switch(chip8->inst.NN) {
+    if(chip8->wait_key >= 0 && (chip8->quirks.key_press || !key_down(chip8, chip8->wait_key))) {
+        chip8->V[chip8->inst.X] = chip8->wait_key;
+        chip8->wait_key = -1;
+    } else {
+        // No key yet or it's still held down, keep executing current instruction
+        chip8->PC -= 2;
+    }
+}
 
-                case 0x07:
-                    // 0xFX07: Sets VX to the value of the delay timer.
-                    chip8->V[chip8->inst.X] = chip8->delay_timer;
-                    break;
+static void op_FX15(chip8_t *chip8) {
+    // 0xFX15: Sets the delay timer to VX
+    chip8->delay_timer = chip8->V[chip8->inst.X];
+}
 
-                case 0x0A:
-                    //0xFX0A: A key press is awaited, and then stored in VX (blocking operation, all instruction halted until next key event)
-                    bool any_key_pressed = false;
-                    for(uint8_t i = 0; i < sizeof chip8->keypad; i++) {
-                        if(chip8->keypad[i]) {
-                            chip8->V[chip8->inst.X] = i;
-                            any_key_pressed = true;
-                            break;
-                        }
-                    }
-                    // If not key has been pressed yet, keep executing current instruction 
-                    if(!any_key_pressed) chip8->PC -= 2; 
-                    break;
+static void op_FX18(chip8_t *chip8) {
+    // 0xFX18: Sets the sound timer to VX.
+    chip8->sound_timer = chip8->V[chip8->inst.X];
+}
 
-                case 0x15:
-                    // 0xFX15: Sets the delay timer to VX
-                    chip8->delay_timer = chip8->V[chip8->inst.X];
-                    break;
+static void op_FX1E(chip8_t *chip8) {
+    // 0xFX1E: Adds VX to I. VF is not affected.
+    chip8->I += chip8->V[chip8->inst.X];
+}
 
-                case 0x18:
-                    // 0xFX18: Sets the sound timer to VX.
-                    chip8->sound_timer = chip8->V[chip8->inst.X];
-                    break;
+static void op_FX29(chip8_t *chip8) {
+    // 0xFX29: Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
+    chip8->I = CHIP8_FONT_ADDR + (chip8->V[chip8->inst.X] & 0xF) * CHIP8_FONT_HEIGHT;
+}
 
-                case 0x1E:
-                    // 0xFX1E: Adds VX to I. VF is not affected.
-                    chip8->I += chip8->V[chip8->inst.X];
-                    break;
+static void op_FX33(chip8_t *chip8) {
+    // 0xFX33: Stores the binary-coded decimal representation of VX-
+    // With the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.
+    uint8_t bcd = chip8->V[chip8->inst.X];
+    write_byte(chip8, chip8->I + 2, bcd % 10);
+    bcd /= 10;
+    write_byte(chip8, chip8->I + 1, bcd % 10);
+    bcd /= 10;
+    write_byte(chip8, chip8->I, bcd % 10);
+}
 
-                case 0x29:
-                    // 0xFX29: Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
-                    chip8->I = chip8->V[chip8->inst.X] * 5;
-                    break;
+static void op_FX55(chip8_t *chip8) {
+    // 0xFX55: Stores from V0 to VX (including VX) in memory, starting at address I.
+    // The offset from I is increased by 1 for each value written, but I itself is left unmodified.
+    // Original COSMAC leaves I incremented past the last written address instead
+    for(int i = 0; i <= chip8->inst.X; i++)
+        write_byte(chip8, chip8->I + i, chip8->V[i]);
 
-                case 0x33:
-                    // 0xFX33: Stores the binary-coded decimal representation of VX-
-                    // With the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.
-                    uint8_t bcd = chip8->V[chip8->inst.X];
-                    chip8->ram[chip8->I + 2] = bcd % 10;
-                    bcd /= 10;
-                    chip8->ram[chip8->I + 1] = bcd % 10;
-                    bcd /= 10;
-                    chip8->ram[chip8->I] = bcd % 10;                    
-                    break;
+    if(chip8->quirks.increment_i) chip8->I += chip8->inst.X + 1;
+}
 
-                case 0x55:
-                    // 0xFX55: Stores from V0 to VX (including VX) in memory, starting at address I. 
-                    // The offset from I is increased by 1 for each value written, but I itself is left unmodified.
-                    for(int i = 0; i <= chip8->inst.X; i++)
-                        chip8->ram[chip8->I + i] = chip8->V[i];
-                    break;
+static void op_FX65(chip8_t *chip8) {
+    // 0xFX65: Fills from V0 to VX (including VX) with values from memory, starting at address I.
+    // The offset from I is increased by 1 for each value read, but I itself is left unmodified.
+    // Original COSMAC leaves I incremented past the last read address instead
+    for(int i = 0; i <= chip8->inst.X; i++)
+        chip8->V[i] = read_data(chip8, chip8->I + i);
 
-                case 0x65:
-                    // 0xFX65: Fills from V0 to VX (including VX) with values from memory, starting at address I. 
-                    // The offset from I is increased by 1 for each value read, but I itself is left unmodified.
-                    for(int i = 0; i <= chip8->inst.X; i++)
-                        chip8->V[i] = chip8->ram[chip8->I + i];
-                    break;
+    if(chip8->quirks.increment_i) chip8->I += chip8->inst.X + 1;
+}
 
-                default:
-                    break; // Uinmplemented/Wrong opcode 
+static void op_FX30(chip8_t *chip8) {
+    // 0xFX30: SUPER-CHIP sets I to the location of the 8x10 sprite for digit VX
+    chip8->I = CHIP8_BIG_FONT_ADDR + (chip8->V[chip8->inst.X] % 10) * CHIP8_BIG_FONT_HEIGHT;
+}
+
+static void op_FX75(chip8_t *chip8) {
+    // 0xFX75: SUPER-CHIP stores V0 to VX (X < 8) in the HP48 RPL user flags
+    for(int i = 0; i <= chip8->inst.X && i < (int)sizeof chip8->rpl; i++)
+        chip8->rpl[i] = chip8->V[i];
+}
+
+static void op_FX85(chip8_t *chip8) {
+    // 0xFX85: SUPER-CHIP fills V0 to VX (X < 8) from the HP48 RPL user flags
+    for(int i = 0; i <= chip8->inst.X && i < (int)sizeof chip8->rpl; i++)
+        chip8->V[i] = chip8->rpl[i];
+}
+
+// 0xFXNN by NN, NULL entries are invalid opcodes
+static const opcode_handler_t misc_handlers[256] = {
+    [0x00] = op_F000, [0x01] = op_FN01, [0x02] = op_F002, [0x07] = op_FX07, [0x0A] = op_FX0A,
+    [0x15] = op_FX15, [0x18] = op_FX18, [0x1E] = op_FX1E, [0x29] = op_FX29, [0x30] = op_FX30,
+    [0x33] = op_FX33, [0x3A] = op_FX3A, [0x55] = op_FX55, [0x65] = op_FX65, [0x75] = op_FX75,
+    [0x85] = op_FX85,
+};
+
+static void op_FXNN(chip8_t *chip8) {
+    const opcode_handler_t handler = misc_handlers[chip8->inst.NN];
+
+    if(handler) handler(chip8);
+    else set_fault(chip8, CHIP8_FAULT_INVALID_OPCODE);
+}
+
+// Opcodes by their first hex digit
+static const opcode_handler_t opcode_handlers[16] = {
+    op_0NNN, op_1NNN, op_2NNN, op_3XNN, op_4XNN, op_5XYN, op_6XNN, op_7XNN,
+    op_8XYN, op_9XY0, op_ANNN, op_BNNN, op_CXNN, op_DXYN, op_EXNN, op_FXNN,
+};
+
+// Handler for a decoded instruction with the nested tables already looked up, for the decode cache
+static opcode_handler_t final_handler(const instruction_t *inst) {
+    switch(inst->opcode >> 12) {
+        case 0x8: return arithmetic_handlers[inst->N];
+        case 0xF: return misc_handlers[inst->NN] ? misc_handlers[inst->NN] : op_invalid;
+        default:  return opcode_handlers[inst->opcode >> 12];
+    }
+}
+
+// Emulate CHIP8 instructions
+void chip8_step(chip8_t *chip8) {
+    const uint16_t inst_addr = chip8->PC;
+
+    // Only instructions completely inside memory are cached, fetches that wrap around or fault are decoded every time
+    decoded_t *decoded = chip8->decode_cache && inst_addr + 1u < chip8->ram_size ?
+                         &chip8->decode_cache->entries[inst_addr] : NULL;
+    opcode_handler_t handler;
+
+    if(decoded && decoded->handler) {
+        chip8->inst = decoded->inst;
+        chip8->PC += 2;
+        handler = decoded->handler;
+    } else {
+        const chip8_fault_t fault = chip8->fault;
+        chip8->inst.opcode = (read_byte(chip8, chip8->PC) << 8) | read_byte(chip8, chip8->PC + 1); // Get next opcode form RAM
+        if(chip8->fault != fault) return;   // Running into memory nothing wrote, there's no instruction there
+        chip8->PC += 2; // Increment program counter for next opcode
+
+        // Fill out instruction format
+        chip8->inst.NNN = chip8->inst.opcode & 0x0FFF;
+        chip8->inst.NN = chip8->inst.opcode & 0x0FF;
+        chip8->inst.N = chip8->inst.opcode & 0x0F;
+        chip8->inst.X = (chip8->inst.opcode >> 8) & 0x0F;
+        chip8->inst.Y = (chip8->inst.opcode >> 4) & 0x0F;
+
+        handler = opcode_handlers[chip8->inst.opcode >> 12];
+
+        // Cached before running it, an instruction overwriting itself invalidates its own entry
+        if(decoded) {
+            decoded->inst = chip8->inst;
+            decoded->handler = final_handler(&chip8->inst);
+            handler = decoded->handler;
+        }
+    }
+
+    if(chip8->log_instructions) print_debug_info(chip8);
+
+    if(chip8->step_hook) {
+        const chip8_step_action_t action = chip8->step_hook(chip8->step_userdata, inst_addr, chip8->inst.opcode);
+
+        if(action == CHIP8_STEP_PAUSE) {
+            chip8->PC = inst_addr;
+            chip8_set_paused(chip8, true);
+            return;
+        } else if(action == CHIP8_STEP_SKIP) {
+            chip8->PC = inst_addr;
+            skip_instruction(chip8);
+            return;
+        }
+    }
+
+    if(chip8->platform != CHIP8_PLATFORM_ANY && chip8_opcode_platform(chip8->inst.opcode) > chip8->platform) {
+        set_fault(chip8, CHIP8_FAULT_PLATFORM_OPCODE);
+        chip8->PC = inst_addr;
+        return;
+    }
+
+    // Emulate opcode
+    handler(chip8);
+
+    // Leave PC at the faulting instruction for the fault report and debuggers
+    if(chip8->fault != CHIP8_FAULT_NONE) chip8->PC = inst_addr;
+}
+
+// Fetch, decode and the jump through the interpreter's table to the instruction's routine
+#define VIP_FETCH_CYCLES 40
+#define VIP_CLEAR_CYCLES (24 + 256 * 6)     // A loop over the 256 display bytes
+
+// 00E0 is the dearest instruction, an instruction can't take a frame's balance further below 0
+#define VIP_MAX_CYCLES (VIP_FETCH_CYCLES + VIP_CLEAR_CYCLES)
+
+static uint32_t vip_execute_cycles(const chip8_t *chip8, uint16_t inst_addr) {
+    const instruction_t *inst = &chip8->inst;
+    const bool skipped = chip8->PC == (uint16_t)(inst_addr + 4);
+
+    switch(inst->opcode >> 12) {
+        case 0x0:
+            if(inst->opcode == 0x00E0) return VIP_CLEAR_CYCLES;
+            if(inst->opcode == 0x00EE) return 10;
+            return 12;      // Calling a machine code routine, the routine itself isn't known
+        case 0x1: return 12;
+        case 0x2: return 26;
+        case 0x3: case 0x4: return skipped ? 14 : 10;
+        case 0x5: case 0x9: return skipped ? 18 : 14;
+        case 0x6: return 6;
+        case 0x7: return 10;
+        case 0x8: return inst->N == 0 ? 12 : 44;  // The ALU ones are built in memory and run from there
+        case 0xA: return 12;
+        case 0xB: return 22;
+        case 0xC: return 36;
+        case 0xD:
+            // Sprites not on a byte boundary are shifted across two display bytes per row
+            return 26 + inst->N * (chip8->V[inst->X] % 8 ? 70 : 46);
+        case 0xE: return skipped ? 18 : 14;
+        case 0xF:
+            switch(inst->NN) {
+                case 0x0A: return 19;   // Per keyboard scan while it waits
+                case 0x1E: case 0x29: return 16;
+                case 0x33: {
+                    // Digits by repeated subtraction
+                    const uint8_t value = chip8->V[inst->X];
+                    return 80 + 16 * (value / 100 + value / 10 % 10 + value % 10);
+                }
+                case 0x55: case 0x65: return 14 + 14 * (inst->X + 1);
+                default: return 10;
             }
+    }
+
+    return 0;
+}
+
+uint32_t chip8_vip_cycles(const chip8_t *chip8, uint16_t inst_addr) {
+    if(chip8->vblank_wait && (chip8->inst.opcode >> 12) == 0xD) return 0;
+    return VIP_FETCH_CYCLES + vip_execute_cycles(chip8, inst_addr);
+}
+
+// The interpreter idles from a sprite waiting for the display interrupt until the frame is over,
+// the next frame starts at the interrupt
+uint32_t chip8_run_vip_frame(chip8_t *chip8, chip8_run_t run, void *userdata) {
+    uint32_t insts = 0;
+    chip8->cycle_balance += CHIP8_VIP_FRAME_CYCLES;
+
+    while(chip8->cycle_balance > 0 && chip8->state == RUNNING) {
+        const uint16_t inst_addr = chip8->PC;
+        if(run) run(userdata, chip8);
+        else chip8_step(chip8);
+        insts++;
+
+        if(chip8->vblank_wait) {
+            chip8->cycle_balance = 0;
             break;
+        }
+        chip8->cycle_balance -= chip8_vip_cycles(chip8, inst_addr);
+    }
 
-        default:
-            break; // Unimplemented or invalid opcode
+    // A machine that stopped running halfway doesn't keep the rest of the frame for when it resumes
+    if(chip8->cycle_balance > 0) chip8->cycle_balance = 0;
+    return insts;
+}
+
+uint32_t chip8_run_flat_frame(chip8_t *chip8, chip8_run_t run, void *userdata) {
+    const uint32_t budget = chip8->insts_per_second + chip8->frame_remainder;
+    chip8->frame_remainder = budget % 60;
+
+    uint32_t insts = 0;
+    for(; insts < budget / 60 && chip8->state == RUNNING; insts++) {
+        if(run) run(userdata, chip8);
+        else chip8_step(chip8);
     }
+
+    return insts;
+}
+
+bool chip8_run_frame(chip8_t *chip8) {
+    // Paused and stopped machines keep their timers too
+    if(chip8->state != RUNNING) return false;
+
+    const bool drawn = chip8->draw;
+    chip8->draw = false;
+
+    if(chip8->timing == CHIP8_TIMING_VIP) chip8_run_vip_frame(chip8, NULL, NULL);
+    else chip8_run_flat_frame(chip8, NULL, NULL);
+    chip8_update_timers(chip8);
+
+    const bool changed = chip8->draw;
+    chip8->draw = drawn || changed;
+    return changed;
 }
 
-int main(int argc, char **argv) {
+// Decrement delay and sound timers, called at 60Hz
+void chip8_update_timers(chip8_t *chip8) {
+    chip8->vblank = true;
+
+    if(chip8->delay_timer > 0) chip8->delay_timer--;
+
+    if(chip8->sound_timer > 0) chip8->sound_timer--;
+}
 
-    if(argc < 2) {
-        fprintf(stderr, "Usage %s <rom_path>\n", argv[0]);
-        exit(EXIT_FAILURE);
+// The buzzer sounds as long as the sound timer is non-zero
+bool chip8_sound_active(const chip8_t *chip8) {
+    return chip8->sound_timer > 0;
+}
+
+// Save state format, all multi-byte values are big endian:
+//   "C8ST" magic, u16 version, u32 ram size, ram, display, u8 planes, u8 hires,
+//   u8 stack depth, u16 stack[16], V[16], u16 I, u16 PC, u8 delay, u8 sound, keypad[16],
+//   rpl[8], u8 xochip, pattern[16], u8 pitch, u8 quirks bitmask, u32 rng state (version 2),
+//   u8 key awaited by FX0A (version 3), u8 DXYN waiting, u8 display interrupt seen (version 4),
+//   u8 frame remainder (version 6), u32 VIP cycle balance (version 7), u8 megachip (version 5), followed by
+//   the Mega-Chip state if it's enabled: u8 color mode, mega_display, mega_screen, u32 palette[256],
+//   u16 sprite width, u16 sprite height, u8 screen alpha, u8 blend mode, u8 collision color,
+//   u16 sound address, u32 sound length, u16 sound rate, u8 loop, u8 playing
+// The RAM size depends on XO-CHIP and Mega-Chip mode so the state size does too
+#define STATE_MAGIC "C8ST"
+
+// Cursor into a save state buffer
+typedef struct {
+    uint8_t *data;
+    const uint8_t *in;
+    size_t size;
+    size_t pos;
+    bool truncated;         // Tried to read past the end
+} state_buf_t;
+
+static void put_bytes(state_buf_t *buf, const void *bytes, size_t len) {
+    if(buf->data && buf->pos + len <= buf->size) memcpy(&buf->data[buf->pos], bytes, len);
+    buf->pos += len;
+}
+
+static void put_u8(state_buf_t *buf, uint8_t value) {
+    put_bytes(buf, &value, 1);
+}
+
+static void put_u16(state_buf_t *buf, uint16_t value) {
+    put_u8(buf, value >> 8);
+    put_u8(buf, value & 0xFF);
+}
+
+static void put_u32(state_buf_t *buf, uint32_t value) {
+    put_u16(buf, value >> 16);
+    put_u16(buf, value & 0xFFFF);
+}
+
+static bool get_bytes(state_buf_t *buf, void *bytes, size_t len) {
+    if(buf->pos + len > buf->size) {
+        buf->truncated = true;
+        return false;
     }
 
-    chip8_t chip8 = {0};
-    const char *rom_name = argv[1];
-    if(!init_chip8(&chip8, rom_name)) exit(EXIT_FAILURE);
+    memcpy(bytes, &buf->in[buf->pos], len);
+    buf->pos += len;
+    return true;
+}
 
-    config_t config = {0}; 
-    if(!init_config(&config, argc, argv)) exit(EXIT_FAILURE);
+static uint8_t get_u8(state_buf_t *buf) {
+    uint8_t value = 0;
+    get_bytes(buf, &value, 1);
+    return value;
+}
 
-    sdl_t sdl = {0};
-    if(!init_sdl(&sdl, &config)) exit(EXIT_FAILURE);
+static uint16_t get_u16(state_buf_t *buf) {
+    const uint8_t hi = get_u8(buf);
+    return (hi << 8) | get_u8(buf);
+}
 
-    clear_screen(sdl, config);
+static uint32_t get_u32(state_buf_t *buf) {
+    const uint32_t hi = get_u16(buf);
+    return (hi << 16) | get_u16(buf);
+}
 
-    srand(time(NULL));
+static uint8_t quirk_bits(const quirks_t *quirks) {
+    return quirks->shift_vx << 0 | quirks->increment_i << 1 | quirks->jump_vx << 2 |
+           quirks->vf_reset << 3 | quirks->clip_sprites << 4 | quirks->key_press << 5 |
+           quirks->display_wait << 6;
+}
 
-    // Main emulator loop
-    while(chip8.state != QUIT) {
-        handle_input(&chip8);
+static void write_state(const chip8_t *chip8, state_buf_t *buf) {
+    put_bytes(buf, STATE_MAGIC, 4);
+    put_u16(buf, CHIP8_STATE_VERSION);
+    put_u16(buf, chip8->ram_size >> 16);
+    put_u16(buf, chip8->ram_size & 0xFFFF);
+    put_bytes(buf, chip8->ram, chip8->ram_size);
+    put_bytes(buf, chip8->display, sizeof chip8->display);
+    put_u8(buf, chip8->planes);
+    put_u8(buf, chip8->hires);
+
+    put_u8(buf, chip8->stack_ptr - chip8->stack);
+    for(size_t i = 0; i < 16; i++) put_u16(buf, chip8->stack[i]);
+
+    put_bytes(buf, chip8->V, sizeof chip8->V);
+    put_u16(buf, chip8->I);
+    put_u16(buf, chip8->PC);
+    put_u8(buf, chip8->delay_timer);
+    put_u8(buf, chip8->sound_timer);
+    for(size_t i = 0; i < 16; i++) put_u8(buf, chip8->keypad[i]);
+    put_bytes(buf, chip8->rpl, sizeof chip8->rpl);
+    put_u8(buf, chip8->xochip);
+    put_bytes(buf, chip8->pattern, sizeof chip8->pattern);
+    put_u8(buf, chip8->pitch);
+    put_u8(buf, quirk_bits(&chip8->quirks));
+    put_u16(buf, chip8->rng_state >> 16);
+    put_u16(buf, chip8->rng_state & 0xFFFF);
+    put_u8(buf, chip8->wait_key);
+    put_u8(buf, chip8->vblank_wait);
+    put_u8(buf, chip8->vblank);
+    put_u8(buf, chip8->frame_remainder);
+    put_u32(buf, (uint32_t)chip8->cycle_balance);
+
+    put_u8(buf, chip8->megachip);
+    if(!chip8->megachip) return;
+
+    put_u8(buf, chip8->mega);
+    put_bytes(buf, chip8->mega_display, sizeof chip8->mega_display);
+    put_bytes(buf, chip8->mega_screen, sizeof chip8->mega_screen);
+    for(size_t i = 0; i < 256; i++) put_u32(buf, chip8->palette[i]);
+    put_u16(buf, chip8->sprite_width);
+    put_u16(buf, chip8->sprite_height);
+    put_u8(buf, chip8->screen_alpha);
+    put_u8(buf, chip8->blend);
+    put_u8(buf, chip8->collision_color);
+    put_u16(buf, chip8->sound.addr);
+    put_u32(buf, chip8->sound.length);
+    put_u16(buf, chip8->sound.rate);
+    put_u8(buf, chip8->sound.loop);
+    put_u8(buf, chip8->sound.playing);
+}
 
-        if(chip8.state == PAUSED) continue;
+// Size of the save state for the current machine
+size_t chip8_state_size(const chip8_t *chip8) {
+    state_buf_t buf = {0};
+    write_state(chip8, &buf);
+    return buf.pos;
+}
 
-        emulate_instruction(&chip8, config);
-        
-        // Delay for approximately 60Hz (16.67ms)
-        SDL_Delay(16);
+// Serialize the machine into data, returns the state size or 0 if size is too small
+size_t chip8_serialize(const chip8_t *chip8, uint8_t *data, size_t size) {
+    state_buf_t buf = {.data = data, .size = size};
+
+    if(chip8_state_size(chip8) > size) return 0;
+
+    write_state(chip8, &buf);
+    return buf.pos;
+}
+
+// Restore the machine from a serialized state, the machine is left untouched on errors
+// The running ROM name is kept as is
+bool chip8_deserialize(chip8_t *chip8, const uint8_t *data, size_t size) {
+    state_buf_t buf = {.in = data, .size = size};
+    char magic[4];
+
+    if(!get_bytes(&buf, magic, sizeof magic) || memcmp(magic, STATE_MAGIC, 4) != 0) {
+        chip8_log(chip8, CHIP8_LOG_ERROR, "state", "Not a CHIP8 save state");
+        return false;
+    }
+
+    const uint16_t version = get_u16(&buf);
+    // Version 1 states lack the RNG state, version 2 the key FX0A is waiting on, version 3 the DXYN wait,
+    // version 4 the Mega-Chip state, version 5 the instructions chip8_run_frame() carries over, version 6 the
+    // VIP machine cycles it does
+    if(version < 1 || version > CHIP8_STATE_VERSION) {
+        chip8_log(chip8, CHIP8_LOG_ERROR, "state", "Unsupported save state version %u, expected %u", version,
+                  CHIP8_STATE_VERSION);
+        return false;
+    }
+
+    const uint32_t hi = get_u16(&buf);
+    const uint32_t ram_size = (hi << 16) | get_u16(&buf);
+    if(ram_size != CHIP8_RAM_SIZE && ram_size != CHIP8_XO_RAM_SIZE) {
+        chip8_log(chip8, CHIP8_LOG_ERROR, "state", "Invalid save state memory size %u", ram_size);
+        return false;
+    }
+
+    // Decode into a copy so a bad state can't leave a half restored machine
+    chip8_t *state = malloc(sizeof *state);
+    if(!state) return false;
+    *state = *chip8;
+
+    state->ram_size = ram_size;
+    memset(state->ram, 0, sizeof state->ram);
+    get_bytes(&buf, state->ram, state->ram_size);
+    get_bytes(&buf, state->display, sizeof state->display);
+    state->planes = get_u8(&buf) & 0x3;
+    state->hires = get_u8(&buf);
+
+    const uint8_t depth = get_u8(&buf);
+    for(size_t i = 0; i < 16; i++) state->stack[i] = get_u16(&buf);
+
+    get_bytes(&buf, state->V, sizeof state->V);
+    state->I = get_u16(&buf);
+    state->PC = get_u16(&buf);
+    state->delay_timer = get_u8(&buf);
+    state->sound_timer = get_u8(&buf);
+    for(size_t i = 0; i < 16; i++) state->keypad[i] = get_u8(&buf);
+    get_bytes(&buf, state->rpl, sizeof state->rpl);
+    state->xochip = get_u8(&buf);
+    get_bytes(&buf, state->pattern, sizeof state->pattern);
+    state->pitch = get_u8(&buf);
+
+    const uint8_t quirks = get_u8(&buf);
+    state->quirks = (quirks_t) {
+        .shift_vx = quirks & (1 << 0),
+        .increment_i = quirks & (1 << 1),
+        .jump_vx = quirks & (1 << 2),
+        .vf_reset = quirks & (1 << 3),
+        .clip_sprites = quirks & (1 << 4),
+        .key_press = quirks & (1 << 5),
+        .display_wait = quirks & (1 << 6),
+    };
+
+    if(version >= 2) {
+        const uint32_t rng_hi = get_u16(&buf);
+        state->rng_state = (rng_hi << 16) | get_u16(&buf);
+        if(state->rng_state == 0) chip8_seed(state, 0);
+    }
+
+    state->wait_key = -1;
+    if(version >= 3) state->wait_key = (int8_t) get_u8(&buf);
+
+    state->vblank_wait = false;
+    state->vblank = false;
+    if(version >= 4) {
+        state->vblank_wait = get_u8(&buf);
+        state->vblank = get_u8(&buf);
+    }
+
+    // Older states start the next frame without a remainder, which only moves an instruction between frames
+    state->frame_remainder = version >= 6 ? get_u8(&buf) : 0;
+    state->cycle_balance = version >= 7 ? (int32_t)get_u32(&buf) : 0;
+
+    // Without Mega-Chip in the state the machine is left in regular CHIP8 mode
+    state->megachip = version >= 5 && get_u8(&buf);
+    state->mega = false;
+    state->sound = (chip8_sound_t) {.serial = chip8->sound.serial};
+#ifdef CHIP8_NO_MEGACHIP
+    if(state->megachip) {
+        chip8_log(chip8, CHIP8_LOG_ERROR, "state", "Save state is from a Mega-Chip ROM, this build leaves Mega-Chip out");
+        free(state);
+        return false;
+    }
+#endif
+    if(state->megachip) {
+        state->mega = get_u8(&buf);
+        get_bytes(&buf, state->mega_display, sizeof state->mega_display);
+        get_bytes(&buf, state->mega_screen, sizeof state->mega_screen);
+        for(size_t i = 0; i < 256; i++) state->palette[i] = get_u32(&buf);
+        state->sprite_width = get_u16(&buf);
+        state->sprite_height = get_u16(&buf);
+        state->screen_alpha = get_u8(&buf);
+        state->blend = get_u8(&buf);
+        state->collision_color = get_u8(&buf);
+        state->sound.addr = get_u16(&buf);
+        state->sound.length = get_u32(&buf);
+        state->sound.rate = get_u16(&buf);
+        state->sound.loop = get_u8(&buf);
+        state->sound.playing = get_u8(&buf);
+    }
+    state->sound.serial++;  // Frontends pick up the restored sound
+
+    const bool corrupt = depth > 16 || state->wait_key < -1 || state->wait_key > 0xF ||
+                         state->frame_remainder >= 60 || state->cycle_balance > 0 ||
+                         state->cycle_balance < -VIP_MAX_CYCLES ||
+                         state->sound.addr + (uint64_t)state->sound.length > ram_size ||
+                         (state->megachip && (state->sprite_width < 1 || state->sprite_width > 256 ||
+                         state->sprite_height < 1 || state->sprite_height > 256 || ram_size != CHIP8_XO_RAM_SIZE));
+
+    if(buf.truncated || buf.pos != size || corrupt) {
+        chip8_log(chip8, CHIP8_LOG_ERROR, "state", "Save state is %s",
+                  buf.truncated ? "truncated" : corrupt ? "corrupt" : "too long");
+        free(state);
+        return false;
+    }
+
+    *chip8 = *state;
+    chip8->stack_ptr = &chip8->stack[depth];
+    memset(chip8->written, 0xFF, sizeof chip8->written);   // States don't say which memory was written
+    flush_decoded(chip8);
+    chip8_set_dirty(chip8);
+    chip8_clear_fault(chip8); // The restored machine hasn't faulted yet
+
+    free(state);
+    return true;
+}
+
+bool chip8_save_state_file(const chip8_t *chip8, const char *path) {
+    const size_t size = chip8_state_size(chip8);
+    uint8_t *data = malloc(size);
+    if(!data) return false;
+
+    chip8_serialize(chip8, data, size);
+
+    FILE *file = fopen(path, "wb");
+    bool ok = file && fwrite(data, 1, size, file) == size;
+    if(file && fclose(file) != 0) ok = false;
+    if(!ok) chip8_log(chip8, CHIP8_LOG_ERROR, "state", "Could not write save state %s", path);
+
+    free(data);
+    return ok;
+}
+
+bool chip8_load_state_file(chip8_t *chip8, const char *path) {
+    FILE *file = fopen(path, "rb");
+    if(!file) {
+        chip8_log(chip8, CHIP8_LOG_ERROR, "state", "Could not open save state %s", path);
+        return false;
+    }
+
+    // Largest possible state is a Mega-Chip one, anything bigger is rejected by chip8_deserialize()
+    const size_t max_size = CHIP8_XO_RAM_SIZE + 2048 + sizeof chip8->display + sizeof chip8->mega_display +
+                            sizeof chip8->mega_screen + sizeof chip8->palette;
+    uint8_t *data = malloc(max_size);
+    if(!data) {
+        fclose(file);
+        return false;
+    }
+
+    const size_t size = fread(data, 1, max_size, file);
+    fclose(file);
 
-        update_screen(sdl, config, chip8);
+    const bool ok = chip8_deserialize(chip8, data, size);
+    free(data);
+    return ok;
+}
+
+void chip8_snapshot(const chip8_t *chip8, chip8_snapshot_t *snapshot) {
+    // Padding and unused memory have to be the same in every snapshot of a state
+    memset(snapshot, 0, sizeof *snapshot);
+
+    snapshot->ram_size = chip8->ram_size;
+    snapshot->rng_state = chip8->rng_state;
+    snapshot->frame_remainder = chip8->frame_remainder;
+    snapshot->cycle_balance = chip8->cycle_balance;
+    memcpy(snapshot->palette, chip8->palette, sizeof snapshot->palette);
+    snapshot->sound_length = chip8->sound.length;
+    snapshot->sound_addr = chip8->sound.addr;
+    snapshot->sound_rate = chip8->sound.rate;
+    memcpy(snapshot->stack, chip8->stack, sizeof snapshot->stack);
+    snapshot->I = chip8->I;
+    snapshot->PC = chip8->PC;
+    snapshot->sprite_width = chip8->sprite_width;
+    snapshot->sprite_height = chip8->sprite_height;
+    memcpy(snapshot->ram, chip8->ram, chip8->ram_size);
+    memcpy(snapshot->display, chip8->display, sizeof snapshot->display);
+    memcpy(snapshot->mega_display, chip8->mega_display, sizeof snapshot->mega_display);
+    memcpy(snapshot->mega_screen, chip8->mega_screen, sizeof snapshot->mega_screen);
+    memcpy(snapshot->V, chip8->V, sizeof snapshot->V);
+    memcpy(snapshot->rpl, chip8->rpl, sizeof snapshot->rpl);
+    memcpy(snapshot->pattern, chip8->pattern, sizeof snapshot->pattern);
+    memcpy(snapshot->keypad, chip8->keypad, sizeof snapshot->keypad);
+    snapshot->stack_depth = chip8->stack_ptr - chip8->stack;
+    snapshot->delay_timer = chip8->delay_timer;
+    snapshot->sound_timer = chip8->sound_timer;
+    snapshot->planes = chip8->planes;
+    snapshot->pitch = chip8->pitch;
+    snapshot->screen_alpha = chip8->screen_alpha;
+    snapshot->blend = chip8->blend;
+    snapshot->collision_color = chip8->collision_color;
+    snapshot->quirks = chip8->quirks;
+    snapshot->wait_key = chip8->wait_key;
+    snapshot->hires = chip8->hires;
+    snapshot->vblank_wait = chip8->vblank_wait;
+    snapshot->vblank = chip8->vblank;
+    snapshot->xochip = chip8->xochip;
+    snapshot->megachip = chip8->megachip;
+    snapshot->mega = chip8->mega;
+    snapshot->sound_loop = chip8->sound.loop;
+    snapshot->sound_playing = chip8->sound.playing;
+}
+
+bool chip8_restore(chip8_t *chip8, const chip8_snapshot_t *snapshot) {
+    const chip8_snapshot_t *s = snapshot;
+
+    // The same checks as for save states, so the CPU never indexes out of its arrays
+    if((s->ram_size != CHIP8_RAM_SIZE && s->ram_size != CHIP8_XO_RAM_SIZE) || s->stack_depth > 16 ||
+       s->wait_key < -1 || s->wait_key > 0xF || s->planes > 3 || s->rng_state == 0 || s->frame_remainder >= 60 ||
+       s->cycle_balance > 0 || s->cycle_balance < -VIP_MAX_CYCLES ||
+       s->sound_addr + (uint64_t)s->sound_length > s->ram_size)
+        return false;
+    if(s->megachip && (s->sprite_width < 1 || s->sprite_width > 256 || s->sprite_height < 1 ||
+                       s->sprite_height > 256 || s->ram_size != CHIP8_XO_RAM_SIZE))
+        return false;
+#ifdef CHIP8_NO_MEGACHIP
+    if(s->megachip) return false;
+#endif
+
+    chip8->ram_size = s->ram_size;
+    chip8->rng_state = s->rng_state;
+    chip8->frame_remainder = s->frame_remainder;
+    chip8->cycle_balance = s->cycle_balance;
+    memcpy(chip8->palette, s->palette, sizeof chip8->palette);
+    // Like save states, only Mega-Chip machines have a digitized sound
+    chip8->sound = (chip8_sound_t) {.serial = chip8->sound.serial};
+    if(s->megachip) {
+        chip8->sound.length = s->sound_length;
+        chip8->sound.addr = s->sound_addr;
+        chip8->sound.rate = s->sound_rate;
+        chip8->sound.loop = s->sound_loop;
+        chip8->sound.playing = s->sound_playing;
     }
+    chip8->sound.serial++;  // Frontends pick up the restored sound
+    memcpy(chip8->stack, s->stack, sizeof chip8->stack);
+    chip8->stack_ptr = &chip8->stack[s->stack_depth];
+    chip8->I = s->I;
+    chip8->PC = s->PC;
+    chip8->sprite_width = s->sprite_width;
+    chip8->sprite_height = s->sprite_height;
+    memset(chip8->ram, 0, sizeof chip8->ram);
+    memcpy(chip8->ram, s->ram, s->ram_size);
+    memset(chip8->written, 0xFF, sizeof chip8->written);
+    memcpy(chip8->display, s->display, sizeof chip8->display);
+    memcpy(chip8->mega_display, s->mega_display, sizeof chip8->mega_display);
+    memcpy(chip8->mega_screen, s->mega_screen, sizeof chip8->mega_screen);
+    memcpy(chip8->V, s->V, sizeof chip8->V);
+    memcpy(chip8->rpl, s->rpl, sizeof chip8->rpl);
+    memcpy(chip8->pattern, s->pattern, sizeof chip8->pattern);
+    memcpy(chip8->keypad, s->keypad, sizeof chip8->keypad);
+    chip8->delay_timer = s->delay_timer;
+    chip8->sound_timer = s->sound_timer;
+    chip8->planes = s->planes;
+    chip8->pitch = s->pitch;
+    chip8->screen_alpha = s->screen_alpha;
+    chip8->blend = s->blend;
+    chip8->collision_color = s->collision_color;
+    chip8->quirks = s->quirks;
+    chip8->wait_key = s->wait_key;
+    chip8->hires = s->hires;
+    chip8->vblank_wait = s->vblank_wait;
+    chip8->vblank = s->vblank;
+    chip8->xochip = s->xochip;
+    chip8->megachip = s->megachip;
+    chip8->mega = s->megachip && s->mega;
+
+    flush_decoded(chip8);
+    chip8_set_dirty(chip8);
+    chip8_clear_fault(chip8);
+    return true;
+}
+
+bool chip8_snapshot_equal(const chip8_snapshot_t *a, const chip8_snapshot_t *b) {
+    return memcmp(a, b, sizeof *a) == 0;
+}
+
+// Accessors
+// Display pixels hold a plane bitmask, bit 0 = plane 1, bit 1 = XO-CHIP plane 2
+// They're the regular CHIP8 display even in Mega-Chip mode, use chip8_mega_color() there
+const uint8_t *chip8_display(const chip8_t *chip8) {
+    return chip8->display;
+}
+
+uint32_t chip8_mega_color(const chip8_t *chip8, uint32_t x, uint32_t y, uint32_t background) {
+    if(x >= CHIP8_MEGA_WIDTH || y >= CHIP8_MEGA_HEIGHT || CHIP8_MEGA_PIXELS == 1) return background;
+
+    const uint8_t index = chip8->mega_screen[y * CHIP8_MEGA_WIDTH + x];
+    if(index == 0) return background;
+
+    const uint32_t argb = chip8->palette[index];
+    const uint32_t alpha = (argb >> 24) * chip8->screen_alpha / 255;
+    uint32_t mixed = 0xFF;
 
-    final_cleanup(sdl);
-    exit(EXIT_SUCCESS);
-}
\ No newline at end of file
+    for(int shift = 8; shift < 32; shift += 8) {
+        const uint32_t color = (argb << 8 >> shift) & 0xFF;
+        const uint32_t back = (background >> shift) & 0xFF;
+        mixed |= ((color * alpha + back * (255 - alpha)) / 255) << shift;
+    }
+
+    return mixed;
+}
+
+// Pixel at X,Y in the current display resolution is on in any plane
+bool chip8_pixel(const chip8_t *chip8, uint32_t x, uint32_t y) {
+    return chip8_pixel_planes(chip8, x, y) != 0;
+}
+
+// Planes the pixel at X,Y is on in, Mega-Chip pixels that aren't transparent are on in plane 1
+uint8_t chip8_pixel_planes(const chip8_t *chip8, uint32_t x, uint32_t y) {
+    if(x >= chip8_display_width(chip8) || y >= chip8_display_height(chip8)) return 0;
+    if(chip8->mega) return chip8->mega_screen[y * CHIP8_MEGA_WIDTH + x] != 0;
+
+    return chip8->display[y * chip8_display_width(chip8) + x];
+}
+
+void chip8_set_key(chip8_t *chip8, uint8_t key, bool pressed) {
+    chip8->keypad[key & 0xF] = pressed;
+}
+
+bool chip8_key(const chip8_t *chip8, uint8_t key) {
+    return chip8->keypad[key & 0xF];
+}
+
+uint8_t chip8_register(const chip8_t *chip8, uint8_t reg) {
+    return chip8->V[reg & 0xF];
+}
+
+uint16_t chip8_index(const chip8_t *chip8) {
+    return chip8->I;
+}
+
+uint16_t chip8_pc(const chip8_t *chip8) {
+    return chip8->PC;
+}
+
+void chip8_poke(chip8_t *chip8, uint32_t addr, uint8_t value) {
+    addr &= chip8->ram_size - 1;
+    chip8->ram[addr] = value;
+    mark_written(chip8, addr, 1);
+    if(chip8->decode_cache) invalidate_decoded(chip8, addr);
+}
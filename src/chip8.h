@@ -0,0 +1,430 @@
+#ifndef CHIP8_H
+#define CHIP8_H
+
+#include <stdio.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+// Original CHIP8 resolution
+#define CHIP8_DISPLAY_WIDTH  64
+#define CHIP8_DISPLAY_HEIGHT 32
+
+// SUPER-CHIP hires resolution
+#define CHIP8_HIRES_WIDTH  128
+#define CHIP8_HIRES_HEIGHT 64
+
+// Mega-Chip color mode resolution
+#define CHIP8_MEGA_WIDTH  256
+#define CHIP8_MEGA_HEIGHT 192
+
+// Builds for microcontrollers can leave Mega-Chip out with -DCHIP8_NO_MEGACHIP, which drops its two 48KB
+// frame buffers from chip8_t, chip8_set_megachip() keeps it off and Mega-Chip save states don't load
+#ifdef CHIP8_NO_MEGACHIP
+#define CHIP8_MEGA_PIXELS 1
+#else
+#define CHIP8_MEGA_PIXELS (CHIP8_MEGA_WIDTH*CHIP8_MEGA_HEIGHT)
+#endif
+
+#define CHIP8_RAM_SIZE    4096
+#define CHIP8_XO_RAM_SIZE 65536  // XO-CHIP addressable memory
+#define CHIP8_ENTRY_POINT 0x200  // CHIP8 roms will be loaded at 0x200
+#define CHIP8_FONT_ADDR   0x000  // Built-in hex font sprites 0-F
+#define CHIP8_FONT_HEIGHT 5      // Each font sprite is 4x5 pixels, 1 byte per row
+#define CHIP8_BIG_FONT_ADDR   0x050  // SUPER-CHIP digit sprites 0-9
+#define CHIP8_BIG_FONT_HEIGHT 10     // Each big font sprite is 8x10 pixels
+#define CHIP8_MAX_DEVICES 8          // Memory mapped devices per machine, see chip8_add_device()
+
+// Emulator states
+typedef enum {
+    QUIT,
+    RUNNING,
+    PAUSED,
+} emulator_state_t;
+
+// Machine faults, set by chip8_step() which also stops the machine (state QUIT)
+typedef enum {
+    CHIP8_FAULT_NONE,
+    CHIP8_FAULT_INVALID_OPCODE,
+    CHIP8_FAULT_STACK_OVERFLOW,     // 2NNN with 16 return addresses on the stack
+    CHIP8_FAULT_STACK_UNDERFLOW,    // 00EE with an empty stack
+    CHIP8_FAULT_MEMORY_BOUNDS,      // Access past the end of memory with strict_memory
+    CHIP8_FAULT_PROTECTED_WRITE,    // Write below 0x200 with strict_memory
+    CHIP8_FAULT_PLATFORM_OPCODE,    // Instruction from a later platform than the one selected
+    CHIP8_FAULT_UNINITIALIZED_READ, // Read from 0x200 up of memory nothing wrote, with strict_init
+} chip8_fault_t;
+
+// How many instructions chip8_run_frame() runs, see chip8_set_timing()
+typedef enum {
+    CHIP8_TIMING_FLAT,      // insts_per_second / 60 of any kind
+    CHIP8_TIMING_VIP,       // As many as fit in a frame of the COSMAC VIP's machine cycles
+} chip8_timing_t;
+
+// The VIP's 1802 runs at 1.76064MHz with 8 clocks per machine cycle, 3668 machine cycles per 60Hz frame.
+// The 1861 display takes 1024 of them for DMA (8 bytes on each of 128 lines) and the interrupt routine
+// around 46, the interpreter gets the rest
+#define CHIP8_VIP_FRAME_CYCLES 2598
+
+// What memory holds at power on, apart from the fonts and the ROM. Real machines came up with
+// whatever was in their RAM chips, zero is what most interpreters give a ROM
+typedef enum {
+    CHIP8_RAM_ZERO,
+    CHIP8_RAM_ONES,         // Every byte 0xFF
+    CHIP8_RAM_RANDOM,       // Pseudo-random bytes from ram_seed
+} chip8_ram_fill_t;
+
+// CHIP8 variants, each one has the instructions of the ones before it
+typedef enum {
+    CHIP8_PLATFORM_ANY,     // Every instruction the emulator knows, XO-CHIP ones still need xochip
+    CHIP8_PLATFORM_VIP,     // Original COSMAC VIP CHIP8
+    CHIP8_PLATFORM_CHIP48,  // CHIP-48 on the HP48, the same instructions without 0NNN machine code calls
+    CHIP8_PLATFORM_SCHIP,   // SUPER-CHIP 1.1: hires, scrolling, 16x16 sprites, big font, RPL flags
+    CHIP8_PLATFORM_XOCHIP,  // XO-CHIP: 64KB memory, display planes, audio patterns
+} chip8_platform_t;
+
+// CHIP8 instruction format
+typedef struct {
+    uint16_t opcode;
+    uint16_t NNN;       // 12 bit address/constant
+    uint8_t NN;         // 8 bit constant
+    uint8_t N;          // 4 bit constant
+    uint8_t X;          // 4 bit register identifier
+    uint8_t Y;          // 4 bit register identifier
+
+} instruction_t;
+
+// Interpreter behaviour differences between CHIP8 implementations
+typedef struct {
+    bool shift_vx;          // 8XY6/8XYE shift V[X] in place instead of V[Y] into V[X]
+    bool increment_i;       // FX55/FX65 leave I incremented by X + 1
+    bool jump_vx;           // BNNN jumps to XNN + V[X] instead of NNN + V[0]
+    bool vf_reset;          // 8XY1/8XY2/8XY3 reset V[F] to 0
+    bool clip_sprites;      // Sprites are clipped at the screen edges instead of wrapping
+    bool key_press;         // FX0A takes a key when pressed instead of when released
+    bool display_wait;      // DXYN waits for the next 60Hz display interrupt before drawing
+} quirks_t;
+
+// Random byte source for CXNN, see chip8_set_rand_source()
+typedef uint8_t (*chip8_rand_t)(void *userdata);
+
+// Mega-Chip digitized sound started by 060N, frontends play it straight from memory
+// The sound at I has a 6 byte header: u16 sample rate, u24 length, a reserved byte, then 8 bit unsigned mono samples
+typedef struct {
+    uint16_t addr;          // First sample
+    uint32_t length;        // Samples, cut off at the end of memory
+    uint16_t rate;          // Samples per second
+    bool loop;              // 0600 loops, 0601 plays once
+    bool playing;           // Cleared by 0700
+    uint32_t serial;        // Counts 060N and 0700, changes whenever frontends have to start or stop a sound
+} chip8_sound_t;
+
+// Message levels for chip8_set_log()
+typedef enum {
+    CHIP8_LOG_DEBUG,        // Every instruction in DEBUG builds
+    CHIP8_LOG_INFO,
+    CHIP8_LOG_WARN,
+    CHIP8_LOG_ERROR,        // ROMs and save states that can't be loaded
+} chip8_log_level_t;
+
+// Message callback, subsystem is "cpu", "rom" or "state", message has no newline
+typedef void (*chip8_log_t)(void *userdata, chip8_log_level_t level, const char *subsystem, const char *message);
+
+// What chip8_step() does with an instruction after the step hook saw it
+typedef enum {
+    CHIP8_STEP_RUN,         // Execute it
+    CHIP8_STEP_SKIP,        // Go on to the next instruction without executing it
+    CHIP8_STEP_PAUSE,       // Pause the machine in front of it, the hook sees it again once resumed
+} chip8_step_action_t;
+
+// Instruction callback, gets the address and opcode before the instruction runs, see chip8_set_step_hook()
+typedef chip8_step_action_t (*chip8_step_hook_t)(void *userdata, uint16_t pc, uint16_t opcode);
+
+// Keypad callback, gets the key and whether it's held down and returns the state instructions see
+typedef bool (*chip8_key_hook_t)(void *userdata, uint8_t key, bool pressed);
+
+// Memory access callback, gets the address and the value read or about to be written
+// and returns the value to use instead, see chip8_set_memory_hooks()
+typedef uint8_t (*chip8_memory_hook_t)(void *userdata, uint16_t addr, uint8_t value);
+
+// Memory mapped device, gets the instructions' data accesses to addresses first to last
+// read gets what memory holds and returns what the instruction reads, write gets the value being written
+// and returns what goes into memory, either can be NULL. A device can keep its state in memory or elsewhere
+typedef struct {
+    uint16_t first;
+    uint16_t last;
+    chip8_memory_hook_t read;
+    chip8_memory_hook_t write;
+    void *userdata;
+} chip8_device_t;
+
+// Machine code routine callback for 0NNN, gets NNN and returns false for routines it doesn't have
+// userdata usually points to the machine, so the routine can work with the registers and memory
+typedef bool (*chip8_sys_hook_t)(void *userdata, uint16_t addr);
+
+// CHIP8 machine, everything it needs is in here and the core has no global state,
+// so any number of machines can run side by side, on different threads too
+typedef struct {
+    emulator_state_t state;
+    chip8_fault_t fault;    // Why the machine stopped, PC is left at the faulting instruction
+    uint8_t ram[CHIP8_XO_RAM_SIZE]; // Random access memory
+    uint32_t ram_size;      // Addressable memory, 4KB or 64KB for XO-CHIP
+    uint8_t display[CHIP8_HIRES_WIDTH*CHIP8_HIRES_HEIGHT]; // Row major in the current resolution, plane bitmask per pixel
+    uint8_t planes;         // XO-CHIP planes selected for drawing, bit 0 = plane 1, bit 1 = plane 2
+    bool hires;             // SUPER-CHIP 128x64 mode
+    bool draw;              // Display changed since last render
+    bool dirty_rows[CHIP8_MEGA_HEIGHT]; // Rows of the current resolution changed since chip8_clear_dirty()
+    uint16_t stack[16];     // Subrutine stacks
+    uint16_t *stack_ptr;    // Stack pointer
+    uint8_t V[16];          // Registers V0 - VF
+    uint16_t I;             // Index memory register
+    uint16_t PC;            // Program counter
+    uint8_t delay_timer;    // Decrements at 60Hz
+    uint8_t sound_timer;    // Decrements at 60Hz and plays a tone when > 0
+    bool keypad[16];        // Hexadecimal keypad 0x0 - 0xF
+    int8_t wait_key;        // Key held down during FX0A, stored once it's released, -1 for none
+    bool vblank_wait;       // DXYN is waiting for a display interrupt
+    bool vblank;            // Display interrupt seen since vblank_wait was set
+    uint8_t rpl[8];         // SUPER-CHIP HP48 RPL user flags (FX75/FX85), kept by chip8_reset()
+    bool xochip;            // XO-CHIP extensions enabled
+    uint8_t pattern[16];    // XO-CHIP 1 bit audio pattern buffer, 128 samples
+    uint8_t pitch;          // XO-CHIP pattern playback rate, 4000*2^((pitch-64)/48) Hz
+    bool megachip;          // Mega-Chip extensions enabled
+    bool mega;              // Mega-Chip 256x192 color mode, switched on by 0011 and off by 0010
+    uint8_t mega_display[CHIP8_MEGA_PIXELS]; // Palette index per pixel being drawn, 0 is transparent
+    uint8_t mega_screen[CHIP8_MEGA_PIXELS];  // Frame on screen, 00E0 shows mega_display and clears it
+    uint32_t palette[256];  // Mega-Chip colors as 0xAARRGGBB, loaded by 02NN
+    uint16_t sprite_width;  // Mega-Chip sprite size set by 03NN and 04NN, 1-256
+    uint16_t sprite_height;
+    uint8_t screen_alpha;   // Mega-Chip screen opacity set by 05NN, for fades
+    uint8_t blend;          // Mega-Chip sprite blend mode set by 080N, kept but sprites are drawn opaque
+    uint8_t collision_color; // Drawing over a pixel of this palette index sets VF, set by 09NN
+    chip8_sound_t sound;    // Mega-Chip digitized sound
+    const char *rom_name;   // Currently running ROM
+    uint8_t rom[CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT]; // Copy of the loaded ROM for chip8_reset()
+    size_t rom_size;
+    instruction_t inst;     // Currently executing instruction
+    quirks_t quirks;        // Interpreter behaviour, defaults to the "modern" preset
+    chip8_platform_t platform; // Instructions newer than this platform fault, CHIP8_PLATFORM_ANY allows all
+    bool strict_memory;     // Fault on stray memory accesses instead of wrapping around
+    chip8_ram_fill_t ram_fill; // Memory contents chip8_reset() starts from
+    uint32_t ram_seed;      // For CHIP8_RAM_RANDOM
+    bool strict_init;       // Fault on reads of memory from 0x200 up that was never written
+    uint8_t written[CHIP8_XO_RAM_SIZE / 8]; // Bit per address, set by the ROM, the fonts and writes
+    uint32_t fault_addr;    // Address read for CHIP8_FAULT_UNINITIALIZED_READ
+    uint32_t rng_state;     // Built-in xorshift32 generator, part of save states so replays stay in sync
+    uint32_t insts_per_second; // Speed for chip8_run_frame(), default 700
+    uint32_t frame_remainder;  // Instructions per second left over from previous frames, in 1/60ths
+    chip8_timing_t timing;  // Kept by chip8_reset()
+    int32_t cycle_balance;  // VIP machine cycles an instruction ran over the last frame, 0 or below
+    chip8_rand_t rand_source; // Overrides the built-in generator if set
+    void *rand_userdata;    // Passed to rand_source
+    chip8_memory_hook_t read_hook;  // Called for data reads by instructions if set
+    chip8_memory_hook_t write_hook; // Called for writes by instructions if set
+    void *hook_userdata;    // Passed to the memory hooks
+    chip8_step_hook_t step_hook; // Called before each instruction if set
+    void *step_userdata;    // Passed to step_hook
+    chip8_key_hook_t key_hook; // Called for keypad reads by EX9E, EXA1 and FX0A if set
+    void *key_userdata;     // Passed to key_hook
+    chip8_device_t devices[CHIP8_MAX_DEVICES]; // Peripherals, see chip8_add_device()
+    uint8_t device_count;
+    chip8_sys_hook_t sys_hook; // Runs 0NNN machine code routines if set
+    void *sys_userdata;     // Passed to sys_hook
+    chip8_log_t log;        // Gets the core's messages if set, they go to stderr otherwise
+    void *log_userdata;     // Passed to log
+    bool log_instructions;  // Describe every instruction to the log, off unless asked for
+    struct chip8_decode_cache *decode_cache; // Instructions decoded by address, see chip8_set_decode_cache()
+} chip8_t;
+
+// Machine setup
+void chip8_init(chip8_t *chip8);
+bool chip8_load_rom(chip8_t *chip8, const uint8_t *rom, size_t rom_size);
+bool chip8_load_rom_file(chip8_t *chip8, const char *rom_name);
+bool chip8_reload_rom_file(chip8_t *chip8);
+void chip8_reset(chip8_t *chip8);
+void chip8_set_paused(chip8_t *chip8, bool paused);
+void chip8_set_xochip(chip8_t *chip8, bool enabled);
+void chip8_set_megachip(chip8_t *chip8, bool enabled);
+void chip8_set_strict_memory(chip8_t *chip8, bool enabled);
+void chip8_set_ram_fill(chip8_t *chip8, chip8_ram_fill_t fill, uint32_t seed);
+const char *chip8_ram_fill_name(chip8_ram_fill_t fill);   // "zero", "ff" or "random"
+void chip8_set_strict_init(chip8_t *chip8, bool enabled);
+void chip8_set_speed(chip8_t *chip8, uint32_t insts_per_second);
+void chip8_set_timing(chip8_t *chip8, chip8_timing_t timing);
+
+// Machine cycles the VIP interpreter took for the instruction chip8_step() just ran from inst_addr, as an
+// estimate from the routines in its listing. Skips, registers copied, sprite rows and the sprite's position
+// in its byte are taken from the machine after the instruction. Instructions the VIP doesn't have cost the
+// fetch and decode only, a sprite waiting for the display interrupt doesn't cost anything yet
+uint32_t chip8_vip_cycles(const chip8_t *chip8, uint16_t inst_addr);
+
+// Runs one instruction in place of chip8_step(), for frontends that trace or profile around it
+typedef void (*chip8_run_t)(void *userdata, chip8_t *chip8);
+
+// The instructions of one frame of VIP machine cycles, what chip8_run_frame() runs with CHIP8_TIMING_VIP but
+// without ticking the timers. Each goes through run, chip8_step() if it's NULL. Ends early once the machine
+// stops running or a sprite waits for the display, returns how many instructions ran
+uint32_t chip8_run_vip_frame(chip8_t *chip8, chip8_run_t run, void *userdata);
+
+// The same for the flat timing, insts_per_second / 60 instructions with the remainder carried over in the
+// machine, so save states made by the frontend keep it. Ends early once the machine stops running
+uint32_t chip8_run_flat_frame(chip8_t *chip8, chip8_run_t run, void *userdata);
+
+// Decode each address once and reuse the decoded instruction until memory there is written to
+// The cache takes 1MB and is allocated here, returns false if that fails
+// It's freed by disabling it again, do that before chip8_init() or dropping the machine
+bool chip8_set_decode_cache(chip8_t *chip8, bool enabled);
+
+// Random numbers, the built-in generator starts from a fixed seed so runs are reproducible
+// A custom source replaces it until set back to NULL
+void chip8_seed(chip8_t *chip8, uint32_t seed);
+void chip8_set_rand_source(chip8_t *chip8, chip8_rand_t source, void *userdata);
+
+// Watch or change the memory accesses of instructions, for scripts and cheats, NULL removes a hook
+// Instruction fetches and chip8_poke() don't go through the hooks
+void chip8_set_memory_hooks(chip8_t *chip8, chip8_memory_hook_t read, chip8_memory_hook_t write, void *userdata);
+
+// Tracers, coverage tools and custom breakpoints from outside the core, NULL removes a hook
+// The key hook can also make instructions see keys that aren't pressed (or the other way around)
+void chip8_set_step_hook(chip8_t *chip8, chip8_step_hook_t hook, void *userdata);
+void chip8_set_key_hook(chip8_t *chip8, chip8_key_hook_t hook, void *userdata);
+
+// Peripherals for hardware experiments (a serial port, RAM banks, ...) without changing the core
+// A device sits between the memory hooks and memory for its address range, where ranges overlap the device
+// added first is closest to memory. Returns false if the range is empty or there are CHIP8_MAX_DEVICES already
+// Instruction fetches and chip8_poke() don't reach devices, and save states don't include them
+bool chip8_add_device(chip8_t *chip8, const chip8_device_t *device);
+void chip8_clear_devices(chip8_t *chip8);
+
+// 0NNN calls machine code at NNN on the COSMAC VIP, which can't be emulated and faults as an invalid
+// opcode. The hook can give some of them a meaning instead, NULL removes it. 00E0, 00EE and the
+// SUPER-CHIP, XO-CHIP and Mega-Chip instructions in the 0 group never reach it
+void chip8_set_sys_hook(chip8_t *chip8, chip8_sys_hook_t hook, void *userdata);
+
+// Where the core's messages go, NULL for stderr, with instruction descriptions on stdout
+void chip8_set_log(chip8_t *chip8, chip8_log_t log, void *userdata);
+
+// Log a description of every instruction at debug level, which formats text on each step
+// Off by default so chip8_step() stays free of formatting and allocations, DEBUG builds of the frontend turn it on
+void chip8_set_instruction_log(chip8_t *chip8, bool enabled);
+
+// Quirks, presets are "modern", "cosmac", "schip" and "xochip"
+// Quirk names are shift, load_store, jump, vf_reset, clipping, key_press and display_wait
+bool chip8_quirks_preset(const char *name, quirks_t *quirks);
+bool chip8_set_quirk(quirks_t *quirks, const char *name, bool enabled);
+
+// Quirks by number in the order of quirks_t, for listing them, the name is NULL past the last one
+#define CHIP8_QUIRK_COUNT 7
+const char *chip8_quirk_name(size_t index);
+bool chip8_quirk_enabled(const quirks_t *quirks, size_t index);
+
+// Platforms, the first one with an instruction and display names like "SUPER-CHIP"
+chip8_platform_t chip8_opcode_platform(uint16_t opcode);
+const char *chip8_platform_name(chip8_platform_t platform);
+
+// Display
+void chip8_clear_display(chip8_t *chip8);
+uint32_t chip8_display_width(const chip8_t *chip8);
+uint32_t chip8_display_height(const chip8_t *chip8);
+
+// Changed rows, for renderers that only redraw what changed, draw is set whenever a row is
+// chip8_clear_dirty() is for after rendering, chip8_set_dirty() marks the whole screen, e.g. for new colors
+bool chip8_row_dirty(const chip8_t *chip8, uint32_t y);
+void chip8_clear_dirty(chip8_t *chip8);
+void chip8_set_dirty(chip8_t *chip8);
+
+// Mega-Chip color of the pixel at X,Y on screen mixed over background by its alpha and the screen alpha
+// Colors are 0xRRGGBBAA like the config colors, transparent pixels are the background
+uint32_t chip8_mega_color(const chip8_t *chip8, uint32_t x, uint32_t y, uint32_t background);
+
+// Save states, a versioned binary snapshot of the whole machine
+#define CHIP8_STATE_VERSION 7
+size_t chip8_state_size(const chip8_t *chip8);
+size_t chip8_serialize(const chip8_t *chip8, uint8_t *data, size_t size);
+bool chip8_deserialize(chip8_t *chip8, const uint8_t *data, size_t size);
+bool chip8_save_state_file(const chip8_t *chip8, const char *path);
+bool chip8_load_state_file(chip8_t *chip8, const char *path);
+
+// Plain copy of the machine state for embedding programs and tests, everything a save state has
+// chip8_snapshot() zeroes the struct first, so two snapshots of the same state are equal byte for byte
+// and can be compared with memcmp() or chip8_snapshot_equal()
+// Frontend settings like the platform, hooks and the loaded ROM aren't part of it
+typedef struct {
+    uint32_t ram_size;      // 4KB, or 64KB for XO-CHIP and Mega-Chip
+    uint32_t rng_state;
+    uint32_t frame_remainder; // See chip8_t, under 60
+    int32_t cycle_balance;
+    uint32_t palette[256];  // Mega-Chip colors, 0xAARRGGBB
+    uint32_t sound_length;  // Mega-Chip digitized sound, see chip8_sound_t
+    uint16_t sound_addr;
+    uint16_t sound_rate;
+    uint16_t stack[16];
+    uint16_t I;
+    uint16_t PC;
+    uint16_t sprite_width;  // Mega-Chip sprite size
+    uint16_t sprite_height;
+    uint8_t ram[CHIP8_XO_RAM_SIZE]; // Bytes past ram_size are 0
+    uint8_t display[CHIP8_HIRES_WIDTH*CHIP8_HIRES_HEIGHT];
+    uint8_t mega_display[CHIP8_MEGA_PIXELS];
+    uint8_t mega_screen[CHIP8_MEGA_PIXELS];
+    uint8_t V[16];
+    uint8_t rpl[8];
+    uint8_t pattern[16];
+    bool keypad[16];
+    uint8_t stack_depth;    // Return addresses on the stack, 0-16
+    uint8_t delay_timer;
+    uint8_t sound_timer;
+    uint8_t planes;
+    uint8_t pitch;
+    uint8_t screen_alpha;
+    uint8_t blend;
+    uint8_t collision_color;
+    quirks_t quirks;
+    int8_t wait_key;
+    bool hires;
+    bool vblank_wait;
+    bool vblank;
+    bool xochip;
+    bool megachip;
+    bool mega;
+    bool sound_loop;
+    bool sound_playing;
+} chip8_snapshot_t;
+
+// The snapshot is big (about 170KB), keep it off small stacks
+void chip8_snapshot(const chip8_t *chip8, chip8_snapshot_t *snapshot);
+// Returns false and leaves the machine untouched if the snapshot isn't a state the machine can be in
+bool chip8_restore(chip8_t *chip8, const chip8_snapshot_t *snapshot);
+bool chip8_snapshot_equal(const chip8_snapshot_t *a, const chip8_snapshot_t *b);
+
+// Execute a single instruction at PC
+void chip8_step(chip8_t *chip8);
+
+// Run one 60Hz frame: insts_per_second / 60 instructions, then tick the timers once
+// Speeds that aren't a multiple of 60 carry the rest over, so any 60 frames run insts_per_second instructions
+// Returns true if the display changed during the frame, chip8->draw is left set for the renderer either way
+// Paused or stopped machines don't run at all
+bool chip8_run_frame(chip8_t *chip8);
+
+// Fault reporting, chip8_clear_fault() lets a debugger resume a faulted machine
+const char *chip8_fault_name(chip8_fault_t fault);
+void chip8_print_fault(const chip8_t *chip8, FILE *out);
+void chip8_clear_fault(chip8_t *chip8);
+
+// Timers, chip8_update_timers() has to be called at 60Hz independent of CPU speed
+void chip8_update_timers(chip8_t *chip8);
+bool chip8_sound_active(const chip8_t *chip8);
+
+// Accessors for frontends and embedding programs
+const uint8_t *chip8_display(const chip8_t *chip8);
+bool chip8_pixel(const chip8_t *chip8, uint32_t x, uint32_t y);
+uint8_t chip8_pixel_planes(const chip8_t *chip8, uint32_t x, uint32_t y);
+void chip8_set_key(chip8_t *chip8, uint8_t key, bool pressed);
+bool chip8_key(const chip8_t *chip8, uint8_t key);
+uint8_t chip8_register(const chip8_t *chip8, uint8_t reg);
+uint16_t chip8_index(const chip8_t *chip8);
+uint16_t chip8_pc(const chip8_t *chip8);
+
+// Memory writes from outside the CPU like debuggers, addresses wrap around and the decode cache is kept in sync
+void chip8_poke(chip8_t *chip8, uint32_t addr, uint8_t value);
+
+#endif // CHIP8_H
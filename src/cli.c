@@ -0,0 +1,104 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <errno.h>
+
+#include "cli.h"
+
+// Check if argv[*i] is option --name; if so set value and return true
+// For the "--name value" form *i is advanced past the value
+// value is set to NULL if the option is missing its value
+bool cli_option(const char *name, int argc, char **argv, int *i, const char **value) {
+    const char *arg = argv[*i];
+
+    if(strncmp(arg, "--", 2) != 0) return false;
+    arg += 2;
+
+    const size_t len = strlen(name);
+    if(strncmp(arg, name, len) != 0) return false;
+
+    if(arg[len] == '=') {
+        *value = &arg[len + 1];
+        return true;
+    }
+
+    if(arg[len] != '\0') return false;
+
+    if(*i + 1 < argc) {
+        *value = argv[++*i];
+    } else {
+        fprintf(stderr, "Option --%s requires a value\n", name);
+        *value = NULL;
+    }
+
+    return true;
+}
+
+// Check if arg is the value-less option --name
+bool cli_flag(const char *name, const char *arg) {
+    return strncmp(arg, "--", 2) == 0 && strcmp(arg + 2, name) == 0;
+}
+
+bool cli_parse_uint(const char *name, const char *value, uint32_t min, uint32_t max, uint32_t *out) {
+    if(!value) return false;
+
+    char *end;
+    errno = 0;
+    const unsigned long long num = strtoull(value, &end, 0);
+
+    if(errno != 0 || end == value || *end != '\0' || value[0] == '-' || num < min || num > max) {
+        fprintf(stderr, "Invalid value %s for --%s, expected a number from %u to %u\n", value, name, min, max);
+        return false;
+    }
+
+    *out = (uint32_t)num;
+    return true;
+}
+
+// Colors are given as RRGGBB or RRGGBBAA hex, optionally prefixed with # or 0x
+bool cli_parse_color(const char *name, const char *value, uint32_t *out) {
+    if(!value) return false;
+
+    const char *hex = value;
+    if(hex[0] == '#') hex++;
+    else if(hex[0] == '0' && (hex[1] == 'x' || hex[1] == 'X')) hex += 2;
+
+    const size_t len = strlen(hex);
+    char *end;
+    const unsigned long color = strtoul(hex, &end, 16);
+
+    if((len != 6 && len != 8) || *end != '\0') {
+        fprintf(stderr, "Invalid color %s for --%s, expected RRGGBB or RRGGBBAA\n", value, name);
+        return false;
+    }
+
+    *out = (len == 6) ? (uint32_t)(color << 8) | 0xFF : (uint32_t)color;
+    return true;
+}
+
+uint8_t *cli_read_file(const char *path, size_t *size) {
+    FILE *file = fopen(path, "rb");
+    if(!file) {
+        fprintf(stderr, "Could not open %s: %s\n", path, strerror(errno));
+        return NULL;
+    }
+
+    fseek(file, 0, SEEK_END);
+    const long len = ftell(file);
+    rewind(file);
+
+    uint8_t *data = len >= 0 ? malloc(len + 1) : NULL;
+    if(!data || (len > 0 && fread(data, len, 1, file) != 1)) {
+        fprintf(stderr, "Could not read %s\n", path);
+        free(data);
+        fclose(file);
+        return NULL;
+    }
+
+    fclose(file);
+    data[len] = '\0';
+    *size = (size_t)len;
+    return data;
+}
@@ -0,0 +1,19 @@
+#ifndef CLI_H
+#define CLI_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+// Command line option helpers shared by the subcommands
+// Options are accepted as "--name value" or "--name=value"
+bool cli_option(const char *name, int argc, char **argv, int *i, const char **value);
+bool cli_flag(const char *name, const char *arg);
+bool cli_parse_uint(const char *name, const char *value, uint32_t min, uint32_t max, uint32_t *out);
+bool cli_parse_color(const char *name, const char *value, uint32_t *out);
+
+// Read a whole file into a malloc'd buffer, NULL on errors
+// The buffer has an extra NUL byte after the data so text files can be used as strings
+uint8_t *cli_read_file(const char *path, size_t *size);
+
+#endif // CLI_H
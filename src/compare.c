@@ -0,0 +1,235 @@
+#include <stdio.h>
+#include <stddef.h>
+#include <stdarg.h>
+#include <string.h>
+
+#include "compare.h"
+
+#define MAX_MEMORY_RANGES 16   // Differing memory ranges listed before the rest are only counted
+#define RANGE_BYTES_SHOWN 8    // Bytes of a range printed from each machine
+
+static const char *state_name(emulator_state_t state) {
+    switch(state) {
+        case QUIT:    return "stopped";
+        case RUNNING: return "running";
+        case PAUSED:  return "paused";
+    }
+
+    return "unknown";
+}
+
+static size_t stack_depth(const chip8_t *chip8) {
+    return chip8->stack_ptr ? (size_t)(chip8->stack_ptr - chip8->stack) : 0;
+}
+
+// Counts a difference and prints it, NULL out only counts
+static void report(size_t *count, FILE *out, const char *format, ...) {
+    (*count)++;
+    if(!out) return;
+
+    va_list args;
+    va_start(args, format);
+    vfprintf(out, format, args);
+    va_end(args);
+    fputc('\n', out);
+}
+
+static void compare_registers(const chip8_t *a, const chip8_t *b, size_t *count, FILE *out) {
+    if(a->state != b->state) report(count, out, "State: %s vs %s", state_name(a->state), state_name(b->state));
+    if(a->fault != b->fault)
+        report(count, out, "Fault: %s vs %s", chip8_fault_name(a->fault), chip8_fault_name(b->fault));
+    if(a->PC != b->PC) report(count, out, "PC: 0x%04X vs 0x%04X", a->PC, b->PC);
+    if(a->I != b->I) report(count, out, "I: 0x%04X vs 0x%04X", a->I, b->I);
+
+    for(int i = 0; i < 16; i++)
+        if(a->V[i] != b->V[i]) report(count, out, "V%X: 0x%02X vs 0x%02X", i, a->V[i], b->V[i]);
+
+    if(a->delay_timer != b->delay_timer) report(count, out, "Delay timer: %u vs %u", a->delay_timer, b->delay_timer);
+    if(a->sound_timer != b->sound_timer) report(count, out, "Sound timer: %u vs %u", a->sound_timer, b->sound_timer);
+
+    const size_t depth_a = stack_depth(a), depth_b = stack_depth(b);
+    if(depth_a != depth_b) report(count, out, "Stack depth: %zu vs %zu", depth_a, depth_b);
+    for(size_t i = 0; i < depth_a && i < depth_b; i++)
+        if(a->stack[i] != b->stack[i]) report(count, out, "Stack[%zu]: 0x%04X vs 0x%04X", i, a->stack[i], b->stack[i]);
+
+    for(int key = 0; key < 16; key++)
+        if(a->keypad[key] != b->keypad[key])
+            report(count, out, "Key %X: %s vs %s", key, a->keypad[key] ? "down" : "up", b->keypad[key] ? "down" : "up");
+    if(a->wait_key != b->wait_key) report(count, out, "FX0A key: %d vs %d", a->wait_key, b->wait_key);
+    if(a->vblank_wait != b->vblank_wait)
+        report(count, out, "DXYN waiting for the display: %s vs %s", a->vblank_wait ? "yes" : "no", b->vblank_wait ? "yes" : "no");
+
+    for(size_t i = 0; i < sizeof a->rpl; i++)
+        if(a->rpl[i] != b->rpl[i]) report(count, out, "RPL flag %zu: 0x%02X vs 0x%02X", i, a->rpl[i], b->rpl[i]);
+
+    if(a->rng_state != b->rng_state) report(count, out, "RNG state: 0x%08X vs 0x%08X", a->rng_state, b->rng_state);
+}
+
+static void compare_extensions(const chip8_t *a, const chip8_t *b, size_t *count, FILE *out) {
+    if(a->xochip != b->xochip) report(count, out, "XO-CHIP: %s vs %s", a->xochip ? "on" : "off", b->xochip ? "on" : "off");
+    if(a->planes != b->planes) report(count, out, "Planes: %u vs %u", a->planes, b->planes);
+    if(a->pitch != b->pitch) report(count, out, "Pitch: %u vs %u", a->pitch, b->pitch);
+    if(memcmp(a->pattern, b->pattern, sizeof a->pattern) != 0) report(count, out, "Audio pattern differs");
+
+    if(a->megachip != b->megachip)
+        report(count, out, "Mega-Chip: %s vs %s", a->megachip ? "on" : "off", b->megachip ? "on" : "off");
+    if(!a->megachip || !b->megachip) return;
+
+    if(a->mega != b->mega) report(count, out, "Color mode: %s vs %s", a->mega ? "on" : "off", b->mega ? "on" : "off");
+    if(a->sprite_width != b->sprite_width || a->sprite_height != b->sprite_height)
+        report(count, out, "Sprite size: %ux%u vs %ux%u", a->sprite_width, a->sprite_height, b->sprite_width, b->sprite_height);
+    if(a->screen_alpha != b->screen_alpha) report(count, out, "Screen alpha: 0x%02X vs 0x%02X", a->screen_alpha, b->screen_alpha);
+    if(a->blend != b->blend) report(count, out, "Blend mode: %u vs %u", a->blend, b->blend);
+    if(a->collision_color != b->collision_color)
+        report(count, out, "Collision color: %u vs %u", a->collision_color, b->collision_color);
+
+    for(int i = 0; i < 256; i++)
+        if(a->palette[i] != b->palette[i]) report(count, out, "Palette %d: %08X vs %08X", i, a->palette[i], b->palette[i]);
+
+    if(memcmp(a->mega_screen, b->mega_screen, sizeof a->mega_screen) != 0)
+        report(count, out, "Mega-Chip screen colors differ");
+    if(memcmp(a->mega_display, b->mega_display, sizeof a->mega_display) != 0)
+        report(count, out, "Mega-Chip frame being drawn differs");
+
+    const chip8_sound_t *sa = &a->sound, *sb = &b->sound;
+    if(sa->playing != sb->playing || (sa->playing && (sa->addr != sb->addr || sa->length != sb->length ||
+                                                      sa->rate != sb->rate || sa->loop != sb->loop)))
+        report(count, out, "Sound: %s 0x%04X %u samples vs %s 0x%04X %u samples",
+               sa->playing ? "playing" : "stopped", sa->addr, sa->length,
+               sb->playing ? "playing" : "stopped", sb->addr, sb->length);
+}
+
+// Ranges of differing bytes, one line each with the first few bytes of both machines
+static void compare_memory(const chip8_t *a, const chip8_t *b, size_t *count, FILE *out) {
+    if(a->ram_size != b->ram_size) report(count, out, "Memory size: %u vs %u bytes", a->ram_size, b->ram_size);
+
+    const uint32_t size = a->ram_size < b->ram_size ? a->ram_size : b->ram_size;
+    size_t ranges = 0, bytes = 0;
+
+    for(uint32_t addr = 0; addr < size; addr++) {
+        if(a->ram[addr] == b->ram[addr]) continue;
+
+        uint32_t end = addr;
+        while(end + 1 < size && a->ram[end + 1] != b->ram[end + 1]) end++;
+
+        const uint32_t len = end - addr + 1;
+        bytes += len;
+        if(++ranges <= MAX_MEMORY_RANGES) {
+            char shown_a[RANGE_BYTES_SHOWN * 3 + 4] = "", shown_b[RANGE_BYTES_SHOWN * 3 + 4] = "";
+            for(uint32_t i = 0; i < len && i < RANGE_BYTES_SHOWN; i++) {
+                snprintf(shown_a + strlen(shown_a), sizeof shown_a - strlen(shown_a), "%s%02X", i ? " " : "", a->ram[addr + i]);
+                snprintf(shown_b + strlen(shown_b), sizeof shown_b - strlen(shown_b), "%s%02X", i ? " " : "", b->ram[addr + i]);
+            }
+
+            report(count, out, "Memory 0x%04X-0x%04X: %s%s vs %s%s", addr, end, shown_a,
+                   len > RANGE_BYTES_SHOWN ? " ..." : "", shown_b, len > RANGE_BYTES_SHOWN ? " ..." : "");
+        } else {
+            (*count)++;
+        }
+
+        addr = end;
+    }
+
+    if(out && ranges > MAX_MEMORY_RANGES) fprintf(out, "... %zu more memory ranges\n", ranges - MAX_MEMORY_RANGES);
+    if(out && ranges > 1) fprintf(out, "%zu bytes of memory differ in %zu ranges\n", bytes, ranges);
+}
+
+// Pixels that differ and the rectangle around them
+static void compare_display(const chip8_t *a, const chip8_t *b, size_t *count, FILE *out) {
+    const uint32_t width_a = chip8_display_width(a), height_a = chip8_display_height(a);
+    const uint32_t width_b = chip8_display_width(b), height_b = chip8_display_height(b);
+    if(width_a != width_b || height_a != height_b)
+        report(count, out, "Resolution: %ux%u vs %ux%u", width_a, height_a, width_b, height_b);
+
+    const uint32_t width = width_a > width_b ? width_a : width_b;
+    const uint32_t height = height_a > height_b ? height_a : height_b;
+    uint32_t pixels = 0, min_x = width, min_y = height, max_x = 0, max_y = 0;
+
+    for(uint32_t y = 0; y < height; y++) {
+        for(uint32_t x = 0; x < width; x++) {
+            const uint8_t pixel_a = x < width_a && y < height_a ? chip8_pixel_planes(a, x, y) : 0;
+            const uint8_t pixel_b = x < width_b && y < height_b ? chip8_pixel_planes(b, x, y) : 0;
+            if(pixel_a == pixel_b) continue;
+
+            pixels++;
+            if(x < min_x) min_x = x;
+            if(y < min_y) min_y = y;
+            if(x > max_x) max_x = x;
+            if(y > max_y) max_y = y;
+        }
+    }
+
+    if(pixels) report(count, out, "Screen: %u %s in x %u-%u, y %u-%u", pixels, pixels == 1 ? "pixel differs" : "pixels differ",
+                      min_x, max_x, min_y, max_y);
+}
+
+size_t compare_machines(const chip8_t *a, const chip8_t *b, FILE *out) {
+    size_t count = 0;
+
+    compare_registers(a, b, &count, out);
+    compare_extensions(a, b, &count, out);
+    compare_memory(a, b, &count, out);
+    compare_display(a, b, &count, out);
+
+    return count;
+}
+
+size_t compare_quirks(const chip8_t *a, const chip8_t *b, FILE *out) {
+    size_t count = 0;
+
+    for(size_t i = 0; chip8_quirk_name(i); i++) {
+        const bool quirk_a = chip8_quirk_enabled(&a->quirks, i);
+        const bool quirk_b = chip8_quirk_enabled(&b->quirks, i);
+        if(quirk_a != quirk_b) report(&count, out, "Quirk %s: %d vs %d", chip8_quirk_name(i), quirk_a, quirk_b);
+    }
+
+    return count;
+}
+
+// Quick check for compare_lockstep(), it looks at everything compare_machines() does and more, byte by byte,
+// so the full comparison only has to run once this finds something
+static bool identical(const chip8_t *a, const chip8_t *b) {
+    if(a->PC != b->PC || a->I != b->I || a->state != b->state || a->fault != b->fault ||
+       a->delay_timer != b->delay_timer || a->sound_timer != b->sound_timer || a->wait_key != b->wait_key ||
+       a->vblank_wait != b->vblank_wait || a->rng_state != b->rng_state || stack_depth(a) != stack_depth(b) ||
+       a->hires != b->hires || a->ram_size != b->ram_size || a->xochip != b->xochip || a->planes != b->planes ||
+       a->pitch != b->pitch || a->megachip != b->megachip)
+        return false;
+
+    if(memcmp(a->V, b->V, sizeof a->V) != 0 || memcmp(a->stack, b->stack, sizeof a->stack) != 0 ||
+       memcmp(a->keypad, b->keypad, sizeof a->keypad) != 0 || memcmp(a->rpl, b->rpl, sizeof a->rpl) != 0 ||
+       memcmp(a->pattern, b->pattern, sizeof a->pattern) != 0 || memcmp(a->ram, b->ram, a->ram_size) != 0 ||
+       memcmp(a->display, b->display, sizeof a->display) != 0)
+        return false;
+
+    if(!a->megachip) return true;
+
+    return a->mega == b->mega && a->sprite_width == b->sprite_width && a->sprite_height == b->sprite_height &&
+           a->screen_alpha == b->screen_alpha && a->blend == b->blend && a->collision_color == b->collision_color &&
+           a->sound.playing == b->sound.playing && a->sound.addr == b->sound.addr &&
+           a->sound.length == b->sound.length && a->sound.rate == b->sound.rate && a->sound.loop == b->sound.loop &&
+           memcmp(a->palette, b->palette, sizeof a->palette) == 0 &&
+           memcmp(a->mega_display, b->mega_display, sizeof a->mega_display) == 0 &&
+           memcmp(a->mega_screen, b->mega_screen, sizeof a->mega_screen) == 0;
+}
+
+bool compare_lockstep(chip8_t *a, chip8_t *b, uint64_t max_cycles, uint32_t insts_per_frame,
+                      uint64_t *cycles, uint16_t *pc) {
+    *cycles = 0;
+
+    while(*cycles < max_cycles && a->state != QUIT && b->state != QUIT) {
+        *pc = a->PC;
+        chip8_step(a);
+        chip8_step(b);
+        (*cycles)++;
+
+        if(insts_per_frame && *cycles % insts_per_frame == 0) {
+            chip8_update_timers(a);
+            chip8_update_timers(b);
+        }
+
+        if(!identical(a, b) && compare_machines(a, b, NULL) > 0) return true;
+    }
+
+    return false;
+}
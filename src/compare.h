@@ -0,0 +1,26 @@
+#ifndef COMPARE_H
+#define COMPARE_H
+
+#include <stdio.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Differences between two machines, for chasing down emulator and quirk bugs
+// Registers, timers, the stack, the keypad, memory and the screen are compared, settings like
+// quirks are not since comparing runs under different quirks is the point of compare_lockstep()
+// Prints one line per difference to out unless it's NULL, returns how many there are
+size_t compare_machines(const chip8_t *a, const chip8_t *b, FILE *out);
+
+// Quirks that differ between the machines, one line each, returns how many
+size_t compare_quirks(const chip8_t *a, const chip8_t *b, FILE *out);
+
+// Run both machines one instruction at a time, with the timers ticking every insts_per_frame instructions,
+// until their states differ, one of them stops or max_cycles instructions ran
+// Returns true if they diverged, cycles is the number of instructions each machine ran,
+// the last one caused the divergence and pc is the address it was at
+bool compare_lockstep(chip8_t *a, chip8_t *b, uint64_t max_cycles, uint32_t insts_per_frame,
+                      uint64_t *cycles, uint16_t *pc);
+
+#endif // COMPARE_H
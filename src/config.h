@@ -0,0 +1,126 @@
+#ifndef CONFIG_H
+#define CONFIG_H
+
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "keymap.h"
+#include "builtin.h"
+#include "log.h"
+#include "tuning_file.h"
+#include "save_ram.h"
+
+// Emulator configuration
+// Buzzer waveforms
+typedef enum {
+    WAVE_SQUARE,
+    WAVE_SINE,
+    WAVE_TRIANGLE,
+    WAVE_NOISE,
+} waveform_t;
+
+// How the picture fills a window of another size
+typedef enum {
+    SCALE_INTEGER,          // Whole multiples of the CHIP8 pixels, sharp but with wider borders
+    SCALE_FIT,              // As big as fits, keeping the aspect ratio
+    SCALE_STRETCH,          // The whole window, pixels aren't square
+} scaling_t;
+
+typedef struct {
+    uint32_t window_width;
+    uint32_t window_height;
+    uint32_t bg_color;      // Background color RGBA
+    uint32_t fg_color;      // Foreground color RGBA
+    uint32_t plane2_color;  // XO-CHIP color for pixels only on in plane 2
+    uint32_t blend_color;   // XO-CHIP color for pixels on in both planes
+    uint32_t scale_factor;  // Amount to scale a CHIP8 pixel
+    bool pixel_outlines;    // Sets pixel outlines
+    uint32_t rotation;      // Degrees the picture is turned clockwise in the window: 0, 90, 180 or 270
+    scaling_t scaling;
+    uint32_t letterbox_color; // Window around the picture RGBA, 0 is the background color
+    bool scanlines;         // Window filters: dark lines between the pixel rows,
+    bool pixel_grid;        // gaps between the pixels,
+    bool curvature;         // and a bent screen
+    uint32_t phosphor;      // Percent of its brightness a dark pixel keeps from the last frame, 0 is no ghosting
+    uint32_t deflicker_frames; // Frames blended into each picture against XOR flicker, 1 is off
+    bool deflicker_average; // Average the frames' colors instead of lighting pixels that are on in any of them
+    uint32_t insts_per_second; // CHIP8 CPU "clock rate"
+    uint32_t square_wave_freq; // Frequency of square wave sound e.g. 440hz for middle A
+    uint32_t audio_sample_rate;
+    int16_t volume;         // How loud or not is the sound
+    bool muted;             // Buzzer off until unmuted, volume is kept
+    bool volume_set;        // --volume or --mute was given, the volume saved from the hotkeys isn't used
+    const char *volume_path; // Where the hotkeys save the volume for the next run, NULL doesn't save it
+    waveform_t waveform;    // Buzzer tone, XO-CHIP audio patterns play as they are
+    uint32_t attack_ms;     // Buzzer fade in and out, short fades keep it from clicking
+    uint32_t release_ms;
+    bool vsync;             // Sync presenting to the monitor refresh rate
+    bool fullscreen;        // Start in (desktop) fullscreen mode
+    const char *renderer;   // Rendering backend name (sdl, term)
+    const char *audio;      // Audio backend name (sdl, none)
+    keymap_t keymap;        // Host key bindings for the CHIP8 keypad
+    chip8_platform_t platform; // --platform, faults on instructions the platform doesn't have
+    const char *rom_name;   // ROM file to run
+    const builtin_rom_t *builtin; // Built-in ROM to run instead of a file
+    const char *rom_dir;    // Where to look for ROMs not found as given
+    const char *state_path; // Save state file for the F5/F9 hotkeys, defaults to <rom>.state
+    const char *rpl_path;   // SUPER-CHIP RPL flags are kept per ROM in this file, NULL keeps them in memory only
+    const char *save_ram;   // Memory regions kept per ROM between runs, see save_ram.h, NULL keeps none
+    save_ram_t save_ram_regions; // The parsed regions
+    const char *tuning_path; // Speed, quirks and colors from the command line are kept per ROM in this file
+    bool forget_tuning;     // Drop what tuning_path has for the ROM
+    tuning_t tuning;        // The parts of it the command line changed
+    const char *symbols_path; // Labels for the debugger and traces, see symbols.h, NULL looks for <rom>.sym
+    const char *cheat_path; // Memory cheats for the ROM, defaults to <rom>.cheats, see cheat.h
+    bool cheats_required;   // cheat_path was given, so it has to exist
+    uint32_t rewind_seconds; // How far back holding backspace can rewind, 0 disables rewinding
+    uint32_t turbo_factor;  // Frames emulated per frame shown while fast forwarding
+    bool watch;             // Reload the ROM when its file changes
+    bool benchmark;         // Run as fast as possible and report the speed
+    bool show_stats;        // Frames drawn, skipped and emulated per second in the title
+    bool pause_on_focus_loss; // Pause while the window is in the background
+    chip8_log_level_t log_level; // Messages less important than this aren't logged
+    log_format_t log_format; // Log lines as text or one JSON object each
+    bool headless;          // Run without renderer and audio, then dump the screen
+    uint32_t headless_frames; // Frames to run in headless mode
+    uint32_t headless_cycles; // Instructions to run in headless mode, overrides headless_frames if set
+    const char *dump_path;  // Headless screen dump, .png for an image, text otherwise, - for stdout
+    uint32_t capture_scale; // Image pixels per CHIP8 pixel in screenshots, GIFs and PNG dumps
+    const char *gif_path;   // Record a GIF from the start, F10 starts one with a generated name otherwise
+    const char *wav_path;   // Headless runs write their sound here, see audio_wav.c
+    quirks_t quirks;        // Interpreter behaviour for the ROM
+    bool xochip;            // Enable XO-CHIP extensions
+    bool megachip;          // Enable Mega-Chip extensions
+    uint32_t seed;          // Random number generator seed, defaults to the time
+    const char *record_path; // Record keypad input to this movie file
+    const char *play_path;  // Play back keypad input from this movie file
+    const char *netplay_host; // Wait for a second player on this "[host:]port", see netplay.h
+    const char *netplay_join; // Play with the player hosting at this "host:port"
+    uint32_t netplay_delay; // Frames netplay sends keypad input ahead
+    const char *trace_path; // Log executed instructions to this file, - for stdout
+    const char *trace_range; // Only log instructions in this "<start>-<end>" address range
+    const char *trace_ops;  // Only log these opcode classes (top nibbles), e.g. "8,D"
+    bool profile;           // Profile executed instructions and report the hotspots on exit
+    const char *profile_path; // Also write the profile to this file in pprof format
+    const char *coverage_path; // Write a text map of code and data bytes to this file on exit, - for stdout
+    const char *coverage_html_path; // Write the coverage as an HTML heatmap to this file on exit
+    const char *script_path; // Lua script with hooks for cheats, bots and HUDs, see script.c
+    bool debug_on_fault;    // Open the debugger REPL when the ROM faults instead of exiting
+    const char *crash_dir;  // Postmortem bundles of faulted runs go in here, see postmortem.h, NULL writes none
+    int argc;               // Command line, for the postmortem report
+    char **argv;
+    const char *debug_listen; // Serve the remote debug protocol on this "[host:]port" instead of running a window
+    const char *serve;      // Show the ROM in browsers connecting to this "[host:]port" instead of running a window
+    bool serve_restart;     // --serve starts the ROM over when it exits or faults
+    uint32_t attract_seconds; // chip8 attract goes on to the next ROM after this long, 0 outside of it
+    const char *broadcast;  // Browsers connecting to this "[host:]port" watch the window session
+    bool strict_memory;     // Fault on stray memory accesses instead of wrapping around
+    chip8_ram_fill_t ram_fill; // Power on memory, random bytes come from the seed
+    bool strict_init;       // Fault on reads of memory nothing wrote
+    chip8_timing_t timing;  // Flat insts_per_second or the VIP's cycles per instruction
+    bool decode_cache;      // Decode instructions once per address, see chip8_set_decode_cache()
+    bool use_romdb;         // Start known ROMs with the settings from the ROM database
+} config_t;
+
+#endif // CONFIG_H
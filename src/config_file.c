@@ -0,0 +1,217 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <ctype.h>
+
+#include "config_file.h"
+
+// Settings files hold one "name = value" pair per line, names are the long options without dashes:
+//
+//   # Comments start with #
+//   speed = 900
+//   quirks = "cosmac"
+//   fg = "33FF33"
+//   outlines = true
+//
+//   [keys]
+//   5 = "Up"
+//
+//   [buttons]
+//   5 = "x"
+//
+//   [rom.TETRIS]
+//   speed = 500
+//
+//   [rom.TETRIS.buttons]
+//   4 = "dpleft"
+//
+// Strings are quoted, numbers and true/false are not. A value of true turns on a flag option,
+// false leaves it off. Entries in the [keys] table bind CHIP8 keys like --key does, [buttons] like --button.
+// [rom.<name>] tables only apply to the ROM file of that name, the extension can be left out,
+// and can have [keys] and [buttons] tables of their own.
+
+// What lines set in the current table
+typedef enum {
+    TABLE_OPTIONS,
+    TABLE_KEYS,
+    TABLE_BUTTONS,
+} table_t;
+
+bool config_file_default_path(char *path, size_t size) {
+    const char *config_home = getenv("XDG_CONFIG_HOME");
+    int len;
+
+    if(config_home && *config_home) {
+        len = snprintf(path, size, "%s/chip8/config.toml", config_home);
+    } else {
+        const char *home = getenv("HOME");
+        if(!home || !*home) return false;
+        len = snprintf(path, size, "%s/.config/chip8/config.toml", home);
+    }
+
+    return len > 0 && (size_t)len < size;
+}
+
+static char *trim(char *str) {
+    while(isspace((unsigned char)*str)) str++;
+
+    char *end = str + strlen(str);
+    while(end > str && isspace((unsigned char)end[-1])) *--end = '\0';
+
+    return str;
+}
+
+// Parse a value in place, quoted strings may contain \" and \\ escapes
+// Returns NULL on syntax errors
+static char *parse_value(char *value) {
+    if(*value != '"') {
+        // Bare value, only a comment may follow
+        char *comment = strchr(value, '#');
+        if(comment) *comment = '\0';
+        value = trim(value);
+
+        return *value && !strpbrk(value, " \t\"") ? value : NULL;
+    }
+
+    char *out = value;
+    for(char *in = value + 1; *in; in++) {
+        if(*in == '"') {
+            *out = '\0';
+
+            const char *rest = in + 1;
+            while(isspace((unsigned char)*rest)) rest++;
+            return *rest == '\0' || *rest == '#' ? value : NULL;
+        }
+
+        if(*in == '\\') {
+            in++;
+            if(*in != '"' && *in != '\\') return NULL;
+        }
+
+        *out++ = *in;
+    }
+
+    return NULL;    // Unterminated string
+}
+
+static bool add_arg(int *argc, char ***argv, size_t *capacity, const char *arg) {
+    if((size_t)*argc == *capacity) {
+        const size_t new_capacity = *capacity ? *capacity * 2 : 16;
+        char **args = realloc(*argv, new_capacity * sizeof *args);
+        if(!args) return false;
+
+        *argv = args;
+        *capacity = new_capacity;
+    }
+
+    char *copy = malloc(strlen(arg) + 1);
+    if(!copy) return false;
+
+    strcpy(copy, arg);
+    (*argv)[(*argc)++] = copy;
+    return true;
+}
+
+// "TETRIS" and "pong" are the tables for TETRIS and pong.ch8
+static bool rom_matches(const char *rom, const char *rom_key) {
+    const size_t length = strlen(rom);
+    if(strncmp(rom, rom_key, length) != 0) return false;
+
+    return rom_key[length] == '\0' || (rom_key[length] == '.' && !strchr(&rom_key[length + 1], '.'));
+}
+
+// Parse a "[name]" table header, skip is set for tables of other ROMs
+static bool parse_table(const char *line, const char *rom_key, table_t *table, bool *skip) {
+    char header[1024];
+    const size_t length = strlen(line);
+    if(length < 2 || length >= sizeof header || line[length - 1] != ']') return false;
+
+    memcpy(header, line, length - 1);
+    header[length - 1] = '\0';
+
+    char *name = header + 1;
+    *skip = false;
+
+    if(strncmp(name, "rom.", 4) == 0) {
+        // Quoted names may contain dots, bare ones end at the first one
+        char *rom = name + 4;
+        char *end;
+        if(*rom == '"') {
+            end = strchr(++rom, '"');
+            if(!end) return false;
+            *end++ = '\0';
+        } else {
+            end = rom + strcspn(rom, ".");
+        }
+
+        if(*end && *end != '.') return false;
+        name = *end ? end + 1 : end;
+        *end = '\0';
+
+        if(!*rom) return false;
+        *skip = !rom_key || !rom_matches(rom, rom_key);
+    }
+
+    if(*name == '\0' && name != header + 1) *table = TABLE_OPTIONS;
+    else if(strcmp(name, "keys") == 0) *table = TABLE_KEYS;
+    else if(strcmp(name, "buttons") == 0) *table = TABLE_BUTTONS;
+    else return false;
+
+    return true;
+}
+
+bool config_file_args(const char *path, const char *rom_key, int *argc, char ***argv) {
+    FILE *file = fopen(path, "r");
+    if(!file) {
+        fprintf(stderr, "Could not open config file %s\n", path);
+        return false;
+    }
+
+    char line[1024];
+    char arg[sizeof line + 8];
+    uint32_t line_num = 0;
+    table_t table = TABLE_OPTIONS;
+    bool skip = false;
+    bool ok = true;
+    size_t capacity = 0;
+
+    *argc = 0;
+    *argv = NULL;
+
+    while(ok && fgets(line, sizeof line, file)) {
+        line_num++;
+
+        char *start = trim(line);
+        if(*start == '\0' || *start == '#') continue;
+
+        if(*start == '[') {
+            if(!parse_table(start, rom_key, &table, &skip)) {
+                fprintf(stderr, "%s:%u: unknown table %s\n", path, line_num, start);
+                ok = false;
+            }
+            continue;
+        }
+
+        char *sep = strchr(start, '=');
+        char *value = sep ? parse_value(trim(sep + 1)) : NULL;
+        if(sep) *sep = '\0';
+        const char *name = trim(start);
+
+        if(!sep || !*name || !value) {
+            fprintf(stderr, "%s:%u: expected name = value\n", path, line_num);
+            ok = false;
+        } else if(!skip && strcmp(value, "false") != 0) {
+            if(table == TABLE_KEYS) snprintf(arg, sizeof arg, "--key=%s:%s", name, value);
+            else if(table == TABLE_BUTTONS) snprintf(arg, sizeof arg, "--button=%s:%s", name, value);
+            else if(strcmp(value, "true") == 0) snprintf(arg, sizeof arg, "--%s", name);
+            else snprintf(arg, sizeof arg, "--%s=%s", name, value);
+
+            ok = add_arg(argc, argv, &capacity, arg);
+        }
+    }
+
+    fclose(file);
+    return ok;
+}
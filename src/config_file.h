@@ -0,0 +1,16 @@
+#ifndef CONFIG_FILE_H
+#define CONFIG_FILE_H
+
+#include <stddef.h>
+#include <stdbool.h>
+
+// Settings file in a small TOML subset, see config_file.c for the format
+// Default location is $XDG_CONFIG_HOME/chip8/config.toml or ~/.config/chip8/config.toml
+bool config_file_default_path(char *path, size_t size);
+
+// Read the file as command line options ("--name=value"), so it takes exactly the options the command line does
+// Only the [rom.<name>] tables for the ROM file name rom_key are included, none if it's NULL
+// The options are malloc'd and live for the rest of the program since the config points into them
+bool config_file_args(const char *path, const char *rom_key, int *argc, char ***argv);
+
+#endif // CONFIG_FILE_H
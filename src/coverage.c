@@ -0,0 +1,203 @@
+#include <stdio.h>
+#include <string.h>
+
+#include "coverage.h"
+
+#define MAP_ROW_BYTES 64
+#define HTML_ROW_BYTES 16
+
+static uint8_t read_hook(void *userdata, uint16_t addr, uint8_t value) {
+    coverage_t *coverage = userdata;
+    if(coverage->next_read) value = coverage->next_read(coverage->next_userdata, addr, value);
+
+    coverage->flags[addr] |= COVERAGE_READ;
+    if(coverage->reads[addr] < UINT32_MAX) coverage->reads[addr]++;
+    return value;
+}
+
+static uint8_t write_hook(void *userdata, uint16_t addr, uint8_t value) {
+    coverage_t *coverage = userdata;
+    if(coverage->next_write) value = coverage->next_write(coverage->next_userdata, addr, value);
+
+    coverage->flags[addr] |= COVERAGE_WRITE;
+    return value;
+}
+
+void coverage_attach(coverage_t *coverage, chip8_t *chip8) {
+    memset(coverage, 0, sizeof *coverage);
+    coverage->chip8 = chip8;
+    coverage->next_read = chip8->read_hook;
+    coverage->next_write = chip8->write_hook;
+    coverage->next_userdata = chip8->hook_userdata;
+
+    chip8_set_memory_hooks(chip8, read_hook, write_hook, coverage);
+}
+
+void coverage_detach(coverage_t *coverage) {
+    chip8_set_memory_hooks(coverage->chip8, coverage->next_read, coverage->next_write, coverage->next_userdata);
+}
+
+// The whole instruction is code, F000 NNNN and Mega-Chip 01NN NNNN included
+void coverage_step(coverage_t *coverage, const chip8_t *chip8) {
+    const uint32_t mask = chip8->ram_size - 1;
+    const uint16_t pc = chip8->PC & mask;
+    const bool long_instruction = (chip8->ram[pc] == 0xF0 && chip8->ram[(pc + 1) & mask] == 0x00) ||
+                                  (chip8->megachip && chip8->ram[pc] == 0x01);
+
+    if(coverage->executed[pc] < UINT32_MAX) coverage->executed[pc]++;
+    for(uint32_t i = 0; i < (long_instruction ? 4u : 2u); i++)
+        coverage->flags[(pc + i) & mask] |= COVERAGE_CODE;
+}
+
+// Rows to show: the ones with ROM bytes in them and any others that were used
+static bool row_used(const coverage_t *coverage, uint32_t start, uint32_t len) {
+    const chip8_t *chip8 = coverage->chip8;
+    if(start + len > CHIP8_ENTRY_POINT && start < CHIP8_ENTRY_POINT + chip8->rom_size) return true;
+
+    for(uint32_t i = start; i < start + len; i++)
+        if(coverage->flags[i]) return true;
+
+    return false;
+}
+
+static char map_char(uint8_t flags) {
+    const bool data = flags & (COVERAGE_READ | COVERAGE_WRITE);
+
+    if(flags & COVERAGE_CODE) return data ? '*' : 'C';
+    if((flags & COVERAGE_READ) && (flags & COVERAGE_WRITE)) return 'b';
+    if(flags & COVERAGE_READ) return 'r';
+    if(flags & COVERAGE_WRITE) return 'w';
+    return '.';
+}
+
+static double percent(size_t part, size_t total) {
+    return total ? 100.0 * part / total : 0;
+}
+
+void coverage_totals(const coverage_t *coverage, coverage_totals_t *totals) {
+    const chip8_t *chip8 = coverage->chip8;
+    const uint32_t rom_end = CHIP8_ENTRY_POINT + chip8->rom_size;
+
+    *totals = (coverage_totals_t) {0};
+    for(uint32_t addr = 0; addr < chip8->ram_size; addr++) {
+        if(coverage->executed[addr]) totals->instructions++;
+        if(addr < CHIP8_ENTRY_POINT || addr >= rom_end) continue;
+
+        if(coverage->flags[addr] & COVERAGE_CODE) totals->code++;
+        else if(coverage->flags[addr]) totals->data++;
+        else totals->unused++;
+    }
+}
+
+bool coverage_write_text(const coverage_t *coverage, FILE *out) {
+    const chip8_t *chip8 = coverage->chip8;
+    const uint32_t rom_end = CHIP8_ENTRY_POINT + chip8->rom_size;
+    coverage_totals_t totals;
+    coverage_totals(coverage, &totals);
+
+    fprintf(out, "Coverage of %s: %zu ROM bytes, %zu code (%.1f%%), %zu data (%.1f%%), %zu unused (%.1f%%)\n",
+            chip8->rom_name ? chip8->rom_name : "ROM", chip8->rom_size, totals.code, percent(totals.code, chip8->rom_size),
+            totals.data, percent(totals.data, chip8->rom_size), totals.unused, percent(totals.unused, chip8->rom_size));
+    fprintf(out, "%zu different instruction addresses executed\n\n", totals.instructions);
+    fprintf(out, "C code  r read  w written  b read and written  * code also used as data  . unused\n");
+
+    for(uint32_t row = 0; row < chip8->ram_size; row += MAP_ROW_BYTES) {
+        if(!row_used(coverage, row, MAP_ROW_BYTES)) continue;
+
+        fprintf(out, "%04X  ", row);
+        for(uint32_t addr = row; addr < row + MAP_ROW_BYTES; addr++) fputc(map_char(coverage->flags[addr]), out);
+        fputc('\n', out);
+    }
+
+    // Never executed or read ROM bytes are unreached code or unused data
+    bool header = false;
+    for(uint32_t addr = CHIP8_ENTRY_POINT; addr < rom_end; addr++) {
+        if(coverage->flags[addr]) continue;
+
+        uint32_t end = addr;
+        while(end + 1 < rom_end && !coverage->flags[end + 1]) end++;
+
+        if(!header) fprintf(out, "\nUnused ROM ranges:\n");
+        header = true;
+        fprintf(out, "  0x%04X-0x%04X  %u byte%s\n", addr, end, end - addr + 1, end == addr ? "" : "s");
+        addr = end;
+    }
+
+    return !ferror(out);
+}
+
+// Bits needed for count, a cheap log2 for the heatmap scale
+static uint32_t bit_length(uint32_t count) {
+    uint32_t bits = 0;
+    for(; count; count >>= 1) bits++;
+    return bits;
+}
+
+// Colour of a byte, brighter for more executions or reads on a log scale
+// The second byte of an instruction gets the count of the one it belongs to
+static void cell_style(const coverage_t *coverage, uint32_t addr, uint32_t max_count, char *style, size_t size) {
+    const uint8_t flags = coverage->flags[addr];
+    const uint32_t before = coverage->executed[(addr - 1) & (coverage->chip8->ram_size - 1)];
+    const uint32_t executed = coverage->executed[addr] > before ? coverage->executed[addr] : before;
+    const uint32_t count = flags & COVERAGE_CODE ? executed : coverage->reads[addr];
+    const double level = 0.25 + 0.75 * bit_length(count) / (bit_length(max_count) + 1);
+
+    if(!flags) snprintf(style, size, "background:#eee;color:#999");
+    else if(flags == COVERAGE_CODE) snprintf(style, size, "background:rgba(40,110,255,%.2f)", level);
+    else if(flags & COVERAGE_CODE) snprintf(style, size, "background:rgba(150,60,220,%.2f)", level);
+    else if(flags & COVERAGE_READ) snprintf(style, size, "background:rgba(255,140,0,%.2f)", level);
+    else snprintf(style, size, "background:rgba(40,170,80,0.6)");
+}
+
+static void write_escaped(const char *text, FILE *out) {
+    for(; *text; text++) {
+        switch(*text) {
+            case '<':  fputs("&lt;", out); break;
+            case '>':  fputs("&gt;", out); break;
+            case '&':  fputs("&amp;", out); break;
+            case '"':  fputs("&quot;", out); break;
+            default:   fputc(*text, out); break;
+        }
+    }
+}
+
+bool coverage_write_html(const coverage_t *coverage, FILE *out) {
+    const chip8_t *chip8 = coverage->chip8;
+    const char *name = chip8->rom_name ? chip8->rom_name : "ROM";
+    uint32_t max_count = 0;
+
+    for(uint32_t addr = 0; addr < chip8->ram_size; addr++) {
+        if(coverage->executed[addr] > max_count) max_count = coverage->executed[addr];
+        if(coverage->reads[addr] > max_count) max_count = coverage->reads[addr];
+    }
+
+    fputs("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>Coverage of ", out);
+    write_escaped(name, out);
+    fputs("</title>\n<style>body{font-family:sans-serif}table{border-collapse:collapse;font-family:monospace}"
+          "td{padding:1px 4px}th{padding-right:8px;color:#555;font-weight:normal}</style></head><body>\n"
+          "<h1>Coverage of ", out);
+    write_escaped(name, out);
+    fputs("</h1>\n<p><span style=\"background:rgb(40,110,255)\">&nbsp;code&nbsp;</span> "
+          "<span style=\"background:rgb(255,140,0)\">&nbsp;data read&nbsp;</span> "
+          "<span style=\"background:rgb(40,170,80)\">&nbsp;written&nbsp;</span> "
+          "<span style=\"background:rgb(150,60,220)\">&nbsp;code used as data&nbsp;</span> "
+          "<span style=\"background:#eee\">&nbsp;unused&nbsp;</span>, "
+          "darker is used more often, hover a byte for its counts</p>\n<table>\n", out);
+
+    for(uint32_t row = 0; row < chip8->ram_size; row += HTML_ROW_BYTES) {
+        if(!row_used(coverage, row, HTML_ROW_BYTES)) continue;
+
+        fprintf(out, "<tr><th>%04X</th>", row);
+        for(uint32_t addr = row; addr < row + HTML_ROW_BYTES; addr++) {
+            char style[64];
+            cell_style(coverage, addr, max_count, style, sizeof style);
+            fprintf(out, "<td style=\"%s\" title=\"0x%04X: executed %u, read %u%s\">%02X</td>", style, addr,
+                    coverage->executed[addr], coverage->reads[addr],
+                    coverage->flags[addr] & COVERAGE_WRITE ? ", written" : "", chip8->ram[addr]);
+        }
+        fputs("</tr>\n", out);
+    }
+
+    fputs("</table>\n</body></html>\n", out);
+    return !ferror(out);
+}
@@ -0,0 +1,48 @@
+#ifndef COVERAGE_H
+#define COVERAGE_H
+
+#include <stdio.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// What a byte of memory was used as during the run, an address can be several
+#define COVERAGE_CODE  0x1     // Part of an executed instruction
+#define COVERAGE_READ  0x2     // Read as data: sprites, FX65, 5XY3 and audio patterns
+#define COVERAGE_WRITE 0x4     // Written by FX33, FX55 or 5XY2
+
+// Code and data coverage of a run, coverage_step() goes before every chip8_step()
+// Data accesses are seen through the core memory hooks, hooks installed before coverage_attach()
+// (like cheats) keep working and are put back by coverage_detach()
+typedef struct {
+    uint8_t flags[CHIP8_XO_RAM_SIZE];
+    uint32_t executed[CHIP8_XO_RAM_SIZE];   // Instructions run at each address
+    uint32_t reads[CHIP8_XO_RAM_SIZE];      // Data reads of each byte
+    chip8_t *chip8;
+    chip8_memory_hook_t next_read;
+    chip8_memory_hook_t next_write;
+    void *next_userdata;
+} coverage_t;
+
+void coverage_attach(coverage_t *coverage, chip8_t *chip8);
+void coverage_detach(coverage_t *coverage);
+void coverage_step(coverage_t *coverage, const chip8_t *chip8);
+
+// How the ROM's bytes were used, each counted once: code, data (read or written), or neither
+typedef struct {
+    size_t code;
+    size_t data;
+    size_t unused;
+    size_t instructions;    // Different addresses instructions ran at, in or out of the ROM
+} coverage_totals_t;
+
+void coverage_totals(const coverage_t *coverage, coverage_totals_t *totals);
+
+// Text map of the ROM, one character per byte, with totals and the ranges that were never used
+bool coverage_write_text(const coverage_t *coverage, FILE *out);
+
+// Self-contained HTML page with a heatmap of the ROM, code in blue and data in orange
+bool coverage_write_html(const coverage_t *coverage, FILE *out);
+
+#endif // COVERAGE_H
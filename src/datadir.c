@@ -0,0 +1,90 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <errno.h>
+#include <sys/stat.h>
+
+#include "datadir.h"
+
+#define LINE_SIZE 512
+
+bool datadir_path(const char *name, char *path, size_t size) {
+    const char *data_home = getenv("XDG_DATA_HOME");
+    int len;
+
+    if(data_home && *data_home) {
+        len = snprintf(path, size, "%s/chip8/%s", data_home, name);
+    } else {
+        const char *home = getenv("HOME");
+        if(!home || !*home) return false;
+        len = snprintf(path, size, "%s/.local/share/chip8/%s", home, name);
+    }
+
+    return len > 0 && (size_t)len < size;
+}
+
+bool datadir_make_parents(const char *path) {
+    char dir[FILENAME_MAX];
+    snprintf(dir, sizeof dir, "%s", path);
+
+    for(char *slash = strchr(dir + 1, '/'); slash; slash = strchr(slash + 1, '/')) {
+        *slash = '\0';
+        if(mkdir(dir, 0755) != 0 && errno != EEXIST) return false;
+        *slash = '/';
+    }
+
+    return true;
+}
+
+// Is line the one for key
+static bool matches(const char *line, const char *key) {
+    const size_t len = strlen(key);
+    return strncmp(line, key, len) == 0 && line[len] == ' ';
+}
+
+bool datadir_find_line(const char *path, const char *key, char *rest, size_t size) {
+    FILE *file = fopen(path, "r");
+    if(!file) return false;
+
+    char line[LINE_SIZE];
+    bool found = false;
+    while(!found && fgets(line, sizeof line, file)) {
+        if(!matches(line, key)) continue;
+
+        line[strcspn(line, "\r\n")] = '\0';
+        found = (size_t)snprintf(rest, size, "%s", line + strlen(key) + 1) < size;
+    }
+
+    fclose(file);
+    return found;
+}
+
+bool datadir_replace_line(const char *path, const char *key, const char *rest) {
+    char tmp_path[FILENAME_MAX];
+    if(snprintf(tmp_path, sizeof tmp_path, "%s.tmp", path) >= (int)sizeof tmp_path) return false;
+    if(!datadir_make_parents(path)) return false;
+
+    FILE *out = fopen(tmp_path, "w");
+    if(!out) return false;
+
+    // Written to a new file that replaces the old one, so a crash halfway doesn't lose the other ROMs' lines
+    FILE *in = fopen(path, "r");
+    if(in) {
+        char line[LINE_SIZE];
+        while(fgets(line, sizeof line, in))
+            if(!matches(line, key)) fputs(line, out);
+        fclose(in);
+    }
+
+    if(rest) fprintf(out, "%s %s\n", key, rest);
+
+    const bool written = !ferror(out);
+    if(fclose(out) != 0 || !written || rename(tmp_path, path) != 0) {
+        remove(tmp_path);
+        return false;
+    }
+
+    return true;
+}
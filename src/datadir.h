@@ -0,0 +1,22 @@
+#ifndef DATADIR_H
+#define DATADIR_H
+
+#include <stddef.h>
+#include <stdbool.h>
+
+// Files the emulator keeps between runs live in $XDG_DATA_HOME/chip8 or ~/.local/share/chip8
+// Path of the file name in there, false if neither variable is set or it doesn't fit
+bool datadir_path(const char *name, char *path, size_t size);
+
+// mkdir -p for the directories path is in
+bool datadir_make_parents(const char *path);
+
+// Files with one line per ROM that start with "<key> ", like the RPL flags and tuning files
+// Finds the rest of the key's line without the newline, false if there's none
+bool datadir_find_line(const char *path, const char *key, char *rest, size_t size);
+
+// Replace or add the key's line, or remove it if rest is NULL, the other lines are kept as they are
+// Missing directories on the way to path are created
+bool datadir_replace_line(const char *path, const char *key, const char *rest);
+
+#endif // DATADIR_H
@@ -0,0 +1,669 @@
+#define _POSIX_C_SOURCE 200809L
+
+// Remote debug protocol, newline separated JSON objects in both directions
+//
+// Requests are flat objects with a "cmd" and an optional "id" echoed in the reply:
+//   {"id": 1, "cmd": "step", "count": 10}
+// Replies have "ok" and either the result fields or an "error" message:
+//   {"id": 1, "ok": true, "state": "paused", "pc": 522, ...}
+// Events are sent without a request and have an "event" field instead:
+//   {"event": "stopped", "reason": "breakpoint", "pc": 530, ...}
+//
+// Commands, addresses and values are JSON numbers or strings like "0x200":
+//   status                      Machine state: pc, opcode, instruction, i, v, dt, st, stack
+//   step [count]                Run count instructions (default 1), pauses a running ROM
+//   continue                    Run at the configured speed until a breakpoint, pause or fault
+//   pause                       Stop running
+//   break addr [condition]      Set a PC breakpoint, the condition is a debugger expression like "v3 == 1"
+//   delete addr                 Remove a PC breakpoint
+//   breakpoints                 List breakpoints
+//   read addr [len]             Memory as a hex string (default 64 bytes)
+//   write addr data             Write a hex string of bytes to memory
+//   set reg value               Set V0-VF, I, PC, DT or ST
+//   key key pressed             Press (true) or release (false) keypad key 0-F
+//   display                     Screen size and pixels, one digit per pixel (XO-CHIP planes), rows split by \n
+//   disasm addr [count]         Disassemble count instructions (default 10)
+//   reset                       Restart the ROM, breakpoints are kept
+//   quit                        Stop the emulator
+// Events are hello (client connected), stopped (reason breakpoint, pause or fault) and exited
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdarg.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <strings.h>
+#include <errno.h>
+#include <signal.h>
+#include <poll.h>
+#include <unistd.h>
+#include <sys/socket.h>
+
+#include "debug_server.h"
+#include "debugger.h"
+#include "disasm.h"
+#include "net.h"
+
+#define MAX_FIELDS 8
+#define MAX_REQUEST 4096
+
+// One "key": value pair of a request, strings are unescaped
+typedef struct {
+    char key[32];
+    char value[MAX_REQUEST];
+    bool is_string;
+} field_t;
+
+typedef struct {
+    field_t fields[MAX_FIELDS];
+    size_t count;
+} request_t;
+
+// Reply or event being built
+typedef struct {
+    char *data;
+    size_t len;
+    size_t capacity;
+    bool failed;
+} reply_t;
+
+typedef struct {
+    int listen_fd;
+    int client_fd;          // -1 without a client
+    char input[MAX_REQUEST];
+    size_t input_len;
+    debugger_t dbg;
+    bool running;
+    bool quit;
+} server_t;
+
+static void reply_printf(reply_t *reply, const char *format, ...) {
+    if(reply->failed) return;
+
+    for(;;) {
+        va_list args;
+        va_start(args, format);
+        const int len = vsnprintf(reply->data ? &reply->data[reply->len] : NULL,
+                                  reply->data ? reply->capacity - reply->len : 0, format, args);
+        va_end(args);
+
+        if(len < 0) {
+            reply->failed = true;
+            return;
+        }
+        if(reply->data && reply->len + len < reply->capacity) {
+            reply->len += len;
+            return;
+        }
+
+        size_t capacity = reply->capacity ? reply->capacity * 2 : 1024;
+        while(capacity <= reply->len + len) capacity *= 2;
+        char *grown = realloc(reply->data, capacity);
+        if(!grown) {
+            reply->failed = true;
+            return;
+        }
+        reply->data = grown;
+        reply->capacity = capacity;
+    }
+}
+
+static void reply_string(reply_t *reply, const char *str) {
+    reply_printf(reply, "\"");
+    for(const char *c = str; *c; c++) {
+        if(*c == '"' || *c == '\\') reply_printf(reply, "\\%c", *c);
+        else if(*c == '\n') reply_printf(reply, "\\n");
+        else if((unsigned char)*c < 0x20) reply_printf(reply, "\\u%04x", *c);
+        else reply_printf(reply, "%c", *c);
+    }
+    reply_printf(reply, "\"");
+}
+
+// Send a finished reply as one line, a client that can't take it is dropped
+static void send_reply(server_t *server, reply_t *reply) {
+    reply_printf(reply, "}\n");
+
+    if(server->client_fd >= 0 && !reply->failed) {
+        if(!net_send(server->client_fd, reply->data, reply->len)) {
+            close(server->client_fd);
+            server->client_fd = -1;
+            server->running = false;
+        }
+    }
+
+    free(reply->data);
+    *reply = (reply_t) {0};
+}
+
+static const char *skip_space(const char *c) {
+    while(*c == ' ' || *c == '\t' || *c == '\r' || *c == '\n') c++;
+    return c;
+}
+
+// JSON string starting at the opening quote, returns the position after the closing quote or NULL
+static const char *parse_string(const char *c, char *out, size_t size) {
+    size_t len = 0;
+
+    for(c++; *c && *c != '"'; c++) {
+        char ch = *c;
+        if(ch == '\\') {
+            switch(*++c) {
+                case 'n': ch = '\n'; break;
+                case 't': ch = '\t'; break;
+                case 'r': ch = '\r'; break;
+                case 'b': ch = '\b'; break;
+                case 'f': ch = '\f'; break;
+                case 'u':
+                    // Only ASCII is of any use here
+                    for(int i = 1; i <= 4; i++) if(!c[i]) return NULL;
+                    ch = (char)strtol((char[5]) {c[1], c[2], c[3], c[4], '\0'}, NULL, 16);
+                    c += 4;
+                    break;
+                case '\0': return NULL;
+                default: ch = *c; break;
+            }
+        }
+
+        if(len + 1 >= size) return NULL;
+        out[len++] = ch;
+    }
+
+    if(*c != '"') return NULL;
+    out[len] = '\0';
+    return c + 1;
+}
+
+// A flat JSON object, nested objects and arrays are not needed by any command
+static bool parse_request(const char *line, request_t *request) {
+    const char *c = skip_space(line);
+    request->count = 0;
+    if(*c++ != '{') return false;
+
+    c = skip_space(c);
+    if(*c == '}') return *skip_space(c + 1) == '\0';
+
+    for(;;) {
+        if(request->count == MAX_FIELDS || *c != '"') return false;
+        field_t *field = &request->fields[request->count++];
+
+        if(!(c = parse_string(c, field->key, sizeof field->key))) return false;
+        c = skip_space(c);
+        if(*c++ != ':') return false;
+        c = skip_space(c);
+
+        field->is_string = *c == '"';
+        if(field->is_string) {
+            if(!(c = parse_string(c, field->value, sizeof field->value))) return false;
+        } else {
+            // Numbers, true, false and null
+            const size_t len = strcspn(c, " \t\r\n,}");
+            if(len == 0 || len >= sizeof field->value || *c == '{' || *c == '[') return false;
+            memcpy(field->value, c, len);
+            field->value[len] = '\0';
+            c += len;
+        }
+
+        c = skip_space(c);
+        if(*c == '}') return *skip_space(c + 1) == '\0';
+        if(*c++ != ',') return false;
+        c = skip_space(c);
+    }
+}
+
+static const field_t *find_field(const request_t *request, const char *key) {
+    for(size_t i = 0; i < request->count; i++)
+        if(strcmp(request->fields[i].key, key) == 0) return &request->fields[i];
+
+    return NULL;
+}
+
+// Number field, decimal or 0x prefixed hex in a string, def if it's missing and def >= 0
+static bool number_field(const request_t *request, const char *key, long long def, uint32_t max, uint32_t *out) {
+    const field_t *field = find_field(request, key);
+    if(!field) {
+        *out = def;
+        return def >= 0;
+    }
+
+    char *end;
+    const unsigned long value = strtoul(field->value, &end, 0);
+    if(field->value[0] == '\0' || field->value[0] == '-' || *end != '\0' || value > max) return false;
+
+    *out = value;
+    return true;
+}
+
+static uint16_t read_word(const chip8_t *chip8, uint32_t addr) {
+    return (chip8->ram[addr % chip8->ram_size] << 8) | chip8->ram[(addr + 1) % chip8->ram_size];
+}
+
+// Start a reply to request, echoing its id
+static void begin_reply(reply_t *reply, const request_t *request, bool ok) {
+    const field_t *id = find_field(request, "id");
+
+    reply_printf(reply, "{");
+    if(id) {
+        reply_printf(reply, "\"id\": ");
+        if(id->is_string) reply_string(reply, id->value);
+        else reply_printf(reply, "%s", id->value);
+        reply_printf(reply, ", ");
+    }
+    reply_printf(reply, "\"ok\": %s", ok ? "true" : "false");
+}
+
+static void send_error(server_t *server, const request_t *request, const char *error) {
+    reply_t reply = {0};
+    begin_reply(&reply, request, false);
+    reply_printf(&reply, ", \"error\": ");
+    reply_string(&reply, error);
+    send_reply(server, &reply);
+}
+
+static void send_ok(server_t *server, const request_t *request) {
+    reply_t reply = {0};
+    begin_reply(&reply, request, true);
+    send_reply(server, &reply);
+}
+
+// Machine state fields, after the opening part of a reply or event
+static void add_state(reply_t *reply, const server_t *server, const chip8_t *chip8) {
+    const uint16_t opcode = read_word(chip8, chip8->PC);
+    char mnemonic[64];
+    disasm_instruction_named(opcode, read_word(chip8, chip8->PC + 2), DISASM_RAW, NULL, &server->dbg.symbols,
+                             mnemonic, sizeof mnemonic);
+
+    reply_printf(reply, ", \"state\": \"%s\", \"pc\": %u, \"opcode\": %u, \"instruction\": ",
+                 server->running ? "running" : "paused", chip8->PC, opcode);
+    reply_string(reply, mnemonic);
+    reply_printf(reply, ", \"i\": %u, \"dt\": %u, \"st\": %u, \"v\": [", chip8->I, chip8->delay_timer, chip8->sound_timer);
+    for(int i = 0; i < 16; i++) reply_printf(reply, "%s%u", i ? ", " : "", chip8->V[i]);
+
+    // Innermost return address first, like the REPL
+    reply_printf(reply, "], \"stack\": [");
+    const size_t depth = chip8->stack_ptr - chip8->stack;
+    for(size_t i = depth; i > 0; i--) reply_printf(reply, "%s%u", i < depth ? ", " : "", chip8->stack[i - 1]);
+    reply_printf(reply, "]");
+}
+
+// Tell the client why the ROM stopped, a fault is cleared so the client can fix things up and go on
+static void send_stopped(server_t *server, chip8_t *chip8, const char *reason) {
+    reply_t reply = {0};
+
+    server->running = false;
+    reply_printf(&reply, "{\"event\": \"stopped\", \"reason\": \"%s\"", reason);
+    if(chip8->fault != CHIP8_FAULT_NONE) {
+        reply_printf(&reply, ", \"fault\": ");
+        reply_string(&reply, chip8_fault_name(chip8->fault));
+        chip8_clear_fault(chip8);
+    }
+    add_state(&reply, server, chip8);
+    send_reply(server, &reply);
+}
+
+// Returns false if the ROM exited, the client has been told
+static bool check_exit(server_t *server, chip8_t *chip8) {
+    if(chip8->fault != CHIP8_FAULT_NONE) {
+        send_stopped(server, chip8, "fault");
+        return true;
+    }
+    if(chip8->state != QUIT) return true;
+
+    reply_t reply = {0};
+    reply_printf(&reply, "{\"event\": \"exited\", \"pc\": %u", chip8->PC);
+    send_reply(server, &reply);
+    server->quit = true;
+    return false;
+}
+
+static bool parse_register(const char *name, int *reg) {
+    if((name[0] == 'V' || name[0] == 'v') && strlen(name) == 2) {
+        char *end;
+        *reg = strtol(&name[1], &end, 16);
+        return *end == '\0';
+    }
+
+    const char *specials[] = {"I", "PC", "DT", "ST"};
+    for(int i = 0; i < 4; i++) {
+        if(strcasecmp(name, specials[i]) == 0) {
+            *reg = 16 + i;
+            return true;
+        }
+    }
+
+    return false;
+}
+
+static void handle_set(server_t *server, chip8_t *chip8, const request_t *request) {
+    const field_t *name = find_field(request, "reg");
+    int reg;
+    uint32_t value;
+
+    if(!name || !parse_register(name->value, &reg)) {
+        send_error(server, request, "reg must be V0-VF, I, PC, DT or ST");
+        return;
+    }
+    if(!number_field(request, "value", -1, reg < 16 || reg >= 18 ? 0xFF : 0xFFFF, &value)) {
+        send_error(server, request, "Missing or invalid value");
+        return;
+    }
+
+    switch(reg) {
+        case 16: chip8->I = value; break;
+        case 17: chip8->PC = value; break;
+        case 18: chip8->delay_timer = value; break;
+        case 19: chip8->sound_timer = value; break;
+        default: chip8->V[reg] = value; break;
+    }
+
+    send_ok(server, request);
+}
+
+// break addr [condition], a condition on an existing breakpoint replaces its old one
+static void handle_break(server_t *server, const request_t *request) {
+    const field_t *condition = find_field(request, "condition");
+    char error[DEBUGGER_CONDITION_SIZE + 32];
+    uint32_t addr;
+
+    if(!number_field(request, "addr", -1, 0xFFFF, &addr)) {
+        send_error(server, request, "Missing or invalid addr");
+    } else if(condition && !debugger_check_condition(condition->value, error, sizeof error)) {
+        send_error(server, request, error);
+    } else if(!condition && debugger_is_breakpoint(&server->dbg, addr)) {
+        send_error(server, request, "Breakpoint already set");
+    } else if(!debugger_is_breakpoint(&server->dbg, addr) && !debugger_add_breakpoint(&server->dbg, addr)) {
+        send_error(server, request, "Too many breakpoints");
+    } else {
+        if(condition) debugger_set_condition(&server->dbg, addr, condition->value);
+        send_ok(server, request);
+    }
+}
+
+static void handle_write(server_t *server, chip8_t *chip8, const request_t *request) {
+    const field_t *data = find_field(request, "data");
+    uint32_t addr;
+
+    if(!number_field(request, "addr", -1, 0xFFFF, &addr)) {
+        send_error(server, request, "Missing or invalid addr");
+        return;
+    }
+
+    const size_t len = data ? strlen(data->value) : 0;
+    if(!data || len % 2 != 0 || strspn(data->value, "0123456789abcdefABCDEF") != len) {
+        send_error(server, request, "data must be a string of hex bytes");
+        return;
+    }
+
+    for(size_t i = 0; i < len; i += 2) {
+        const char byte[3] = {data->value[i], data->value[i + 1], '\0'};
+        chip8_poke(chip8, addr + i / 2, strtoul(byte, NULL, 16));
+    }
+
+    send_ok(server, request);
+}
+
+static void handle_request(server_t *server, chip8_t *chip8, const request_t *request) {
+    const field_t *cmd_field = find_field(request, "cmd");
+    const char *cmd = cmd_field ? cmd_field->value : "";
+    reply_t reply = {0};
+    uint32_t addr;
+    uint32_t count;
+
+    if(strcmp(cmd, "status") == 0) {
+        begin_reply(&reply, request, true);
+        add_state(&reply, server, chip8);
+        send_reply(server, &reply);
+    } else if(strcmp(cmd, "step") == 0) {
+        if(!number_field(request, "count", 1, UINT32_MAX, &count)) {
+            send_error(server, request, "Invalid count");
+            return;
+        }
+
+        server->running = false;
+        for(uint32_t i = 0; i < count && debugger_step(&server->dbg, chip8); i++)
+            ;
+
+        // The reply comes first so it's clear which request caused the fault or exit
+        begin_reply(&reply, request, true);
+        reply_printf(&reply, ", \"fault\": ");
+        if(chip8->fault != CHIP8_FAULT_NONE) reply_string(&reply, chip8_fault_name(chip8->fault));
+        else reply_printf(&reply, "null");
+        add_state(&reply, server, chip8);
+        send_reply(server, &reply);
+        check_exit(server, chip8);
+    } else if(strcmp(cmd, "continue") == 0) {
+        server->running = true;
+        send_ok(server, request);
+    } else if(strcmp(cmd, "pause") == 0) {
+        send_ok(server, request);
+        if(server->running) send_stopped(server, chip8, "pause");
+    } else if(strcmp(cmd, "break") == 0) {
+        handle_break(server, request);
+    } else if(strcmp(cmd, "delete") == 0) {
+        if(!number_field(request, "addr", -1, 0xFFFF, &addr)) {
+            send_error(server, request, "Missing or invalid addr");
+        } else if(!debugger_delete_breakpoint(&server->dbg, addr)) {
+            send_error(server, request, "No breakpoint at addr");
+        } else {
+            send_ok(server, request);
+        }
+    } else if(strcmp(cmd, "breakpoints") == 0) {
+        begin_reply(&reply, request, true);
+        reply_printf(&reply, ", \"breakpoints\": [");
+        for(size_t i = 0; i < server->dbg.breakpoint_count; i++)
+            reply_printf(&reply, "%s%u", i ? ", " : "", server->dbg.breakpoints[i]);
+        reply_printf(&reply, "]");
+        send_reply(server, &reply);
+    } else if(strcmp(cmd, "read") == 0) {
+        if(!number_field(request, "addr", -1, 0xFFFF, &addr) ||
+           !number_field(request, "len", 64, chip8->ram_size, &count)) {
+            send_error(server, request, "Missing or invalid addr or len");
+            return;
+        }
+
+        begin_reply(&reply, request, true);
+        reply_printf(&reply, ", \"addr\": %u, \"data\": \"", addr);
+        for(uint32_t i = 0; i < count; i++) reply_printf(&reply, "%02X", chip8->ram[(addr + i) % chip8->ram_size]);
+        reply_printf(&reply, "\"");
+        send_reply(server, &reply);
+    } else if(strcmp(cmd, "write") == 0) {
+        handle_write(server, chip8, request);
+    } else if(strcmp(cmd, "set") == 0) {
+        handle_set(server, chip8, request);
+    } else if(strcmp(cmd, "key") == 0) {
+        const field_t *pressed = find_field(request, "pressed");
+        if(!number_field(request, "key", -1, 0xF, &count) || !pressed ||
+           (strcmp(pressed->value, "true") != 0 && strcmp(pressed->value, "false") != 0)) {
+            send_error(server, request, "Usage: key, pressed true or false");
+            return;
+        }
+
+        chip8_set_key(chip8, count, pressed->value[0] == 't');
+        send_ok(server, request);
+    } else if(strcmp(cmd, "display") == 0) {
+        const uint32_t width = chip8_display_width(chip8);
+        const uint32_t height = chip8_display_height(chip8);
+
+        begin_reply(&reply, request, true);
+        reply_printf(&reply, ", \"width\": %u, \"height\": %u, \"pixels\": \"", width, height);
+        for(uint32_t y = 0; y < height; y++) {
+            for(uint32_t x = 0; x < width; x++) reply_printf(&reply, "%u", chip8_pixel_planes(chip8, x, y));
+            if(y + 1 < height) reply_printf(&reply, "\\n");
+        }
+        reply_printf(&reply, "\"");
+        send_reply(server, &reply);
+    } else if(strcmp(cmd, "disasm") == 0) {
+        if(!number_field(request, "addr", chip8->PC, 0xFFFF, &addr) ||
+           !number_field(request, "count", 10, 1000, &count)) {
+            send_error(server, request, "Invalid addr or count");
+            return;
+        }
+
+        begin_reply(&reply, request, true);
+        reply_printf(&reply, ", \"instructions\": [");
+        for(uint32_t i = 0; i < count; i++) {
+            const uint16_t opcode = read_word(chip8, addr);
+            char mnemonic[64];
+            const uint8_t len = disasm_instruction_named(opcode, read_word(chip8, addr + 2), DISASM_RAW, NULL,
+                                                         &server->dbg.symbols, mnemonic, sizeof mnemonic);
+
+            reply_printf(&reply, "%s{\"addr\": %u, \"opcode\": %u, \"text\": ", i ? ", " : "", addr, opcode);
+            reply_string(&reply, mnemonic);
+            reply_printf(&reply, "}");
+            addr = (addr + len) % chip8->ram_size;
+        }
+        reply_printf(&reply, "]");
+        send_reply(server, &reply);
+    } else if(strcmp(cmd, "reset") == 0) {
+        server->running = false;
+        chip8_reset(chip8);
+        send_ok(server, request);
+    } else if(strcmp(cmd, "quit") == 0) {
+        send_ok(server, request);
+        server->quit = true;
+    } else {
+        send_error(server, request, cmd_field ? "Unknown cmd" : "Missing cmd");
+    }
+}
+
+// Handle every complete line received so far
+static void handle_input(server_t *server, chip8_t *chip8) {
+    char *line = server->input;
+    char *newline;
+
+    while(!server->quit && server->client_fd >= 0 &&
+          (newline = memchr(line, '\n', server->input_len - (line - server->input)))) {
+        *newline = '\0';
+
+        static request_t request;
+        if(*skip_space(line) == '\0') {
+            // Blank line
+        } else if(!parse_request(line, &request)) {
+            request.count = 0;
+            send_error(server, &request, "Invalid request, expected a flat JSON object");
+        } else {
+            handle_request(server, chip8, &request);
+        }
+
+        line = newline + 1;
+    }
+
+    // Keep the start of an incomplete line, a line that doesn't fit is dropped
+    size_t left = server->input_len - (line - server->input);
+    if(left == sizeof server->input) left = 0;
+    memmove(server->input, line, left);
+    server->input_len = left;
+}
+
+static void accept_client(server_t *server, const chip8_t *chip8) {
+    const int fd = accept(server->listen_fd, NULL, NULL);
+    if(fd < 0) return;
+
+    if(server->client_fd >= 0) {
+        const char *busy = "{\"event\": \"busy\", \"error\": \"Another client is connected\"}\n";
+        net_send(fd, busy, strlen(busy));
+        close(fd);
+        return;
+    }
+
+    server->client_fd = fd;
+    server->input_len = 0;
+
+    reply_t reply = {0};
+    reply_printf(&reply, "{\"event\": \"hello\", \"rom\": ");
+    reply_string(&reply, chip8->rom_name ? chip8->rom_name : "");
+    add_state(&reply, server, chip8);
+    send_reply(server, &reply);
+}
+
+// Reads whatever arrived, false if the client went away
+static bool read_client(server_t *server) {
+    const ssize_t n = recv(server->client_fd, &server->input[server->input_len],
+                           sizeof server->input - server->input_len, 0);
+    if(n < 0 && errno == EINTR) return true;
+    if(n <= 0) return false;
+
+    server->input_len += n;
+    return true;
+}
+
+// One 60Hz frame worth of instructions, stopping at breakpoints
+static void run_frame(server_t *server, chip8_t *chip8) {
+    for(uint32_t i = 0; i < server->dbg.steps_per_frame && server->running; i++) {
+        // The instruction at a breakpoint just stopped at still runs
+        if(!debugger_step(&server->dbg, chip8) || chip8->fault != CHIP8_FAULT_NONE) {
+            check_exit(server, chip8);
+            return;
+        }
+
+        if(debugger_should_break(&server->dbg, chip8)) send_stopped(server, chip8, "breakpoint");
+    }
+}
+
+bool debug_server_run(chip8_t *chip8, const config_t *config) {
+    server_t server = {.client_fd = -1};
+    if((server.listen_fd = net_listen(config->debug_listen)) < 0) return false;
+
+    debugger_init(&server.dbg, config);
+    if(server.dbg.steps_per_frame == 0) server.dbg.steps_per_frame = 1;
+
+    // A client hanging up while we write to it shouldn't kill the emulator
+    void (*old_sigpipe)(int) = signal(SIGPIPE, SIG_IGN);
+
+    fprintf(stderr, "Debug server listening on %s, the ROM is paused until a client sends continue\n",
+            config->debug_listen);
+
+    uint64_t next_frame = net_now_ms();
+    uint32_t frames = 0;
+
+    while(!server.quit) {
+        struct pollfd fds[2] = {
+            {.fd = server.listen_fd, .events = POLLIN},
+            {.fd = server.client_fd, .events = POLLIN},
+        };
+
+        // Wait for the next frame while running, for the client otherwise
+        int timeout = -1;
+        if(server.running) {
+            const uint64_t now = net_now_ms();
+            timeout = next_frame > now ? (int)(next_frame - now) : 0;
+        }
+
+        if(poll(fds, server.client_fd >= 0 ? 2 : 1, timeout) < 0 && errno != EINTR) {
+            fprintf(stderr, "Debug server poll failed: %s\n", strerror(errno));
+            break;
+        }
+
+        if(server.client_fd >= 0 && fds[1].fd == server.client_fd && (fds[1].revents & (POLLIN | POLLHUP | POLLERR))) {
+            if(read_client(&server)) {
+                handle_input(&server, chip8);
+            } else {
+                // Keep the machine where it is for the next client
+                close(server.client_fd);
+                server.client_fd = -1;
+                server.running = false;
+            }
+        }
+
+        // After the client so one that just hung up doesn't make its replacement look like a second client
+        if(fds[0].revents & POLLIN) accept_client(&server, chip8);
+
+        if(!server.running) {
+            next_frame = net_now_ms();
+            continue;
+        }
+
+        if(net_now_ms() >= next_frame) {
+            run_frame(&server, chip8);
+
+            // 1000 / 60 ms per frame, spread over three frames to stay at 60Hz on average
+            next_frame += ++frames % 3 == 0 ? 16 : 17;
+            if(net_now_ms() > next_frame + 100) next_frame = net_now_ms();   // Too far behind to catch up
+        }
+    }
+
+    if(server.client_fd >= 0) close(server.client_fd);
+    close(server.listen_fd);
+    signal(SIGPIPE, old_sigpipe);
+    debugger_free(&server.dbg);
+    return true;
+}
@@ -0,0 +1,15 @@
+#ifndef DEBUG_SERVER_H
+#define DEBUG_SERVER_H
+
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "config.h"
+
+// Remote debugger for editors and other tools, JSON requests and replies over TCP, one per line
+// The protocol is described at the top of debug_server.c
+// Serves config->debug_listen ("[host:]port", host defaults to 127.0.0.1) until a client sends
+// quit or the ROM exits, returns false if the address can't be listened on
+bool debug_server_run(chip8_t *chip8, const config_t *config);
+
+#endif // DEBUG_SERVER_H
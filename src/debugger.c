@@ -0,0 +1,1080 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <strings.h>
+#include <ctype.h>
+#include <signal.h>
+
+#include "debugger.h"
+#include "disasm.h"
+#include "cheat.h"
+#include "romload.h"
+
+// Set from the SIGINT handler to pause a running "continue"
+static volatile sig_atomic_t interrupted = 0;
+
+static void debugger_interrupt(int sig) {
+    (void)sig;
+    interrupted = 1;
+}
+
+static void print_help(void) {
+    puts("Commands:\n"
+         "  s, step [n]           Execute n instructions (default 1)\n"
+         "  n, next               Step over a subroutine call\n"
+         "  fin, finish           Run until the current subroutine returns\n"
+         "  c, continue           Run until a breakpoint, Ctrl-C pauses\n"
+         "  b, break <addr> [if <cond>]  Set a breakpoint on a PC address, e.g. if v[3] == 0x1F && hits > 2\n"
+         "  d, delete <addr>      Remove a breakpoint\n"
+         "                        Addresses for break, delete and mem can be labels from the symbols\n"
+         "  bl, breakpoints       List breakpoints\n"
+         "  w, watch <addr>[-<end>] [r|w|rw]  Stop on memory reads and/or writes (default w)\n"
+         "  w, watch <V0-VF|I|DT|ST>          Stop when a register changes\n"
+         "  wl, watchpoints       List watchpoints\n"
+         "  unwatch <n>           Remove watchpoint n\n"
+         "  r, regs               Show registers and timers\n"
+         "  m, mem [read] <addr> [len]  Dump memory (default 64 bytes)\n"
+         "  mem write <addr> <byte>...  Write hex bytes to memory\n"
+         "  st, stack             Show the call stack\n"
+         "  disp, display         Show the display\n"
+         "  spr, sprite [rows]    Show the sprite at I as the DXYN at PC draws it (default 15 rows)\n"
+         "                        and the BCD digits at I\n"
+         "  k, key <k> <0|1>      Press or release keypad key 0-F\n"
+         "  speed [n]             Show or change the instructions per second\n"
+         "  quirk [<name> [0|1]]  List the quirks, or toggle or set one, e.g. quirk shift\n"
+         "  freeze <addr> <val> [name]  Hold a memory byte at val (hex)\n"
+         "  poke <addr> <val> [name]    Write a memory byte once (hex)\n"
+         "  cheats                List cheats\n"
+         "  cheat on|off|del <n>  Enable, disable or delete cheat n\n"
+         "  cheat save            Write the cheats to the cheat file\n"
+         "  h, help               Show this help\n"
+         "  q, quit               Exit the debugger");
+}
+
+// Parse a number in base 10 or 16, hex numbers may have a 0x prefix
+static bool parse_number(const char *str, int base, uint32_t max, uint32_t *out) {
+    if(!str) {
+        puts("Missing argument");
+        return false;
+    }
+
+    char *end = NULL;
+    const unsigned long value = strtoul(str, &end, base);
+    if(*str == '\0' || *end != '\0' || value > max) {
+        printf("Invalid value %s\n", str);
+        return false;
+    }
+
+    *out = (uint32_t)value;
+    return true;
+}
+
+// Address argument, a label or hex
+static bool parse_address(const debugger_t *dbg, const char *str, uint16_t *addr) {
+    if(!str) {
+        puts("Missing argument");
+        return false;
+    }
+
+    if(debugger_parse_address(dbg, str, addr)) return true;
+
+    printf("Invalid address or unknown label %s\n", str);
+    return false;
+}
+
+void debugger_init(debugger_t *dbg, const config_t *config) {
+    *dbg = (debugger_t) {
+        .steps_per_frame = config->insts_per_second / 60,
+    };
+
+    // A symbol file that can't be read is reported, the debugger works without names then
+    if(!config->rom_name || config->builtin || !romload_symbols(config->rom_name, config->symbols_path, &dbg->symbols))
+        symbols_init(&dbg->symbols);
+}
+
+void debugger_free(debugger_t *dbg) {
+    symbols_free(&dbg->symbols);
+}
+
+bool debugger_parse_address(const debugger_t *dbg, const char *str, uint16_t *addr) {
+    if(symbols_find(&dbg->symbols, str, addr)) return true;
+
+    char *end = NULL;
+    const unsigned long value = strtoul(str, &end, 16);
+    if(*str == '\0' || *end != '\0' || value > 0xFFFF) return false;
+
+    *addr = (uint16_t)value;
+    return true;
+}
+
+void debugger_location(const debugger_t *dbg, uint16_t addr, char *text, size_t size) {
+    if(dbg->symbols.label_count == 0 && dbg->symbols.line_count == 0) {
+        snprintf(text, size, "%s", "");
+        return;
+    }
+
+    char name[SYMBOLS_NAME_SIZE + 8] = "";
+    if(dbg->symbols.label_count > 0) {
+        name[0] = ' ';
+        symbols_describe(&dbg->symbols, addr, name + 1, sizeof name - 1);
+    }
+
+    const uint32_t line = symbols_line(&dbg->symbols, addr);
+    const char *source = dbg->symbols.source[0] ? dbg->symbols.source : "line";
+    if(line) snprintf(text, size, "%s (%s:%u)", name, source, line);
+    else snprintf(text, size, "%s", name);
+}
+
+bool debugger_is_breakpoint(const debugger_t *dbg, uint16_t addr) {
+    for(size_t i = 0; i < dbg->breakpoint_count; i++)
+        if(dbg->breakpoints[i] == addr) return true;
+
+    return false;
+}
+
+// Returns false if the breakpoint is already set or there is no room for it
+bool debugger_add_breakpoint(debugger_t *dbg, uint16_t addr) {
+    if(debugger_is_breakpoint(dbg, addr) || dbg->breakpoint_count >= DEBUGGER_MAX_BREAKPOINTS) return false;
+
+    dbg->conditions[dbg->breakpoint_count][0] = '\0';
+    dbg->hits[dbg->breakpoint_count] = 0;
+    dbg->breakpoints[dbg->breakpoint_count++] = addr;
+    return true;
+}
+
+// Returns false if there is no breakpoint at addr
+bool debugger_delete_breakpoint(debugger_t *dbg, uint16_t addr) {
+    for(size_t i = 0; i < dbg->breakpoint_count; i++) {
+        if(dbg->breakpoints[i] == addr) {
+            const size_t last = --dbg->breakpoint_count;
+            dbg->breakpoints[i] = dbg->breakpoints[last];
+            dbg->hits[i] = dbg->hits[last];
+            memcpy(dbg->conditions[i], dbg->conditions[last], DEBUGGER_CONDITION_SIZE);
+            return true;
+        }
+    }
+
+    return false;
+}
+
+// Breakpoint condition being parsed, with chip8 NULL only the syntax is checked
+typedef struct {
+    const char *pos;
+    const chip8_t *chip8;
+    uint32_t hits;
+    bool error;
+    const char *error_at;       // Where the first error was found
+} condition_t;
+
+static int64_t parse_or(condition_t *cond);
+
+static void fail(condition_t *cond, const char *at) {
+    if(cond->error) return;
+
+    cond->error = true;
+    cond->error_at = at;
+}
+
+static void skip_blanks(condition_t *cond) {
+    while(*cond->pos == ' ' || *cond->pos == '\t') cond->pos++;
+}
+
+// Consume token if it's next
+static bool accept(condition_t *cond, const char *token) {
+    skip_blanks(cond);
+
+    const size_t len = strlen(token);
+    if(strncmp(cond->pos, token, len) != 0) return false;
+
+    cond->pos += len;
+    return true;
+}
+
+// v[index] and mem[addr]
+static int64_t parse_index(condition_t *cond, bool memory) {
+    if(!accept(cond, "[")) {
+        fail(cond, cond->pos);
+        return 0;
+    }
+
+    const char *start = cond->pos;
+    const int64_t index = parse_or(cond);
+    if(!accept(cond, "]")) fail(cond, cond->pos);
+
+    // Constant V indexes are checked up front, computed ones wrap around
+    if(!memory && !cond->chip8 && (index < 0 || index > 0xF)) fail(cond, start);
+    if(!cond->chip8) return 0;
+
+    return memory ? cond->chip8->ram[(uint64_t)index % cond->chip8->ram_size] : cond->chip8->V[index & 0xF];
+}
+
+// Numbers, variables, parentheses and the unary operators
+static int64_t parse_primary(condition_t *cond) {
+    if(accept(cond, "(")) {
+        const int64_t value = parse_or(cond);
+        if(!accept(cond, ")")) fail(cond, cond->pos);
+        return value;
+    }
+    if(accept(cond, "!")) return !parse_primary(cond);
+    if(accept(cond, "-")) return (int64_t)(0 - (uint64_t)parse_primary(cond));
+
+    // Decimal, or hex with a 0x prefix
+    if(isdigit((unsigned char)*cond->pos)) {
+        char *end = NULL;
+        const int64_t value = strtoll(cond->pos, &end, strncasecmp(cond->pos, "0x", 2) == 0 ? 16 : 10);
+        cond->pos = end;
+        return value;
+    }
+
+    char name[8];
+    size_t len = 0;
+    while(isalnum((unsigned char)cond->pos[len])) len++;
+    if(len == 0 || len >= sizeof name) {
+        fail(cond, cond->pos);
+        return 0;
+    }
+
+    for(size_t i = 0; i < len; i++) name[i] = (char)tolower((unsigned char)cond->pos[i]);
+    name[len] = '\0';
+    cond->pos += len;
+
+    const chip8_t *chip8 = cond->chip8;
+    if(strcmp(name, "v") == 0) return parse_index(cond, false);
+    if(strcmp(name, "mem") == 0) return parse_index(cond, true);
+    if(len == 2 && name[0] == 'v' && isxdigit((unsigned char)name[1])) return chip8 ? chip8->V[strtol(&name[1], NULL, 16)] : 0;
+    if(strcmp(name, "i") == 0) return chip8 ? chip8->I : 0;
+    if(strcmp(name, "pc") == 0) return chip8 ? chip8->PC : 0;
+    if(strcmp(name, "dt") == 0) return chip8 ? chip8->delay_timer : 0;
+    if(strcmp(name, "st") == 0) return chip8 ? chip8->sound_timer : 0;
+    if(strcmp(name, "sp") == 0) return chip8 ? (int64_t)debugger_call_depth(chip8) : 0;
+    if(strcmp(name, "hits") == 0) return cond->hits;
+
+    fail(cond, cond->pos - len);
+    return 0;
+}
+
+// Arithmetic wraps around instead of overflowing, dividing by zero gives 0
+static int64_t parse_term(condition_t *cond) {
+    int64_t value = parse_primary(cond);
+
+    for(;;) {
+        if(accept(cond, "*")) {
+            value = (int64_t)((uint64_t)value * (uint64_t)parse_primary(cond));
+        } else if(accept(cond, "/") || accept(cond, "%")) {
+            const bool modulo = cond->pos[-1] == '%';
+            const int64_t divisor = parse_primary(cond);
+
+            if(divisor == 0 || (divisor == -1 && value == INT64_MIN)) value = 0;
+            else value = modulo ? value % divisor : value / divisor;
+        } else {
+            return value;
+        }
+    }
+}
+
+static int64_t parse_sum(condition_t *cond) {
+    int64_t value = parse_term(cond);
+
+    for(;;) {
+        if(accept(cond, "+")) value = (int64_t)((uint64_t)value + (uint64_t)parse_term(cond));
+        else if(accept(cond, "-")) value = (int64_t)((uint64_t)value - (uint64_t)parse_term(cond));
+        else return value;
+    }
+}
+
+// The two character operators are tried first so "<=" isn't read as "<"
+static int64_t parse_compare(condition_t *cond) {
+    const int64_t left = parse_sum(cond);
+
+    if(accept(cond, "==")) return left == parse_sum(cond);
+    if(accept(cond, "!=")) return left != parse_sum(cond);
+    if(accept(cond, "<=")) return left <= parse_sum(cond);
+    if(accept(cond, ">=")) return left >= parse_sum(cond);
+    if(accept(cond, "<")) return left < parse_sum(cond);
+    if(accept(cond, ">")) return left > parse_sum(cond);
+    return left;
+}
+
+// Both sides are always evaluated, the expressions have no side effects
+static int64_t parse_and(condition_t *cond) {
+    int64_t value = parse_compare(cond);
+
+    while(accept(cond, "&&")) {
+        const int64_t right = parse_compare(cond);
+        value = value && right;
+    }
+    return value;
+}
+
+static int64_t parse_or(condition_t *cond) {
+    int64_t value = parse_and(cond);
+
+    while(accept(cond, "||")) {
+        const int64_t right = parse_and(cond);
+        value = value || right;
+    }
+    return value;
+}
+
+static bool eval_condition(condition_t *cond, int64_t *value) {
+    *value = parse_or(cond);
+    skip_blanks(cond);
+    if(*cond->pos != '\0') fail(cond, cond->pos);
+
+    return !cond->error;
+}
+
+// Returns false with a message in error if the condition doesn't parse
+bool debugger_check_condition(const char *condition, char *error, size_t size) {
+    condition_t cond = {.pos = condition};
+    int64_t value;
+
+    if(strlen(condition) >= DEBUGGER_CONDITION_SIZE) {
+        snprintf(error, size, "Condition too long, maximum is %d characters", DEBUGGER_CONDITION_SIZE - 1);
+        return false;
+    }
+    if(eval_condition(&cond, &value)) return true;
+
+    if(*cond.error_at == '\0') snprintf(error, size, "Unexpected end of condition");
+    else snprintf(error, size, "Invalid condition at \"%s\"", cond.error_at);
+    return false;
+}
+
+// An empty condition makes the breakpoint unconditional again, returns false if there is no
+// breakpoint at addr or the condition doesn't parse
+bool debugger_set_condition(debugger_t *dbg, uint16_t addr, const char *condition) {
+    char error[DEBUGGER_CONDITION_SIZE + 32];
+
+    for(size_t i = 0; i < dbg->breakpoint_count; i++) {
+        if(dbg->breakpoints[i] != addr) continue;
+        if(*condition && !debugger_check_condition(condition, error, sizeof error)) return false;
+
+        snprintf(dbg->conditions[i], DEBUGGER_CONDITION_SIZE, "%s", condition);
+        return true;
+    }
+
+    return false;
+}
+
+// Condition of the breakpoint at addr, NULL without a breakpoint or condition
+const char *debugger_condition(const debugger_t *dbg, uint16_t addr) {
+    for(size_t i = 0; i < dbg->breakpoint_count; i++)
+        if(dbg->breakpoints[i] == addr) return dbg->conditions[i][0] ? dbg->conditions[i] : NULL;
+
+    return NULL;
+}
+
+bool debugger_should_break(debugger_t *dbg, const chip8_t *chip8) {
+    for(size_t i = 0; i < dbg->breakpoint_count; i++) {
+        if(dbg->breakpoints[i] != chip8->PC) continue;
+
+        dbg->hits[i]++;
+        if(dbg->conditions[i][0] == '\0') return true;
+
+        condition_t cond = {.pos = dbg->conditions[i], .chip8 = chip8, .hits = dbg->hits[i]};
+        int64_t value;
+        return eval_condition(&cond, &value) && value != 0;
+    }
+
+    return false;
+}
+
+// Value a register watchpoint compares against
+static uint16_t watch_value(const watchpoint_t *watch, const chip8_t *chip8) {
+    switch(watch->target) {
+        case WATCH_V:  return chip8->V[watch->reg];
+        case WATCH_I:  return chip8->I;
+        case WATCH_DT: return chip8->delay_timer;
+        case WATCH_ST: return chip8->sound_timer;
+        default:       return 0;
+    }
+}
+
+// Returns false if there is no room for the watchpoint
+bool debugger_add_watchpoint(debugger_t *dbg, const chip8_t *chip8, watchpoint_t watch) {
+    if(dbg->watchpoint_count >= DEBUGGER_MAX_WATCHPOINTS) return false;
+
+    watch.last = watch_value(&watch, chip8);
+    dbg->watchpoints[dbg->watchpoint_count++] = watch;
+    return true;
+}
+
+// Later watchpoints move down one so the numbering stays in the order they were added
+bool debugger_delete_watchpoint(debugger_t *dbg, size_t index) {
+    if(index >= dbg->watchpoint_count) return false;
+
+    memmove(&dbg->watchpoints[index], &dbg->watchpoints[index + 1],
+            (--dbg->watchpoint_count - index) * sizeof dbg->watchpoints[0]);
+    return true;
+}
+
+void debugger_describe_watchpoint(const watchpoint_t *watch, char *text, size_t size) {
+    switch(watch->target) {
+        case WATCH_V:  snprintf(text, size, "V%X", watch->reg); return;
+        case WATCH_I:  snprintf(text, size, "I"); return;
+        case WATCH_DT: snprintf(text, size, "DT"); return;
+        case WATCH_ST: snprintf(text, size, "ST"); return;
+        default:       break;
+    }
+
+    const char *access = watch->on_read && watch->on_write ? "access" : watch->on_read ? "read" : "write";
+    if(watch->end == watch->start) snprintf(text, size, "%s 0x%04X", access, watch->start);
+    else snprintf(text, size, "%s 0x%04X-0x%04X", access, watch->start, watch->end);
+}
+
+// One line report of the last watchpoint hit with the instruction responsible
+void debugger_describe_hit(const debugger_t *dbg, const chip8_t *chip8, char *text, size_t size) {
+    const watch_hit_t *hit = &dbg->watch_hit;
+    const watchpoint_t *watch = &dbg->watchpoints[hit->index];
+    const uint16_t opcode = (chip8->ram[hit->pc % chip8->ram_size] << 8) | chip8->ram[(hit->pc + 1) % chip8->ram_size];
+    const uint16_t next = (chip8->ram[(hit->pc + 2) % chip8->ram_size] << 8) | chip8->ram[(hit->pc + 3) % chip8->ram_size];
+    char mnemonic[64];
+    char name[32];
+
+    disasm_instruction_named(opcode, next, DISASM_RAW, NULL, &dbg->symbols, mnemonic, sizeof mnemonic);
+    debugger_describe_watchpoint(watch, name, sizeof name);
+
+    if(watch->target != WATCH_MEMORY) {
+        snprintf(text, size, "Watchpoint %zu: %s = 0x%02X (was 0x%02X) by 0x%04X %s",
+                 hit->index, name, hit->value, hit->old_value, hit->pc, mnemonic);
+    } else if(hit->write) {
+        snprintf(text, size, "Watchpoint %zu: write 0x%04X = 0x%02X (was 0x%02X) by 0x%04X %s",
+                 hit->index, hit->addr, hit->value, hit->old_value, hit->pc, mnemonic);
+    } else {
+        snprintf(text, size, "Watchpoint %zu: read 0x%04X = 0x%02X by 0x%04X %s",
+                 hit->index, hit->addr, hit->value, hit->pc, mnemonic);
+    }
+}
+
+// Subroutine calls the ROM is inside of
+size_t debugger_call_depth(const chip8_t *chip8) {
+    return chip8->stack_ptr - chip8->stack;
+}
+
+void debugger_sprite(const chip8_t *chip8, uint8_t default_rows, debugger_sprite_t *sprite) {
+    const uint32_t size = chip8->ram_size;
+    const uint16_t opcode = (chip8->ram[chip8->PC % size] << 8) | chip8->ram[(chip8->PC + 1) % size];
+
+    *sprite = (debugger_sprite_t) {
+        .addr = chip8->I,
+        .rows = default_rows < 1 ? 1 : default_rows > 16 ? 16 : default_rows,
+        .width = 8,
+        .at_draw = (opcode & 0xF000) == 0xD000 && !chip8->mega,
+    };
+    if(sprite->at_draw) {
+        sprite->rows = (opcode & 0xF) ? (opcode & 0xF) : 16;
+        sprite->width = (opcode & 0xF) ? 8 : 16;
+    }
+
+    // Reads wrap around the end of memory like DXYN's
+    const uint32_t bytes = sprite->width / 8;
+    for(uint32_t row = 0; row < sprite->rows; row++) {
+        const uint32_t addr = chip8->I + row * bytes;
+        sprite->bits[row] = bytes == 2 ? (chip8->ram[addr % size] << 8) | chip8->ram[(addr + 1) % size]
+                                       : chip8->ram[addr % size];
+    }
+}
+
+void debugger_describe_bcd(const chip8_t *chip8, char *text, size_t size) {
+    const uint32_t ram_size = chip8->ram_size;
+    const uint16_t opcode = (chip8->ram[chip8->PC % ram_size] << 8) | chip8->ram[(chip8->PC + 1) % ram_size];
+    const uint8_t digits[3] = {
+        chip8->ram[chip8->I % ram_size], chip8->ram[(chip8->I + 1) % ram_size], chip8->ram[(chip8->I + 2) % ram_size],
+    };
+
+    int len = snprintf(text, size, "%u %u %u", digits[0], digits[1], digits[2]);
+    if((opcode & 0xF0FF) == 0xF033 && len >= 0 && (size_t)len < size)
+        snprintf(text + len, size - len, " <- V%X = %u", (opcode >> 8) & 0xF, chip8->V[(opcode >> 8) & 0xF]);
+}
+
+bool debugger_at_call(const chip8_t *chip8) {
+    return chip8->ram[chip8->PC % chip8->ram_size] >> 4 == 0x2;
+}
+
+// break <addr> [if <condition>], a condition on an existing breakpoint replaces its old one
+static void add_breakpoint(debugger_t *dbg, uint16_t addr, const char *keyword, const char *condition) {
+    char error[DEBUGGER_CONDITION_SIZE + 32];
+
+    if(keyword && (strcmp(keyword, "if") != 0 || !condition)) {
+        puts("Usage: break <addr> [if <condition>]");
+        return;
+    }
+    if(condition && !debugger_check_condition(condition, error, sizeof error)) {
+        puts(error);
+        return;
+    }
+
+    if(debugger_is_breakpoint(dbg, addr) && !condition) {
+        printf("Breakpoint at 0x%04X already set\n", addr);
+    } else if(!debugger_is_breakpoint(dbg, addr) && !debugger_add_breakpoint(dbg, addr)) {
+        printf("Too many breakpoints, maximum is %d\n", DEBUGGER_MAX_BREAKPOINTS);
+    } else if(condition) {
+        debugger_set_condition(dbg, addr, condition);
+        printf("Breakpoint at 0x%04X if %s\n", addr, condition);
+    } else {
+        printf("Breakpoint set at 0x%04X\n", addr);
+    }
+}
+
+static void delete_breakpoint(debugger_t *dbg, uint16_t addr) {
+    if(debugger_delete_breakpoint(dbg, addr)) printf("Breakpoint at 0x%04X deleted\n", addr);
+    else printf("No breakpoint at 0x%04X\n", addr);
+}
+
+static void print_breakpoints(const debugger_t *dbg) {
+    if(dbg->breakpoint_count == 0) {
+        puts("No breakpoints");
+        return;
+    }
+
+    for(size_t i = 0; i < dbg->breakpoint_count; i++) {
+        char location[SYMBOLS_NAME_SIZE + SYMBOLS_SOURCE_SIZE + 32];
+        debugger_location(dbg, dbg->breakpoints[i], location, sizeof location);
+        printf("  0x%04X%s", dbg->breakpoints[i], location);
+        if(dbg->conditions[i][0]) printf(" if %s", dbg->conditions[i]);
+        printf(", hits: %u\n", dbg->hits[i]);
+    }
+}
+
+// watch <addr>[-<end>] [r|w|rw] and watch <V0-VF|I|DT|ST>
+static void add_watchpoint(debugger_t *dbg, const chip8_t *chip8, const char *target, const char *mode) {
+    watchpoint_t watch = {.target = WATCH_MEMORY, .on_write = true};
+    uint32_t start, end;
+    char text[32];
+
+    if(!target) {
+        puts("Usage: watch <addr>[-<end>] [r|w|rw] or watch <V0-VF|I|DT|ST>");
+        return;
+    }
+
+    if((target[0] == 'v' || target[0] == 'V') && strlen(target) == 2 && strchr("0123456789abcdefABCDEF", target[1])) {
+        watch.target = WATCH_V;
+        watch.reg = (uint8_t)strtoul(&target[1], NULL, 16);
+    } else if(strcasecmp(target, "i") == 0) {
+        watch.target = WATCH_I;
+    } else if(strcasecmp(target, "dt") == 0) {
+        watch.target = WATCH_DT;
+    } else if(strcasecmp(target, "st") == 0) {
+        watch.target = WATCH_ST;
+    } else {
+        snprintf(text, sizeof text, "%s", target);
+        char *dash = strchr(text, '-');
+        if(dash) *dash = '\0';
+
+        if(!parse_number(text, 16, 0xFFFF, &start)) return;
+        end = start;
+        if(dash && !parse_number(dash + 1, 16, 0xFFFF, &end)) return;
+        if(end < start) {
+            printf("Invalid range %s\n", target);
+            return;
+        }
+
+        if(mode && strcmp(mode, "r") != 0 && strcmp(mode, "w") != 0 && strcmp(mode, "rw") != 0) {
+            printf("Invalid access %s, use r, w or rw\n", mode);
+            return;
+        }
+
+        watch.start = start;
+        watch.end = end;
+        watch.on_read = mode && strchr(mode, 'r');
+        watch.on_write = !mode || strchr(mode, 'w');
+    }
+
+    if(!debugger_add_watchpoint(dbg, chip8, watch)) {
+        printf("Too many watchpoints, maximum is %d\n", DEBUGGER_MAX_WATCHPOINTS);
+        return;
+    }
+
+    debugger_describe_watchpoint(&watch, text, sizeof text);
+    printf("Watchpoint %zu: %s\n", dbg->watchpoint_count - 1, text);
+}
+
+static void print_watchpoints(const debugger_t *dbg) {
+    if(dbg->watchpoint_count == 0) {
+        puts("No watchpoints");
+        return;
+    }
+
+    for(size_t i = 0; i < dbg->watchpoint_count; i++) {
+        char text[32];
+        debugger_describe_watchpoint(&dbg->watchpoints[i], text, sizeof text);
+        printf("  %zu: %s\n", i, text);
+    }
+}
+
+static void print_cheats(const cheat_list_t *cheats) {
+    if(cheats->count == 0) {
+        puts("No cheats");
+        return;
+    }
+
+    for(size_t i = 0; i < cheats->count; i++) {
+        const cheat_t *cheat = &cheats->cheats[i];
+        printf("  %zu: %-6s 0x%04X = 0x%02X%s  %s\n", i, cheat->freeze ? "freeze" : "poke", cheat->addr, cheat->value,
+               cheat->enabled ? "" : " (off)", cheat->name);
+    }
+}
+
+// freeze and poke <addr> <value> [name]
+static void add_cheat(cheat_list_t *cheats, chip8_t *chip8, bool freeze, const char *addr_arg, const char *value_arg,
+                      const char *name) {
+    uint32_t addr, value;
+    if(!parse_number(addr_arg, 16, 0xFFFF, &addr) || !parse_number(value_arg, 16, 0xFF, &value)) return;
+
+    if(!cheat_add(cheats, freeze, addr, value, name)) {
+        printf("Too many cheats, maximum is %d\n", CHEAT_MAX);
+        return;
+    }
+
+    cheat_attach(cheats, chip8);
+    printf("Cheat %zu: %s 0x%04X = 0x%02X\n", cheats->count - 1, freeze ? "freeze" : "poke", addr, value);
+}
+
+// cheat on|off|del <n> and cheat save
+static void cheat_command(cheat_list_t *cheats, chip8_t *chip8, const config_t *config, const char *action,
+                          const char *index_arg) {
+    uint32_t index;
+
+    if(action && strcmp(action, "save") == 0) {
+        if(!config->cheat_path) puts("No cheat file for this ROM");
+        else if(cheat_save_file(cheats, config->cheat_path)) printf("Saved %zu cheats to %s\n", cheats->count, config->cheat_path);
+        return;
+    }
+
+    if(!action || (strcmp(action, "on") != 0 && strcmp(action, "off") != 0 && strcmp(action, "del") != 0)) {
+        puts("Usage: cheat on|off|del <n> or cheat save");
+        return;
+    }
+    if(!parse_number(index_arg, 10, UINT32_MAX, &index)) return;
+
+    const bool ok = strcmp(action, "del") == 0 ? cheat_delete(cheats, index)
+                                               : cheat_set_enabled(cheats, index, strcmp(action, "on") == 0);
+    if(!ok) {
+        printf("No cheat %u\n", index);
+        return;
+    }
+
+    cheat_apply(cheats, chip8);
+    print_cheats(cheats);
+}
+
+static void print_registers(const debugger_t *dbg, const chip8_t *chip8) {
+    const uint16_t opcode = (chip8->ram[chip8->PC % chip8->ram_size] << 8) | chip8->ram[(chip8->PC + 1) % chip8->ram_size];
+    const uint16_t next = (chip8->ram[(chip8->PC + 2) % chip8->ram_size] << 8) | chip8->ram[(chip8->PC + 3) % chip8->ram_size];
+    char mnemonic[64];
+    char location[SYMBOLS_NAME_SIZE + SYMBOLS_SOURCE_SIZE + 32];
+
+    disasm_instruction_named(opcode, next, DISASM_RAW, NULL, &dbg->symbols, mnemonic, sizeof mnemonic);
+    debugger_location(dbg, chip8->PC, location, sizeof location);
+    printf("PC: 0x%04X%s (%04X %s)  I: 0x%04X  DT: %u  ST: %u\n",
+           chip8->PC, location, opcode, mnemonic, chip8->I, chip8->delay_timer, chip8->sound_timer);
+
+    for(int i = 0; i < 16; i++)
+        printf("V%X: 0x%02X%s", i, chip8->V[i], i % 8 == 7 ? "\n" : "  ");
+}
+
+static void print_memory(const chip8_t *chip8, uint32_t addr, uint32_t len) {
+    for(uint32_t row = 0; row < len; row += 16) {
+        printf("%04X:", (addr + row) % chip8->ram_size);
+
+        for(uint32_t i = row; i < row + 16 && i < len; i++)
+            printf(" %02X", chip8->ram[(addr + i) % chip8->ram_size]);
+
+        putchar('\n');
+    }
+}
+
+// mem write <addr> <byte>..., the bytes are hex and written in one go once they all parse
+static void write_memory(chip8_t *chip8, const char *addr_arg, const char *bytes_arg) {
+    uint8_t bytes[64];
+    uint32_t addr;
+    size_t count = 0;
+
+    if(!parse_number(addr_arg, 16, 0xFFFF, &addr)) return;
+
+    for(const char *str = bytes_arg; str && *str;) {
+        char *end = NULL;
+        const unsigned long value = strtoul(str, &end, 16);
+
+        if(end == str || value > 0xFF || (*end != '\0' && *end != ' ' && *end != '\t')) {
+            printf("Invalid byte in %s\n", bytes_arg);
+            return;
+        }
+        if(count == sizeof bytes) {
+            printf("Too many bytes, maximum is %zu\n", sizeof bytes);
+            return;
+        }
+
+        bytes[count++] = (uint8_t)value;
+        for(str = end; *str == ' ' || *str == '\t'; str++)
+            ;
+    }
+
+    if(count == 0) {
+        puts("Usage: mem write <addr> <byte>...");
+        return;
+    }
+
+    // chip8_poke keeps the decode cache in step with the new bytes
+    for(size_t i = 0; i < count; i++) chip8_poke(chip8, (addr + i) % chip8->ram_size, bytes[i]);
+    print_memory(chip8, addr, count);
+}
+
+// Innermost frame first, PC and then the call site of every return address
+static void print_stack(const debugger_t *dbg, const chip8_t *chip8) {
+    const size_t depth = debugger_call_depth(chip8);
+    char location[SYMBOLS_NAME_SIZE + SYMBOLS_SOURCE_SIZE + 32];
+
+    debugger_location(dbg, chip8->PC, location, sizeof location);
+    printf("  #0 0x%04X%s\n", chip8->PC, location);
+
+    for(size_t i = depth; i > 0; i--) {
+        const uint16_t ret = chip8->stack[i - 1];
+        const uint16_t call = (ret - 2) & 0xFFFF;
+        const uint16_t opcode = (chip8->ram[call % chip8->ram_size] << 8) | chip8->ram[(call + 1) % chip8->ram_size];
+        char mnemonic[64];
+
+        disasm_instruction_named(opcode, 0, DISASM_RAW, NULL, &dbg->symbols, mnemonic, sizeof mnemonic);
+        debugger_location(dbg, call, location, sizeof location);
+        printf("  #%zu 0x%04X%s  %s, returns to 0x%04X\n", depth - i + 1, call, location, mnemonic, ret);
+    }
+}
+
+static void print_display(const chip8_t *chip8) {
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t height = chip8_display_height(chip8);
+
+    for(uint32_t y = 0; y < height; y++) {
+        for(uint32_t x = 0; x < width; x++)
+            putchar(chip8_pixel(chip8, x, y) ? '#' : '.');
+
+        putchar('\n');
+    }
+}
+
+// Memory hooks for one watched instruction, chained to the hooks that were installed before
+typedef struct {
+    debugger_t *dbg;
+    const chip8_t *chip8;
+    uint16_t pc;
+    chip8_memory_hook_t next_read;
+    chip8_memory_hook_t next_write;
+    void *next_userdata;
+} watch_context_t;
+
+// The first watched access of an instruction is the one reported
+static void check_memory_watch(watch_context_t *context, uint16_t addr, uint8_t old_value, uint8_t value, bool write) {
+    watch_hit_t *hit = &context->dbg->watch_hit;
+    if(hit->hit) return;
+
+    for(size_t i = 0; i < context->dbg->watchpoint_count; i++) {
+        const watchpoint_t *watch = &context->dbg->watchpoints[i];
+        if(watch->target != WATCH_MEMORY || addr < watch->start || addr > watch->end) continue;
+        if(!(write ? watch->on_write : watch->on_read)) continue;
+
+        *hit = (watch_hit_t) {
+            .hit = true, .index = i, .pc = context->pc, .write = write,
+            .addr = addr, .old_value = old_value, .value = value,
+        };
+        return;
+    }
+}
+
+static uint8_t watch_read_hook(void *userdata, uint16_t addr, uint8_t value) {
+    watch_context_t *context = userdata;
+    if(context->next_read) value = context->next_read(context->next_userdata, addr, value);
+
+    check_memory_watch(context, addr, value, value, false);
+    return value;
+}
+
+static uint8_t watch_write_hook(void *userdata, uint16_t addr, uint8_t value) {
+    watch_context_t *context = userdata;
+    if(context->next_write) value = context->next_write(context->next_userdata, addr, value);
+
+    check_memory_watch(context, addr, context->chip8->ram[addr], value, true);
+    return value;
+}
+
+// Run one instruction with the watchpoints hooked in, the previous hooks are put back afterwards
+static void watched_step(debugger_t *dbg, chip8_t *chip8) {
+    watch_context_t context = {
+        .dbg = dbg,
+        .chip8 = chip8,
+        .pc = chip8->PC,
+        .next_read = chip8->read_hook,
+        .next_write = chip8->write_hook,
+        .next_userdata = chip8->hook_userdata,
+    };
+
+    chip8_set_memory_hooks(chip8, watch_read_hook, watch_write_hook, &context);
+    chip8_step(chip8);
+    chip8_set_memory_hooks(chip8, context.next_read, context.next_write, context.next_userdata);
+
+    for(size_t i = 0; i < dbg->watchpoint_count && !dbg->watch_hit.hit; i++) {
+        const watchpoint_t *watch = &dbg->watchpoints[i];
+        const uint16_t value = watch_value(watch, chip8);
+
+        if(watch->target != WATCH_MEMORY && value != watch->last) {
+            dbg->watch_hit = (watch_hit_t) {
+                .hit = true, .index = i, .pc = context.pc, .old_value = watch->last, .value = value,
+            };
+        }
+    }
+}
+
+// Execute one instruction, ticking the timers at the configured CPU speed
+// Returns false if the ROM exited, faulted or hit a watchpoint
+bool debugger_step(debugger_t *dbg, chip8_t *chip8) {
+    dbg->watch_hit.hit = false;
+
+    if(dbg->watchpoint_count > 0) watched_step(dbg, chip8);
+    else chip8_step(chip8);
+
+    if(++dbg->frame_steps >= dbg->steps_per_frame) {
+        chip8_update_timers(chip8);
+        dbg->frame_steps = 0;
+    }
+
+    // Taken after the timer tick so counting down doesn't trigger the timer watchpoints
+    for(size_t i = 0; i < dbg->watchpoint_count; i++)
+        dbg->watchpoints[i].last = watch_value(&dbg->watchpoints[i], chip8);
+
+    return chip8->state != QUIT && !dbg->watch_hit.hit;
+}
+
+static void report_watch(const debugger_t *dbg, const chip8_t *chip8) {
+    if(!dbg->watch_hit.hit) return;
+
+    char text[128];
+    debugger_describe_hit(dbg, chip8, text, sizeof text);
+    puts(text);
+}
+
+static void print_sprite(const chip8_t *chip8, uint8_t rows) {
+    debugger_sprite_t sprite;
+    debugger_sprite(chip8, rows, &sprite);
+
+    printf("Sprite at I = 0x%04X, %ux%u%s\n", sprite.addr, sprite.width, sprite.rows,
+           sprite.at_draw ? " for the DXYN at PC" : "");
+    for(uint32_t row = 0; row < sprite.rows; row++) {
+        printf("  0x%04X  %0*X  ", (sprite.addr + row * sprite.width / 8) % chip8->ram_size, sprite.width / 4,
+               sprite.bits[row]);
+        for(int bit = sprite.width - 1; bit >= 0; bit--) putchar(sprite.bits[row] >> bit & 1 ? '#' : '.');
+        putchar('\n');
+    }
+
+    char bcd[32];
+    debugger_describe_bcd(chip8, bcd, sizeof bcd);
+    printf("BCD at I: %s\n", bcd);
+}
+
+// The timers keep ticking 60 times per emulated second at the new speed
+static void speed_command(debugger_t *dbg, chip8_t *chip8, const char *arg) {
+    uint32_t speed = 0;
+
+    if(arg) {
+        if(!parse_number(arg, 10, 100000000, &speed)) return;
+        if(speed < 60) {
+            puts("The speed can't be less than 60 instructions per second");
+            return;
+        }
+
+        chip8_set_speed(chip8, speed);
+        dbg->steps_per_frame = speed / 60;
+        dbg->frame_steps = 0;
+    }
+
+    printf("Speed %u instructions per second\n", chip8->insts_per_second);
+}
+
+// Quirks change between two instructions, the ROM goes on from where it was
+static void quirk_command(chip8_t *chip8, const char *name, const char *value) {
+    if(!name) {
+        for(size_t i = 0; i < CHIP8_QUIRK_COUNT; i++)
+            printf("  %-13s %s\n", chip8_quirk_name(i), chip8_quirk_enabled(&chip8->quirks, i) ? "on" : "off");
+        return;
+    }
+
+    size_t index = 0;
+    while(index < CHIP8_QUIRK_COUNT && strcmp(chip8_quirk_name(index), name) != 0) index++;
+    if(index == CHIP8_QUIRK_COUNT) {
+        printf("Unknown quirk %s, 'quirk' lists them\n", name);
+        return;
+    }
+    if(value && strcmp(value, "0") != 0 && strcmp(value, "1") != 0) {
+        puts("Usage: quirk <name> [0|1]");
+        return;
+    }
+
+    const bool enabled = value ? value[0] == '1' : !chip8_quirk_enabled(&chip8->quirks, index);
+    chip8_set_quirk(&chip8->quirks, name, enabled);
+    printf("Quirk %s %s\n", name, enabled ? "on" : "off");
+}
+
+// Show a fault and stay in the debugger, the machine is stopped at the faulting instruction
+static void report_fault(chip8_t *chip8) {
+    if(chip8->fault == CHIP8_FAULT_NONE) return;
+
+    chip8_print_fault(chip8, stdout);
+    chip8_clear_fault(chip8);
+}
+
+// Run until a breakpoint or Ctrl-C, and with a stop_depth of 0 or more until the call depth is
+// down to it
+static void debugger_continue(debugger_t *dbg, chip8_t *chip8, int stop_depth) {
+    interrupted = 0;
+    signal(SIGINT, debugger_interrupt);
+
+    // Always execute the current instruction, even when it has a breakpoint
+    while(debugger_step(dbg, chip8)) {
+        if(debugger_should_break(dbg, chip8)) {
+            char location[SYMBOLS_NAME_SIZE + SYMBOLS_SOURCE_SIZE + 32];
+            debugger_location(dbg, chip8->PC, location, sizeof location);
+            printf("Breakpoint at 0x%04X%s\n", chip8->PC, location);
+            break;
+        }
+
+        if(stop_depth >= 0 && debugger_call_depth(chip8) <= (size_t)stop_depth) break;
+
+        if(interrupted) {
+            printf("Paused at 0x%04X\n", chip8->PC);
+            break;
+        }
+    }
+
+    signal(SIGINT, SIG_DFL);
+}
+
+void debugger_repl(chip8_t *chip8, const config_t *config) {
+    debugger_t dbg;
+    cheat_list_t cheats;
+    char line[256];
+
+    debugger_init(&dbg, config);
+    if(!config->cheat_path || !cheat_load_file(&cheats, config->cheat_path, false)) cheat_init(&cheats);
+    if(cheats.count > 0) cheat_attach(&cheats, chip8);
+
+    printf("Debugging %s, type 'help' for a list of commands\n", chip8->rom_name);
+    report_fault(chip8);
+    print_registers(&dbg, chip8);
+
+    while(chip8->state != QUIT) {
+        printf("(chip8) ");
+        fflush(stdout);
+
+        if(!fgets(line, sizeof line, stdin)) break;
+
+        const char *cmd = strtok(line, " \t\r\n");
+        const char *arg1 = strtok(NULL, " \t\r\n");
+        const char *arg2 = strtok(NULL, " \t\r\n");
+        char *rest = strtok(NULL, "\r\n");
+        uint32_t value = 0;
+        uint32_t len = 0;
+        uint16_t addr = 0;
+
+        if(!cmd) continue;
+
+        if(strcmp(cmd, "s") == 0 || strcmp(cmd, "step") == 0) {
+            uint32_t count = 1;
+            if(arg1 && !parse_number(arg1, 10, UINT32_MAX, &count)) continue;
+
+            for(uint32_t i = 0; i < count && debugger_step(&dbg, chip8); i++)
+                ;
+            report_watch(&dbg, chip8);
+            report_fault(chip8);
+            print_registers(&dbg, chip8);
+        } else if(strcmp(cmd, "c") == 0 || strcmp(cmd, "continue") == 0) {
+            debugger_continue(&dbg, chip8, -1);
+            report_watch(&dbg, chip8);
+            report_fault(chip8);
+            print_registers(&dbg, chip8);
+        } else if(strcmp(cmd, "n") == 0 || strcmp(cmd, "next") == 0) {
+            // Anything but a call is a single step
+            if(debugger_at_call(chip8)) debugger_continue(&dbg, chip8, debugger_call_depth(chip8));
+            else debugger_step(&dbg, chip8);
+            report_watch(&dbg, chip8);
+            report_fault(chip8);
+            print_registers(&dbg, chip8);
+        } else if(strcmp(cmd, "fin") == 0 || strcmp(cmd, "finish") == 0) {
+            if(debugger_call_depth(chip8) == 0) {
+                puts("Not in a subroutine");
+                continue;
+            }
+            debugger_continue(&dbg, chip8, debugger_call_depth(chip8) - 1);
+            report_watch(&dbg, chip8);
+            report_fault(chip8);
+            print_registers(&dbg, chip8);
+        } else if(strcmp(cmd, "b") == 0 || strcmp(cmd, "break") == 0) {
+            if(parse_address(&dbg, arg1, &addr)) add_breakpoint(&dbg, addr, arg2, rest);
+        } else if(strcmp(cmd, "d") == 0 || strcmp(cmd, "delete") == 0) {
+            if(parse_address(&dbg, arg1, &addr)) delete_breakpoint(&dbg, addr);
+        } else if(strcmp(cmd, "bl") == 0 || strcmp(cmd, "breakpoints") == 0) {
+            print_breakpoints(&dbg);
+        } else if(strcmp(cmd, "w") == 0 || strcmp(cmd, "watch") == 0) {
+            add_watchpoint(&dbg, chip8, arg1, arg2);
+        } else if(strcmp(cmd, "wl") == 0 || strcmp(cmd, "watchpoints") == 0) {
+            print_watchpoints(&dbg);
+        } else if(strcmp(cmd, "unwatch") == 0) {
+            if(!parse_number(arg1, 10, UINT32_MAX, &value)) continue;
+            if(debugger_delete_watchpoint(&dbg, value)) printf("Watchpoint %u deleted\n", value);
+            else printf("No watchpoint %u\n", value);
+        } else if(strcmp(cmd, "r") == 0 || strcmp(cmd, "regs") == 0) {
+            print_registers(&dbg, chip8);
+        } else if((strcmp(cmd, "m") == 0 || strcmp(cmd, "mem") == 0) && arg1 && strcmp(arg1, "write") == 0) {
+            write_memory(chip8, arg2, rest);
+        } else if(strcmp(cmd, "m") == 0 || strcmp(cmd, "mem") == 0) {
+            // "mem read <addr> [len]" and the shorter "mem <addr> [len]"
+            if(arg1 && strcmp(arg1, "read") == 0) {
+                arg1 = arg2;
+                arg2 = rest ? strtok(rest, " \t") : NULL;
+            }
+
+            len = 64;
+            if(!parse_address(&dbg, arg1, &addr)) continue;
+            if(arg2 && !parse_number(arg2, 10, chip8->ram_size, &len)) continue;
+            print_memory(chip8, addr, len);
+        } else if(strcmp(cmd, "st") == 0 || strcmp(cmd, "stack") == 0) {
+            print_stack(&dbg, chip8);
+        } else if(strcmp(cmd, "disp") == 0 || strcmp(cmd, "display") == 0) {
+            print_display(chip8);
+        } else if(strcmp(cmd, "k") == 0 || strcmp(cmd, "key") == 0) {
+            if(!parse_number(arg1, 16, 0xF, &value)) continue;
+            if(!arg2 || (strcmp(arg2, "0") != 0 && strcmp(arg2, "1") != 0)) {
+                puts("Usage: key <k> <0|1>");
+                continue;
+            }
+            chip8_set_key(chip8, value, arg2[0] == '1');
+        } else if(strcmp(cmd, "spr") == 0 || strcmp(cmd, "sprite") == 0) {
+            value = 15;
+            if(arg1 && !parse_number(arg1, 10, 16, &value)) continue;
+            if(value == 0) {
+                puts("A sprite has 1 to 16 rows");
+                continue;
+            }
+            print_sprite(chip8, value);
+        } else if(strcmp(cmd, "speed") == 0) {
+            speed_command(&dbg, chip8, arg1);
+        } else if(strcmp(cmd, "quirk") == 0 || strcmp(cmd, "quirks") == 0) {
+            quirk_command(chip8, arg1, arg2);
+        } else if(strcmp(cmd, "freeze") == 0 || strcmp(cmd, "poke") == 0) {
+            add_cheat(&cheats, chip8, cmd[0] == 'f', arg1, arg2, rest);
+        } else if(strcmp(cmd, "cheats") == 0) {
+            print_cheats(&cheats);
+        } else if(strcmp(cmd, "cheat") == 0) {
+            cheat_command(&cheats, chip8, config, arg1, arg2);
+        } else if(strcmp(cmd, "h") == 0 || strcmp(cmd, "help") == 0) {
+            print_help();
+        } else if(strcmp(cmd, "q") == 0 || strcmp(cmd, "quit") == 0) {
+            break;
+        } else {
+            printf("Unknown command %s, type 'help' for a list of commands\n", cmd);
+        }
+    }
+
+    if(chip8->state == QUIT) puts("Program exited");
+    chip8_set_memory_hooks(chip8, NULL, NULL, NULL);    // Unhook the cheats
+    debugger_free(&dbg);
+}
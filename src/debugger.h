@@ -0,0 +1,113 @@
+#ifndef DEBUGGER_H
+#define DEBUGGER_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "config.h"
+#include "symbols.h"
+
+#define DEBUGGER_MAX_BREAKPOINTS 32
+#define DEBUGGER_MAX_WATCHPOINTS 16
+#define DEBUGGER_CONDITION_SIZE 96
+
+typedef enum {
+    WATCH_MEMORY,   // Reads and/or writes to an address range
+    WATCH_V,        // Value changes of a V register
+    WATCH_I,
+    WATCH_DT,
+    WATCH_ST,
+} watch_target_t;
+
+typedef struct {
+    watch_target_t target;
+    uint8_t reg;                // V register for WATCH_V
+    uint16_t start, end;        // Inclusive address range for WATCH_MEMORY
+    bool on_read, on_write;
+    uint16_t last;              // Register value before the current instruction
+} watchpoint_t;
+
+// What stopped the last debugger_step at a watchpoint
+typedef struct {
+    bool hit;
+    size_t index;               // Watchpoint that triggered
+    uint16_t pc;                // Address of the instruction responsible
+    bool write;                 // Memory watchpoints, the access was a write
+    uint16_t addr;              // Memory watchpoints, the address accessed
+    uint16_t old_value, value;
+} watch_hit_t;
+
+// Debugger session state shared by the REPL and TUI frontends
+typedef struct {
+    uint16_t breakpoints[DEBUGGER_MAX_BREAKPOINTS];
+    char conditions[DEBUGGER_MAX_BREAKPOINTS][DEBUGGER_CONDITION_SIZE];   // Empty for unconditional breakpoints
+    uint32_t hits[DEBUGGER_MAX_BREAKPOINTS];                                // Times PC reached each breakpoint
+    size_t breakpoint_count;
+    watchpoint_t watchpoints[DEBUGGER_MAX_WATCHPOINTS];
+    size_t watchpoint_count;
+    watch_hit_t watch_hit;
+    uint32_t steps_per_frame;   // Instructions between 60Hz timer ticks
+    uint32_t frame_steps;       // Instructions run since the last timer tick
+    symbols_t symbols;          // Labels and source lines of the ROM, empty if it has none
+} debugger_t;
+
+// Loads the ROM's symbols, debugger_free() lets go of them
+void debugger_init(debugger_t *dbg, const config_t *config);
+void debugger_free(debugger_t *dbg);
+bool debugger_step(debugger_t *dbg, chip8_t *chip8);
+bool debugger_is_breakpoint(const debugger_t *dbg, uint16_t addr);
+bool debugger_add_breakpoint(debugger_t *dbg, uint16_t addr);
+bool debugger_delete_breakpoint(debugger_t *dbg, uint16_t addr);
+
+// A label from the symbols or a hex address
+bool debugger_parse_address(const debugger_t *dbg, const char *str, uint16_t *addr);
+
+// " draw+4 (game.o8:12)" for an address in labeled code, empty without symbols
+void debugger_location(const debugger_t *dbg, uint16_t addr, char *text, size_t size);
+
+// Conditions are C like expressions over v[0]-v[15] (or v0-vf), i, pc, dt, st, sp (call depth),
+// mem[addr] and hits (times PC reached the breakpoint, this time included), e.g.
+// "v[3] == 0x1F && dt == 0" or "hits % 10 == 0"
+bool debugger_check_condition(const char *condition, char *error, size_t size);
+bool debugger_set_condition(debugger_t *dbg, uint16_t addr, const char *condition);
+const char *debugger_condition(const debugger_t *dbg, uint16_t addr);
+
+// Counts the hit of a breakpoint at PC and evaluates its condition, true if execution should stop
+bool debugger_should_break(debugger_t *dbg, const chip8_t *chip8);
+
+// Step over and step out work on the call depth: "next" at a 2NNN call runs until the depth is
+// back where it was, "finish" until it is one less
+size_t debugger_call_depth(const chip8_t *chip8);
+bool debugger_at_call(const chip8_t *chip8);
+
+// Watchpoints stop debugger_step after the instruction that triggered them and fill in watch_hit
+// Register watchpoints only see changes made by instructions, not the 60Hz timer ticks
+bool debugger_add_watchpoint(debugger_t *dbg, const chip8_t *chip8, watchpoint_t watch);
+bool debugger_delete_watchpoint(debugger_t *dbg, size_t index);
+void debugger_describe_watchpoint(const watchpoint_t *watch, char *text, size_t size);
+void debugger_describe_hit(const debugger_t *dbg, const chip8_t *chip8, char *text, size_t size);
+
+// The sprite at I, as the DXYN at PC would draw it from there. Without a DXYN at PC the rows are
+// default_rows, 8 pixels wide. Only the first plane of XO-CHIP's two plane sprites is read
+typedef struct {
+    uint16_t addr;              // I
+    uint8_t rows;               // 1-16
+    uint8_t width;              // 8, or 16 for DXY0
+    bool at_draw;               // The instruction at PC is the DXYN
+    uint16_t bits[16];          // One row each, the leftmost pixel in bit width - 1
+} debugger_sprite_t;
+
+void debugger_sprite(const chip8_t *chip8, uint8_t default_rows, debugger_sprite_t *sprite);
+
+// The 3 bytes at I as FX33 leaves them, "1 2 8", and " <- V3 = 128" when the FX33 at PC is about to write them
+void debugger_describe_bcd(const chip8_t *chip8, char *text, size_t size);
+
+// Interactive debugger REPL on stdin/stdout, returns when the user quits or the ROM exits
+void debugger_repl(chip8_t *chip8, const config_t *config);
+
+// Full screen terminal debugger, see tui.c
+bool debugger_tui(chip8_t *chip8, const config_t *config);
+
+#endif // DEBUGGER_H
@@ -0,0 +1,501 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "disasm.h"
+
+// Code map flags for disasm_program()
+#define CODE_START 0x1  // First byte of an instruction
+#define CODE_PART  0x2  // Remaining bytes of an instruction
+
+// Mnemonic in raw or Octo syntax, both formats take the same operands in the same order
+#define EMIT(raw, octo, ...) snprintf(buf, size, syntax == DISASM_OCTO ? (octo) : (raw), __VA_ARGS__)
+#define EMIT0(raw, octo)     snprintf(buf, size, "%s", syntax == DISASM_OCTO ? (octo) : (raw))
+
+// Name for addr, or the plain address if it has no label. Names from symbols come first,
+// where labels are given only for addresses that get a label line
+static void label_name(const uint8_t *labels, const symbols_t *symbols, uint16_t addr, char *buf, size_t size) {
+    const disasm_label_t kind = labels ? labels[addr] : DISASM_LABEL_NONE;
+    const char *symbol = !labels || kind != DISASM_LABEL_NONE ? symbols_name(symbols, addr) : NULL;
+
+    if(symbol) {
+        snprintf(buf, size, "%s", symbol);
+        return;
+    }
+
+    if(kind != DISASM_LABEL_NONE && addr == CHIP8_ENTRY_POINT) {
+        snprintf(buf, size, "main");
+        return;
+    }
+
+    switch(kind) {
+        case DISASM_LABEL_SUB:  snprintf(buf, size, "sub_%03X", addr); break;
+        case DISASM_LABEL_JUMP: snprintf(buf, size, "label_%03X", addr); break;
+        case DISASM_LABEL_DATA: snprintf(buf, size, "data_%03X", addr); break;
+        default:                snprintf(buf, size, "0x%03X", addr); break;
+    }
+}
+
+// Mega-Chip instructions 0010-09NN, returns their length or 0 for other opcodes
+// Octo has no syntax for them, they're written as the same bytes there
+static uint8_t decode_mega(uint16_t opcode, uint16_t next, disasm_syntax_t syntax, char *buf, size_t size) {
+    const uint8_t NN = opcode & 0x0FF;
+
+    if((opcode & 0xFF00) == 0x0100) {
+        if(syntax == DISASM_OCTO) snprintf(buf, size, "0x01 0x%02X 0x%02X 0x%02X", NN, next >> 8, next & 0xFF);
+        else                      snprintf(buf, size, "LDHI 0x%06X", (uint32_t)NN << 16 | next);
+        return 4;
+    }
+
+    switch(opcode >> 8) {
+        case 0x00:
+            if(opcode == 0x0010)            snprintf(buf, size, "MEGAOFF");
+            else if(opcode == 0x0011)       snprintf(buf, size, "MEGAON");
+            else if((NN & 0xF0) == 0xB0)    snprintf(buf, size, "SCRU %u", NN & 0xF);
+            else                            return 0;
+            break;
+
+        case 0x02: snprintf(buf, size, "LDPAL %u", NN); break;
+        case 0x03: snprintf(buf, size, "SPRW %u", NN); break;
+        case 0x04: snprintf(buf, size, "SPRH %u", NN); break;
+        case 0x05: snprintf(buf, size, "ALPHA %u", NN); break;
+        case 0x06: if(NN > 0x01) return 0; snprintf(buf, size, "DIGISND %u", NN); break;
+        case 0x07: if(NN != 0x00) return 0; snprintf(buf, size, "STOPSND"); break;
+        case 0x08: if(NN > 0x05) return 0; snprintf(buf, size, "BMODE %u", NN); break;
+        case 0x09: snprintf(buf, size, "CCOL %u", NN); break;
+        default:   return 0;
+    }
+
+    if(syntax == DISASM_OCTO) snprintf(buf, size, "0x%02X 0x%02X", opcode >> 8, NN);
+    return 2;
+}
+
+// Decode opcode, valid is set to false for opcodes that aren't instructions
+static uint8_t decode(uint16_t opcode, uint16_t next, disasm_syntax_t syntax, const uint8_t *labels,
+                      const symbols_t *symbols, char *buf, size_t size, bool *valid) {
+    const uint16_t NNN = opcode & 0x0FFF;
+    const uint8_t NN = opcode & 0x0FF;
+    const uint8_t N = opcode & 0x0F;
+    const uint8_t X = (opcode >> 8) & 0x0F;
+    const uint8_t Y = (opcode >> 4) & 0x0F;
+    char addr[SYMBOLS_NAME_SIZE];
+
+    label_name(labels, symbols, NNN, addr, sizeof addr);
+    *valid = true;
+
+    // Mega-Chip instructions are 0NNN machine code calls to everything else
+    const uint8_t mega = decode_mega(opcode, next, syntax, buf, size);
+    if(mega) return mega;
+
+    switch((opcode >> 12) & 0x0F) {
+        case 0x00:
+            if(opcode == 0x00E0)                 EMIT0("CLS", "clear");
+            else if(opcode == 0x00EE)            EMIT0("RET", "return");
+            else if((opcode & 0xFFF0) == 0x00C0) EMIT("SCD %u", "scroll-down %u", N);
+            else if((opcode & 0xFFF0) == 0x00D0) EMIT("SCU %u", "scroll-up %u", N);
+            else if(opcode == 0x00FB)            EMIT0("SCR", "scroll-right");
+            else if(opcode == 0x00FC)            EMIT0("SCL", "scroll-left");
+            else if(opcode == 0x00FD)            EMIT0("EXIT", "exit");
+            else if(opcode == 0x00FE)            EMIT0("LOW", "lores");
+            else if(opcode == 0x00FF)            EMIT0("HIGH", "hires");
+            else if(syntax == DISASM_OCTO)       snprintf(buf, size, "0x%02X 0x%02X", opcode >> 8, NN); // No machine code calls in Octo
+            else                                 snprintf(buf, size, "SYS %s", addr);
+            break;
+
+        case 0x01: EMIT("JP %s", "jump %s", addr); break;
+        case 0x02:
+            // Octo calls labeled subroutines by name
+            if(labels ? labels[NNN] != DISASM_LABEL_NONE : symbols_name(symbols, NNN) != NULL) EMIT("CALL %s", "%s", addr);
+            else EMIT("CALL %s", ":call %s", addr);
+            break;
+        case 0x03: EMIT("SE V%X, 0x%02X", "if v%x != 0x%02X then", X, NN); break;
+        case 0x04: EMIT("SNE V%X, 0x%02X", "if v%x == 0x%02X then", X, NN); break;
+
+        case 0x05:
+            if(N == 0)      EMIT("SE V%X, V%X", "if v%x != v%x then", X, Y);
+            else if(N == 2) EMIT("SAVE V%X-V%X", "save v%x - v%x", X, Y);
+            else if(N == 3) EMIT("LOAD V%X-V%X", "load v%x - v%x", X, Y);
+            else            *valid = false;
+            break;
+
+        case 0x06: EMIT("LD V%X, 0x%02X", "v%x := 0x%02X", X, NN); break;
+        case 0x07: EMIT("ADD V%X, 0x%02X", "v%x += 0x%02X", X, NN); break;
+
+        case 0x08:
+            switch(N) {
+                case 0x0: EMIT("LD V%X, V%X", "v%x := v%x", X, Y); break;
+                case 0x1: EMIT("OR V%X, V%X", "v%x |= v%x", X, Y); break;
+                case 0x2: EMIT("AND V%X, V%X", "v%x &= v%x", X, Y); break;
+                case 0x3: EMIT("XOR V%X, V%X", "v%x ^= v%x", X, Y); break;
+                case 0x4: EMIT("ADD V%X, V%X", "v%x += v%x", X, Y); break;
+                case 0x5: EMIT("SUB V%X, V%X", "v%x -= v%x", X, Y); break;
+                case 0x6: EMIT("SHR V%X, V%X", "v%x >>= v%x", X, Y); break;
+                case 0x7: EMIT("SUBN V%X, V%X", "v%x =- v%x", X, Y); break;
+                case 0xE: EMIT("SHL V%X, V%X", "v%x <<= v%x", X, Y); break;
+                default:  *valid = false; break;
+            }
+            break;
+
+        case 0x09:
+            if(N == 0) EMIT("SNE V%X, V%X", "if v%x == v%x then", X, Y);
+            else       *valid = false;
+            break;
+
+        case 0x0A: EMIT("LD I, %s", "i := %s", addr); break;
+        case 0x0B: EMIT("JP V0, %s", "jump0 %s", addr); break;
+        case 0x0C: EMIT("RND V%X, 0x%02X", "v%x := random 0x%02X", X, NN); break;
+        case 0x0D: EMIT("DRW V%X, V%X, %u", "sprite v%x v%x %u", X, Y, N); break;
+
+        case 0x0E:
+            if(NN == 0x9E)      EMIT("SKP V%X", "if v%x -key then", X);
+            else if(NN == 0xA1) EMIT("SKNP V%X", "if v%x key then", X);
+            else                *valid = false;
+            break;
+
+        case 0x0F:
+            switch(NN) {
+                case 0x00:
+                    if(X != 0) {
+                        *valid = false;
+                        break;
+                    }
+                    label_name(labels, symbols, next, addr, sizeof addr);
+                    EMIT("LD I, LONG %s", "i := long %s", addr);
+                    return 4;
+
+                case 0x01: EMIT("PLANE %u", "plane %u", X); break;
+                case 0x02:
+                    if(X == 0) EMIT0("AUDIO", "audio");
+                    else       *valid = false;
+                    break;
+
+                case 0x07: EMIT("LD V%X, DT", "v%x := delay", X); break;
+                case 0x0A: EMIT("LD V%X, K", "v%x := key", X); break;
+                case 0x15: EMIT("LD DT, V%X", "delay := v%x", X); break;
+                case 0x18: EMIT("LD ST, V%X", "buzzer := v%x", X); break;
+                case 0x1E: EMIT("ADD I, V%X", "i += v%x", X); break;
+                case 0x29: EMIT("LD F, V%X", "i := hex v%x", X); break;
+                case 0x30: EMIT("LD HF, V%X", "i := bighex v%x", X); break;
+                case 0x33: EMIT("LD B, V%X", "bcd v%x", X); break;
+                case 0x3A: EMIT("PITCH V%X", "pitch := v%x", X); break;
+                case 0x55: EMIT("LD [I], V%X", "save v%x", X); break;
+                case 0x65: EMIT("LD V%X, [I]", "load v%x", X); break;
+                case 0x75: EMIT("LD R, V%X", "saveflags v%x", X); break;
+                case 0x85: EMIT("LD V%X, R", "loadflags v%x", X); break;
+                default:   *valid = false; break;
+            }
+            break;
+
+        default:
+            break;
+    }
+
+    // Not an instruction, print it as data
+    if(!*valid && syntax == DISASM_OCTO) snprintf(buf, size, "0x%02X 0x%02X", opcode >> 8, NN);
+    else if(!*valid)                     snprintf(buf, size, "dw 0x%04X", opcode);
+
+    return 2;
+}
+
+uint8_t disasm_instruction(uint16_t opcode, uint16_t next, disasm_syntax_t syntax,
+                           const uint8_t *labels, char *buf, size_t size) {
+    return disasm_instruction_named(opcode, next, syntax, labels, NULL, buf, size);
+}
+
+uint8_t disasm_instruction_named(uint16_t opcode, uint16_t next, disasm_syntax_t syntax,
+                                 const uint8_t *labels, const symbols_t *symbols, char *buf, size_t size) {
+    bool valid;
+    return decode(opcode, next, syntax, labels, symbols, buf, size, &valid);
+}
+
+static void set_label(uint8_t *labels, uint32_t addr, uint32_t end, disasm_label_t kind) {
+    if(addr < CHIP8_ENTRY_POINT || addr >= end) return;
+
+    if(labels[addr] < kind) labels[addr] = kind;
+}
+
+// Conditional skips, the next instruction runs or is skipped
+static bool is_skip(uint16_t opcode) {
+    return ((opcode & 0xF000) == 0x3000) || ((opcode & 0xF000) == 0x4000) ||
+           ((opcode & 0xF00F) == 0x5000) || ((opcode & 0xF00F) == 0x9000) ||
+           ((opcode & 0xF0FF) == 0xE09E) || ((opcode & 0xF0FF) == 0xE0A1);
+}
+
+// Instructions after which execution doesn't continue with the next one
+static bool ends_path(uint16_t opcode) {
+    return (opcode & 0xF000) == 0x1000 || (opcode & 0xF000) == 0xB000 || opcode == 0x00EE || opcode == 0x00FD;
+}
+
+// Length of the instruction a skip at addr jumps over, next is the word after the skip
+// F000 NNNN and 01NN NNNN are skipped as a whole
+static uint32_t skipped_length(uint32_t addr, uint32_t end, uint16_t next) {
+    return addr + 2 < end && (next == 0xF000 || (next & 0xFF00) == 0x0100) ? 4 : 2;
+}
+
+// Follow all code paths from the entry point, marking instructions in code and targets in labels
+static void trace_code(const uint8_t *ram, uint32_t end, uint8_t *code, uint8_t *labels, uint32_t *pending) {
+    size_t pending_count = 0;
+    pending[pending_count++] = CHIP8_ENTRY_POINT;
+
+    while(pending_count > 0) {
+        uint32_t addr = pending[--pending_count];
+
+        // Walk straight line code until the path ends or joins already traced code
+        while(addr >= CHIP8_ENTRY_POINT && addr + 1 < end && !(code[addr] & (CODE_START | CODE_PART))) {
+            const uint16_t opcode = (ram[addr] << 8) | ram[addr + 1];
+            const uint16_t next = addr + 3 < end ? (ram[addr + 2] << 8) | ram[addr + 3] : 0;
+            const uint16_t NNN = opcode & 0x0FFF;
+            char buf[32];
+            bool valid;
+
+            const uint8_t len = decode(opcode, next, DISASM_RAW, NULL, NULL, buf, sizeof buf, &valid);
+            if(!valid || addr + len > end) break;
+
+            code[addr] = CODE_START;
+            for(uint8_t i = 1; i < len; i++) code[addr + i] = CODE_PART;
+
+            if((opcode & 0xF000) == 0x1000) {
+                set_label(labels, NNN, end, DISASM_LABEL_JUMP);
+                pending[pending_count++] = NNN;
+            } else if((opcode & 0xF000) == 0x2000) {
+                set_label(labels, NNN, end, DISASM_LABEL_SUB);
+                pending[pending_count++] = NNN;
+            } else if((opcode & 0xF000) == 0xB000) {
+                // Computed jump, the table at NNN can't be followed statically
+                set_label(labels, NNN, end, DISASM_LABEL_JUMP);
+            } else if((opcode & 0xF000) == 0xA000) {
+                set_label(labels, NNN, end, DISASM_LABEL_DATA);
+            } else if(opcode == 0xF000) {
+                set_label(labels, next, end, DISASM_LABEL_DATA);
+            } else if(is_skip(opcode)) {
+                // Either the next instruction runs or it is skipped
+                pending[pending_count++] = addr + len + skipped_length(addr, end, next);
+            }
+
+            if(ends_path(opcode)) break;
+            addr += len;
+        }
+    }
+}
+
+// A ROM traced from the entry point, the maps are indexed by address
+typedef struct {
+    uint32_t end;
+    uint8_t *ram;       // Has room to read a word past the end
+    uint8_t *code;      // Same, for the length of the last instruction
+    uint8_t *labels;
+    uint32_t *pending;  // Each traced instruction adds at most 1 pending path
+} program_t;
+
+static void free_program(program_t *program) {
+    free(program->ram);
+    free(program->code);
+    free(program->labels);
+    free(program->pending);
+}
+
+static bool analyze_program(const uint8_t *rom, size_t rom_size, const symbols_t *symbols, program_t *program) {
+    const uint32_t end = CHIP8_ENTRY_POINT + rom_size;
+    if(end > CHIP8_XO_RAM_SIZE) {
+        fprintf(stderr, "ROM is too large to disassemble, max size is %u bytes\n",
+                CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT);
+        return false;
+    }
+
+    *program = (program_t){
+        .end = end,
+        .ram = calloc(CHIP8_XO_RAM_SIZE + 4, 1),
+        .code = calloc(CHIP8_XO_RAM_SIZE + 4, 1),
+        .labels = calloc(CHIP8_XO_RAM_SIZE, 1),
+        .pending = calloc(CHIP8_XO_RAM_SIZE + 1, sizeof *program->pending),
+    };
+
+    if(!program->ram || !program->code || !program->labels || !program->pending) {
+        fprintf(stderr, "Out of memory\n");
+        free_program(program);
+        return false;
+    }
+
+    for(size_t i = 0; i < rom_size; i++) program->ram[CHIP8_ENTRY_POINT + i] = rom[i];
+
+    trace_code(program->ram, end, program->code, program->labels, program->pending);
+    set_label(program->labels, CHIP8_ENTRY_POINT, end, DISASM_LABEL_JUMP);
+    for(size_t i = 0; symbols && i < symbols->label_count; i++)
+        set_label(program->labels, symbols->labels[i].addr, end, DISASM_LABEL_DATA);
+
+    // Targets inside another instruction can't get a label line, refer to them by address
+    for(uint32_t addr = CHIP8_ENTRY_POINT; addr < end; addr++)
+        if(program->code[addr] == CODE_PART) program->labels[addr] = DISASM_LABEL_NONE;
+
+    return true;
+}
+
+bool disasm_program(const uint8_t *rom, size_t rom_size, disasm_syntax_t syntax, const symbols_t *symbols, FILE *out) {
+    program_t program;
+    if(!analyze_program(rom, rom_size, symbols, &program)) return false;
+
+    const uint32_t end = program.end;
+    const uint8_t *ram = program.ram;
+    const uint8_t *code = program.code;
+    const uint8_t *labels = program.labels;
+
+    const char *comment = syntax == DISASM_OCTO ? "#" : ";";
+    uint32_t addr = CHIP8_ENTRY_POINT;
+
+    while(addr < end) {
+        char name[SYMBOLS_NAME_SIZE];
+        char line[64];
+
+        if(labels[addr] != DISASM_LABEL_NONE) {
+            label_name(labels, symbols, addr, name, sizeof name);
+            fprintf(out, syntax == DISASM_OCTO ? "\n: %s\n" : "\n%s:\n", name);
+        }
+
+        if(code[addr] == CODE_START) {
+            const uint16_t opcode = (ram[addr] << 8) | ram[addr + 1];
+            const uint16_t next = (ram[addr + 2] << 8) | ram[addr + 3];
+            const uint8_t len = disasm_instruction_named(opcode, next, syntax, labels, symbols, line, sizeof line);
+
+            if(len == 4) fprintf(out, "    %-28s %s %04X: %04X %04X\n", line, comment, addr, opcode, next);
+            else         fprintf(out, "    %-28s %s %04X: %04X\n", line, comment, addr, opcode);
+
+            addr += len;
+            continue;
+        }
+
+        // Data runs up to 8 bytes, broken at labels and code
+        const uint32_t start = addr;
+        int len = snprintf(line, sizeof line, "%s", syntax == DISASM_OCTO ? "" : "db ");
+
+        do {
+            const char *sep = addr == start ? "" : syntax == DISASM_OCTO ? " " : ", ";
+            len += snprintf(&line[len], sizeof line - len, "%s0x%02X", sep, ram[addr]);
+            addr++;
+        } while(addr < end && addr - start < 8 && code[addr] != CODE_START && labels[addr] == DISASM_LABEL_NONE);
+
+        fprintf(out, "    %-28s %s %04X\n", line, comment, start);
+    }
+
+    free_program(&program);
+    return true;
+}
+
+static uint16_t program_word(const program_t *program, uint32_t addr) {
+    return (program->ram[addr] << 8) | program->ram[addr + 1];
+}
+
+static bool is_code(const program_t *program, uint32_t addr) {
+    return addr < program->end && program->code[addr] == CODE_START;
+}
+
+// Address of the last instruction of the basic block at start
+static uint32_t block_last(const program_t *program, const uint8_t *leaders, uint32_t start) {
+    uint32_t addr = start;
+
+    for(;;) {
+        const uint16_t opcode = program_word(program, addr);
+        const uint32_t next = addr + ((program->code[addr + 2] == CODE_PART) ? 4 : 2);
+
+        if(ends_path(opcode) || is_skip(opcode) || !is_code(program, next) || leaders[next]) return addr;
+        addr = next;
+    }
+}
+
+// Text for a DOT string, quotes and backslashes escaped
+static void write_dot_text(FILE *out, const char *text) {
+    for(; *text; text++) {
+        if(*text == '"' || *text == '\\') fputc('\\', out);
+        fputc(*text, out);
+    }
+}
+
+static void write_edge(FILE *out, uint32_t from, uint32_t to, const char *attributes) {
+    fprintf(out, "    b_%04X -> b_%04X%s;\n", from, to, attributes);
+}
+
+bool disasm_cfg(const uint8_t *rom, size_t rom_size, const symbols_t *symbols, FILE *out) {
+    program_t program;
+    if(!analyze_program(rom, rom_size, symbols, &program)) return false;
+
+    // Room for the targets of a skip at the end
+    uint8_t *leaders = calloc(CHIP8_XO_RAM_SIZE + 8, 1);
+    if(!leaders) {
+        fprintf(stderr, "Out of memory\n");
+        free_program(&program);
+        return false;
+    }
+
+    // Blocks start at the entry point, at labels and after anything that branches
+    leaders[CHIP8_ENTRY_POINT] = 1;
+    for(uint32_t addr = CHIP8_ENTRY_POINT; addr < program.end; addr++) {
+        if(!is_code(&program, addr)) continue;
+
+        const uint16_t opcode = program_word(&program, addr);
+        const uint32_t next = addr + ((program.code[addr + 2] == CODE_PART) ? 4 : 2);
+
+        if(program.labels[addr] != DISASM_LABEL_NONE) leaders[addr] = 1;
+        if(ends_path(opcode)) leaders[next] = 1;
+        if(is_skip(opcode)) {
+            leaders[next] = 1;
+            leaders[next + skipped_length(addr, program.end, program_word(&program, next))] = 1;
+        }
+    }
+
+    fprintf(out, "digraph rom {\n");
+    fprintf(out, "    node [shape=box, fontname=\"monospace\"];\n");
+
+    for(uint32_t start = CHIP8_ENTRY_POINT; start < program.end; start++) {
+        if(!is_code(&program, start) || !leaders[start]) continue;
+
+        const uint32_t last = block_last(&program, leaders, start);
+        char name[SYMBOLS_NAME_SIZE];
+        char line[64];
+
+        label_name(program.labels, symbols, start, name, sizeof name);
+        fprintf(out, "    b_%04X [label=\"", start);
+        write_dot_text(out, name);
+        fprintf(out, ":\\l");
+
+        uint32_t addr = start;
+        uint32_t next = start;
+        for(; addr <= last; addr = next) {
+            const uint16_t opcode = program_word(&program, addr);
+            next = addr + disasm_instruction_named(opcode, program_word(&program, addr + 2), DISASM_RAW,
+                                                   program.labels, symbols, line, sizeof line);
+            fprintf(out, "%04X  ", addr);
+            write_dot_text(out, line);
+            fprintf(out, "\\l");
+        }
+        fprintf(out, "\"];\n");
+
+        // Calls anywhere in the block, then where the last instruction goes
+        for(addr = start; addr <= last; addr += program.code[addr + 2] == CODE_PART ? 4 : 2) {
+            const uint16_t opcode = program_word(&program, addr);
+            if((opcode & 0xF000) == 0x2000 && is_code(&program, opcode & 0x0FFF))
+                write_edge(out, start, opcode & 0x0FFF, " [style=dashed, label=\"call\"]");
+        }
+
+        const uint16_t opcode = program_word(&program, last);
+        const uint16_t NNN = opcode & 0x0FFF;
+
+        if((opcode & 0xF000) == 0x1000) {
+            if(is_code(&program, NNN)) write_edge(out, start, NNN, "");
+        } else if((opcode & 0xF000) == 0xB000) {
+            if(is_code(&program, NNN)) write_edge(out, start, NNN, " [style=dotted, label=\"jump0\"]");
+        } else if(is_skip(opcode)) {
+            const uint32_t skipped = next + skipped_length(last, program.end, program_word(&program, next));
+            if(is_code(&program, next)) write_edge(out, start, next, "");
+            if(is_code(&program, skipped)) write_edge(out, start, skipped, " [label=\"skip\"]");
+        } else if(!ends_path(opcode) && is_code(&program, next)) {
+            write_edge(out, start, next, "");
+        }
+    }
+
+    fprintf(out, "}\n");
+
+    free(leaders);
+    free_program(&program);
+    return true;
+}
@@ -0,0 +1,43 @@
+#ifndef DISASM_H
+#define DISASM_H
+
+#include <stdio.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "symbols.h"
+
+// Output syntax, raw is the common "LD VX, NN" style, octo is what the Octo assembler accepts
+typedef enum {
+    DISASM_RAW,
+    DISASM_OCTO,
+} disasm_syntax_t;
+
+// Kinds of labels found while tracing a program, higher values win when an address is used as several
+typedef enum {
+    DISASM_LABEL_NONE,
+    DISASM_LABEL_DATA,  // Target of I := NNN
+    DISASM_LABEL_JUMP,  // Target of a jump
+    DISASM_LABEL_SUB,   // Target of a subroutine call
+} disasm_label_t;
+
+// Decode one instruction into a mnemonic, next is the following word (used by XO-CHIP F000 NNNN and Mega-Chip 01NN NNNN)
+// labels is indexed by address and may be NULL, labeled addresses are printed by name
+// Returns the instruction length in bytes, 2 or 4
+uint8_t disasm_instruction(uint16_t opcode, uint16_t next, disasm_syntax_t syntax,
+                           const uint8_t *labels, char *buf, size_t size);
+
+// Same with the names from a symbol file for the addresses it has, symbols may be NULL
+uint8_t disasm_instruction_named(uint16_t opcode, uint16_t next, disasm_syntax_t syntax,
+                                 const uint8_t *labels, const symbols_t *symbols, char *buf, size_t size);
+
+// Disassemble a whole ROM loaded at the entry point, tracing code from the entry point
+// Bytes not reachable as code are written as data, symbols may be NULL
+bool disasm_program(const uint8_t *rom, size_t rom_size, disasm_syntax_t syntax, const symbols_t *symbols, FILE *out);
+
+// Control-flow graph of the traced code in Graphviz DOT, one node per basic block
+// Jumps, skips and fall through are solid edges, calls dashed and jump0 dotted to the table start
+bool disasm_cfg(const uint8_t *rom, size_t rom_size, const symbols_t *symbols, FILE *out);
+
+#endif // DISASM_H
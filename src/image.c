@@ -0,0 +1,488 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "image.h"
+
+uint8_t *image_from_display(const chip8_t *chip8, const uint32_t palette[4], uint32_t scale,
+                            uint32_t *width, uint32_t *height) {
+    const uint32_t display_width = chip8_display_width(chip8);
+    const uint32_t display_height = chip8_display_height(chip8);
+
+    *width = display_width * scale;
+    *height = display_height * scale;
+
+    uint8_t *rgb = malloc((size_t)*width * *height * 3);
+    if(!rgb) return NULL;
+
+    for(uint32_t y = 0; y < *height; y++) {
+        for(uint32_t x = 0; x < *width; x++) {
+            const uint32_t color = chip8->mega ? chip8_mega_color(chip8, x / scale, y / scale, palette[0]) :
+                                   palette[chip8_pixel_planes(chip8, x / scale, y / scale) & 0x3];
+            uint8_t *pixel = &rgb[((size_t)y * *width + x) * 3];
+
+            pixel[0] = (color >> 24) & 0xFF;
+            pixel[1] = (color >> 16) & 0xFF;
+            pixel[2] = (color >>  8) & 0xFF;
+        }
+    }
+
+    return rgb;
+}
+
+void image_write_text(const chip8_t *chip8, FILE *out) {
+    for(uint32_t y = 0; y < chip8_display_height(chip8); y++) {
+        for(uint32_t x = 0; x < chip8_display_width(chip8); x++) {
+            const uint8_t planes = chip8_pixel_planes(chip8, x, y);
+            fputc(planes == 0 ? '.' : planes == 1 ? '#' : '0' + planes, out);
+        }
+
+        fputc('\n', out);
+    }
+}
+
+// Growable output buffer with an LSB first bit writer for deflate
+typedef struct {
+    uint8_t *data;
+    size_t len;
+    size_t cap;
+    uint32_t bits;          // Pending bits not yet written to data
+    uint32_t bit_count;
+    bool failed;            // Ran out of memory
+} png_buf_t;
+
+static void buf_byte(png_buf_t *buf, uint8_t byte) {
+    if(buf->len == buf->cap) {
+        const size_t cap = buf->cap ? buf->cap * 2 : 4096;
+        uint8_t *data = realloc(buf->data, cap);
+        if(!data) {
+            buf->failed = true;
+            return;
+        }
+
+        buf->data = data;
+        buf->cap = cap;
+    }
+
+    buf->data[buf->len++] = byte;
+}
+
+static void buf_u32(png_buf_t *buf, uint32_t value) {
+    buf_byte(buf, value >> 24);
+    buf_byte(buf, value >> 16);
+    buf_byte(buf, value >> 8);
+    buf_byte(buf, value);
+}
+
+static void put_bits(png_buf_t *buf, uint32_t value, uint32_t count) {
+    buf->bits |= value << buf->bit_count;
+    buf->bit_count += count;
+
+    while(buf->bit_count >= 8) {
+        buf_byte(buf, buf->bits & 0xFF);
+        buf->bits >>= 8;
+        buf->bit_count -= 8;
+    }
+}
+
+static void flush_bits(png_buf_t *buf) {
+    if(buf->bit_count > 0) buf_byte(buf, buf->bits & 0xFF);
+
+    buf->bits = 0;
+    buf->bit_count = 0;
+}
+
+// Huffman codes are stored most significant bit first
+static void put_code(png_buf_t *buf, uint32_t code, uint32_t count) {
+    uint32_t reversed = 0;
+    for(uint32_t i = 0; i < count; i++) reversed |= ((code >> i) & 1) << (count - 1 - i);
+
+    put_bits(buf, reversed, count);
+}
+
+// Fixed Huffman literal/length codes (RFC 1951 3.2.6)
+static void put_symbol(png_buf_t *buf, uint32_t symbol) {
+    if(symbol < 144)      put_code(buf, 0x30 + symbol, 8);
+    else if(symbol < 256) put_code(buf, 0x190 + symbol - 144, 9);
+    else if(symbol < 280) put_code(buf, symbol - 256, 7);
+    else                  put_code(buf, 0xC0 + symbol - 280, 8);
+}
+
+static void put_match(png_buf_t *buf, uint32_t length, uint32_t distance) {
+    static const uint16_t length_base[] = {3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+                                           35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258};
+    static const uint8_t length_extra[] = {0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+                                           3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0};
+    static const uint16_t dist_base[] = {1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385,
+                                         513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577};
+    static const uint8_t dist_extra[] = {0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7,
+                                         8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13};
+
+    int code = 28;
+    while(length_base[code] > length) code--;
+    put_symbol(buf, 257 + code);
+    put_bits(buf, length - length_base[code], length_extra[code]);
+
+    code = 29;
+    while(dist_base[code] > distance) code--;
+    put_code(buf, code, 5);
+    put_bits(buf, distance - dist_base[code], dist_extra[code]);
+}
+
+// Deflate with fixed Huffman codes, matching against the previous pixel and the previous row
+// which covers the long runs of identical pixels in scaled CHIP8 screens
+static void deflate(png_buf_t *buf, const uint8_t *data, size_t len, size_t row_len) {
+    const size_t distances[] = {3, row_len};
+
+    put_bits(buf, 1, 1);    // Final block
+    put_bits(buf, 1, 2);    // Fixed Huffman codes
+
+    for(size_t i = 0; i < len; ) {
+        size_t best_len = 0;
+        size_t best_dist = 0;
+
+        for(size_t d = 0; d < sizeof distances / sizeof distances[0]; d++) {
+            const size_t dist = distances[d];
+            if(dist > i || dist > 32768) continue;
+
+            size_t match = 0;
+            while(match < 258 && i + match < len && data[i + match] == data[i + match - dist]) match++;
+
+            if(match > best_len) {
+                best_len = match;
+                best_dist = dist;
+            }
+        }
+
+        if(best_len >= 3) {
+            put_match(buf, best_len, best_dist);
+            i += best_len;
+        } else {
+            put_symbol(buf, data[i++]);
+        }
+    }
+
+    put_symbol(buf, 256);   // End of block
+    flush_bits(buf);
+}
+
+// The table is built on every call, a shared one would need locking with machines on several threads
+static uint32_t crc32(const uint8_t *data, size_t len) {
+    uint32_t table[256];
+
+    for(uint32_t n = 0; n < 256; n++) {
+        uint32_t c = n;
+        for(int k = 0; k < 8; k++) c = (c & 1) ? 0xEDB88320 ^ (c >> 1) : c >> 1;
+        table[n] = c;
+    }
+
+    uint32_t crc = 0xFFFFFFFF;
+    for(size_t i = 0; i < len; i++) crc = table[(crc ^ data[i]) & 0xFF] ^ (crc >> 8);
+
+    return crc ^ 0xFFFFFFFF;
+}
+
+static uint32_t adler32(const uint8_t *data, size_t len) {
+    uint32_t a = 1;
+    uint32_t b = 0;
+
+    for(size_t i = 0; i < len; i++) {
+        a = (a + data[i]) % 65521;
+        b = (b + a) % 65521;
+    }
+
+    return (b << 16) | a;
+}
+
+// Chunk length and type, the data has to follow in buf, then end_chunk() adds the CRC
+static size_t begin_chunk(png_buf_t *buf, const char *type, uint32_t len) {
+    buf_u32(buf, len);
+    const size_t start = buf->len;
+    for(int i = 0; i < 4; i++) buf_byte(buf, type[i]);
+
+    return start;
+}
+
+static void end_chunk(png_buf_t *buf, size_t start) {
+    if(!buf->failed) buf_u32(buf, crc32(&buf->data[start], buf->len - start));
+}
+
+bool image_write_png(const char *path, const uint8_t *rgb, uint32_t width, uint32_t height) {
+    // Every row starts with filter type 0 (none)
+    const size_t row_len = (size_t)width * 3 + 1;
+    const size_t raw_len = row_len * height;
+    uint8_t *raw = malloc(raw_len);
+    if(!raw) return false;
+
+    for(uint32_t y = 0; y < height; y++) {
+        raw[y * row_len] = 0;
+        memcpy(&raw[y * row_len + 1], &rgb[(size_t)y * width * 3], (size_t)width * 3);
+    }
+
+    png_buf_t zlib = {0};
+    buf_byte(&zlib, 0x78);  // Deflate, 32K window
+    buf_byte(&zlib, 0x01);
+    deflate(&zlib, raw, raw_len, row_len);
+    buf_u32(&zlib, adler32(raw, raw_len));
+    free(raw);
+
+    png_buf_t png = {0};
+    static const uint8_t signature[] = {0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'};
+    for(size_t i = 0; i < sizeof signature; i++) buf_byte(&png, signature[i]);
+
+    size_t chunk = begin_chunk(&png, "IHDR", 13);
+    buf_u32(&png, width);
+    buf_u32(&png, height);
+    buf_byte(&png, 8);      // Bit depth
+    buf_byte(&png, 2);      // Truecolor RGB
+    buf_byte(&png, 0);      // Deflate compression
+    buf_byte(&png, 0);      // Adaptive filtering
+    buf_byte(&png, 0);      // No interlace
+    end_chunk(&png, chunk);
+
+    chunk = begin_chunk(&png, "IDAT", zlib.len);
+    for(size_t i = 0; i < zlib.len && !zlib.failed; i++) buf_byte(&png, zlib.data[i]);
+    end_chunk(&png, chunk);
+
+    chunk = begin_chunk(&png, "IEND", 0);
+    end_chunk(&png, chunk);
+
+    bool ok = !zlib.failed && !png.failed;
+    free(zlib.data);
+
+    FILE *file = ok ? fopen(path, "wb") : NULL;
+    ok = file && fwrite(png.data, 1, png.len, file) == png.len;
+    if(file && fclose(file) != 0) ok = false;
+    if(!ok) fprintf(stderr, "Could not write image %s\n", path);
+
+    free(png.data);
+    return ok;
+}
+
+// GIF output, see the GIF89a specification
+// Frames use the 4 entry global palette directly, so LZW starts from 2 bit codes
+#define GIF_MIN_CODE_SIZE 2
+#define GIF_CLEAR_CODE    (1 << GIF_MIN_CODE_SIZE)
+#define GIF_MAX_CODES     4096
+
+// Browsers slow down frames shorter than 2/100s, so changes faster than that are merged
+#define GIF_MIN_DELAY 2
+
+static void gif_u16(FILE *file, uint16_t value) {
+    fputc(value & 0xFF, file);
+    fputc(value >> 8, file);
+}
+
+// LZW output packed LSB first into data sub-blocks of up to 255 bytes
+typedef struct {
+    FILE *file;
+    uint8_t block[255];
+    uint32_t block_len;
+    uint32_t bits;
+    uint32_t bit_count;
+} gif_writer_t;
+
+static void gif_put_code(gif_writer_t *writer, uint32_t code, uint32_t size) {
+    writer->bits |= code << writer->bit_count;
+    writer->bit_count += size;
+
+    while(writer->bit_count >= 8) {
+        writer->block[writer->block_len++] = writer->bits & 0xFF;
+        writer->bits >>= 8;
+        writer->bit_count -= 8;
+
+        if(writer->block_len == sizeof writer->block) {
+            fputc(writer->block_len, writer->file);
+            fwrite(writer->block, 1, writer->block_len, writer->file);
+            writer->block_len = 0;
+        }
+    }
+}
+
+static void gif_flush(gif_writer_t *writer) {
+    if(writer->bit_count > 0) gif_put_code(writer, 0, 8 - writer->bit_count);
+
+    if(writer->block_len > 0) {
+        fputc(writer->block_len, writer->file);
+        fwrite(writer->block, 1, writer->block_len, writer->file);
+    }
+
+    fputc(0, writer->file); // Block terminator
+}
+
+static bool gif_lzw(FILE *file, const uint8_t *pixels, size_t count) {
+    // Code table as a trie, children[code][pixel] is the code for that string plus pixel, 0 if none
+    uint16_t (*children)[4] = calloc(GIF_MAX_CODES, sizeof *children);
+    if(!children) return false;
+
+    const uint32_t end_code = GIF_CLEAR_CODE + 1;
+    uint32_t next_code = end_code + 1;
+    uint32_t code_size = GIF_MIN_CODE_SIZE + 1;
+    gif_writer_t writer = {.file = file};
+
+    fputc(GIF_MIN_CODE_SIZE, file);
+    gif_put_code(&writer, GIF_CLEAR_CODE, code_size);
+
+    uint32_t code = pixels[0];
+    for(size_t i = 1; i < count; i++) {
+        const uint8_t pixel = pixels[i];
+
+        if(children[code][pixel]) {
+            code = children[code][pixel];
+            continue;
+        }
+
+        gif_put_code(&writer, code, code_size);
+
+        if(next_code < GIF_MAX_CODES) {
+            // The decoder grows its codes once the table fills the current size
+            if(next_code == 1u << code_size) code_size++;
+            children[code][pixel] = next_code++;
+        } else {
+            // Table is full, start over
+            gif_put_code(&writer, GIF_CLEAR_CODE, code_size);
+            memset(children, 0, GIF_MAX_CODES * sizeof *children);
+            next_code = end_code + 1;
+            code_size = GIF_MIN_CODE_SIZE + 1;
+        }
+
+        code = pixel;
+    }
+
+    gif_put_code(&writer, code, code_size);
+    gif_put_code(&writer, end_code, code_size);
+    gif_flush(&writer);
+
+    free(children);
+    return true;
+}
+
+static void gif_pixels(const gif_t *gif, const chip8_t *chip8, uint8_t *pixels) {
+    const uint32_t display_width = chip8_display_width(chip8);
+    const uint32_t display_height = chip8_display_height(chip8);
+
+    for(uint32_t y = 0; y < gif->height; y++) {
+        for(uint32_t x = 0; x < gif->width; x++) {
+            pixels[(size_t)y * gif->width + x] = chip8_pixel_planes(chip8, (uint64_t)x * display_width / gif->width,
+                                                                    (uint64_t)y * display_height / gif->height) & 0x3;
+        }
+    }
+}
+
+// Write the pending frame with a delay covering all the 60Hz frames it was shown for
+static void gif_write_pending(gif_t *gif) {
+    const uint64_t start = gif->written_frames * 100 / 60;
+    const uint64_t end = (gif->written_frames + gif->pending_frames) * 100 / 60;
+    const uint64_t delay = end - start;
+
+    // Graphic control extension with the delay in 1/100s
+    fputc(0x21, gif->file);
+    fputc(0xF9, gif->file);
+    fputc(4, gif->file);
+    fputc(0, gif->file);
+    gif_u16(gif->file, delay > 0xFFFF ? 0xFFFF : delay);
+    fputc(0, gif->file);
+    fputc(0, gif->file);
+
+    // Image descriptor covering the whole screen, no local palette
+    fputc(0x2C, gif->file);
+    gif_u16(gif->file, 0);
+    gif_u16(gif->file, 0);
+    gif_u16(gif->file, gif->width);
+    gif_u16(gif->file, gif->height);
+    fputc(0, gif->file);
+
+    if(!gif_lzw(gif->file, gif->pixels, (size_t)gif->width * gif->height)) gif->failed = true;
+
+    gif->written_frames += gif->pending_frames;
+    gif->pending_frames = 0;
+}
+
+bool image_gif_open(gif_t *gif, const char *path, const chip8_t *chip8, const uint32_t palette[4], uint32_t scale) {
+    *gif = (gif_t) {
+        .width = chip8_display_width(chip8) * scale,
+        .height = chip8_display_height(chip8) * scale,
+    };
+    snprintf(gif->path, sizeof gif->path, "%s", path);
+
+    const size_t size = (size_t)gif->width * gif->height;
+    gif->pixels = malloc(size);
+    gif->next = malloc(size);
+    gif->file = gif->pixels && gif->next ? fopen(path, "wb") : NULL;
+
+    if(!gif->file) {
+        fprintf(stderr, "Could not open %s for writing\n", path);
+        free(gif->pixels);
+        free(gif->next);
+        return false;
+    }
+
+    // Header and logical screen with a 4 color global palette
+    fputs("GIF89a", gif->file);
+    gif_u16(gif->file, gif->width);
+    gif_u16(gif->file, gif->height);
+    fputc(0x80 | (1 << 4) | 1, gif->file);
+    fputc(0, gif->file);    // Background color index
+    fputc(0, gif->file);    // Square pixels
+
+    for(int i = 0; i < 4; i++) {
+        fputc((palette[i] >> 24) & 0xFF, gif->file);
+        fputc((palette[i] >> 16) & 0xFF, gif->file);
+        fputc((palette[i] >>  8) & 0xFF, gif->file);
+    }
+
+    // Netscape extension to loop forever
+    fputc(0x21, gif->file);
+    fputc(0xFF, gif->file);
+    fputc(11, gif->file);
+    fputs("NETSCAPE2.0", gif->file);
+    fputc(3, gif->file);
+    fputc(1, gif->file);
+    gif_u16(gif->file, 0);
+    fputc(0, gif->file);
+
+    gif_pixels(gif, chip8, gif->pixels);
+    gif->pending_frames = 1;
+    return true;
+}
+
+// Add one 60Hz frame
+void image_gif_frame(gif_t *gif, const chip8_t *chip8) {
+    if(!gif->file) return;
+
+    const size_t size = (size_t)gif->width * gif->height;
+    gif_pixels(gif, chip8, gif->next);
+
+    if(memcmp(gif->next, gif->pixels, size) != 0) {
+        const uint64_t shown = (gif->written_frames + gif->pending_frames) * 100 / 60 - gif->written_frames * 100 / 60;
+
+        // Frames too short to show properly are replaced by the next one
+        if(shown >= GIF_MIN_DELAY) gif_write_pending(gif);
+
+        uint8_t *pixels = gif->pixels;
+        gif->pixels = gif->next;
+        gif->next = pixels;
+    }
+
+    gif->pending_frames++;
+}
+
+bool image_gif_close(gif_t *gif) {
+    if(!gif->file) return false;
+
+    gif_write_pending(gif);
+    fputc(0x3B, gif->file); // Trailer
+
+    bool ok = !gif->failed && !ferror(gif->file);
+    if(fclose(gif->file) != 0) ok = false;
+    if(!ok) fprintf(stderr, "Could not write %s\n", gif->path);
+
+    free(gif->pixels);
+    free(gif->next);
+    gif->file = NULL;
+    gif->pixels = NULL;
+    gif->next = NULL;
+    return ok;
+}
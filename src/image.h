@@ -0,0 +1,44 @@
+#ifndef IMAGE_H
+#define IMAGE_H
+
+#include <stdio.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Framebuffer as 8 bit RGB, each CHIP8 pixel scaled to scale x scale image pixels
+// palette holds RGBA colors indexed by the pixel plane bitmask (background, plane 1, plane 2, both)
+// Mega-Chip frames are in their own colors over the background
+// Returns a malloc'd buffer of width * height * 3 bytes
+uint8_t *image_from_display(const chip8_t *chip8, const uint32_t palette[4], uint32_t scale,
+                            uint32_t *width, uint32_t *height);
+
+// Write 8 bit RGB pixels as a PNG file
+bool image_write_png(const char *path, const uint8_t *rgb, uint32_t width, uint32_t height);
+
+// Animated GIF recording at the emulated 60Hz frame rate
+// A frame is only written once the screen changes, unchanged frames just add to its delay
+typedef struct {
+    FILE *file;             // NULL while not recording
+    char path[FILENAME_MAX];
+    uint32_t width;         // Image size, fixed when recording starts
+    uint32_t height;
+    uint8_t *pixels;        // Pending frame as palette indices
+    uint8_t *next;          // Frame being compared against the pending one
+    uint32_t pending_frames; // 60Hz frames the pending frame has been on screen
+    uint64_t written_frames; // 60Hz frames covered by the frames written so far
+    bool failed;
+} gif_t;
+
+// Start recording, the image is sized for the current resolution times scale
+// Frames in another resolution are resampled to that size, Mega-Chip ones only get the plane 1 color
+bool image_gif_open(gif_t *gif, const char *path, const chip8_t *chip8, const uint32_t palette[4], uint32_t scale);
+void image_gif_frame(gif_t *gif, const chip8_t *chip8);
+bool image_gif_close(gif_t *gif);
+
+// Framebuffer as text, one line per row, '.' for off and '#' for on pixels
+// XO-CHIP pixels on in plane 2 are written as their plane bitmask '2' or '3'
+void image_write_text(const chip8_t *chip8, FILE *out);
+
+#endif // IMAGE_H
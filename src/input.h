@@ -0,0 +1,66 @@
+#ifndef INPUT_H
+#define INPUT_H
+
+#include <stdio.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "config.h"
+
+// Frontend actions, backends translate host input into these
+typedef enum {
+    INPUT_KEYPAD,           // CHIP8 key pressed or released
+    INPUT_QUIT,
+    INPUT_PAUSE,            // Toggle pause
+    INPUT_REWIND,           // Held, step backwards through recent states
+    INPUT_TURBO,            // Held, fast forward
+    INPUT_SAVE_STATE,
+    INPUT_LOAD_STATE,
+    INPUT_GIF,              // Start/stop GIF recording
+    INPUT_SCREENSHOT,
+    INPUT_FULLSCREEN,
+    INPUT_INVERT,           // Swap foreground and background colors
+    INPUT_OVERLAY,          // Cycle the debug overlay: off, speed and timers, registers too
+    INPUT_VOLUME_UP,
+    INPUT_VOLUME_DOWN,
+    INPUT_MUTE,             // Toggle mute
+    INPUT_RESET,            // Power cycle the machine
+    INPUT_RELOAD,           // Load the ROM file again and reset
+    INPUT_MENU,             // Go back to the ROM menu
+    INPUT_MENU_UP,          // Menu navigation, only while input_t.menu is set
+    INPUT_MENU_DOWN,
+    INPUT_MENU_PAGE_UP,
+    INPUT_MENU_PAGE_DOWN,
+    INPUT_MENU_SELECT,
+    INPUT_DROP,             // File dropped on the window, run it instead of the current ROM
+    INPUT_FOCUS,            // Window got focus back (pressed) or lost it, minimizing loses it too
+    INPUT_SPEED_UP,
+    INPUT_SPEED_DOWN,
+    INPUT_QUIRK,            // Toggle a quirk
+} input_action_t;
+
+typedef struct {
+    input_action_t action;
+    uint8_t key;            // CHIP8 key for INPUT_KEYPAD, quirk number for INPUT_QUIRK, see chip8_quirk_name()
+    bool pressed;           // Press or release, INPUT_KEYPAD and the held actions only
+    char path[FILENAME_MAX]; // Dropped file for INPUT_DROP
+} input_event_t;
+
+// Input backend
+// poll() returns the pending events one at a time, false once there are none left
+typedef struct input input_t;
+
+struct input {
+    const char *name;
+    bool (*init)(input_t *input, const config_t *config);
+    bool (*poll)(input_t *input, const config_t *config, input_event_t *event);
+    void (*cleanup)(input_t *input);
+    bool menu;              // Set by the frontend while the ROM menu is shown
+    void *data;
+};
+
+// Available backends
+void sdl_input(input_t *input);
+void stdio_input(input_t *input);               // Commands from a frontend on stdin, for the stdio renderer
+
+#endif // INPUT_H
@@ -0,0 +1,291 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <SDL.h>
+
+#include "input.h"
+#include "log.h"
+
+#define MAX_CONTROLLERS  8
+#define STICK_DEAD_ZONE  16000  // Of 32767, the left stick acts as a D-pad beyond this
+#define MAX_PENDING      4
+
+// Open controllers and events still to report, a stick move can release one direction and press another
+typedef struct {
+    SDL_GameController *controllers[MAX_CONTROLLERS];
+    int8_t stick[2];        // Left stick X and Y: -1, 0 or 1
+    input_event_t pending[MAX_PENDING];
+    int pending_count;
+} sdl_input_t;
+
+// Hotkeys, everything else goes through the keymap
+static const struct {
+    SDL_Keycode key;
+    input_action_t action;
+    bool held;              // Reports release too
+} hotkeys[] = {
+    {SDLK_ESCAPE,    INPUT_QUIT,       false},
+    {SDLK_SPACE,     INPUT_PAUSE,      false},
+    {SDLK_F2,        INPUT_RESET,      false},
+    {SDLK_F3,        INPUT_RELOAD,     false},
+    {SDLK_BACKSPACE, INPUT_REWIND,     true},
+    {SDLK_TAB,       INPUT_TURBO,      true},
+    {SDLK_F5,        INPUT_SAVE_STATE, false},
+    {SDLK_F7,        INPUT_INVERT,     false},
+    {SDLK_F8,        INPUT_OVERLAY,    false},
+    {SDLK_EQUALS,    INPUT_VOLUME_UP,  false},
+    {SDLK_MINUS,     INPUT_VOLUME_DOWN, false},
+    {SDLK_F6,        INPUT_MUTE,       false},
+    {SDLK_F9,        INPUT_LOAD_STATE, false},
+    {SDLK_F10,       INPUT_GIF,        false},
+    {SDLK_F11,       INPUT_FULLSCREEN, false},
+    {SDLK_F12,       INPUT_SCREENSHOT, false},
+    {SDLK_F1,        INPUT_MENU,       false},
+    {SDLK_RIGHTBRACKET, INPUT_SPEED_UP,  false},
+    {SDLK_LEFTBRACKET,  INPUT_SPEED_DOWN, false},
+};
+
+// ROM menu navigation, takes priority over the keymap while the menu is shown
+static const struct {
+    SDL_Keycode key;
+    input_action_t action;
+} menu_keys[] = {
+    {SDLK_UP,       INPUT_MENU_UP},
+    {SDLK_DOWN,     INPUT_MENU_DOWN},
+    {SDLK_PAGEUP,   INPUT_MENU_PAGE_UP},
+    {SDLK_PAGEDOWN, INPUT_MENU_PAGE_DOWN},
+    {SDLK_RETURN,   INPUT_MENU_SELECT},
+};
+
+// Controller buttons for the ROM menu and for unbound buttons while a ROM runs
+static const struct {
+    SDL_GameControllerButton button;
+    input_action_t action;
+} menu_buttons[] = {
+    {SDL_CONTROLLER_BUTTON_DPAD_UP,   INPUT_MENU_UP},
+    {SDL_CONTROLLER_BUTTON_DPAD_DOWN, INPUT_MENU_DOWN},
+    {SDL_CONTROLLER_BUTTON_A,         INPUT_MENU_SELECT},
+    {SDL_CONTROLLER_BUTTON_START,     INPUT_MENU_SELECT},
+}, hotkey_buttons[] = {
+    {SDL_CONTROLLER_BUTTON_START, INPUT_PAUSE},
+    {SDL_CONTROLLER_BUTTON_BACK,  INPUT_MENU},
+};
+
+static bool sdl_input_init(input_t *input, const config_t *config) {
+    (void)config;
+
+    sdl_input_t *sdl = calloc(1, sizeof *sdl);
+    if(!sdl) return false;
+    input->data = sdl;
+
+    // Keyboard events are part of the SDL subsystems main() initializes,
+    // controllers are optional and show up as SDL_CONTROLLERDEVICEADDED events, also the ones already plugged in
+    if(SDL_InitSubSystem(SDL_INIT_GAMECONTROLLER) != 0)
+        log_write(CHIP8_LOG_WARN, "input", "Could not initialize game controllers, keyboard only %s", SDL_GetError());
+
+    return true;
+}
+
+static void open_controller(sdl_input_t *sdl, int device) {
+    for(int i = 0; i < MAX_CONTROLLERS; i++) {
+        if(sdl->controllers[i]) continue;
+
+        sdl->controllers[i] = SDL_GameControllerOpen(device);
+        if(sdl->controllers[i])
+            log_write(CHIP8_LOG_INFO, "input", "Controller connected: %s", SDL_GameControllerName(sdl->controllers[i]));
+        return;
+    }
+}
+
+static void close_controller(sdl_input_t *sdl, SDL_JoystickID id) {
+    SDL_GameController *controller = SDL_GameControllerFromInstanceID(id);
+
+    for(int i = 0; controller && i < MAX_CONTROLLERS; i++) {
+        if(sdl->controllers[i] != controller) continue;
+
+        log_write(CHIP8_LOG_INFO, "input", "Controller disconnected: %s", SDL_GameControllerName(controller));
+        SDL_GameControllerClose(controller);
+        sdl->controllers[i] = NULL;
+    }
+}
+
+// Translate a controller button, the left stick comes through here as the D-pad
+// Bound buttons press CHIP8 keys, a few unbound ones are hotkeys
+static bool translate_button(const input_t *input, const config_t *config, int button, bool pressed,
+                             input_event_t *event) {
+    for(size_t i = 0; input->menu && i < sizeof menu_buttons / sizeof menu_buttons[0]; i++) {
+        if(menu_buttons[i].button != button) continue;
+        if(!pressed) return false;
+
+        *event = (input_event_t) {.action = menu_buttons[i].action, .pressed = true};
+        return true;
+    }
+
+    const int chip8_key = keymap_button(&config->keymap, button);
+    if(chip8_key >= 0) {
+        *event = (input_event_t) {.action = INPUT_KEYPAD, .key = chip8_key, .pressed = pressed};
+        return true;
+    }
+
+    for(size_t i = 0; pressed && i < sizeof hotkey_buttons / sizeof hotkey_buttons[0]; i++) {
+        if(hotkey_buttons[i].button != button) continue;
+
+        *event = (input_event_t) {.action = hotkey_buttons[i].action, .pressed = true};
+        return true;
+    }
+
+    return false;
+}
+
+static void queue_button(sdl_input_t *sdl, const input_t *input, const config_t *config, int button, bool pressed) {
+    if(sdl->pending_count < MAX_PENDING &&
+       translate_button(input, config, button, pressed, &sdl->pending[sdl->pending_count]))
+        sdl->pending_count++;
+}
+
+// Left stick past the dead zone presses the D-pad button for the direction
+static void queue_stick(sdl_input_t *sdl, const input_t *input, const config_t *config, const SDL_ControllerAxisEvent *axis) {
+    static const int directions[2][2] = {
+        {SDL_CONTROLLER_BUTTON_DPAD_LEFT, SDL_CONTROLLER_BUTTON_DPAD_RIGHT},
+        {SDL_CONTROLLER_BUTTON_DPAD_UP,   SDL_CONTROLLER_BUTTON_DPAD_DOWN},
+    };
+
+    if(axis->axis != SDL_CONTROLLER_AXIS_LEFTX && axis->axis != SDL_CONTROLLER_AXIS_LEFTY) return;
+
+    const int index = axis->axis == SDL_CONTROLLER_AXIS_LEFTX ? 0 : 1;
+    const int8_t direction = axis->value < -STICK_DEAD_ZONE ? -1 : axis->value > STICK_DEAD_ZONE ? 1 : 0;
+    if(direction == sdl->stick[index]) return;
+
+    if(sdl->stick[index]) queue_button(sdl, input, config, directions[index][sdl->stick[index] > 0], false);
+    if(direction) queue_button(sdl, input, config, directions[index][direction > 0], true);
+    sdl->stick[index] = direction;
+}
+
+// Translate a key event, false if it doesn't mean anything to the emulator
+static bool translate_key(const input_t *input, const config_t *config, const SDL_KeyboardEvent *key,
+                          input_event_t *event) {
+    const bool pressed = key->type == SDL_KEYDOWN;
+
+    for(size_t i = 0; input->menu && i < sizeof menu_keys / sizeof menu_keys[0]; i++) {
+        if(menu_keys[i].key != key->keysym.sym) continue;
+        if(!pressed) return false;
+
+        *event = (input_event_t) {.action = menu_keys[i].action, .pressed = true};
+        return true;
+    }
+
+    // Ctrl and a number toggles a quirk, before the keymap gets the number as a keypad key
+    const SDL_Keycode sym = key->keysym.sym;
+    if(!input->menu && (key->keysym.mod & KMOD_CTRL) && sym >= SDLK_1 && sym < SDLK_1 + CHIP8_QUIRK_COUNT) {
+        if(!pressed) return false;
+
+        *event = (input_event_t) {.action = INPUT_QUIRK, .key = (uint8_t)(sym - SDLK_1), .pressed = true};
+        return true;
+    }
+
+    for(size_t i = 0; i < sizeof hotkeys / sizeof hotkeys[0]; i++) {
+        if(hotkeys[i].key != key->keysym.sym) continue;
+        if(!pressed && !hotkeys[i].held) return false;
+
+        *event = (input_event_t) {.action = hotkeys[i].action, .pressed = pressed};
+        return true;
+    }
+
+    // Map host keys to CHIP8 keypad
+    const int chip8_key = keymap_lookup(&config->keymap, key->keysym.sym);
+    if(chip8_key < 0) return false;
+
+    *event = (input_event_t) {.action = INPUT_KEYPAD, .key = chip8_key, .pressed = pressed};
+    return true;
+}
+
+static bool sdl_input_poll(input_t *input, const config_t *config, input_event_t *event) {
+    sdl_input_t *sdl = input->data;
+    SDL_Event sdl_event;
+
+    for(;;) {
+        if(sdl->pending_count > 0) {
+            *event = sdl->pending[0];
+            memmove(&sdl->pending[0], &sdl->pending[1], --sdl->pending_count * sizeof sdl->pending[0]);
+            return true;
+        }
+
+        if(!SDL_PollEvent(&sdl_event)) return false;
+
+        switch(sdl_event.type) {
+            case SDL_QUIT:
+                // Window closed
+                *event = (input_event_t) {.action = INPUT_QUIT};
+                return true;
+
+            case SDL_KEYDOWN:
+            case SDL_KEYUP:
+                if(translate_key(input, config, &sdl_event.key, event)) return true;
+                break;
+
+            case SDL_WINDOWEVENT:
+                if(sdl_event.window.event == SDL_WINDOWEVENT_FOCUS_GAINED ||
+                   sdl_event.window.event == SDL_WINDOWEVENT_RESTORED) {
+                    *event = (input_event_t) {.action = INPUT_FOCUS, .pressed = true};
+                    return true;
+                }
+                if(sdl_event.window.event == SDL_WINDOWEVENT_FOCUS_LOST ||
+                   sdl_event.window.event == SDL_WINDOWEVENT_MINIMIZED) {
+                    *event = (input_event_t) {.action = INPUT_FOCUS, .pressed = false};
+                    return true;
+                }
+                break;
+
+            case SDL_DROPFILE:
+                // SDL hands over the path, it has to be freed here
+                *event = (input_event_t) {.action = INPUT_DROP};
+                snprintf(event->path, sizeof event->path, "%s", sdl_event.drop.file);
+                SDL_free(sdl_event.drop.file);
+                return true;
+
+            case SDL_CONTROLLERDEVICEADDED:
+                open_controller(sdl, sdl_event.cdevice.which);
+                break;
+
+            case SDL_CONTROLLERDEVICEREMOVED:
+                close_controller(sdl, sdl_event.cdevice.which);
+                break;
+
+            case SDL_CONTROLLERBUTTONDOWN:
+            case SDL_CONTROLLERBUTTONUP:
+                queue_button(sdl, input, config, sdl_event.cbutton.button, sdl_event.type == SDL_CONTROLLERBUTTONDOWN);
+                break;
+
+            case SDL_CONTROLLERAXISMOTION:
+                queue_stick(sdl, input, config, &sdl_event.caxis);
+                break;
+
+            default:
+                break;
+        }
+    }
+}
+
+static void sdl_input_cleanup(input_t *input) {
+    sdl_input_t *sdl = input->data;
+    if(!sdl) return;
+
+    for(int i = 0; i < MAX_CONTROLLERS; i++) {
+        if(sdl->controllers[i]) SDL_GameControllerClose(sdl->controllers[i]);
+    }
+
+    SDL_QuitSubSystem(SDL_INIT_GAMECONTROLLER);
+    free(sdl);
+    input->data = NULL;
+}
+
+void sdl_input(input_t *input) {
+    *input = (input_t) {
+        .name = "sdl",
+        .init = sdl_input_init,
+        .poll = sdl_input_poll,
+        .cleanup = sdl_input_cleanup,
+    };
+}
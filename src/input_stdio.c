@@ -0,0 +1,230 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <errno.h>
+#include <fcntl.h>
+#include <unistd.h>
+
+#include "input.h"
+#include "log.h"
+
+// Input half of the frontend protocol in render_stdio.c, one command per line on stdin:
+//   key <0-f> <down|up>            CHIP8 keypad
+//   <action>                       quit, pause, reset, reload, menu, save-state, load-state, gif,
+//                                  screenshot, fullscreen, invert, overlay, volume-up, volume-down, mute,
+//                                  speed-up, speed-down, menu-up, menu-down, menu-page-up, menu-page-down,
+//                                  menu-select
+//   <rewind|turbo|focus> <down|up> Held actions, focus down is the frontend's window getting focus
+//   quirk <n>                      Toggle quirk n, see chip8_quirk_name()
+//   drop <path>                    Run another ROM
+// The end of stdin counts as quit, the frontend is gone
+#define STDIO_LINE_MAX (FILENAME_MAX + 16)
+
+typedef struct {
+    char line[STDIO_LINE_MAX];  // Start of the next line, read so far
+    size_t len;
+    bool too_long;          // The line being read didn't fit, it's skipped up to its end
+    bool eof;
+    bool quit_sent;
+    int flags;              // stdin's file status flags before it was made non-blocking
+} stdio_input_t;
+
+static const struct {
+    const char *name;
+    input_action_t action;
+    bool held;              // Takes down or up after the name
+} actions[] = {
+    {"quit",           INPUT_QUIT,           false},
+    {"pause",          INPUT_PAUSE,          false},
+    {"reset",          INPUT_RESET,          false},
+    {"reload",         INPUT_RELOAD,         false},
+    {"menu",           INPUT_MENU,           false},
+    {"save-state",     INPUT_SAVE_STATE,     false},
+    {"load-state",     INPUT_LOAD_STATE,     false},
+    {"gif",            INPUT_GIF,            false},
+    {"screenshot",     INPUT_SCREENSHOT,     false},
+    {"fullscreen",     INPUT_FULLSCREEN,     false},
+    {"invert",         INPUT_INVERT,         false},
+    {"overlay",        INPUT_OVERLAY,        false},
+    {"volume-up",      INPUT_VOLUME_UP,      false},
+    {"volume-down",    INPUT_VOLUME_DOWN,    false},
+    {"mute",           INPUT_MUTE,           false},
+    {"speed-up",       INPUT_SPEED_UP,       false},
+    {"speed-down",     INPUT_SPEED_DOWN,     false},
+    {"menu-up",        INPUT_MENU_UP,        false},
+    {"menu-down",      INPUT_MENU_DOWN,      false},
+    {"menu-page-up",   INPUT_MENU_PAGE_UP,   false},
+    {"menu-page-down", INPUT_MENU_PAGE_DOWN, false},
+    {"menu-select",    INPUT_MENU_SELECT,    false},
+    {"rewind",         INPUT_REWIND,         true},
+    {"turbo",          INPUT_TURBO,          true},
+    {"focus",          INPUT_FOCUS,          true},
+};
+
+static bool stdio_input_init(input_t *input, const config_t *config) {
+    (void)config;
+
+    stdio_input_t *in = calloc(1, sizeof *in);
+    if(!in) return false;
+    input->data = in;
+
+    // poll() runs once a frame, it can't wait for the frontend to say something
+    in->flags = fcntl(STDIN_FILENO, F_GETFL);
+    if(in->flags == -1 || fcntl(STDIN_FILENO, F_SETFL, in->flags | O_NONBLOCK) == -1) {
+        log_write(CHIP8_LOG_ERROR, "input", "Could not make stdin non-blocking");
+        free(in);
+        input->data = NULL;
+        return false;
+    }
+
+    return true;
+}
+
+static void stdio_input_cleanup(input_t *input) {
+    stdio_input_t *in = input->data;
+    if(!in) return;
+
+    if(in->flags != -1) fcntl(STDIN_FILENO, F_SETFL, in->flags);
+    free(in);
+    input->data = NULL;
+}
+
+static bool parse_state(const char *word, bool *pressed) {
+    if(!word) return false;
+
+    *pressed = strcmp(word, "down") == 0;
+    return *pressed || strcmp(word, "up") == 0;
+}
+
+// One command into an event, false for lines that aren't one
+static bool parse_command(char *line, input_event_t *event) {
+    char *arg = strchr(line, ' ');
+    if(arg) *arg++ = '\0';
+
+    *event = (input_event_t) {0};
+
+    if(strcmp(line, "key") == 0) {
+        char *state = arg ? strchr(arg, ' ') : NULL;
+        if(state) *state++ = '\0';
+
+        char *end;
+        const unsigned long key = arg ? strtoul(arg, &end, 16) : 16;
+        if(key > 0xF || end == arg || *end != '\0' || !parse_state(state, &event->pressed)) return false;
+
+        event->action = INPUT_KEYPAD;
+        event->key = (uint8_t)key;
+        return true;
+    }
+
+    if(strcmp(line, "quirk") == 0) {
+        char *end;
+        const unsigned long quirk = arg ? strtoul(arg, &end, 10) : CHIP8_QUIRK_COUNT;
+        if(quirk >= CHIP8_QUIRK_COUNT || end == arg || *end != '\0') return false;
+
+        event->action = INPUT_QUIRK;
+        event->key = (uint8_t)quirk;
+        return true;
+    }
+
+    if(strcmp(line, "drop") == 0) {
+        if(!arg || !*arg) return false;
+
+        event->action = INPUT_DROP;
+        snprintf(event->path, sizeof event->path, "%s", arg);
+        return true;
+    }
+
+    for(size_t i = 0; i < sizeof actions / sizeof actions[0]; i++) {
+        if(strcmp(actions[i].name, line) != 0) continue;
+        if(actions[i].held ? !parse_state(arg, &event->pressed) : arg != NULL) return false;
+
+        event->action = actions[i].action;
+        return true;
+    }
+
+    return false;
+}
+
+// Next complete line out of what was read, without its newline
+static bool next_line(stdio_input_t *in, char *line) {
+    char *newline = memchr(in->line, '\n', in->len);
+    if(!newline) return false;
+
+    const size_t len = newline - in->line;
+    memcpy(line, in->line, len);
+    line[len] = '\0';
+    if(len > 0 && line[len - 1] == '\r') line[len - 1] = '\0';
+
+    in->len -= len + 1;
+    memmove(in->line, newline + 1, in->len);
+    return true;
+}
+
+// Top up the line buffer with what the frontend sent since the last call
+static void read_input(stdio_input_t *in) {
+    while(!in->eof && in->len < sizeof in->line) {
+        const ssize_t got = read(STDIN_FILENO, &in->line[in->len], sizeof in->line - in->len);
+        if(got > 0) {
+            in->len += got;
+        } else if(got == 0) {
+            in->eof = true;
+        } else if(errno != EINTR) {
+            // EAGAIN is nothing to read yet, anything else won't get better
+            if(errno != EAGAIN && errno != EWOULDBLOCK) in->eof = true;
+            break;
+        }
+    }
+
+    // A line longer than the buffer can't be a command, drop what there is of it
+    if(in->len == sizeof in->line && !memchr(in->line, '\n', in->len)) {
+        in->len = 0;
+        in->too_long = true;
+    }
+}
+
+static bool stdio_input_poll(input_t *input, const config_t *config, input_event_t *event) {
+    (void)config;
+    stdio_input_t *in = input->data;
+    char line[STDIO_LINE_MAX];
+
+    while(true) {
+        if(!next_line(in, line)) {
+            read_input(in);
+            if(!next_line(in, line)) break;
+        }
+
+        if(in->too_long) {
+            in->too_long = false;
+            continue;
+        }
+
+        if(line[0] == '\0') continue;
+
+        char command[STDIO_LINE_MAX];
+        memcpy(command, line, strlen(line) + 1);
+        if(parse_command(command, event)) return true;
+
+        log_write(CHIP8_LOG_WARN, "input", "Unknown frontend command: %s", line);
+    }
+
+    if(in->eof && !in->quit_sent) {
+        in->quit_sent = true;
+        *event = (input_event_t) {.action = INPUT_QUIT};
+        return true;
+    }
+
+    return false;
+}
+
+void stdio_input(input_t *input) {
+    *input = (input_t) {
+        .name = "stdio",
+        .init = stdio_input_init,
+        .poll = stdio_input_poll,
+        .cleanup = stdio_input_cleanup,
+    };
+}
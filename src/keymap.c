@@ -0,0 +1,154 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <ctype.h>
+#include <SDL.h>
+
+#include "keymap.h"
+
+// Default CHIP8 Keypad QWERTY
+// 123C         1234
+// 456D         qwer
+// 789E         asdf
+// A0BF         zxcv
+//
+// Controllers get the usual directions 2/4/6/8 on the D-pad, 5 on A and 0 on B
+void keymap_default(keymap_t *keymap) {
+    *keymap = (keymap_t) {
+        .keys = {
+            [0x1] = SDLK_1, [0x2] = SDLK_2, [0x3] = SDLK_3, [0xC] = SDLK_4,
+            [0x4] = SDLK_q, [0x5] = SDLK_w, [0x6] = SDLK_e, [0xD] = SDLK_r,
+            [0x7] = SDLK_a, [0x8] = SDLK_s, [0x9] = SDLK_d, [0xE] = SDLK_f,
+            [0xA] = SDLK_z, [0x0] = SDLK_x, [0xB] = SDLK_c, [0xF] = SDLK_v,
+        },
+    };
+
+    memset(keymap->buttons, -1, sizeof keymap->buttons);
+    keymap->buttons[SDL_CONTROLLER_BUTTON_DPAD_UP] = 0x2;
+    keymap->buttons[SDL_CONTROLLER_BUTTON_DPAD_DOWN] = 0x8;
+    keymap->buttons[SDL_CONTROLLER_BUTTON_DPAD_LEFT] = 0x4;
+    keymap->buttons[SDL_CONTROLLER_BUTTON_DPAD_RIGHT] = 0x6;
+    keymap->buttons[SDL_CONTROLLER_BUTTON_A] = 0x5;
+    keymap->buttons[SDL_CONTROLLER_BUTTON_B] = 0x0;
+}
+
+// CHIP8 key from the "<chip8 key>:" start of a binding, -1 if it doesn't start like that
+static int binding_key(const char *binding) {
+    const char *sep = strchr(binding, ':');
+    if(!sep || sep - binding != 1 || !isxdigit((unsigned char)binding[0])) return -1;
+
+    const char digit = toupper((unsigned char)binding[0]);
+    return isdigit((unsigned char)digit) ? digit - '0' : digit - 'A' + 10;
+}
+
+// Bind a host key to a CHIP8 key from a "<chip8 key>:<host key name>" string, e.g. "5:Up"
+// Host key names are SDL key names ("Space", "Left", "Keypad 8", ...)
+bool keymap_bind(keymap_t *keymap, const char *binding) {
+    const char *sep = strchr(binding, ':');
+    const int chip8_key = binding_key(binding);
+
+    if(chip8_key < 0) {
+        fprintf(stderr, "Invalid key binding %s, expected <chip8 key 0-F>:<key name>\n", binding);
+        return false;
+    }
+
+    const SDL_Keycode host_key = SDL_GetKeyFromName(sep + 1);
+    if(host_key == SDLK_UNKNOWN) {
+        fprintf(stderr, "Unknown key name %s in key binding %s\n", sep + 1, binding);
+        return false;
+    }
+
+    // A host key can only drive one CHIP8 key
+    for(int i = 0; i < 16; i++) {
+        if(keymap->keys[i] == host_key) keymap->keys[i] = 0;
+    }
+
+    keymap->keys[chip8_key] = host_key;
+
+    return true;
+}
+
+// Bind a game controller button from a "<chip8 key>:<button name>" string, e.g. "5:x"
+// Button names are SDL's: a, b, x, y, back, start, leftshoulder, dpup, ...
+// Several buttons can press the same CHIP8 key, "<chip8 key>:none" removes all of them
+bool keymap_bind_button(keymap_t *keymap, const char *binding) {
+    const char *sep = strchr(binding, ':');
+    const int chip8_key = binding_key(binding);
+
+    if(chip8_key < 0) {
+        fprintf(stderr, "Invalid button binding %s, expected <chip8 key 0-F>:<button name>\n", binding);
+        return false;
+    }
+
+    if(strcmp(sep + 1, "none") == 0) {
+        for(int i = 0; i < KEYMAP_BUTTONS; i++) {
+            if(keymap->buttons[i] == chip8_key) keymap->buttons[i] = -1;
+        }
+        return true;
+    }
+
+    const SDL_GameControllerButton button = SDL_GameControllerGetButtonFromString(sep + 1);
+    if(button == SDL_CONTROLLER_BUTTON_INVALID || button >= KEYMAP_BUTTONS) {
+        fprintf(stderr, "Unknown button name %s in button binding %s\n", sep + 1, binding);
+        return false;
+    }
+
+    keymap->buttons[button] = chip8_key;
+
+    return true;
+}
+
+// Load key bindings from a file, one "<chip8 key>:<key name>" binding per line
+// Empty lines and lines starting with # are ignored
+bool keymap_load_file(keymap_t *keymap, const char *path) {
+    FILE *file = fopen(path, "r");
+
+    if(!file) {
+        fprintf(stderr, "Could not open keymap file %s\n", path);
+        return false;
+    }
+
+    char line[128];
+    uint32_t line_num = 0;
+    bool ok = true;
+
+    while(fgets(line, sizeof line, file)) {
+        line_num++;
+
+        // Trim surrounding whitespace
+        char *start = line;
+        while(isspace((unsigned char)*start)) start++;
+        char *end = start + strlen(start);
+        while(end > start && isspace((unsigned char)end[-1])) *--end = '\0';
+
+        if(*start == '\0' || *start == '#') continue;
+
+        if(!keymap_bind(keymap, start)) {
+            fprintf(stderr, "%s:%u: invalid key binding\n", path, line_num);
+            ok = false;
+            break;
+        }
+    }
+
+    fclose(file);
+
+    return ok;
+}
+
+// Returns the CHIP8 key bound to the host key, -1 if unbound
+int keymap_lookup(const keymap_t *keymap, int32_t host_key) {
+    if(host_key == 0) return -1;
+
+    for(int i = 0; i < 16; i++) {
+        if(keymap->keys[i] == host_key) return i;
+    }
+
+    return -1;
+}
+
+// Returns the CHIP8 key bound to the controller button, -1 if unbound
+int keymap_button(const keymap_t *keymap, int button) {
+    return button >= 0 && button < KEYMAP_BUTTONS ? keymap->buttons[button] : -1;
+}
@@ -0,0 +1,23 @@
+#ifndef KEYMAP_H
+#define KEYMAP_H
+
+#include <stdint.h>
+#include <stdbool.h>
+
+// Room for every SDL game controller button
+#define KEYMAP_BUTTONS 32
+
+// Host key bound to each CHIP8 key 0x0 - 0xF, and the CHIP8 key for each game controller button
+typedef struct {
+    int32_t keys[16];       // SDL keycodes, 0 if unbound
+    int8_t buttons[KEYMAP_BUTTONS]; // CHIP8 keys by SDL_GameControllerButton, -1 if unbound
+} keymap_t;
+
+void keymap_default(keymap_t *keymap);
+bool keymap_bind(keymap_t *keymap, const char *binding);
+bool keymap_bind_button(keymap_t *keymap, const char *binding);
+bool keymap_load_file(keymap_t *keymap, const char *path);
+int keymap_lookup(const keymap_t *keymap, int32_t host_key);
+int keymap_button(const keymap_t *keymap, int button);
+
+#endif // KEYMAP_H
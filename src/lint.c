@@ -0,0 +1,533 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <stdarg.h>
+#include <string.h>
+
+#include "lint.h"
+#include "opcodes.h"
+
+// Memory map flags
+#define CODE_START   0x01   // First byte of an instruction
+#define CODE_PART    0x02   // Remaining bytes of an instruction
+#define DATA_TARGET  0x04   // I is set to it
+#define TABLE_TARGET 0x08   // BNNN jumps through a table there
+#define CALL_TARGET  0x10   // Start of a subroutine
+
+#define STACK_SIZE  16      // Return addresses on the stack
+#define TABLE_JUMPS 128     // Most jumps a BNNN table can hold, V0 is a byte
+
+// Path still to trace and what I is on it, -1 when it isn't a known constant
+typedef struct {
+    uint32_t addr;
+    int32_t i;
+} path_t;
+
+// Memory an instruction stores to
+typedef struct {
+    uint32_t pc;
+    uint32_t first;
+    uint32_t last;
+} store_t;
+
+typedef struct {
+    lint_t *lint;
+    chip8_platform_t platform;
+    bool megachip;
+    bool out_of_memory;
+
+    uint8_t *ram;           // Has room to read a word past the end
+    uint32_t end;
+    uint8_t *map;
+    path_t *pending;        // Each traced instruction adds at most 1 path, BNNN tables their jumps
+    size_t pending_count;
+    size_t pending_capacity;
+    store_t *stores;
+    size_t store_count;
+    size_t store_capacity;
+
+    // Instructions newer than the VIP, by platform and Mega-Chip last
+    uint32_t uses[CHIP8_PLATFORM_XOCHIP + 2];
+    uint32_t first_use[CHIP8_PLATFORM_XOCHIP + 2];
+    uint32_t odd_targets;   // Jumps and calls to odd addresses
+    uint32_t first_odd_target;
+
+    // Subroutines in address order, the entry point is the first one
+    uint32_t *functions;
+    uint32_t function_count;
+    uint32_t *calls;        // Call targets of each function, calls[call_start[f]] on
+    uint32_t call_count;
+    uint32_t call_capacity;
+    uint32_t *call_start;
+    uint32_t *visited;      // Function index + 1 that last traced an address
+    uint8_t *state;         // 0 not looked at, 1 being looked at, 2 done
+    uint32_t *depth;
+    bool recursion;
+} checker_t;
+
+const char *lint_severity_name(lint_severity_t severity) {
+    switch(severity) {
+        case LINT_INFO:    return "info";
+        case LINT_WARNING: return "warning";
+        case LINT_ERROR:   return "error";
+    }
+    return "unknown";
+}
+
+static void report(checker_t *checker, lint_severity_t severity, uint32_t addr, const char *format, ...) {
+    lint_t *lint = checker->lint;
+
+    if(lint->count == lint->capacity) {
+        const size_t capacity = lint->capacity ? lint->capacity * 2 : 64;
+        lint_message_t *messages = realloc(lint->messages, capacity * sizeof *messages);
+        if(!messages) {
+            checker->out_of_memory = true;
+            return;
+        }
+        lint->messages = messages;
+        lint->capacity = capacity;
+    }
+
+    lint_message_t *message = &lint->messages[lint->count++];
+    message->severity = severity;
+    message->addr = addr;
+
+    va_list args;
+    va_start(args, format);
+    vsnprintf(message->text, sizeof message->text, format, args);
+    va_end(args);
+
+    lint->counts[severity]++;
+}
+
+static uint16_t word_at(const checker_t *checker, uint32_t addr) {
+    return (checker->ram[addr] << 8) | checker->ram[addr + 1];
+}
+
+static const opcode_info_t *instruction_at(const checker_t *checker, uint32_t addr) {
+    return addr + 1 < checker->end ? opcode_find(word_at(checker, addr), checker->megachip) : NULL;
+}
+
+// Instructions after which execution doesn't continue with the next one
+static bool ends_path(uint16_t opcode) {
+    return (opcode & 0xF000) == 0x1000 || (opcode & 0xF000) == 0xB000 || opcode == 0x00EE || opcode == 0x00FD;
+}
+
+static bool is_skip(uint16_t opcode) {
+    return ((opcode & 0xF000) == 0x3000) || ((opcode & 0xF000) == 0x4000) ||
+           ((opcode & 0xF00F) == 0x5000) || ((opcode & 0xF00F) == 0x9000) ||
+           ((opcode & 0xF0FF) == 0xE09E) || ((opcode & 0xF0FF) == 0xE0A1);
+}
+
+// Where a skip at addr of len bytes lands, past a whole 4 byte instruction after it
+static uint32_t skip_target(const checker_t *checker, uint32_t addr, uint8_t len) {
+    const opcode_info_t *next = instruction_at(checker, addr + len);
+    return addr + len + (next ? next->size : 2);
+}
+
+// Overlapping BNNN tables can push more jumps than there's room for, the extra ones are already traced
+static void push(checker_t *checker, uint32_t addr, int32_t i) {
+    if(checker->pending_count < checker->pending_capacity) checker->pending[checker->pending_count++] = (path_t){addr, i};
+}
+
+static void add_store(checker_t *checker, uint32_t pc, int32_t i, uint32_t count) {
+    if(i < 0) return;
+
+    if(checker->store_count == checker->store_capacity) {
+        const size_t capacity = checker->store_capacity ? checker->store_capacity * 2 : 32;
+        store_t *stores = realloc(checker->stores, capacity * sizeof *stores);
+        if(!stores) {
+            checker->out_of_memory = true;
+            return;
+        }
+        checker->stores = stores;
+        checker->store_capacity = capacity;
+    }
+
+    checker->stores[checker->store_count++] = (store_t){pc, (uint32_t)i, (uint32_t)i + count - 1};
+}
+
+static void check_target(checker_t *checker, uint32_t addr, uint32_t target, const char *what) {
+    if(target < CHIP8_ENTRY_POINT)
+        report(checker, LINT_ERROR, addr, "%s to 0x%03X, below the program at 0x200", what, target);
+    else if(target >= checker->end)
+        report(checker, LINT_WARNING, addr, "%s to 0x%03X, past the end of the ROM", what, target);
+
+    if(target & 1 && !checker->odd_targets++) checker->first_odd_target = addr;
+}
+
+// Jumps at the start of a BNNN table, the entries V0 picks
+static void push_table(checker_t *checker, uint32_t table) {
+    for(uint32_t entry = table, n = 0; n < TABLE_JUMPS && entry + 1 < checker->end; entry += 2, n++) {
+        const uint16_t opcode = word_at(checker, entry);
+        if((opcode & 0xF000) != 0x1000) break;
+        push(checker, entry, -1);
+    }
+}
+
+static void note_platform(checker_t *checker, uint32_t addr, const opcode_info_t *info) {
+    const size_t level = info->megachip ? CHIP8_PLATFORM_XOCHIP + 1 : info->platform;
+    if(level == CHIP8_PLATFORM_VIP) return;
+
+    if(!checker->uses[level]++) checker->first_use[level] = addr;
+
+    if(checker->platform != CHIP8_PLATFORM_ANY && !info->megachip && info->platform > checker->platform)
+        report(checker, LINT_ERROR, addr, "%s is a %s instruction, not on the %s", info->form,
+               chip8_platform_name(info->platform), chip8_platform_name(checker->platform));
+}
+
+// Follow every path from the entry point, marking code, where I points and what gets stored
+static void trace(checker_t *checker) {
+    push(checker, CHIP8_ENTRY_POINT, -1);
+
+    while(checker->pending_count > 0) {
+        const path_t path = checker->pending[--checker->pending_count];
+        uint32_t addr = path.addr;
+        int32_t i = path.i;
+
+        while(addr >= CHIP8_ENTRY_POINT && addr < checker->end && !(checker->map[addr] & CODE_START)) {
+            if(checker->map[addr] & CODE_PART) {
+                uint32_t start = addr;
+                while(!(checker->map[start] & CODE_START)) start--;
+                report(checker, LINT_WARNING, addr, "Execution reaches the middle of the instruction at 0x%03X", start);
+                break;
+            }
+
+            const uint16_t opcode = addr + 1 < checker->end ? word_at(checker, addr) : checker->ram[addr] << 8;
+            const uint16_t next = word_at(checker, addr + 2);
+            const opcode_info_t *info = instruction_at(checker, addr);
+            const uint16_t NNN = opcode & 0x0FFF;
+            const uint8_t X = (opcode >> 8) & 0xF;
+            const uint8_t Y = (opcode >> 4) & 0xF;
+
+            if(!info && (opcode & 0xF000) == 0) {
+                report(checker, LINT_ERROR, addr, "%04X calls machine code, which no interpreter runs", opcode);
+                break;
+            }
+            if(!info) {
+                report(checker, LINT_ERROR, addr, "%04X isn't an instruction but runs as code", opcode);
+                break;
+            }
+            if(addr + info->size > checker->end) {
+                report(checker, LINT_WARNING, addr, "%s is cut off by the end of the ROM", info->form);
+                break;
+            }
+
+            checker->map[addr] |= CODE_START;
+            for(uint8_t n = 1; n < info->size; n++) checker->map[addr + n] |= CODE_PART;
+            note_platform(checker, addr, info);
+
+            if((opcode & 0xF000) == 0x1000) {
+                check_target(checker, addr, NNN, "Jump");
+                push(checker, NNN, i);
+            } else if((opcode & 0xF000) == 0x2000) {
+                check_target(checker, addr, NNN, "Call");
+                checker->map[NNN] |= CALL_TARGET;
+                push(checker, NNN, i);
+                i = -1;     // Whatever the subroutine left there
+            } else if((opcode & 0xF000) == 0xB000) {
+                checker->map[NNN] |= TABLE_TARGET;
+                push_table(checker, NNN);
+            } else if((opcode & 0xF000) == 0xA000) {
+                checker->map[NNN] |= DATA_TARGET;
+                i = NNN;
+            } else if(opcode == 0xF000) {
+                checker->map[next] |= DATA_TARGET;
+                i = next;
+            } else if((opcode & 0xF0FF) == 0xF055) {
+                add_store(checker, addr, i, X + 1);
+                i = -1;     // Depends on the load_store quirk
+            } else if((opcode & 0xF0FF) == 0xF033) {
+                add_store(checker, addr, i, 3);
+            } else if((opcode & 0xF00F) == 0x5002) {
+                add_store(checker, addr, i, (X > Y ? X - Y : Y - X) + 1);
+            } else if((opcode & 0xF0FF) == 0xF065 || (opcode & 0xF0FF) == 0xF01E || (opcode & 0xF0FF) == 0xF029 ||
+                      (opcode & 0xF0FF) == 0xF030 || (opcode & 0xFF00) == 0x0100) {
+                i = -1;
+            } else if(is_skip(opcode)) {
+                push(checker, skip_target(checker, addr, info->size), i);
+            }
+
+            if(ends_path(opcode)) break;
+            addr += info->size;
+            if(addr >= checker->end)
+                report(checker, LINT_WARNING, addr - info->size, "Execution runs past the end of the ROM");
+        }
+    }
+}
+
+// Record the calls a subroutine makes, the paths end where it returns
+static bool trace_function(checker_t *checker, uint32_t index) {
+    const uint32_t start = checker->functions[index];
+    checker->call_start[index] = checker->call_count;
+    checker->pending_count = 0;
+    push(checker, start, -1);
+
+    while(checker->pending_count > 0) {
+        uint32_t addr = checker->pending[--checker->pending_count].addr;
+
+        while(addr >= CHIP8_ENTRY_POINT && addr < checker->end && checker->map[addr] & CODE_START &&
+              checker->visited[addr] != index + 1) {
+            const uint16_t opcode = word_at(checker, addr);
+            const uint8_t len = (checker->map[addr + 2] & CODE_PART) ? 4 : 2;
+            checker->visited[addr] = index + 1;
+
+            if((opcode & 0xF000) == 0x1000) {
+                push(checker, opcode & 0x0FFF, -1);
+            } else if((opcode & 0xF000) == 0x2000) {
+                if(checker->call_count == checker->call_capacity) {
+                    const uint32_t capacity = checker->call_capacity ? checker->call_capacity * 2 : 64;
+                    uint32_t *calls = realloc(checker->calls, capacity * sizeof *calls);
+                    if(!calls) return false;
+                    checker->calls = calls;
+                    checker->call_capacity = capacity;
+                }
+                checker->calls[checker->call_count++] = opcode & 0x0FFF;
+            } else if(opcode == 0x00EE && index == 0) {
+                report(checker, LINT_WARNING, addr, "00EE returns with nothing on the stack");
+            } else if(is_skip(opcode)) {
+                push(checker, skip_target(checker, addr, len), -1);
+            }
+
+            if(ends_path(opcode)) break;
+            addr += len;
+        }
+    }
+
+    return true;
+}
+
+static uint32_t find_function(const checker_t *checker, uint32_t addr) {
+    uint32_t low = 0, high = checker->function_count;
+
+    while(low < high) {
+        const uint32_t middle = (low + high) / 2;
+        if(checker->functions[middle] < addr) low = middle + 1;
+        else high = middle;
+    }
+
+    return low < checker->function_count && checker->functions[low] == addr ? low : UINT32_MAX;
+}
+
+// Most return addresses on the stack once the function at index is called
+static uint32_t call_depth(checker_t *checker, uint32_t index) {
+    if(checker->state[index] == 2) return checker->depth[index];
+    if(checker->state[index] == 1) {
+        if(!checker->recursion)
+            report(checker, LINT_WARNING, checker->functions[index],
+                   "The subroutine at 0x%03X can be called again before it returns, the stack can overflow",
+                   checker->functions[index]);
+        checker->recursion = true;
+        return 0;
+    }
+
+    checker->state[index] = 1;
+    uint32_t depth = 0;
+    const uint32_t last = index + 1 < checker->function_count ? checker->call_start[index + 1] : checker->call_count;
+    for(uint32_t call = checker->call_start[index]; call < last; call++) {
+        const uint32_t callee = find_function(checker, checker->calls[call]);
+        if(callee == UINT32_MAX) continue;
+
+        const uint32_t callee_depth = call_depth(checker, callee) + 1;
+        if(callee_depth > depth) depth = callee_depth;
+    }
+
+    checker->state[index] = 2;
+    checker->depth[index] = depth;
+    return depth;
+}
+
+static bool check_stack(checker_t *checker) {
+    checker->function_count = 0;
+    for(uint32_t addr = CHIP8_ENTRY_POINT; addr < checker->end; addr++)
+        if(addr == CHIP8_ENTRY_POINT || (checker->map[addr] & (CALL_TARGET | CODE_START)) == (CALL_TARGET | CODE_START))
+            checker->functions[checker->function_count++] = addr;
+
+    for(uint32_t index = 0; index < checker->function_count; index++)
+        if(!trace_function(checker, index)) return false;
+
+    const uint32_t depth = checker->end > CHIP8_ENTRY_POINT ? call_depth(checker, 0) : 0;
+    if(depth > STACK_SIZE)
+        report(checker, LINT_ERROR, CHIP8_ENTRY_POINT, "Calls nest up to %u deep, the stack holds %u return addresses",
+               depth, STACK_SIZE);
+    else if(!checker->recursion)
+        report(checker, LINT_INFO, CHIP8_ENTRY_POINT, "Calls nest up to %u deep", depth);
+
+    return true;
+}
+
+static void check_stores(checker_t *checker) {
+    for(size_t n = 0; n < checker->store_count; n++) {
+        const store_t *store = &checker->stores[n];
+
+        for(uint32_t addr = store->first; addr <= store->last && addr < checker->end; addr++) {
+            if(checker->map[addr] & (CODE_START | CODE_PART)) {
+                report(checker, LINT_WARNING, store->pc, "%04X writes into the code at 0x%03X, self-modifying code",
+                       word_at(checker, store->pc), addr);
+                break;
+            }
+        }
+    }
+}
+
+// Untraced bytes nothing points at that decode as instructions up to a jump or return
+static void check_unreachable(checker_t *checker) {
+    uint32_t addr = CHIP8_ENTRY_POINT;
+
+    while(addr < checker->end) {
+        if(checker->map[addr] & (CODE_START | CODE_PART)) {
+            addr++;
+            continue;
+        }
+
+        uint32_t run_end = addr;
+        bool pointed_at = false;
+        while(run_end < checker->end && !(checker->map[run_end] & (CODE_START | CODE_PART))) {
+            if(checker->map[run_end] & (DATA_TARGET | TABLE_TARGET)) pointed_at = true;
+            run_end++;
+        }
+        if(pointed_at) {
+            addr = run_end;
+            continue;
+        }
+
+        uint32_t pc = addr;
+        uint32_t instructions = 0;
+        bool ended = false;
+        const opcode_info_t *info;
+        while(!ended && pc < run_end && (info = instruction_at(checker, pc)) && pc + info->size <= run_end) {
+            ended = ends_path(word_at(checker, pc));
+            instructions++;
+            pc += info->size;
+        }
+
+        if(ended && instructions >= 2) {
+            report(checker, LINT_WARNING, addr, "0x%03X-0x%03X looks like code but nothing jumps or calls there",
+                   addr, pc - 1);
+            addr = pc;
+        } else {
+            addr += 2;
+        }
+    }
+}
+
+// Fine on the VIP, some interpreters only fetch whole words and many ROMs do it throughout, so once for all of them
+static void check_alignment(checker_t *checker) {
+    if(!checker->odd_targets) return;
+
+    report(checker, LINT_WARNING, checker->first_odd_target,
+           "Jumps and calls to odd addresses (%u, the first is here), not every interpreter runs code there",
+           checker->odd_targets);
+}
+
+static void check_platforms(checker_t *checker, size_t rom_size) {
+    static const char *const names[] = {NULL, NULL, "CHIP-48", "SUPER-CHIP", "XO-CHIP", "Mega-Chip"};
+
+    for(size_t level = CHIP8_PLATFORM_CHIP48; level < sizeof names / sizeof names[0]; level++) {
+        if(!checker->uses[level] || checker->platform != CHIP8_PLATFORM_ANY) continue;
+
+        report(checker, LINT_INFO, checker->first_use[level], "Needs the %s for %u instruction%s, the first is here",
+               names[level], checker->uses[level], checker->uses[level] == 1 ? "" : "s");
+    }
+
+    if(checker->platform != CHIP8_PLATFORM_ANY && checker->platform < CHIP8_PLATFORM_XOCHIP &&
+       rom_size > CHIP8_RAM_SIZE - CHIP8_ENTRY_POINT)
+        report(checker, LINT_ERROR, CHIP8_ENTRY_POINT, "The ROM is %zu bytes, more than the %s's 4KB memory holds",
+               rom_size, chip8_platform_name(checker->platform));
+}
+
+// Messages by address, in the order they were found for each address
+static bool sort_messages(lint_t *lint) {
+    if(lint->count < 2) return true;
+
+    uint32_t *starts = calloc(CHIP8_XO_RAM_SIZE + 1, sizeof *starts);
+    lint_message_t *sorted = malloc(lint->count * sizeof *sorted);
+    if(!starts || !sorted) {
+        free(starts);
+        free(sorted);
+        return false;
+    }
+
+    for(size_t n = 0; n < lint->count; n++) starts[lint->messages[n].addr + 1]++;
+    for(uint32_t addr = 0; addr < CHIP8_XO_RAM_SIZE; addr++) starts[addr + 1] += starts[addr];
+    for(size_t n = 0; n < lint->count; n++) sorted[starts[lint->messages[n].addr]++] = lint->messages[n];
+
+    free(starts);
+    free(lint->messages);
+    lint->messages = sorted;
+    lint->capacity = lint->count;
+    return true;
+}
+
+static void free_checker(checker_t *checker) {
+    free(checker->ram);
+    free(checker->map);
+    free(checker->pending);
+    free(checker->stores);
+    free(checker->functions);
+    free(checker->calls);
+    free(checker->call_start);
+    free(checker->visited);
+    free(checker->state);
+    free(checker->depth);
+}
+
+bool lint_rom(const uint8_t *rom, size_t rom_size, chip8_platform_t platform, bool megachip, lint_t *lint) {
+    *lint = (lint_t){0};
+
+    if(rom_size > CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT) {
+        fprintf(stderr, "ROM is too large to check, max size is %u bytes\n", CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT);
+        return false;
+    }
+
+    checker_t checker = {
+        .lint = lint,
+        .platform = platform,
+        .megachip = megachip,
+        .end = CHIP8_ENTRY_POINT + rom_size,
+        .ram = calloc(CHIP8_XO_RAM_SIZE + 4, 1),
+        .map = calloc(CHIP8_XO_RAM_SIZE + 4, 1),
+        .pending = calloc(CHIP8_XO_RAM_SIZE + TABLE_JUMPS + 1, sizeof *checker.pending),
+        .pending_capacity = CHIP8_XO_RAM_SIZE + TABLE_JUMPS + 1,
+        .functions = calloc(CHIP8_XO_RAM_SIZE, sizeof *checker.functions),
+        .call_start = calloc(CHIP8_XO_RAM_SIZE, sizeof *checker.call_start),
+        .visited = calloc(CHIP8_XO_RAM_SIZE, sizeof *checker.visited),
+        .state = calloc(CHIP8_XO_RAM_SIZE, sizeof *checker.state),
+        .depth = calloc(CHIP8_XO_RAM_SIZE, sizeof *checker.depth),
+    };
+
+    bool ok = checker.ram && checker.map && checker.pending && checker.functions && checker.call_start &&
+              checker.visited && checker.state && checker.depth;
+    if(ok) {
+        memcpy(&checker.ram[CHIP8_ENTRY_POINT], rom, rom_size);
+
+        trace(&checker);
+        ok = check_stack(&checker);
+        check_stores(&checker);
+        check_unreachable(&checker);
+        check_alignment(&checker);
+        check_platforms(&checker, rom_size);
+        ok = ok && !checker.out_of_memory && sort_messages(lint);
+    }
+
+    free_checker(&checker);
+    if(!ok) {
+        fprintf(stderr, "Out of memory\n");
+        lint_free(lint);
+    }
+    return ok;
+}
+
+void lint_free(lint_t *lint) {
+    free(lint->messages);
+    *lint = (lint_t){0};
+}
+
+void lint_write(const lint_t *lint, const char *name, lint_severity_t min_severity, FILE *out) {
+    for(size_t n = 0; n < lint->count; n++) {
+        const lint_message_t *message = &lint->messages[n];
+        if(message->severity < min_severity) continue;
+        fprintf(out, "%s:0x%03X: %s: %s\n", name, message->addr, lint_severity_name(message->severity), message->text);
+    }
+}
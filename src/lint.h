@@ -0,0 +1,43 @@
+#ifndef LINT_H
+#define LINT_H
+
+#include <stdio.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Static checks of a ROM for its authors, from the code traced from the entry point like the disassembler does
+// Nothing runs, so values only known at run time (BNNN jumps, I after FX1E) aren't followed
+typedef enum {
+    LINT_INFO,
+    LINT_WARNING,
+    LINT_ERROR,
+} lint_severity_t;
+
+typedef struct {
+    lint_severity_t severity;
+    uint16_t addr;
+    char text[112];
+} lint_message_t;
+
+typedef struct {
+    lint_message_t *messages;   // By address, messages about the whole ROM are at the entry point
+    size_t count;
+    size_t capacity;
+    size_t counts[3];           // Messages per severity
+} lint_t;
+
+// platform is the profile the ROM is meant for, instructions newer than it are errors
+// With CHIP8_PLATFORM_ANY they are only noted. megachip decodes the Mega-Chip instructions
+// Returns false if the ROM doesn't fit in memory or there's no memory for the checks
+bool lint_rom(const uint8_t *rom, size_t rom_size, chip8_platform_t platform, bool megachip, lint_t *lint);
+void lint_free(lint_t *lint);
+
+const char *lint_severity_name(lint_severity_t severity);
+
+// "name:0x0204: warning: ..." lines like compiler messages, for the messages at min_severity and above
+void lint_write(const lint_t *lint, const char *name, lint_severity_t min_severity, FILE *out);
+
+#endif // LINT_H
@@ -0,0 +1,143 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdarg.h>
+#include <string.h>
+#include <time.h>
+
+#include "log.h"
+
+#define LINE_SIZE 2048
+
+static const char *level_names[] = {
+    [CHIP8_LOG_DEBUG] = "debug",
+    [CHIP8_LOG_INFO]  = "info",
+    [CHIP8_LOG_WARN]  = "warn",
+    [CHIP8_LOG_ERROR] = "error",
+};
+
+// Settings for the whole program, there's only one stderr
+static chip8_log_level_t min_level = CHIP8_LOG_INFO;
+static log_format_t log_format = LOG_TEXT;
+
+void log_configure(chip8_log_level_t level, log_format_t format) {
+    min_level = level;
+    log_format = format;
+}
+
+bool log_parse_level(const char *name, chip8_log_level_t *level) {
+    for(size_t i = 0; i < sizeof level_names / sizeof level_names[0]; i++) {
+        if(strcmp(level_names[i], name) != 0) continue;
+
+        *level = (chip8_log_level_t)i;
+        return true;
+    }
+
+    // warning spelled out is fine too
+    if(strcmp(name, "warning") == 0) {
+        *level = CHIP8_LOG_WARN;
+        return true;
+    }
+
+    fprintf(stderr, "Unknown log level %s, expected debug, info, warn or error\n", name);
+    return false;
+}
+
+bool log_parse_format(const char *name, log_format_t *format) {
+    if(strcmp(name, "text") == 0) *format = LOG_TEXT;
+    else if(strcmp(name, "json") == 0) *format = LOG_JSON;
+    else {
+        fprintf(stderr, "Unknown log format %s, expected text or json\n", name);
+        return false;
+    }
+
+    return true;
+}
+
+bool log_enabled(chip8_log_level_t level) {
+    return level >= min_level;
+}
+
+bool log_is_json(void) {
+    return log_format == LOG_JSON;
+}
+
+// JSON string contents, control characters escaped
+static size_t json_escape(char *out, size_t size, const char *text) {
+    size_t len = 0;
+
+    for(const unsigned char *c = (const unsigned char *)text; *c && len + 7 < size; c++) {
+        if(*c == '"' || *c == '\\') {
+            out[len++] = '\\';
+            out[len++] = *c;
+        } else if(*c < 0x20) {
+            len += snprintf(&out[len], size - len, "\\u%04x", *c);
+        } else {
+            out[len++] = *c;
+        }
+    }
+
+    out[len] = '\0';
+    return len;
+}
+
+static void write_line(chip8_log_level_t level, const char *subsystem, const char *message) {
+    char line[LINE_SIZE * 2];
+
+    // Messages used to end in a newline, they don't need one anymore
+    size_t message_len = strlen(message);
+    while(message_len > 0 && message[message_len - 1] == '\n') message_len--;
+
+    char trimmed[LINE_SIZE];
+    snprintf(trimmed, sizeof trimmed, "%.*s", (int)message_len, message);
+
+    if(log_format == LOG_JSON) {
+        struct timespec now;
+        struct tm utc;
+        char escaped[LINE_SIZE * 2 - 128];
+
+        timespec_get(&now, TIME_UTC);
+        gmtime_r(&now.tv_sec, &utc);
+        json_escape(escaped, sizeof escaped, trimmed);
+
+        snprintf(line, sizeof line,
+                 "{\"time\":\"%04d-%02d-%02dT%02d:%02d:%02d.%03ldZ\",\"level\":\"%s\","
+                 "\"subsystem\":\"%s\",\"message\":\"%s\"}\n",
+                 utc.tm_year + 1900, utc.tm_mon + 1, utc.tm_mday, utc.tm_hour, utc.tm_min, utc.tm_sec,
+                 now.tv_nsec / 1000000, level_names[level], subsystem, escaped);
+    } else {
+        snprintf(line, sizeof line, "[%s] %s: %s\n", level_names[level], subsystem, trimmed);
+    }
+
+    // One write per line, so lines from the emulation and window threads don't get mixed up
+    fputs(line, stderr);
+}
+
+void log_write(chip8_log_level_t level, const char *subsystem, const char *fmt, ...) {
+    if(!log_enabled(level)) return;
+
+    char message[LINE_SIZE];
+    va_list args;
+
+    va_start(args, fmt);
+    vsnprintf(message, sizeof message, fmt, args);
+    va_end(args);
+
+    write_line(level, subsystem, message);
+}
+
+void log_chip8(void *userdata, chip8_log_level_t level, const char *subsystem, const char *message) {
+    (void)userdata;
+    if(log_enabled(level)) write_line(level, subsystem, message);
+}
+
+void log_fault(const chip8_t *chip8) {
+    if(!log_enabled(CHIP8_LOG_ERROR)) return;
+
+    // A JSON log needs the report on one line
+    if(log_format == LOG_JSON)
+        log_write(CHIP8_LOG_ERROR, "cpu", "Machine fault: %s at 0x%04X (opcode %04X) in %s", chip8_fault_name(chip8->fault),
+                  chip8->PC, chip8->inst.opcode, chip8->rom_name ? chip8->rom_name : "ROM");
+    else
+        chip8_print_fault(chip8, stderr);
+}
@@ -0,0 +1,31 @@
+#ifndef LOG_H
+#define LOG_H
+
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Leveled log lines on stderr, tagged with the subsystem they come from (cpu, display, audio, input, rom, ...)
+// Text lines look like "[info] audio: Running without sound", JSON ones are an object per line:
+//   {"time":"2026-10-14T09:30:00.125Z","level":"info","subsystem":"audio","message":"Running without sound"}
+typedef enum {
+    LOG_TEXT,
+    LOG_JSON,
+} log_format_t;
+
+// Lines below level are dropped, the default is info in text
+void log_configure(chip8_log_level_t level, log_format_t format);
+bool log_parse_level(const char *name, chip8_log_level_t *level);
+bool log_parse_format(const char *name, log_format_t *format);
+bool log_enabled(chip8_log_level_t level);
+bool log_is_json(void);
+
+void log_write(chip8_log_level_t level, const char *subsystem, const char *fmt, ...);
+
+// Report of why the machine stopped, chip8_print_fault() in text and one cpu line in JSON
+void log_fault(const chip8_t *chip8);
+
+// For chip8_set_log(), the core's messages go through the same log
+void log_chip8(void *userdata, chip8_log_level_t level, const char *subsystem, const char *message);
+
+#endif // LOG_H
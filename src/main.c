@@ -0,0 +1,3634 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <time.h>
+#include <stdatomic.h>
+#include <SDL.h>
+
+#include "chip8.h"
+#include "config.h"
+#include "config_file.h"
+#include "renderer.h"
+#include "audio.h"
+#include "input.h"
+#include "cli.h"
+#include "debugger.h"
+#include "debug_server.h"
+#include "web_server.h"
+#include "script.h"
+#include "cheat.h"
+#include "disasm.h"
+#include "opcodes.h"
+#include "lint.h"
+#include "asm.h"
+#include "octo.h"
+#include "rewind.h"
+#include "image.h"
+#include "movie.h"
+#include "netplay.h"
+#include "trace.h"
+#include "profile.h"
+#include "coverage.h"
+#include "compare.h"
+#include "reftrace.h"
+#include "romdb.h"
+#include "menu.h"
+#include "builtin.h"
+#include "romload.h"
+#include "rpl_file.h"
+#include "volume_file.h"
+#include "datadir.h"
+#include "postmortem.h"
+#include "repl.h"
+#include "playlist.h"
+#include "tuning_file.h"
+#include "watch.h"
+#include "log.h"
+
+// Rewind snapshots are taken every few frames, 30 per second
+#define REWIND_FRAME_INTERVAL 2
+
+// Volume hotkey step, 32 steps from silent to full
+#define VOLUME_STEP 1024
+
+// Frames the timing runs back to back to make up for a hiccup. After a longer gap, like sitting in the
+// debugger, a minimized window or the laptop sleeping, it starts counting from now instead of catching up
+#define MAX_CATCH_UP_FRAMES 5
+
+// A host too slow to draw every frame still draws at least one in this many
+#define MAX_FRAME_SKIP 5
+
+// --watch looks at the ROM file four times a second
+#define WATCH_INTERVAL_FRAMES 15
+
+// chip8 bench runs this many instructions without --cycles, and fails --baseline when this many percent slower
+#define BENCH_DEFAULT_CYCLES 50000000
+#define BENCH_TOLERANCE 10
+
+// Seconds chip8 attract shows a ROM for without --duration or a time in the playlist
+#define ATTRACT_DEFAULT_SECONDS 60
+
+// Fastest --speed, instructions per second
+#define MAX_SPEED 100000000
+
+// Frontend hotkeys that act while held down
+typedef struct {
+    bool rewind;            // Backspace, step backwards through recent states
+    bool turbo;             // Tab, fast forward
+    bool menu;              // F1 was pressed, leave the ROM for the menu
+    bool quit;              // Escape was pressed or the window closed, the ROM didn't quit by itself
+    uint8_t overlay;        // F8 cycles it, see overlay_mode_t
+    bool focus_paused;      // Paused by --pause-on-focus-loss, resumes when the window gets focus back
+    char dropped[FILENAME_MAX]; // ROM file dropped on the window, leave the ROM to run that one
+} hotkeys_t;
+
+// How running a ROM in the window ended
+typedef enum {
+    SESSION_QUIT,
+    SESSION_MENU,           // Back to the ROM menu
+    SESSION_FAILED,         // The ROM couldn't be loaded or set up
+    SESSION_DROPPED,        // A file was dropped on the window to run next
+    SESSION_NEXT,           // Attract mode is done with the ROM
+} session_end_t;
+
+// Emulated time, how many instructions a frame runs is up to the machine, see chip8_run_flat_frame()
+typedef struct {
+    uint32_t frames;        // 60Hz frames emulated
+    uint64_t instructions;  // Total instructions executed
+} frame_clock_t;
+
+// XO-CHIP audio pattern last handed to the audio backend
+typedef struct {
+    bool on;
+    uint8_t pattern[16];
+    uint8_t pitch;
+} audio_pattern_t;
+
+// Debug overlay drawn over the screen by renderers that have one
+typedef enum {
+    OVERLAY_OFF,
+    OVERLAY_SPEED,          // Frames and instructions per second, timers
+    OVERLAY_REGISTERS,      // Speed, PC, I and the V registers
+    OVERLAY_MODES,
+} overlay_mode_t;
+
+// Window frame counts for --stats and the overlay, the rates are worked out every second
+typedef struct {
+    uint64_t since;         // Performance counter at the last reset
+    uint32_t drawn;         // Frames handed to the renderer
+    uint32_t skipped;       // Frames with a new screen that weren't drawn to catch up
+    uint32_t emulated;      // Emulated frames at the last reset
+    uint64_t instructions;  // Instructions executed at the last reset
+    uint32_t fps;           // Rates over the last second
+    uint32_t skipped_ps;
+    uint32_t emulated_ps;
+    uint64_t ips;
+    char text[64];          // Shown in the title, "" until the first second is over
+} frame_stats_t;
+
+// Emulation thread of a window session, everything in here is guarded by lock
+// The main thread takes the lock to read input into the machine and copy the screen out
+typedef struct {
+    SDL_mutex *lock;
+    SDL_Thread *thread;
+    atomic_int waiting;     // The main thread wants the lock, the emulation thread lets go after its frame
+    bool stop;              // Set by the main thread when the session ends
+    chip8_t *chip8;
+    const config_t *config;
+    const hotkeys_t *hotkeys;
+    frame_clock_t clock;
+    movie_t *movie;         // Active movie, NULL once playback finished
+    netplay_t *netplay;     // NULL without netplay
+    trace_t *trace;
+    profile_t *profile;
+    coverage_t *coverage;
+    script_t *script;
+    cheat_list_t *cheats;
+    rewind_t *rewind;
+    bool rewind_enabled;
+    gif_t *gif;
+} emulation_t;
+
+void print_usage(FILE *out, const char *program) {
+    fprintf(out,
+        "Usage: %s [run] [options] [rom_path]\n"
+        "       %s debug [options] <rom_path>\n"
+        "       %s tui [options] <rom_path>\n"
+        "       %s repl [options] [rom_path]\n"
+        "       %s disasm [--syntax raw|octo] [--cfg] [--symbols <file>] [--output <file>] <rom_path>\n"
+        "       %s asm [-o <file>] [--symbols <file>] <source>\n"
+        "       %s info <rom_path>\n"
+        "       %s lint [--platform <name>] [--megachip] [--show <level>] [--fail-on <level>] <rom_path>\n"
+        "       %s opcodes [--format markdown|json] [--platform <name>] [--megachip] [--output <file>]\n"
+        "       %s bench [options] [--save <file>] [--baseline <file>] <rom_path>\n"
+        "       %s batch <rom_dir> [options] [--out <dir>] [--baseline <dir>] [--wav]\n"
+        "       %s attract <playlist|rom_dir> [options] [--duration <seconds>]\n"
+        "       %s compare <a.state> <b.state>\n"
+        "       %s compare [options] --vs <quirks> <rom_path>\n"
+        "       %s compare [options] --ref <trace> [--ref-format csv|json] [--ref-columns <list>] <rom_path>\n"
+        "\n"
+        "rom_path is a file, - for stdin, an http(s):// URL or a zip archive, <archive>.zip:<name> picks a file in it\n"
+        "\n"
+        "Commands:\n"
+        "  run                  Run a ROM (default), without a ROM pick one from a menu\n"
+        "  debug                Step through a ROM in an interactive debugger\n"
+        "  tui                  Full screen terminal debugger with live disassembly\n"
+        "  repl                 Type instructions or opcodes and run them one at a time on an empty machine, or\n"
+        "                       after the ROM, to see what they change, .help lists the commands\n"
+        "  disasm               Disassemble a ROM with labels for jump targets and data, --cfg for a DOT graph\n"
+        "  asm                  Assemble a source file in the disasm syntax, or Octo source (.o8), into a ROM\n"
+        "  info                 Show the ROM's hash and recommended settings from the ROM database\n"
+        "  lint                 Check a ROM without running it: jump and call targets, stack depth, instructions\n"
+        "                       newer than --platform, unreachable and self-modifying code. Levels are info,\n"
+        "                       warning and error, --show hides messages below one (default info), the exit code\n"
+        "                       is 1 if there are messages at --fail-on or above (default error)\n"
+        "  opcodes              Print a reference of the instructions the emulator implements, all of them or\n"
+        "                       the ones of a --platform (vip, chip48, schip, xochip), --megachip adds Mega-Chip\n"
+        "  bench                Run a ROM flat out for --cycles instructions and report the speed per opcode class\n"
+        "  batch                Run every ROM in a directory headless for --frames or --cycles, write a screenshot\n"
+        "                       and <rom>.json stats (result, fault, coverage, opcodes run) per ROM and a summary.txt\n"
+        "                       to --out (default batch). --baseline <dir> compares with an earlier run's summary\n"
+        "                       and fails if a ROM's result or last frame changed. The seed is 0 unless given.\n"
+        "                       --wav also writes each ROM's sound to <rom>.wav\n"
+        "  attract              Unattended display: run the ROMs of a directory or playlist file in the window one\n"
+        "                       after the other, each for --duration seconds (default 60) or the seconds after its\n"
+        "                       path in the playlist, then start over. <rom_path>.movie plays as a ROM's demo. F1\n"
+        "                       skips to the next ROM, a ROM that exits or faults makes way for it, Escape stops\n"
+        "  compare              Diff two save states, or run a ROM and stop at the first instruction where it differs\n"
+        "                       from a copy with the quirks changed by --vs (a preset or <name>=<0|1>,...) or from\n"
+        "                       another emulator's trace given with --ref, --cycles or --frames limit the run\n"
+        "                       (default 600 frames with --vs, the whole trace with --ref)\n"
+        "\n"
+        "Options:\n"
+        "  --speed <n>          Instructions per second (default 700)\n"
+        "  --timing <flat|vip>  flat runs --speed instructions of any kind, vip gives each instruction the time\n"
+        "                       the COSMAC VIP interpreter took, for ROMs timed on the real machine (default flat)\n"
+        "  --scale <n>          Window scale factor (default 20)\n"
+        "  --renderer <name>    Rendering backend: sdl, term, stdio (default sdl). stdio is for frontends in other\n"
+        "                       languages, frames go to stdout and keys come from stdin, see render_stdio.c\n"
+        "  --audio <name>       Audio backend: sdl, none (default sdl)\n"
+        "  --platform <name>    Machine to be compatible with: vip, chip48, schip, xochip. Sets the quirks,\n"
+        "                       speed and memory, and faults on instructions the machine doesn't have\n"
+        "  --quirks <preset>    Interpreter behaviour: modern, cosmac, schip, xochip (default modern)\n"
+        "  --quirk <name>=<0|1> Toggle a single quirk: shift, load_store, jump, vf_reset, clipping,\n"
+        "                       key_press, display_wait\n"
+        "  --palette <name>     Color scheme: default, green, lcd, amber, contrast (default default)\n"
+        "  --fg <color>         Foreground color RRGGBB[AA] (default FFFFFF)\n"
+        "  --bg <color>         Background color RRGGBB[AA] (default 000000)\n"
+        "  --xochip             Enable XO-CHIP extensions (64KB memory, 2 display planes)\n"
+        "  --plane2 <color>     XO-CHIP plane 2 color RRGGBB[AA] (default FF6600)\n"
+        "  --blend <color>      XO-CHIP color for both planes RRGGBB[AA] (default 662200)\n"
+        "  --megachip           Enable Mega-Chip extensions (256x192 colors, digitized sound), on for .mc8 ROMs\n"
+        "  --outlines           Draw pixel outlines\n"
+        "  --rotate <degrees>   Turn the picture clockwise for sideways screens: 0, 90, 180, 270 (default 0)\n"
+        "  --scaling <mode>     Picture size in the window: integer (whole multiples of a pixel), fit (as big as\n"
+        "                       it fits), stretch (all of the window) (default integer)\n"
+        "  --letterbox <color>  Color around the picture RRGGBB[AA] (default: the background color)\n"
+        "  --filter <name>      Screen look: none, crt, lcd (default none)\n"
+        "  --scanlines          Darken the bottom of every pixel row like a CRT\n"
+        "  --pixel-grid         Leave gaps between the pixels like an LCD\n"
+        "  --curvature          Bend the picture like a CRT tube\n"
+        "  --phosphor <percent> Brightness a pixel keeps each frame after going dark, 0-95. Ghosting hides\n"
+        "                       the flicker of sprites drawn every frame (default 0)\n"
+        "  --deflicker <mode>   Blend the last frames against XOR flicker: off, or (pixels on in any of them),\n"
+        "                       average (their colors mixed), with :2 or :3 frames, e.g. or:3 (default off)\n"
+        "  --fullscreen         Start in fullscreen mode\n"
+        "  --no-vsync           Disable vsync\n"
+        "  --freq <hz>          Buzzer frequency (default 440)\n"
+        "  --volume <n>         Buzzer volume 0-32767 (default 3000)\n"
+        "  --mute               Start with the buzzer muted, F6 toggles it\n"
+        "  --volume-file <file> Where the volume keys save the volume, none to not save it\n"
+        "                       (default ~/.local/share/chip8/volume)\n"
+        "  --wave <name>        Buzzer waveform: square, sine, triangle, noise (default square)\n"
+        "  --attack <ms>        Buzzer fade in time, 0-1000 (default 5)\n"
+        "  --release <ms>       Buzzer fade out time, 0-1000 (default 5)\n"
+        "  --key <k>:<name>     Bind CHIP8 key 0-F to a key name, e.g. 5:Up\n"
+        "  --keymap <file>      Load key bindings from a file\n"
+        "  --button <k>:<name>  Bind CHIP8 key 0-F to a controller button (a, b, x, y, dpup, ...), e.g. 5:x\n"
+        "  --seed <n>           Seed for CXNN random numbers, makes runs reproducible (default: time)\n"
+        "  --record <file>      Record keypad input to a movie file\n"
+        "  --play <file>        Play back keypad input from a movie file\n"
+        "  --netplay-host <[host:]port> Wait for a second player and play the ROM together, host defaults to\n"
+        "                       127.0.0.1, 0.0.0.0 lets players on other machines join\n"
+        "  --netplay-join <host:port> Join the player hosting at host:port, with the same ROM\n"
+        "  --netplay-delay <n>  Frames keypad input is sent ahead to hide network latency, 0-30 (default 2)\n"
+        "  --trace <file>       Log every executed instruction and register changes, - for stdout\n"
+        "  --trace-range <a-b>  Only log instructions at hex addresses a to b, e.g. 200-2FF\n"
+        "  --trace-ops <list>   Only log these opcode classes (first hex digit), e.g. 8,D\n"
+        "  --profile            Count executions and time per address and opcode, report hotspots on exit\n"
+        "  --profile-pprof <file> Also write the profile for pprof\n"
+        "  --coverage <file>    Write a map of the bytes run as code and used as data on exit, - for stdout\n"
+        "  --coverage-html <file> Write the coverage as an HTML heatmap\n"
+        "  --script <file.lua>  Run a Lua script hooked into frames, instructions, memory and keys (make LUA=1)\n"
+        "  --debug-on-fault     Open the debugger when the ROM faults instead of exiting\n"
+        "  --crash-dir <dir>    Where a report with the state, trace and screen goes when the ROM faults, none to\n"
+        "                       not write one (default ~/.local/share/chip8/crashes, none in headless mode)\n"
+        "  --debug-listen <[host:]port> Start paused and serve the JSON remote debug protocol, host defaults to 127.0.0.1\n"
+        "  --serve <[host:]port> Run on a web server, browsers show the screen and send keys over a WebSocket\n"
+        "                       and /metrics has counters for Prometheus\n"
+        "  --serve-restart      Start the ROM over when it exits or faults instead of stopping the server\n"
+        "  --broadcast <[host:]port> Let any number of browsers watch the window session, without keys, also /metrics\n"
+        "  --strict-memory      Fault on writes below 0x200 and accesses past the end of memory\n"
+        "  --ram-fill <zero|ff|random> Memory at power on outside the fonts and the ROM, random uses --seed\n"
+        "                       (default zero)\n"
+        "  --strict-init        Fault on reads from 0x200 up of memory nothing wrote, like RAM past the ROM\n"
+        "  --decode-cache       Decode each instruction once and reuse it until its memory changes, faster\n"
+        "  --no-romdb           Don't apply the recommended settings for known ROMs\n"
+        "  --state <file>       Save state file for F5 (save) and F9 (load), default <rom_path>.state\n"
+        "  --rpl-file <file>    Where SUPER-CHIP RPL flags (high scores) are kept, none to forget them on exit\n"
+        "                       (default ~/.local/share/chip8/rpl_flags)\n"
+        "  --save-ram <ranges>  Keep these memory regions per ROM between runs like battery backed RAM, e.g.\n"
+        "                       2F0-2FF,E00-E0F in hex, none to not keep any (default from the ROM database)\n"
+        "  --tuning-file <file> Where speed, quirks, colors and --deflicker given for a ROM are kept for its next\n"
+        "                       runs, none to not keep them (default ~/.local/share/chip8/tuning)\n"
+        "  --forget-tuning      Go back to the ROM's default speed, quirks, colors and frame blending\n"
+        "  --symbols <file>     Labels and source lines for the debugger and --trace, default <rom_path>.sym if it\n"
+        "                       exists, .o8 source brings its own\n"
+        "  --cheats <file>      Freeze and poke memory with the cheats in file, default <rom_path>.cheats if it exists\n"
+        "  --rewind <seconds>   How far back holding Backspace rewinds, 0 disables (default 10)\n"
+        "  --turbo <factor>     Speed multiplier while Tab is held (default 4)\n"
+        "  --watch              Reload and reset when the ROM file, or the Octo source, is saved again\n"
+        "  --benchmark          Run uncapped and print the achieved speed on exit\n"
+        "  --pause-on-focus-loss Pause while the window doesn't have focus or is minimized\n"
+        "  --stats              Show frames drawn, skipped and emulated per second in the title\n"
+        "  --log-level <level>  Least important messages to log: debug, info, warn, error (default info)\n"
+        "  --log-format <name>  Log lines on stderr as text or json, one object per line (default text)\n"
+        "  --headless           Run without window or sound, then dump the screen and exit\n"
+        "  --frames <n>         Frames to run in headless mode (default 600)\n"
+        "  --cycles <n>         Instructions to run in headless mode instead of frames\n"
+        "  --dump <file>        Headless screen dump, PNG for .png files, text otherwise (default -, stdout)\n"
+        "  --gif <file>         Record an animated GIF from the start\n"
+        "  --wav <file>         Headless mode: write the buzzer, XO-CHIP patterns and Mega-Chip sounds to a WAV\n"
+        "                       file (44100Hz, 16 bit mono), in emulated time\n"
+        "  --capture-scale <n>  Image pixels per CHIP8 pixel for screenshots, GIFs and dumps (default 4)\n"
+        "  --config <file>      Settings file (default ~/.config/chip8/config.toml)\n"
+        "  --rom-dir <dir>      Directory to look in for ROMs not found as given\n"
+        "  --builtin <name>     Run a ROM built into the program instead of a file, see --builtin list\n"
+        "  --help               Show this help\n",
+        program, program, program, program, program, program, program, program, program, program, program, program, program, program, program);
+}
+
+// --platform settings, quirks and speed as on the original machines
+static const struct {
+    const char *name;
+    chip8_platform_t platform;
+    const char *quirks;
+    uint32_t insts_per_second;
+    bool xochip;
+} platforms[] = {
+    {"vip",    CHIP8_PLATFORM_VIP,    "cosmac", 600,   false},
+    {"chip48", CHIP8_PLATFORM_CHIP48, "schip",  1800,  false},
+    {"schip",  CHIP8_PLATFORM_SCHIP,  "schip",  1800,  false},
+    {"xochip", CHIP8_PLATFORM_XOCHIP, "xochip", 60000, true},
+};
+
+bool parse_platform(const char *name, chip8_platform_t *platform) {
+    for(size_t i = 0; i < sizeof platforms / sizeof platforms[0]; i++) {
+        if(strcmp(platforms[i].name, name) == 0) {
+            *platform = platforms[i].platform;
+            return true;
+        }
+    }
+
+    fprintf(stderr, "Unknown platform %s, expected vip, chip48, schip or xochip\n", name);
+    return false;
+}
+
+bool parse_ram_fill(const char *name, chip8_ram_fill_t *fill) {
+    const chip8_ram_fill_t fills[] = {CHIP8_RAM_ZERO, CHIP8_RAM_ONES, CHIP8_RAM_RANDOM};
+    for(size_t i = 0; i < sizeof fills / sizeof fills[0]; i++) {
+        if(strcmp(chip8_ram_fill_name(fills[i]), name) == 0) {
+            *fill = fills[i];
+            return true;
+        }
+    }
+
+    fprintf(stderr, "Unknown RAM fill %s, expected zero, ff or random\n", name);
+    return false;
+}
+
+// Parse a "<name>=<0|1>" quirk toggle
+bool parse_quirk(quirks_t *quirks, const char *toggle) {
+    char name[32];
+    const char *sep = strchr(toggle, '=');
+
+    if(!sep || (size_t)(sep - toggle) >= sizeof name || (strcmp(sep + 1, "0") != 0 && strcmp(sep + 1, "1") != 0)) {
+        fprintf(stderr, "Invalid quirk %s, expected <name>=<0|1>\n", toggle);
+        return false;
+    }
+
+    memcpy(name, toggle, sep - toggle);
+    name[sep - toggle] = '\0';
+
+    if(!chip8_set_quirk(quirks, name, sep[1] == '1')) {
+        fprintf(stderr, "Unknown quirk %s\n", name);
+        return false;
+    }
+
+    return true;
+}
+
+// Built-in color schemes: background, foreground, XO-CHIP plane 2 and both planes
+static const struct {
+    const char *name;
+    uint32_t colors[4];
+} palettes[] = {
+    {"default",  {0x000000FF, 0xFFFFFFFF, 0xFF6600FF, 0x662200FF}},
+    {"green",    {0x001200FF, 0x33FF33FF, 0x1E8C1EFF, 0x0B400BFF}},     // Green phosphor monitor
+    {"lcd",      {0x9BBC0FFF, 0x0F380FFF, 0x306230FF, 0x8BAC0FFF}},     // Handheld LCD
+    {"amber",    {0x140C00FF, 0xFFB000FF, 0xB36B00FF, 0x5C3700FF}},     // Amber monitor
+    {"contrast", {0x000000FF, 0xFFFFFFFF, 0xFFFF00FF, 0x00FFFFFF}},
+};
+
+bool apply_palette(config_t *config, const char *name) {
+    for(size_t i = 0; i < sizeof palettes / sizeof palettes[0]; i++) {
+        if(strcmp(palettes[i].name, name) != 0) continue;
+
+        config->bg_color = palettes[i].colors[0];
+        config->fg_color = palettes[i].colors[1];
+        config->plane2_color = palettes[i].colors[2];
+        config->blend_color = palettes[i].colors[3];
+        return true;
+    }
+
+    fprintf(stderr, "Unknown palette %s\n", name);
+    return false;
+}
+
+bool parse_scaling(const char *name, scaling_t *scaling) {
+    static const struct {
+        const char *name;
+        scaling_t scaling;
+    } modes[] = {
+        {"integer", SCALE_INTEGER}, {"fit", SCALE_FIT}, {"stretch", SCALE_STRETCH},
+    };
+
+    for(size_t i = 0; i < sizeof modes / sizeof modes[0]; i++) {
+        if(strcmp(modes[i].name, name) != 0) continue;
+
+        *scaling = modes[i].scaling;
+        return true;
+    }
+
+    fprintf(stderr, "Unknown scaling %s\n", name);
+    return false;
+}
+
+// Screen filter presets, --scanlines, --pixel-grid, --curvature and --phosphor set the parts one by one
+static const struct {
+    const char *name;
+    bool scanlines;
+    bool pixel_grid;
+    bool curvature;
+    uint32_t phosphor;
+} filters[] = {
+    {"none", false, false, false, 0},
+    {"crt",  true,  false, true,  55},  // Tube with visible scanlines and a slow phosphor
+    {"lcd",  false, true,  false, 40},  // Handheld LCD, the pixel grid and a bit of ghosting
+};
+
+bool apply_filter(config_t *config, const char *name) {
+    for(size_t i = 0; i < sizeof filters / sizeof filters[0]; i++) {
+        if(strcmp(filters[i].name, name) != 0) continue;
+
+        config->scanlines = filters[i].scanlines;
+        config->pixel_grid = filters[i].pixel_grid;
+        config->curvature = filters[i].curvature;
+        config->phosphor = filters[i].phosphor;
+        return true;
+    }
+
+    fprintf(stderr, "Unknown filter %s\n", name);
+    return false;
+}
+
+bool parse_waveform(const char *name, waveform_t *waveform) {
+    static const struct {
+        const char *name;
+        waveform_t waveform;
+    } waveforms[] = {
+        {"square", WAVE_SQUARE}, {"sine", WAVE_SINE}, {"triangle", WAVE_TRIANGLE}, {"noise", WAVE_NOISE},
+    };
+
+    for(size_t i = 0; i < sizeof waveforms / sizeof waveforms[0]; i++) {
+        if(strcmp(waveforms[i].name, name) != 0) continue;
+
+        *waveform = waveforms[i].waveform;
+        return true;
+    }
+
+    fprintf(stderr, "Unknown waveform %s\n", name);
+    return false;
+}
+
+// Built-in ROM by name, "list" prints the names instead
+const builtin_rom_t *find_builtin(const char *name) {
+    const builtin_rom_t *rom = builtin_find(name);
+    if(rom) return rom;
+
+    FILE *out = strcmp(name, "list") == 0 ? stdout : stderr;
+    if(out == stderr) fprintf(stderr, "Unknown built-in ROM %s\n", name);
+
+    fprintf(out, "Built-in ROMs:");
+    for(size_t i = 0; i < builtin_rom_count; i++) fprintf(out, " %s", builtin_roms[i].name);
+    fprintf(out, "\n");
+
+    if(out == stdout) exit(EXIT_SUCCESS);
+    return NULL;
+}
+
+// Apply options from argv[first] onwards, the ROM path is the only positional argument
+bool parse_options(config_t *config, const char *program, int first, int argc, char **argv) {
+    for (int i = first; i < argc; i++) {
+        const char *value = NULL;
+        uint32_t num = 0;
+
+        if(cli_flag("help", argv[i])) {
+            print_usage(stdout, program);
+            exit(EXIT_SUCCESS);
+        } else if(cli_option("config", argc, argv, &i, &value)) {
+            // Already loaded by load_config_file()
+            if(!value) return false;
+        } else if(cli_option("rom-dir", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->rom_dir = value;
+        } else if(cli_option("builtin", argc, argv, &i, &value)) {
+            if(!value || !(config->builtin = find_builtin(value))) return false;
+        } else if(cli_option("speed", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("speed", value, 60, MAX_SPEED, &config->insts_per_second)) return false;
+        } else if(cli_option("timing", argc, argv, &i, &value)) {
+            if(!value) return false;
+            if(strcmp(value, "flat") == 0) {
+                config->timing = CHIP8_TIMING_FLAT;
+            } else if(strcmp(value, "vip") == 0) {
+                config->timing = CHIP8_TIMING_VIP;
+            } else {
+                fprintf(stderr, "Unknown timing %s, expected flat or vip\n", value);
+                return false;
+            }
+        } else if(cli_option("scale", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("scale", value, 1, 100, &config->scale_factor)) return false;
+        } else if(cli_option("renderer", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->renderer = value;
+        } else if(cli_option("audio", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->audio = value;
+        } else if(cli_option("platform", argc, argv, &i, &value)) {
+            if(!value || !parse_platform(value, &config->platform)) return false;
+        } else if(cli_option("quirks", argc, argv, &i, &value)) {
+            if(!value) return false;
+            if(!chip8_quirks_preset(value, &config->quirks)) {
+                fprintf(stderr, "Unknown quirks preset %s\n", value);
+                return false;
+            }
+        } else if(cli_option("quirk", argc, argv, &i, &value)) {
+            if(!value || !parse_quirk(&config->quirks, value)) return false;
+        } else if(cli_option("palette", argc, argv, &i, &value)) {
+            if(!value || !apply_palette(config, value)) return false;
+        } else if(cli_option("fg", argc, argv, &i, &value)) {
+            if(!cli_parse_color("fg", value, &config->fg_color)) return false;
+        } else if(cli_option("bg", argc, argv, &i, &value)) {
+            if(!cli_parse_color("bg", value, &config->bg_color)) return false;
+        } else if(cli_flag("xochip", argv[i])) {
+            config->xochip = true;
+        } else if(cli_flag("megachip", argv[i])) {
+            config->megachip = true;
+        } else if(cli_option("plane2", argc, argv, &i, &value)) {
+            if(!cli_parse_color("plane2", value, &config->plane2_color)) return false;
+        } else if(cli_option("blend", argc, argv, &i, &value)) {
+            if(!cli_parse_color("blend", value, &config->blend_color)) return false;
+        } else if(cli_flag("outlines", argv[i])) {
+            config->pixel_outlines = true;
+        } else if(cli_option("rotate", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("rotate", value, 0, 270, &config->rotation)) return false;
+            if(config->rotation % 90 != 0) {
+                fprintf(stderr, "Invalid value %s for --rotate, expected 0, 90, 180 or 270\n", value);
+                return false;
+            }
+        } else if(cli_option("scaling", argc, argv, &i, &value)) {
+            if(!value || !parse_scaling(value, &config->scaling)) return false;
+        } else if(cli_option("letterbox", argc, argv, &i, &value)) {
+            if(!cli_parse_color("letterbox", value, &config->letterbox_color)) return false;
+        } else if(cli_option("filter", argc, argv, &i, &value)) {
+            if(!value || !apply_filter(config, value)) return false;
+        } else if(cli_flag("scanlines", argv[i])) {
+            config->scanlines = true;
+        } else if(cli_flag("pixel-grid", argv[i])) {
+            config->pixel_grid = true;
+        } else if(cli_flag("curvature", argv[i])) {
+            config->curvature = true;
+        } else if(cli_option("phosphor", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("phosphor", value, 0, 95, &config->phosphor)) return false;
+        } else if(cli_option("deflicker", argc, argv, &i, &value)) {
+            if(!value) return false;
+            if(!tuning_parse_deflicker(value, &config->deflicker_frames, &config->deflicker_average)) {
+                fprintf(stderr, "Invalid value %s for --deflicker, expected off, or or average, "
+                                "optionally with :2 or :3 frames\n", value);
+                return false;
+            }
+        } else if(cli_flag("fullscreen", argv[i])) {
+            config->fullscreen = true;
+        } else if(cli_flag("no-vsync", argv[i])) {
+            config->vsync = false;
+        } else if(cli_option("freq", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("freq", value, 20, 20000, &config->square_wave_freq)) return false;
+        } else if(cli_option("volume", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("volume", value, 0, INT16_MAX, &num)) return false;
+            config->volume = (int16_t)num;
+            config->volume_set = true;
+        } else if(cli_flag("mute", argv[i])) {
+            config->muted = true;
+            config->volume_set = true;
+        } else if(cli_option("volume-file", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->volume_path = value;
+        } else if(cli_option("wave", argc, argv, &i, &value)) {
+            if(!value || !parse_waveform(value, &config->waveform)) return false;
+        } else if(cli_option("attack", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("attack", value, 0, 1000, &config->attack_ms)) return false;
+        } else if(cli_option("release", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("release", value, 0, 1000, &config->release_ms)) return false;
+        } else if(cli_option("keymap", argc, argv, &i, &value)) {
+            if(!value || !keymap_load_file(&config->keymap, value)) return false;
+        } else if(cli_option("key", argc, argv, &i, &value)) {
+            if(!value || !keymap_bind(&config->keymap, value)) return false;
+        } else if(cli_option("button", argc, argv, &i, &value)) {
+            if(!value || !keymap_bind_button(&config->keymap, value)) return false;
+        } else if(cli_option("turbo", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("turbo", value, 1, 100, &config->turbo_factor)) return false;
+        } else if(cli_flag("watch", argv[i])) {
+            config->watch = true;
+        } else if(cli_flag("benchmark", argv[i])) {
+            // Presenting would wait for the monitor
+            config->benchmark = true;
+            config->vsync = false;
+        } else if(cli_flag("pause-on-focus-loss", argv[i])) {
+            config->pause_on_focus_loss = true;
+        } else if(cli_flag("stats", argv[i])) {
+            config->show_stats = true;
+        } else if(cli_option("log-level", argc, argv, &i, &value)) {
+            if(!value || !log_parse_level(value, &config->log_level)) return false;
+        } else if(cli_option("log-format", argc, argv, &i, &value)) {
+            if(!value || !log_parse_format(value, &config->log_format)) return false;
+        } else if(cli_flag("debug-on-fault", argv[i])) {
+            config->debug_on_fault = true;
+        } else if(cli_option("crash-dir", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->crash_dir = value;
+        } else if(cli_option("debug-listen", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->debug_listen = value;
+        } else if(cli_option("serve", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->serve = value;
+        } else if(cli_flag("serve-restart", argv[i])) {
+            config->serve_restart = true;
+        } else if(cli_option("broadcast", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->broadcast = value;
+        } else if(cli_flag("decode-cache", argv[i])) {
+            config->decode_cache = true;
+        } else if(cli_flag("strict-memory", argv[i])) {
+            config->strict_memory = true;
+        } else if(cli_option("ram-fill", argc, argv, &i, &value)) {
+            if(!value || !parse_ram_fill(value, &config->ram_fill)) return false;
+        } else if(cli_flag("strict-init", argv[i])) {
+            config->strict_init = true;
+        } else if(cli_flag("no-romdb", argv[i])) {
+            config->use_romdb = false;
+        } else if(cli_flag("headless", argv[i])) {
+            config->headless = true;
+        } else if(cli_option("frames", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("frames", value, 1, UINT32_MAX, &config->headless_frames)) return false;
+        } else if(cli_option("cycles", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("cycles", value, 1, UINT32_MAX, &config->headless_cycles)) return false;
+        } else if(cli_option("dump", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->dump_path = value;
+        } else if(cli_option("capture-scale", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("capture-scale", value, 1, 32, &config->capture_scale)) return false;
+        } else if(cli_option("gif", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->gif_path = value;
+        } else if(cli_option("wav", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->wav_path = value;
+        } else if(cli_option("rewind", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("rewind", value, 0, 600, &config->rewind_seconds)) return false;
+        } else if(cli_option("seed", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("seed", value, 0, UINT32_MAX, &config->seed)) return false;
+        } else if(cli_option("record", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->record_path = value;
+        } else if(cli_option("play", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->play_path = value;
+        } else if(cli_option("netplay-host", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->netplay_host = value;
+        } else if(cli_option("netplay-join", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->netplay_join = value;
+        } else if(cli_option("netplay-delay", argc, argv, &i, &value)) {
+            if(!cli_parse_uint("netplay-delay", value, 0, NETPLAY_MAX_DELAY, &config->netplay_delay)) return false;
+        } else if(cli_option("trace", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->trace_path = value;
+        } else if(cli_option("trace-range", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->trace_range = value;
+        } else if(cli_option("trace-ops", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->trace_ops = value;
+        } else if(cli_flag("profile", argv[i])) {
+            config->profile = true;
+        } else if(cli_option("script", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->script_path = value;
+        } else if(cli_option("profile-pprof", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->profile = true;
+            config->profile_path = value;
+        } else if(cli_option("coverage", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->coverage_path = value;
+        } else if(cli_option("coverage-html", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->coverage_html_path = value;
+        } else if(cli_option("state", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->state_path = value;
+        } else if(cli_option("rpl-file", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->rpl_path = value;
+        } else if(cli_option("save-ram", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->save_ram = strcmp(value, "none") == 0 ? NULL : value;
+        } else if(cli_option("tuning-file", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->tuning_path = value;
+        } else if(cli_flag("forget-tuning", argv[i])) {
+            config->forget_tuning = true;
+        } else if(cli_option("symbols", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->symbols_path = value;
+        } else if(cli_option("cheats", argc, argv, &i, &value)) {
+            if(!value) return false;
+            config->cheat_path = value;
+            config->cheats_required = true;
+        } else if(strncmp(argv[i], "--", 2) == 0) {
+            fprintf(stderr, "Unknown option %s\n", argv[i]);
+            return false;
+        } else if(!config->rom_name) {
+            config->rom_name = argv[i];
+        } else {
+            fprintf(stderr, "Unexpected argument %s\n", argv[i]);
+            return false;
+        }
+    }
+
+    return true;
+}
+
+// Settings file from --config, or the default one if it exists
+// rom_key picks the [rom.<name>] tables that apply, NULL skips them all
+bool load_config_file(config_t *config, const char *rom_key, const char *program, int first, int argc, char **argv) {
+    const char *path = NULL;
+    char default_path[FILENAME_MAX];
+
+    for(int i = first; i < argc; i++) {
+        const char *value = NULL;
+        if(cli_option("config", argc, argv, &i, &value)) {
+            if(!value) return false;
+            path = value;
+        }
+    }
+
+    if(!path) {
+        if(!config_file_default_path(default_path, sizeof default_path)) return true;
+
+        FILE *file = fopen(default_path, "r");
+        if(!file) return true;
+        fclose(file);
+
+        path = default_path;
+    }
+
+    int file_argc;
+    char **file_argv;
+    if(!config_file_args(path, rom_key, &file_argc, &file_argv)) return false;
+
+    if(!parse_options(config, program, 0, file_argc, file_argv)) {
+        fprintf(stderr, "Invalid setting in config file %s\n", path);
+        return false;
+    }
+
+    return true;
+}
+
+// ROMs not found as given are looked up in the ROM directory, ~/ is expanded there
+const char *find_rom(const char *rom_name, const char *rom_dir) {
+    static char rom_path[FILENAME_MAX];
+
+    if(romload_is_stdin(rom_name) || romload_is_url(rom_name)) return rom_name;
+
+    FILE *rom = fopen(rom_name, "rb");
+    if(rom || !rom_dir || rom_name[0] == '/') {
+        if(rom) fclose(rom);
+        return rom_name;
+    }
+
+    const char *home = getenv("HOME");
+    if(strncmp(rom_dir, "~/", 2) == 0 && home) snprintf(rom_path, sizeof rom_path, "%s/%s/%s", home, rom_dir + 2, rom_name);
+    else snprintf(rom_path, sizeof rom_path, "%s/%s", rom_dir, rom_name);
+
+    return rom_path;
+}
+
+// ROM bytes for a source, lookup_rom() and load_machine() both need them and stdin can only be read once
+// keep holds on to them for the next call, failures too so the error is only printed once
+const uint8_t *read_rom(const char *source, size_t *size, bool keep) {
+    static char cached_source[FILENAME_MAX];
+    static uint8_t *cached_rom;
+    static size_t cached_size;
+    static bool cached;
+
+    if(!cached || strcmp(source, cached_source) != 0) {
+        free(cached_rom);
+        cached_rom = romload_read(source, &cached_size);
+        snprintf(cached_source, sizeof cached_source, "%s", source);
+    }
+
+    cached = keep;
+    *size = cached_size;
+    return cached_rom;
+}
+
+// The ROM to run, built in or from config->rom_name
+const uint8_t *config_rom(const config_t *config, size_t *size, bool keep) {
+    if(!config->builtin) return read_rom(config->rom_name, size, keep);
+
+    *size = config->builtin->size;
+    return config->builtin->data;
+}
+
+// Recommended settings for ROMs in the database, NULL for unknown or unreadable ROMs
+const romdb_entry_t *lookup_rom(const config_t *config) {
+    size_t rom_size = 0;
+    const uint8_t *rom = config_rom(config, &rom_size, true);
+
+    return rom ? romdb_find(rom, rom_size) : NULL;
+}
+
+void apply_platform(config_t *config, chip8_platform_t platform) {
+    for(size_t i = 0; i < sizeof platforms / sizeof platforms[0]; i++) {
+        if(platforms[i].platform != platform) continue;
+
+        chip8_quirks_preset(platforms[i].quirks, &config->quirks);
+        config->insts_per_second = platforms[i].insts_per_second;
+        config->xochip = platforms[i].xochip;
+    }
+}
+
+void apply_rom_settings(config_t *config, const romdb_entry_t *entry) {
+    chip8_quirks_preset(entry->quirks, &config->quirks);
+    if(entry->insts_per_second) config->insts_per_second = entry->insts_per_second;
+    if(strcmp(entry->platform, "xochip") == 0) config->xochip = true;
+    if(strcmp(entry->platform, "megachip") == 0) config->megachip = true;
+
+    if(entry->has_colors) {
+        config->fg_color = entry->fg_color;
+        config->bg_color = entry->bg_color;
+    }
+
+    if(entry->save_ram) config->save_ram = entry->save_ram;
+}
+
+// Speed, quirks, colors and frame blending kept from earlier runs of the ROM
+// A platform given for this run brings its own speed and quirks
+void apply_tuning(config_t *config, const tuning_t *tuning, bool platform) {
+    if(tuning->has_speed && !platform) config->insts_per_second = tuning->insts_per_second;
+    if(tuning->has_quirks && !platform) config->quirks = tuning->quirks;
+
+    if(tuning->has_colors) {
+        config->fg_color = tuning->colors[0];
+        config->bg_color = tuning->colors[1];
+        config->plane2_color = tuning->colors[2];
+        config->blend_color = tuning->colors[3];
+    }
+    if(tuning->has_deflicker) {
+        config->deflicker_frames = tuning->deflicker_frames;
+        config->deflicker_average = tuning->deflicker_average;
+    }
+}
+
+// Add what the command line changed to what was kept for the ROM
+bool save_tuning(const config_t *config, const char *path, const char *sha1, tuning_t *kept) {
+    const tuning_t *given = &config->tuning;
+    if(!given->has_speed && !given->has_quirks && !given->has_colors && !given->has_deflicker &&
+       !config->forget_tuning) return true;
+
+    if(config->forget_tuning) *kept = (tuning_t) {0};
+    if(given->has_speed) {
+        kept->has_speed = true;
+        kept->insts_per_second = given->insts_per_second;
+    }
+    if(given->has_quirks) {
+        kept->has_quirks = true;
+        kept->quirks = given->quirks;
+    }
+    if(given->has_colors) {
+        kept->has_colors = true;
+        memcpy(kept->colors, given->colors, sizeof kept->colors);
+    }
+    if(given->has_deflicker) {
+        kept->has_deflicker = true;
+        kept->deflicker_frames = given->deflicker_frames;
+        kept->deflicker_average = given->deflicker_average;
+    }
+
+    return tuning_file_save(path, sha1, kept);
+}
+
+void set_defaults(config_t *config) {
+    *config = (config_t) {
+        .window_width = CHIP8_DISPLAY_WIDTH,
+        .window_height = CHIP8_DISPLAY_HEIGHT,
+        .bg_color = 0x000000FF,
+        .fg_color = 0xFFFFFFFF,
+        .plane2_color = 0xFF6600FF,
+        .blend_color = 0x662200FF,
+        .scale_factor = 20,
+        .pixel_outlines = false,
+        .deflicker_frames = 1,
+        .insts_per_second = 700,    // Number of instructions to emulate in 1 second
+        .square_wave_freq = 440,    // 440hz for middle A
+        .audio_sample_rate = 44100, // CD quality or so
+        .volume = 3000,             // INT16_MAX would be max volume
+        .waveform = WAVE_SQUARE,
+        .attack_ms = 5,
+        .release_ms = 5,
+        .vsync = true,
+        .fullscreen = false,
+        .renderer = "sdl",
+        .audio = "sdl",
+        .rom_name = NULL,
+        .xochip = false,
+        .megachip = false,
+        .rewind_seconds = 10,
+        .turbo_factor = 4,
+        .watch = false,
+        .benchmark = false,
+        .show_stats = false,
+        .pause_on_focus_loss = false,
+        .log_level = CHIP8_LOG_INFO,
+        .log_format = LOG_TEXT,
+        .headless = false,
+        .headless_frames = 600,     // 10 seconds
+        .headless_cycles = 0,
+        .dump_path = "-",
+        .seed = (uint32_t)time(NULL),
+        .netplay_delay = NETPLAY_DEFAULT_DELAY,
+        .capture_scale = 4,
+        .use_romdb = true,
+    };
+
+    keymap_default(&config->keymap);
+    chip8_quirks_preset("modern", &config->quirks);
+}
+
+// Settings file first so the command line overrides it
+bool load_settings(config_t *config, const char *rom_name, const char *rom_key, int first, int argc, char **argv) {
+    if(!load_config_file(config, rom_key, argv[0], first, argc, argv)) return false;
+
+    // What the command line changes is kept for the ROM, what the settings file says is in the file already
+    const uint32_t speed = config->insts_per_second;
+    const quirks_t quirks = config->quirks;
+    const uint32_t colors[4] = {config->fg_color, config->bg_color, config->plane2_color, config->blend_color};
+    const uint32_t deflicker_frames = config->deflicker_frames;
+    const bool deflicker_average = config->deflicker_average;
+
+    if(!parse_options(config, argv[0], first, argc, argv)) return false;
+    log_configure(config->log_level, config->log_format);
+
+    config->tuning = (tuning_t) {
+        .has_speed = config->insts_per_second != speed,
+        .insts_per_second = config->insts_per_second,
+        .has_quirks = memcmp(&config->quirks, &quirks, sizeof quirks) != 0,
+        .quirks = config->quirks,
+        .has_colors = config->fg_color != colors[0] || config->bg_color != colors[1] ||
+                      config->plane2_color != colors[2] || config->blend_color != colors[3],
+        .colors = {config->fg_color, config->bg_color, config->plane2_color, config->blend_color},
+        .has_deflicker = config->deflicker_frames != deflicker_frames ||
+                         config->deflicker_average != deflicker_average,
+        .deflicker_frames = config->deflicker_frames,
+        .deflicker_average = config->deflicker_average,
+    };
+
+    if(rom_name) {
+        config->rom_name = rom_name;
+        config->builtin = NULL;
+    } else if(config->builtin) {
+        if(config->rom_name) {
+            fprintf(stderr, "--builtin can't be used with a ROM file\n");
+            return false;
+        }
+
+        // Save states and captures are named after the built-in ROM
+        config->rom_name = config->builtin->name;
+    } else if(config->rom_name) {
+        config->rom_name = find_rom(config->rom_name, config->rom_dir);
+    }
+
+    return true;
+}
+
+// File name of a ROM for the [rom.<name>] settings file tables, without directory
+// For a file in a zip archive that's the name in the archive
+const char *rom_key(const char *rom_name) {
+    const char *name = romload_file_name(rom_name);
+    const char *sep = strrchr(name, ':');
+    if(sep) name = sep + 1;
+    sep = strrchr(name, '/');
+
+    return sep ? sep + 1 : name;
+}
+
+// Parse arguments from argv[first] onwards, on top of the settings file
+// rom_name replaces the ROM from the arguments if set, e.g. for a ROM picked from the menu
+bool init_config(config_t *config, const char *rom_name, int first, int argc, char **argv) {
+    set_defaults(config);
+    if(!load_settings(config, rom_name, NULL, first, argc, argv)) return false;
+
+    // Once the ROM is known start over: known ROMs start from their recommended settings,
+    // then the platform's, the tuning kept from earlier runs and the settings file's table for the ROM,
+    // anything set explicitly still overrides them
+    if(config->rom_name) {
+        const char *key = rom_key(config->rom_name);
+        const romdb_entry_t *entry = config->use_romdb ? lookup_rom(config) : NULL;
+        const chip8_platform_t platform = config->platform;
+
+        // Tuning from earlier runs, by the ROM's SHA-1 so renamed copies keep it
+        // Headless runs are scripts, they run the same for everyone
+        static char default_tuning_path[4096];
+        const char *tuning_path = config->headless ? "none" : config->tuning_path;
+        if(!tuning_path && tuning_file_default_path(default_tuning_path, sizeof default_tuning_path))
+            tuning_path = default_tuning_path;
+        else if(tuning_path && strcmp(tuning_path, "none") == 0)
+            tuning_path = NULL;
+
+        char sha1[ROMDB_SHA1_HEX_SIZE] = "";
+        size_t rom_size = 0;
+        const uint8_t *rom = tuning_path ? config_rom(config, &rom_size, true) : NULL;
+        if(rom) romdb_sha1(rom, rom_size, sha1);
+
+        tuning_t kept = {0};
+        if(sha1[0] && !config->forget_tuning) tuning_file_load(tuning_path, sha1, &kept);
+
+        // Mega-Chip ROMs can only be told apart by their extension
+        const char *dot = strrchr(romload_file_name(config->rom_name), '.');
+        const bool megachip = dot && (strcmp(dot, ".mc8") == 0 || strcmp(dot, ".MC8") == 0);
+
+        set_defaults(config);
+        if(entry) apply_rom_settings(config, entry);
+        apply_platform(config, platform);
+        if(megachip) config->megachip = true;
+        apply_tuning(config, &kept, platform != CHIP8_PLATFORM_ANY);
+
+        if(!load_settings(config, rom_name, key, first, argc, argv)) return false;
+
+        if(sha1[0] && !save_tuning(config, tuning_path, sha1, &kept))
+            log_write(CHIP8_LOG_WARN, "rom", "Couldn't save the tuning to %s", tuning_path);
+    }
+
+    // Mega-Chip's 256x192 screen is 4:3, the window keeps the CHIP8 width
+    if(config->megachip) config->window_height = config->window_width * CHIP8_MEGA_HEIGHT / CHIP8_MEGA_WIDTH;
+
+    if(config->record_path && config->play_path) {
+        fprintf(stderr, "--record and --play can't be used together\n");
+        return false;
+    }
+
+    // The frontend protocol has stdin and stdout to itself
+    const bool stdio_out = (config->trace_path && strcmp(config->trace_path, "-") == 0) ||
+                           (config->coverage_path && strcmp(config->coverage_path, "-") == 0);
+    if(strcmp(config->renderer, "stdio") == 0 && !config->headless && (stdio_out || config->debug_on_fault)) {
+        fprintf(stderr, "--renderer stdio talks to the frontend on stdin and stdout, --trace -, --coverage - and "
+                        "--debug-on-fault need them too\n");
+        return false;
+    }
+
+    if(config->wav_path && !config->headless) {
+        fprintf(stderr, "--wav records the sound of headless runs, it needs --headless\n");
+        return false;
+    }
+
+    if(config->broadcast && (config->headless || config->debug_listen || config->serve)) {
+        fprintf(stderr, "--broadcast shows the window session, it can't be used with --headless, --debug-listen or --serve\n");
+        return false;
+    }
+
+    if(config->netplay_host && config->netplay_join) {
+        fprintf(stderr, "--netplay-host and --netplay-join can't be used together\n");
+        return false;
+    }
+    if((config->netplay_host || config->netplay_join) &&
+       (config->record_path || config->play_path || config->headless || config->debug_listen || config->serve)) {
+        fprintf(stderr, "Netplay runs in the window, without movies\n");
+        return false;
+    }
+
+    if(config->save_ram && !save_ram_parse(config->save_ram, &config->save_ram_regions)) return false;
+
+    // Save states go next to the ROM unless given
+    static char default_state_path[4096];
+    if(!config->state_path && config->rom_name) {
+        snprintf(default_state_path, sizeof default_state_path, "%s.state", romload_file_name(config->rom_name));
+        config->state_path = default_state_path;
+    }
+
+    // So do cheats, which are optional unless the file was given
+    static char default_cheat_path[4096];
+    if(!config->cheat_path && config->rom_name) {
+        snprintf(default_cheat_path, sizeof default_cheat_path, "%s.cheats", romload_file_name(config->rom_name));
+        config->cheat_path = default_cheat_path;
+    }
+
+    // RPL flags of all ROMs share one file per user, "none" doesn't keep them
+    static char default_rpl_path[4096];
+    if(!config->rpl_path && rpl_file_default_path(default_rpl_path, sizeof default_rpl_path))
+        config->rpl_path = default_rpl_path;
+    else if(config->rpl_path && strcmp(config->rpl_path, "none") == 0)
+        config->rpl_path = NULL;
+
+    // The volume from last time, unless this run says otherwise
+    static char default_volume_path[4096];
+    if(!config->volume_path && volume_file_default_path(default_volume_path, sizeof default_volume_path))
+        config->volume_path = default_volume_path;
+    else if(config->volume_path && strcmp(config->volume_path, "none") == 0)
+        config->volume_path = NULL;
+
+    // A --wav of a headless run comes out the same for everyone
+    if(config->volume_path && !config->volume_set && !config->headless)
+        volume_file_load(config->volume_path, &config->volume, &config->muted);
+
+    // Crash reports are for bug reports from players, scripts ask for them
+    static char default_crash_dir[4096];
+    if(!config->crash_dir && !config->headless && postmortem_default_dir(default_crash_dir, sizeof default_crash_dir))
+        config->crash_dir = default_crash_dir;
+    else if(config->crash_dir && strcmp(config->crash_dir, "none") == 0)
+        config->crash_dir = NULL;
+
+    config->argc = argc;
+    config->argv = argv;
+    return true;
+}
+
+// Available rendering backends
+static const struct {
+    const char *name;
+    void (*setup)(renderer_t *renderer);
+} renderers[] = {
+    {"sdl",  sdl_renderer},
+    {"term", term_renderer},
+    {"stdio", stdio_renderer},
+};
+
+bool init_renderer(renderer_t *renderer, const config_t *config) {
+    for(size_t i = 0; i < sizeof renderers / sizeof renderers[0]; i++) {
+        if(strcmp(renderers[i].name, config->renderer) == 0) {
+            renderers[i].setup(renderer);
+            return true;
+        }
+    }
+
+    log_write(CHIP8_LOG_ERROR, "display", "Unknown renderer %s", config->renderer);
+    return false;
+}
+
+// Available audio backends
+static const struct {
+    const char *name;
+    void (*setup)(audio_t *audio);
+} audio_backends[] = {
+    {"sdl",  sdl_audio},
+    {"none", null_audio},
+};
+
+bool init_audio(audio_t *audio, const config_t *config) {
+    for(size_t i = 0; i < sizeof audio_backends / sizeof audio_backends[0]; i++) {
+        if(strcmp(audio_backends[i].name, config->audio) == 0) {
+            audio_backends[i].setup(audio);
+            return true;
+        }
+    }
+
+    log_write(CHIP8_LOG_ERROR, "audio", "Unknown audio backend %s", config->audio);
+    return false;
+}
+
+bool init_sdl(void) {
+
+    // Video is initialized by the SDL renderer, other backends don't need a window
+    if(SDL_Init(SDL_INIT_EVENTS | SDL_INIT_AUDIO | SDL_INIT_TIMER) != 0) {
+        log_write(CHIP8_LOG_ERROR, "main", "Could not initalize SDL subsystems! %s", SDL_GetError());
+        return false;
+    }
+
+    return true;
+}
+
+// Screenshots and GIFs use the display colors
+void capture_palette(const config_t *config, uint32_t palette[4]) {
+    palette[0] = config->bg_color;
+    palette[1] = config->fg_color;
+    palette[2] = config->plane2_color;
+    palette[3] = config->blend_color;
+}
+
+// First unused <rom>-NNN.<extension> file name for hotkey captures
+bool next_capture_path(const config_t *config, const char *extension, char *path, size_t size) {
+    for(uint32_t i = 1; i < 1000; i++) {
+        snprintf(path, size, "%s-%03u.%s", romload_file_name(config->rom_name), i, extension);
+
+        FILE *file = fopen(path, "rb");
+        if(!file) return true;
+        fclose(file);
+    }
+
+    log_write(CHIP8_LOG_ERROR, "capture", "Too many %s captures for %s", extension, config->rom_name);
+    return false;
+}
+
+bool save_screenshot(const chip8_t *chip8, const config_t *config, const char *path) {
+    uint32_t palette[4];
+    capture_palette(config, palette);
+
+    uint32_t width, height;
+    uint8_t *rgb = image_from_display(chip8, palette, config->capture_scale, &width, &height);
+    const bool ok = rgb && image_write_png(path, rgb, width, height);
+
+    free(rgb);
+    return ok;
+}
+
+bool start_gif(gif_t *gif, const chip8_t *chip8, const config_t *config, const char *path) {
+    uint32_t palette[4];
+    capture_palette(config, palette);
+
+    return image_gif_open(gif, path, chip8, palette, config->capture_scale);
+}
+
+// Movies and netplay need every frame to run from the state the one before left
+bool in_lockstep(const config_t *config) {
+    return config->record_path || config->play_path || config->netplay_host || config->netplay_join;
+}
+
+// Jumping to another machine state would desync a movie or the other player's machine
+bool blocks_jump(const config_t *config) {
+    if(!in_lockstep(config)) return false;
+
+    if(config->netplay_host || config->netplay_join)
+        log_write(CHIP8_LOG_WARN, "netplay", "Loading states and resetting are disabled during netplay");
+    else
+        log_write(CHIP8_LOG_WARN, "movie", "Loading states and resetting are disabled while recording or playing a movie");
+    return true;
+}
+
+// Read the ROM again and reset, built-in ROMs and stdin can't change so those are only reset
+bool reload_rom(chip8_t *chip8, const config_t *config) {
+    if(!config->builtin && !romload_is_stdin(config->rom_name)) {
+        size_t rom_size = 0;
+        uint8_t *rom = romload_read(config->rom_name, &rom_size);
+        const bool ok = rom && chip8_load_rom(chip8, rom, rom_size);
+        free(rom);
+        if(!ok) return false;
+    }
+
+    chip8_reset(chip8);
+    return true;
+}
+
+// Battery backed memory of the ROM, kept out of movies and netplay like the RPL flags
+void load_save_ram(chip8_t *chip8, const config_t *config) {
+    if(!config->save_ram_regions.count || in_lockstep(config)) return;
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    char path[FILENAME_MAX];
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+    if(save_ram_default_path(sha1, path, sizeof path) && save_ram_load(&config->save_ram_regions, path, chip8))
+        log_write(CHIP8_LOG_INFO, "rom", "Loaded saved memory from %s", path);
+}
+
+void save_save_ram(const chip8_t *chip8, const config_t *config) {
+    if(!config->save_ram_regions.count || in_lockstep(config)) return;
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    char path[FILENAME_MAX] = "";
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+    if(!save_ram_default_path(sha1, path, sizeof path) || !save_ram_save(&config->save_ram_regions, path, chip8))
+        log_write(CHIP8_LOG_WARN, "rom", "Couldn't save memory to %s", path);
+}
+
+// F3 and --watch, a ROM that doesn't load or assemble leaves the running one alone
+void reload_from_disk(chip8_t *chip8, const config_t *config) {
+    if(blocks_jump(config)) return;
+
+    save_save_ram(chip8, config);
+    if(reload_rom(chip8, config)) log_write(CHIP8_LOG_INFO, "rom", "Reloaded %s", config->rom_name);
+    else log_write(CHIP8_LOG_WARN, "rom", "Couldn't reload %s, still running the one loaded before", config->rom_name);
+    load_save_ram(chip8, config);
+}
+
+// Volume and mute hotkeys, the result is saved for the next run
+void change_volume(audio_t *audio, config_t *config, int32_t delta, bool toggle_mute) {
+    if(toggle_mute) {
+        config->muted = !config->muted;
+    } else {
+        const int32_t volume = config->volume + delta;
+        config->volume = volume < 0 ? 0 : volume > INT16_MAX ? INT16_MAX : (int16_t)volume;
+        config->muted = false;
+    }
+
+    if(audio->set_volume) audio->set_volume(audio, config->muted ? 0 : config->volume);
+    if(config->muted) log_write(CHIP8_LOG_INFO, "audio", "Muted");
+    else log_write(CHIP8_LOG_INFO, "audio", "Volume %d", config->volume);
+
+    if(config->volume_path && !volume_file_save(config->volume_path, config->volume, config->muted))
+        log_write(CHIP8_LOG_WARN, "audio", "Couldn't save the volume to %s", config->volume_path);
+}
+
+// Speed and quirk hotkeys, for finding the settings a ROM needs while it runs. They last until the ROM is left,
+// given as options they're kept in the tuning file
+bool blocks_tuning(const config_t *config) {
+    if(!in_lockstep(config)) return false;
+
+    if(config->netplay_host || config->netplay_join)
+        log_write(CHIP8_LOG_WARN, "netplay", "The speed and quirks can't change during netplay");
+    else
+        log_write(CHIP8_LOG_WARN, "movie", "The speed and quirks can't change while recording or playing a movie");
+    return true;
+}
+
+void change_speed(chip8_t *chip8, config_t *config, bool faster) {
+    if(blocks_tuning(config)) return;
+    if(config->timing == CHIP8_TIMING_VIP) {
+        log_write(CHIP8_LOG_WARN, "cpu", "--timing vip runs at the speed of the VIP, --timing flat for --speed");
+        return;
+    }
+
+    // A quarter more or a fifth less, so going up and down again comes back close to where it was
+    const uint64_t speed = faster ? (uint64_t)config->insts_per_second * 5 / 4 : config->insts_per_second * 4 / 5;
+    config->insts_per_second = speed < 60 ? 60 : speed > MAX_SPEED ? MAX_SPEED : (uint32_t)speed;
+    chip8_set_speed(chip8, config->insts_per_second);
+    log_write(CHIP8_LOG_INFO, "cpu", "Speed %u instructions/s, --speed %u keeps it", config->insts_per_second,
+              config->insts_per_second);
+}
+
+void toggle_quirk(chip8_t *chip8, config_t *config, size_t index) {
+    const char *name = chip8_quirk_name(index);
+    if(!name || blocks_tuning(config)) return;
+
+    const bool enabled = !chip8_quirk_enabled(&chip8->quirks, index);
+    chip8_set_quirk(&chip8->quirks, name, enabled);
+    chip8_set_quirk(&config->quirks, name, enabled);    // F2 resets with it
+    log_write(CHIP8_LOG_INFO, "cpu", "Quirk %s %s, --quirk %s=%d keeps it", name, enabled ? "on" : "off", name,
+              enabled);
+}
+
+// Handle user input
+// Host input comes from the input backend, CHIP8 keypad bindings are in the config keymap
+void handle_input(chip8_t *chip8, config_t *config, input_t *input, renderer_t *renderer, audio_t *audio,
+                  hotkeys_t *hotkeys, gif_t *gif){
+
+    input_event_t event;
+    char path[FILENAME_MAX];
+
+    while(input->poll(input, config, &event)) {
+
+        switch(event.action) {
+
+            case INPUT_KEYPAD:
+                chip8_set_key(chip8, event.key, event.pressed);
+                break;
+
+            case INPUT_QUIT:
+                chip8->state = QUIT;
+                hotkeys->quit = true;
+                return;
+
+            case INPUT_REWIND:
+                hotkeys->rewind = event.pressed;
+                break;
+
+            case INPUT_TURBO:
+                hotkeys->turbo = event.pressed;
+                break;
+
+            case INPUT_SAVE_STATE:
+                if(chip8_save_state_file(chip8, config->state_path))
+                    log_write(CHIP8_LOG_INFO, "state", "Saved state to %s", config->state_path);
+                break;
+
+            case INPUT_LOAD_STATE:
+                if(!blocks_jump(config) && chip8_load_state_file(chip8, config->state_path))
+                    log_write(CHIP8_LOG_INFO, "state", "Loaded state from %s", config->state_path);
+                break;
+
+            case INPUT_RESET:
+                if(!blocks_jump(config)) {
+                    // Saved memory survives a power cycle
+                    save_save_ram(chip8, config);
+                    chip8_reset(chip8);
+                    load_save_ram(chip8, config);
+                    log_write(CHIP8_LOG_INFO, "cpu", "Reset");
+                }
+                break;
+
+            case INPUT_RELOAD:
+                reload_from_disk(chip8, config);
+                break;
+
+            case INPUT_SPEED_UP:
+            case INPUT_SPEED_DOWN:
+                change_speed(chip8, config, event.action == INPUT_SPEED_UP);
+                break;
+
+            case INPUT_QUIRK:
+                toggle_quirk(chip8, config, event.key);
+                break;
+
+            case INPUT_GIF:
+                // Start or stop recording a GIF
+                if(gif->file) {
+                    if(image_gif_close(gif)) log_write(CHIP8_LOG_INFO, "capture", "Saved GIF to %s", gif->path);
+                } else if(next_capture_path(config, "gif", path, sizeof path) && start_gif(gif, chip8, config, path)) {
+                    log_write(CHIP8_LOG_INFO, "capture", "Recording GIF to %s", path);
+                }
+                break;
+
+            case INPUT_SCREENSHOT:
+                if(next_capture_path(config, "png", path, sizeof path) && save_screenshot(chip8, config, path))
+                    log_write(CHIP8_LOG_INFO, "capture", "Saved screenshot to %s", path);
+                break;
+
+            case INPUT_FULLSCREEN:
+                // Toggle fullscreen if the renderer supports it
+                if(renderer->toggle_fullscreen) renderer->toggle_fullscreen(renderer);
+                break;
+
+            case INPUT_INVERT: {
+                const uint32_t bg_color = config->bg_color;
+                config->bg_color = config->fg_color;
+                config->fg_color = bg_color;
+
+                // Redraw everything in the new colors
+                renderer->clear(renderer, config);
+                chip8_set_dirty(chip8);
+                break;
+            }
+
+            case INPUT_VOLUME_UP:
+                change_volume(audio, config, VOLUME_STEP, false);
+                break;
+
+            case INPUT_VOLUME_DOWN:
+                change_volume(audio, config, -VOLUME_STEP, false);
+                break;
+
+            case INPUT_MUTE:
+                change_volume(audio, config, 0, true);
+                break;
+
+            case INPUT_OVERLAY:
+                hotkeys->overlay = (hotkeys->overlay + 1) % OVERLAY_MODES;
+                break;
+
+            case INPUT_PAUSE:
+                chip8_set_paused(chip8, chip8->state == RUNNING);
+                log_write(CHIP8_LOG_INFO, "input", "%s", chip8->state == PAUSED ? "Paused" : "Resumed");
+                return;
+
+            case INPUT_FOCUS:
+                // Keys let go of in another window never come back up
+                if(!event.pressed)
+                    for(uint8_t key = 0; key < 16; key++) chip8_set_key(chip8, key, false);
+
+                if(!config->pause_on_focus_loss) break;
+                if(!event.pressed && chip8->state == RUNNING) {
+                    chip8_set_paused(chip8, true);
+                    hotkeys->focus_paused = true;
+                    log_write(CHIP8_LOG_INFO, "input", "Paused, the window lost focus");
+                } else if(event.pressed && hotkeys->focus_paused) {
+                    chip8_set_paused(chip8, false);
+                    hotkeys->focus_paused = false;
+                    log_write(CHIP8_LOG_INFO, "input", "Resumed");
+                }
+                break;
+
+            case INPUT_DROP:
+                snprintf(hotkeys->dropped, sizeof hotkeys->dropped, "%s", event.path);
+                return;
+
+            case INPUT_MENU:
+                hotkeys->menu = true;
+                return;
+
+            case INPUT_MENU_UP:
+            case INPUT_MENU_DOWN:
+            case INPUT_MENU_PAGE_UP:
+            case INPUT_MENU_PAGE_DOWN:
+            case INPUT_MENU_SELECT:
+                break; // Only reported while the menu is shown
+        }
+    }
+}
+
+// Fresh machine with the settings, without a ROM
+void reset_machine(chip8_t *chip8, const config_t *config) {
+    chip8_set_decode_cache(chip8, false);
+    chip8_init(chip8);
+    chip8_set_log(chip8, log_chip8, NULL);
+#ifdef DEBUG
+    chip8_set_instruction_log(chip8, true);     // make debug describes every instruction
+#endif
+    chip8->quirks = config->quirks;
+    chip8->platform = config->platform;
+    chip8_set_xochip(chip8, config->xochip);
+    chip8_set_megachip(chip8, config->megachip);
+    chip8_set_strict_memory(chip8, config->strict_memory);
+    chip8_set_ram_fill(chip8, config->ram_fill, config->seed);
+    chip8_set_strict_init(chip8, config->strict_init);
+    if(config->decode_cache && !chip8_set_decode_cache(chip8, true))
+        log_write(CHIP8_LOG_WARN, "cpu", "Out of memory for the decode cache, running without it");
+    chip8_seed(chip8, config->seed);
+    chip8_set_speed(chip8, config->insts_per_second);
+    chip8_set_timing(chip8, config->timing);
+}
+
+// Load the ROM into a fresh machine
+bool load_machine(chip8_t *chip8, const config_t *config) {
+    reset_machine(chip8, config);
+
+    size_t rom_size = 0;
+    const uint8_t *rom = config_rom(config, &rom_size, false);
+    if(!rom || !chip8_load_rom(chip8, rom, rom_size)) return false;
+
+    chip8->rom_name = config->rom_name;
+    return true;
+}
+
+// Parse the command line and load the ROM into a fresh machine
+bool init_machine(chip8_t *chip8, config_t *config, int first, int argc, char **argv) {
+    if(!init_config(config, NULL, first, argc, argv)) {
+        fprintf(stderr, "Try '%s --help' for more information\n", argv[0]);
+        return false;
+    }
+
+    if(!config->rom_name) {
+        print_usage(stderr, argv[0]);
+        return false;
+    }
+
+    return load_machine(chip8, config);
+}
+
+// Load the movie to play back or start a new recording
+bool init_movie(movie_t *movie, chip8_t *chip8, const config_t *config) {
+    if(config->play_path) {
+        char error[FILENAME_MAX + 64];
+        if(!movie_load_file(movie, config->play_path, error, sizeof error)) {
+            log_write(CHIP8_LOG_ERROR, "movie", "%s", error);
+            return false;
+        }
+
+        // Random numbers have to come out the same as in the recording, and so does random memory
+        chip8_seed(chip8, movie->seed);
+        if(chip8->ram_fill == CHIP8_RAM_RANDOM) chip8_set_ram_fill(chip8, CHIP8_RAM_RANDOM, movie->seed);
+    } else {
+        movie_init(movie, config->seed);
+    }
+
+    return true;
+}
+
+// Write the recording to --record
+bool save_movie(const movie_t *movie, const config_t *config) {
+    char error[FILENAME_MAX + 64];
+    if(movie_save_file(movie, config->record_path, error, sizeof error)) return true;
+
+    log_write(CHIP8_LOG_ERROR, "movie", "%s", error);
+    return false;
+}
+
+// Start the execution trace from --trace, the last instructions are dumped if the ROM crashes
+// Without --trace only the ring is kept, for the crash report
+trace_t *init_trace(const config_t *config) {
+    trace_t *trace = malloc(sizeof *trace);
+    FILE *out = !config->trace_path ? NULL : strcmp(config->trace_path, "-") == 0 ? stdout : fopen(config->trace_path, "w");
+
+    if(!trace || (config->trace_path && !out)) {
+        if(!out) log_write(CHIP8_LOG_ERROR, "trace", "Could not open trace file %s", config->trace_path);
+        free(trace);
+        return NULL;
+    }
+
+    trace_init(trace, out);
+
+    if((config->trace_range && !trace_parse_range(trace, config->trace_range)) ||
+       (config->trace_ops && !trace_parse_classes(trace, config->trace_ops)) ||
+       (config->rom_name && !config->builtin && !romload_symbols(config->rom_name, config->symbols_path, &trace->symbols))) {
+        if(out && out != stdout) fclose(out);
+        free(trace);
+        return NULL;
+    }
+
+    return trace;
+}
+
+void close_trace(trace_t *trace) {
+    if(!trace) return;
+
+    if(trace->out && trace->out != stdout) fclose(trace->out);
+    symbols_free(&trace->symbols);
+    free(trace);
+}
+
+// Print why the ROM stopped, returns false if it faulted
+// With --debug-on-fault the machine is handed to the debugger as it was at the fault
+bool check_fault(chip8_t *chip8, const config_t *config) {
+    if(chip8->fault == CHIP8_FAULT_NONE) return true;
+
+    log_fault(chip8);
+    if(config->debug_on_fault) debugger_repl(chip8, config);
+
+    return false;
+}
+
+// Postmortem bundle of a faulted run in --crash-dir, trace and movie are NULL without them
+void write_crash_report(const chip8_t *chip8, const config_t *config, const trace_t *trace, const movie_t *movie) {
+    if(chip8->fault == CHIP8_FAULT_NONE || !config->crash_dir) return;
+
+    postmortem_t postmortem = {
+        .trace = trace,
+        .movie = movie,
+        .scale = config->capture_scale,
+        .seed = movie ? movie->seed : config->seed,
+        .argc = config->argc,
+        .argv = config->argv,
+    };
+    capture_palette(config, postmortem.palette);
+
+    char path[FILENAME_MAX];
+    if(postmortem_write(config->crash_dir, chip8, &postmortem, path, sizeof path))
+        log_write(CHIP8_LOG_ERROR, "crash", "Crash report written to %s, please attach it to bug reports", path);
+    else
+        log_write(CHIP8_LOG_WARN, "crash", "Crash report in %s is incomplete", config->crash_dir);
+}
+
+// Print the --profile report and write the pprof file if asked for
+void close_profile(profile_t *profile, const chip8_t *chip8, const config_t *config) {
+    if(!profile) return;
+
+    profile_report(profile, chip8, 20, stderr);
+    if(config->profile_path && profile_write_pprof(profile, chip8, config->profile_path))
+        log_write(CHIP8_LOG_INFO, "profile", "Wrote pprof profile to %s", config->profile_path);
+
+    free(profile);
+}
+
+// Write the --coverage and --coverage-html reports, false if one couldn't be written
+bool close_coverage(coverage_t *coverage, const config_t *config) {
+    if(!coverage) return true;
+
+    bool ok = true;
+    coverage_detach(coverage);
+
+    if(config->coverage_path && strcmp(config->coverage_path, "-") == 0) {
+        coverage_write_text(coverage, stdout);
+    } else if(config->coverage_path) {
+        FILE *out = fopen(config->coverage_path, "w");
+        ok = out && coverage_write_text(coverage, out);
+        if(out) ok = fclose(out) == 0 && ok;
+        if(!ok) log_write(CHIP8_LOG_ERROR, "coverage", "Could not write coverage to %s", config->coverage_path);
+    }
+
+    if(config->coverage_html_path) {
+        FILE *out = fopen(config->coverage_html_path, "w");
+        bool html_ok = out && coverage_write_html(coverage, out);
+        if(out) html_ok = fclose(out) == 0 && html_ok;
+        if(!html_ok)
+            log_write(CHIP8_LOG_ERROR, "coverage", "Could not write coverage to %s", config->coverage_html_path);
+        ok = ok && html_ok;
+    }
+
+    free(coverage);
+    return ok;
+}
+
+void run_instruction(chip8_t *chip8, trace_t *trace, profile_t *profile, coverage_t *coverage, script_t *script) {
+    if(script) script_instruction(script);
+    if(coverage) coverage_step(coverage, chip8);
+    if(profile) profile_start(profile, chip8);
+
+    if(trace) trace_step(trace, chip8);
+    else chip8_step(chip8);
+
+    if(profile) profile_stop(profile, chip8);
+}
+
+// The tools run_instruction() runs around each instruction, for chip8_run_vip_frame()
+typedef struct {
+    trace_t *trace;
+    profile_t *profile;
+    coverage_t *coverage;
+    script_t *script;
+} instruction_tools_t;
+
+void run_tooled_instruction(void *userdata, chip8_t *chip8) {
+    const instruction_tools_t *tools = userdata;
+    run_instruction(chip8, tools->trace, tools->profile, tools->coverage, tools->script);
+}
+
+// Run one 60Hz frame: insts_per_second / 60 instructions or a frame of VIP cycles, then tick the timers
+// With a movie the keypad state for the frame is recorded to or played back from it
+void emulate_frame(chip8_t *chip8, frame_clock_t *clock, movie_t *movie, trace_t *trace, profile_t *profile,
+                   coverage_t *coverage, script_t *script) {
+    if(movie && movie->playing) {
+        movie_play_frame(movie, chip8, clock->frames);
+    } else if(movie && !movie_record_frame(movie, chip8, clock->frames)) {
+        log_write(CHIP8_LOG_ERROR, "movie", "Out of memory recording movie");
+    }
+
+    instruction_tools_t tools = {trace, profile, coverage, script};
+    clock->instructions += chip8->timing == CHIP8_TIMING_VIP ?
+                           chip8_run_vip_frame(chip8, run_tooled_instruction, &tools) :
+                           chip8_run_flat_frame(chip8, run_tooled_instruction, &tools);
+    clock->frames++;
+
+    // Timers tick once per frame, independent of CPU speed
+    chip8_update_timers(chip8);
+
+    if(script) script_frame(script);
+}
+
+// Write the screen to config->dump_path
+bool dump_screen(const chip8_t *chip8, const config_t *config) {
+    const char *path = config->dump_path;
+    const size_t len = strlen(path);
+
+    if(len > 4 && strcmp(&path[len - 4], ".png") == 0) return save_screenshot(chip8, config, path);
+
+    if(strcmp(path, "-") == 0) {
+        image_write_text(chip8, stdout);
+        return true;
+    }
+
+    FILE *out = fopen(path, "w");
+    if(!out) {
+        log_write(CHIP8_LOG_ERROR, "capture", "Could not open %s for writing", path);
+        return false;
+    }
+
+    image_write_text(chip8, out);
+    return fclose(out) == 0;
+}
+
+// Load the ROM's cheats and hook them into the machine, netplay goes without so both machines have the same memory
+bool init_cheats(cheat_list_t *cheats, chip8_t *chip8, const config_t *config) {
+    if(!config->cheat_path || config->netplay_host || config->netplay_join) {
+        cheat_init(cheats);
+        return true;
+    }
+
+    if(!cheat_load_file(cheats, config->cheat_path, config->cheats_required)) return false;
+
+    if(cheats->count > 0) {
+        log_write(CHIP8_LOG_INFO, "cheat", "Loaded %zu cheats from %s", cheats->count, config->cheat_path);
+        cheat_attach(cheats, chip8);
+    }
+    return true;
+}
+
+// Movie, trace, profile, coverage and script as set up in the settings, *active_movie is left NULL without a movie
+// Coverage hooks into memory before the script so the script can chain to it
+bool init_recording(chip8_t *chip8, const config_t *config, movie_t *movie, movie_t **active_movie, trace_t **trace,
+                    profile_t **profile, coverage_t **coverage, script_t **script) {
+    *active_movie = NULL;
+    *trace = NULL;
+    *profile = NULL;
+    *coverage = NULL;
+    *script = NULL;
+
+    if(config->record_path || config->play_path) {
+        if(!init_movie(movie, chip8, config)) return false;
+        *active_movie = movie;
+    }
+
+    if((config->trace_path || config->crash_dir) && !(*trace = init_trace(config))) {
+        movie_free(movie);
+        return false;
+    }
+
+    if(config->profile) {
+        if(!(*profile = malloc(sizeof **profile))) {
+            log_write(CHIP8_LOG_ERROR, "profile", "Out of memory for the profile");
+            close_trace(*trace);
+            movie_free(movie);
+            return false;
+        }
+        profile_init(*profile);
+    }
+
+    if(config->coverage_path || config->coverage_html_path) {
+        if(!(*coverage = malloc(sizeof **coverage))) {
+            log_write(CHIP8_LOG_ERROR, "coverage", "Out of memory for the coverage");
+            free(*profile);
+            close_trace(*trace);
+            movie_free(movie);
+            return false;
+        }
+        coverage_attach(*coverage, chip8);
+    }
+
+    if(config->script_path && !(*script = script_load(config->script_path, chip8))) {
+        free(*coverage);
+        free(*profile);
+        close_trace(*trace);
+        movie_free(movie);
+        return false;
+    }
+
+    return true;
+}
+
+// Hand Mega-Chip digitized sounds to the audio backend whenever the ROM starts or stops one
+void update_sound(audio_t *audio, const chip8_t *chip8, uint32_t *serial) {
+    const chip8_sound_t *sound = &chip8->sound;
+    if(!audio->play_sound || sound->serial == *serial) return;
+
+    *serial = sound->serial;
+    audio->play_sound(audio, sound->playing ? &chip8->ram[sound->addr] : NULL, sound->length, sound->rate, sound->loop);
+}
+
+// XO-CHIP's pattern replaces the buzzer tone once a ROM loaded one, an empty pattern buffer would be silent
+// so ROMs that never use F002 keep the regular tone
+void update_pattern(audio_t *audio, const chip8_t *chip8, audio_pattern_t *last) {
+    static const uint8_t empty[sizeof chip8->pattern] = {0};
+    if(!audio->set_pattern) return;
+
+    const bool on = chip8->xochip && memcmp(chip8->pattern, empty, sizeof empty) != 0;
+    if(on == last->on && (!on || (memcmp(chip8->pattern, last->pattern, sizeof last->pattern) == 0 &&
+                                  chip8->pitch == last->pitch))) return;
+
+    last->on = on;
+    memcpy(last->pattern, chip8->pattern, sizeof last->pattern);
+    last->pitch = chip8->pitch;
+    audio->set_pattern(audio, on ? chip8->pattern : NULL, chip8->pitch);
+}
+
+// Sound of a headless run for --wav, the machine's buzzer, pattern and sound as the window would play them
+typedef struct {
+    audio_t audio;
+    uint32_t sound_serial;
+    audio_pattern_t pattern;
+} headless_audio_t;
+
+bool open_headless_audio(headless_audio_t *sound, const chip8_t *chip8, const config_t *config) {
+    *sound = (headless_audio_t) {.sound_serial = chip8->sound.serial};
+    if(config->wav_path) wav_audio(&sound->audio);
+    else null_audio(&sound->audio);
+
+    return sound->audio.init(&sound->audio, config);
+}
+
+// After each emulated frame
+void headless_audio_frame(headless_audio_t *sound, const chip8_t *chip8) {
+    sound->audio.set_playing(&sound->audio, chip8_sound_active(chip8));
+    update_sound(&sound->audio, chip8, &sound->sound_serial);
+    update_pattern(&sound->audio, chip8, &sound->pattern);
+    if(sound->audio.frame) sound->audio.frame(&sound->audio);
+}
+
+// Run for a fixed number of frames or instructions without any renderer, the sound only goes to --wav
+int run_headless(chip8_t *chip8, const config_t *config) {
+    movie_t movie = {0};
+    movie_t *active_movie;
+    trace_t *trace;
+    profile_t *profile;
+    coverage_t *coverage;
+    script_t *script;
+    cheat_list_t cheats;
+    if(!init_cheats(&cheats, chip8, config) ||
+       !init_recording(chip8, config, &movie, &active_movie, &trace, &profile, &coverage, &script)) {
+        chip8_set_memory_hooks(chip8, NULL, NULL, NULL);
+        return EXIT_FAILURE;
+    }
+
+    frame_clock_t clock = {0};
+    gif_t gif = {0};
+    headless_audio_t sound;
+    bool ok = open_headless_audio(&sound, chip8, config);
+    ok = ok && (!config->gif_path || start_gif(&gif, chip8, config, config->gif_path));
+
+    if(!ok) {
+        // Nothing to run
+    } else if(config->headless_cycles > 0) {
+        // Timers still tick every insts_per_second / 60 instructions
+        const uint32_t insts_per_frame = config->insts_per_second / 60;
+
+        for(uint32_t i = 0; i < config->headless_cycles && chip8->state != QUIT; i++) {
+            run_instruction(chip8, trace, profile, coverage, script);
+            if((i + 1) % insts_per_frame == 0) {
+                chip8_update_timers(chip8);
+                if(script) script_frame(script);
+                cheat_apply(&cheats, chip8);
+                headless_audio_frame(&sound, chip8);
+            }
+        }
+    } else {
+        for(uint32_t i = 0; i < config->headless_frames && chip8->state != QUIT; i++) {
+            emulate_frame(chip8, &clock, active_movie, trace, profile, coverage, script);
+            cheat_apply(&cheats, chip8);
+            image_gif_frame(&gif, chip8);
+            headless_audio_frame(&sound, chip8);
+        }
+    }
+
+    if(ok) {
+        ok = dump_screen(chip8, config);
+        if(config->gif_path) ok = image_gif_close(&gif) && ok;
+        if(config->record_path) ok = save_movie(&movie, config) && ok;
+        ok = check_fault(chip8, config) && ok;
+        write_crash_report(chip8, config, trace, active_movie);
+    }
+
+    close_trace(trace);
+    close_profile(profile, chip8, config);
+    script_free(script);
+    ok = close_coverage(coverage, config) && ok;
+    movie_free(&movie);
+    sound.audio.cleanup(&sound.audio);
+
+    // The cheat list goes away with this function
+    chip8_set_memory_hooks(chip8, NULL, NULL, NULL);
+    return ok ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+// Show the ROM file name in the window title, NULL for no ROM
+// hud is text from a script shown after the name, NULL or "" for none
+void set_title(renderer_t *renderer, const char *rom_name, const char *hud) {
+    char title[FILENAME_MAX + 192];
+
+    if(!renderer->set_title) return;
+    if(!rom_name) {
+        renderer->set_title(renderer, RENDERER_TITLE);
+        return;
+    }
+
+    const char *file_name = romload_file_name(rom_name);
+    const char *slash = strrchr(file_name, '/');
+    snprintf(title, sizeof title, "%s - %s%s%s", RENDERER_TITLE, slash ? slash + 1 : file_name,
+             hud && hud[0] ? " | " : "", hud ? hud : "");
+    renderer->set_title(renderer, title);
+}
+
+// Once a second, work out the rates since the last time, returns whether they changed
+bool update_stats(frame_stats_t *stats, const frame_clock_t *clock) {
+    const uint64_t now = SDL_GetPerformanceCounter();
+    const uint64_t freq = SDL_GetPerformanceFrequency();
+    if(now - stats->since < freq) return false;
+
+    const double seconds = (double)(now - stats->since) / freq;
+    stats->fps = (uint32_t)(stats->drawn / seconds + 0.5);
+    stats->skipped_ps = (uint32_t)(stats->skipped / seconds + 0.5);
+    stats->emulated_ps = (uint32_t)((clock->frames - stats->emulated) / seconds + 0.5);
+    stats->ips = (uint64_t)((clock->instructions - stats->instructions) / seconds + 0.5);
+    snprintf(stats->text, sizeof stats->text, "%u fps, %u skipped, %u emulated", stats->fps, stats->skipped_ps,
+             stats->emulated_ps);
+
+    stats->since = now;
+    stats->drawn = 0;
+    stats->skipped = 0;
+    stats->emulated = clock->frames;
+    stats->instructions = clock->instructions;
+    return true;
+}
+
+// Overlay text for the machine as it's drawn
+void format_overlay(char *text, size_t size, overlay_mode_t mode, const chip8_t *chip8, const frame_stats_t *stats) {
+    int len = snprintf(text, size, "FPS %u SKIP %u\nIPS %llu\nDT %02X ST %02X\n", stats->fps, stats->skipped_ps,
+                       (unsigned long long)stats->ips, chip8->delay_timer, chip8->sound_timer);
+    if(mode != OVERLAY_REGISTERS) return;
+
+    len += snprintf(text + len, size - len, "PC %04X I %04X SP %u\n", chip8->PC, chip8->I,
+                    (unsigned)(chip8->stack_ptr - chip8->stack));
+    for(int reg = 0; reg < 16; reg += 4)
+        len += snprintf(text + len, size - len, "V%X %02X V%X %02X V%X %02X V%X %02X\n", reg, chip8->V[reg],
+                        reg + 1, chip8->V[reg + 1], reg + 2, chip8->V[reg + 2], reg + 3, chip8->V[reg + 3]);
+}
+
+// Window title with the script text and the frame stats, when there are any
+void set_stats_title(renderer_t *renderer, const config_t *config, const char *hud, const frame_stats_t *stats) {
+    char text[sizeof stats->text + 160];
+
+    snprintf(text, sizeof text, "%s%s%s", hud, hud[0] && stats->text[0] ? " | " : "", stats->text);
+    set_title(renderer, config->rom_name, text);
+}
+
+// SUPER-CHIP games keep high scores and settings in the RPL flags, they're saved per ROM so they come back
+// on the next run. Movies leave them alone, playback has to start from the same flags as the recording.
+// So does netplay, the other player runs with the host's flags
+void load_rpl_flags(chip8_t *chip8, const config_t *config) {
+    if(!config->rpl_path || in_lockstep(config)) return;
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+    rpl_file_load(config->rpl_path, sha1, chip8->rpl, sizeof chip8->rpl);
+}
+
+// Only written when the ROM changed them, so ROMs that never use the flags don't get a line
+void save_rpl_flags(const chip8_t *chip8, const config_t *config, const uint8_t loaded[sizeof chip8->rpl]) {
+    if(!config->rpl_path || in_lockstep(config)) return;
+    if(memcmp(loaded, chip8->rpl, sizeof chip8->rpl) == 0) return;
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+    if(!rpl_file_save(config->rpl_path, sha1, chip8->rpl, sizeof chip8->rpl))
+        log_write(CHIP8_LOG_WARN, "rom", "Couldn't save the RPL flags to %s", config->rpl_path);
+}
+
+// One turn of the emulation thread: turbo_factor frames when fast forwarding, rewound ones while rewinding
+void emulation_step(emulation_t *emu) {
+    chip8_t *chip8 = emu->chip8;
+    const bool rewinding = emu->rewind_enabled && emu->hotkeys->rewind;
+    const uint32_t frames = emu->hotkeys->turbo && !emu->netplay ? emu->config->turbo_factor : 1;
+
+    for(uint32_t i = 0; i < frames && chip8->state != QUIT; i++) {
+        // The frame waits for the other player's keypad, the next turn tries again
+        if(emu->netplay && !netplay_frame(emu->netplay, chip8, emu->clock.frames)) break;
+
+        if(rewinding) {
+            // Step back one snapshot per frame instead of emulating
+            rewind_pop(emu->rewind, chip8);
+        } else {
+            emulate_frame(chip8, &emu->clock, emu->movie, emu->trace, emu->profile, emu->coverage, emu->script);
+
+            if(emu->rewind_enabled && emu->clock.frames % REWIND_FRAME_INTERVAL == 0) rewind_push(emu->rewind, chip8);
+        }
+
+        image_gif_frame(emu->gif, chip8);
+    }
+
+    // Also puts frozen values back after loading a state or rewinding
+    cheat_apply(emu->cheats, chip8);
+
+    // Hand the keypad back to the player once the movie is over
+    if(emu->movie && emu->movie->playing && movie_finished(emu->movie, emu->clock.frames)) {
+        log_write(CHIP8_LOG_INFO, "movie", "Movie finished after %u frames", emu->clock.frames);
+        for(uint8_t key = 0; key < 16; key++) chip8_set_key(chip8, key, false);
+        emu->movie = NULL;
+    }
+}
+
+// Runs the machine at 60 frames per second, or as fast as it goes for a benchmark, until told to stop
+int emulation_thread(void *userdata) {
+    emulation_t *emu = userdata;
+    const uint64_t counter_freq = SDL_GetPerformanceFrequency();
+    const uint64_t frame_ticks = counter_freq / 60;
+    uint64_t next_frame_time = SDL_GetPerformanceCounter();
+
+    SDL_LockMutex(emu->lock);
+    while(!emu->stop) {
+        // Paused, or quit and waiting for the main thread to notice
+        const bool idle = emu->chip8->state == PAUSED || emu->chip8->state == QUIT;
+        if(!idle) emulation_step(emu);
+
+        SDL_UnlockMutex(emu->lock);
+
+        if(idle) {
+            // Don't spin while paused, and don't try to catch up after resuming
+            SDL_Delay(16);
+            next_frame_time = SDL_GetPerformanceCounter();
+        } else if(!emu->config->benchmark) {
+            // Deadlines are absolute so rounding errors don't add up
+            next_frame_time += frame_ticks;
+            const uint64_t now = SDL_GetPerformanceCounter();
+
+            if(next_frame_time > now) {
+                SDL_Delay((uint32_t)((next_frame_time - now) * 1000 / counter_freq));
+            } else if(now - next_frame_time > frame_ticks * MAX_CATCH_UP_FRAMES) {
+                // Too far behind (slow host, window dragged), skip ahead instead of running fast
+                next_frame_time = now;
+            }
+        }
+
+        // A mutex isn't fair, without this an uncapped benchmark could keep the main thread out for good
+        while(atomic_load(&emu->waiting) > 0) SDL_Delay(0);
+        SDL_LockMutex(emu->lock);
+    }
+    SDL_UnlockMutex(emu->lock);
+
+    return 0;
+}
+
+bool start_emulation(emulation_t *emu) {
+    if(!(emu->lock = SDL_CreateMutex())) {
+        log_write(CHIP8_LOG_ERROR, "main", "Could not create the emulation lock: %s", SDL_GetError());
+        return false;
+    }
+
+    if(!(emu->thread = SDL_CreateThread(emulation_thread, "emulation", emu))) {
+        log_write(CHIP8_LOG_ERROR, "main", "Could not start the emulation thread: %s", SDL_GetError());
+        SDL_DestroyMutex(emu->lock);
+        return false;
+    }
+
+    return true;
+}
+
+void lock_emulation(emulation_t *emu) {
+    atomic_fetch_add(&emu->waiting, 1);
+    SDL_LockMutex(emu->lock);
+    atomic_fetch_sub(&emu->waiting, 1);
+}
+
+void unlock_emulation(emulation_t *emu) {
+    SDL_UnlockMutex(emu->lock);
+}
+
+// Wait for the emulation thread to finish its frame and exit, the machine belongs to the caller again
+void stop_emulation(emulation_t *emu) {
+    lock_emulation(emu);
+    emu->stop = true;
+    unlock_emulation(emu);
+
+    SDL_WaitThread(emu->thread, NULL);
+    SDL_DestroyMutex(emu->lock);
+}
+
+// Copy of the machine for the renderer, the stack pointer has to point into the copy's own stack
+void copy_view(chip8_t *view, const chip8_t *chip8) {
+    // Rows changed in a skipped frame still have to be redrawn with this one
+    bool dirty_rows[CHIP8_MEGA_HEIGHT];
+    memcpy(dirty_rows, view->dirty_rows, sizeof dirty_rows);
+
+    *view = *chip8;
+    view->stack_ptr = view->stack + (chip8->stack_ptr - chip8->stack);
+    for(uint32_t y = 0; y < CHIP8_MEGA_HEIGHT; y++) view->dirty_rows[y] |= dirty_rows[y];
+}
+
+// --netplay-host waits for the other player and sends them this machine, --netplay-join takes the host's
+// machine, speed and timing in place of the loaded one
+bool start_netplay(netplay_t *netplay, chip8_t *chip8, config_t *config) {
+    const bool ok = config->netplay_host ?
+        netplay_host(netplay, config->netplay_host, config->netplay_delay, chip8, config->insts_per_second,
+                     config->timing) :
+        netplay_join(netplay, config->netplay_join, chip8, &config->insts_per_second, &config->timing);
+
+    if(ok) netplay_attach(netplay, chip8);
+    return ok;
+}
+
+// Run config->rom_name in the window until the user quits, goes back to the menu or drops another ROM
+// on the window, which is copied to next_rom
+session_end_t run_rom(chip8_t *chip8, config_t *config, renderer_t *renderer, audio_t *audio, input_t *input,
+                      char next_rom[FILENAME_MAX]) {
+    if(!load_machine(chip8, config)) return SESSION_FAILED;
+    set_title(renderer, config->rom_name, NULL);
+
+    load_rpl_flags(chip8, config);
+    load_save_ram(chip8, config);
+    uint8_t rpl[sizeof chip8->rpl];
+    memcpy(rpl, chip8->rpl, sizeof rpl);
+
+    netplay_t netplay = {.fd = -1};
+    const bool netplaying = config->netplay_host || config->netplay_join;
+    if(netplaying && !start_netplay(&netplay, chip8, config)) return SESSION_FAILED;
+
+    movie_t movie = {0};
+    movie_t *active_movie;
+    trace_t *trace;
+    profile_t *profile;
+    coverage_t *coverage;
+    script_t *script;
+    cheat_list_t cheats;
+    if(!init_cheats(&cheats, chip8, config) ||
+       !init_recording(chip8, config, &movie, &active_movie, &trace, &profile, &coverage, &script)) {
+        chip8_set_memory_hooks(chip8, NULL, NULL, NULL);
+        if(netplaying) netplay_close(&netplay, chip8);
+        return SESSION_FAILED;
+    }
+
+    // Rewinding is optional as well, it would desync a movie or netplay
+    rewind_t rewind = {0};
+    hotkeys_t hotkeys = {0};
+    gif_t gif = {0};
+    emulation_t emu = {
+        .chip8 = chip8,
+        .config = config,
+        .hotkeys = &hotkeys,
+        .movie = active_movie,
+        .netplay = netplaying ? &netplay : NULL,
+        .trace = trace,
+        .profile = profile,
+        .coverage = coverage,
+        .script = script,
+        .cheats = &cheats,
+        .rewind = &rewind,
+        .rewind_enabled = config->rewind_seconds > 0 && !active_movie && !netplaying &&
+                          rewind_init(&rewind, config->rewind_seconds * 60 / REWIND_FRAME_INTERVAL),
+        .gif = &gif,
+    };
+    char hud[128] = "";     // Script text in the window title
+    frame_stats_t stats = {.since = SDL_GetPerformanceCounter()};
+    watch_t watch;
+    uint32_t watch_frames = 0;
+    const bool watching = config->watch && !config->builtin && watch_init(&watch, config->rom_name);
+    if(config->watch && !watching) log_write(CHIP8_LOG_WARN, "rom", "Only ROM files can be watched for changes");
+    uint32_t sound_serial = chip8->sound.serial;
+    audio_pattern_t pattern = {0};
+    if(config->gif_path && start_gif(&gif, chip8, config, config->gif_path))
+        log_write(CHIP8_LOG_INFO, "capture", "Recording GIF to %s", config->gif_path);
+
+    // Viewers get the screen the window shows, sent from its copy outside the lock
+    web_server_t *broadcast = config->broadcast ? web_broadcast_open(config->broadcast) : NULL;
+
+    // The renderer draws from a copy so the emulation thread can go on meanwhile
+    chip8_t *view = malloc(sizeof *view);
+    if(view) *view = *chip8;
+    if(!view || (config->broadcast && !broadcast) || !start_emulation(&emu)) {
+        if(!view) log_write(CHIP8_LOG_ERROR, "display", "Out of memory for the screen");
+        web_broadcast_close(broadcast, chip8);
+        free(view);
+        rewind_free(&rewind);
+        close_trace(trace);
+        free(profile);
+        free(coverage);
+        script_free(script);
+        movie_free(&movie);
+        chip8_set_memory_hooks(chip8, NULL, NULL, NULL);
+        if(netplaying) netplay_close(&netplay, chip8);
+        return SESSION_FAILED;
+    }
+
+    renderer->clear(renderer, config);
+
+    const uint64_t counter_freq = SDL_GetPerformanceFrequency();
+    const uint64_t frame_ticks = counter_freq / 60;
+    const uint64_t start_time = SDL_GetPerformanceCounter();
+    uint64_t next_frame_time = start_time;
+    bool redraw = false;    // The view changed since it was last drawn
+    uint32_t skipped_in_row = 0;
+    overlay_mode_t overlay = OVERLAY_OFF;  // Mode the renderer was last given
+
+    // Window loop, input, sound and drawing at 60Hz while the emulation thread runs the machine
+    while(true) {
+        lock_emulation(&emu);
+        handle_input(chip8, config, input, renderer, audio, &hotkeys, &gif);
+        if(watching && ++watch_frames % WATCH_INTERVAL_FRAMES == 0 && watch_poll(&watch))
+            reload_from_disk(chip8, config);
+
+        const bool time_up = config->attract_seconds && emu.clock.frames >= config->attract_seconds * 60;
+        const bool done = chip8->state == QUIT || hotkeys.menu || hotkeys.dropped[0] || netplay.disconnected || time_up;
+        // The overlay shows timers and registers, which change without drawing
+        const overlay_mode_t overlay_mode = renderer->set_overlay ? hotkeys.overlay : OVERLAY_OFF;
+        const bool copied = chip8->draw || overlay_mode != OVERLAY_OFF || overlay_mode != overlay;
+        if(copied) {
+            copy_view(view, chip8);
+            chip8_clear_dirty(chip8);
+            redraw = true;
+        }
+
+        bool new_hud = script && strcmp(script_hud(script), hud) != 0;
+        if(new_hud) snprintf(hud, sizeof hud, "%s", script_hud(script));
+        if(update_stats(&stats, &emu.clock) && config->show_stats) new_hud = true;
+        const uint64_t instructions = emu.clock.instructions;
+        const uint32_t frames = emu.clock.frames;
+
+        // Beep while the sound timer is active
+        const bool sound = chip8_sound_active(chip8);
+        audio->set_playing(audio, sound);
+        update_sound(audio, chip8, &sound_serial);
+        update_pattern(audio, chip8, &pattern);
+        unlock_emulation(&emu);
+
+        if(done) break;
+        if(broadcast) web_broadcast_frame(broadcast, view, config, copied, sound, instructions, frames);
+        if(new_hud) set_stats_title(renderer, config, hud, &stats);
+
+        if(overlay_mode != overlay) {
+            overlay = overlay_mode;
+            if(overlay == OVERLAY_OFF) renderer->set_overlay(renderer, NULL);
+        }
+        if(overlay != OVERLAY_OFF) {
+            char text[256];
+            format_overlay(text, sizeof text, overlay, view, &stats);
+            renderer->set_overlay(renderer, text);
+        }
+
+        // A frame or more behind, drawing this one would only put us further back. Emulation doesn't wait
+        // for the window, so skipping frames keeps the game running at full speed on a slow host
+        const bool behind = SDL_GetPerformanceCounter() > next_frame_time + frame_ticks;
+        // Pixels fading out need frames of their own
+        if(renderer->animating && renderer->animating(renderer)) redraw = true;
+        if(redraw && behind && skipped_in_row < MAX_FRAME_SKIP) {
+            stats.skipped++;
+            skipped_in_row++;
+        } else if(redraw) {
+            renderer->update(renderer, config, view);
+            chip8_clear_dirty(view);
+            stats.drawn++;
+            skipped_in_row = 0;
+            redraw = false;
+        }
+
+        // Sleep until the next frame is due, the window doesn't need to keep up with a fast forward
+        next_frame_time += frame_ticks;
+        const uint64_t now = SDL_GetPerformanceCounter();
+
+        if(next_frame_time > now) {
+            SDL_Delay((uint32_t)((next_frame_time - now) * 1000 / counter_freq));
+        } else if(now - next_frame_time > frame_ticks * MAX_CATCH_UP_FRAMES) {
+            next_frame_time = now;
+        }
+    }
+
+    stop_emulation(&emu);
+    free(view);
+    web_broadcast_close(broadcast, chip8);
+    if(netplaying) netplay_close(&netplay, chip8);
+
+    audio->set_playing(audio, false);
+    if(audio->play_sound) audio->play_sound(audio, NULL, 0, 0, false);
+    if(audio->set_pattern) audio->set_pattern(audio, NULL, 0);
+
+    const frame_clock_t clock = emu.clock;
+    if(config->benchmark) {
+        const double seconds = (double)(SDL_GetPerformanceCounter() - start_time) / counter_freq;
+
+        printf("Ran %llu instructions in %u frames in %.2f seconds: %.0f instructions/s, %.1f frames/s\n",
+               (unsigned long long)clock.instructions, clock.frames, seconds,
+               seconds > 0 ? clock.instructions / seconds : 0, seconds > 0 ? clock.frames / seconds : 0);
+    }
+
+    if(config->record_path && save_movie(&movie, config))
+        log_write(CHIP8_LOG_INFO, "movie", "Saved movie of %u frames to %s", movie.frames, config->record_path);
+
+    if(gif.file && image_gif_close(&gif)) log_write(CHIP8_LOG_INFO, "capture", "Saved GIF to %s", gif.path);
+
+    save_rpl_flags(chip8, config, rpl);
+    save_save_ram(chip8, config);
+    write_crash_report(chip8, config, trace, active_movie);
+
+    close_trace(trace);
+    close_profile(profile, chip8, config);
+    script_free(script);
+    close_coverage(coverage, config);
+    movie_free(&movie);
+    rewind_free(&rewind);
+    chip8_set_memory_hooks(chip8, NULL, NULL, NULL);   // The cheat list goes away with this function
+
+    // Attract mode carries on unless Escape was pressed, F1 and dropped files only skip ahead
+    if(config->attract_seconds && !hotkeys.quit) {
+        if(chip8->fault != CHIP8_FAULT_NONE)
+            log_write(CHIP8_LOG_WARN, "cpu", "Machine fault: %s at 0x%04X (opcode %04X) in %s", chip8_fault_name(chip8->fault),
+                      chip8->PC, chip8->inst.opcode, config->rom_name);
+        return SESSION_NEXT;
+    }
+
+    // A fault ends the session like quitting, it's reported once the window is gone
+    if(chip8->fault != CHIP8_FAULT_NONE) return SESSION_QUIT;
+
+    if(hotkeys.dropped[0]) {
+        snprintf(next_rom, FILENAME_MAX, "%s", hotkeys.dropped);
+        return SESSION_DROPPED;
+    }
+
+    return hotkeys.menu ? SESSION_MENU : SESSION_QUIT;
+}
+
+// Show the ROM menu until a ROM is picked, returns NULL if the user quit
+// ROMs are listed from the ROM directory, or the current directory without one
+// A file dropped on the window is picked as well, it's copied to dropped
+const char *run_menu(menu_t *menu, const config_t *config, renderer_t *renderer, input_t *input,
+                     char dropped[FILENAME_MAX]) {
+    const char *dir = config->rom_dir ? config->rom_dir : ".";
+    if(strcmp(menu->dir, dir) != 0) menu_scan(menu, dir);
+
+    // The menu is drawn as a hires CHIP8 screen, so it works with any renderer
+    chip8_t screen;
+    chip8_init(&screen);
+
+    const char *path = NULL;
+    bool done = false;
+    bool changed = true;
+
+    input->menu = true;
+    renderer->clear(renderer, config);
+    set_title(renderer, NULL, NULL);
+
+    while(!done) {
+        input_event_t event;
+
+        while(!done && input->poll(input, config, &event)) {
+            switch(event.action) {
+                case INPUT_QUIT:
+                    done = true;
+                    break;
+
+                case INPUT_MENU_UP:
+                case INPUT_MENU_DOWN:
+                case INPUT_MENU_PAGE_UP:
+                case INPUT_MENU_PAGE_DOWN: {
+                    const int step = event.action == INPUT_MENU_UP || event.action == INPUT_MENU_DOWN ? 1 : MENU_LINES;
+                    const bool up = event.action == INPUT_MENU_UP || event.action == INPUT_MENU_PAGE_UP;
+
+                    menu_move(menu, up ? -step : step);
+                    changed = true;
+                    break;
+                }
+
+                case INPUT_MENU_SELECT:
+                    path = menu_selected_path(menu);
+                    done = path != NULL;
+                    break;
+
+                case INPUT_DROP:
+                    snprintf(dropped, FILENAME_MAX, "%s", event.path);
+                    path = dropped;
+                    done = true;
+                    break;
+
+                case INPUT_FULLSCREEN:
+                    if(renderer->toggle_fullscreen) renderer->toggle_fullscreen(renderer);
+                    changed = true;
+                    break;
+
+                default:
+                    break; // Emulator hotkeys and the keypad do nothing here
+            }
+        }
+
+        if(changed || (renderer->animating && renderer->animating(renderer))) {
+            menu_draw(menu, &screen);
+            renderer->update(renderer, config, &screen);
+            chip8_clear_dirty(&screen);
+            changed = false;
+        }
+
+        SDL_Delay(16);
+    }
+
+    input->menu = false;
+    return path;
+}
+
+// SDL and the window, sound and input the ROMs run in
+bool open_window(renderer_t *renderer, audio_t *audio, input_t *input, const config_t *config) {
+    if(!init_sdl()) return false;
+
+    if(!init_renderer(renderer, config)) {
+        SDL_Quit();
+        return false;
+    }
+
+    if(!renderer->init(renderer, config)) {
+        renderer->cleanup(renderer);
+        SDL_Quit();
+        return false;
+    }
+
+    renderer->clear(renderer, config);
+
+    if(!init_audio(audio, config)) {
+        renderer->cleanup(renderer);
+        SDL_Quit();
+        return false;
+    }
+
+    // Sound is optional, keep running silently if no audio device is available
+    if(!audio->init(audio, config)) {
+        log_write(CHIP8_LOG_WARN, "audio", "Running without sound");
+        null_audio(audio);
+    }
+
+    // A frontend on the other end of stdio sends the keys too
+    if(strcmp(config->renderer, "stdio") == 0) stdio_input(input);
+    else sdl_input(input);
+    if(!input->init(input, config)) {
+        audio->cleanup(audio);
+        renderer->cleanup(renderer);
+        SDL_Quit();
+        return false;
+    }
+
+    return true;
+}
+
+void close_window(renderer_t *renderer, audio_t *audio, input_t *input) {
+    input->cleanup(input);
+    audio->cleanup(audio);
+    renderer->cleanup(renderer);
+    SDL_Quit();
+}
+
+// chip8 [run] [options] [rom_path]: Run a ROM in a window or terminal, without a ROM start in the menu
+int run_command(int first, int argc, char **argv) {
+
+    config_t config = {0}; 
+    chip8_t chip8 = {0};
+    if(!init_config(&config, NULL, first, argc, argv)) {
+        fprintf(stderr, "Try '%s --help' for more information\n", argv[0]);
+        return EXIT_FAILURE;
+    }
+
+    if(config.debug_listen) {
+        if(!config.rom_name) {
+            print_usage(stderr, argv[0]);
+            return EXIT_FAILURE;
+        }
+
+        return load_machine(&chip8, &config) && debug_server_run(&chip8, &config) ? EXIT_SUCCESS : EXIT_FAILURE;
+    }
+
+    if(config.serve) {
+        if(!config.rom_name) {
+            print_usage(stderr, argv[0]);
+            return EXIT_FAILURE;
+        }
+
+        if(!load_machine(&chip8, &config)) return EXIT_FAILURE;
+        return web_server_run(&chip8, &config) && check_fault(&chip8, &config) ? EXIT_SUCCESS : EXIT_FAILURE;
+    }
+
+    if(config.headless) {
+        if(!config.rom_name) {
+            print_usage(stderr, argv[0]);
+            return EXIT_FAILURE;
+        }
+
+        return load_machine(&chip8, &config) ? run_headless(&chip8, &config) : EXIT_FAILURE;
+    }
+
+    renderer_t renderer = {0};
+    audio_t audio = {0};
+    input_t input = {0};
+    if(!open_window(&renderer, &audio, &input, &config)) return EXIT_FAILURE;
+
+    // Alternate between the menu and ROMs until the user quits, F1 gets back to the menu
+    // and a file dropped on the window replaces the running ROM
+    menu_t menu = {0};
+    char dropped[FILENAME_MAX];
+    bool from_menu = !config.rom_name;
+    session_end_t end = SESSION_MENU;
+
+    while(end == SESSION_MENU || end == SESSION_DROPPED) {
+        const char *path = end == SESSION_DROPPED ? dropped : NULL;
+
+        if(!path && from_menu && !(path = run_menu(&menu, &config, &renderer, &input, dropped))) {
+            end = SESSION_QUIT;
+            break;
+        }
+
+        // Settings for the ROM, including its ROM database entry
+        if(path && !init_config(&config, path, first, argc, argv)) {
+            end = SESSION_FAILED;
+            break;
+        }
+
+        end = run_rom(&chip8, &config, &renderer, &audio, &input, dropped);
+
+        // A ROM from the menu or dropped on the window that fails to load just goes back to the menu
+        if(end == SESSION_FAILED && path) end = SESSION_MENU;
+        from_menu = true;
+    }
+
+    menu_free(&menu);
+    close_window(&renderer, &audio, &input);
+
+    // The window is gone by now, the debugger runs on the terminal
+    if(!check_fault(&chip8, &config)) return EXIT_FAILURE;
+    return end == SESSION_QUIT ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+// chip8 debug [options] <rom_path>: Step through a ROM on the command line
+int debug_command(int first, int argc, char **argv) {
+
+    config_t config = {0};
+    chip8_t chip8 = {0};
+    if(!init_machine(&chip8, &config, first, argc, argv)) return EXIT_FAILURE;
+
+    debugger_repl(&chip8, &config);
+    return EXIT_SUCCESS;
+}
+
+// chip8 repl [options] [rom_path]: Type instructions and see what they do, on an empty machine or after the ROM
+int repl_command(int first, int argc, char **argv) {
+
+    config_t config = {0};
+    chip8_t chip8 = {0};
+    if(!init_config(&config, NULL, first, argc, argv)) {
+        fprintf(stderr, "Try '%s --help' for more information\n", argv[0]);
+        return EXIT_FAILURE;
+    }
+
+    if(config.rom_name) {
+        if(!load_machine(&chip8, &config)) return EXIT_FAILURE;
+    } else {
+        reset_machine(&chip8, &config);
+    }
+
+    repl_run(&chip8);
+    chip8_set_decode_cache(&chip8, false);
+    return EXIT_SUCCESS;
+}
+
+// chip8 tui [options] <rom_path>: Full screen terminal debugger
+int tui_command(int first, int argc, char **argv) {
+
+    config_t config = {0};
+    chip8_t chip8 = {0};
+    if(!init_machine(&chip8, &config, first, argc, argv)) return EXIT_FAILURE;
+
+    return debugger_tui(&chip8, &config) ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+// chip8 disasm [--syntax raw|octo] [--cfg] [--symbols <file>] [--output <file>] <rom_path>: Disassemble a ROM
+int disasm_command(int first, int argc, char **argv) {
+
+    disasm_syntax_t syntax = DISASM_RAW;
+    bool cfg = false;
+    const char *output = NULL;
+    const char *symbols_path = NULL;
+    const char *rom_name = NULL;
+
+    for(int i = first; i < argc; i++) {
+        const char *value = NULL;
+
+        if(cli_option("syntax", argc, argv, &i, &value)) {
+            if(!value) return EXIT_FAILURE;
+
+            if(strcmp(value, "raw") == 0) {
+                syntax = DISASM_RAW;
+            } else if(strcmp(value, "octo") == 0) {
+                syntax = DISASM_OCTO;
+            } else {
+                fprintf(stderr, "Unknown syntax %s, expected raw or octo\n", value);
+                return EXIT_FAILURE;
+            }
+        } else if(cli_option("output", argc, argv, &i, &value)) {
+            if(!value) return EXIT_FAILURE;
+            output = value;
+        } else if(cli_option("symbols", argc, argv, &i, &value)) {
+            if(!value) return EXIT_FAILURE;
+            symbols_path = value;
+        } else if(cli_flag("cfg", argv[i])) {
+            cfg = true;
+        } else if(strncmp(argv[i], "--", 2) == 0) {
+            fprintf(stderr, "Unknown option %s\n", argv[i]);
+            return EXIT_FAILURE;
+        } else if(!rom_name) {
+            rom_name = argv[i];
+        } else {
+            fprintf(stderr, "Unexpected argument %s\n", argv[i]);
+            return EXIT_FAILURE;
+        }
+    }
+
+    if(!rom_name) {
+        print_usage(stderr, argv[0]);
+        return EXIT_FAILURE;
+    }
+
+    size_t rom_size = 0;
+    uint8_t *rom = romload_read(rom_name, &rom_size);
+    if(!rom) return EXIT_FAILURE;
+
+    symbols_t symbols;
+    if(!romload_symbols(rom_name, symbols_path, &symbols)) {
+        free(rom);
+        return EXIT_FAILURE;
+    }
+
+    FILE *out = output ? fopen(output, "w") : stdout;
+    if(!out) {
+        fprintf(stderr, "Could not open %s for writing\n", output);
+        symbols_free(&symbols);
+        free(rom);
+        return EXIT_FAILURE;
+    }
+
+    const bool ok = cfg ? disasm_cfg(rom, rom_size, &symbols, out) : disasm_program(rom, rom_size, syntax, &symbols, out);
+
+    if(output) fclose(out);
+    symbols_free(&symbols);
+    free(rom);
+    return ok ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+// chip8 asm [-o <file>] [--symbols <file>] <source>: Assemble a ROM, the output defaults to the source name with .ch8
+int asm_command(int first, int argc, char **argv) {
+
+    const char *output = NULL;
+    const char *symbols_path = NULL;
+    const char *source_name = NULL;
+
+    for(int i = first; i < argc; i++) {
+        const char *value = NULL;
+
+        if(cli_option("symbols", argc, argv, &i, &value)) {
+            if(!value) return EXIT_FAILURE;
+            symbols_path = value;
+        } else if(strcmp(argv[i], "-o") == 0 || cli_option("output", argc, argv, &i, &value)) {
+            if(strcmp(argv[i], "-o") == 0) value = i + 1 < argc ? argv[++i] : NULL;
+            if(!value) {
+                fprintf(stderr, "Option -o requires a value\n");
+                return EXIT_FAILURE;
+            }
+            output = value;
+        } else if(strncmp(argv[i], "-", 1) == 0) {
+            fprintf(stderr, "Unknown option %s\n", argv[i]);
+            return EXIT_FAILURE;
+        } else if(!source_name) {
+            source_name = argv[i];
+        } else {
+            fprintf(stderr, "Unexpected argument %s\n", argv[i]);
+            return EXIT_FAILURE;
+        }
+    }
+
+    if(!source_name) {
+        print_usage(stderr, argv[0]);
+        return EXIT_FAILURE;
+    }
+
+    // game.s -> game.ch8
+    char default_output[512];
+    if(!output) {
+        const char *dot = strrchr(source_name, '.');
+        const int base_len = dot && !strchr(dot, '/') ? (int)(dot - source_name) : (int)strlen(source_name);
+
+        snprintf(default_output, sizeof default_output, "%.*s.ch8", base_len, source_name);
+        output = default_output;
+    }
+
+    size_t source_size = 0;
+    char *source = (char *)cli_read_file(source_name, &source_size);
+    if(!source) return EXIT_FAILURE;
+
+    uint8_t *rom = NULL;
+    size_t rom_size = 0;
+    symbols_t symbols;
+    symbols_t *wanted = symbols_path ? &symbols : NULL;
+    const bool ok = octo_is_source(source_name) ? octo_assemble(source, source_name, &rom, &rom_size, wanted)
+                                                : asm_assemble(source, source_name, &rom, &rom_size, wanted);
+    free(source);
+    if(!ok) return EXIT_FAILURE;
+
+    if(wanted) {
+        const bool saved = symbols_save_file(&symbols, symbols_path);
+        symbols_free(&symbols);
+        if(!saved) {
+            free(rom);
+            return EXIT_FAILURE;
+        }
+    }
+
+    FILE *out = fopen(output, "wb");
+    if(!out || fwrite(rom, 1, rom_size, out) != rom_size) {
+        fprintf(stderr, "Could not write %s\n", output);
+        if(out) fclose(out);
+        free(rom);
+        return EXIT_FAILURE;
+    }
+
+    fclose(out);
+    free(rom);
+    printf("Wrote %zu bytes to %s\n", rom_size, output);
+    return EXIT_SUCCESS;
+}
+
+// Apply --vs, a quirks preset or a comma separated list of <name>=<0|1> toggles
+bool parse_vs_quirks(quirks_t *quirks, const char *spec) {
+    if(chip8_quirks_preset(spec, quirks)) return true;
+
+    char toggles[256];
+    snprintf(toggles, sizeof toggles, "%s", spec);
+    for(char *toggle = strtok(toggles, ","); toggle; toggle = strtok(NULL, ","))
+        if(!parse_quirk(quirks, toggle)) return false;
+
+    return true;
+}
+
+// chip8 compare <a.state> <b.state>: Show how two save states differ
+int compare_states(const char *path_a, const char *path_b) {
+    chip8_t a = {0}, b = {0};
+    chip8_init(&a);
+    chip8_init(&b);
+    chip8_set_log(&a, log_chip8, NULL);
+    chip8_set_log(&b, log_chip8, NULL);
+    if(!chip8_load_state_file(&a, path_a) || !chip8_load_state_file(&b, path_b)) return EXIT_FAILURE;
+
+    printf("A is %s, B is %s\n", path_a, path_b);
+    const size_t quirks = compare_quirks(&a, &b, stdout);
+    const size_t differences = compare_machines(&a, &b, stdout);
+    if(!quirks && !differences) puts("The states are the same");
+
+    return quirks || differences ? EXIT_FAILURE : EXIT_SUCCESS;
+}
+
+// chip8 compare [options] --vs <quirks> <rom_path>: Run the ROM twice in lockstep, once as configured and
+// once with the quirks changed by --vs, and show where the two runs first differ
+int compare_runs(const config_t *config, const char *vs) {
+    config_t config_b = *config;
+    if(!parse_vs_quirks(&config_b.quirks, vs)) return EXIT_FAILURE;
+
+    chip8_t a = {0}, b = {0};
+    if(!load_machine(&a, config) || !load_machine(&b, &config_b)) return EXIT_FAILURE;
+
+    const uint32_t insts_per_frame = config->insts_per_second / 60;
+    const uint64_t max_cycles = config->headless_cycles ? config->headless_cycles :
+                                (uint64_t)config->headless_frames * insts_per_frame;
+    uint64_t cycles = 0;
+    uint16_t pc = 0;
+    const bool diverged = compare_lockstep(&a, &b, max_cycles, insts_per_frame, &cycles, &pc);
+
+    printf("A is %s as configured, B with --vs %s\n", config->rom_name, vs);
+    if(!compare_quirks(&a, &b, stdout)) puts("The quirks are the same");
+
+    if(!diverged) {
+        printf("No divergence in %llu instructions", (unsigned long long)cycles);
+        if(a.state == QUIT) printf(", both machines stopped");
+        printf("\n");
+        return EXIT_SUCCESS;
+    }
+
+    const uint32_t mask = a.ram_size - 1;
+    const uint16_t opcode = a.ram[pc & mask] << 8 | a.ram[(pc + 1) & mask];
+    const uint16_t next = a.ram[(pc + 2) & mask] << 8 | a.ram[(pc + 3) & mask];
+    char text[64];
+    disasm_instruction(opcode, next, DISASM_RAW, NULL, text, sizeof text);
+
+    printf("Diverged at instruction %llu (frame %llu), 0x%04X: %04X %s\n", (unsigned long long)cycles,
+           (unsigned long long)(insts_per_frame ? (cycles - 1) / insts_per_frame : 0), pc, opcode, text);
+    compare_machines(&a, &b, stdout);
+    return EXIT_FAILURE;
+}
+
+// chip8 compare [options] --ref <trace> <rom_path>: Run the ROM against a reference emulator's trace,
+// every line of it is compared with the machine before the instruction it logged
+int compare_reference(const config_t *config, const char *path, reftrace_format_t format, const char *columns) {
+    reftrace_t ref;
+    chip8_t chip8 = {0};
+    if(!reftrace_open(&ref, path, format, columns)) return EXIT_FAILURE;
+    if(!load_machine(&chip8, config)) {
+        reftrace_close(&ref);
+        return EXIT_FAILURE;
+    }
+
+    const uint32_t insts_per_frame = config->insts_per_second / 60;
+    uint64_t cycles = 0;
+    uint16_t last_pc = chip8.PC;
+    reftrace_state_t state;
+    bool error = false, mismatch = false;
+
+    while((!config->headless_cycles || cycles < config->headless_cycles) && reftrace_next(&ref, &state, &error)) {
+        if(reftrace_compare(&state, &chip8, NULL) > 0) {
+            mismatch = true;
+            break;
+        }
+
+        // The trace goes on after the ROM stopped or faulted here
+        if(chip8.state == QUIT) {
+            printf("The machine stopped after %llu instructions, the reference trace goes on at line %zu\n",
+                   (unsigned long long)cycles, ref.line);
+            if(chip8.fault != CHIP8_FAULT_NONE) chip8_print_fault(&chip8, stdout);
+            reftrace_close(&ref);
+            return EXIT_FAILURE;
+        }
+
+        last_pc = chip8.PC;
+        chip8_step(&chip8);
+        cycles++;
+        if(insts_per_frame && cycles % insts_per_frame == 0) chip8_update_timers(&chip8);
+    }
+
+    reftrace_close(&ref);
+    if(error) return EXIT_FAILURE;
+
+    if(!mismatch) {
+        printf("All %llu instructions match the reference trace\n", (unsigned long long)cycles);
+        return EXIT_SUCCESS;
+    }
+
+    if(cycles == 0) {
+        printf("Mismatch at line %zu of the reference trace, before the first instruction\n", ref.line);
+    } else {
+        const uint32_t mask = chip8.ram_size - 1;
+        const uint16_t opcode = chip8.ram[last_pc & mask] << 8 | chip8.ram[(last_pc + 1) & mask];
+        const uint16_t next = chip8.ram[(last_pc + 2) & mask] << 8 | chip8.ram[(last_pc + 3) & mask];
+        char text[64];
+        disasm_instruction(opcode, next, DISASM_RAW, NULL, text, sizeof text);
+
+        printf("Mismatch at line %zu of the reference trace, after instruction %llu at 0x%04X: %04X %s\n",
+               ref.line, (unsigned long long)cycles, last_pc, opcode, text);
+    }
+
+    reftrace_compare(&state, &chip8, stdout);
+    return EXIT_FAILURE;
+}
+
+// chip8 compare: Diff two save states, two runs of a ROM under different quirks or a run against a reference trace
+// Exits with failure when they differ, like diff
+int compare_command(int first, int argc, char **argv) {
+    // --vs and the --ref options are compare's own, the rest configures the run like for chip8 run
+    const char *vs = NULL, *ref = NULL, *ref_columns = NULL;
+    const char *ref_format = NULL;
+    char **args = malloc((argc + 1) * sizeof *args);
+    int count = 0;
+    if(!args) return EXIT_FAILURE;
+
+    args[count++] = argv[0];
+    for(int i = first; i < argc; i++) {
+        const char *value = NULL;
+        const char **option = NULL;
+
+        if(cli_option("vs", argc, argv, &i, &value)) option = &vs;
+        else if(cli_option("ref-format", argc, argv, &i, &value)) option = &ref_format;
+        else if(cli_option("ref-columns", argc, argv, &i, &value)) option = &ref_columns;
+        else if(cli_option("ref", argc, argv, &i, &value)) option = &ref;
+
+        if(option && !value) {
+            free(args);
+            return EXIT_FAILURE;
+        }
+
+        if(option) *option = value;
+        else args[count++] = argv[i];
+    }
+
+    // Traces ending in .json or .jsonl are JSON unless --ref-format says otherwise
+    const char *dot = ref ? strrchr(ref, '.') : NULL;
+    reftrace_format_t format = dot && (strcmp(dot, ".json") == 0 || strcmp(dot, ".jsonl") == 0) ? REFTRACE_JSON : REFTRACE_CSV;
+    if(ref_format && strcmp(ref_format, "csv") == 0) {
+        format = REFTRACE_CSV;
+    } else if(ref_format && strcmp(ref_format, "json") == 0) {
+        format = REFTRACE_JSON;
+    } else if(ref_format) {
+        fprintf(stderr, "Unknown trace format %s, expected csv or json\n", ref_format);
+        free(args);
+        return EXIT_FAILURE;
+    }
+
+    int status;
+    if(vs && ref) {
+        fprintf(stderr, "--vs and --ref can't be used together\n");
+        status = EXIT_FAILURE;
+    } else if(!vs && !ref) {
+        if(count == 3 && strncmp(args[1], "--", 2) != 0 && strncmp(args[2], "--", 2) != 0) {
+            status = compare_states(args[1], args[2]);
+        } else {
+            print_usage(stderr, argv[0]);
+            status = EXIT_FAILURE;
+        }
+    } else {
+        config_t config = {0};
+        if(!init_config(&config, NULL, 1, count, args)) {
+            fprintf(stderr, "Try '%s --help' for more information\n", argv[0]);
+            status = EXIT_FAILURE;
+        } else if(!config.rom_name) {
+            print_usage(stderr, argv[0]);
+            status = EXIT_FAILURE;
+        } else {
+            status = ref ? compare_reference(&config, ref, format, ref_columns) : compare_runs(&config, vs);
+        }
+    }
+
+    free(args);
+    return status;
+}
+
+// chip8 info <rom_path>: Show what the ROM database knows about a ROM
+int info_command(int first, int argc, char **argv) {
+    if(argc - first != 1 || strncmp(argv[first], "--", 2) == 0) {
+        print_usage(stderr, argv[0]);
+        return EXIT_FAILURE;
+    }
+
+    const char *rom_name = argv[first];
+    size_t rom_size = 0;
+    uint8_t *rom = romload_read(rom_name, &rom_size);
+    if(!rom) return EXIT_FAILURE;
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(rom, rom_size, sha1);
+    const romdb_entry_t *entry = romdb_find(rom, rom_size);
+    free(rom);
+
+    printf("File:     %s\n", rom_name);
+    printf("Size:     %zu bytes\n", rom_size);
+    printf("SHA-1:    %s\n", sha1);
+
+    if(!entry) {
+        puts("Not in the ROM database, running with the default settings");
+        return EXIT_SUCCESS;
+    }
+
+    printf("Title:    %s\n", entry->title);
+    printf("Platform: %s\n", entry->platform);
+    printf("Quirks:   %s\n", entry->quirks);
+    if(entry->insts_per_second) printf("Speed:    %u instructions/s\n", entry->insts_per_second);
+    else printf("Speed:    default\n");
+    if(entry->has_colors) printf("Colors:   %08X on %08X\n", entry->fg_color, entry->bg_color);
+
+    return EXIT_SUCCESS;
+}
+
+bool parse_severity(const char *name, lint_severity_t *severity) {
+    for(lint_severity_t level = LINT_INFO; level <= LINT_ERROR; level++) {
+        if(strcmp(lint_severity_name(level), name) == 0) {
+            *severity = level;
+            return true;
+        }
+    }
+
+    fprintf(stderr, "Unknown level %s, expected info, warning or error\n", name);
+    return false;
+}
+
+// chip8 lint [--platform <name>] [--megachip] [--show <level>] [--fail-on <level>] <rom_path>: Static checks
+int lint_command(int first, int argc, char **argv) {
+    chip8_platform_t platform = CHIP8_PLATFORM_ANY;
+    bool megachip = false;
+    lint_severity_t show = LINT_INFO;
+    lint_severity_t fail_on = LINT_ERROR;
+    const char *rom_name = NULL;
+
+    for(int i = first; i < argc; i++) {
+        const char *value = NULL;
+
+        if(cli_option("platform", argc, argv, &i, &value)) {
+            if(!value || !parse_platform(value, &platform)) return EXIT_FAILURE;
+        } else if(cli_flag("megachip", argv[i])) {
+            megachip = true;
+        } else if(cli_option("show", argc, argv, &i, &value)) {
+            if(!value || !parse_severity(value, &show)) return EXIT_FAILURE;
+        } else if(cli_option("fail-on", argc, argv, &i, &value)) {
+            if(!value || !parse_severity(value, &fail_on)) return EXIT_FAILURE;
+        } else if(strncmp(argv[i], "--", 2) == 0) {
+            fprintf(stderr, "Unknown option %s\n", argv[i]);
+            return EXIT_FAILURE;
+        } else if(!rom_name) {
+            rom_name = argv[i];
+        } else {
+            fprintf(stderr, "Unexpected argument %s\n", argv[i]);
+            return EXIT_FAILURE;
+        }
+    }
+
+    if(!rom_name) {
+        print_usage(stderr, argv[0]);
+        return EXIT_FAILURE;
+    }
+
+    size_t rom_size = 0;
+    uint8_t *rom = romload_read(rom_name, &rom_size);
+    if(!rom) return EXIT_FAILURE;
+
+    lint_t lint;
+    const bool ok = lint_rom(rom, rom_size, platform, megachip, &lint);
+    free(rom);
+    if(!ok) return EXIT_FAILURE;
+
+    lint_write(&lint, rom_name, show, stdout);
+    fprintf(stderr, "%zu error%s, %zu warning%s\n", lint.counts[LINT_ERROR], lint.counts[LINT_ERROR] == 1 ? "" : "s",
+            lint.counts[LINT_WARNING], lint.counts[LINT_WARNING] == 1 ? "" : "s");
+
+    bool failed = false;
+    for(lint_severity_t level = fail_on; level <= LINT_ERROR; level++)
+        if(lint.counts[level]) failed = true;
+
+    lint_free(&lint);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
+
+// chip8 opcodes [--format markdown|json] [--platform <name>] [--megachip] [--output <file>]: Instruction reference
+int opcodes_command(int first, int argc, char **argv) {
+    bool json = false;
+    bool megachip = false;
+    chip8_platform_t platform = CHIP8_PLATFORM_ANY;
+    const char *output = NULL;
+
+    for(int i = first; i < argc; i++) {
+        const char *value = NULL;
+
+        if(cli_option("format", argc, argv, &i, &value)) {
+            if(!value) return EXIT_FAILURE;
+
+            if(strcmp(value, "markdown") == 0) {
+                json = false;
+            } else if(strcmp(value, "json") == 0) {
+                json = true;
+            } else {
+                fprintf(stderr, "Unknown format %s, expected markdown or json\n", value);
+                return EXIT_FAILURE;
+            }
+        } else if(cli_option("platform", argc, argv, &i, &value)) {
+            if(!value || !parse_platform(value, &platform)) return EXIT_FAILURE;
+        } else if(cli_flag("megachip", argv[i])) {
+            megachip = true;
+        } else if(cli_option("output", argc, argv, &i, &value)) {
+            if(!value) return EXIT_FAILURE;
+            output = value;
+        } else if(strncmp(argv[i], "--", 2) == 0) {
+            fprintf(stderr, "Unknown option %s\n", argv[i]);
+            return EXIT_FAILURE;
+        } else {
+            fprintf(stderr, "Unexpected argument %s\n", argv[i]);
+            return EXIT_FAILURE;
+        }
+    }
+
+    FILE *out = output ? fopen(output, "w") : stdout;
+    if(!out) {
+        fprintf(stderr, "Could not open %s for writing\n", output);
+        return EXIT_FAILURE;
+    }
+
+    bool ok = json ? opcodes_write_json(out, platform, megachip) : opcodes_write_markdown(out, platform, megachip);
+    if(output && fclose(out) != 0) ok = false;
+    return ok ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+// Run cycles instructions with the timers ticking every insts_per_frame, the ROM restarts when it exits
+// Returns the seconds it took, or a negative value if the ROM faulted
+double bench_run(chip8_t *chip8, uint32_t insts_per_frame, uint64_t cycles, profile_t *profile) {
+    const uint64_t start = SDL_GetPerformanceCounter();
+    uint32_t frame_insts = 0;
+
+    for(uint64_t i = 0; i < cycles; i++) {
+        if(profile) profile_start(profile, chip8);
+        chip8_step(chip8);
+        if(profile) profile_stop(profile, chip8);
+
+        if(++frame_insts == insts_per_frame) {
+            chip8_update_timers(chip8);
+            frame_insts = 0;
+        }
+
+        if(chip8->fault != CHIP8_FAULT_NONE) {
+            chip8_print_fault(chip8, stderr);
+            return -1;
+        }
+        if(chip8->state == QUIT) chip8_reset(chip8);
+    }
+
+    return (double)(SDL_GetPerformanceCounter() - start) / SDL_GetPerformanceFrequency();
+}
+
+// Compare with the speed saved by --save, slower by more than BENCH_TOLERANCE percent is a regression
+bool bench_check_baseline(const char *path, double speed) {
+    FILE *file = fopen(path, "r");
+    double baseline = 0;
+
+    if(!file) {
+        fprintf(stderr, "Could not open baseline %s\n", path);
+        return false;
+    }
+
+    const bool read = fscanf(file, "instructions_per_second %lf", &baseline) == 1 && baseline > 0;
+    fclose(file);
+    if(!read) {
+        fprintf(stderr, "Baseline %s has no instructions_per_second line\n", path);
+        return false;
+    }
+
+    const double change = 100.0 * (speed - baseline) / baseline;
+    printf("Baseline:  %.0f instructions/s, %+.1f%%\n", baseline, change);
+    if(change >= -BENCH_TOLERANCE) return true;
+
+    fprintf(stderr, "Slower than the baseline by more than %d%%\n", BENCH_TOLERANCE);
+    return false;
+}
+
+// chip8 bench [options] [--save <file>] [--baseline <file>] <rom_path>: Measure emulation throughput
+int bench_command(int first, int argc, char **argv) {
+    // --save and --baseline are bench's own, the rest configures the machine like for chip8 run
+    const char *save = NULL, *baseline = NULL;
+    char **args = malloc((argc + 1) * sizeof *args);
+    int count = 0;
+    if(!args) return EXIT_FAILURE;
+
+    args[count++] = argv[0];
+    for(int i = first; i < argc; i++) {
+        const char *value = NULL;
+        const char **option = NULL;
+
+        if(cli_option("save", argc, argv, &i, &value)) option = &save;
+        else if(cli_option("baseline", argc, argv, &i, &value)) option = &baseline;
+
+        if(option && !value) {
+            free(args);
+            return EXIT_FAILURE;
+        }
+
+        if(option) *option = value;
+        else args[count++] = argv[i];
+    }
+
+    config_t config = {0};
+    chip8_t chip8 = {0};
+    const bool loaded = init_machine(&chip8, &config, 1, count, args);
+    free(args);
+    if(!loaded) return EXIT_FAILURE;
+
+    const uint64_t cycles = config.headless_cycles ? config.headless_cycles : BENCH_DEFAULT_CYCLES;
+    const uint32_t insts_per_frame = config.insts_per_second / 60;
+    profile_t *profile = malloc(sizeof *profile);
+    if(!profile) {
+        fprintf(stderr, "Out of memory for the profile\n");
+        return EXIT_FAILURE;
+    }
+
+    // The plain run gives the speed, a second profiled one the time per opcode class
+    const double seconds = bench_run(&chip8, insts_per_frame, cycles, NULL);
+    chip8_reset(&chip8);
+    profile_init(profile);
+    const double profiled = seconds < 0 ? -1 : bench_run(&chip8, insts_per_frame, cycles, profile);
+
+    if(seconds < 0 || profiled < 0) {
+        free(profile);
+        return EXIT_FAILURE;
+    }
+
+    const double speed = seconds > 0 ? cycles / seconds : 0;
+    printf("%s: %llu instructions in %.3f seconds\n", config.rom_name, (unsigned long long)cycles, seconds);
+    printf("Speed:     %.0f instructions/s, %.2f ns per instruction\n", speed, seconds * 1e9 / cycles);
+    printf("Decode cache: %s\n\n", config.decode_cache ? "on" : "off");
+    profile_report_classes(profile, profile_clock_overhead(), stdout);
+    free(profile);
+
+    bool ok = true;
+    if(save) {
+        FILE *file = fopen(save, "w");
+        if(file) {
+            fprintf(file, "instructions_per_second %.0f\n", speed);
+            fclose(file);
+            printf("Saved the speed to %s\n", save);
+        } else {
+            fprintf(stderr, "Could not write %s\n", save);
+            ok = false;
+        }
+    }
+    if(baseline) ok = bench_check_baseline(baseline, speed) && ok;
+
+    return ok ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+// Outcome of one ROM in chip8 batch, with the screen and instructions to compare runs by
+typedef struct {
+    char name[256];         // File name in the ROM directory
+    const char *result;     // ok, exited, fault or error (didn't load)
+    char fault[96];         // What faulted and where, empty otherwise
+    uint64_t instructions;
+    char screen[ROMDB_SHA1_HEX_SIZE]; // SHA-1 of the last frame's pixels
+} batch_result_t;
+
+// JSON string with quotes, backslashes and control characters escaped
+void write_json_string(FILE *out, const char *text) {
+    fputc('"', out);
+    for(; *text; text++) {
+        if(*text == '"' || *text == '\\') fprintf(out, "\\%c", *text);
+        else if((unsigned char)*text < 0x20) fprintf(out, "\\u%04x", *text);
+        else fputc(*text, out);
+    }
+    fputc('"', out);
+}
+
+// Stats of the run as <rom>.json next to its screenshot
+bool batch_write_stats(const char *path, const chip8_t *chip8, const config_t *config, const coverage_t *coverage,
+                       const batch_result_t *result) {
+    FILE *out = fopen(path, "w");
+    if(!out) {
+        fprintf(stderr, "Could not open %s for writing\n", path);
+        return false;
+    }
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+    coverage_totals_t totals;
+    coverage_totals(coverage, &totals);
+
+    fprintf(out, "{\n  \"rom\": ");
+    write_json_string(out, result->name);
+    fprintf(out, ",\n  \"sha1\": \"%s\",\n  \"size\": %zu,\n", sha1, chip8->rom_size);
+    fprintf(out, "  \"platform\": \"%s\",\n  \"speed\": %u,\n", chip8_platform_name(chip8->platform),
+            config->insts_per_second);
+    fprintf(out, "  \"result\": \"%s\",\n  \"fault\": ", result->result);
+    if(chip8->fault != CHIP8_FAULT_NONE)
+        fprintf(out, "{\"name\": \"%s\", \"pc\": %u, \"opcode\": \"%04X\"},\n", chip8_fault_name(chip8->fault),
+                chip8->PC, chip8->inst.opcode);
+    else
+        fprintf(out, "null,\n");
+    fprintf(out, "  \"instructions\": %llu,\n  \"screen_sha1\": \"%s\",\n",
+            (unsigned long long)result->instructions, result->screen);
+    fprintf(out, "  \"coverage\": {\"code_bytes\": %zu, \"data_bytes\": %zu, \"unused_bytes\": %zu, "
+            "\"instruction_addresses\": %zu},\n", totals.code, totals.data, totals.unused, totals.instructions);
+
+    // Executions per instruction by the opcodes at the addresses run, as memory has them at the end
+    uint64_t *counts = calloc(opcode_count + 1, sizeof *counts);
+    if(counts) {
+        for(uint32_t addr = 0; addr < chip8->ram_size; addr++) {
+            if(!coverage->executed[addr]) continue;
+
+            const uint16_t opcode = (chip8->ram[addr] << 8) | chip8->ram[(addr + 1) % chip8->ram_size];
+            const opcode_info_t *info = opcode_find(opcode, chip8->megachip);
+            counts[info ? (size_t)(info - opcode_table) : opcode_count] += coverage->executed[addr];
+        }
+
+        fprintf(out, "  \"opcodes\": {");
+        bool first = true;
+        for(size_t i = 0; i <= opcode_count; i++) {
+            if(!counts[i]) continue;
+
+            fprintf(out, "%s\"%s\": %llu", first ? "" : ", ", i < opcode_count ? opcode_table[i].form : "unknown",
+                    (unsigned long long)counts[i]);
+            first = false;
+        }
+        fprintf(out, "}\n}\n");
+        free(counts);
+    }
+
+    const bool ok = counts && !ferror(out);
+    return fclose(out) == 0 && ok;
+}
+
+// Run one ROM headless with coverage, then write its screenshot and stats to out_dir, and its sound with wav
+// args are the options for the machine, the ROM's path goes in the last slot
+void batch_run_rom(const char *path, int argc, char **args, const char *out_dir, bool wav, coverage_t *coverage,
+                   batch_result_t *result) {
+    const char *name = strrchr(path, '/');
+    snprintf(result->name, sizeof result->name, "%s", name ? name + 1 : path);
+    result->result = "error";
+
+    config_t config = {0};
+    chip8_t *chip8 = calloc(1, sizeof *chip8);
+    args[argc - 1] = (char *)path;
+    if(!chip8 || !init_machine(chip8, &config, 1, argc, args)) {
+        if(chip8) chip8_set_decode_cache(chip8, false);
+        free(chip8);
+        return;
+    }
+
+    char file[FILENAME_MAX];
+    snprintf(file, sizeof file, "%s/%s.wav", out_dir, result->name);
+    if(wav) config.wav_path = file;
+
+    // A WAV file that can't be opened doesn't stop the run, the ROM's other results are still worth having
+    headless_audio_t sound;
+    if(!open_headless_audio(&sound, chip8, &config)) null_audio(&sound.audio);
+
+    memset(coverage, 0, sizeof *coverage);
+    coverage_attach(coverage, chip8);
+    frame_clock_t clock = {0};
+
+    if(config.headless_cycles > 0) {
+        const uint32_t insts_per_frame = config.insts_per_second / 60;
+
+        for(uint32_t i = 0; i < config.headless_cycles && chip8->state != QUIT; i++) {
+            run_instruction(chip8, NULL, NULL, coverage, NULL);
+            if((i + 1) % insts_per_frame == 0) {
+                chip8_update_timers(chip8);
+                headless_audio_frame(&sound, chip8);
+            }
+        }
+    } else {
+        for(uint32_t i = 0; i < config.headless_frames && chip8->state != QUIT; i++) {
+            emulate_frame(chip8, &clock, NULL, NULL, NULL, coverage, NULL);
+            headless_audio_frame(&sound, chip8);
+        }
+    }
+    coverage_detach(coverage);
+    sound.audio.cleanup(&sound.audio);
+
+    for(uint32_t addr = 0; addr < chip8->ram_size; addr++) result->instructions += coverage->executed[addr];
+    if(chip8->fault != CHIP8_FAULT_NONE) {
+        result->result = "fault";
+        snprintf(result->fault, sizeof result->fault, "%s at 0x%04X (opcode %04X)", chip8_fault_name(chip8->fault),
+                 chip8->PC, chip8->inst.opcode);
+    } else {
+        result->result = chip8->state == QUIT ? "exited" : "ok";
+    }
+
+    // The screen at 1:1 is enough to tell runs apart, the PNG has the capture scale
+    uint32_t palette[4], width, height;
+    capture_palette(&config, palette);
+    uint8_t *rgb = image_from_display(chip8, palette, 1, &width, &height);
+    if(rgb) romdb_sha1(rgb, (size_t)width * height * 3, result->screen);
+    free(rgb);
+
+    snprintf(file, sizeof file, "%s/%s.png", out_dir, result->name);
+    if(!save_screenshot(chip8, &config, file)) fprintf(stderr, "Could not write %s\n", file);
+    snprintf(file, sizeof file, "%s/%s.json", out_dir, result->name);
+    batch_write_stats(file, chip8, &config, coverage, result);
+
+    chip8_set_decode_cache(chip8, false);
+    free(chip8);
+}
+
+// summary.txt of another batch run, prints the ROMs whose result or last frame is different now
+// Returns false if any are, or the baseline can't be read
+bool batch_check_baseline(const char *dir, const batch_result_t *results, size_t count) {
+    char path[FILENAME_MAX];
+    snprintf(path, sizeof path, "%s/summary.txt", dir);
+    FILE *file = fopen(path, "r");
+    if(!file) {
+        fprintf(stderr, "Could not open baseline %s\n", path);
+        return false;
+    }
+
+    char line[512];
+    size_t changed = 0, compared = 0;
+    while(fgets(line, sizeof line, file)) {
+        char name[256], result[16], screen[ROMDB_SHA1_HEX_SIZE];
+        if(line[0] == '#' || sscanf(line, "%255[^\t]\t%15s\t%*u\t%40s", name, result, screen) != 3) continue;
+
+        for(size_t i = 0; i < count; i++) {
+            if(strcmp(results[i].name, name) != 0) continue;
+
+            compared++;
+            if(strcmp(results[i].result, result) != 0) {
+                printf("%s: %s in the baseline, %s now %s\n", name, result, results[i].result, results[i].fault);
+                changed++;
+            } else if(strcmp(results[i].screen, screen) != 0) {
+                printf("%s: the last frame is different from the baseline\n", name);
+                changed++;
+            }
+        }
+    }
+    fclose(file);
+
+    printf("%zu of %zu ROMs in the baseline changed\n", changed, compared);
+    return changed == 0;
+}
+
+// chip8 batch <rom_dir> [options] [--out <dir>] [--baseline <dir>]: Run every ROM in a directory headless
+int batch_command(int first, int argc, char **argv) {
+    if(first >= argc || argv[first][0] == '-') {
+        print_usage(stderr, argv[0]);
+        return EXIT_FAILURE;
+    }
+    const char *rom_dir = argv[first];
+
+    // --out, --baseline and --wav are batch's own, the rest configures the machines like for chip8 run
+    const char *out_dir = "batch", *baseline = NULL;
+    bool wav = false;
+    char **args = malloc((argc + 5) * sizeof *args);
+    int count = 0;
+    if(!args) return EXIT_FAILURE;
+
+    // Runs are only comparable with the same random numbers, --seed can still pick others
+    args[count++] = argv[0];
+    args[count++] = "--headless";
+    args[count++] = "--seed";
+    args[count++] = "0";
+    for(int i = first + 1; i < argc; i++) {
+        const char *value = NULL;
+        const char **option = NULL;
+
+        if(cli_flag("wav", argv[i])) {
+            wav = true;
+            continue;
+        }
+
+        if(cli_option("out", argc, argv, &i, &value)) option = &out_dir;
+        else if(cli_option("baseline", argc, argv, &i, &value)) option = &baseline;
+
+        if(option && !value) {
+            free(args);
+            return EXIT_FAILURE;
+        }
+
+        if(option) *option = value;
+        else args[count++] = argv[i];
+    }
+    args[count++] = NULL;   // The ROM
+
+    menu_t roms = {0};
+    char dir_path[FILENAME_MAX];
+    snprintf(dir_path, sizeof dir_path, "%s/", out_dir);
+    coverage_t *coverage = malloc(sizeof *coverage);
+    batch_result_t *results = NULL;
+    bool ok = coverage && menu_scan(&roms, rom_dir);
+    if(ok && !(results = calloc(roms.count ? roms.count : 1, sizeof *results))) ok = false;
+    if(ok && !datadir_make_parents(dir_path)) {
+        fprintf(stderr, "Could not make the directory %s\n", out_dir);
+        ok = false;
+    }
+
+    size_t counts[4] = {0};     // ok, exited, fault, error
+    for(size_t i = 0; ok && i < roms.count; i++) {
+        batch_run_rom(roms.paths[i], count, args, out_dir, wav, coverage, &results[i]);
+
+        const batch_result_t *result = &results[i];
+        const char *names[] = {"ok", "exited", "fault", "error"};
+        for(size_t j = 0; j < 4; j++) counts[j] += strcmp(result->result, names[j]) == 0;
+        printf("%-24s %-6s %12llu instructions  %s\n", result->name, result->result,
+               (unsigned long long)result->instructions, result->fault);
+    }
+
+    // Tab separated so a later run can use it as its --baseline
+    if(ok) {
+        char path[FILENAME_MAX];
+        snprintf(path, sizeof path, "%s/summary.txt", out_dir);
+        FILE *summary = fopen(path, "w");
+        if(summary) {
+            fprintf(summary, "# rom\tresult\tinstructions\tscreen_sha1\tfault\n");
+            for(size_t i = 0; i < roms.count; i++)
+                fprintf(summary, "%s\t%s\t%llu\t%s\t%s\n", results[i].name, results[i].result,
+                        (unsigned long long)results[i].instructions, results[i].screen[0] ? results[i].screen : "-",
+                        results[i].fault);
+            fprintf(summary, "# %zu ROMs: %zu ok, %zu exited, %zu faulted, %zu didn't load\n", roms.count, counts[0],
+                    counts[1], counts[2], counts[3]);
+            ok = fclose(summary) == 0;
+        } else {
+            fprintf(stderr, "Could not open %s for writing\n", path);
+            ok = false;
+        }
+
+        printf("%zu ROMs: %zu ok, %zu exited, %zu faulted, %zu didn't load, results in %s\n", roms.count, counts[0],
+               counts[1], counts[2], counts[3], out_dir);
+    }
+
+    if(ok && baseline) ok = batch_check_baseline(baseline, results, roms.count);
+
+    free(results);
+    free(coverage);
+    menu_free(&roms);
+    free(args);
+    return ok ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+// chip8 attract <playlist|rom_dir> [options] [--duration <seconds>]: Run the ROMs in the window one after the
+// other and start over at the end, until Escape. A movie recorded next to a ROM is played as its demo
+int attract_command(int first, int argc, char **argv) {
+    if(first >= argc || argv[first][0] == '-') {
+        print_usage(stderr, argv[0]);
+        return EXIT_FAILURE;
+    }
+    const char *list_path = argv[first];
+
+    // --duration is attract's own, the rest configures the machines like for chip8 run
+    uint32_t duration = ATTRACT_DEFAULT_SECONDS;
+    char **args = malloc((argc + 1) * sizeof *args);
+    int count = 0;
+    if(!args) return EXIT_FAILURE;
+
+    args[count++] = argv[0];
+    for(int i = first + 1; i < argc; i++) {
+        const char *value = NULL;
+
+        if(!cli_option("duration", argc, argv, &i, &value)) {
+            args[count++] = argv[i];
+        } else if(!value || !cli_parse_uint("duration", value, 1, PLAYLIST_MAX_SECONDS, &duration)) {
+            free(args);
+            return EXIT_FAILURE;
+        }
+    }
+    args[count] = NULL;
+
+    // The options are checked once before the window opens, each ROM reads them again with its own settings
+    config_t config = {0};
+    chip8_t chip8 = {0};
+    playlist_t playlist = {0};
+    bool ok = init_config(&config, NULL, 1, count, args);
+    if(ok && config.rom_name) {
+        fprintf(stderr, "chip8 attract takes its ROMs from %s, not the command line\n", list_path);
+        ok = false;
+    }
+    if(ok && (config.headless || config.serve || config.debug_listen || config.netplay_host || config.netplay_join)) {
+        fprintf(stderr, "chip8 attract runs in the window, without --headless, --serve, --debug-listen or netplay\n");
+        ok = false;
+    }
+    if(!ok) fprintf(stderr, "Try '%s --help' for more information\n", argv[0]);
+
+    renderer_t renderer = {0};
+    audio_t audio = {0};
+    input_t input = {0};
+    bool *reported = NULL;  // A ROM that faults every time around gets one crash report, not one per pass
+    if(!ok || !playlist_load(&playlist, list_path) || !(reported = calloc(playlist.count, sizeof *reported)) ||
+       !open_window(&renderer, &audio, &input, &config)) {
+        free(reported);
+        playlist_free(&playlist);
+        free(args);
+        return EXIT_FAILURE;
+    }
+
+    size_t failed_in_row = 0;
+    for(size_t i = 0; ; i = (i + 1) % playlist.count) {
+        const playlist_entry_t *entry = &playlist.entries[i];
+        const uint32_t seconds = entry->seconds ? entry->seconds : duration;
+        session_end_t end = SESSION_FAILED;
+
+        log_write(CHIP8_LOG_INFO, "attract", "Running %s for %u seconds", entry->path, seconds);
+        if(init_config(&config, entry->path, 1, count, args)) {
+            // Until the demo is over the keypad is the movie's, then it's free to play like in chip8 run
+            char demo_path[FILENAME_MAX];
+            snprintf(demo_path, sizeof demo_path, "%s.movie", romload_file_name(entry->path));
+            FILE *file = config.play_path || config.record_path ? NULL : fopen(demo_path, "rb");
+            const bool demo = file != NULL;
+            if(demo) {
+                fclose(file);
+                config.play_path = demo_path;
+                log_write(CHIP8_LOG_INFO, "attract", "Playing %s as the demo", demo_path);
+            }
+
+            if(reported[i]) config.crash_dir = NULL;
+            config.attract_seconds = seconds;
+
+            char dropped[FILENAME_MAX];
+            end = run_rom(&chip8, &config, &renderer, &audio, &input, dropped);
+            reported[i] = reported[i] || (config.crash_dir && chip8.fault != CHIP8_FAULT_NONE);
+        }
+
+        // Skip ROMs that don't load, as long as some of them do
+        failed_in_row = end == SESSION_FAILED ? failed_in_row + 1 : 0;
+        if(failed_in_row == playlist.count) {
+            fprintf(stderr, "None of the ROMs in %s could be run\n", list_path);
+            ok = false;
+            break;
+        }
+
+        if(end == SESSION_QUIT) break;
+    }
+
+    close_window(&renderer, &audio, &input);
+    free(reported);
+    playlist_free(&playlist);
+    free(args);
+    return ok ? EXIT_SUCCESS : EXIT_FAILURE;
+}
+
+int main(int argc, char **argv) {
+
+    // "run" is the default command, "chip8 game.ch8" is the same as "chip8 run game.ch8"
+    if(argc > 1 && strcmp(argv[1], "run") == 0) return run_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "debug") == 0) return debug_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "tui") == 0) return tui_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "repl") == 0) return repl_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "disasm") == 0) return disasm_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "asm") == 0) return asm_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "info") == 0) return info_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "lint") == 0) return lint_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "opcodes") == 0) return opcodes_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "compare") == 0) return compare_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "bench") == 0) return bench_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "batch") == 0) return batch_command(2, argc, argv);
+    if(argc > 1 && strcmp(argv[1], "attract") == 0) return attract_command(2, argc, argv);
+
+    return run_command(1, argc, argv);
+}
@@ -0,0 +1,232 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <string.h>
+#include <strings.h>
+#include <ctype.h>
+#include <dirent.h>
+#include <sys/stat.h>
+
+#include "menu.h"
+#include "romdb.h"
+
+// Text layout on the 128x64 screen: 3x5 glyphs in 4x6 cells below a title line
+#define MENU_CHAR_WIDTH  4
+#define MENU_LEFT        2
+#define MENU_COLUMNS     ((CHIP8_HIRES_WIDTH - MENU_LEFT) / MENU_CHAR_WIDTH)
+
+// 3x5 font, one row per byte with bit 2 as the leftmost pixel
+// Letters are upper case only, anything missing is drawn as '?'
+static const struct {
+    char c;
+    uint8_t rows[5];
+} glyphs[] = {
+    {' ', {0, 0, 0, 0, 0}},
+    {'A', {2, 5, 7, 5, 5}}, {'B', {6, 5, 6, 5, 6}}, {'C', {3, 4, 4, 4, 3}}, {'D', {6, 5, 5, 5, 6}},
+    {'E', {7, 4, 6, 4, 7}}, {'F', {7, 4, 6, 4, 4}}, {'G', {3, 4, 5, 5, 3}}, {'H', {5, 5, 7, 5, 5}},
+    {'I', {7, 2, 2, 2, 7}}, {'J', {1, 1, 1, 5, 2}}, {'K', {5, 5, 6, 5, 5}}, {'L', {4, 4, 4, 4, 7}},
+    {'M', {5, 7, 7, 5, 5}}, {'N', {6, 5, 5, 5, 5}}, {'O', {2, 5, 5, 5, 2}}, {'P', {6, 5, 6, 4, 4}},
+    {'Q', {2, 5, 5, 6, 3}}, {'R', {6, 5, 6, 5, 5}}, {'S', {3, 4, 2, 1, 6}}, {'T', {7, 2, 2, 2, 2}},
+    {'U', {5, 5, 5, 5, 7}}, {'V', {5, 5, 5, 5, 2}}, {'W', {5, 5, 7, 7, 5}}, {'X', {5, 5, 2, 5, 5}},
+    {'Y', {5, 5, 2, 2, 2}}, {'Z', {7, 1, 2, 4, 7}},
+    {'0', {7, 5, 5, 5, 7}}, {'1', {2, 6, 2, 2, 7}}, {'2', {6, 1, 2, 4, 7}}, {'3', {6, 1, 2, 1, 6}},
+    {'4', {5, 5, 7, 1, 1}}, {'5', {7, 4, 6, 1, 6}}, {'6', {3, 4, 7, 5, 7}}, {'7', {7, 1, 2, 2, 2}},
+    {'8', {7, 5, 7, 5, 7}}, {'9', {7, 5, 7, 1, 6}},
+    {'-', {0, 0, 7, 0, 0}}, {'.', {0, 0, 0, 0, 2}}, {',', {0, 0, 0, 2, 4}}, {'\'', {2, 2, 0, 0, 0}},
+    {'!', {2, 2, 2, 0, 2}}, {'?', {6, 1, 2, 0, 2}}, {':', {0, 2, 0, 2, 0}}, {'/', {1, 1, 2, 4, 4}},
+    {'(', {1, 2, 2, 2, 1}}, {')', {4, 2, 2, 2, 4}}, {'_', {0, 0, 0, 0, 7}}, {'+', {0, 2, 7, 2, 0}},
+    {'&', {2, 5, 2, 5, 3}}, {'>', {4, 2, 1, 2, 4}},
+};
+
+// ROM files are usually .ch8 or have no extension at all like the ones in roms/
+static bool is_rom_file(const char *name) {
+    const char *dot = strrchr(name, '.');
+    if(name[0] == '.') return false;
+    if(!dot) return true;
+
+    const char *extensions[] = {".ch8", ".c8", ".sc8", ".xo8", ".mc8", ".o8"};
+    for(size_t i = 0; i < sizeof extensions / sizeof extensions[0]; i++)
+        if(strcmp(dot, extensions[i]) == 0) return true;
+
+    return false;
+}
+
+// Title from the ROM database, NULL for unknown or unreadable ROMs
+static const char *rom_title(const char *path) {
+    FILE *file = fopen(path, "rb");
+    if(!file) return NULL;
+
+    uint8_t rom[CHIP8_XO_RAM_SIZE];
+    const size_t rom_size = fread(rom, 1, sizeof rom, file);
+    fclose(file);
+
+    const romdb_entry_t *entry = romdb_find(rom, rom_size);
+    return entry ? entry->title : NULL;
+}
+
+static bool add_entry(menu_t *menu, const char *path, const char *title, size_t *capacity) {
+    if(menu->count == *capacity) {
+        const size_t new_capacity = *capacity ? *capacity * 2 : 32;
+        char **paths = realloc(menu->paths, new_capacity * sizeof *paths);
+        if(paths) menu->paths = paths;
+        char **titles = realloc(menu->titles, new_capacity * sizeof *titles);
+        if(titles) menu->titles = titles;
+        if(!paths || !titles) return false;
+
+        *capacity = new_capacity;
+    }
+
+    menu->paths[menu->count] = strdup(path);
+    menu->titles[menu->count] = strdup(title);
+    if(!menu->paths[menu->count] || !menu->titles[menu->count]) {
+        free(menu->paths[menu->count]);
+        free(menu->titles[menu->count]);
+        return false;
+    }
+
+    menu->count++;
+    return true;
+}
+
+// Sort by title, insertion sort is plenty for a directory of ROMs
+static void sort_entries(menu_t *menu) {
+    for(size_t i = 1; i < menu->count; i++) {
+        char *path = menu->paths[i];
+        char *title = menu->titles[i];
+        size_t j = i;
+
+        for(; j > 0 && strcasecmp(menu->titles[j - 1], title) > 0; j--) {
+            menu->paths[j] = menu->paths[j - 1];
+            menu->titles[j] = menu->titles[j - 1];
+        }
+
+        menu->paths[j] = path;
+        menu->titles[j] = title;
+    }
+}
+
+// List the ROM files in dir, files too big for 64KB of memory are left out
+bool menu_scan(menu_t *menu, const char *dir) {
+    menu_free(menu);
+    snprintf(menu->dir, sizeof menu->dir, "%s", dir);
+
+    DIR *handle = opendir(dir);
+    if(!handle) {
+        fprintf(stderr, "Could not open ROM directory %s\n", dir);
+        return false;
+    }
+
+    size_t capacity = 0;
+    bool ok = true;
+    struct dirent *file;
+
+    while(ok && (file = readdir(handle))) {
+        char path[FILENAME_MAX];
+        struct stat info;
+
+        if(!is_rom_file(file->d_name)) continue;
+        snprintf(path, sizeof path, "%s/%s", dir, file->d_name);
+
+        if(stat(path, &info) != 0 || !S_ISREG(info.st_mode)) continue;
+        if(info.st_size == 0 || info.st_size > CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT) continue;
+
+        const char *title = rom_title(path);
+        ok = add_entry(menu, path, title ? title : file->d_name, &capacity);
+    }
+
+    closedir(handle);
+
+    if(!ok) {
+        fprintf(stderr, "Out of memory listing %s\n", dir);
+        menu_free(menu);
+        return false;
+    }
+
+    sort_entries(menu);
+    return true;
+}
+
+// Move the selection, the list scrolls to keep it on screen
+void menu_move(menu_t *menu, int delta) {
+    if(menu->count == 0) return;
+
+    if(delta < 0 && (size_t)-delta > menu->selected) menu->selected = 0;
+    else if(delta > 0 && menu->selected + delta >= menu->count) menu->selected = menu->count - 1;
+    else menu->selected += delta;
+
+    if(menu->selected < menu->top) menu->top = menu->selected;
+    if(menu->selected >= menu->top + MENU_LINES) menu->top = menu->selected - MENU_LINES + 1;
+}
+
+const char *menu_selected_path(const menu_t *menu) {
+    return menu->count > 0 ? menu->paths[menu->selected] : NULL;
+}
+
+void menu_free(menu_t *menu) {
+    for(size_t i = 0; i < menu->count; i++) {
+        free(menu->paths[i]);
+        free(menu->titles[i]);
+    }
+
+    free(menu->paths);
+    free(menu->titles);
+    menu->paths = NULL;
+    menu->titles = NULL;
+    menu->count = 0;
+    menu->selected = 0;
+    menu->top = 0;
+}
+
+static void set_pixel(chip8_t *screen, int x, int y, bool on) {
+    if(x < 0 || y < 0 || x >= CHIP8_HIRES_WIDTH || y >= CHIP8_HIRES_HEIGHT) return;
+    screen->display[y * CHIP8_HIRES_WIDTH + x] = on ? 0x1 : 0x0;
+}
+
+// Draw up to MENU_COLUMNS characters, inverted draws dark text on a lit bar
+static void draw_text(chip8_t *screen, int y, const char *text, bool inverted) {
+    if(inverted) {
+        for(int row = y - 1; row < y + MENU_LINE_HEIGHT - 1; row++)
+            for(int x = 0; x < CHIP8_HIRES_WIDTH; x++) set_pixel(screen, x, row, true);
+    }
+
+    for(int col = 0; text[col] && col < MENU_COLUMNS; col++) {
+        const char c = toupper((unsigned char)text[col]);
+        size_t glyph = 0;
+
+        while(glyph < sizeof glyphs / sizeof glyphs[0] && glyphs[glyph].c != c) glyph++;
+        if(glyph == sizeof glyphs / sizeof glyphs[0]) {
+            glyph = 0;
+            while(glyphs[glyph].c != '?') glyph++;
+        }
+
+        for(int row = 0; row < 5; row++) {
+            for(int bit = 0; bit < 3; bit++) {
+                if(glyphs[glyph].rows[row] & (0x4 >> bit))
+                    set_pixel(screen, MENU_LEFT + col * MENU_CHAR_WIDTH + bit, y + row, !inverted);
+            }
+        }
+    }
+}
+
+void menu_draw(menu_t *menu, chip8_t *screen) {
+    char line[MENU_COLUMNS + 1];
+
+    screen->hires = true;
+    memset(screen->display, 0, sizeof screen->display);
+
+    // Title line with the position in the list
+    if(menu->count > 0) snprintf(line, sizeof line, "ROMS %zu/%zu", menu->selected + 1, menu->count);
+    else snprintf(line, sizeof line, "NO ROMS IN %.20s", menu->dir);
+    draw_text(screen, 1, line, false);
+
+    for(int x = 0; x < CHIP8_HIRES_WIDTH; x++) set_pixel(screen, x, MENU_LIST_TOP - 2, true);
+
+    for(size_t i = 0; i < MENU_LINES && menu->top + i < menu->count; i++) {
+        const size_t entry = menu->top + i;
+        draw_text(screen, MENU_LIST_TOP + 1 + i * MENU_LINE_HEIGHT, menu->titles[entry], entry == menu->selected);
+    }
+
+    chip8_set_dirty(screen);
+}
@@ -0,0 +1,32 @@
+#ifndef MENU_H
+#define MENU_H
+
+#include <stddef.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Menu lines shown at once, below the title line
+#define MENU_LIST_TOP    9
+#define MENU_LINE_HEIGHT 6
+#define MENU_LINES       ((CHIP8_HIRES_HEIGHT - MENU_LIST_TOP) / MENU_LINE_HEIGHT)
+
+// ROM launcher, lists the ROM files in a directory
+typedef struct {
+    char dir[FILENAME_MAX];
+    char **paths;           // Full paths, sorted by title
+    char **titles;          // From the ROM database, the file name for unknown ROMs
+    size_t count;
+    size_t selected;
+    size_t top;             // First entry on screen
+} menu_t;
+
+bool menu_scan(menu_t *menu, const char *dir);
+void menu_move(menu_t *menu, int delta);
+const char *menu_selected_path(const menu_t *menu);
+void menu_free(menu_t *menu);
+
+// Draw the menu as text into a hires CHIP8 display, so any renderer can show it
+void menu_draw(menu_t *menu, chip8_t *screen);
+
+#endif // MENU_H
@@ -0,0 +1,146 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "movie.h"
+
+// Movie files are text, a header followed by one keypad change per line:
+//   chip8-movie 1
+//   seed <n>
+//   frames <n>
+//   <frame> <key 0-F> down|up
+#define MOVIE_MAGIC   "chip8-movie"
+#define MOVIE_VERSION 1
+
+void movie_init(movie_t *movie, uint32_t seed) {
+    *movie = (movie_t) {0};
+    movie->seed = seed;
+}
+
+static bool add_event(movie_t *movie, uint32_t frame, uint8_t key, bool pressed) {
+    if(movie->count == movie->capacity) {
+        const size_t capacity = movie->capacity ? movie->capacity * 2 : 256;
+        movie_event_t *events = realloc(movie->events, capacity * sizeof *events);
+        if(!events) return false;
+
+        movie->events = events;
+        movie->capacity = capacity;
+    }
+
+    movie->events[movie->count++] = (movie_event_t) {.frame = frame, .key = key, .pressed = pressed};
+    return true;
+}
+
+// Record the keypad state the frame is about to run with, only changes are stored
+bool movie_record_frame(movie_t *movie, const chip8_t *chip8, uint32_t frame) {
+    for(uint8_t key = 0; key < 16; key++) {
+        const bool pressed = chip8_key(chip8, key);
+        if(pressed == movie->keys[key]) continue;
+
+        if(!add_event(movie, frame, key, pressed)) return false;
+        movie->keys[key] = pressed;
+    }
+
+    movie->frames = frame + 1;
+    return true;
+}
+
+// Set the keypad to the recorded state for the frame, overriding live input
+void movie_play_frame(movie_t *movie, chip8_t *chip8, uint32_t frame) {
+    while(movie->next < movie->count && movie->events[movie->next].frame <= frame) {
+        const movie_event_t *event = &movie->events[movie->next++];
+        movie->keys[event->key] = event->pressed;
+    }
+
+    for(uint8_t key = 0; key < 16; key++) chip8_set_key(chip8, key, movie->keys[key]);
+}
+
+bool movie_finished(const movie_t *movie, uint32_t frame) {
+    return frame >= movie->frames;
+}
+
+bool movie_save_file(const movie_t *movie, const char *path, char *error, size_t size) {
+    FILE *file = fopen(path, "w");
+    if(!file) {
+        snprintf(error, size, "Could not open movie file %s for writing", path);
+        return false;
+    }
+
+    fprintf(file, "%s %d\nseed %u\nframes %u\n", MOVIE_MAGIC, MOVIE_VERSION, movie->seed, movie->frames);
+    for(size_t i = 0; i < movie->count; i++) {
+        const movie_event_t *event = &movie->events[i];
+        fprintf(file, "%u %X %s\n", event->frame, event->key, event->pressed ? "down" : "up");
+    }
+
+    const bool ok = !ferror(file);
+    if(fclose(file) != 0 || !ok) {
+        snprintf(error, size, "Could not write movie file %s", path);
+        return false;
+    }
+
+    return true;
+}
+
+static bool read_header(FILE *file, const char *format, void *value) {
+    char line[128];
+    return fgets(line, sizeof line, file) && sscanf(line, format, value) == 1;
+}
+
+bool movie_load_file(movie_t *movie, const char *path, char *error, size_t size) {
+    FILE *file = fopen(path, "r");
+    if(!file) {
+        snprintf(error, size, "Could not open movie file %s", path);
+        return false;
+    }
+
+    movie_t loaded = {.playing = true};
+    char line[128];
+    uint32_t line_num = 3;
+    bool ok = true;
+
+    // Header lines are all required and in order
+    int version = 0;
+    if(!read_header(file, MOVIE_MAGIC " %d", &version) || !read_header(file, "seed %u", &loaded.seed) ||
+       !read_header(file, "frames %u", &loaded.frames)) {
+        snprintf(error, size, "%s: invalid movie header", path);
+        ok = false;
+    } else if(version != MOVIE_VERSION) {
+        snprintf(error, size, "%s: unsupported movie version %d, expected %d", path, version, MOVIE_VERSION);
+        ok = false;
+    }
+
+    while(ok && fgets(line, sizeof line, file)) {
+        line_num++;
+
+        uint32_t frame, key;
+        char state[8];
+        const uint32_t last_frame = loaded.count ? loaded.events[loaded.count - 1].frame : 0;
+
+        if(sscanf(line, "%u %x %7s", &frame, &key, state) != 3 || key > 0xF ||
+           (strcmp(state, "down") != 0 && strcmp(state, "up") != 0) || frame < last_frame) {
+            snprintf(error, size, "%s:%u: invalid movie event", path, line_num);
+            ok = false;
+        } else if(!add_event(&loaded, frame, key, strcmp(state, "down") == 0)) {
+            snprintf(error, size, "Out of memory loading movie %s", path);
+            ok = false;
+        }
+    }
+
+    fclose(file);
+
+    if(!ok) {
+        movie_free(&loaded);
+        return false;
+    }
+
+    movie_free(movie);
+    *movie = loaded;
+    return true;
+}
+
+void movie_free(movie_t *movie) {
+    free(movie->events);
+    movie->events = NULL;
+    movie->count = 0;
+    movie->capacity = 0;
+}
@@ -0,0 +1,39 @@
+#ifndef MOVIE_H
+#define MOVIE_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Keypad change applied at the start of a frame
+typedef struct {
+    uint32_t frame;
+    uint8_t key;
+    bool pressed;
+} movie_event_t;
+
+// Recorded keypad input for a run, replayed frame by frame it reproduces the run exactly
+// as long as the RNG seed, speed and quirks are the same
+typedef struct {
+    uint32_t seed;          // RNG seed the recording started with
+    uint32_t frames;        // Length of the recording
+    movie_event_t *events;  // Sorted by frame
+    size_t count;
+    size_t capacity;
+    size_t next;            // Next event to play back
+    bool keys[16];          // Keypad after the last recorded or played frame
+    bool playing;           // Loaded for playback, otherwise recording
+} movie_t;
+
+void movie_init(movie_t *movie, uint32_t seed);
+bool movie_record_frame(movie_t *movie, const chip8_t *chip8, uint32_t frame);
+void movie_play_frame(movie_t *movie, chip8_t *chip8, uint32_t frame);
+bool movie_finished(const movie_t *movie, uint32_t frame);
+// On failure error gets a message saying why, the movie is left as it was when loading fails
+bool movie_save_file(const movie_t *movie, const char *path, char *error, size_t size);
+bool movie_load_file(movie_t *movie, const char *path, char *error, size_t size);
+void movie_free(movie_t *movie);
+
+#endif // MOVIE_H
@@ -0,0 +1,112 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <string.h>
+#include <errno.h>
+#include <time.h>
+#include <unistd.h>
+#include <netdb.h>
+#include <sys/socket.h>
+
+#include "net.h"
+
+int net_listen(const char *address) {
+    char host[256] = "127.0.0.1";
+    const char *port = address;
+    const char *colon = strrchr(address, ':');
+
+    if(colon) {
+        if(colon > address) snprintf(host, sizeof host, "%.*s", (int)(colon - address), address);
+        port = colon + 1;
+    }
+
+    struct addrinfo hints = {.ai_family = AF_UNSPEC, .ai_socktype = SOCK_STREAM, .ai_flags = AI_PASSIVE};
+    struct addrinfo *result;
+    const int error = getaddrinfo(host, port, &hints, &result);
+    if(error != 0) {
+        fprintf(stderr, "Invalid address %s: %s\n", address, gai_strerror(error));
+        return -1;
+    }
+
+    int fd = -1;
+    for(struct addrinfo *ai = result; ai && fd < 0; ai = ai->ai_next) {
+        fd = socket(ai->ai_family, ai->ai_socktype, ai->ai_protocol);
+        if(fd < 0) continue;
+
+        // Restarting right after a run shouldn't fail on the old connections
+        const int yes = 1;
+        setsockopt(fd, SOL_SOCKET, SO_REUSEADDR, &yes, sizeof yes);
+        if(bind(fd, ai->ai_addr, ai->ai_addrlen) != 0 || listen(fd, 8) != 0) {
+            close(fd);
+            fd = -1;
+        }
+    }
+
+    freeaddrinfo(result);
+    if(fd < 0) fprintf(stderr, "Could not listen on %s: %s\n", address, strerror(errno));
+    return fd;
+}
+
+int net_connect(const char *address) {
+    char host[256];
+    const char *colon = strrchr(address, ':');
+
+    if(!colon || colon == address || (size_t)(colon - address) >= sizeof host) {
+        fprintf(stderr, "Invalid address %s, expected <host>:<port>\n", address);
+        return -1;
+    }
+    snprintf(host, sizeof host, "%.*s", (int)(colon - address), address);
+
+    struct addrinfo hints = {.ai_family = AF_UNSPEC, .ai_socktype = SOCK_STREAM};
+    struct addrinfo *result;
+    const int error = getaddrinfo(host, colon + 1, &hints, &result);
+    if(error != 0) {
+        fprintf(stderr, "Invalid address %s: %s\n", address, gai_strerror(error));
+        return -1;
+    }
+
+    int fd = -1;
+    for(struct addrinfo *ai = result; ai && fd < 0; ai = ai->ai_next) {
+        fd = socket(ai->ai_family, ai->ai_socktype, ai->ai_protocol);
+        if(fd >= 0 && connect(fd, ai->ai_addr, ai->ai_addrlen) != 0) {
+            close(fd);
+            fd = -1;
+        }
+    }
+
+    freeaddrinfo(result);
+    if(fd < 0) fprintf(stderr, "Could not connect to %s: %s\n", address, strerror(errno));
+    return fd;
+}
+
+bool net_send(int fd, const void *data, size_t len) {
+    const char *bytes = data;
+
+    for(size_t sent = 0; sent < len; ) {
+        const ssize_t n = send(fd, &bytes[sent], len - sent, 0);
+        if(n < 0 && errno == EINTR) continue;
+        if(n <= 0) return false;
+        sent += n;
+    }
+
+    return true;
+}
+
+bool net_recv(int fd, void *data, size_t len) {
+    char *bytes = data;
+
+    for(size_t received = 0; received < len; ) {
+        const ssize_t n = recv(fd, &bytes[received], len - received, 0);
+        if(n < 0 && errno == EINTR) continue;
+        if(n <= 0) return false;
+        received += n;
+    }
+
+    return true;
+}
+
+uint64_t net_now_ms(void) {
+    struct timespec ts;
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    return (uint64_t)ts.tv_sec * 1000 + ts.tv_nsec / 1000000;
+}
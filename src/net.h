@@ -0,0 +1,26 @@
+#ifndef NET_H
+#define NET_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+// TCP helpers shared by the debug and web servers and netplay
+
+// Listening socket for "[host:]port", the host defaults to 127.0.0.1 so nothing is exposed
+// on the network by accident, -1 after printing the error
+int net_listen(const char *address);
+
+// Connected socket for "host:port", -1 after printing the error
+int net_connect(const char *address);
+
+// Send all of data, false if the peer went away
+bool net_send(int fd, const void *data, size_t len);
+
+// Wait for exactly len bytes, false if the peer went away first
+bool net_recv(int fd, void *data, size_t len);
+
+// Monotonic clock for pacing frames
+uint64_t net_now_ms(void);
+
+#endif // NET_H
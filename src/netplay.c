@@ -0,0 +1,258 @@
+#define _POSIX_C_SOURCE 200809L
+
+// Netplay protocol, all numbers big endian
+//
+// Handshake, once the other player connected:
+//   host:  "C8NP", u8 version, u8 delay, u32 instructions per second, u8 timing (chip8_timing_t),
+//          40 hex digits of the ROM's SHA-1, u32 state size, the save state of the machine
+//   other: "C8NP", u8 1 if it has the same ROM and loaded the state, 0 to refuse
+// Then both sides send one message per frame:
+//   u32 frame, u16 keypad bits (bit n is key n)
+// Messages are in frame order, starting at frame delay, the first delay frames have no keys pressed
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <errno.h>
+#include <signal.h>
+#include <poll.h>
+#include <unistd.h>
+#include <sys/socket.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+
+#include "netplay.h"
+#include "net.h"
+#include "log.h"
+#include "romdb.h"
+
+#define NETPLAY_MAGIC   "C8NP"
+#define NETPLAY_VERSION 2
+#define HELLO_SIZE      (4 + 1 + 1 + 4 + 1 + 40 + 4)
+#define MESSAGE_SIZE    6
+
+static void put_u32(uint8_t *data, uint32_t value) {
+    data[0] = value >> 24;
+    data[1] = value >> 16;
+    data[2] = value >> 8;
+    data[3] = value;
+}
+
+static uint32_t get_u32(const uint8_t *data) {
+    return (uint32_t)data[0] << 24 | (uint32_t)data[1] << 16 | (uint32_t)data[2] << 8 | data[3];
+}
+
+// Nothing before the first delay frames, and keypad messages go out as soon as they're ready
+static void start(netplay_t *netplay, int fd, uint32_t delay) {
+    *netplay = (netplay_t) {.fd = fd, .delay = delay, .sent = delay, .received = delay};
+
+    const int yes = 1;
+    setsockopt(fd, IPPROTO_TCP, TCP_NODELAY, &yes, sizeof yes);
+}
+
+static bool host(netplay_t *netplay, const char *address, uint32_t delay, const chip8_t *chip8,
+                 uint32_t insts_per_second, chip8_timing_t timing) {
+    const int listen_fd = net_listen(address);
+    if(listen_fd < 0) return false;
+
+    log_write(CHIP8_LOG_INFO, "netplay", "Waiting for the other player on %s", address);
+    int fd;
+    do {
+        fd = accept(listen_fd, NULL, NULL);
+    } while(fd < 0 && errno == EINTR);
+    close(listen_fd);
+
+    if(fd < 0) {
+        log_write(CHIP8_LOG_ERROR, "netplay", "Could not accept the other player: %s", strerror(errno));
+        return false;
+    }
+
+    const size_t state_size = chip8_state_size(chip8);
+    uint8_t *hello = malloc(HELLO_SIZE + state_size);
+    if(!hello) {
+        close(fd);
+        return false;
+    }
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+    memcpy(hello, NETPLAY_MAGIC, 4);
+    hello[4] = NETPLAY_VERSION;
+    hello[5] = delay;
+    put_u32(&hello[6], insts_per_second);
+    hello[10] = timing;
+    memcpy(&hello[11], sha1, 40);
+    put_u32(&hello[51], state_size);
+    chip8_serialize(chip8, &hello[HELLO_SIZE], state_size);
+
+    uint8_t reply[5];
+    const bool sent = net_send(fd, hello, HELLO_SIZE + state_size);
+    free(hello);
+
+    if(!sent || !net_recv(fd, reply, sizeof reply) || memcmp(reply, NETPLAY_MAGIC, 4) != 0) {
+        log_write(CHIP8_LOG_ERROR, "netplay", "The other player disconnected before the game started");
+        close(fd);
+        return false;
+    }
+    if(reply[4] != 1) {
+        log_write(CHIP8_LOG_ERROR, "netplay", "The other player doesn't have the same ROM loaded");
+        close(fd);
+        return false;
+    }
+
+    start(netplay, fd, delay);
+    log_write(CHIP8_LOG_INFO, "netplay", "The other player joined, %u frames of input delay", delay);
+    return true;
+}
+
+static bool refuse(int fd, const char *reason) {
+    const uint8_t reply[5] = {'C', '8', 'N', 'P', 0};
+    net_send(fd, reply, sizeof reply);
+    close(fd);
+
+    log_write(CHIP8_LOG_ERROR, "netplay", "%s", reason);
+    return false;
+}
+
+static bool join(netplay_t *netplay, const char *address, chip8_t *chip8, uint32_t *insts_per_second,
+                 chip8_timing_t *timing) {
+    const int fd = net_connect(address);
+    if(fd < 0) return false;
+
+    uint8_t hello[HELLO_SIZE];
+    if(!net_recv(fd, hello, sizeof hello) || memcmp(hello, NETPLAY_MAGIC, 4) != 0)
+        return refuse(fd, "The host didn't send a netplay greeting");
+    if(hello[4] != NETPLAY_VERSION) return refuse(fd, "The host runs a different netplay version");
+    if(hello[5] > NETPLAY_MAX_DELAY) return refuse(fd, "The host asked for too much input delay");
+    if(hello[10] != CHIP8_TIMING_FLAT && hello[10] != CHIP8_TIMING_VIP)
+        return refuse(fd, "The host runs a timing this version doesn't know");
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+    if(memcmp(&hello[11], sha1, 40) != 0) return refuse(fd, "The host is running a different ROM");
+
+    // Bigger than any save state, even with Mega-Chip
+    const uint32_t state_size = get_u32(&hello[51]);
+    if(state_size > 2 * sizeof *chip8) return refuse(fd, "The host sent an invalid machine");
+
+    uint8_t *state = malloc(state_size);
+    if(!state) return refuse(fd, "Out of memory for the host's machine");
+
+    // Speed and timing first, setting them starts the frame's remainder and machine cycles over and the
+    // state has the host's
+    chip8_set_speed(chip8, get_u32(&hello[6]));
+    chip8_set_timing(chip8, hello[10]);
+    const bool loaded = net_recv(fd, state, state_size) && chip8_deserialize(chip8, state, state_size);
+    free(state);
+    if(!loaded) return refuse(fd, "Could not load the host's machine");
+
+    const uint8_t reply[5] = {'C', '8', 'N', 'P', 1};
+    if(!net_send(fd, reply, sizeof reply)) return refuse(fd, "The host disconnected before the game started");
+
+    *insts_per_second = get_u32(&hello[6]);
+    *timing = hello[10];
+    start(netplay, fd, hello[5]);
+    log_write(CHIP8_LOG_INFO, "netplay", "Joined %s, %u frames of input delay", address, netplay->delay);
+    return true;
+}
+
+// A player leaving shows up as a failed send instead of a SIGPIPE, until netplay_close()
+bool netplay_host(netplay_t *netplay, const char *address, uint32_t delay, const chip8_t *chip8,
+                  uint32_t insts_per_second, chip8_timing_t timing) {
+    void (*old_sigpipe)(int) = signal(SIGPIPE, SIG_IGN);
+    if(!host(netplay, address, delay, chip8, insts_per_second, timing)) {
+        signal(SIGPIPE, old_sigpipe);
+        return false;
+    }
+
+    netplay->old_sigpipe = old_sigpipe;
+    return true;
+}
+
+bool netplay_join(netplay_t *netplay, const char *address, chip8_t *chip8, uint32_t *insts_per_second,
+                  chip8_timing_t *timing) {
+    void (*old_sigpipe)(int) = signal(SIGPIPE, SIG_IGN);
+    if(!join(netplay, address, chip8, insts_per_second, timing)) {
+        signal(SIGPIPE, old_sigpipe);
+        return false;
+    }
+
+    netplay->old_sigpipe = old_sigpipe;
+    return true;
+}
+
+static bool key_hook(void *userdata, uint8_t key, bool pressed) {
+    const netplay_t *netplay = userdata;
+    (void)pressed;
+    return netplay->keys >> key & 1;
+}
+
+void netplay_attach(netplay_t *netplay, chip8_t *chip8) {
+    chip8_set_key_hook(chip8, key_hook, netplay);
+}
+
+static bool disconnect(netplay_t *netplay, const char *reason) {
+    if(!netplay->disconnected) log_write(CHIP8_LOG_WARN, "netplay", "%s", reason);
+    netplay->disconnected = true;
+    return false;
+}
+
+// Take in whatever arrived without waiting
+static bool receive(netplay_t *netplay, uint32_t frame) {
+    struct pollfd pfd = {.fd = netplay->fd, .events = POLLIN};
+
+    while(poll(&pfd, 1, 0) > 0) {
+        const ssize_t n = recv(netplay->fd, &netplay->partial[netplay->partial_size],
+                               MESSAGE_SIZE - netplay->partial_size, 0);
+        if(n < 0 && errno == EINTR) continue;
+        if(n <= 0) return disconnect(netplay, "The other player left");
+
+        netplay->partial_size += n;
+        if(netplay->partial_size < MESSAGE_SIZE) continue;
+        netplay->partial_size = 0;
+
+        const uint32_t message_frame = get_u32(netplay->partial);
+        if(message_frame != netplay->received || message_frame - frame >= NETPLAY_BUFFER)
+            return disconnect(netplay, "The other player's input is out of step, stopping");
+
+        netplay->remote[message_frame % NETPLAY_BUFFER] = netplay->partial[4] << 8 | netplay->partial[5];
+        netplay->received++;
+    }
+
+    return true;
+}
+
+bool netplay_frame(netplay_t *netplay, const chip8_t *chip8, uint32_t frame) {
+    if(netplay->disconnected) return false;
+
+    // What this player holds now is pressed delay frames later on both machines
+    while(netplay->sent <= frame + netplay->delay) {
+        uint16_t keys = 0;
+        for(uint8_t key = 0; key < 16; key++)
+            if(chip8_key(chip8, key)) keys |= 1 << key;
+
+        uint8_t message[MESSAGE_SIZE];
+        put_u32(message, netplay->sent);
+        message[4] = keys >> 8;
+        message[5] = keys & 0xFF;
+        if(!net_send(netplay->fd, message, sizeof message)) return disconnect(netplay, "The other player left");
+
+        netplay->local[netplay->sent % NETPLAY_BUFFER] = keys;
+        netplay->sent++;
+    }
+
+    if(!receive(netplay, frame) || netplay->received <= frame) return false;
+
+    netplay->keys = netplay->local[frame % NETPLAY_BUFFER] | netplay->remote[frame % NETPLAY_BUFFER];
+    return true;
+}
+
+void netplay_close(netplay_t *netplay, chip8_t *chip8) {
+    chip8_set_key_hook(chip8, NULL, NULL);
+    if(netplay->fd < 0) return;
+
+    close(netplay->fd);
+    netplay->fd = -1;
+    signal(SIGPIPE, netplay->old_sigpipe);
+}
@@ -0,0 +1,50 @@
+#ifndef NETPLAY_H
+#define NETPLAY_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+#define NETPLAY_DEFAULT_DELAY 2
+#define NETPLAY_MAX_DELAY     30
+#define NETPLAY_BUFFER        64    // Frames of keypad input kept, the other side is at most twice the delay ahead
+
+// Two players on one machine over TCP, each side runs its own copy in lockstep
+// The host sends its machine and speed when the other player joins, from then on each side
+// sends its keypad for the frame delay frames ahead. A frame runs once both keypads for it are in,
+// and the ROM sees both players' keys together, so the copies run exactly the same frames
+typedef struct {
+    int fd;
+    uint32_t delay;         // Frames input is sent ahead, hides that much latency
+    uint16_t local[NETPLAY_BUFFER];     // Keypad bits per frame, indexed by frame % NETPLAY_BUFFER
+    uint16_t remote[NETPLAY_BUFFER];
+    uint32_t sent;          // Frames whose local keypad was sent
+    uint32_t received;      // Frames whose remote keypad came in
+    uint8_t partial[6];     // Start of a message not complete yet
+    size_t partial_size;
+    uint16_t keys;          // Keypad of the frame being run
+    bool disconnected;      // The other player left or sent something broken
+    void (*old_sigpipe)(int); // Put back by netplay_close()
+} netplay_t;
+
+// Wait for the other player on "[host:]port" and send them the machine, delay, speed and timing
+bool netplay_host(netplay_t *netplay, const char *address, uint32_t delay, const chip8_t *chip8,
+                  uint32_t insts_per_second, chip8_timing_t timing);
+
+// Connect to the host at "host:port" and take over its machine, speed and timing, the same ROM has to be loaded
+bool netplay_join(netplay_t *netplay, const char *address, chip8_t *chip8, uint32_t *insts_per_second,
+                  chip8_timing_t *timing);
+
+// Instructions read the frame's shared keypad through the key hook, chip8's own keypad stays
+// what this player presses
+void netplay_attach(netplay_t *netplay, chip8_t *chip8);
+
+// Call before running frame, sends this player's keypad and takes in the other's
+// False if the frame can't run yet, call again for the same frame later, or if disconnected is set
+bool netplay_frame(netplay_t *netplay, const chip8_t *chip8, uint32_t frame);
+
+void netplay_close(netplay_t *netplay, chip8_t *chip8);
+
+#endif // NETPLAY_H
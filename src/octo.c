@@ -0,0 +1,710 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <stdarg.h>
+#include <string.h>
+#include <strings.h>
+#include <ctype.h>
+
+#include "chip8.h"
+#include "octo.h"
+
+// The Octo language without macros and {} calculations, tokens are separated by whitespace:
+//
+//   : main                 Labels, a bare label name calls it, programs start at main
+//   :const SPEED 3         Named numbers
+//   :alias x v4            Other names for registers
+//   v0 := SPEED            Assignments and arithmetic, :=, +=, -=, |=, &=, ^=, =-, >>=, <<=
+//   i := long sprites      XO-CHIP 16 bit index load
+//   if x == 5 then v1 += 1 Conditions run the next statement, with begin ... else ... end a block
+//   loop ... while v0 != 0 ... again
+//   0xFF 0x81              Numbers on their own are data bytes
+//   :org :next :unpack :byte :pointer :call
+//   # comment              Comments run to the end of the line
+
+#define MAX_NAME_LEN  32
+#define MAX_NESTING   32
+#define MAX_WHILES    16
+
+typedef enum {
+    NAME_LABEL,
+    NAME_CONST,
+    NAME_ALIAS,
+} name_kind_t;
+
+typedef struct {
+    char name[MAX_NAME_LEN];
+    name_kind_t kind;
+    uint32_t value;             // Address, number or register
+} octo_name_t;
+
+typedef struct {
+    const char *text;
+    int line;
+} octo_token_t;
+
+// Open if ... begin and loop blocks, their jumps are patched when the block ends
+typedef struct {
+    bool loop;
+    uint32_t addr;              // Start of the loop, or the jump over the if block
+    uint32_t whiles[MAX_WHILES];
+    size_t while_count;
+} octo_block_t;
+
+// Assembler state, like asm.c the source is assembled twice
+// Pass 1 collects names, pass 2 emits code and reports errors
+typedef struct {
+    const char *file_name;
+    octo_token_t *tokens;
+    size_t token_count;
+    size_t next;
+    int line;
+    int pass;
+    uint32_t pc;
+    uint32_t end;
+    uint8_t *ram;
+    octo_name_t *names;
+    size_t name_count;
+    size_t name_cap;
+    octo_block_t blocks[MAX_NESTING];
+    size_t depth;
+    symbols_t *symbols;         // Lines are added in pass 2, NULL if not wanted
+    int errors;
+} octo_t;
+
+static void octo_error(octo_t *oc, const char *fmt, ...) {
+    if(oc->pass != 2) return;
+
+    va_list args;
+    va_start(args, fmt);
+    fprintf(stderr, "%s:%d: error: ", oc->file_name, oc->line);
+    vfprintf(stderr, fmt, args);
+    fputc('\n', stderr);
+    va_end(args);
+
+    oc->errors++;
+}
+
+bool octo_is_source(const char *name) {
+    const char *dot = strrchr(name, '.');
+    return dot && strcasecmp(dot, ".o8") == 0;
+}
+
+static bool is_identifier(const char *str) {
+    if(!(isalpha((unsigned char)*str) || *str == '_')) return false;
+
+    for(str++; *str; str++)
+        if(!(isalnum((unsigned char)*str) || *str == '_' || *str == '-')) return false;
+
+    return true;
+}
+
+// Split the source on whitespace into tokens pointing into text, which is modified
+static bool tokenize(octo_t *oc, char *text) {
+    size_t cap = 0;
+    int line = 1;
+
+    for(char *c = text; *c; ) {
+        if(*c == '\n') line++;
+        if(isspace((unsigned char)*c)) {
+            c++;
+            continue;
+        }
+
+        if(*c == '#') {
+            while(*c && *c != '\n') c++;
+            continue;
+        }
+
+        if(oc->token_count == cap) {
+            cap = cap ? cap * 2 : 1024;
+            octo_token_t *tokens = realloc(oc->tokens, cap * sizeof *tokens);
+            if(!tokens) {
+                fprintf(stderr, "Out of memory\n");
+                return false;
+            }
+            oc->tokens = tokens;
+        }
+
+        oc->tokens[oc->token_count++] = (octo_token_t){c, line};
+        while(*c && !isspace((unsigned char)*c)) c++;
+
+        if(*c) {
+            if(*c == '\n') line++;
+            *c++ = '\0';
+        }
+    }
+
+    return true;
+}
+
+static const char *peek_token(const octo_t *oc) {
+    return oc->next < oc->token_count ? oc->tokens[oc->next].text : NULL;
+}
+
+// Empty string at the end of the source, so callers can compare without checking
+static const char *next_token(octo_t *oc) {
+    if(oc->next >= oc->token_count) {
+        octo_error(oc, "unexpected end of file");
+        return "";
+    }
+
+    oc->line = oc->tokens[oc->next].line;
+    return oc->tokens[oc->next++].text;
+}
+
+static octo_name_t *find_name(const octo_t *oc, const char *name) {
+    for(size_t i = 0; i < oc->name_count; i++)
+        if(strcmp(oc->names[i].name, name) == 0) return &oc->names[i];
+
+    return NULL;
+}
+
+static void define_name(octo_t *oc, const char *name, name_kind_t kind, uint32_t value) {
+    if(!is_identifier(name)) {
+        octo_error(oc, "invalid name '%s'", name);
+        return;
+    }
+
+    // Constants and aliases are set again in pass 2, labels already have their address
+    octo_name_t *existing = find_name(oc, name);
+    if(oc->pass == 2) {
+        if(existing && kind != NAME_LABEL) existing->value = value;
+        return;
+    }
+
+    if(strlen(name) >= MAX_NAME_LEN) {
+        fprintf(stderr, "%s:%d: error: name %s is longer than %d characters\n",
+                oc->file_name, oc->line, name, MAX_NAME_LEN - 1);
+        oc->errors++;
+        return;
+    }
+
+    if(existing) {
+        fprintf(stderr, "%s:%d: error: %s is already defined\n", oc->file_name, oc->line, name);
+        oc->errors++;
+        return;
+    }
+
+    if(oc->name_count >= oc->name_cap) {
+        const size_t cap = oc->name_cap ? oc->name_cap * 2 : 64;
+        octo_name_t *names = realloc(oc->names, cap * sizeof *names);
+        if(!names) {
+            fprintf(stderr, "Out of memory\n");
+            oc->errors++;
+            return;
+        }
+
+        oc->names = names;
+        oc->name_cap = cap;
+    }
+
+    octo_name_t *entry = &oc->names[oc->name_count++];
+    strcpy(entry->name, name);
+    entry->kind = kind;
+    entry->value = value;
+}
+
+// v0-vf or an alias, -1 otherwise
+static int parse_register(const octo_t *oc, const char *str) {
+    if((str[0] == 'v' || str[0] == 'V') && isxdigit((unsigned char)str[1]) && str[2] == '\0')
+        return isdigit((unsigned char)str[1]) ? str[1] - '0' : toupper((unsigned char)str[1]) - 'A' + 10;
+
+    const octo_name_t *alias = find_name(oc, str);
+    return alias && alias->kind == NAME_ALIAS ? (int)alias->value : -1;
+}
+
+static int expect_register(octo_t *oc) {
+    const char *str = next_token(oc);
+    const int reg = parse_register(oc, str);
+    if(reg < 0) octo_error(oc, "expected a register v0-vf, got '%s'", str);
+
+    return reg < 0 ? 0 : reg;
+}
+
+// Number, constant or label checked against max, negative numbers wrap around like in Octo
+static uint32_t parse_value(octo_t *oc, const char *str, uint32_t max) {
+    if(str[0] == '{') {
+        octo_error(oc, "{} calculations aren't supported");
+        return 0;
+    }
+
+    if(is_identifier(str)) {
+        const octo_name_t *name = find_name(oc, str);
+
+        // Labels defined further down are unknown in pass 1, sizes don't depend on their value
+        if(!name || name->kind == NAME_ALIAS) {
+            if(oc->pass == 2) octo_error(oc, name ? "%s is a register" : "undefined name %s", str);
+            return 0;
+        }
+
+        if(name->value > max) octo_error(oc, "%s (0x%X) out of range, maximum is 0x%X", str, name->value, max);
+        return name->value & max;
+    }
+
+    const bool negative = str[0] == '-';
+    const char *digits = negative ? str + 1 : str;
+    const bool binary = digits[0] == '0' && (digits[1] == 'b' || digits[1] == 'B');
+    char *end = NULL;
+    const unsigned long num = strtoul(binary ? digits + 2 : digits, &end, binary ? 2 : 0);
+
+    if(digits[0] == '\0' || digits[0] == '-' || *end != '\0' || (binary && digits[2] == '\0')) {
+        octo_error(oc, "expected a number or name, got '%s'", str);
+        return 0;
+    }
+
+    if(negative ? num > (max + 1) / 2 : num > max) {
+        octo_error(oc, "value %s out of range, maximum is 0x%X", str, max);
+        return 0;
+    }
+
+    return negative ? (uint32_t)(max + 1 - num) & max : (uint32_t)num;
+}
+
+static uint32_t expect_value(octo_t *oc, uint32_t max) {
+    return parse_value(oc, next_token(oc), max);
+}
+
+static void expect_token(octo_t *oc, const char *expected) {
+    const char *str = next_token(oc);
+    if(strcmp(str, expected) != 0) octo_error(oc, "expected '%s', got '%s'", expected, str);
+}
+
+static void emit_byte(octo_t *oc, uint8_t byte) {
+    if(oc->pc >= CHIP8_XO_RAM_SIZE) {
+        octo_error(oc, "program does not fit in memory");
+        return;
+    }
+
+    oc->ram[oc->pc++] = byte;
+    if(oc->pc > oc->end) oc->end = oc->pc;
+}
+
+static void emit_word(octo_t *oc, uint16_t word) {
+    emit_byte(oc, word >> 8);
+    emit_byte(oc, word & 0xFF);
+}
+
+// Point the jump at addr to target
+static void patch_jump(octo_t *oc, uint32_t addr, uint32_t target) {
+    if(target > 0xFFF) octo_error(oc, "jump target 0x%X is past 0xFFF", target);
+    if(addr + 1 >= CHIP8_XO_RAM_SIZE) return;
+
+    oc->ram[addr] = 0x10 | (target >> 8 & 0xF);
+    oc->ram[addr + 1] = target & 0xFF;
+}
+
+// Condition of if and while, the code emitted skips the next instruction when the condition is false,
+// or when it's true if inverted
+static void assemble_condition(octo_t *oc, bool inverted) {
+    const int x = expect_register(oc);
+    const char *op = next_token(oc);
+
+    if(strcmp(op, "key") == 0 || strcmp(op, "-key") == 0) {
+        const bool skip_unpressed = (strcmp(op, "key") == 0) != inverted;
+        emit_word(oc, (skip_unpressed ? 0xE0A1 : 0xE09E) | x << 8);
+        return;
+    }
+
+    const char *rhs = next_token(oc);
+    const int y = parse_register(oc, rhs);
+
+    if(strcmp(op, "==") == 0 || strcmp(op, "!=") == 0) {
+        const bool skip_equal = (strcmp(op, "!=") == 0) != inverted;
+
+        if(y >= 0) emit_word(oc, (skip_equal ? 0x5000 : 0x9000) | x << 8 | y << 4);
+        else       emit_word(oc, (skip_equal ? 0x3000 : 0x4000) | x << 8 | parse_value(oc, rhs, 0xFF));
+        return;
+    }
+
+    // The rest subtract in vf, whose flag is 1 when the left side is the larger or equal one
+    bool swapped, true_flag;
+    if(strcmp(op, "<") == 0)       { swapped = false; true_flag = false; }
+    else if(strcmp(op, ">=") == 0) { swapped = false; true_flag = true; }
+    else if(strcmp(op, ">") == 0)  { swapped = true;  true_flag = false; }
+    else if(strcmp(op, "<=") == 0) { swapped = true;  true_flag = true; }
+    else {
+        octo_error(oc, "unknown comparison '%s'", op);
+        emit_word(oc, 0);
+        return;
+    }
+
+    if(y >= 0) {
+        emit_word(oc, 0x8F00 | (swapped ? y : x) << 4);           // vf := left
+        emit_word(oc, 0x8F05 | (swapped ? x : y) << 4);           // vf -= right
+    } else {
+        emit_word(oc, 0x6F00 | parse_value(oc, rhs, 0xFF));      // vf := constant
+        emit_word(oc, (swapped ? 0x8F05 : 0x8F07) | x << 4);      // vf -= vx or vf =- vx
+    }
+
+    emit_word(oc, 0x3F00 | (true_flag == inverted));
+}
+
+static void push_block(octo_t *oc, bool loop, uint32_t addr) {
+    if(oc->depth == MAX_NESTING) {
+        octo_error(oc, "blocks nested deeper than %d", MAX_NESTING);
+        return;
+    }
+
+    oc->blocks[oc->depth++] = (octo_block_t){.loop = loop, .addr = addr};
+}
+
+static octo_block_t *open_block(octo_t *oc, bool loop, const char *keyword) {
+    if(oc->depth == 0 || oc->blocks[oc->depth - 1].loop != loop) {
+        octo_error(oc, "%s without %s", keyword, loop ? "loop" : "if ... begin");
+        return NULL;
+    }
+
+    return &oc->blocks[oc->depth - 1];
+}
+
+static void assemble_if(octo_t *oc) {
+    // Peek at then/begin first, the condition is inverted for a block
+    size_t end = oc->next;
+    while(end < oc->token_count && strcmp(oc->tokens[end].text, "then") != 0 &&
+          strcmp(oc->tokens[end].text, "begin") != 0 && end - oc->next < 3) end++;
+    const bool block = end < oc->token_count && strcmp(oc->tokens[end].text, "begin") == 0;
+
+    assemble_condition(oc, block);
+    expect_token(oc, block ? "begin" : "then");
+
+    if(block) {
+        // Skipped when the condition holds, otherwise goes to the else or the end
+        push_block(oc, false, oc->pc);
+        emit_word(oc, 0x1000);
+    }
+}
+
+static void assemble_while(octo_t *oc) {
+    octo_block_t *loop = NULL;
+    for(size_t i = oc->depth; i > 0 && !loop; i--)
+        if(oc->blocks[i - 1].loop) loop = &oc->blocks[i - 1];
+
+    if(!loop) octo_error(oc, "while without loop");
+    assemble_condition(oc, true);
+
+    if(loop && loop->while_count == MAX_WHILES) octo_error(oc, "more than %d whiles in a loop", MAX_WHILES);
+    else if(loop) loop->whiles[loop->while_count++] = oc->pc;
+    emit_word(oc, 0x1000);
+}
+
+static void assemble_register(octo_t *oc, int x) {
+    const char *op = next_token(oc);
+
+    if(strcmp(op, ":=") == 0) {
+        const char *src = next_token(oc);
+        const int y = parse_register(oc, src);
+
+        if(y >= 0)                           emit_word(oc, 0x8000 | x << 8 | y << 4);
+        else if(strcmp(src, "key") == 0)     emit_word(oc, 0xF00A | x << 8);
+        else if(strcmp(src, "delay") == 0)   emit_word(oc, 0xF007 | x << 8);
+        else if(strcmp(src, "random") == 0)  emit_word(oc, 0xC000 | x << 8 | expect_value(oc, 0xFF));
+        else                                 emit_word(oc, 0x6000 | x << 8 | parse_value(oc, src, 0xFF));
+        return;
+    }
+
+    if(strcmp(op, "+=") == 0 || strcmp(op, "-=") == 0) {
+        const bool add = strcmp(op, "+=") == 0;
+        const char *src = next_token(oc);
+        const int y = parse_register(oc, src);
+
+        if(y >= 0)    emit_word(oc, (add ? 0x8004 : 0x8005) | x << 8 | y << 4);
+        else if(add)  emit_word(oc, 0x7000 | x << 8 | parse_value(oc, src, 0xFF));
+        else          emit_word(oc, 0x7000 | x << 8 | ((0x100 - parse_value(oc, src, 0xFF)) & 0xFF));
+        return;
+    }
+
+    static const struct {
+        const char *op;
+        uint16_t opcode;
+    } alu[] = {
+        {"|=",  0x8001},
+        {"&=",  0x8002},
+        {"^=",  0x8003},
+        {">>=", 0x8006},
+        {"=-",  0x8007},
+        {"<<=", 0x800E},
+    };
+
+    for(size_t i = 0; i < sizeof alu / sizeof alu[0]; i++) {
+        if(strcmp(op, alu[i].op) == 0) {
+            emit_word(oc, alu[i].opcode | x << 8 | expect_register(oc) << 4);
+            return;
+        }
+    }
+
+    octo_error(oc, "unknown operator '%s'", op);
+    emit_word(oc, 0);
+}
+
+static void assemble_index(octo_t *oc) {
+    const char *op = next_token(oc);
+
+    if(strcmp(op, "+=") == 0) {
+        emit_word(oc, 0xF01E | expect_register(oc) << 8);
+        return;
+    }
+
+    if(strcmp(op, ":=") != 0) {
+        octo_error(oc, "unknown operator '%s'", op);
+        emit_word(oc, 0);
+        return;
+    }
+
+    const char *src = next_token(oc);
+    if(strcmp(src, "long") == 0) {
+        emit_word(oc, 0xF000);
+        emit_word(oc, expect_value(oc, 0xFFFF));
+    } else if(strcmp(src, "hex") == 0) {
+        emit_word(oc, 0xF029 | expect_register(oc) << 8);
+    } else if(strcmp(src, "bighex") == 0) {
+        emit_word(oc, 0xF030 | expect_register(oc) << 8);
+    } else {
+        emit_word(oc, 0xA000 | parse_value(oc, src, 0xFFF));
+    }
+}
+
+// save and load, with an optional "- vy" for the XO-CHIP register ranges
+static void assemble_save_load(octo_t *oc, bool save) {
+    const int x = expect_register(oc);
+    const char *dash = peek_token(oc);
+
+    if(dash && strcmp(dash, "-") == 0) {
+        next_token(oc);
+        emit_word(oc, (save ? 0x5002 : 0x5003) | x << 8 | expect_register(oc) << 4);
+    } else {
+        emit_word(oc, (save ? 0xF055 : 0xF065) | x << 8);
+    }
+}
+
+// Directives starting with a colon
+static void assemble_directive(octo_t *oc, const char *directive) {
+    if(strcmp(directive, ":") == 0) {
+        define_name(oc, next_token(oc), NAME_LABEL, oc->pc);
+    } else if(strcmp(directive, ":const") == 0) {
+        const char *name = next_token(oc);
+        define_name(oc, name, NAME_CONST, expect_value(oc, 0xFFFF));
+    } else if(strcmp(directive, ":alias") == 0) {
+        const char *name = next_token(oc);
+        define_name(oc, name, NAME_ALIAS, expect_register(oc));
+    } else if(strcmp(directive, ":next") == 0) {
+        // Names the second byte of the next instruction, for code that modifies itself
+        define_name(oc, next_token(oc), NAME_LABEL, oc->pc + 1);
+    } else if(strcmp(directive, ":org") == 0) {
+        oc->pc = expect_value(oc, CHIP8_XO_RAM_SIZE - 1);
+    } else if(strcmp(directive, ":byte") == 0) {
+        emit_byte(oc, expect_value(oc, 0xFF));
+    } else if(strcmp(directive, ":pointer") == 0) {
+        emit_word(oc, expect_value(oc, 0xFFFF));
+    } else if(strcmp(directive, ":call") == 0) {
+        emit_word(oc, 0x2000 | expect_value(oc, 0xFFF));
+    } else if(strcmp(directive, ":unpack") == 0) {
+        // v0 and v1 get the address, with a nibble in front of it or all 16 bits for long
+        const char *nibble = next_token(oc);
+        const bool wide = strcmp(nibble, "long") == 0;
+        const uint32_t high = wide ? 0 : parse_value(oc, nibble, 0xF);
+        const uint32_t addr = expect_value(oc, wide ? 0xFFFF : 0xFFF);
+
+        emit_word(oc, 0x6000 | ((high << 4 | addr >> 8) & 0xFF));
+        emit_word(oc, 0x6100 | (addr & 0xFF));
+    } else if(strcmp(directive, ":breakpoint") == 0) {
+        next_token(oc);
+    } else if(strcmp(directive, ":monitor") == 0) {
+        next_token(oc);
+        next_token(oc);
+    } else {
+        octo_error(oc, "%s isn't supported", directive);
+    }
+}
+
+static void assemble_statement(octo_t *oc) {
+    const char *token = next_token(oc);
+
+    // Instructions without operands
+    static const struct {
+        const char *name;
+        uint16_t opcode;
+    } plain[] = {
+        {"clear",        0x00E0},
+        {"return",       0x00EE},
+        {";",            0x00EE},
+        {"scroll-right", 0x00FB},
+        {"scroll-left",  0x00FC},
+        {"exit",         0x00FD},
+        {"lores",        0x00FE},
+        {"hires",        0x00FF},
+        {"audio",        0xF002},
+    };
+
+    // Instructions with a single register
+    static const struct {
+        const char *name;
+        uint16_t opcode;
+    } single[] = {
+        {"bcd",       0xF033},
+        {"saveflags", 0xF075},
+        {"loadflags", 0xF085},
+    };
+
+    for(size_t i = 0; i < sizeof plain / sizeof plain[0]; i++) {
+        if(strcmp(token, plain[i].name) == 0) {
+            emit_word(oc, plain[i].opcode);
+            return;
+        }
+    }
+
+    for(size_t i = 0; i < sizeof single / sizeof single[0]; i++) {
+        if(strcmp(token, single[i].name) == 0) {
+            emit_word(oc, single[i].opcode | expect_register(oc) << 8);
+            return;
+        }
+    }
+
+    const int x = parse_register(oc, token);
+    if(x >= 0) {
+        assemble_register(oc, x);
+    } else if(token[0] == ':') {
+        assemble_directive(oc, token);
+    } else if(strcmp(token, "i") == 0) {
+        assemble_index(oc);
+    } else if(strcmp(token, "delay") == 0 || strcmp(token, "buzzer") == 0 || strcmp(token, "pitch") == 0) {
+        const uint16_t opcode = token[0] == 'd' ? 0xF015 : token[0] == 'b' ? 0xF018 : 0xF03A;
+        expect_token(oc, ":=");
+        emit_word(oc, opcode | expect_register(oc) << 8);
+    } else if(strcmp(token, "jump") == 0) {
+        emit_word(oc, 0x1000 | expect_value(oc, 0xFFF));
+    } else if(strcmp(token, "jump0") == 0) {
+        emit_word(oc, 0xB000 | expect_value(oc, 0xFFF));
+    } else if(strcmp(token, "native") == 0) {
+        emit_word(oc, expect_value(oc, 0xFFF));
+    } else if(strcmp(token, "scroll-down") == 0 || strcmp(token, "scroll-up") == 0) {
+        emit_word(oc, (token[7] == 'd' ? 0x00C0 : 0x00D0) | expect_value(oc, 0xF));
+    } else if(strcmp(token, "sprite") == 0) {
+        const int sx = expect_register(oc);
+        const int sy = expect_register(oc);
+        emit_word(oc, 0xD000 | sx << 8 | sy << 4 | expect_value(oc, 0xF));
+    } else if(strcmp(token, "save") == 0 || strcmp(token, "load") == 0) {
+        assemble_save_load(oc, token[0] == 's');
+    } else if(strcmp(token, "plane") == 0) {
+        emit_word(oc, 0xF001 | expect_value(oc, 0x3) << 8);
+    } else if(strcmp(token, "if") == 0) {
+        assemble_if(oc);
+    } else if(strcmp(token, "else") == 0) {
+        octo_block_t *block = open_block(oc, false, "else");
+        if(block) {
+            const uint32_t jump = oc->pc;
+            emit_word(oc, 0x1000);
+            patch_jump(oc, block->addr, oc->pc);
+            block->addr = jump;
+        }
+    } else if(strcmp(token, "end") == 0) {
+        octo_block_t *block = open_block(oc, false, "end");
+        if(block) {
+            patch_jump(oc, block->addr, oc->pc);
+            oc->depth--;
+        }
+    } else if(strcmp(token, "loop") == 0) {
+        push_block(oc, true, oc->pc);
+    } else if(strcmp(token, "while") == 0) {
+        assemble_while(oc);
+    } else if(strcmp(token, "again") == 0) {
+        octo_block_t *loop = open_block(oc, true, "again");
+        if(loop) {
+            emit_word(oc, 0x1000);
+            patch_jump(oc, oc->pc - 2, loop->addr);
+            for(size_t i = 0; i < loop->while_count; i++) patch_jump(oc, loop->whiles[i], oc->pc);
+            oc->depth--;
+        }
+    } else if(isdigit((unsigned char)token[0]) || token[0] == '-') {
+        emit_byte(oc, parse_value(oc, token, 0xFF));
+    } else if(is_identifier(token)) {
+        // Constants are data bytes, labels and names yet to be defined in pass 1 are calls
+        const octo_name_t *name = find_name(oc, token);
+        if(name && name->kind == NAME_CONST) emit_byte(oc, parse_value(oc, token, 0xFF));
+        else emit_word(oc, 0x2000 | parse_value(oc, token, 0xFFF));
+    } else {
+        octo_error(oc, "unknown statement '%s'", token);
+    }
+}
+
+static void assemble_pass(octo_t *oc, int pass) {
+    oc->pass = pass;
+    oc->next = 0;
+    oc->line = 0;
+    oc->depth = 0;
+    oc->pc = CHIP8_ENTRY_POINT;
+    oc->end = CHIP8_ENTRY_POINT;
+
+    // Programs start at main, those that don't begin with it get a jump there
+    const bool main_first = oc->token_count >= 2 && strcmp(oc->tokens[0].text, ":") == 0 &&
+                            strcmp(oc->tokens[1].text, "main") == 0;
+    if(!main_first) {
+        oc->line = 1;
+        emit_word(oc, 0x1000 | parse_value(oc, "main", 0xFFF));
+    }
+
+    while(oc->next < oc->token_count) {
+        const uint32_t statement_pc = oc->pc;
+        const int line = oc->tokens[oc->next].line;
+
+        assemble_statement(oc);
+        if(pass == 2 && oc->symbols && oc->pc != statement_pc && !symbols_add_line(oc->symbols, statement_pc, line))
+            oc->errors++;
+    }
+
+    if(oc->depth > 0) octo_error(oc, "%s without %s", oc->blocks[oc->depth - 1].loop ? "loop" : "begin",
+                                 oc->blocks[oc->depth - 1].loop ? "again" : "end");
+}
+
+bool octo_assemble(const char *source, const char *file_name, uint8_t **rom, size_t *rom_size, symbols_t *symbols) {
+    octo_t oc = {
+        .file_name = file_name,
+        .ram = calloc(CHIP8_XO_RAM_SIZE, 1),
+        .symbols = symbols,
+    };
+
+    if(symbols) {
+        symbols_init(symbols);
+        snprintf(symbols->source, sizeof symbols->source, "%s", file_name);
+    }
+
+    char *text = malloc(strlen(source) + 1);
+    if(!oc.ram || !text) {
+        fprintf(stderr, "Out of memory\n");
+        free(oc.ram);
+        free(text);
+        return false;
+    }
+
+    strcpy(text, source);
+    bool ok = tokenize(&oc, text);
+
+    if(ok) assemble_pass(&oc, 1);
+    if(ok && oc.errors == 0) assemble_pass(&oc, 2);
+
+    for(size_t i = 0; ok && symbols && oc.errors == 0 && i < oc.name_count; i++)
+        if(oc.names[i].kind == NAME_LABEL && !symbols_add_label(symbols, oc.names[i].value, oc.names[i].name))
+            oc.errors++;
+
+    if(ok && oc.errors > 0) {
+        fprintf(stderr, "%s: %d error%s\n", file_name, oc.errors, oc.errors == 1 ? "" : "s");
+        ok = false;
+    }
+
+    if(ok) {
+        *rom_size = oc.end - CHIP8_ENTRY_POINT;
+        *rom = malloc(*rom_size ? *rom_size : 1);
+        if(*rom) memcpy(*rom, &oc.ram[CHIP8_ENTRY_POINT], *rom_size);
+        ok = *rom != NULL;
+    }
+
+    if(symbols && !ok) symbols_free(symbols);
+    if(symbols && ok) symbols_sort(symbols);
+
+    free(text);
+    free(oc.ram);
+    free(oc.tokens);
+    free(oc.names);
+    return ok;
+}
@@ -0,0 +1,17 @@
+#ifndef OCTO_H
+#define OCTO_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "symbols.h"
+
+// Assemble Octo source (.o8), see octo.c for the supported part of the language
+// Same conventions as asm_assemble(): errors go to stderr with line numbers, *rom is malloc'd
+bool octo_assemble(const char *source, const char *file_name, uint8_t **rom, size_t *rom_size, symbols_t *symbols);
+
+// Does the file name end in .o8
+bool octo_is_source(const char *name);
+
+#endif // OCTO_H
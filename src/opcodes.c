@@ -0,0 +1,271 @@
+#include <stdio.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "opcodes.h"
+
+#define VIP    CHIP8_PLATFORM_VIP
+#define SCHIP  CHIP8_PLATFORM_SCHIP
+#define XOCHIP CHIP8_PLATFORM_XOCHIP
+
+// Searched in order, so an entry can narrow down one further on (DXY0 before DXYN)
+const opcode_info_t opcode_table[] = {
+    {0x00E0, 0xFFFF, 0, "00E0", 2, "CLS", "clear", VIP, false, NULL,
+     "Clear the screen, in Mega-Chip mode show the frame drawn since the last 00E0 and start a new one"},
+    {0x00EE, 0xFFFF, 0, "00EE", 2, "RET", "return", VIP, false, NULL,
+     "Return from a subroutine"},
+    {0x00C0, 0xFFF0, 0, "00CN", 2, "SCD N", "scroll-down N", SCHIP, false, NULL,
+     "Scroll the screen N pixels down"},
+    {0x00D0, 0xFFF0, 0, "00DN", 2, "SCU N", "scroll-up N", XOCHIP, false, NULL,
+     "Scroll the screen N pixels up"},
+    {0x00FB, 0xFFFF, 0, "00FB", 2, "SCR", "scroll-right", SCHIP, false, NULL,
+     "Scroll the screen 4 pixels right"},
+    {0x00FC, 0xFFFF, 0, "00FC", 2, "SCL", "scroll-left", SCHIP, false, NULL,
+     "Scroll the screen 4 pixels left"},
+    {0x00FD, 0xFFFF, 0, "00FD", 2, "EXIT", "exit", SCHIP, false, NULL,
+     "Stop the interpreter"},
+    {0x00FE, 0xFFFF, 0, "00FE", 2, "LOW", "lores", SCHIP, false, NULL,
+     "Switch to the 64x32 screen"},
+    {0x00FF, 0xFFFF, 0, "00FF", 2, "HIGH", "hires", SCHIP, false, NULL,
+     "Switch to the 128x64 screen"},
+    {0x0010, 0xFFFF, 0, "0010", 2, "MEGAOFF", NULL, VIP, true, NULL,
+     "Leave Mega-Chip mode"},
+    {0x0011, 0xFFFF, 0, "0011", 2, "MEGAON", NULL, VIP, true, NULL,
+     "Switch to the 256x192 color screen of Mega-Chip mode"},
+    {0x00B0, 0xFFF0, 0, "00BN", 2, "SCRU N", NULL, VIP, true, NULL,
+     "Scroll the screen N pixels up"},
+    {0x0100, 0xFF00, 0, "01NN NNNN", 4, "LDHI NNNNNN", NULL, VIP, true, NULL,
+     "Set I to the 24 bit address made of NN and the next word"},
+    {0x0200, 0xFF00, 0, "02NN", 2, "LDPAL NN", NULL, VIP, true, NULL,
+     "Load palette colors 1 to NN from I, 4 bytes of ARGB each"},
+    {0x0300, 0xFF00, 0, "03NN", 2, "SPRW NN", NULL, VIP, true, NULL,
+     "Set the sprite width to NN, 0 is 256"},
+    {0x0400, 0xFF00, 0, "04NN", 2, "SPRH NN", NULL, VIP, true, NULL,
+     "Set the sprite height to NN, 0 is 256"},
+    {0x0500, 0xFF00, 0, "05NN", 2, "ALPHA NN", NULL, VIP, true, NULL,
+     "Set the screen alpha to NN"},
+    {0x0600, 0xFF00, 1, "060N", 2, "DIGISND N", NULL, VIP, true, NULL,
+     "Play the digitized sound at I, in a loop for N = 0 and once for N = 1"},
+    {0x0700, 0xFFFF, 0, "0700", 2, "STOPSND", NULL, VIP, true, NULL,
+     "Stop the digitized sound"},
+    {0x0800, 0xFF00, 5, "080N", 2, "BMODE N", NULL, VIP, true, NULL,
+     "Set the sprite blend mode: normal, 25%, 50%, 75%, add or multiply"},
+    {0x0900, 0xFF00, 0, "09NN", 2, "CCOL NN", NULL, VIP, true, NULL,
+     "Set the collision color to palette index NN"},
+
+    {0x1000, 0xF000, 0, "1NNN", 2, "JP NNN", "jump NNN", VIP, false, NULL,
+     "Jump to NNN"},
+    {0x2000, 0xF000, 0, "2NNN", 2, "CALL NNN", ":call NNN", VIP, false, NULL,
+     "Call the subroutine at NNN, the stack holds 16 return addresses"},
+    {0x3000, 0xF000, 0, "3XNN", 2, "SE VX, NN", "if vX != NN then", VIP, false, NULL,
+     "Skip the next instruction if VX = NN"},
+    {0x4000, 0xF000, 0, "4XNN", 2, "SNE VX, NN", "if vX == NN then", VIP, false, NULL,
+     "Skip the next instruction if VX != NN"},
+    {0x5000, 0xF00F, 0, "5XY0", 2, "SE VX, VY", "if vX != vY then", VIP, false, NULL,
+     "Skip the next instruction if VX = VY"},
+    {0x5002, 0xF00F, 0, "5XY2", 2, "SAVE VX-VY", "save vX - vY", XOCHIP, false, NULL,
+     "Store VX to VY in memory from I, backwards if Y < X, I is unchanged"},
+    {0x5003, 0xF00F, 0, "5XY3", 2, "LOAD VX-VY", "load vX - vY", XOCHIP, false, NULL,
+     "Load VX to VY from memory at I, backwards if Y < X, I is unchanged"},
+    {0x6000, 0xF000, 0, "6XNN", 2, "LD VX, NN", "vX := NN", VIP, false, NULL,
+     "Set VX to NN"},
+    {0x7000, 0xF000, 0, "7XNN", 2, "ADD VX, NN", "vX += NN", VIP, false, NULL,
+     "Add NN to VX, VF is unchanged"},
+    {0x8000, 0xF00F, 0, "8XY0", 2, "LD VX, VY", "vX := vY", VIP, false, NULL,
+     "Set VX to VY"},
+    {0x8001, 0xF00F, 0, "8XY1", 2, "OR VX, VY", "vX |= vY", VIP, false, "vf_reset",
+     "Set VX to VX OR VY, vf_reset clears VF"},
+    {0x8002, 0xF00F, 0, "8XY2", 2, "AND VX, VY", "vX &= vY", VIP, false, "vf_reset",
+     "Set VX to VX AND VY, vf_reset clears VF"},
+    {0x8003, 0xF00F, 0, "8XY3", 2, "XOR VX, VY", "vX ^= vY", VIP, false, "vf_reset",
+     "Set VX to VX XOR VY, vf_reset clears VF"},
+    {0x8004, 0xF00F, 0, "8XY4", 2, "ADD VX, VY", "vX += vY", VIP, false, NULL,
+     "Add VY to VX, VF is 1 on a carry"},
+    {0x8005, 0xF00F, 0, "8XY5", 2, "SUB VX, VY", "vX -= vY", VIP, false, NULL,
+     "Subtract VY from VX, VF is 0 on a borrow"},
+    {0x8006, 0xF00F, 0, "8XY6", 2, "SHR VX, VY", "vX >>= vY", VIP, false, "shift",
+     "Set VX to VY shifted right by 1 and VF to the bit shifted out, shift shifts VX in place"},
+    {0x8007, 0xF00F, 0, "8XY7", 2, "SUBN VX, VY", "vX =- vY", VIP, false, NULL,
+     "Set VX to VY - VX, VF is 0 on a borrow"},
+    {0x800E, 0xF00F, 0, "8XYE", 2, "SHL VX, VY", "vX <<= vY", VIP, false, "shift",
+     "Set VX to VY shifted left by 1 and VF to the bit shifted out, shift shifts VX in place"},
+    {0x9000, 0xF00F, 0, "9XY0", 2, "SNE VX, VY", "if vX == vY then", VIP, false, NULL,
+     "Skip the next instruction if VX != VY"},
+    {0xA000, 0xF000, 0, "ANNN", 2, "LD I, NNN", "i := NNN", VIP, false, NULL,
+     "Set I to NNN"},
+    {0xB000, 0xF000, 0, "BNNN", 2, "JP V0, NNN", "jump0 NNN", VIP, false, "jump",
+     "Jump to NNN + V0, jump makes it XNN + VX"},
+    {0xC000, 0xF000, 0, "CXNN", 2, "RND VX, NN", "vX := random NN", VIP, false, NULL,
+     "Set VX to a random byte AND NN"},
+    {0xD000, 0xF00F, 0, "DXY0", 2, "DRW VX, VY, 0", "sprite vX vY 0", SCHIP, false, "clipping,display_wait",
+     "Draw the 16x16 sprite at I at VX, VY, the same as DXYN in Mega-Chip mode"},
+    {0xD000, 0xF000, 0, "DXYN", 2, "DRW VX, VY, N", "sprite vX vY N", VIP, false, "clipping,display_wait",
+     "XOR the 8xN sprite at I onto the screen at VX, VY, VF is 1 if a pixel was turned off; "
+     "Mega-Chip mode draws the color sprite of the size set by 03NN and 04NN. "
+     "clipping cuts sprites off at the edges instead of wrapping them, display_wait draws at the next 60Hz frame"},
+    {0xE09E, 0xF0FF, 0, "EX9E", 2, "SKP VX", "if vX -key then", VIP, false, NULL,
+     "Skip the next instruction if key VX is down"},
+    {0xE0A1, 0xF0FF, 0, "EXA1", 2, "SKNP VX", "if vX key then", VIP, false, NULL,
+     "Skip the next instruction if key VX is up"},
+    {0xF000, 0xFFFF, 0, "F000 NNNN", 4, "LD I, LONG NNNN", "i := long NNNN", XOCHIP, false, NULL,
+     "Set I to the 16 bit address in the next word"},
+    {0xF001, 0xF0FF, 0, "FN01", 2, "PLANE N", "plane N", XOCHIP, false, NULL,
+     "Select the drawing planes, bit 0 is plane 1 and bit 1 plane 2"},
+    {0xF002, 0xFFFF, 0, "F002", 2, "AUDIO", "audio", XOCHIP, false, NULL,
+     "Load the 16 byte audio pattern from I"},
+    {0xF007, 0xF0FF, 0, "FX07", 2, "LD VX, DT", "vX := delay", VIP, false, NULL,
+     "Set VX to the delay timer"},
+    {0xF00A, 0xF0FF, 0, "FX0A", 2, "LD VX, K", "vX := key", VIP, false, "key_press",
+     "Wait for a key and put it in VX, the key counts when it's released, key_press takes it when pressed"},
+    {0xF015, 0xF0FF, 0, "FX15", 2, "LD DT, VX", "delay := vX", VIP, false, NULL,
+     "Set the delay timer to VX"},
+    {0xF018, 0xF0FF, 0, "FX18", 2, "LD ST, VX", "buzzer := vX", VIP, false, NULL,
+     "Set the sound timer to VX"},
+    {0xF01E, 0xF0FF, 0, "FX1E", 2, "ADD I, VX", "i += vX", VIP, false, NULL,
+     "Add VX to I"},
+    {0xF029, 0xF0FF, 0, "FX29", 2, "LD F, VX", "i := hex vX", VIP, false, NULL,
+     "Point I at the 4x5 font sprite of digit VX"},
+    {0xF030, 0xF0FF, 0, "FX30", 2, "LD HF, VX", "i := bighex vX", SCHIP, false, NULL,
+     "Point I at the 8x10 font sprite of digit VX"},
+    {0xF033, 0xF0FF, 0, "FX33", 2, "LD B, VX", "bcd vX", VIP, false, NULL,
+     "Store the decimal digits of VX at I, I + 1 and I + 2"},
+    {0xF03A, 0xF0FF, 0, "FX3A", 2, "PITCH VX", "pitch := vX", XOCHIP, false, NULL,
+     "Set the audio pattern's pitch to VX"},
+    {0xF055, 0xF0FF, 0, "FX55", 2, "LD [I], VX", "save vX", VIP, false, "load_store",
+     "Store V0 to VX in memory from I, load_store leaves I past the last byte"},
+    {0xF065, 0xF0FF, 0, "FX65", 2, "LD VX, [I]", "load vX", VIP, false, "load_store",
+     "Load V0 to VX from memory at I, load_store leaves I past the last byte"},
+    {0xF875, 0xF8FF, 0, "FX75", 2, "LD R, VX", "saveflags vX", XOCHIP, false, NULL,
+     "Store V0 to VX in the flags, X above 7 is XO-CHIP, the core keeps the first 8"},
+    {0xF075, 0xF0FF, 0, "FX75", 2, "LD R, VX", "saveflags vX", SCHIP, false, NULL,
+     "Store V0 to VX, X up to 7, in the HP48 flags, they survive a reset"},
+    {0xF885, 0xF8FF, 0, "FX85", 2, "LD VX, R", "loadflags vX", XOCHIP, false, NULL,
+     "Load V0 to VX from the flags, X above 7 is XO-CHIP, the core keeps the first 8"},
+    {0xF085, 0xF0FF, 0, "FX85", 2, "LD VX, R", "loadflags vX", SCHIP, false, NULL,
+     "Load V0 to VX, X up to 7, from the HP48 flags"},
+};
+
+const size_t opcode_count = sizeof opcode_table / sizeof opcode_table[0];
+
+const opcode_info_t *opcode_find(uint16_t opcode, bool megachip) {
+    for(size_t i = 0; i < opcode_count; i++) {
+        const opcode_info_t *info = &opcode_table[i];
+
+        if((opcode & info->mask) != info->pattern || (info->megachip && !megachip)) continue;
+        if(info->limit && (opcode & ~info->mask) > info->limit) continue;
+        return info;
+    }
+
+    return NULL;
+}
+
+const char *opcode_platform_key(const opcode_info_t *info) {
+    if(info->megachip) return "megachip";
+
+    switch(info->platform) {
+        case CHIP8_PLATFORM_VIP:    return "vip";
+        case CHIP8_PLATFORM_CHIP48: return "chip48";
+        case CHIP8_PLATFORM_SCHIP:  return "schip";
+        default:                    return "xochip";
+    }
+}
+
+static bool listed(const opcode_info_t *info, chip8_platform_t platform, bool megachip) {
+    if(platform == CHIP8_PLATFORM_ANY) return true;
+    return info->megachip ? megachip : info->platform <= platform;
+}
+
+static const char *platform_title(const opcode_info_t *info) {
+    return info->megachip ? "Mega-Chip" : chip8_platform_name(info->platform);
+}
+
+// Table cells can't hold a bare |
+static void write_cell(FILE *out, const char *text, bool code) {
+    fputs(code ? " `" : " ", out);
+    for(; *text; text++) {
+        if(*text == '|') fputc('\\', out);
+        fputc(*text, out);
+    }
+    fputs(code ? "` |" : " |", out);
+}
+
+bool opcodes_write_markdown(FILE *out, chip8_platform_t platform, bool megachip) {
+    if(platform == CHIP8_PLATFORM_ANY) fputs("# CHIP8 instructions\n\n", out);
+    else fprintf(out, "# CHIP8 instructions on the %s%s\n\n", chip8_platform_name(platform), megachip ? " with Mega-Chip" : "");
+    fputs("X and Y are registers, N, NN and NNN constants. Every instruction counts as one towards the "
+          "instructions per second of --speed, the 4 byte ones too. Quirks are the names --quirk takes.\n"
+          "0NNN calls machine code on the COSMAC VIP and faults unless a program gives the core a sys hook, "
+          "the Mega-Chip instructions are only decoded with --megachip.\n\n", out);
+    fputs("| Opcode | Raw | Octo | Platform | Quirks | Description |\n", out);
+    fputs("|---|---|---|---|---|---|\n", out);
+
+    for(size_t i = 0; i < opcode_count; i++) {
+        const opcode_info_t *info = &opcode_table[i];
+        if(!listed(info, platform, megachip)) continue;
+
+        fputc('|', out);
+        write_cell(out, info->form, true);
+        write_cell(out, info->raw, true);
+        write_cell(out, info->octo ? info->octo : "", info->octo);
+        write_cell(out, platform_title(info), false);
+        write_cell(out, info->quirks ? info->quirks : "", false);
+        write_cell(out, info->description, false);
+        fputc('\n', out);
+    }
+
+    return !ferror(out);
+}
+
+// None of the table's text needs more than quotes and backslashes escaped
+static void write_string(FILE *out, const char *text) {
+    fputc('"', out);
+    for(; *text; text++) {
+        if(*text == '"' || *text == '\\') fputc('\\', out);
+        fputc(*text, out);
+    }
+    fputc('"', out);
+}
+
+// Comma separated names as an array
+static void write_list(FILE *out, const char *text) {
+    fputc('[', out);
+    while(text && *text) {
+        const char *end = text;
+        while(*end && *end != ',') end++;
+
+        fprintf(out, "\"%.*s\"", (int)(end - text), text);
+        text = *end ? end + 1 : end;
+        if(*text) fputc(',', out);
+    }
+    fputc(']', out);
+}
+
+bool opcodes_write_json(FILE *out, chip8_platform_t platform, bool megachip) {
+    bool first = true;
+
+    fputs("[\n", out);
+    for(size_t i = 0; i < opcode_count; i++) {
+        const opcode_info_t *info = &opcode_table[i];
+        if(!listed(info, platform, megachip)) continue;
+
+        fputs(first ? "  {" : ",\n  {", out);
+        first = false;
+
+        fprintf(out, "\"opcode\":");
+        write_string(out, info->form);
+        fprintf(out, ",\"pattern\":\"%04X\",\"mask\":\"%04X\",\"limit\":%u,\"size\":%u,\"raw\":", info->pattern,
+                info->mask, info->limit, info->size);
+        write_string(out, info->raw);
+        fputs(",\"octo\":", out);
+        if(info->octo) write_string(out, info->octo);
+        else fputs("null", out);
+        fprintf(out, ",\"platform\":\"%s\",\"quirks\":", opcode_platform_key(info));
+        write_list(out, info->quirks);
+        fputs(",\"description\":", out);
+        write_string(out, info->description);
+        fputc('}', out);
+    }
+    fputs("\n]\n", out);
+
+    return !ferror(out);
+}
@@ -0,0 +1,42 @@
+#ifndef OPCODES_H
+#define OPCODES_H
+
+#include <stdio.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Reference of every instruction the core implements, "chip8 opcodes" prints it
+// tests/opcodes.c runs the whole opcode space through chip8_step() to keep it in step with the core
+typedef struct {
+    uint16_t pattern;           // Opcode with the operand bits 0
+    uint16_t mask;              // Bits that pick the instruction, the rest are operands
+    uint16_t limit;             // Largest operand value (opcode & ~mask) it takes, 0 for any
+    const char *form;           // Opcode with operands as letters, like "8XY4"
+    uint8_t size;               // Bytes, 4 for the ones followed by an address word
+    const char *raw;            // Disassembler's raw syntax
+    const char *octo;           // Octo syntax, NULL if Octo has none
+    chip8_platform_t platform;  // First platform with it, see chip8_opcode_platform()
+    bool megachip;              // Needs Mega-Chip, these aren't part of the platforms
+    const char *quirks;         // Quirks that change it, comma separated names for --quirk, NULL if none
+    const char *description;
+} opcode_info_t;
+
+extern const opcode_info_t opcode_table[];
+extern const size_t opcode_count;
+
+// Instruction for an opcode, NULL if the core doesn't have one
+// Mega-Chip ones are only found with megachip, without it their opcodes are 0NNN machine code calls
+const opcode_info_t *opcode_find(uint16_t opcode, bool megachip);
+
+// Name for --platform, "vip" to "xochip", or "megachip"
+const char *opcode_platform_key(const opcode_info_t *info);
+
+// The instructions of a platform profile, everything for CHIP8_PLATFORM_ANY
+// megachip adds the Mega-Chip ones to a platform's list, CHIP8_PLATFORM_ANY has them anyway
+bool opcodes_write_markdown(FILE *out, chip8_platform_t platform, bool megachip);
+bool opcodes_write_json(FILE *out, chip8_platform_t platform, bool megachip);
+
+#endif // OPCODES_H
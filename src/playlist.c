@@ -0,0 +1,132 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <ctype.h>
+#include <sys/stat.h>
+
+#include "playlist.h"
+#include "menu.h"
+
+static bool add_entry(playlist_t *playlist, size_t *capacity, const char *path, uint32_t seconds) {
+    if(playlist->count == *capacity) {
+        const size_t new_capacity = *capacity ? *capacity * 2 : 16;
+        playlist_entry_t *entries = realloc(playlist->entries, new_capacity * sizeof *entries);
+        if(!entries) return false;
+
+        playlist->entries = entries;
+        *capacity = new_capacity;
+    }
+
+    char *copy = malloc(strlen(path) + 1);
+    if(!copy) return false;
+    strcpy(copy, path);
+
+    playlist->entries[playlist->count++] = (playlist_entry_t) {.path = copy, .seconds = seconds};
+    return true;
+}
+
+static bool load_dir(playlist_t *playlist, const char *dir) {
+    menu_t menu = {0};
+    if(!menu_scan(&menu, dir)) return false;
+
+    size_t capacity = 0;
+    bool ok = true;
+    for(size_t i = 0; ok && i < menu.count; i++) ok = add_entry(playlist, &capacity, menu.paths[i], 0);
+
+    menu_free(&menu);
+    if(!ok) fprintf(stderr, "Out of memory listing %s\n", dir);
+    return ok;
+}
+
+// Seconds at the end of a line, which is cut off before them. ROM names often have spaces and
+// numbers in them, only a last word made of nothing but digits counts
+static bool split_seconds(char *line, uint32_t *seconds, bool *valid) {
+    *valid = true;
+
+    char *space = strrchr(line, ' ');
+    char *tab = strrchr(line, '\t');
+    if(!space || (tab && tab > space)) space = tab;
+    if(!space || !space[1]) return false;
+
+    for(const char *c = space + 1; *c; c++)
+        if(!isdigit((unsigned char)*c)) return false;
+
+    const unsigned long value = strtoul(space + 1, NULL, 10);
+    *valid = value > 0 && value <= PLAYLIST_MAX_SECONDS;
+    *seconds = (uint32_t)value;
+
+    while(space > line && isspace((unsigned char)space[-1])) space--;
+    *space = '\0';
+    return true;
+}
+
+static bool load_file(playlist_t *playlist, const char *path) {
+    FILE *file = fopen(path, "r");
+    if(!file) {
+        fprintf(stderr, "Could not open playlist %s\n", path);
+        return false;
+    }
+
+    const char *sep = strrchr(path, '/');
+    const int dir_len = sep ? (int)(sep - path + 1) : 0;
+    char line[FILENAME_MAX];
+    uint32_t line_num = 0;
+    size_t capacity = 0;
+    bool ok = true;
+
+    while(ok && fgets(line, sizeof line, file)) {
+        line_num++;
+        line[strcspn(line, "\r\n")] = '\0';
+
+        char *start = line;
+        while(isspace((unsigned char)*start)) start++;
+        if(*start == '\0' || *start == '#') continue;
+
+        size_t len = strlen(start);
+        while(len > 0 && isspace((unsigned char)start[len - 1])) start[--len] = '\0';
+
+        uint32_t seconds = 0;
+        bool valid;
+        if(split_seconds(start, &seconds, &valid) && !valid) {
+            fprintf(stderr, "%s:%u: seconds have to be from 1 to %d\n", path, line_num, PLAYLIST_MAX_SECONDS);
+            ok = false;
+            break;
+        }
+
+        char rom[FILENAME_MAX];
+        if((size_t)snprintf(rom, sizeof rom, "%.*s%s", start[0] == '/' ? 0 : dir_len, path, start) >= sizeof rom) {
+            fprintf(stderr, "%s:%u: path too long\n", path, line_num);
+            ok = false;
+        } else if(!add_entry(playlist, &capacity, rom, seconds)) {
+            fprintf(stderr, "Out of memory reading %s\n", path);
+            ok = false;
+        }
+    }
+
+    fclose(file);
+    return ok;
+}
+
+bool playlist_load(playlist_t *playlist, const char *path) {
+    *playlist = (playlist_t) {0};
+
+    struct stat info;
+    const bool ok = stat(path, &info) == 0 && S_ISDIR(info.st_mode) ? load_dir(playlist, path) : load_file(playlist, path);
+
+    if(ok && playlist->count == 0) fprintf(stderr, "No ROMs in %s\n", path);
+    if(!ok || playlist->count == 0) {
+        playlist_free(playlist);
+        return false;
+    }
+
+    return true;
+}
+
+void playlist_free(playlist_t *playlist) {
+    for(size_t i = 0; i < playlist->count; i++) free(playlist->entries[i].path);
+
+    free(playlist->entries);
+    *playlist = (playlist_t) {0};
+}
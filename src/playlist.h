@@ -0,0 +1,29 @@
+#ifndef PLAYLIST_H
+#define PLAYLIST_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+// Longest time a playlist line can give a ROM, a day
+#define PLAYLIST_MAX_SECONDS 86400
+
+typedef struct {
+    char *path;             // ROM file
+    uint32_t seconds;       // How long it runs, 0 for the default
+} playlist_entry_t;
+
+// ROMs for chip8 attract, in the order they're shown
+typedef struct {
+    playlist_entry_t *entries;
+    size_t count;
+} playlist_t;
+
+// A directory gives its ROM files in the order of the menu, anything else is read as a playlist file,
+// one ROM per line with an optional number of seconds at the end:
+//   <rom_path> [seconds]
+// Relative paths are from the playlist's directory, # starts a comment line
+bool playlist_load(playlist_t *playlist, const char *path);
+void playlist_free(playlist_t *playlist);
+
+#endif // PLAYLIST_H
@@ -0,0 +1,184 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <ctype.h>
+#include <errno.h>
+#include <time.h>
+#include <sys/stat.h>
+
+#include "postmortem.h"
+#include "datadir.h"
+#include "image.h"
+#include "romdb.h"
+#include "log.h"
+
+bool postmortem_default_dir(char *path, size_t size) {
+    return datadir_path("crashes", path, size);
+}
+
+// ROM file name without its directory or archive, with anything unusual for a file name replaced
+static void rom_label(const chip8_t *chip8, char *label, size_t size) {
+    const char *name = chip8->rom_name ? chip8->rom_name : "rom";
+    const char *sep = strrchr(name, '/');
+    if(sep) name = sep + 1;
+    sep = strrchr(name, ':');
+    if(sep) name = sep + 1;
+
+    size_t len = 0;
+    for(; name[len] && len + 1 < size; len++) {
+        const unsigned char c = name[len];
+        label[len] = isalnum(c) || c == '-' || c == '_' || c == '.' ? (char)c : '_';
+    }
+    label[len] = '\0';
+    if(len == 0) snprintf(label, size, "rom");
+}
+
+// New directory under dir, numbered if another fault in the same second took the name
+static bool make_bundle_dir(const char *dir, const chip8_t *chip8, char *path, size_t size) {
+    char label[64];
+    char stamp[32];
+    const time_t now = time(NULL);
+    struct tm tm;
+
+    rom_label(chip8, label, sizeof label);
+    localtime_r(&now, &tm);
+    strftime(stamp, sizeof stamp, "%Y%m%d-%H%M%S", &tm);
+
+    int len = snprintf(path, size, "%s/", dir);
+    if(len < 0 || (size_t)len >= size || !datadir_make_parents(path)) return false;
+
+    for(uint32_t i = 1; i < 100; i++) {
+        len = i == 1 ? snprintf(path, size, "%s/%s-%s", dir, label, stamp)
+                     : snprintf(path, size, "%s/%s-%s-%u", dir, label, stamp, i);
+        if(len < 0 || (size_t)len >= size) return false;
+
+        if(mkdir(path, 0755) == 0) return true;
+        if(errno != EEXIST) return false;
+    }
+
+    return false;
+}
+
+static FILE *open_file(const char *dir, const char *name, const char *mode) {
+    char path[FILENAME_MAX];
+    if((size_t)snprintf(path, sizeof path, "%s/%s", dir, name) >= sizeof path) return NULL;
+
+    FILE *file = fopen(path, mode);
+    if(!file) log_write(CHIP8_LOG_ERROR, "crash", "Could not open %s for writing", path);
+    return file;
+}
+
+static bool write_report(const char *dir, const chip8_t *chip8, const postmortem_t *postmortem) {
+    FILE *out = open_file(dir, "report.txt", "w");
+    if(!out) return false;
+
+    char sha1[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(chip8->rom, chip8->rom_size, sha1);
+
+    chip8_print_fault(chip8, out);
+    fprintf(out, "\nROM: %s\n", chip8->rom_name ? chip8->rom_name : "(none)");
+    fprintf(out, "Size: %zu bytes\n", chip8->rom_size);
+    fprintf(out, "SHA-1: %s\n", sha1);
+
+    fprintf(out, "\nPlatform: %s\n", chip8_platform_name(chip8->platform));
+    fprintf(out, "XO-CHIP: %s\n", chip8->xochip ? "on" : "off");
+    fprintf(out, "Mega-Chip: %s%s\n", chip8->megachip ? "on" : "off", chip8->mega ? ", in the 256x192 mode" : "");
+    if(chip8->timing == CHIP8_TIMING_VIP) fprintf(out, "Speed: COSMAC VIP timing\n");
+    else fprintf(out, "Speed: %u instructions per second\n", chip8->insts_per_second);
+    fprintf(out, "Quirks:");
+    bool any = false;
+    for(size_t i = 0; i < CHIP8_QUIRK_COUNT; i++) {
+        if(!chip8_quirk_enabled(&chip8->quirks, i)) continue;
+
+        fprintf(out, "%s%s", any ? "," : " ", chip8_quirk_name(i));
+        any = true;
+    }
+    fprintf(out, "%s\n", any ? "" : " none");
+    fprintf(out, "Strict memory: %s\n", chip8->strict_memory ? "on" : "off");
+    fprintf(out, "Power on memory: %s, strict init %s\n", chip8_ram_fill_name(chip8->ram_fill),
+            chip8->strict_init ? "on" : "off");
+    fprintf(out, "Seed: %u\n", postmortem->seed);
+    if(postmortem->trace)
+        fprintf(out, "Instructions run: %llu\n", (unsigned long long)postmortem->trace->count);
+    if(postmortem->movie) fprintf(out, "Frames in input.movie: %u\n", postmortem->movie->frames);
+
+    // Quoted so it can be pasted back into a shell
+    fprintf(out, "\nCommand line:");
+    for(int i = 0; i < postmortem->argc; i++) {
+        const char *arg = postmortem->argv[i];
+        if(*arg && strcspn(arg, " \t\n'\"\\$`*?&;|<>()[]{}#~!") == strlen(arg)) {
+            fprintf(out, " %s", arg);
+            continue;
+        }
+
+        fputs(" '", out);
+        for(; *arg; arg++) {
+            if(*arg == '\'') fputs("'\\''", out);
+            else fputc(*arg, out);
+        }
+        fputc('\'', out);
+    }
+    fputc('\n', out);
+
+    return fclose(out) == 0;
+}
+
+static bool write_state(const char *dir, const chip8_t *chip8) {
+    const size_t size = chip8_state_size(chip8);
+    uint8_t *data = malloc(size);
+    if(!data) {
+        log_write(CHIP8_LOG_ERROR, "crash", "Out of memory for the save state");
+        return false;
+    }
+
+    FILE *out = open_file(dir, "machine.state", "wb");
+    const bool ok = out && chip8_serialize(chip8, data, size) == size && fwrite(data, 1, size, out) == size;
+
+    free(data);
+    return out ? fclose(out) == 0 && ok : false;
+}
+
+static bool write_trace(const char *dir, const trace_t *trace) {
+    FILE *out = open_file(dir, "trace.txt", "w");
+    if(!out) return false;
+
+    fprintf(out, "Last %zu of %llu instructions before the fault:\n", trace->ring_count, (unsigned long long)trace->count);
+    trace_dump(trace, out);
+    return fclose(out) == 0;
+}
+
+static bool write_screen(const char *dir, const chip8_t *chip8, const postmortem_t *postmortem) {
+    char path[FILENAME_MAX];
+    if((size_t)snprintf(path, sizeof path, "%s/screen.png", dir) >= sizeof path) return false;
+
+    uint32_t width, height;
+    uint8_t *rgb = image_from_display(chip8, postmortem->palette, postmortem->scale, &width, &height);
+    const bool ok = rgb && image_write_png(path, rgb, width, height);
+
+    free(rgb);
+    return ok;
+}
+
+bool postmortem_write(const char *dir, const chip8_t *chip8, const postmortem_t *postmortem, char *path, size_t size) {
+    if(!make_bundle_dir(dir, chip8, path, size)) {
+        log_write(CHIP8_LOG_ERROR, "crash", "Could not make a crash report directory in %s", dir);
+        return false;
+    }
+
+    bool ok = write_report(path, chip8, postmortem);
+    ok = write_state(path, chip8) && ok;
+    ok = write_screen(path, chip8, postmortem) && ok;
+    if(postmortem->trace) ok = write_trace(path, postmortem->trace) && ok;
+
+    if(postmortem->movie) {
+        char movie_path[FILENAME_MAX], error[FILENAME_MAX + 64] = "The crash report path is too long for the movie";
+        const bool saved = (size_t)snprintf(movie_path, sizeof movie_path, "%s/input.movie", path) < sizeof movie_path &&
+                           movie_save_file(postmortem->movie, movie_path, error, sizeof error);
+        if(!saved) log_write(CHIP8_LOG_ERROR, "crash", "%s", error);
+        ok = saved && ok;
+    }
+
+    return ok;
+}
@@ -0,0 +1,35 @@
+#ifndef POSTMORTEM_H
+#define POSTMORTEM_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "trace.h"
+#include "movie.h"
+
+// Everything about a faulted run for a bug report, in a new <rom>-<date>-<time> directory:
+//   report.txt     the fault, the ROM's name, size and SHA-1, the machine settings and the command line
+//   machine.state  save state at the fault, F9 loads it with --state pointing at it
+//   trace.txt      the instructions before the fault
+//   screen.png     the display
+//   input.movie    the keypad input up to the fault, for --play, only if a movie was recording or playing
+// Default location is $XDG_DATA_HOME/chip8/crashes or ~/.local/share/chip8/crashes
+bool postmortem_default_dir(char *path, size_t size);
+
+typedef struct {
+    const trace_t *trace;   // Last instructions, NULL leaves trace.txt out
+    const movie_t *movie;   // NULL leaves input.movie out
+    uint32_t palette[4];    // Display colors for the screenshot
+    uint32_t scale;         // Image pixels per CHIP8 pixel
+    uint32_t seed;          // CXNN random numbers the run started from
+    int argc;               // Command line the emulator was started with
+    char **argv;
+} postmortem_t;
+
+// Missing directories on the way to dir are created, path gets the new directory
+// Returns false if any of the files couldn't be written, the others are still there
+bool postmortem_write(const char *dir, const chip8_t *chip8, const postmortem_t *postmortem, char *path, size_t size);
+
+#endif // POSTMORTEM_H
@@ -0,0 +1,350 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <time.h>
+
+#include "profile.h"
+#include "disasm.h"
+
+// Instruction forms, the first one matching opcode & mask == value wins
+static const struct {
+    uint16_t mask;
+    uint16_t value;
+    const char *name;
+} forms[] = {
+    {0xFFFF, 0x00E0, "00E0"}, {0xFFFF, 0x00EE, "00EE"}, {0xFFF0, 0x00C0, "00CN"}, {0xFFF0, 0x00D0, "00DN"},
+    {0xFFFF, 0x00FB, "00FB"}, {0xFFFF, 0x00FC, "00FC"}, {0xFFFF, 0x00FD, "00FD"}, {0xFFFF, 0x00FE, "00FE"},
+    {0xFFFF, 0x00FF, "00FF"}, {0xF000, 0x0000, "0NNN"}, {0xF000, 0x1000, "1NNN"}, {0xF000, 0x2000, "2NNN"},
+    {0xF000, 0x3000, "3XNN"}, {0xF000, 0x4000, "4XNN"}, {0xF00F, 0x5000, "5XY0"}, {0xF00F, 0x5002, "5XY2"},
+    {0xF00F, 0x5003, "5XY3"}, {0xF000, 0x6000, "6XNN"}, {0xF000, 0x7000, "7XNN"}, {0xF00F, 0x8000, "8XY0"},
+    {0xF00F, 0x8001, "8XY1"}, {0xF00F, 0x8002, "8XY2"}, {0xF00F, 0x8003, "8XY3"}, {0xF00F, 0x8004, "8XY4"},
+    {0xF00F, 0x8005, "8XY5"}, {0xF00F, 0x8006, "8XY6"}, {0xF00F, 0x8007, "8XY7"}, {0xF00F, 0x800E, "8XYE"},
+    {0xF00F, 0x9000, "9XY0"}, {0xF000, 0xA000, "ANNN"}, {0xF000, 0xB000, "BNNN"}, {0xF000, 0xC000, "CXNN"},
+    {0xF000, 0xD000, "DXYN"}, {0xF0FF, 0xE09E, "EX9E"}, {0xF0FF, 0xE0A1, "EXA1"}, {0xFFFF, 0xF000, "F000"},
+    {0xFFFF, 0xF002, "F002"}, {0xF0FF, 0xF001, "FN01"}, {0xF0FF, 0xF007, "FX07"}, {0xF0FF, 0xF00A, "FX0A"},
+    {0xF0FF, 0xF015, "FX15"}, {0xF0FF, 0xF018, "FX18"}, {0xF0FF, 0xF01E, "FX1E"}, {0xF0FF, 0xF029, "FX29"},
+    {0xF0FF, 0xF030, "FX30"}, {0xF0FF, 0xF033, "FX33"}, {0xF0FF, 0xF03A, "FX3A"}, {0xF0FF, 0xF055, "FX55"},
+    {0xF0FF, 0xF065, "FX65"}, {0xF0FF, 0xF075, "FX75"}, {0xF0FF, 0xF085, "FX85"},
+};
+
+#define FORM_COUNT (sizeof forms / sizeof forms[0])
+#define FORM_UNKNOWN FORM_COUNT
+
+static size_t form_of(uint16_t opcode) {
+    for(size_t i = 0; i < FORM_COUNT; i++)
+        if((opcode & forms[i].mask) == forms[i].value) return i;
+
+    return FORM_UNKNOWN;
+}
+
+static const char *form_name(size_t form) {
+    return form == FORM_UNKNOWN ? "????" : forms[form].name;
+}
+
+static uint64_t now_ns(void) {
+    struct timespec ts;
+    timespec_get(&ts, TIME_UTC);
+    return (uint64_t)ts.tv_sec * 1000000000 + ts.tv_nsec;
+}
+
+static uint16_t read_word(const chip8_t *chip8, uint32_t addr) {
+    return (chip8->ram[addr % chip8->ram_size] << 8) | chip8->ram[(addr + 1) % chip8->ram_size];
+}
+
+void profile_init(profile_t *profile) {
+    _Static_assert(FORM_COUNT < PROFILE_FORMS, "PROFILE_FORMS too small for the instruction forms");
+    memset(profile, 0, sizeof *profile);
+}
+
+void profile_start(profile_t *profile, const chip8_t *chip8) {
+    profile->pc = chip8->PC;
+    profile->opcode = read_word(chip8, chip8->PC);
+    profile->started = now_ns();
+}
+
+// Faulting instructions didn't run and aren't counted
+void profile_stop(profile_t *profile, const chip8_t *chip8) {
+    const uint64_t time = now_ns() - profile->started;
+    if(chip8->fault != CHIP8_FAULT_NONE) return;
+
+    const uint32_t cycles = chip8_vip_cycles(chip8, profile->pc);
+    profile_counter_t *addr = &profile->addrs[profile->pc];
+    profile_counter_t *form = &profile->forms[form_of(profile->opcode)];
+    addr->count++;
+    addr->time += time;
+    addr->cycles += cycles;
+    form->count++;
+    form->time += time;
+    form->cycles += cycles;
+    profile->count++;
+    profile->time += time;
+    profile->cycles += cycles;
+}
+
+// Counter with the address or form it belongs to, for sorting
+typedef struct {
+    uint32_t key;
+    profile_counter_t counter;
+} hotspot_t;
+
+static int by_count(const void *a, const void *b) {
+    const hotspot_t *x = a;
+    const hotspot_t *y = b;
+    if(x->counter.count != y->counter.count) return x->counter.count < y->counter.count ? 1 : -1;
+    return x->key < y->key ? -1 : x->key > y->key;
+}
+
+// Non-zero counters sorted by executions, most first, NULL if there are none or on allocation failure
+static hotspot_t *sorted_hotspots(const profile_counter_t *counters, size_t count, size_t *used) {
+    hotspot_t *hotspots = malloc(count * sizeof *hotspots);
+    *used = 0;
+    if(!hotspots) return NULL;
+
+    for(size_t i = 0; i < count; i++)
+        if(counters[i].count > 0) hotspots[(*used)++] = (hotspot_t) {.key = i, .counter = counters[i]};
+
+    qsort(hotspots, *used, sizeof *hotspots, by_count);
+    return hotspots;
+}
+
+static double percent(uint64_t part, uint64_t total) {
+    return total ? 100.0 * part / total : 0;
+}
+
+void profile_report(const profile_t *profile, const chip8_t *chip8, size_t top, FILE *out) {
+    fprintf(out, "Profile of %s: %llu instructions in %.3f ms, %.1f ns per instruction\n",
+            chip8->rom_name ? chip8->rom_name : "ROM", (unsigned long long)profile->count, profile->time / 1e6,
+            profile->count ? (double)profile->time / profile->count : 0);
+    if(profile->count == 0) return;
+    fprintf(out, "On a COSMAC VIP: %llu machine cycles, the interpreter gets %d a frame\n",
+            (unsigned long long)profile->cycles, CHIP8_VIP_FRAME_CYCLES);
+
+    size_t used;
+    hotspot_t *hotspots = sorted_hotspots(profile->addrs, chip8->ram_size, &used);
+    if(!hotspots) return;
+
+    fprintf(out, "\nHottest addresses:\n  Address        Count       %%     Time ms  VIP cycles %%  Instruction\n");
+    for(size_t i = 0; i < used && i < top; i++) {
+        const hotspot_t *spot = &hotspots[i];
+        char mnemonic[64];
+        disasm_instruction(read_word(chip8, spot->key), read_word(chip8, spot->key + 2), DISASM_RAW, NULL,
+                           mnemonic, sizeof mnemonic);
+
+        fprintf(out, "  0x%04X  %12llu  %5.1f%%  %10.3f        %5.1f%%  %s\n", spot->key,
+                (unsigned long long)spot->counter.count, percent(spot->counter.count, profile->count),
+                spot->counter.time / 1e6, percent(spot->counter.cycles, profile->cycles), mnemonic);
+    }
+    if(used > top) fprintf(out, "  ... %zu more addresses\n", used - top);
+    free(hotspots);
+
+    hotspots = sorted_hotspots(profile->forms, PROFILE_FORMS, &used);
+    if(!hotspots) return;
+
+    fprintf(out, "\nInstruction forms:\n  Form          Count       %%     Time ms   ns each  VIP cycles each\n");
+    for(size_t i = 0; i < used; i++) {
+        const hotspot_t *spot = &hotspots[i];
+        fprintf(out, "  %-4s    %12llu  %5.1f%%  %10.3f  %8.1f  %15.1f\n", form_name(spot->key),
+                (unsigned long long)spot->counter.count, percent(spot->counter.count, profile->count),
+                spot->counter.time / 1e6, (double)spot->counter.time / spot->counter.count,
+                (double)spot->counter.cycles / spot->counter.count);
+    }
+    free(hotspots);
+}
+
+uint64_t profile_clock_overhead(void) {
+    const uint32_t samples = 100000;
+    uint64_t spent = 0;
+
+    for(uint32_t i = 0; i < samples; i++) {
+        const uint64_t started = now_ns();
+        spent += now_ns() - started;
+    }
+
+    return spent / samples;
+}
+
+void profile_report_classes(const profile_t *profile, uint64_t overhead, FILE *out) {
+    profile_counter_t classes[17] = {0};     // 0-F, then unknown opcodes
+
+    for(size_t i = 0; i <= FORM_COUNT; i++) {
+        if(profile->forms[i].count == 0) continue;
+
+        const char digit = i == FORM_UNKNOWN ? '?' : forms[i].name[0];
+        const size_t class = digit >= '0' && digit <= '9' ? (size_t)(digit - '0') :
+                             digit >= 'A' && digit <= 'F' ? (size_t)(digit - 'A' + 10) : 16;
+        classes[class].count += profile->forms[i].count;
+        classes[class].time += profile->forms[i].time;
+    }
+
+    fprintf(out, "  Class         Count       %%   ns each\n");
+    for(size_t i = 0; i < 17; i++) {
+        if(classes[i].count == 0) continue;
+
+        const double each = (double)classes[i].time / classes[i].count - overhead;
+        fprintf(out, "  %cXXX    %12llu  %5.1f%%  %8.1f\n", i < 16 ? "0123456789ABCDEF"[i] : '?',
+                (unsigned long long)classes[i].count, percent(classes[i].count, profile->count), each > 0 ? each : 0);
+    }
+}
+
+// Just enough of the protobuf wire format for profile.proto
+typedef struct {
+    uint8_t *data;
+    size_t len;
+    size_t capacity;
+    bool failed;            // Out of memory, the buffer is incomplete
+} pb_t;
+
+static void pb_raw(pb_t *pb, const void *data, size_t size) {
+    if(pb->failed || size == 0) return;
+
+    if(pb->len + size > pb->capacity) {
+        size_t capacity = pb->capacity ? pb->capacity : 4096;
+        while(capacity < pb->len + size) capacity *= 2;
+
+        uint8_t *grown = realloc(pb->data, capacity);
+        if(!grown) {
+            pb->failed = true;
+            return;
+        }
+        pb->data = grown;
+        pb->capacity = capacity;
+    }
+
+    memcpy(&pb->data[pb->len], data, size);
+    pb->len += size;
+}
+
+static void pb_varint(pb_t *pb, uint64_t value) {
+    uint8_t bytes[10];
+    size_t len = 0;
+
+    do {
+        bytes[len] = value & 0x7F;
+        value >>= 7;
+        if(value) bytes[len] |= 0x80;
+        len++;
+    } while(value);
+
+    pb_raw(pb, bytes, len);
+}
+
+static void pb_uint(pb_t *pb, uint32_t field, uint64_t value) {
+    pb_varint(pb, field << 3);
+    pb_varint(pb, value);
+}
+
+// Length delimited field, strings and nested messages
+static void pb_bytes(pb_t *pb, uint32_t field, const void *data, size_t size) {
+    pb_varint(pb, field << 3 | 2);
+    pb_varint(pb, size);
+    pb_raw(pb, data, size);
+}
+
+// Nested message, built in msg which is emptied for the next one
+static void pb_message(pb_t *pb, uint32_t field, pb_t *msg) {
+    if(msg->failed) pb->failed = true;
+    pb_bytes(pb, field, msg->data, msg->len);
+    msg->len = 0;
+}
+
+// Profile.string_table entries, referenced by index
+typedef struct {
+    pb_t table;
+    uint64_t count;
+} pb_strings_t;
+
+static uint64_t pb_string(pb_strings_t *strings, const char *str) {
+    pb_bytes(&strings->table, 6, str, strlen(str));
+    return strings->count++;
+}
+
+// One sample per address with the execution count, time and VIP cycles, each address gets its own function
+// named after the instruction there so the hotspots read like a listing
+bool profile_write_pprof(const profile_t *profile, const chip8_t *chip8, const char *path) {
+    pb_t out = {0};
+    pb_t msg = {0};
+    pb_t line = {0};
+    pb_strings_t strings = {0};
+
+    pb_string(&strings, "");
+    const uint64_t file_name = pb_string(&strings, chip8->rom_name ? chip8->rom_name : "rom");
+    const uint64_t instructions = pb_string(&strings, "instructions");
+    const uint64_t count = pb_string(&strings, "count");
+
+    // Profile.sample_type
+    pb_uint(&msg, 1, instructions);
+    pb_uint(&msg, 2, count);
+    pb_message(&out, 1, &msg);
+    pb_uint(&msg, 1, pb_string(&strings, "cpu"));
+    pb_uint(&msg, 2, pb_string(&strings, "nanoseconds"));
+    pb_message(&out, 1, &msg);
+    pb_uint(&msg, 1, pb_string(&strings, "vip_cycles"));
+    pb_uint(&msg, 2, pb_string(&strings, "cycles"));
+    pb_message(&out, 1, &msg);
+
+    for(uint32_t addr = 0; addr < chip8->ram_size; addr++) {
+        const profile_counter_t *counter = &profile->addrs[addr];
+        if(counter->count == 0) continue;
+
+        char name[80];
+        char mnemonic[64];
+        disasm_instruction(read_word(chip8, addr), read_word(chip8, addr + 2), DISASM_RAW, NULL,
+                           mnemonic, sizeof mnemonic);
+        snprintf(name, sizeof name, "0x%04X %s", addr, mnemonic);
+        const uint64_t id = addr + 1;
+
+        // Profile.sample: location_id, value
+        pb_uint(&msg, 1, id);
+        pb_uint(&msg, 2, counter->count);
+        pb_uint(&msg, 2, counter->time);
+        pb_uint(&msg, 2, counter->cycles);
+        pb_message(&out, 2, &msg);
+
+        // Profile.location: id, address, line (function_id, line)
+        pb_uint(&line, 1, id);
+        pb_uint(&line, 2, addr);
+        pb_uint(&msg, 1, id);
+        pb_uint(&msg, 3, addr);
+        pb_message(&msg, 4, &line);
+        pb_message(&out, 4, &msg);
+
+        // Profile.function: id, name, system_name, filename
+        const uint64_t function_name = pb_string(&strings, name);
+        pb_uint(&msg, 1, id);
+        pb_uint(&msg, 2, function_name);
+        pb_uint(&msg, 3, function_name);
+        pb_uint(&msg, 4, file_name);
+        pb_message(&out, 5, &msg);
+    }
+
+    // Profile.duration_nanos, period_type and period
+    pb_uint(&out, 10, profile->time);
+    pb_uint(&msg, 1, instructions);
+    pb_uint(&msg, 2, count);
+    pb_message(&out, 11, &msg);
+    pb_uint(&out, 12, 1);
+
+    if(strings.table.failed) out.failed = true;
+    pb_raw(&out, strings.table.data, strings.table.len);
+
+    bool ok = !out.failed;
+    if(!ok) fprintf(stderr, "Out of memory writing profile %s\n", path);
+
+    FILE *file = ok ? fopen(path, "wb") : NULL;
+    if(ok && !file) {
+        fprintf(stderr, "Could not open %s for writing\n", path);
+        ok = false;
+    }
+
+    if(file) {
+        ok = fwrite(out.data, 1, out.len, file) == out.len;
+        ok = fclose(file) == 0 && ok;
+        if(!ok) fprintf(stderr, "Could not write profile %s\n", path);
+    }
+
+    free(out.data);
+    free(msg.data);
+    free(line.data);
+    free(strings.table.data);
+    return ok;
+}
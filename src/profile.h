@@ -0,0 +1,52 @@
+#ifndef PROFILE_H
+#define PROFILE_H
+
+#include <stdio.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Instruction forms like "8XY4" the opcode counts are grouped by, plus one for unknown opcodes
+#define PROFILE_FORMS 64
+
+// Executions, interpreter time in nanoseconds and what they would have taken on a COSMAC VIP,
+// per address and per instruction form
+typedef struct {
+    uint64_t count;
+    uint64_t time;
+    uint64_t cycles;        // VIP machine cycles, see chip8_vip_cycles()
+} profile_counter_t;
+
+// Instruction profile, profile_start() and profile_stop() go around every chip8_step()
+typedef struct {
+    profile_counter_t addrs[CHIP8_XO_RAM_SIZE];
+    profile_counter_t forms[PROFILE_FORMS];
+    uint64_t count;         // Instructions executed
+    uint64_t time;          // Nanoseconds spent executing them
+    uint64_t cycles;        // VIP machine cycles they add up to
+    uint16_t pc;            // Instruction being timed
+    uint16_t opcode;
+    uint64_t started;
+} profile_t;
+
+void profile_init(profile_t *profile);
+void profile_start(profile_t *profile, const chip8_t *chip8);
+void profile_stop(profile_t *profile, const chip8_t *chip8);
+
+// Hotspot report, the top addresses by executions with their disassembly, then every instruction form seen
+// The VIP cycle columns show where a ROM spends its time on the real machine, with --timing vip too
+void profile_report(const profile_t *profile, const chip8_t *chip8, size_t top, FILE *out);
+
+// Cost of reading the clock twice in nanoseconds, which every timed instruction pays
+uint64_t profile_clock_overhead(void);
+
+// Executions and time per opcode class (the first hex digit), with overhead taken off each instruction's time
+void profile_report_classes(const profile_t *profile, uint64_t overhead, FILE *out);
+
+// Write the address counts as an uncompressed pprof protobuf, "go tool pprof -top <file>" reads it
+// The VIP cycles are a third sample type, -sample_index=vip_cycles ranks by them
+bool profile_write_pprof(const profile_t *profile, const chip8_t *chip8, const char *path);
+
+#endif // PROFILE_H
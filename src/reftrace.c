@@ -0,0 +1,307 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <strings.h>
+#include <ctype.h>
+
+#include "reftrace.h"
+
+#define LINE_SIZE 1024
+
+// CSV:  pc,opcode,i,v0,v1,v2,v3,v4,v5,v6,v7,v8,v9,va,vb,vc,vd,ve,vf,dt,st,sp
+//       0200,00E0,0000,00,00,00,00,00,00,00,00,00,00,00,00,00,00,00,00,00,00,0
+// JSON: {"pc": 512, "opcode": "00E0", "i": 0, "v": [0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0], "dt": 0}
+// A JSON array around the objects is fine as long as the objects are one per line
+
+// Field bit for a column or key name, 0 for ones that aren't compared
+static uint32_t field_bit(const char *name, size_t len) {
+    static const struct {
+        const char *name;
+        uint32_t bit;
+    } names[] = {
+        {"pc", REFTRACE_PC}, {"opcode", REFTRACE_OPCODE}, {"op", REFTRACE_OPCODE}, {"i", REFTRACE_I},
+        {"dt", REFTRACE_DT}, {"delay", REFTRACE_DT}, {"st", REFTRACE_ST}, {"sound", REFTRACE_ST},
+        {"sp", REFTRACE_SP},
+    };
+
+    for(size_t i = 0; i < sizeof names / sizeof names[0]; i++)
+        if(strlen(names[i].name) == len && strncasecmp(names[i].name, name, len) == 0) return names[i].bit;
+
+    // v0 - vf
+    if(len == 2 && tolower((unsigned char)name[0]) == 'v' && isxdigit((unsigned char)name[1])) {
+        const int reg = isdigit((unsigned char)name[1]) ? name[1] - '0' : tolower((unsigned char)name[1]) - 'a' + 10;
+        return REFTRACE_V0 << reg;
+    }
+
+    return 0;
+}
+
+// Most a field can hold
+static uint32_t field_max(uint32_t bit) {
+    return bit == REFTRACE_PC || bit == REFTRACE_OPCODE || bit == REFTRACE_I ? 0xFFFF : 0xFF;
+}
+
+static void set_field(reftrace_state_t *state, uint32_t bit, uint32_t value) {
+    state->fields |= bit;
+
+    if(bit == REFTRACE_PC) state->pc = value;
+    else if(bit == REFTRACE_OPCODE) state->opcode = value;
+    else if(bit == REFTRACE_I) state->I = value;
+    else if(bit == REFTRACE_DT) state->delay_timer = value;
+    else if(bit == REFTRACE_ST) state->sound_timer = value;
+    else if(bit == REFTRACE_SP) state->sp = value;
+    else for(int reg = 0; reg < 16; reg++) if(bit == REFTRACE_V0 << reg) state->V[reg] = value;
+}
+
+static bool parse_value(const char *text, size_t len, int base, uint32_t max, uint32_t *value) {
+    char digits[16];
+    if(len >= 2 && text[0] == '0' && (text[1] == 'x' || text[1] == 'X')) {
+        text += 2;
+        len -= 2;
+        base = 16;
+    }
+    if(len == 0 || len >= sizeof digits) return false;
+
+    memcpy(digits, text, len);
+    digits[len] = '\0';
+
+    char *end;
+    const unsigned long num = strtoul(digits, &end, base);
+    if(*end != '\0' || digits[0] == '-' || num > max) return false;
+
+    *value = (uint32_t)num;
+    return true;
+}
+
+static char *trim(char *str) {
+    while(isspace((unsigned char)*str)) str++;
+
+    char *end = str + strlen(str);
+    while(end > str && isspace((unsigned char)end[-1])) *--end = '\0';
+
+    return str;
+}
+
+static bool parse_columns(reftrace_t *trace, char *header) {
+    trace->column_count = 0;
+
+    for(char *column = header; column; ) {
+        if(trace->column_count == REFTRACE_COLUMNS_MAX) {
+            fprintf(stderr, "More than %d columns in the reference trace\n", REFTRACE_COLUMNS_MAX);
+            return false;
+        }
+
+        char *comma = strchr(column, ',');
+        if(comma) *comma = '\0';
+        char *next = comma ? comma + 1 : NULL;
+
+        column = trim(column);
+        const size_t len = strlen(column);
+        const bool quoted = len >= 2 && column[0] == '"' && column[len - 1] == '"';
+        trace->columns[trace->column_count++] = quoted ? field_bit(column + 1, len - 2) : field_bit(column, len);
+        column = next;
+    }
+
+    trace->have_columns = true;
+    return true;
+}
+
+bool reftrace_open(reftrace_t *trace, const char *path, reftrace_format_t format, const char *columns) {
+    memset(trace, 0, sizeof *trace);
+    trace->format = format;
+
+    if(columns) {
+        char header[LINE_SIZE];
+        snprintf(header, sizeof header, "%s", columns);
+        if(!parse_columns(trace, header)) return false;
+    }
+
+    trace->in = strcmp(path, "-") == 0 ? stdin : fopen(path, "r");
+    if(!trace->in) {
+        fprintf(stderr, "Could not open reference trace %s\n", path);
+        return false;
+    }
+
+    return true;
+}
+
+void reftrace_close(reftrace_t *trace) {
+    if(trace->in && trace->in != stdin) fclose(trace->in);
+    trace->in = NULL;
+}
+
+static bool parse_csv(reftrace_t *trace, char *line, reftrace_state_t *state) {
+    size_t column = 0;
+
+    for(char *field = line; field; column++) {
+        char *comma = strchr(field, ',');
+        if(comma) *comma = '\0';
+
+        char *text = trim(field);
+        const uint32_t bit = column < trace->column_count ? trace->columns[column] : 0;
+        uint32_t value;
+
+        if(bit && !parse_value(text, strlen(text), 16, field_max(bit), &value)) {
+            fprintf(stderr, "Reference trace line %zu: invalid value \"%s\" in column %zu\n", trace->line, text, column + 1);
+            return false;
+        }
+        if(bit) set_field(state, bit, value);
+
+        field = comma ? comma + 1 : NULL;
+    }
+
+    return true;
+}
+
+static const char *skip_space(const char *text) {
+    while(isspace((unsigned char)*text)) text++;
+    return text;
+}
+
+// A number or a hex string, *text is moved past it
+static bool parse_json_value(const char **text, uint32_t max, uint32_t *value) {
+    const char *start = *text;
+
+    if(*start == '"') {
+        const char *end = strchr(start + 1, '"');
+        if(!end || !parse_value(start + 1, end - start - 1, 16, max, value)) return false;
+        *text = end + 1;
+        return true;
+    }
+
+    const char *end = start;
+    while(isalnum((unsigned char)*end)) end++;
+    if(!parse_value(start, end - start, 10, max, value)) return false;
+
+    *text = end;
+    return true;
+}
+
+// Fields of a JSON object, false if it's malformed
+static bool parse_json_object(const char *line, reftrace_state_t *state) {
+    const char *text = skip_space(line);
+    if(*text++ != '{') return false;
+
+    for(text = skip_space(text); *text != '}'; ) {
+        // "key": value
+        if(*text != '"') return false;
+        const char *key = text + 1;
+        const char *key_end = strchr(key, '"');
+        if(!key_end) return false;
+
+        text = skip_space(key_end + 1);
+        if(*text++ != ':') return false;
+        text = skip_space(text);
+
+        const size_t key_len = key_end - key;
+        const uint32_t bit = field_bit(key, key_len);
+        uint32_t value;
+
+        if(key_len == 1 && tolower((unsigned char)key[0]) == 'v' && *text == '[') {
+            // "v": [V0, ..., VF]
+            text = skip_space(text + 1);
+            for(int reg = 0; *text != ']'; reg++) {
+                if(reg == 16 || !parse_json_value(&text, 0xFF, &value)) return false;
+                set_field(state, REFTRACE_V0 << reg, value);
+
+                text = skip_space(text);
+                if(*text == ',') text = skip_space(text + 1);
+            }
+            text++;
+        } else if(bit) {
+            if(!parse_json_value(&text, field_max(bit), &value)) return false;
+            set_field(state, bit, value);
+        } else {
+            // Skipped, anything up to the next key, arrays and objects included
+            bool quoted = false;
+            int depth = 0;
+            for(; *text && (quoted || depth > 0 || (*text != ',' && *text != '}')); text++) {
+                if(*text == '"') quoted = !quoted;
+                else if(!quoted && (*text == '[' || *text == '{')) depth++;
+                else if(!quoted && (*text == ']' || *text == '}')) depth--;
+            }
+        }
+
+        text = skip_space(text);
+        if(*text == ',') text = skip_space(text + 1);
+        else if(*text != '}') return false;
+    }
+
+    return true;
+}
+
+static bool parse_json(reftrace_t *trace, const char *line, reftrace_state_t *state) {
+    if(parse_json_object(line, state)) return true;
+
+    fprintf(stderr, "Reference trace line %zu: invalid JSON object\n", trace->line);
+    return false;
+}
+
+bool reftrace_next(reftrace_t *trace, reftrace_state_t *state, bool *error) {
+    char buf[LINE_SIZE];
+    *error = false;
+
+    while(fgets(buf, sizeof buf, trace->in)) {
+        trace->line++;
+        char *line = trim(buf);
+
+        // Blank lines, comments and the brackets of a JSON array
+        if(!*line || *line == '#' || strcmp(line, "[") == 0 || strcmp(line, "]") == 0) continue;
+
+        *state = (reftrace_state_t) {0};
+        if(trace->format == REFTRACE_JSON) {
+            const size_t len = strlen(line);
+            if(line[len - 1] == ',') line[len - 1] = '\0';
+            *error = !parse_json(trace, line, state);
+        } else if(!trace->have_columns) {
+            if(!parse_columns(trace, line)) *error = true;
+            else continue;
+        } else {
+            *error = !parse_csv(trace, line, state);
+        }
+
+        return !*error;
+    }
+
+    return false;
+}
+
+size_t reftrace_compare(const reftrace_state_t *state, const chip8_t *chip8, FILE *out) {
+    const uint32_t mask = chip8->ram_size - 1;
+    const uint16_t opcode = chip8->ram[chip8->PC & mask] << 8 | chip8->ram[(chip8->PC + 1) & mask];
+    const uint8_t sp = chip8->stack_ptr - chip8->stack;
+    size_t count = 0;
+
+    // Expected and actual value of every field that's in the trace
+    const struct {
+        uint32_t bit;
+        const char *name;
+        uint32_t expected;
+        uint32_t actual;
+        int digits;
+    } fields[] = {
+        {REFTRACE_PC,     "PC",          state->pc,          chip8->PC,          4},
+        {REFTRACE_OPCODE, "Opcode",      state->opcode,      opcode,             4},
+        {REFTRACE_I,      "I",           state->I,           chip8->I,           4},
+        {REFTRACE_DT,     "Delay timer", state->delay_timer, chip8->delay_timer, 2},
+        {REFTRACE_SP,     "Stack depth", state->sp,          sp,                 2},
+        {REFTRACE_ST,     "Sound timer", state->sound_timer, chip8->sound_timer, 2},
+    };
+
+    for(size_t i = 0; i < sizeof fields / sizeof fields[0]; i++) {
+        if(!(state->fields & fields[i].bit) || fields[i].expected == fields[i].actual) continue;
+
+        count++;
+        if(out) fprintf(out, "%s: 0x%0*X (reference) vs 0x%0*X\n", fields[i].name, fields[i].digits, fields[i].expected,
+                        fields[i].digits, fields[i].actual);
+    }
+
+    for(int reg = 0; reg < 16; reg++) {
+        if(!(state->fields & REFTRACE_V0 << reg) || state->V[reg] == chip8->V[reg]) continue;
+
+        count++;
+        if(out) fprintf(out, "V%X: 0x%02X (reference) vs 0x%02X\n", reg, state->V[reg], chip8->V[reg]);
+    }
+
+    return count;
+}
@@ -0,0 +1,63 @@
+#ifndef REFTRACE_H
+#define REFTRACE_H
+
+#include <stdio.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Per instruction trace from a reference emulator, each line is the machine state before one instruction
+// CSV files name their columns in a header line or with the columns argument of reftrace_open(), JSON files
+// have one object per line. Values are hex, with or without 0x, JSON numbers are decimal
+// Fields are pc, opcode, i, v0-vf (a "v" array in JSON), dt, st and sp (the stack depth), others are skipped
+// A trace only needs the fields it has, missing ones aren't compared
+typedef enum {
+    REFTRACE_CSV,
+    REFTRACE_JSON,
+} reftrace_format_t;
+
+// Fields present in a line
+#define REFTRACE_PC     (1u << 0)
+#define REFTRACE_OPCODE (1u << 1)
+#define REFTRACE_I      (1u << 2)
+#define REFTRACE_DT     (1u << 3)
+#define REFTRACE_ST     (1u << 4)
+#define REFTRACE_SP     (1u << 5)
+#define REFTRACE_V0     (1u << 6)  // V0 to VF are bits 6 to 21
+#define REFTRACE_COLUMNS_MAX 64
+
+typedef struct {
+    uint32_t fields;
+    uint16_t pc;
+    uint16_t opcode;
+    uint16_t I;
+    uint8_t V[16];
+    uint8_t delay_timer;
+    uint8_t sound_timer;
+    uint8_t sp;
+} reftrace_state_t;
+
+typedef struct {
+    FILE *in;
+    reftrace_format_t format;
+    uint32_t columns[REFTRACE_COLUMNS_MAX]; // CSV column fields, 0 for skipped columns
+    size_t column_count;
+    bool have_columns;      // Header read or columns given
+    size_t line;            // Line number of the last state read
+} reftrace_t;
+
+// columns is a CSV header like "pc,i,v0,v1" for files without one, NULL reads it from the file
+bool reftrace_open(reftrace_t *trace, const char *path, reftrace_format_t format, const char *columns);
+void reftrace_close(reftrace_t *trace);
+
+// Next state, returns false at the end of the file and on errors, which are printed with the line number
+// error tells them apart
+bool reftrace_next(reftrace_t *trace, reftrace_state_t *state, bool *error);
+
+// Fields of the state that don't match the machine, one line each like "V3: 0x10 (reference) vs 0x08"
+// Returns how many, nothing is printed if out is NULL
+size_t reftrace_compare(const reftrace_state_t *state, const chip8_t *chip8, FILE *out);
+
+#endif // REFTRACE_H
@@ -0,0 +1,608 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <ctype.h>
+#include <SDL.h>
+
+#include "renderer.h"
+#include "log.h"
+
+#define CURVE_STEPS 16      // Mesh cells along each side of the bent screen
+#define CURVE_BEND  0.05f   // How far the corners are pulled in, a fraction of the distance to the middle
+
+// SDL container object
+typedef struct {
+    SDL_Window *window;
+    SDL_Renderer *renderer;
+    SDL_Texture *screen;    // CHIP8 pixels at 128x64, lores uses the top left quarter, created on first use
+    SDL_Texture *mega;      // Mega-Chip frames, created on first use
+    bool valid;             // The texture for the current mode holds the last frame, only changed rows are uploaded
+    bool drawn_mega;        // Mode, resolution and colors of the last frame
+    uint32_t drawn_width;
+    uint32_t drawn_height;
+    uint32_t drawn_colors[4];
+    char overlay[512];      // Debug overlay text, "" when off
+    bool animating;         // Some rows of the last frame are still fading out or blending
+    bool fading[CHIP8_MEGA_HEIGHT];
+    // --deflicker's last frames by plane bits, the oldest is replaced next. A row is blending while they differ
+    uint8_t history[TUNING_DEFLICKER_MAX_FRAMES][CHIP8_HIRES_WIDTH*CHIP8_HIRES_HEIGHT];
+    uint32_t history_next;
+    bool blending[CHIP8_HIRES_HEIGHT];
+    uint32_t glow[CHIP8_MEGA_WIDTH*CHIP8_MEGA_HEIGHT]; // Phosphor decay buffer, the color each texture pixel was shown in
+    SDL_Texture *frame;     // Rotation and curvature draw the screen in here first, created on first use
+    bool upright;           // This renderer can't draw into textures, no rotation or curvature
+    bool flat;              // Curvature doesn't work with this renderer, the screen is drawn straight
+    int drawn_output_w;     // Window size in pixels at the last frame
+    int drawn_output_h;
+    SDL_Vertex curve[(CURVE_STEPS + 1) * (CURVE_STEPS + 1)]; // Mesh that bends the frame onto the window
+    int curve_indices[CURVE_STEPS * CURVE_STEPS * 6];
+} sdl_t;
+
+// 3x5 pixel overlay font, a row per 3 bits from the top, the high bit is the left pixel
+// Lowercase is drawn as uppercase, characters without a glyph as blanks
+static const struct {
+    char c;
+    uint16_t rows;
+} font[] = {
+    {'0', 075557}, {'1', 026222}, {'2', 071747}, {'3', 071717}, {'4', 055711}, {'5', 074717}, {'6', 074757},
+    {'7', 071111}, {'8', 075757}, {'9', 075717}, {'A', 025755}, {'B', 065656}, {'C', 034443}, {'D', 065556},
+    {'E', 074647}, {'F', 074644}, {'G', 034553}, {'H', 055755}, {'I', 072227}, {'J', 011156}, {'K', 055655},
+    {'L', 044447}, {'M', 057755}, {'N', 065555}, {'O', 025552}, {'P', 065644}, {'Q', 025563}, {'R', 065655},
+    {'S', 034716}, {'T', 072222}, {'U', 055557}, {'V', 055552}, {'W', 055775}, {'X', 055255}, {'Y', 055222},
+    {'Z', 071247}, {':', 002020}, {'.', 000002}, {'-', 000700}, {'/', 011244}, {'%', 051245},
+};
+
+static uint16_t font_glyph(char c) {
+    c = (char)toupper((unsigned char)c);
+
+    for(size_t i = 0; i < sizeof font / sizeof font[0]; i++)
+        if(font[i].c == c) return font[i].rows;
+
+    return 0;
+}
+
+// Overlay text in the top left corner on a translucent box, sized to the scale factor so it stays readable
+static void sdl_draw_overlay(sdl_t *sdl, const config_t *config) {
+    const int size = config->scale_factor / 3 > 0 ? (int)config->scale_factor / 3 : 1;
+    const int advance = 4 * size;     // Glyph and a column of space
+    const int line_height = 6 * size;
+
+    int columns = 0, lines = 0;
+    for(const char *line = sdl->overlay; *line; lines++) {
+        const char *end = strchr(line, '\n');
+        const int len = end ? (int)(end - line) : (int)strlen(line);
+        if(len > columns) columns = len;
+        line += len + (end != NULL);
+    }
+
+    SDL_SetRenderDrawBlendMode(sdl->renderer, SDL_BLENDMODE_BLEND);
+    SDL_SetRenderDrawColor(sdl->renderer, 0, 0, 0, 0xB0);
+    SDL_Rect box = {0, 0, columns * advance + 3 * size, lines * line_height + 3 * size};
+    SDL_RenderFillRect(sdl->renderer, &box);
+    SDL_SetRenderDrawBlendMode(sdl->renderer, SDL_BLENDMODE_NONE);
+
+    SDL_SetRenderDrawColor(sdl->renderer, 0xFF, 0xFF, 0x00, 0xFF);
+    int x = 2 * size, y = 2 * size;
+    for(const char *c = sdl->overlay; *c; c++) {
+        if(*c == '\n') {
+            x = 2 * size;
+            y += line_height;
+            continue;
+        }
+
+        const uint16_t glyph = font_glyph(*c);
+        for(int row = 0; row < 5; row++) {
+            for(int col = 0; col < 3; col++) {
+                if(!(glyph >> ((4 - row) * 3 + 2 - col) & 1)) continue;
+
+                SDL_Rect pixel = {x + col * size, y + row * size, size, size};
+                SDL_RenderFillRect(sdl->renderer, &pixel);
+            }
+        }
+        x += advance;
+    }
+}
+
+static void set_draw_color(SDL_Renderer *renderer, uint32_t color) {
+    SDL_SetRenderDrawColor(renderer, (color >> 24) & 0xFF, (color >> 16) & 0xFF, (color >> 8) & 0xFF, color & 0xFF);
+}
+
+// Picture size in the window, turned sideways for 90 and 270 degrees
+static void picture_size(const config_t *config, int *w, int *h) {
+    const bool sideways = config->rotation == 90 || config->rotation == 270;
+    const int screen_w = config->window_width * config->scale_factor;
+    const int screen_h = config->window_height * config->scale_factor;
+
+    *w = sideways ? screen_h : screen_w;
+    *h = sideways ? screen_w : screen_h;
+}
+
+// --letterbox, or else the background color. Around a curved screen it's black like the frame of a tube
+static uint32_t letterbox_color(const config_t *config, bool curved) {
+    if(config->letterbox_color) return config->letterbox_color;
+    return curved ? 0x000000FF : config->bg_color;
+}
+
+static bool sdl_init(renderer_t *renderer, const config_t *config) {
+    sdl_t *sdl = calloc(1, sizeof *sdl);
+    if(!sdl) return false;
+    renderer->data = sdl;
+
+    if(SDL_InitSubSystem(SDL_INIT_VIDEO) != 0) {
+        log_write(CHIP8_LOG_ERROR, "display", "Could not initalize SDL video subsystem! %s", SDL_GetError());
+        return false;
+    }
+
+    Uint32 window_flags = SDL_WINDOW_RESIZABLE;
+    if(config->fullscreen) window_flags |= SDL_WINDOW_FULLSCREEN_DESKTOP;
+
+    int picture_w, picture_h;
+    picture_size(config, &picture_w, &picture_h);
+
+    sdl->window = SDL_CreateWindow(RENDERER_TITLE, SDL_WINDOWPOS_CENTERED, SDL_WINDOWPOS_CENTERED,
+                                    picture_w, picture_h, window_flags);
+    if(!sdl->window) {
+        log_write(CHIP8_LOG_ERROR, "display", "Could not create window %s", SDL_GetError());
+        return false;
+    }
+
+    Uint32 renderer_flags = SDL_RENDERER_ACCELERATED;
+    if(config->vsync) renderer_flags |= SDL_RENDERER_PRESENTVSYNC;
+
+    sdl->renderer = SDL_CreateRenderer(sdl->window, -1, renderer_flags);
+    if(!sdl->renderer) {
+        log_write(CHIP8_LOG_ERROR, "display", "Could not create renderer %s", SDL_GetError());
+        return false;
+    }
+
+    // Draw in scaled CHIP8 coordinates, SDL stretches it to the window size on resize
+    // keeping the aspect ratio, and an integer multiple of the scale unless it should fit the window exactly
+    // Stretching sets the scale of each axis on every frame instead
+    if(config->scaling != SCALE_STRETCH) {
+        SDL_RenderSetLogicalSize(sdl->renderer, picture_w, picture_h);
+        SDL_RenderSetIntegerScale(sdl->renderer, config->scaling == SCALE_INTEGER ? SDL_TRUE : SDL_FALSE);
+    }
+
+    return true;
+}
+
+static void sdl_cleanup(renderer_t *renderer) {
+    sdl_t *sdl = renderer->data;
+    if(!sdl) return;
+
+    if(sdl->screen) SDL_DestroyTexture(sdl->screen);
+    if(sdl->mega) SDL_DestroyTexture(sdl->mega);
+    if(sdl->frame) SDL_DestroyTexture(sdl->frame);
+    if(sdl->renderer) SDL_DestroyRenderer(sdl->renderer);
+    if(sdl->window) SDL_DestroyWindow(sdl->window);
+
+    free(sdl);
+    renderer->data = NULL;
+}
+
+static void sdl_clear(renderer_t *renderer, const config_t *config) {
+    sdl_t *sdl = renderer->data;
+    sdl->valid = false;
+
+    set_draw_color(sdl->renderer, letterbox_color(config, config->curvature));
+    SDL_RenderClear(sdl->renderer);
+}
+
+// Pixels of row y as RGBA, Mega-Chip colors or the colors of the planes a pixel is on in
+static void fill_row(const chip8_t *chip8, const config_t *config, const uint32_t colors[4], uint32_t y,
+                     uint32_t *row) {
+    const uint32_t width = chip8_display_width(chip8);
+
+    if(chip8->mega) {
+        for(uint32_t x = 0; x < width; x++) row[x] = chip8_mega_color(chip8, x, y, config->bg_color);
+        return;
+    }
+
+    const uint8_t *display = &chip8_display(chip8)[y * width];
+    for(uint32_t x = 0; x < width; x++) row[x] = colors[display[x] & 0x3];
+}
+
+// Flicker comes from sprites being erased and drawn again with XOR, a frame caught in between misses them.
+// Blending the row with the same row of the last frames shows them all the time: ORing lights pixels that
+// are on in any frame, averaging mixes the colors so a flickering pixel is dimmer
+// row holds the colors of the current frame and gets the blend. True while the frames differ
+static bool blend_row(sdl_t *sdl, const config_t *config, const chip8_t *chip8, const uint32_t colors[4], bool all,
+                      uint32_t y, uint32_t *row) {
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t frames = config->deflicker_frames;
+    const uint8_t *display = &chip8_display(chip8)[y * width];
+    const uint32_t start = y * CHIP8_HIRES_WIDTH;
+
+    // A new screen doesn't blend with what was there before
+    for(uint32_t i = 0; i < frames; i++)
+        if(all || i == sdl->history_next % frames) memcpy(&sdl->history[i][start], display, width);
+
+    bool blending = false;
+    for(uint32_t i = 1; i < frames; i++)
+        if(memcmp(&sdl->history[i][start], &sdl->history[0][start], width) != 0) blending = true;
+    if(!blending) return false;
+
+    for(uint32_t x = 0; x < width; x++) {
+        if(!config->deflicker_average) {
+            uint8_t planes = 0;
+            for(uint32_t i = 0; i < frames; i++) planes |= sdl->history[i][start + x];
+            row[x] = colors[planes & 0x3];
+            continue;
+        }
+
+        uint32_t sums[4] = {0};
+        for(uint32_t i = 0; i < frames; i++) {
+            const uint32_t color = colors[sdl->history[i][start + x] & 0x3];
+            for(uint32_t c = 0; c < 4; c++) sums[c] += (color >> (c * 8)) & 0xFF;
+        }
+
+        row[x] = 0;
+        for(uint32_t c = 0; c < 4; c++) row[x] |= (sums[c] / frames) << (c * 8);
+    }
+
+    return true;
+}
+
+// Channel by channel from the color shown last frame down towards the background
+static uint32_t fade(uint32_t from, uint32_t to, uint32_t percent) {
+    uint32_t color = to & 0xFF;
+
+    for(uint32_t shift = 8; shift < 32; shift += 8) {
+        const int32_t a = (from >> shift) & 0xFF;
+        const int32_t b = (to >> shift) & 0xFF;
+        color |= (uint32_t)(b + (a - b) * (int32_t)percent / 100) << shift;
+    }
+
+    return color;
+}
+
+// Phosphor ghosting: a pixel that went dark keeps part of its last brightness for a few frames instead of
+// going out at once, like a CRT. Sprites that are erased and drawn again every frame stop flickering
+// Lit pixels show at full brightness right away. True while some pixel of the row hasn't faded out yet
+static bool decay_row(uint32_t *glow, uint32_t background, uint32_t percent, uint32_t *row, uint32_t width) {
+    bool fading = false;
+
+    for(uint32_t x = 0; x < width; x++) {
+        if(row[x] == background && glow[x] != background) {
+            row[x] = fade(glow[x], background, percent);
+            fading = fading || row[x] != background;
+        }
+        glow[x] = row[x];
+    }
+
+    return fading;
+}
+
+// The screen goes through a texture, uploading only the rows that changed since the last frame
+// and the rows still fading out. A new mode, resolution or colors upload all of it, without ghosts
+static bool sdl_update_texture(sdl_t *sdl, const config_t *config, const chip8_t *chip8, const uint32_t colors[4]) {
+    SDL_Texture **texture = chip8->mega ? &sdl->mega : &sdl->screen;
+    const int texture_width = chip8->mega ? CHIP8_MEGA_WIDTH : CHIP8_HIRES_WIDTH;
+    const int texture_height = chip8->mega ? CHIP8_MEGA_HEIGHT : CHIP8_HIRES_HEIGHT;
+
+    if(!*texture) {
+        *texture = SDL_CreateTexture(sdl->renderer, SDL_PIXELFORMAT_RGBA8888, SDL_TEXTUREACCESS_STREAMING,
+                                     texture_width, texture_height);
+        if(!*texture) {
+            log_write(CHIP8_LOG_ERROR, "display", "Could not create screen texture %s", SDL_GetError());
+            return false;
+        }
+        SDL_SetTextureBlendMode(*texture, SDL_BLENDMODE_NONE);
+        sdl->valid = false;
+    }
+    sdl->animating = false;
+
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t height = chip8_display_height(chip8);
+    const bool all = !sdl->valid || sdl->drawn_mega != chip8->mega || sdl->drawn_width != width ||
+                     sdl->drawn_height != height || memcmp(sdl->drawn_colors, colors, sizeof sdl->drawn_colors) != 0;
+
+    static uint32_t pixels[CHIP8_MEGA_WIDTH*CHIP8_MEGA_HEIGHT];
+    const bool deflicker = config->deflicker_frames > 1 && !chip8->mega;  // Mega-Chip frames are double buffered
+    uint32_t first = 0;     // Start of the run of changed rows being collected
+
+    for(uint32_t y = 0; y <= height; y++) {
+        const bool changed = y < height && (all || chip8_row_dirty(chip8, y) || sdl->fading[y] ||
+                                            (deflicker && sdl->blending[y]));
+        if(changed) {
+            uint32_t *row = &pixels[y * texture_width];
+            uint32_t *glow = &sdl->glow[y * texture_width];
+
+            fill_row(chip8, config, colors, y, row);
+            if(deflicker) {
+                sdl->blending[y] = blend_row(sdl, config, chip8, colors, all, y, row);
+                sdl->animating = sdl->animating || sdl->blending[y];
+            }
+            if(all || !config->phosphor) {
+                memcpy(glow, row, width * sizeof *glow);
+                sdl->fading[y] = false;
+            } else {
+                sdl->fading[y] = decay_row(glow, config->bg_color, config->phosphor, row, width);
+                sdl->animating = sdl->animating || sdl->fading[y];
+            }
+            continue;
+        }
+
+        // Consecutive changed rows go up in one piece
+        if(y > first) {
+            const SDL_Rect rows = {.x = 0, .y = first, .w = width, .h = y - first};
+            SDL_UpdateTexture(*texture, &rows, &pixels[first * texture_width], texture_width * sizeof pixels[0]);
+        }
+        first = y + 1;
+    }
+
+    if(deflicker) sdl->history_next++;
+    sdl->valid = true;
+    sdl->drawn_mega = chip8->mega;
+    sdl->drawn_width = width;
+    sdl->drawn_height = height;
+    memcpy(sdl->drawn_colors, colors, sizeof sdl->drawn_colors);
+
+    const SDL_Rect source = {.x = 0, .y = 0, .w = width, .h = height};
+    SDL_RenderCopy(sdl->renderer, *texture, &source, NULL);
+    return true;
+}
+
+// Scanlines and the pixel grid, translucent over the picture
+static void sdl_draw_filters(sdl_t *sdl, const config_t *config, const chip8_t *chip8) {
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t height = chip8_display_height(chip8);
+    const uint32_t screen_w = config->window_width * config->scale_factor;
+    const uint32_t screen_h = config->window_height * config->scale_factor;
+
+    SDL_SetRenderDrawBlendMode(sdl->renderer, SDL_BLENDMODE_BLEND);
+
+    // The bottom third of every row, rows too thin for that (Mega-Chip at small scales) darken every other one
+    if(config->scanlines) {
+        SDL_SetRenderDrawColor(sdl->renderer, 0, 0, 0, 0x70);
+        for(uint32_t y = 0; y < height; y++) {
+            const int top = y * screen_h / height;
+            const int bottom = (y + 1) * screen_h / height;
+            const int lines = bottom - top >= 3 ? (bottom - top) / 3 : (int)(y % 2) * (bottom - top);
+            if(!lines) continue;
+
+            SDL_Rect line = {.x = 0, .y = bottom - lines, .w = screen_w, .h = lines};
+            SDL_RenderFillRect(sdl->renderer, &line);
+        }
+    }
+
+    // Gaps in the background color left of and above every pixel, Mega-Chip pixels are too small for them
+    if(config->pixel_grid && !chip8->mega) {
+        const int gap = screen_w / width >= 8 ? (int)(screen_w / width / 8) : 1;
+
+        SDL_SetRenderDrawColor(sdl->renderer, (config->bg_color >> 24) & 0xFF, (config->bg_color >> 16) & 0xFF,
+                               (config->bg_color >> 8) & 0xFF, 0xA0);
+        for(uint32_t x = 1; x < width; x++) {
+            SDL_Rect column = {.x = x * screen_w / width, .y = 0, .w = gap, .h = screen_h};
+            SDL_RenderFillRect(sdl->renderer, &column);
+        }
+        for(uint32_t y = 1; y < height; y++) {
+            SDL_Rect row = {.x = 0, .y = y * screen_h / height, .w = screen_w, .h = gap};
+            SDL_RenderFillRect(sdl->renderer, &row);
+        }
+    }
+
+    SDL_SetRenderDrawBlendMode(sdl->renderer, SDL_BLENDMODE_NONE);
+}
+
+// Where a point of the frame texture ends up in the window when it's turned
+static SDL_FPoint rotate_point(const config_t *config, float x, float y, float screen_w, float screen_h) {
+    switch(config->rotation) {
+        case 90:  return (SDL_FPoint) {.x = screen_h - y, .y = x};
+        case 180: return (SDL_FPoint) {.x = screen_w - x, .y = screen_h - y};
+        case 270: return (SDL_FPoint) {.x = y, .y = screen_w - x};
+        default:  return (SDL_FPoint) {.x = x, .y = y};
+    }
+}
+
+// Grid over the frame texture, each vertex moved towards the middle by how far it is off the other axis,
+// so the edges bow out like the glass of a tube. The mesh is turned with the picture
+static void build_curve(sdl_t *sdl, const config_t *config, uint32_t screen_w, uint32_t screen_h) {
+    int vertex = 0;
+    for(int row = 0; row <= CURVE_STEPS; row++) {
+        for(int col = 0; col <= CURVE_STEPS; col++) {
+            const float u = (float)col / CURVE_STEPS;
+            const float v = (float)row / CURVE_STEPS;
+            const float cx = 2 * u - 1;     // -1 to 1 from the middle
+            const float cy = 2 * v - 1;
+
+            const float x = (1 + cx * (1 - CURVE_BEND * cy * cy)) * screen_w / 2;
+            const float y = (1 + cy * (1 - CURVE_BEND * cx * cx)) * screen_h / 2;
+
+            sdl->curve[vertex++] = (SDL_Vertex) {
+                .position = rotate_point(config, x, y, screen_w, screen_h),
+                .color = {0xFF, 0xFF, 0xFF, 0xFF},
+                .tex_coord = {.x = u, .y = v},
+            };
+        }
+    }
+
+    // Two triangles per cell
+    int index = 0;
+    for(int row = 0; row < CURVE_STEPS; row++) {
+        for(int col = 0; col < CURVE_STEPS; col++) {
+            const int corner = row * (CURVE_STEPS + 1) + col;
+            const int below = corner + CURVE_STEPS + 1;
+            const int cell[6] = {corner, corner + 1, below, corner + 1, below + 1, below};
+
+            memcpy(&sdl->curve_indices[index], cell, sizeof cell);
+            index += 6;
+        }
+    }
+}
+
+// Rotation and curvature draw everything into a texture, which is then turned or bent onto the window
+// Renderers without render targets keep the screen upright, without geometry (SDL before 2.0.18) flat
+static bool sdl_begin_frame(sdl_t *sdl, const config_t *config) {
+    if(sdl->upright || ((!config->curvature || sdl->flat) && !config->rotation)) return false;
+
+    if(!sdl->frame) {
+        const uint32_t screen_w = config->window_width * config->scale_factor;
+        const uint32_t screen_h = config->window_height * config->scale_factor;
+
+        sdl->frame = SDL_CreateTexture(sdl->renderer, SDL_PIXELFORMAT_RGBA8888, SDL_TEXTUREACCESS_TARGET,
+                                       screen_w, screen_h);
+        if(!sdl->frame) {
+            log_write(CHIP8_LOG_WARN, "display", "No rotation or curvature, could not create frame texture %s",
+                      SDL_GetError());
+            sdl->upright = true;
+            return false;
+        }
+        SDL_SetTextureBlendMode(sdl->frame, SDL_BLENDMODE_NONE);
+        build_curve(sdl, config, screen_w, screen_h);
+    }
+
+    if(SDL_SetRenderTarget(sdl->renderer, sdl->frame) != 0) {
+        log_write(CHIP8_LOG_WARN, "display", "No rotation or curvature, could not draw into a texture %s",
+                  SDL_GetError());
+        sdl->upright = true;
+        return false;
+    }
+
+    return true;
+}
+
+static void sdl_end_frame(sdl_t *sdl, const config_t *config) {
+    const bool curved = config->curvature && !sdl->flat;
+
+    SDL_SetRenderTarget(sdl->renderer, NULL);
+    set_draw_color(sdl->renderer, letterbox_color(config, curved));
+    SDL_RenderClear(sdl->renderer);
+
+    if(curved) {
+        const int vertices = sizeof sdl->curve / sizeof sdl->curve[0];
+        const int indices = sizeof sdl->curve_indices / sizeof sdl->curve_indices[0];
+        if(SDL_RenderGeometry(sdl->renderer, sdl->frame, sdl->curve, vertices, sdl->curve_indices, indices) == 0)
+            return;
+
+        log_write(CHIP8_LOG_WARN, "display", "No curvature, could not draw the mesh %s", SDL_GetError());
+        sdl->flat = true;
+    }
+
+    // Turned around its middle, which is the middle of the window
+    int picture_w, picture_h;
+    picture_size(config, &picture_w, &picture_h);
+    const int screen_w = config->window_width * config->scale_factor;
+    const int screen_h = config->window_height * config->scale_factor;
+
+    const SDL_Rect target = {
+        .x = (picture_w - screen_w) / 2,
+        .y = (picture_h - screen_h) / 2,
+        .w = screen_w,
+        .h = screen_h,
+    };
+    SDL_RenderCopyEx(sdl->renderer, sdl->frame, NULL, &target, config->rotation, NULL, SDL_FLIP_NONE);
+}
+
+// Stretching has no logical size, the drawing is scaled to the window on each axis
+static void sdl_stretch(sdl_t *sdl, const config_t *config) {
+    int picture_w, picture_h;
+    picture_size(config, &picture_w, &picture_h);
+
+    int output_w = 0, output_h = 0;
+    if(SDL_GetRendererOutputSize(sdl->renderer, &output_w, &output_h) != 0 || output_w <= 0 || output_h <= 0)
+        return;
+
+    SDL_RenderSetScale(sdl->renderer, (float)output_w / picture_w, (float)output_h / picture_h);
+}
+
+static void sdl_update(renderer_t *renderer, const config_t *config, const chip8_t *chip8) {
+    sdl_t *sdl = renderer->data;
+
+    // Grab color values to draw
+    const uint8_t bg_r = (config->bg_color >> 24) & 0xFF;
+    const uint8_t bg_g = (config->bg_color >> 16) & 0xFF;
+    const uint8_t bg_b = (config->bg_color >>  8) & 0xFF;
+    const uint8_t bg_a = (config->bg_color >>  0) & 0xFF;
+
+    // Pixel colors by XO-CHIP plane bitmask, plane 1 only is the regular foreground
+    const uint32_t colors[4] = {config->bg_color, config->fg_color, config->plane2_color, config->blend_color};
+
+    // The scale has to be set before drawing into the frame texture, which keeps it for the window
+    SDL_GetRendererOutputSize(sdl->renderer, &sdl->drawn_output_w, &sdl->drawn_output_h);
+    if(config->scaling == SCALE_STRETCH) sdl_stretch(sdl, config);
+    const bool framed = sdl_begin_frame(sdl, config);
+
+    // Clear the letterbox area around the logical screen after window resizes
+    if(framed) SDL_SetRenderDrawColor(sdl->renderer, bg_r, bg_g, bg_b, bg_a);
+    else set_draw_color(sdl->renderer, letterbox_color(config, false));
+    SDL_RenderClear(sdl->renderer);
+
+    // Pixel outlines are drawn on top of the lit CHIP8 pixels, Mega-Chip has no outlines
+    const bool drawn = sdl_update_texture(sdl, config, chip8, colors);
+    if(drawn && config->pixel_outlines && !chip8->mega) {
+        const uint8_t *display = chip8_display(chip8);
+        const uint32_t width = chip8_display_width(chip8);
+        const uint32_t height = chip8_display_height(chip8);
+
+        // The window always covers 64x32 scaled pixels, hires pixels are half the size
+        const uint32_t screen_w = config->window_width * config->scale_factor;
+        const uint32_t screen_h = config->window_height * config->scale_factor;
+
+        SDL_SetRenderDrawColor(sdl->renderer, bg_r, bg_g, bg_b, bg_a);
+        for(uint32_t i = 0; i < width * height; i++) {
+            if(!display[i]) continue;
+
+            // Translate 1D index i value to 2D X/Y coordinates
+            const uint32_t x = i % width;
+            const uint32_t y = i / width;
+
+            // Edges are computed so there are no gaps for odd scale factors
+            SDL_Rect rect = {
+                .x = x * screen_w / width,
+                .y = y * screen_h / height,
+                .w = (x + 1) * screen_w / width - x * screen_w / width,
+                .h = (y + 1) * screen_h / height - y * screen_h / height,
+            };
+            SDL_RenderDrawRect(sdl->renderer, &rect);
+        }
+    }
+
+    if(drawn && (config->scanlines || config->pixel_grid)) sdl_draw_filters(sdl, config, chip8);
+    if(framed) sdl_end_frame(sdl, config);
+
+    if(sdl->overlay[0]) sdl_draw_overlay(sdl, config);
+    SDL_RenderPresent(sdl->renderer);
+}
+
+static void sdl_toggle_fullscreen(renderer_t *renderer) {
+    const sdl_t *sdl = renderer->data;
+
+    const bool fullscreen = SDL_GetWindowFlags(sdl->window) & SDL_WINDOW_FULLSCREEN_DESKTOP;
+    SDL_SetWindowFullscreen(sdl->window, fullscreen ? 0 : SDL_WINDOW_FULLSCREEN_DESKTOP);
+}
+
+static void sdl_set_title(renderer_t *renderer, const char *title) {
+    const sdl_t *sdl = renderer->data;
+    SDL_SetWindowTitle(sdl->window, title);
+}
+
+static void sdl_set_overlay(renderer_t *renderer, const char *text) {
+    sdl_t *sdl = renderer->data;
+    snprintf(sdl->overlay, sizeof sdl->overlay, "%s", text ? text : "");
+}
+
+// A resized window is drawn again too, the picture is scaled to its new size
+static bool sdl_animating(renderer_t *renderer) {
+    const sdl_t *sdl = renderer->data;
+
+    int output_w = 0, output_h = 0;
+    SDL_GetRendererOutputSize(sdl->renderer, &output_w, &output_h);
+    return sdl->animating || output_w != sdl->drawn_output_w || output_h != sdl->drawn_output_h;
+}
+
+void sdl_renderer(renderer_t *renderer) {
+    *renderer = (renderer_t) {
+        .name = "sdl",
+        .init = sdl_init,
+        .clear = sdl_clear,
+        .update = sdl_update,
+        .toggle_fullscreen = sdl_toggle_fullscreen,
+        .set_title = sdl_set_title,
+        .set_overlay = sdl_set_overlay,
+        .animating = sdl_animating,
+        .cleanup = sdl_cleanup,
+    };
+}
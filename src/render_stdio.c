@@ -0,0 +1,102 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <signal.h>
+
+#include "renderer.h"
+#include "image.h"
+
+// Frontend protocol for programs in other languages, they start the emulator with --renderer stdio and
+// talk to it over its stdin and stdout. Everything the emulator writes is a text line, a frame's pixels
+// follow its line:
+//   chip8-frontend <version>       Once at the start
+//   frame <width> <height>         Then width * height * 3 bytes of RGB, rows top to bottom
+//   title <text>                   Window title with the ROM name and stats
+//   sound <0|1>                    The buzzer started or stopped
+//   bye                            The emulator is closing
+// Lines it doesn't know a frontend skips, newer versions only add new ones. What the frontend sends
+// is in input_stdio.c
+#define STDIO_PROTOCOL_VERSION 1
+
+typedef struct {
+    bool sound;             // Last sound line sent
+} stdio_frontend_t;
+
+static bool stdio_init(renderer_t *renderer, const config_t *config) {
+    (void)config;
+
+    stdio_frontend_t *frontend = calloc(1, sizeof *frontend);
+    if(!frontend) return false;
+    renderer->data = frontend;
+
+    // A frontend that went away shows up as the end of stdin, not as a signal in the middle of a frame
+    signal(SIGPIPE, SIG_IGN);
+
+    printf("chip8-frontend %d\n", STDIO_PROTOCOL_VERSION);
+    fflush(stdout);
+    return true;
+}
+
+static void stdio_cleanup(renderer_t *renderer) {
+    if(!renderer->data) return;
+
+    puts("bye");
+    fflush(stdout);
+
+    signal(SIGPIPE, SIG_DFL);
+    free(renderer->data);
+    renderer->data = NULL;
+}
+
+// The frontend starts out with nothing on screen, the first frame takes care of it
+static void stdio_clear(renderer_t *renderer, const config_t *config) {
+    (void)renderer;
+    (void)config;
+}
+
+static void stdio_update(renderer_t *renderer, const config_t *config, const chip8_t *chip8) {
+    stdio_frontend_t *frontend = renderer->data;
+
+    const bool sound = chip8_sound_active(chip8);
+    if(sound != frontend->sound) {
+        printf("sound %d\n", sound);
+        frontend->sound = sound;
+    }
+
+    // The same colors as screenshots, so frontends don't have to know about planes or Mega-Chip palettes
+    const uint32_t palette[4] = {config->bg_color, config->fg_color, config->plane2_color, config->blend_color};
+    uint32_t width, height;
+    uint8_t *rgb = image_from_display(chip8, palette, 1, &width, &height);
+    if(rgb) {
+        printf("frame %u %u\n", width, height);
+        fwrite(rgb, 3, (size_t)width * height, stdout);
+        free(rgb);
+    }
+
+    fflush(stdout);
+}
+
+static void stdio_set_title(renderer_t *renderer, const char *title) {
+    (void)renderer;
+
+    // A line per title, a newline in it would start a line of its own
+    printf("title %.*s\n", (int)strcspn(title, "\n"), title);
+    fflush(stdout);
+}
+
+void stdio_renderer(renderer_t *renderer) {
+    *renderer = (renderer_t) {
+        .name = "stdio",
+        .init = stdio_init,
+        .clear = stdio_clear,
+        .update = stdio_update,
+        .toggle_fullscreen = NULL,
+        .set_title = stdio_set_title,
+        .set_overlay = NULL,
+        .cleanup = stdio_cleanup,
+    };
+}
@@ -0,0 +1,225 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <stdarg.h>
+#include <signal.h>
+#include <unistd.h>
+
+#include "renderer.h"
+
+// Each terminal cell holds 2 vertically stacked CHIP8 pixels using half-block characters
+// Sized for Mega-Chip's 256x192, the other modes only use the top left part
+// Mega-Chip colors aren't shown, every pixel that isn't transparent is drawn
+#define TERM_COLS CHIP8_MEGA_WIDTH
+#define TERM_ROWS (CHIP8_MEGA_HEIGHT / 2)
+
+// ANSI escape sequences
+#define ANSI_ALT_SCREEN_ON  "\x1b[?1049h"
+#define ANSI_ALT_SCREEN_OFF "\x1b[?1049l"
+#define ANSI_CURSOR_HIDE    "\x1b[?25l"
+#define ANSI_CURSOR_SHOW    "\x1b[?25h"
+#define ANSI_CLEAR          "\x1b[2J"
+#define ANSI_RESET          "\x1b[0m"
+
+#define TERM_RESTORE ANSI_RESET ANSI_CURSOR_SHOW ANSI_ALT_SCREEN_OFF
+
+// Cell contents, bit 0 = top pixel, bit 1 = bottom pixel
+enum {
+    CELL_EMPTY  = 0,
+    CELL_TOP    = 1,
+    CELL_BOTTOM = 2,
+    CELL_FULL   = 3,
+};
+
+static const char *cell_glyphs[] = {
+    [CELL_EMPTY]  = " ",
+    [CELL_TOP]    = "▀", // Upper half block
+    [CELL_BOTTOM] = "▄", // Lower half block
+    [CELL_FULL]   = "█", // Full block
+};
+
+// Terminal container object
+typedef struct {
+    uint8_t cells[TERM_ROWS][TERM_COLS];   // Last drawn cell contents
+    bool valid;                            // Cells reflect what is on the terminal
+    uint32_t width;                        // Resolution the cells were drawn in
+    uint32_t rows;                         // Terminal rows the screen takes up
+    char title[320];                       // Status line under the screen
+    bool title_valid;                      // Status line is on the terminal
+    char *out;                             // Frame output buffer, written in one go
+    size_t out_len;
+    size_t out_cap;
+} term_t;
+
+static void term_restore_on_signal(int sig) {
+    // Only async-signal-safe calls here
+    (void)!write(STDOUT_FILENO, TERM_RESTORE, sizeof TERM_RESTORE - 1);
+    _exit(128 + sig);
+}
+
+static void term_append(term_t *term, const char *str, size_t len) {
+    if(term->out_len + len > term->out_cap) {
+        size_t cap = term->out_cap ? term->out_cap * 2 : 4096;
+        while(cap < term->out_len + len) cap *= 2;
+
+        char *out = realloc(term->out, cap);
+        if(!out) return; // Drop output, next frame will try again
+        term->out = out;
+        term->out_cap = cap;
+    }
+
+    memcpy(&term->out[term->out_len], str, len);
+    term->out_len += len;
+}
+
+static void term_appendf(term_t *term, const char *fmt, ...) {
+    char buf[64];
+    va_list args;
+
+    va_start(args, fmt);
+    const int len = vsnprintf(buf, sizeof buf, fmt, args);
+    va_end(args);
+
+    if(len > 0) term_append(term, buf, (size_t)len < sizeof buf ? (size_t)len : sizeof buf - 1);
+}
+
+static void term_flush(term_t *term) {
+    fwrite(term->out, 1, term->out_len, stdout);
+    fflush(stdout);
+    term->out_len = 0;
+}
+
+// Set 24 bit foreground/background colors from RGBA config values
+static void term_colors(term_t *term, const config_t *config) {
+    term_appendf(term, "\x1b[38;2;%u;%u;%um",
+                 (config->fg_color >> 24) & 0xFF, (config->fg_color >> 16) & 0xFF, (config->fg_color >> 8) & 0xFF);
+    term_appendf(term, "\x1b[48;2;%u;%u;%um",
+                 (config->bg_color >> 24) & 0xFF, (config->bg_color >> 16) & 0xFF, (config->bg_color >> 8) & 0xFF);
+}
+
+// Status line right under the screen, it moves with resolution changes
+static void term_draw_title(term_t *term) {
+    term_appendf(term, "\x1b[%u;1H\x1b[K", term->rows + 1);
+    term_append(term, term->title, strlen(term->title));
+    term->title_valid = true;
+}
+
+static bool term_init(renderer_t *renderer, const config_t *config) {
+    (void)config;
+
+    term_t *term = calloc(1, sizeof *term);
+    if(!term) return false;
+    renderer->data = term;
+
+    if(!isatty(STDOUT_FILENO)) {
+        fprintf(stderr, "Terminal renderer requires stdout to be a terminal\n");
+        return false;
+    }
+
+    // Make sure the terminal is usable again if we get interrupted
+    signal(SIGINT, term_restore_on_signal);
+    signal(SIGTERM, term_restore_on_signal);
+
+    fputs(ANSI_ALT_SCREEN_ON ANSI_CURSOR_HIDE, stdout);
+    fflush(stdout);
+
+    return true;
+}
+
+static void term_cleanup(renderer_t *renderer) {
+    term_t *term = renderer->data;
+    if(!term) return;
+
+    fputs(TERM_RESTORE, stdout);
+    fflush(stdout);
+
+    signal(SIGINT, SIG_DFL);
+    signal(SIGTERM, SIG_DFL);
+
+    free(term->out);
+    free(term);
+    renderer->data = NULL;
+}
+
+static void term_clear(renderer_t *renderer, const config_t *config) {
+    term_t *term = renderer->data;
+
+    term_colors(term, config);
+    term_append(term, ANSI_CLEAR, sizeof ANSI_CLEAR - 1);
+    term_flush(term);
+
+    memset(term->cells, CELL_EMPTY, sizeof term->cells);
+    term->valid = false;
+    term->title_valid = false;
+}
+
+static void term_update(renderer_t *renderer, const config_t *config, const chip8_t *chip8) {
+    term_t *term = renderer->data;
+
+    // Resolution change, start over with a blank screen
+    if(term->valid && term->width != chip8_display_width(chip8)) term_clear(renderer, config);
+    term->width = chip8_display_width(chip8);
+
+    term_colors(term, config);
+
+    const uint32_t cols = chip8_display_width(chip8);
+    const uint32_t rows = chip8_display_height(chip8) / 2;
+    term->rows = rows;
+
+    for(uint32_t row = 0; row < rows; row++) {
+        int32_t cursor_col = -1; // Column the cursor is on after last write, -1 if unknown
+
+        // Neither of the pixel rows in this line changed, nothing to compare
+        if(term->valid && !chip8_row_dirty(chip8, row * 2) && !chip8_row_dirty(chip8, row * 2 + 1)) continue;
+
+        for(uint32_t col = 0; col < cols; col++) {
+            const uint8_t cell = (chip8_pixel(chip8, col, row * 2)     ? CELL_TOP    : 0) |
+                                 (chip8_pixel(chip8, col, row * 2 + 1) ? CELL_BOTTOM : 0);
+
+            // Only redraw cells that changed since last frame
+            if(term->valid && term->cells[row][col] == cell) continue;
+            term->cells[row][col] = cell;
+
+            // Move the cursor unless we are already right after the previous changed cell
+            if(cursor_col != (int32_t)col) term_appendf(term, "\x1b[%u;%uH", row + 1, col + 1);
+
+            const char *glyph = cell_glyphs[cell];
+            term_append(term, glyph, strlen(glyph));
+            cursor_col = col + 1;
+        }
+    }
+
+    if(!term->title_valid) term_draw_title(term);
+
+    term->valid = true;
+    term_flush(term);
+}
+
+static void term_set_title(renderer_t *renderer, const char *title) {
+    term_t *term = renderer->data;
+    snprintf(term->title, sizeof term->title, "%s", title);
+
+    // Before the first frame the screen size isn't known yet, term_update() draws it then
+    term->title_valid = false;
+    if(!term->valid) return;
+
+    term_draw_title(term);
+    term_flush(term);
+}
+
+void term_renderer(renderer_t *renderer) {
+    *renderer = (renderer_t) {
+        .name = "term",
+        .init = term_init,
+        .clear = term_clear,
+        .update = term_update,
+        .toggle_fullscreen = NULL,
+        .set_title = term_set_title,
+        .set_overlay = NULL,
+        .cleanup = term_cleanup,
+    };
+}
@@ -0,0 +1,38 @@
+#ifndef RENDERER_H
+#define RENDERER_H
+
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "config.h"
+
+// Window title, followed by the ROM name while one runs
+#define RENDERER_TITLE "CHIP8 Emulator"
+
+// Rendering backend
+// Each backend fills out the function table, data holds the backend private state
+typedef struct renderer renderer_t;
+
+struct renderer {
+    const char *name;
+    bool (*init)(renderer_t *renderer, const config_t *config);
+    void (*clear)(renderer_t *renderer, const config_t *config);
+    void (*update)(renderer_t *renderer, const config_t *config, const chip8_t *chip8);
+    void (*toggle_fullscreen)(renderer_t *renderer);   // Optional, may be NULL
+    void (*set_title)(renderer_t *renderer, const char *title); // Optional, may be NULL
+    // Optional, may be NULL. Debug text drawn over the screen from the next update on, lines end in '\n',
+    // NULL hides it
+    void (*set_overlay)(renderer_t *renderer, const char *text);
+    // Optional, may be NULL. The last update left the picture changing by itself (phosphor ghosting),
+    // the next frame has to be drawn even if the machine didn't draw
+    bool (*animating)(renderer_t *renderer);
+    void (*cleanup)(renderer_t *renderer);
+    void *data;
+};
+
+// Available backends
+void sdl_renderer(renderer_t *renderer);
+void term_renderer(renderer_t *renderer);
+void stdio_renderer(renderer_t *renderer);     // Frontend protocol on stdout, see render_stdio.c
+
+#endif // RENDERER_H
@@ -0,0 +1,328 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <ctype.h>
+
+#include "repl.h"
+#include "asm.h"
+#include "disasm.h"
+
+static void print_help(void) {
+    puts("Type an instruction to run it at PC, like LD V0, 0x05 or DRW V0, V1, 5, or its opcode in hex like 6005\n"
+         "Commands:\n"
+         "  .r, .regs             Show registers and timers\n"
+         "  .m, .mem <addr> [len] Dump memory (default 16 bytes)\n"
+         "  .d, .display          Show the display\n"
+         "  .st, .stack           Show the return addresses on the stack\n"
+         "  .l, .list             Disassemble the instructions typed so far\n"
+         "  .s, .step [n]         Run the next n instructions already in memory at PC (default 1)\n"
+         "  .t, .tick [n]         Count the timers down n times (default 1), also the display interrupt for DXYN\n"
+         "  .k, .key <k> <0|1>    Press or release keypad key 0-F\n"
+         "  .reset                Start over with an empty machine\n"
+         "  .h, .help             Show this help\n"
+         "  .q, .quit             Exit");
+}
+
+// Parse a number in base 10 or 16, hex numbers may have a 0x prefix
+static bool parse_number(const char *str, int base, uint32_t max, uint32_t *out) {
+    if(!str) {
+        puts("Missing argument");
+        return false;
+    }
+
+    char *end = NULL;
+    const unsigned long value = strtoul(str, &end, base);
+    if(*str == '\0' || *end != '\0' || value > max) {
+        printf("Invalid value %s\n", str);
+        return false;
+    }
+
+    *out = (uint32_t)value;
+    return true;
+}
+
+// 4 or 8 hex digits, an optional 0x in front, 8 for the instructions followed by an address word
+// No mnemonic is made of 4 or 8 hex letters, so anything else goes to the assembler
+static bool parse_opcode(const char *text, uint8_t bytes[4], size_t *size) {
+    if(text[0] == '0' && (text[1] == 'x' || text[1] == 'X')) text += 2;
+
+    const size_t len = strlen(text);
+    if((len != 4 && len != 8) || strspn(text, "0123456789abcdefABCDEF") != len) return false;
+
+    for(size_t i = 0; i < len / 2; i++) {
+        const char digits[3] = {text[i * 2], text[i * 2 + 1], '\0'};
+        bytes[i] = (uint8_t)strtoul(digits, NULL, 16);
+    }
+
+    *size = len / 2;
+    return true;
+}
+
+// One instruction in the raw syntax, the assembler prints what's wrong with it
+static bool assemble(const char *text, uint8_t bytes[4], size_t *size) {
+    uint8_t *code = NULL;
+    size_t code_size = 0;
+
+    if(!asm_assemble(text, "input", &code, &code_size, NULL)) return false;
+
+    const bool ok = code_size == 2 || code_size == 4;
+    if(ok) memcpy(bytes, code, code_size);
+    else if(code_size == 0) puts("Nothing to run, type an instruction");
+    else puts("Type one instruction at a time");
+
+    *size = code_size;
+    free(code);
+    return ok;
+}
+
+static uint16_t word_at(const chip8_t *chip8, uint32_t addr) {
+    return (chip8->ram[addr % chip8->ram_size] << 8) | chip8->ram[(addr + 1) % chip8->ram_size];
+}
+
+// Address, opcode and mnemonic, returns the instruction length
+static uint8_t print_instruction(const chip8_t *chip8, uint32_t addr) {
+    const uint16_t opcode = word_at(chip8, addr);
+    char mnemonic[64];
+
+    const uint8_t size = disasm_instruction(opcode, word_at(chip8, addr + 2), DISASM_RAW, NULL, mnemonic, sizeof mnemonic);
+    if(size == 4) printf("0x%04X: %04X %04X  %s\n", addr, opcode, word_at(chip8, addr + 2), mnemonic);
+    else printf("0x%04X: %04X       %s\n", addr, opcode, mnemonic);
+    return size;
+}
+
+static void print_registers(const chip8_t *chip8) {
+    printf("PC: 0x%04X  I: 0x%04X  SP: %d  DT: %u  ST: %u\n", chip8->PC, chip8->I,
+           (int)(chip8->stack_ptr - chip8->stack), chip8->delay_timer, chip8->sound_timer);
+
+    for(int i = 0; i < 16; i++)
+        printf("V%X: 0x%02X%s", i, chip8->V[i], i % 8 == 7 ? "\n" : "  ");
+}
+
+static void print_memory(const chip8_t *chip8, uint32_t addr, uint32_t len) {
+    for(uint32_t row = 0; row < len; row += 16) {
+        printf("%04X:", (addr + row) % chip8->ram_size);
+
+        for(uint32_t i = row; i < row + 16 && i < len; i++)
+            printf(" %02X", chip8->ram[(addr + i) % chip8->ram_size]);
+
+        putchar('\n');
+    }
+}
+
+static void print_display(const chip8_t *chip8) {
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t height = chip8_display_height(chip8);
+
+    for(uint32_t y = 0; y < height; y++) {
+        for(uint32_t x = 0; x < width; x++)
+            putchar(chip8_pixel(chip8, x, y) ? '#' : '.');
+
+        putchar('\n');
+    }
+}
+
+static void print_stack(const chip8_t *chip8) {
+    const size_t depth = chip8->stack_ptr - chip8->stack;
+    if(depth == 0) puts("The stack is empty");
+
+    for(size_t i = depth; i > 0; i--) printf("  #%zu returns to 0x%04X\n", depth - i, chip8->stack[i - 1]);
+}
+
+static bool display_changed(const chip8_t *before, const chip8_t *after) {
+    const uint32_t width = chip8_display_width(after);
+    const uint32_t height = chip8_display_height(after);
+
+    for(uint32_t y = 0; y < height; y++) {
+        for(uint32_t x = 0; x < width; x++)
+            if(chip8_pixel(before, x, y) != chip8_pixel(after, x, y)) return true;
+    }
+
+    return false;
+}
+
+// Memory the instruction wrote to, in runs of changed bytes
+static void print_memory_changes(const chip8_t *before, const chip8_t *after) {
+    for(uint32_t addr = 0; addr < after->ram_size; addr++) {
+        if(before->ram[addr] == after->ram[addr]) continue;
+
+        uint32_t end = addr;
+        while(end < after->ram_size && before->ram[end] != after->ram[end]) end++;
+
+        printf("  Memory 0x%04X:", addr);
+        for(uint32_t i = addr; i < end && i < addr + 16; i++) printf(" %02X", after->ram[i]);
+        printf(end - addr > 16 ? " ... (%u bytes)\n" : "\n", end - addr);
+        addr = end;
+    }
+}
+
+// Everything the instruction at before->PC of size bytes did to the machine
+static void print_changes(const chip8_t *before, const chip8_t *after, uint8_t size) {
+    for(int i = 0; i < 16; i++) {
+        if(before->V[i] != after->V[i])
+            printf("  V%X: 0x%02X -> 0x%02X (%u)\n", i, before->V[i], after->V[i], after->V[i]);
+    }
+
+    if(before->I != after->I) printf("  I: 0x%04X -> 0x%04X\n", before->I, after->I);
+    if(before->delay_timer != after->delay_timer)
+        printf("  DT: %u -> %u\n", before->delay_timer, after->delay_timer);
+    if(before->sound_timer != after->sound_timer)
+        printf("  ST: %u -> %u\n", before->sound_timer, after->sound_timer);
+
+    // The copy's stack pointer still points into the machine's stack
+    const size_t depth_before = before->stack_ptr - after->stack;
+    const size_t depth_after = after->stack_ptr - after->stack;
+    if(depth_after > depth_before) printf("  Pushed return address 0x%04X\n", after->stack[depth_after - 1]);
+    else if(depth_after < depth_before) printf("  Popped return address 0x%04X\n", before->stack[depth_before - 1]);
+
+    // Staying put is waiting for a key or the display, run_at_pc() says which
+    const uint16_t next = (before->PC + size) & 0xFFFF;
+    if(after->PC != next && after->PC != before->PC) {
+        const uint8_t skipped = word_at(before, next) == 0xF000 ? 4 : 2;
+        if(after->PC == ((next + skipped) & 0xFFFF) && depth_before == depth_after)
+            printf("  PC: 0x%04X, skipped the instruction at 0x%04X\n", after->PC, next);
+        else
+            printf("  PC: 0x%04X\n", after->PC);
+    }
+
+    print_memory_changes(before, after);
+
+    // Switching resolutions clears the display, there's nothing to show yet
+    if(chip8_display_width(before) != chip8_display_width(after))
+        printf("  Display: %ux%u\n", chip8_display_width(after), chip8_display_height(after));
+    else if(display_changed(before, after))
+        print_display(after);
+}
+
+// The typed instructions by address, with a gap where others were skipped or jumped over
+static void list_typed(const chip8_t *chip8, const bool *typed) {
+    uint32_t next = 0;
+    bool any = false;
+
+    for(uint32_t addr = 0; addr < chip8->ram_size; addr++) {
+        if(!typed[addr]) continue;
+
+        if(any && addr != next) puts("...");
+        next = addr + print_instruction(chip8, addr);
+        any = true;
+    }
+
+    if(!any) puts("Nothing typed yet");
+}
+
+// Run the instruction at PC and show what it did, before gets the machine as it was
+static void run_at_pc(chip8_t *chip8, chip8_t *before) {
+    const uint8_t size = print_instruction(chip8, chip8->PC);
+
+    *before = *chip8;
+    chip8->state = RUNNING;
+    chip8_step(chip8);
+
+    if(chip8->fault != CHIP8_FAULT_NONE) {
+        chip8_print_fault(chip8, stdout);
+        chip8_clear_fault(chip8);
+        return;
+    }
+
+    print_changes(before, chip8, size);
+
+    if(chip8->state == QUIT) {
+        puts("  The program exited, the machine keeps running for the next instruction");
+    } else if(chip8->PC == before->PC && chip8->vblank_wait) {
+        puts("  Waiting for the display interrupt, .tick sends one and .step runs it again");
+    } else if(chip8->PC == before->PC && (chip8->inst.opcode & 0xF0FF) == 0xF00A) {
+        puts("  Waiting for a key, press one with .key <k> 1 and release it with .key <k> 0, then .step");
+    }
+}
+
+void repl_run(chip8_t *chip8) {
+    // The machine before each instruction to compare against, too big for the stack
+    chip8_t *before = malloc(sizeof *before);
+    bool *typed = calloc(CHIP8_XO_RAM_SIZE, sizeof *typed);    // Addresses instructions were typed at
+    char line[256];
+
+    if(!before || !typed) {
+        fprintf(stderr, "Out of memory for the REPL\n");
+        free(before);
+        free(typed);
+        return;
+    }
+
+    puts("Type instructions to run them, .help for the commands");
+
+    while(true) {
+        printf("chip8> ");
+        fflush(stdout);
+
+        if(!fgets(line, sizeof line, stdin)) break;
+
+        // The whole line for the assembler, the words for commands
+        char *text = line;
+        while(isspace((unsigned char)*text)) text++;
+        text[strcspn(text, "\r\n")] = '\0';
+        if(*text == '\0' || *text == ';') continue;
+
+        if(*text != '.') {
+            uint8_t bytes[4];
+            size_t size = 0;
+            if(!parse_opcode(text, bytes, &size) && !assemble(text, bytes, &size)) continue;
+
+            // chip8_poke keeps the decode cache in step with the new bytes
+            for(size_t i = 0; i < size; i++) chip8_poke(chip8, (chip8->PC + i) % chip8->ram_size, bytes[i]);
+            typed[chip8->PC % chip8->ram_size] = true;
+
+            run_at_pc(chip8, before);
+            continue;
+        }
+
+        const char *cmd = strtok(text, " \t");
+        const char *arg1 = strtok(NULL, " \t");
+        const char *arg2 = strtok(NULL, " \t");
+        uint32_t value = 0;
+        uint32_t len = 16;
+
+        if(strcmp(cmd, ".r") == 0 || strcmp(cmd, ".regs") == 0) {
+            print_registers(chip8);
+        } else if(strcmp(cmd, ".m") == 0 || strcmp(cmd, ".mem") == 0) {
+            if(!parse_number(arg1, 16, chip8->ram_size - 1, &value)) continue;
+            if(arg2 && !parse_number(arg2, 10, chip8->ram_size, &len)) continue;
+            print_memory(chip8, value, len);
+        } else if(strcmp(cmd, ".d") == 0 || strcmp(cmd, ".display") == 0) {
+            print_display(chip8);
+        } else if(strcmp(cmd, ".st") == 0 || strcmp(cmd, ".stack") == 0) {
+            print_stack(chip8);
+        } else if(strcmp(cmd, ".l") == 0 || strcmp(cmd, ".list") == 0) {
+            list_typed(chip8, typed);
+        } else if(strcmp(cmd, ".s") == 0 || strcmp(cmd, ".step") == 0) {
+            value = 1;
+            if(arg1 && !parse_number(arg1, 10, UINT32_MAX, &value)) continue;
+            for(uint32_t i = 0; i < value; i++) run_at_pc(chip8, before);
+        } else if(strcmp(cmd, ".t") == 0 || strcmp(cmd, ".tick") == 0) {
+            value = 1;
+            if(arg1 && !parse_number(arg1, 10, UINT32_MAX, &value)) continue;
+            for(uint32_t i = 0; i < value; i++) chip8_update_timers(chip8);
+            printf("DT: %u  ST: %u\n", chip8->delay_timer, chip8->sound_timer);
+        } else if(strcmp(cmd, ".k") == 0 || strcmp(cmd, ".key") == 0) {
+            if(!parse_number(arg1, 16, 0xF, &value)) continue;
+            if(!arg2 || (strcmp(arg2, "0") != 0 && strcmp(arg2, "1") != 0)) {
+                puts("Usage: .key <k> <0|1>");
+                continue;
+            }
+            chip8_set_key(chip8, value, arg2[0] == '1');
+        } else if(strcmp(cmd, ".reset") == 0) {
+            chip8_reset(chip8);
+            memset(typed, 0, CHIP8_XO_RAM_SIZE * sizeof *typed);
+            print_registers(chip8);
+        } else if(strcmp(cmd, ".h") == 0 || strcmp(cmd, ".help") == 0) {
+            print_help();
+        } else if(strcmp(cmd, ".q") == 0 || strcmp(cmd, ".quit") == 0) {
+            break;
+        } else {
+            printf("Unknown command %s, type .help for a list of commands\n", cmd);
+        }
+    }
+
+    free(before);
+    free(typed);
+}
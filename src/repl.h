@@ -0,0 +1,11 @@
+#ifndef REPL_H
+#define REPL_H
+
+#include "chip8.h"
+
+// "chip8 repl": instructions typed in the raw syntax of asm.c, or as hex opcodes, are written at PC
+// and run right away, then the registers, memory and pixels they changed are shown
+// Commands start with a dot so they can't be confused with mnemonics, ".help" lists them
+void repl_run(chip8_t *chip8);
+
+#endif // REPL_H
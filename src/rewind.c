@@ -0,0 +1,161 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "rewind.h"
+
+// Deltas are the XOR of two consecutive states, which is mostly zeros between nearby frames
+// They are run length encoded as repeated (u16 zero run, u16 literal count, literal bytes)
+
+// Worst case encoded size, a literal header every 0xFFFF bytes
+static size_t delta_bound(size_t size) {
+    return size + (size / 0xFFFF + 1) * 4;
+}
+
+static void put_u16(uint8_t *out, size_t *pos, size_t value) {
+    out[(*pos)++] = value >> 8;
+    out[(*pos)++] = value & 0xFF;
+}
+
+static size_t encode_delta(const uint8_t *a, const uint8_t *b, size_t size, uint8_t *out) {
+    size_t pos = 0;
+    size_t i = 0;
+
+    while(i < size) {
+        size_t zeros = 0;
+        while(i + zeros < size && zeros < 0xFFFF && a[i + zeros] == b[i + zeros]) zeros++;
+        i += zeros;
+
+        size_t literals = 0;
+        while(i + literals < size && literals < 0xFFFF && a[i + literals] != b[i + literals]) literals++;
+
+        put_u16(out, &pos, zeros);
+        put_u16(out, &pos, literals);
+        for(size_t j = 0; j < literals; j++) out[pos++] = a[i + j] ^ b[i + j];
+        i += literals;
+    }
+
+    return pos;
+}
+
+// XOR the delta into state, turning it into the state the delta was made against
+static void apply_delta(uint8_t *state, size_t size, const uint8_t *delta, size_t delta_size) {
+    size_t pos = 0;
+    size_t i = 0;
+
+    while(pos + 4 <= delta_size && i < size) {
+        const size_t zeros = (delta[pos] << 8) | delta[pos + 1];
+        const size_t literals = (delta[pos + 2] << 8) | delta[pos + 3];
+        pos += 4;
+        i += zeros;
+
+        for(size_t j = 0; j < literals && i < size && pos < delta_size; j++) state[i++] ^= delta[pos++];
+    }
+}
+
+static void drop_deltas(rewind_t *rewind) {
+    for(size_t i = 0; i < rewind->capacity; i++) {
+        free(rewind->deltas[i]);
+        rewind->deltas[i] = NULL;
+    }
+
+    rewind->count = 0;
+    rewind->head = 0;
+}
+
+bool rewind_init(rewind_t *rewind, size_t capacity) {
+    *rewind = (rewind_t) {
+        .deltas = calloc(capacity, sizeof *rewind->deltas),
+        .delta_sizes = calloc(capacity, sizeof *rewind->delta_sizes),
+        .capacity = capacity,
+    };
+
+    if(capacity == 0 || !rewind->deltas || !rewind->delta_sizes) {
+        rewind_free(rewind);
+        return false;
+    }
+
+    return true;
+}
+
+// Record the current machine state as the newest one, the oldest state is dropped when full
+void rewind_push(rewind_t *rewind, const chip8_t *chip8) {
+    const size_t size = chip8_state_size(chip8);
+
+    // Deltas only work between states of the same size
+    if(size != rewind->state_size) {
+        drop_deltas(rewind);
+        free(rewind->latest);
+        free(rewind->scratch);
+        rewind->latest = malloc(size);
+        rewind->scratch = malloc(size);
+        rewind->state_size = 0;
+
+        if(!rewind->latest || !rewind->scratch) return;
+
+        chip8_serialize(chip8, rewind->latest, size);
+        rewind->state_size = size;
+        return;
+    }
+
+    chip8_serialize(chip8, rewind->scratch, size);
+
+    uint8_t *delta = malloc(delta_bound(size));
+    if(!delta) return;
+
+    const size_t delta_size = encode_delta(rewind->scratch, rewind->latest, size, delta);
+    uint8_t *shrunk = realloc(delta, delta_size ? delta_size : 1);
+    if(shrunk) delta = shrunk;
+
+    // Overwrite the oldest delta when the ring is full
+    free(rewind->deltas[rewind->head]);
+    rewind->deltas[rewind->head] = delta;
+    rewind->delta_sizes[rewind->head] = delta_size;
+    rewind->head = (rewind->head + 1) % rewind->capacity;
+    if(rewind->count < rewind->capacity) rewind->count++;
+
+    // Newest state moves to the front
+    uint8_t *tmp = rewind->latest;
+    rewind->latest = rewind->scratch;
+    rewind->scratch = tmp;
+}
+
+// Restore the newest recorded state and forget it, the next pop returns the one before
+// Returns false when there is nothing left to rewind
+bool rewind_pop(rewind_t *rewind, chip8_t *chip8) {
+    if(rewind->state_size == 0) return false;
+
+    if(!chip8_deserialize(chip8, rewind->latest, rewind->state_size)) return false;
+
+    if(rewind->count == 0) {
+        // Keep the oldest state so holding rewind stays at the start
+        return true;
+    }
+
+    rewind->head = (rewind->head + rewind->capacity - 1) % rewind->capacity;
+    apply_delta(rewind->latest, rewind->state_size, rewind->deltas[rewind->head], rewind->delta_sizes[rewind->head]);
+    free(rewind->deltas[rewind->head]);
+    rewind->deltas[rewind->head] = NULL;
+    rewind->count--;
+
+    return true;
+}
+
+size_t rewind_memory_used(const rewind_t *rewind) {
+    size_t used = rewind->state_size * 2;
+
+    for(size_t i = 0; i < rewind->capacity; i++)
+        if(rewind->deltas[i]) used += rewind->delta_sizes[i];
+
+    return used;
+}
+
+void rewind_free(rewind_t *rewind) {
+    if(rewind->deltas) drop_deltas(rewind);
+
+    free(rewind->deltas);
+    free(rewind->delta_sizes);
+    free(rewind->latest);
+    free(rewind->scratch);
+    *rewind = (rewind_t) {0};
+}
@@ -0,0 +1,29 @@
+#ifndef REWIND_H
+#define REWIND_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Ring buffer of recent save states for rewinding
+// The newest state is kept whole, older ones as compressed deltas against the next newer state
+typedef struct {
+    uint8_t **deltas;       // Ring of delta compressed states, NULL when empty
+    size_t *delta_sizes;
+    size_t capacity;        // Maximum number of states kept
+    size_t head;            // Slot for the next delta
+    size_t count;           // Deltas in the ring
+    uint8_t *latest;        // Newest state, uncompressed
+    uint8_t *scratch;       // Serialized state being pushed
+    size_t state_size;      // 0 while there is no newest state
+} rewind_t;
+
+bool rewind_init(rewind_t *rewind, size_t capacity);
+void rewind_push(rewind_t *rewind, const chip8_t *chip8);
+bool rewind_pop(rewind_t *rewind, chip8_t *chip8);
+size_t rewind_memory_used(const rewind_t *rewind);
+void rewind_free(rewind_t *rewind);
+
+#endif // REWIND_H
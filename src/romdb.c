@@ -0,0 +1,107 @@
+#include <stdio.h>
+#include <string.h>
+
+#include "romdb.h"
+
+// ROMs in roms/ and programs/, hashes match the CHIP-8 community database where it has them
+// Games written for CHIP-48 get the "schip" quirks, the rest run fine with the defaults
+static const romdb_entry_t romdb[] = {
+    {"ea9af3c09b0d9e265fcd92bcc5d51a2939fdf27a", "15 Puzzle",       "chip8", "modern", 0, false, 0, 0, NULL},
+    {"d40abc54374e4343639f993e897e00904ddf85d9", "Blinky",          "chip8", "schip",  1000, false, 0, 0, NULL},
+    {"6f6509f38220e057a7e32ebb22dd353c1078e3e7", "Blitz",           "chip8", "modern", 0, false, 0, 0, NULL},
+    {"f13766c14aeb02ad8d4d103cb5eadd282d20cddc", "Brix",            "chip8", "modern", 0, false, 0, 0, NULL},
+    {"2d10c07b532f4fa7c07a07324ba26ca39fe484fd", "Connect 4",       "chip8", "modern", 0, false, 0, 0, NULL},
+    {"5260f8931e0e9f41e555b382a14a88368e3ed886", "Guess",           "chip8", "modern", 0, false, 0, 0, NULL},
+    {"050f07a54371da79f924dd0227b89d07b4f2aed0", "Hidden",          "chip8", "modern", 0, false, 0, 0, NULL},
+    {"f100197f0f2f05b4f3c8c31ab9c2c3930d3e9571", "Space Invaders",  "chip8", "schip",  0, false, 0, 0, NULL},
+    {"d6fa9dc9005dc0496f39ba52fef56f9fd0a5a158", "Kaleidoscope",    "chip8", "cosmac", 0, false, 0, 0, NULL},
+    {"b9272ae1acdaaa79ab649f6b48b72088ca2b1d74", "Maze",            "chip8", "modern", 0, false, 0, 0, NULL},
+    {"d979858bb9ffd07b48f52f92a8bcac0199f3623e", "Merlin",          "chip8", "modern", 0, false, 0, 0, NULL},
+    {"0d0cc129dad3c45ba672f85fec71a668232212cc", "Missile Command", "chip8", "modern", 0, false, 0, 0, NULL},
+    {"b232ef880bd6060fb45fa6effed7edf0ae95670e", "Pong",            "chip8", "modern", 0, false, 0, 0, NULL},
+    {"a60611339661e3ab2d8af024ad1da5880a6f8665", "Pong 2",          "chip8", "modern", 0, false, 0, 0, NULL},
+    {"1293db0ccccbe7dd3fc5a09a2abc5d7b175e18e0", "Puzzle",          "chip8", "modern", 0, false, 0, 0, NULL},
+    {"1bdb4ddaa7049266fa3226851f28855a365cfd12", "Syzygy",          "chip8", "modern", 0, false, 0, 0, NULL},
+    {"18b9d15f4c159e1f0ed58c2d8ec1d89325d3a3b6", "Tank",            "chip8", "modern", 0, false, 0, 0, NULL},
+    {"5f518084744bf3cb8733f6e5454dfd1634320563", "Tetris",          "chip8", "modern", 0, false, 0, 0, NULL},
+    {"429d455a4bc53167942bf6fd934d72b0f648dce3", "Tic-Tac-Toe",     "chip8", "modern", 0, false, 0, 0, NULL},
+    {"bdb92475acfe11bc7814a2f5eade13fcd09b756a", "UFO",             "chip8", "modern", 0, false, 0, 0, NULL},
+    {"da710f631f8e35534d0b9170bcf892a60f49c43d", "Vertical Brix",   "chip8", "modern", 0, false, 0, 0, NULL},
+    {"ade839585ddeb0e3633177df03c1d91589e629eb", "Vers",            "chip8", "modern", 0, false, 0, 0, NULL},
+    {"d666688a8fce468a7d88b536bc1ef5f35ba12031", "Wipe Off",        "chip8", "cosmac", 0, false, 0, 0, NULL},
+    {"1ba58656810b67fd131eb9af3e3987863bf26c90", "IBM Logo",        "chip8", "modern", 0, false, 0, 0, NULL},
+    {"f1cfcffe1937ed6dd6eeed1a7f85dfc777bda700", "Opcode test",     "chip8", "modern", 0, false, 0, 0, NULL},
+    {"9df1689015a0d1d95144f141903296f9f1c35fc5", "BC test",         "chip8", "modern", 0, false, 0, 0, NULL},
+};
+
+static uint32_t rotl(uint32_t value, int bits) {
+    return (value << bits) | (value >> (32 - bits));
+}
+
+// Process one 64 byte block
+static void sha1_block(uint32_t h[5], const uint8_t block[64]) {
+    uint32_t w[80];
+
+    for(int i = 0; i < 16; i++)
+        w[i] = (uint32_t)block[i*4] << 24 | (uint32_t)block[i*4 + 1] << 16 | block[i*4 + 2] << 8 | block[i*4 + 3];
+    for(int i = 16; i < 80; i++)
+        w[i] = rotl(w[i-3] ^ w[i-8] ^ w[i-14] ^ w[i-16], 1);
+
+    uint32_t a = h[0], b = h[1], c = h[2], d = h[3], e = h[4];
+
+    for(int i = 0; i < 80; i++) {
+        uint32_t f, k;
+        if(i < 20)      { f = (b & c) | (~b & d);          k = 0x5A827999; }
+        else if(i < 40) { f = b ^ c ^ d;                   k = 0x6ED9EBA1; }
+        else if(i < 60) { f = (b & c) | (b & d) | (c & d); k = 0x8F1BBCDC; }
+        else            { f = b ^ c ^ d;                   k = 0xCA62C1D6; }
+
+        const uint32_t temp = rotl(a, 5) + f + e + k + w[i];
+        e = d;
+        d = c;
+        c = rotl(b, 30);
+        b = a;
+        a = temp;
+    }
+
+    h[0] += a;
+    h[1] += b;
+    h[2] += c;
+    h[3] += d;
+    h[4] += e;
+}
+
+void romdb_sha1(const uint8_t *data, size_t size, char hex[ROMDB_SHA1_HEX_SIZE]) {
+    uint32_t h[5] = {0x67452301, 0xEFCDAB89, 0x98BADCFE, 0x10325476, 0xC3D2E1F0};
+    uint8_t block[64];
+    size_t pos = 0;
+
+    for(; pos + 64 <= size; pos += 64) sha1_block(h, &data[pos]);
+
+    // Last partial block, a 1 bit, zero padding and the length in bits
+    const size_t rest = size - pos;
+    memset(block, 0, sizeof block);
+    memcpy(block, &data[pos], rest);
+    block[rest] = 0x80;
+
+    if(rest >= 56) {
+        sha1_block(h, block);
+        memset(block, 0, sizeof block);
+    }
+
+    const uint64_t bits = (uint64_t)size * 8;
+    for(int i = 0; i < 8; i++) block[63 - i] = bits >> (i * 8);
+    sha1_block(h, block);
+
+    for(int i = 0; i < 5; i++) snprintf(&hex[i * 8], 9, "%08x", h[i]);
+}
+
+const romdb_entry_t *romdb_find(const uint8_t *rom, size_t size) {
+    char hex[ROMDB_SHA1_HEX_SIZE];
+    romdb_sha1(rom, size, hex);
+
+    for(size_t i = 0; i < sizeof romdb / sizeof romdb[0]; i++)
+        if(strcmp(romdb[i].sha1, hex) == 0) return &romdb[i];
+
+    return NULL;
+}
@@ -0,0 +1,28 @@
+#ifndef ROMDB_H
+#define ROMDB_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#define ROMDB_SHA1_HEX_SIZE 41
+
+// Known ROM, identified by the SHA-1 hash of the ROM file like in the CHIP-8 community database
+typedef struct {
+    const char *sha1;           // Lowercase hex digest
+    const char *title;
+    const char *platform;       // "chip8", "schip", "xochip" or "megachip"
+    const char *quirks;         // Preset name, see chip8_quirks_preset()
+    uint32_t insts_per_second;  // Recommended speed, 0 for the emulator default
+    bool has_colors;            // Recommended colors, RGBA8888 like config_t
+    uint32_t fg_color;
+    uint32_t bg_color;
+    const char *save_ram;       // Memory regions with the high scores, see save_ram_parse(), NULL for none
+} romdb_entry_t;
+
+void romdb_sha1(const uint8_t *data, size_t size, char hex[ROMDB_SHA1_HEX_SIZE]);
+
+// Look up a ROM image, returns NULL for unknown ROMs
+const romdb_entry_t *romdb_find(const uint8_t *rom, size_t size);
+
+#endif // ROMDB_H
@@ -0,0 +1,335 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <strings.h>
+#include <ctype.h>
+
+#include "romload.h"
+#include "chip8.h"
+#include "zip.h"
+#include "octo.h"
+#include "log.h"
+
+// Largest ROM that fits into XO-CHIP memory, and the largest file read to get one out of
+#define ROMLOAD_MAX_ROM_SIZE  (CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT)
+#define ROMLOAD_MAX_FILE_SIZE (16 * 1024 * 1024)
+
+bool romload_is_url(const char *source) {
+    return strncmp(source, "http://", 7) == 0 || strncmp(source, "https://", 8) == 0;
+}
+
+bool romload_is_stdin(const char *source) {
+    return strcmp(source, "-") == 0;
+}
+
+const char *romload_file_name(const char *source) {
+    if(romload_is_stdin(source)) return "stdin";
+    if(!romload_is_url(source)) return source;
+
+    const char *name = strrchr(source, '/') + 1;
+    return *name ? name : "download";
+}
+
+static bool has_rom_extension(const char *name) {
+    const char *dot = strrchr(name, '.');
+    if(!dot) return false;
+
+    const char *extensions[] = {".ch8", ".c8", ".sc8", ".xo8", ".mc8", ".o8"};
+    for(size_t i = 0; i < sizeof extensions / sizeof extensions[0]; i++)
+        if(strcasecmp(dot, extensions[i]) == 0) return true;
+
+    return false;
+}
+
+// Read everything up to max_size bytes, pipes and stdin can't be measured up front
+static uint8_t *read_stream(FILE *stream, const char *name, size_t max_size, size_t *size) {
+    uint8_t *data = NULL;
+    size_t length = 0;
+    size_t capacity = 0;
+
+    for(;;) {
+        if(length == capacity) {
+            if(capacity > max_size) {
+                log_write(CHIP8_LOG_ERROR, "rom", "%s is too big, more than %zu bytes", name, max_size);
+                free(data);
+                return NULL;
+            }
+
+            capacity = capacity ? capacity * 2 : 4096;
+            uint8_t *grown = realloc(data, capacity);
+            if(!grown) {
+                log_write(CHIP8_LOG_ERROR, "rom", "Out of memory reading %s", name);
+                free(data);
+                return NULL;
+            }
+            data = grown;
+        }
+
+        const size_t read = fread(&data[length], 1, capacity - length, stream);
+        if(read == 0) break;
+        length += read;
+    }
+
+    if(ferror(stream) || length > max_size) {
+        log_write(CHIP8_LOG_ERROR, "rom", ferror(stream) ? "Could not read %s" : "%s is too big", name);
+        free(data);
+        return NULL;
+    }
+
+    *size = length;
+    return data;
+}
+
+// Downloads go through curl, that saves linking against an HTTP and TLS library
+static uint8_t *download(const char *url, size_t *size) {
+    char command[FILENAME_MAX * 2];
+    size_t pos = snprintf(command, sizeof command, "curl -fsSL --max-filesize %d '", ROMLOAD_MAX_FILE_SIZE);
+
+    // Single quoted for the shell, a ' in the URL becomes '\''
+    for(const char *c = url; *c; c++) {
+        if(pos + 6 >= sizeof command) {
+            log_write(CHIP8_LOG_ERROR, "rom", "URL %s is too long", url);
+            return NULL;
+        }
+
+        if(*c == '\'') {
+            memcpy(&command[pos], "'\\''", 4);
+            pos += 4;
+        } else {
+            command[pos++] = *c;
+        }
+    }
+    memcpy(&command[pos], "'", 2);
+
+    FILE *pipe = popen(command, "r");
+    if(!pipe) {
+        log_write(CHIP8_LOG_ERROR, "rom", "Could not run curl to download %s", url);
+        return NULL;
+    }
+
+    uint8_t *data = read_stream(pipe, url, ROMLOAD_MAX_FILE_SIZE, size);
+    if(pclose(pipe) != 0) {
+        log_write(CHIP8_LOG_ERROR, "rom", "Could not download %s", url);
+        free(data);
+        return NULL;
+    }
+
+    return data;
+}
+
+// What a file that obviously isn't a ROM is, NULL if it could be one
+// CHIP-8 has no header, so this only catches well known file signatures and plain text
+static const char *not_a_rom(const uint8_t *data, size_t size) {
+    static const struct {
+        const char *magic;
+        size_t length;
+        const char *what;
+    } signatures[] = {
+        {"\x89PNG", 4, "a PNG image"},
+        {"GIF8", 4, "a GIF image"},
+        {"\xFF\xD8\xFF", 3, "a JPEG image"},
+        {"%PDF", 4, "a PDF document"},
+        {"\x7F" "ELF", 4, "a Linux program"},
+        {"\x1F\x8B", 2, "gzip compressed, unpack it first"},
+        {"PK\x03\x04", 4, "a damaged zip archive"},
+        {"Rar!", 4, "a RAR archive, unpack it first"},
+        {"7z\xBC\xAF", 4, "a 7-Zip archive, unpack it first"},
+    };
+
+    if(size == 0) return "empty";
+
+    for(size_t i = 0; i < sizeof signatures / sizeof signatures[0]; i++)
+        if(size >= signatures[i].length && memcmp(data, signatures[i].magic, signatures[i].length) == 0)
+            return signatures[i].what;
+
+    // Downloads of the page a ROM is linked from instead of the ROM itself
+    size_t start = 0;
+    while(start < size && isspace(data[start])) start++;
+    if(size - start >= 5 && (strncasecmp((const char *)&data[start], "<!doc", 5) == 0 ||
+                             strncasecmp((const char *)&data[start], "<html", 5) == 0))
+        return "a web page, the link may not go to the ROM file itself";
+
+    // Instructions almost always have bytes outside printable ASCII, opcodes like 00E0, A2xx or Dxyn do
+    bool has_newline = false;
+    for(size_t i = 0; i < size; i++) {
+        if(data[i] == '\n') has_newline = true;
+        else if(!isprint(data[i]) && !isspace(data[i])) return NULL;
+    }
+    if(size >= 16 && has_newline) return "a text file, Octo source is assembled when its name ends in .o8";
+
+    return NULL;
+}
+
+// Print why the ROM can't be run, true if it looks fine
+static bool check_rom(const char *name, const uint8_t *data, size_t size) {
+    const char *what = not_a_rom(data, size);
+    if(!what) return true;
+
+    log_write(CHIP8_LOG_ERROR, "rom", "%s is not a CHIP-8 ROM, it is %s", name, what);
+    return false;
+}
+
+// Octo source is assembled on the way in, data is freed
+static uint8_t *assemble_source(const char *name, uint8_t *data, size_t data_size, size_t *size, symbols_t *symbols) {
+    char *source = realloc(data, data_size + 1);
+    if(!source) {
+        log_write(CHIP8_LOG_ERROR, "rom", "Out of memory");
+        free(data);
+        return NULL;
+    }
+
+    source[data_size] = '\0';
+    uint8_t *rom = NULL;
+    const bool ok = octo_assemble(source, name, &rom, size, symbols);
+    free(source);
+    return ok ? rom : NULL;
+}
+
+// The file called entry_name, or without a name the only file or the first one with a ROM extension
+static uint8_t *extract_rom(const uint8_t *zip, size_t zip_size, const char *archive, const char *entry_name,
+                            size_t *size) {
+    zip_entry_t entry, found, first;
+    bool have_found = false;
+    size_t files = 0;
+
+    for(size_t i = 0; !have_found && zip_entry(zip, zip_size, i, &entry); i++) {
+        const size_t length = strlen(entry.name);
+        if(length == 0 || entry.name[length - 1] == '/') continue;   // Directory
+
+        if(files++ == 0) first = entry;
+        if(entry_name ? strcmp(entry.name, entry_name) == 0 : has_rom_extension(entry.name)) {
+            found = entry;
+            have_found = true;
+        }
+    }
+
+    if(!have_found && !entry_name && files == 1) {
+        found = first;
+        have_found = true;
+    }
+
+    if(!have_found) {
+        // One log line with the files in it, as many as fit
+        char names[1024] = "";
+        size_t len = 0;
+        for(size_t i = 0; zip_entry(zip, zip_size, i, &entry) && len < sizeof names; i++)
+            len += snprintf(&names[len], sizeof names - len, " %s", entry.name);
+
+        if(entry_name) log_write(CHIP8_LOG_ERROR, "rom", "No file %s in %s, it has:%s", entry_name, archive, names);
+        else if(files == 0)
+            log_write(CHIP8_LOG_ERROR, "rom", "No files in %s, or it is not a valid zip archive", archive);
+        else
+            log_write(CHIP8_LOG_ERROR, "rom", "Pick a ROM from %s with %s:<name>, it has:%s", archive, archive, names);
+        return NULL;
+    }
+
+    if(found.size > ROMLOAD_MAX_ROM_SIZE) {
+        log_write(CHIP8_LOG_ERROR, "rom", "Rom %s in %s is too big, Rom size: %u, Max size allowed: %d",
+                  found.name, archive, found.size, ROMLOAD_MAX_ROM_SIZE);
+        return NULL;
+    }
+
+    uint8_t *rom = zip_extract(zip, zip_size, &found);
+    if(rom && octo_is_source(found.name)) return assemble_source(found.name, rom, found.size, size, NULL);
+    if(rom && !check_rom(found.name, rom, found.size)) {
+        free(rom);
+        return NULL;
+    }
+
+    if(rom) *size = found.size;
+    return rom;
+}
+
+bool romload_symbols(const char *source, const char *path, symbols_t *symbols) {
+    if(path) return symbols_load_file(symbols, path, true);
+
+    symbols_init(symbols);
+    if(romload_is_url(source) || romload_is_stdin(source)) return true;
+
+    // The source is assembled again, its errors were already reported when the ROM was loaded
+    if(octo_is_source(source)) {
+        FILE *file = fopen(source, "rb");
+        size_t data_size = 0, rom_size = 0;
+        uint8_t *data = file ? read_stream(file, source, ROMLOAD_MAX_FILE_SIZE, &data_size) : NULL;
+        if(file) fclose(file);
+
+        if(data) free(assemble_source(source, data, data_size, &rom_size, symbols));
+        return true;
+    }
+
+    // game.ch8.sym, then game.sym
+    char sym_path[FILENAME_MAX];
+    if(snprintf(sym_path, sizeof sym_path, "%s.sym", source) >= (int)sizeof sym_path) return true;
+    if(!symbols_load_file(symbols, sym_path, false)) return false;
+    if(symbols->label_count > 0 || symbols->line_count > 0) return true;
+
+    snprintf(sym_path, sizeof sym_path, "%s", source);
+    char *ext = strrchr(sym_path, '.');
+    if(!ext || strchr(ext, '/') || (size_t)(ext - sym_path) + sizeof ".sym" > sizeof sym_path) return true;
+    strcpy(ext, ".sym");
+    return symbols_load_file(symbols, sym_path, false);
+}
+
+uint8_t *romload_read(const char *source, size_t *size) {
+    char path[FILENAME_MAX];
+    const char *entry_name = NULL;
+
+    // "<archive>.zip:<name>" names a file in the archive
+    snprintf(path, sizeof path, "%s", source);
+    char *colon = strrchr(path, ':');
+    if(colon && colon - path >= 4 && strncasecmp(colon - 4, ".zip", 4) == 0) {
+        *colon = '\0';
+        entry_name = colon + 1;
+    }
+
+    uint8_t *data;
+    size_t data_size = 0;
+
+    if(romload_is_stdin(path)) {
+        data = read_stream(stdin, "stdin", ROMLOAD_MAX_FILE_SIZE, &data_size);
+    } else if(romload_is_url(path)) {
+        data = download(path, &data_size);
+    } else {
+        FILE *file = fopen(path, "rb");
+        if(!file) {
+            log_write(CHIP8_LOG_ERROR, "rom", "Rom file %s is invalid or does not exist", path);
+            return NULL;
+        }
+
+        data = read_stream(file, path, ROMLOAD_MAX_FILE_SIZE, &data_size);
+        fclose(file);
+    }
+
+    if(!data) return NULL;
+
+    if(zip_is_archive(data, data_size)) {
+        uint8_t *rom = extract_rom(data, data_size, path, entry_name, size);
+        free(data);
+        return rom;
+    }
+
+    if(entry_name) {
+        log_write(CHIP8_LOG_ERROR, "rom", "%s is not a zip archive", path);
+        free(data);
+        return NULL;
+    }
+
+    const char *name = romload_is_stdin(path) ? "stdin" : path;
+    if(octo_is_source(path)) return assemble_source(name, data, data_size, size, NULL);
+    if(!check_rom(name, data, data_size)) {
+        free(data);
+        return NULL;
+    }
+
+    if(data_size > ROMLOAD_MAX_ROM_SIZE) {
+        log_write(CHIP8_LOG_ERROR, "rom", "Rom file %s is too big, Rom size: %zu, Max size allowed: %d", name,
+                  data_size, ROMLOAD_MAX_ROM_SIZE);
+        free(data);
+        return NULL;
+    }
+
+    *size = data_size;
+    return data;
+}
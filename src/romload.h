@@ -0,0 +1,31 @@
+#ifndef ROMLOAD_H
+#define ROMLOAD_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "symbols.h"
+
+// Where ROMs can come from on the command line:
+//   game.ch8                       a file
+//   -                              stdin
+//   http://... or https://...      a download, needs curl
+//   games.zip or games.zip:<name>  a file in a zip archive, also for downloads and stdin
+// Octo source named *.o8 is assembled into the ROM
+bool romload_is_url(const char *source);
+bool romload_is_stdin(const char *source);
+
+// Read a ROM into a malloc'd buffer, NULL on errors, ROMs too big for 64KB of memory and files that
+// are obviously something else, like images, archives, web pages or text. The reason is printed
+uint8_t *romload_read(const char *source, size_t *size);
+
+// Base name for files named after the ROM like save states, "stdin" for stdin
+// and the last part of the path for URLs, which can't have files next to them
+const char *romload_file_name(const char *source);
+
+// Labels and source lines for debugging the ROM: from path if it's given, the labels of .o8 source,
+// or <rom>.sym next to the ROM if there is one. Only a symbol file that was given has to exist
+bool romload_symbols(const char *source, const char *path, symbols_t *symbols);
+
+#endif // ROMLOAD_H
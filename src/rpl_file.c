@@ -0,0 +1,46 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "rpl_file.h"
+#include "datadir.h"
+
+#define LINE_SIZE 128
+
+// The flags file looks like this, lines for other ROMs are kept as they are when one is saved:
+//
+//   9fc8a47ec7166e57a3da16d7c93c5cb4fbd7af95 0000001200000000
+//   2f6354d9c4f1d5f3a1ad76e4f1a1fa1fb4fc8c8d 0300000000000000
+
+bool rpl_file_default_path(char *path, size_t size) {
+    return datadir_path("rpl_flags", path, size);
+}
+
+bool rpl_file_load(const char *path, const char *sha1, uint8_t *flags, size_t count) {
+    char hex[LINE_SIZE];
+    if(!datadir_find_line(path, sha1, hex, sizeof hex)) return false;
+
+    // All or nothing, a damaged line doesn't leave half of the flags loaded
+    uint8_t loaded[LINE_SIZE / 2] = {0};
+    bool found = count <= sizeof loaded;
+    for(size_t i = 0; found && i < count; i++) {
+        unsigned int value;
+        found = sscanf(hex + i * 2, "%2x", &value) == 1;
+        loaded[i] = (uint8_t)value;
+    }
+
+    if(found) memcpy(flags, loaded, count);
+    return found;
+}
+
+bool rpl_file_save(const char *path, const char *sha1, const uint8_t *flags, size_t count) {
+    char hex[LINE_SIZE];
+    if(count * 2 >= sizeof hex) return false;
+
+    for(size_t i = 0; i < count; i++) snprintf(&hex[i * 2], sizeof hex - i * 2, "%02x", flags[i]);
+    return datadir_replace_line(path, sha1, hex);
+}
@@ -0,0 +1,18 @@
+#ifndef RPL_FILE_H
+#define RPL_FILE_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+// SUPER-CHIP RPL user flags kept on disk, one line per ROM: "<sha1> <flags in hex>"
+// Default location is $XDG_DATA_HOME/chip8/rpl_flags or ~/.local/share/chip8/rpl_flags
+bool rpl_file_default_path(char *path, size_t size);
+
+// Flags saved for the ROM with this SHA-1, returns false and leaves flags alone if there are none
+bool rpl_file_load(const char *path, const char *sha1, uint8_t *flags, size_t count);
+
+// Replace or add the line for the ROM, missing directories on the way to path are created
+bool rpl_file_save(const char *path, const char *sha1, const uint8_t *flags, size_t count);
+
+#endif // RPL_FILE_H
@@ -0,0 +1,100 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "save_ram.h"
+#include "datadir.h"
+
+// The file has a line per region with its start address and bytes in hex:
+//
+//   02f0 000000000000001200000000000000ff
+//   0e00 0300000000000000
+
+bool save_ram_parse(const char *ranges, save_ram_t *save_ram) {
+    save_ram_t parsed = {0};
+
+    for(const char *c = ranges; *c; ) {
+        char *sep;
+        char *end = NULL;
+        const unsigned long min = strtoul(c, &sep, 16);
+        const unsigned long max = *sep == '-' ? strtoul(sep + 1, &end, 16) : 0;
+
+        if(sep == c || *sep != '-' || end == sep + 1 || (*end != '\0' && *end != ',') || min > max ||
+           max > 0xFFFF || parsed.count == SAVE_RAM_MAX_REGIONS) {
+            fprintf(stderr, "Invalid save RAM regions %s, expected up to %d <start>-<end> in hex, e.g. 2F0-2FF,E00-E0F\n",
+                    ranges, SAVE_RAM_MAX_REGIONS);
+            return false;
+        }
+
+        parsed.regions[parsed.count].start = (uint16_t)min;
+        parsed.regions[parsed.count].length = (uint16_t)(max - min + 1);
+        parsed.count++;
+        c = *end == ',' ? end + 1 : end;
+    }
+
+    *save_ram = parsed;
+    return true;
+}
+
+bool save_ram_default_path(const char *sha1, char *path, size_t size) {
+    char name[64];
+    snprintf(name, sizeof name, "saves/%s.ram", sha1);
+    return datadir_path(name, path, size);
+}
+
+// Is the line's region this one, with all of its bytes
+static bool region_matches(const char *line, uint16_t start, uint16_t length) {
+    char *hex;
+    const unsigned long addr = strtoul(line, &hex, 16);
+    if(hex == line || *hex != ' ' || addr != start) return false;
+
+    return strcspn(hex + 1, "\r\n") == (size_t)length * 2;
+}
+
+bool save_ram_load(const save_ram_t *save_ram, const char *path, chip8_t *chip8) {
+    FILE *file = fopen(path, "r");
+    if(!file) return false;
+
+    // Longest line is a whole 64K region
+    const size_t line_size = 0x10000 * 2 + 16;
+    char *line = malloc(line_size);
+    while(line && fgets(line, line_size, file)) {
+        for(size_t r = 0; r < save_ram->count; r++) {
+            const uint16_t start = save_ram->regions[r].start;
+            const uint16_t length = save_ram->regions[r].length;
+            if(!region_matches(line, start, length)) continue;
+
+            const char *hex = strchr(line, ' ') + 1;
+            for(uint32_t i = 0; i < length; i++) {
+                unsigned int value;
+                if(sscanf(hex + i * 2, "%2x", &value) != 1) break;
+                chip8_poke(chip8, start + i, (uint8_t)value);
+            }
+        }
+    }
+
+    free(line);
+    fclose(file);
+    return true;
+}
+
+bool save_ram_save(const save_ram_t *save_ram, const char *path, const chip8_t *chip8) {
+    if(!datadir_make_parents(path)) return false;
+
+    FILE *file = fopen(path, "w");
+    if(!file) return false;
+
+    for(size_t r = 0; r < save_ram->count; r++) {
+        const uint16_t start = save_ram->regions[r].start;
+        fprintf(file, "%04x ", start);
+        for(uint32_t i = 0; i < save_ram->regions[r].length; i++)
+            fprintf(file, "%02x", chip8->ram[(start + i) & (chip8->ram_size - 1)]);
+        fputc('\n', file);
+    }
+
+    return fclose(file) == 0;
+}
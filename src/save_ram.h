@@ -0,0 +1,33 @@
+#ifndef SAVE_RAM_H
+#define SAVE_RAM_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+#define SAVE_RAM_MAX_REGIONS 8
+
+// Memory a ROM keeps its high scores in, saved on exit and put back when it's loaded again like battery
+// backed RAM. Regions come from the ROM database or --save-ram as "<start>-<end>[,...]" in hex
+typedef struct {
+    struct {
+        uint16_t start;
+        uint16_t length;
+    } regions[SAVE_RAM_MAX_REGIONS];
+    size_t count;
+} save_ram_t;
+
+bool save_ram_parse(const char *ranges, save_ram_t *save_ram);
+
+// One file per ROM, $XDG_DATA_HOME/chip8/saves/<sha1>.ram or ~/.local/share/chip8/saves/<sha1>.ram
+bool save_ram_default_path(const char *sha1, char *path, size_t size);
+
+// Regions the file has with the same start and length are written to memory, false if there's no file
+bool save_ram_load(const save_ram_t *save_ram, const char *path, chip8_t *chip8);
+
+// Missing directories on the way to path are created
+bool save_ram_save(const save_ram_t *save_ram, const char *path, const chip8_t *chip8);
+
+#endif // SAVE_RAM_H
@@ -0,0 +1,347 @@
+// Lua scripting, built in with "make LUA=1"
+//
+// Scripts get a global chip8 table:
+//   chip8.on_frame(fn)          fn(frame) after every 60Hz frame
+//   chip8.on_instruction(fn)    fn(pc, opcode) before every instruction, slows the emulator down a lot
+//   chip8.on_read(fn)           fn(addr, value) on data reads by instructions, return a number to read that instead
+//   chip8.on_write(fn)          fn(addr, value) on writes by instructions, return a number to write that instead
+//   chip8.on_key(fn)            fn(key, pressed) when a keypad key changes, checked once per frame
+//   chip8.peek(addr)            Read memory
+//   chip8.poke(addr, value)     Write memory
+//   chip8.reg(name)             Read V0-VF, I, PC, DT or ST
+//   chip8.set_reg(name, value)  Write one of those
+//   chip8.key(key)              Whether keypad key 0-15 is held down
+//   chip8.press(key, pressed)   Press or release a keypad key, like the player would
+//   chip8.pixel(x, y)           Planes lit at a screen position, 0 for off
+//   chip8.hud(text)             Show text in the window title next to the ROM name, nil clears it
+// Passing nil to an on_ function removes the hook, so does an error in it after it's printed
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <strings.h>
+
+#include "script.h"
+#include "log.h"
+
+#ifdef CHIP8_LUA
+#include <lua.h>
+#include <lauxlib.h>
+#include <lualib.h>
+
+typedef enum {
+    HOOK_FRAME,
+    HOOK_INSTRUCTION,
+    HOOK_READ,
+    HOOK_WRITE,
+    HOOK_KEY,
+    HOOK_COUNT,
+} hook_t;
+
+static const char *hook_names[HOOK_COUNT] = {"on_frame", "on_instruction", "on_read", "on_write", "on_key"};
+
+struct script {
+    lua_State *lua;
+    chip8_t *chip8;
+    int hooks[HOOK_COUNT];  // Registry references to the hook functions, LUA_NOREF if unset
+    bool keys[16];          // Keypad as of the last frame, to find the changes for on_key
+    uint32_t frames;
+    char hud[128];
+    chip8_memory_hook_t next_read;  // Hooks installed before the script, like cheats, run after its own
+    chip8_memory_hook_t next_write;
+    void *next_userdata;
+};
+
+static uint8_t read_hook(void *userdata, uint16_t addr, uint8_t value);
+static uint8_t write_hook(void *userdata, uint16_t addr, uint8_t value);
+
+// Only hooked memory accesses pay for calling into Lua
+static void update_memory_hooks(script_t *script) {
+    chip8_set_memory_hooks(script->chip8,
+                           script->hooks[HOOK_READ] != LUA_NOREF || script->next_read ? read_hook : NULL,
+                           script->hooks[HOOK_WRITE] != LUA_NOREF || script->next_write ? write_hook : NULL, script);
+}
+
+static void remove_hook(script_t *script, hook_t hook) {
+    luaL_unref(script->lua, LUA_REGISTRYINDEX, script->hooks[hook]);
+    script->hooks[hook] = LUA_NOREF;
+    update_memory_hooks(script);
+}
+
+// Push the hook function, false if it isn't set
+static bool push_hook(script_t *script, hook_t hook) {
+    if(script->hooks[hook] == LUA_NOREF) return false;
+
+    lua_rawgeti(script->lua, LUA_REGISTRYINDEX, script->hooks[hook]);
+    return true;
+}
+
+// Call a pushed hook with its arguments, its result is left on the stack when this returns true
+static bool call_hook(script_t *script, hook_t hook, int args) {
+    if(lua_pcall(script->lua, args, 1, 0) == LUA_OK) return true;
+
+    log_write(CHIP8_LOG_ERROR, "script", "Script error in %s, removing it: %s", hook_names[hook],
+              lua_tostring(script->lua, -1));
+    lua_pop(script->lua, 1);
+    remove_hook(script, hook);
+    return false;
+}
+
+static uint8_t memory_hook(script_t *script, hook_t hook, uint16_t addr, uint8_t value) {
+    if(!push_hook(script, hook)) return value;
+
+    lua_pushinteger(script->lua, addr);
+    lua_pushinteger(script->lua, value);
+    if(!call_hook(script, hook, 2)) return value;
+
+    if(lua_isinteger(script->lua, -1)) value = lua_tointeger(script->lua, -1) & 0xFF;
+    lua_pop(script->lua, 1);
+    return value;
+}
+
+static uint8_t read_hook(void *userdata, uint16_t addr, uint8_t value) {
+    script_t *script = userdata;
+    value = memory_hook(script, HOOK_READ, addr, value);
+    return script->next_read ? script->next_read(script->next_userdata, addr, value) : value;
+}
+
+static uint8_t write_hook(void *userdata, uint16_t addr, uint8_t value) {
+    script_t *script = userdata;
+    value = memory_hook(script, HOOK_WRITE, addr, value);
+    return script->next_write ? script->next_write(script->next_userdata, addr, value) : value;
+}
+
+static script_t *get_script(lua_State *lua) {
+    return lua_touserdata(lua, lua_upvalueindex(1));
+}
+
+static int set_hook(lua_State *lua, hook_t hook) {
+    script_t *script = get_script(lua);
+    if(!lua_isnoneornil(lua, 1)) luaL_checktype(lua, 1, LUA_TFUNCTION);
+
+    remove_hook(script, hook);
+    if(lua_isnoneornil(lua, 1)) return 0;
+
+    lua_settop(lua, 1);
+    script->hooks[hook] = luaL_ref(lua, LUA_REGISTRYINDEX);
+    update_memory_hooks(script);
+    return 0;
+}
+
+static int lua_on_frame(lua_State *lua)       { return set_hook(lua, HOOK_FRAME); }
+static int lua_on_instruction(lua_State *lua) { return set_hook(lua, HOOK_INSTRUCTION); }
+static int lua_on_read(lua_State *lua)        { return set_hook(lua, HOOK_READ); }
+static int lua_on_write(lua_State *lua)       { return set_hook(lua, HOOK_WRITE); }
+static int lua_on_key(lua_State *lua)         { return set_hook(lua, HOOK_KEY); }
+
+static int lua_peek(lua_State *lua) {
+    const chip8_t *chip8 = get_script(lua)->chip8;
+    lua_pushinteger(lua, chip8->ram[luaL_checkinteger(lua, 1) & (chip8->ram_size - 1)]);
+    return 1;
+}
+
+static int lua_poke(lua_State *lua) {
+    chip8_poke(get_script(lua)->chip8, luaL_checkinteger(lua, 1), luaL_checkinteger(lua, 2) & 0xFF);
+    return 0;
+}
+
+// Register by name, V0-VF are 0-15 and I, PC, DT, ST follow
+static int check_register(lua_State *lua, int arg) {
+    const char *name = luaL_checkstring(lua, arg);
+    const char *specials[] = {"I", "PC", "DT", "ST"};
+
+    if((name[0] == 'V' || name[0] == 'v') && strlen(name) == 2) {
+        char *end;
+        const long reg = strtol(&name[1], &end, 16);
+        if(*end == '\0') return reg;
+    }
+
+    for(int i = 0; i < 4; i++)
+        if(strcasecmp(name, specials[i]) == 0) return 16 + i;
+
+    return luaL_argerror(lua, arg, "expected V0-VF, I, PC, DT or ST");
+}
+
+static int lua_reg(lua_State *lua) {
+    const chip8_t *chip8 = get_script(lua)->chip8;
+    const int reg = check_register(lua, 1);
+
+    switch(reg) {
+        case 16: lua_pushinteger(lua, chip8->I); break;
+        case 17: lua_pushinteger(lua, chip8->PC); break;
+        case 18: lua_pushinteger(lua, chip8->delay_timer); break;
+        case 19: lua_pushinteger(lua, chip8->sound_timer); break;
+        default: lua_pushinteger(lua, chip8->V[reg]); break;
+    }
+
+    return 1;
+}
+
+static int lua_set_reg(lua_State *lua) {
+    chip8_t *chip8 = get_script(lua)->chip8;
+    const int reg = check_register(lua, 1);
+    const lua_Integer value = luaL_checkinteger(lua, 2);
+
+    switch(reg) {
+        case 16: chip8->I = value & 0xFFFF; break;
+        case 17: chip8->PC = value & 0xFFFF; break;
+        case 18: chip8->delay_timer = value & 0xFF; break;
+        case 19: chip8->sound_timer = value & 0xFF; break;
+        default: chip8->V[reg] = value & 0xFF; break;
+    }
+
+    return 0;
+}
+
+static uint8_t check_key(lua_State *lua, int arg) {
+    const lua_Integer key = luaL_checkinteger(lua, arg);
+    if(key < 0 || key > 0xF) return luaL_argerror(lua, arg, "keys are 0-15");
+
+    return key;
+}
+
+static int lua_key(lua_State *lua) {
+    lua_pushboolean(lua, chip8_key(get_script(lua)->chip8, check_key(lua, 1)));
+    return 1;
+}
+
+static int lua_press(lua_State *lua) {
+    chip8_set_key(get_script(lua)->chip8, check_key(lua, 1), lua_toboolean(lua, 2));
+    return 0;
+}
+
+static int lua_pixel(lua_State *lua) {
+    const chip8_t *chip8 = get_script(lua)->chip8;
+    const lua_Integer x = luaL_checkinteger(lua, 1);
+    const lua_Integer y = luaL_checkinteger(lua, 2);
+
+    const bool inside = x >= 0 && y >= 0 && x < chip8_display_width(chip8) && y < chip8_display_height(chip8);
+    lua_pushinteger(lua, inside ? chip8_pixel_planes(chip8, x, y) : 0);
+    return 1;
+}
+
+static int lua_hud(lua_State *lua) {
+    script_t *script = get_script(lua);
+    snprintf(script->hud, sizeof script->hud, "%s", lua_isnoneornil(lua, 1) ? "" : luaL_checkstring(lua, 1));
+    return 0;
+}
+
+static const luaL_Reg functions[] = {
+    {"on_frame",       lua_on_frame},
+    {"on_instruction", lua_on_instruction},
+    {"on_read",        lua_on_read},
+    {"on_write",       lua_on_write},
+    {"on_key",         lua_on_key},
+    {"peek",           lua_peek},
+    {"poke",           lua_poke},
+    {"reg",            lua_reg},
+    {"set_reg",        lua_set_reg},
+    {"key",            lua_key},
+    {"press",          lua_press},
+    {"pixel",          lua_pixel},
+    {"hud",            lua_hud},
+    {NULL, NULL},
+};
+
+script_t *script_load(const char *path, chip8_t *chip8) {
+    script_t *script = calloc(1, sizeof *script);
+    lua_State *lua = script ? luaL_newstate() : NULL;
+    if(!lua) {
+        log_write(CHIP8_LOG_ERROR, "script", "Out of memory for the script");
+        free(script);
+        return NULL;
+    }
+
+    script->lua = lua;
+    script->chip8 = chip8;
+    script->next_read = chip8->read_hook;
+    script->next_write = chip8->write_hook;
+    script->next_userdata = chip8->hook_userdata;
+    for(int i = 0; i < HOOK_COUNT; i++) script->hooks[i] = LUA_NOREF;
+    for(uint8_t key = 0; key < 16; key++) script->keys[key] = chip8_key(chip8, key);
+
+    luaL_openlibs(lua);
+    lua_newtable(lua);
+    lua_pushlightuserdata(lua, script);
+    luaL_setfuncs(lua, functions, 1);
+    lua_setglobal(lua, "chip8");
+
+    // The top level code runs once to set up the hooks
+    if(luaL_loadfile(lua, path) != LUA_OK || lua_pcall(lua, 0, 0, 0) != LUA_OK) {
+        log_write(CHIP8_LOG_ERROR, "script", "Could not run script %s: %s", path, lua_tostring(lua, -1));
+        script_free(script);
+        return NULL;
+    }
+
+    return script;
+}
+
+void script_free(script_t *script) {
+    if(!script) return;
+
+    chip8_set_memory_hooks(script->chip8, script->next_read, script->next_write, script->next_userdata);
+    lua_close(script->lua);
+    free(script);
+}
+
+void script_instruction(script_t *script) {
+    const chip8_t *chip8 = script->chip8;
+    if(!push_hook(script, HOOK_INSTRUCTION)) return;
+
+    const uint32_t mask = chip8->ram_size - 1;
+    lua_pushinteger(script->lua, chip8->PC);
+    lua_pushinteger(script->lua, chip8->ram[chip8->PC & mask] << 8 | chip8->ram[(chip8->PC + 1) & mask]);
+    if(call_hook(script, HOOK_INSTRUCTION, 2)) lua_pop(script->lua, 1);
+}
+
+void script_frame(script_t *script) {
+    script->frames++;
+
+    for(uint8_t key = 0; key < 16; key++) {
+        const bool pressed = chip8_key(script->chip8, key);
+        if(pressed == script->keys[key]) continue;
+
+        script->keys[key] = pressed;
+        if(!push_hook(script, HOOK_KEY)) continue;
+
+        lua_pushinteger(script->lua, key);
+        lua_pushboolean(script->lua, pressed);
+        if(call_hook(script, HOOK_KEY, 2)) lua_pop(script->lua, 1);
+    }
+
+    if(push_hook(script, HOOK_FRAME)) {
+        lua_pushinteger(script->lua, script->frames);
+        if(call_hook(script, HOOK_FRAME, 1)) lua_pop(script->lua, 1);
+    }
+}
+
+const char *script_hud(const script_t *script) {
+    return script->hud;
+}
+
+#else
+// Without Lua --script only explains how to get it
+script_t *script_load(const char *path, chip8_t *chip8) {
+    (void)chip8;
+    log_write(CHIP8_LOG_ERROR, "script", "Can't run %s, scripting needs a build with Lua: make LUA=1", path);
+    return NULL;
+}
+
+void script_free(script_t *script) {
+    (void)script;
+}
+
+void script_instruction(script_t *script) {
+    (void)script;
+}
+
+void script_frame(script_t *script) {
+    (void)script;
+}
+
+const char *script_hud(const script_t *script) {
+    (void)script;
+    return "";
+}
+#endif
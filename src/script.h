@@ -0,0 +1,24 @@
+#ifndef SCRIPT_H
+#define SCRIPT_H
+
+#include "chip8.h"
+
+// Lua scripts hooked into a running machine for cheats, bots and HUDs
+// The API scripts see is described at the top of script.c
+typedef struct script script_t;
+
+// Load and run the script's top level code, which sets up its hooks
+// NULL after printing the error, always NULL in builds without Lua
+script_t *script_load(const char *path, chip8_t *chip8);
+void script_free(script_t *script);
+
+// Call before each instruction
+void script_instruction(script_t *script);
+
+// Call after each 60Hz frame, keypad changes since the last frame are reported first
+void script_frame(script_t *script);
+
+// Text the script wants shown, "" for none
+const char *script_hud(const script_t *script);
+
+#endif // SCRIPT_H
@@ -0,0 +1,161 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "symbols.h"
+
+void symbols_init(symbols_t *symbols) {
+    memset(symbols, 0, sizeof *symbols);
+}
+
+void symbols_free(symbols_t *symbols) {
+    free(symbols->labels);
+    free(symbols->lines);
+    symbols_init(symbols);
+}
+
+// Make room for one more element in a growing array
+static bool grow(void **items, size_t count, size_t *cap, size_t item_size) {
+    if(count < *cap) return true;
+
+    const size_t new_cap = *cap ? *cap * 2 : 64;
+    void *grown = realloc(*items, new_cap * item_size);
+    if(!grown) return false;
+
+    *items = grown;
+    *cap = new_cap;
+    return true;
+}
+
+bool symbols_add_label(symbols_t *symbols, uint16_t addr, const char *name) {
+    if(!grow((void **)&symbols->labels, symbols->label_count, &symbols->label_cap, sizeof *symbols->labels))
+        return false;
+
+    symbol_t *label = &symbols->labels[symbols->label_count++];
+    label->addr = addr;
+    snprintf(label->name, sizeof label->name, "%s", name);
+    return true;
+}
+
+bool symbols_add_line(symbols_t *symbols, uint16_t addr, uint32_t line) {
+    if(!grow((void **)&symbols->lines, symbols->line_count, &symbols->line_cap, sizeof *symbols->lines))
+        return false;
+
+    symbols->lines[symbols->line_count++] = (symbol_line_t){addr, line};
+    return true;
+}
+
+static int compare_lines(const void *a, const void *b) {
+    const symbol_line_t *x = a, *y = b;
+    return x->addr != y->addr ? (x->addr > y->addr) - (x->addr < y->addr) : (x->line > y->line) - (x->line < y->line);
+}
+
+void symbols_sort(symbols_t *symbols) {
+    if(symbols->line_count > 0) qsort(symbols->lines, symbols->line_count, sizeof *symbols->lines, compare_lines);
+}
+
+const char *symbols_name(const symbols_t *symbols, uint16_t addr) {
+    for(size_t i = 0; symbols && i < symbols->label_count; i++)
+        if(symbols->labels[i].addr == addr) return symbols->labels[i].name;
+
+    return NULL;
+}
+
+bool symbols_find(const symbols_t *symbols, const char *name, uint16_t *addr) {
+    for(size_t i = 0; symbols && i < symbols->label_count; i++) {
+        if(strcmp(symbols->labels[i].name, name) == 0) {
+            *addr = symbols->labels[i].addr;
+            return true;
+        }
+    }
+
+    return false;
+}
+
+uint32_t symbols_line(const symbols_t *symbols, uint16_t addr) {
+    if(!symbols || symbols->line_count == 0) return 0;
+
+    // The last line starting at or before addr, lines are sorted by address
+    size_t low = 0, high = symbols->line_count;
+    while(low < high) {
+        const size_t mid = (low + high) / 2;
+        if(symbols->lines[mid].addr <= addr) low = mid + 1;
+        else high = mid;
+    }
+
+    return low > 0 ? symbols->lines[low - 1].line : 0;
+}
+
+void symbols_describe(const symbols_t *symbols, uint16_t addr, char *buf, size_t size) {
+    const symbol_t *closest = NULL;
+
+    for(size_t i = 0; symbols && i < symbols->label_count; i++) {
+        const symbol_t *label = &symbols->labels[i];
+        if(label->addr <= addr && (!closest || label->addr > closest->addr)) closest = label;
+    }
+
+    if(!closest)                    snprintf(buf, size, "0x%04X", addr);
+    else if(closest->addr == addr)  snprintf(buf, size, "%s", closest->name);
+    else                            snprintf(buf, size, "%s+%u", closest->name, addr - closest->addr);
+}
+
+bool symbols_load_file(symbols_t *symbols, const char *path, bool required) {
+    symbols_init(symbols);
+
+    FILE *file = fopen(path, "r");
+    if(!file) {
+        if(required) fprintf(stderr, "Could not open symbol file %s\n", path);
+        return !required;
+    }
+
+    char line[SYMBOLS_SOURCE_SIZE + 16];
+    int line_number = 0;
+    bool ok = true;
+
+    while(ok && fgets(line, sizeof line, file)) {
+        line_number++;
+        line[strcspn(line, "\r\n")] = '\0';
+
+        char name[SYMBOLS_NAME_SIZE];
+        unsigned int addr;
+        unsigned long number;
+
+        if(line[0] == '\0' || line[0] == '#') continue;
+
+        if(strncmp(line, "source ", 7) == 0) {
+            snprintf(symbols->source, sizeof symbols->source, "%.*s", SYMBOLS_SOURCE_SIZE - 1, line + 7);
+        } else if(sscanf(line, "label %x %31s", &addr, name) == 2 && addr <= 0xFFFF) {
+            ok = symbols_add_label(symbols, (uint16_t)addr, name);
+        } else if(sscanf(line, "line %x %lu", &addr, &number) == 2 && addr <= 0xFFFF) {
+            ok = symbols_add_line(symbols, (uint16_t)addr, (uint32_t)number);
+        } else {
+            fprintf(stderr, "%s:%d: invalid symbol line: %s\n", path, line_number, line);
+            ok = false;
+        }
+    }
+
+    fclose(file);
+    if(!ok) symbols_free(symbols);
+    symbols_sort(symbols);
+    return ok;
+}
+
+bool symbols_save_file(const symbols_t *symbols, const char *path) {
+    FILE *file = fopen(path, "w");
+    if(!file) {
+        fprintf(stderr, "Could not write symbol file %s\n", path);
+        return false;
+    }
+
+    fprintf(file, "# CHIP-8 symbols\n");
+    if(symbols->source[0]) fprintf(file, "source %s\n", symbols->source);
+
+    for(size_t i = 0; i < symbols->label_count; i++)
+        fprintf(file, "label %04X %s\n", symbols->labels[i].addr, symbols->labels[i].name);
+    for(size_t i = 0; i < symbols->line_count; i++)
+        fprintf(file, "line %04X %u\n", symbols->lines[i].addr, symbols->lines[i].line);
+
+    return fclose(file) == 0;
+}
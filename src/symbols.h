@@ -0,0 +1,59 @@
+#ifndef SYMBOLS_H
+#define SYMBOLS_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#define SYMBOLS_NAME_SIZE 32
+#define SYMBOLS_SOURCE_SIZE 256
+
+// Labels and source lines of an assembled ROM, for debugging by name instead of by address
+typedef struct {
+    uint16_t addr;
+    char name[SYMBOLS_NAME_SIZE];
+} symbol_t;
+
+typedef struct {
+    uint16_t addr;          // First byte of the code or data the line assembled to
+    uint32_t line;
+} symbol_line_t;
+
+typedef struct {
+    char source[SYMBOLS_SOURCE_SIZE];  // The source file the lines are in, may be empty
+    symbol_t *labels;
+    size_t label_count;
+    size_t label_cap;
+    symbol_line_t *lines;   // In address order once the file is loaded or the assembler is done
+    size_t line_count;
+    size_t line_cap;
+} symbols_t;
+
+void symbols_init(symbols_t *symbols);
+void symbols_free(symbols_t *symbols);
+
+// Return false when out of memory
+bool symbols_add_label(symbols_t *symbols, uint16_t addr, const char *name);
+bool symbols_add_line(symbols_t *symbols, uint16_t addr, uint32_t line);
+void symbols_sort(symbols_t *symbols);
+
+// Label at exactly addr, NULL if it has none
+const char *symbols_name(const symbols_t *symbols, uint16_t addr);
+bool symbols_find(const symbols_t *symbols, const char *name, uint16_t *addr);
+
+// Source line for the code at addr, 0 if it didn't come from one
+uint32_t symbols_line(const symbols_t *symbols, uint16_t addr);
+
+// "name" or "name+offset" from the closest label before addr, the address in hex without labels
+void symbols_describe(const symbols_t *symbols, uint16_t addr, char *buf, size_t size);
+
+// Symbol files are text, numbers in hex:
+//   source <file name>
+//   label <addr> <name>
+//   line <addr> <line number in decimal>
+// # starts a comment line
+// A missing file is only an error if required, symbols are left empty then
+bool symbols_load_file(symbols_t *symbols, const char *path, bool required);
+bool symbols_save_file(const symbols_t *symbols, const char *path);
+
+#endif // SYMBOLS_H
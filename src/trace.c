@@ -0,0 +1,145 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <ctype.h>
+
+#include "trace.h"
+#include "disasm.h"
+
+void trace_init(trace_t *trace, FILE *out) {
+    memset(trace, 0, sizeof *trace);
+    trace->out = out;
+    trace->max_addr = 0xFFFF;
+    trace->op_classes = 0xFFFF;
+    symbols_init(&trace->symbols);
+}
+
+static uint16_t read_word(const chip8_t *chip8, uint32_t addr) {
+    return (chip8->ram[addr % chip8->ram_size] << 8) | chip8->ram[(addr + 1) % chip8->ram_size];
+}
+
+// Instruction, then only what it changed, e.g. "0x0204: 7A01  ADD VA, 0x01  VA 01->02"
+// With symbols the address is followed by its label, "0x0204 draw+4: 7A01  ADD VA, 0x01  VA 01->02"
+static void write_entry(const trace_entry_t *entry, const symbols_t *symbols, FILE *out) {
+    char mnemonic[64];
+    disasm_instruction_named(entry->opcode, entry->next, DISASM_RAW, NULL, symbols, mnemonic, sizeof mnemonic);
+
+    char where[SYMBOLS_NAME_SIZE + 16] = "";
+    if(symbols->label_count > 0) {
+        where[0] = ' ';
+        symbols_describe(symbols, entry->pc, where + 1, sizeof where - 1);
+    }
+
+    // Longest possible list is all 16 registers, I, SP and both timers
+    char changes[256] = "";
+    size_t len = 0;
+
+    for(int i = 0; i < 16; i++) {
+        if(entry->V_before[i] != entry->V_after[i])
+            len += snprintf(&changes[len], sizeof changes - len, " V%X %02X->%02X", i, entry->V_before[i], entry->V_after[i]);
+    }
+
+    if(entry->I_before != entry->I_after)
+        len += snprintf(&changes[len], sizeof changes - len, " I %04X->%04X", entry->I_before, entry->I_after);
+    if(entry->sp_before != entry->sp_after)
+        len += snprintf(&changes[len], sizeof changes - len, " SP %u->%u", entry->sp_before, entry->sp_after);
+    if(entry->delay_before != entry->delay_after)
+        len += snprintf(&changes[len], sizeof changes - len, " DT %02X->%02X", entry->delay_before, entry->delay_after);
+    if(entry->sound_before != entry->sound_after)
+        snprintf(&changes[len], sizeof changes - len, " ST %02X->%02X", entry->sound_before, entry->sound_after);
+
+    if(changes[0]) fprintf(out, "0x%04X%s: %04X  %-20s%s\n", entry->pc, where, entry->opcode, mnemonic, changes);
+    else           fprintf(out, "0x%04X%s: %04X  %s\n", entry->pc, where, entry->opcode, mnemonic);
+}
+
+// Execute one instruction, returns false if the ROM crashed or quit
+bool trace_step(trace_t *trace, chip8_t *chip8) {
+    trace_entry_t *entry = &trace->ring[trace->ring_head];
+
+    *entry = (trace_entry_t) {
+        .pc = chip8->PC,
+        .opcode = read_word(chip8, chip8->PC),
+        .next = read_word(chip8, chip8->PC + 2),
+        .I_before = chip8->I,
+        .sp_before = chip8->stack_ptr - chip8->stack,
+        .delay_before = chip8->delay_timer,
+        .sound_before = chip8->sound_timer,
+    };
+    memcpy(entry->V_before, chip8->V, sizeof chip8->V);
+
+    chip8_step(chip8);
+
+    // The faulting instruction didn't run, keep it out of the ring
+    // Without a log the ring is only kept for someone else to dump, like a crash report
+    if(chip8->fault != CHIP8_FAULT_NONE) {
+        if(!trace->out) return false;
+        fprintf(stderr, "Machine fault after %llu instructions, last %zu instructions:\n",
+                (unsigned long long)trace->count, trace->ring_count);
+        trace_dump(trace, stderr);
+        return false;
+    }
+
+    trace->count++;
+
+    memcpy(entry->V_after, chip8->V, sizeof chip8->V);
+    entry->I_after = chip8->I;
+    entry->sp_after = chip8->stack_ptr - chip8->stack;
+    entry->delay_after = chip8->delay_timer;
+    entry->sound_after = chip8->sound_timer;
+
+    trace->ring_head = (trace->ring_head + 1) % TRACE_RING_SIZE;
+    if(trace->ring_count < TRACE_RING_SIZE) trace->ring_count++;
+
+    const bool in_range = entry->pc >= trace->min_addr && entry->pc <= trace->max_addr;
+    if(trace->out && in_range && (trace->op_classes & (1 << (entry->opcode >> 12))))
+        write_entry(entry, &trace->symbols, trace->out);
+
+    return chip8->state != QUIT;
+}
+
+// Write the ring, oldest instruction first
+void trace_dump(const trace_t *trace, FILE *out) {
+    const size_t start = (trace->ring_head + TRACE_RING_SIZE - trace->ring_count) % TRACE_RING_SIZE;
+
+    for(size_t i = 0; i < trace->ring_count; i++) write_entry(&trace->ring[(start + i) % TRACE_RING_SIZE], &trace->symbols, out);
+}
+
+bool trace_parse_range(trace_t *trace, const char *range) {
+    char *sep;
+    char *end = NULL;
+    const unsigned long min = strtoul(range, &sep, 16);
+    const unsigned long max = *sep == '-' ? strtoul(sep + 1, &end, 16) : 0;
+
+    if(sep == range || *sep != '-' || end == sep + 1 || *end != '\0' || min > max || max > 0xFFFF) {
+        fprintf(stderr, "Invalid trace range %s, expected <start>-<end> in hex, e.g. 200-2FF\n", range);
+        return false;
+    }
+
+    trace->min_addr = min;
+    trace->max_addr = max;
+    return true;
+}
+
+bool trace_parse_classes(trace_t *trace, const char *classes) {
+    uint16_t mask = 0;
+
+    for(const char *c = classes; *c; c++) {
+        if(*c == ',') continue;
+
+        if(!isxdigit((unsigned char)*c)) {
+            fprintf(stderr, "Invalid opcode class list %s, expected hex digits, e.g. 8,D\n", classes);
+            return false;
+        }
+
+        const int digit = isdigit((unsigned char)*c) ? *c - '0' : toupper((unsigned char)*c) - 'A' + 10;
+        mask |= 1 << digit;
+    }
+
+    if(mask == 0) {
+        fprintf(stderr, "Empty opcode class list\n");
+        return false;
+    }
+
+    trace->op_classes = mask;
+    return true;
+}
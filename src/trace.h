@@ -0,0 +1,53 @@
+#ifndef TRACE_H
+#define TRACE_H
+
+#include <stdio.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "symbols.h"
+
+// Instructions kept for the dump when a ROM faults
+#define TRACE_RING_SIZE 1000
+
+// Machine state around one executed instruction
+typedef struct {
+    uint16_t pc;
+    uint16_t opcode;
+    uint16_t next;          // Following word, for XO-CHIP F000 NNNN
+    uint8_t V_before[16];
+    uint8_t V_after[16];
+    uint16_t I_before;
+    uint16_t I_after;
+    uint8_t sp_before;      // Stack depth
+    uint8_t sp_after;
+    uint8_t delay_before;
+    uint8_t delay_after;
+    uint8_t sound_before;
+    uint8_t sound_after;
+} trace_entry_t;
+
+// Execution trace, every instruction goes into the ring, the ones matching the filters are also logged
+typedef struct {
+    FILE *out;              // Log output, NULL to only keep the ring
+    uint16_t min_addr;      // Only log instructions at min_addr - max_addr
+    uint16_t max_addr;
+    uint16_t op_classes;    // Only log opcodes whose top nibble has its bit set here
+    trace_entry_t ring[TRACE_RING_SIZE];
+    size_t ring_head;       // Slot for the next entry
+    size_t ring_count;
+    uint64_t count;         // Instructions executed
+    symbols_t symbols;      // Addresses and targets are logged by name when there are any, freed by the owner
+} trace_t;
+
+void trace_init(trace_t *trace, FILE *out);
+bool trace_step(trace_t *trace, chip8_t *chip8);
+void trace_dump(const trace_t *trace, FILE *out);
+
+// Filter parsing for "<start>-<end>" hex address ranges and opcode class lists like "8,D" or "8D"
+bool trace_parse_range(trace_t *trace, const char *range);
+bool trace_parse_classes(trace_t *trace, const char *classes);
+
+#endif // TRACE_H
@@ -0,0 +1,524 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <signal.h>
+#include <poll.h>
+#include <termios.h>
+#include <unistd.h>
+
+#include "debugger.h"
+#include "disasm.h"
+
+// Pane sizes in terminal lines
+#define DISASM_LINES 20
+#define MEMORY_LINES 8
+#define PANE_LINES   DISASM_LINES
+
+// Memory pane lines have room for highlighting every byte
+#define MEMORY_LINE_SIZE 256
+
+// Below the memory pane: the sprite at I, two rows per line, and the BCD digits at I
+#define SPRITE_TOP       (MEMORY_LINES + 1)
+#define SPRITE_ROWS      15
+
+// Frames a keypad key stays pressed after a key press, terminals don't report key releases
+#define KEY_HOLD_FRAMES 6
+
+// Frames (or steps) the memory pane highlights a byte after the ROM wrote it
+#define WRITE_HIGHLIGHT_FRAMES 30
+
+// ANSI escape sequences
+#define ANSI_ALT_SCREEN_ON  "\x1b[?1049h"
+#define ANSI_ALT_SCREEN_OFF "\x1b[?1049l"
+#define ANSI_CURSOR_HIDE    "\x1b[?25l"
+#define ANSI_CURSOR_SHOW    "\x1b[?25h"
+#define ANSI_HOME           "\x1b[H"
+#define ANSI_CLEAR          "\x1b[2J"
+#define ANSI_CLEAR_EOL      "\x1b[K"
+#define ANSI_REVERSE        "\x1b[7m"
+#define ANSI_HIGHLIGHT      "\x1b[1;33m"
+#define ANSI_RESET          "\x1b[0m"
+
+#define TUI_RESTORE ANSI_RESET ANSI_CURSOR_SHOW ANSI_ALT_SCREEN_OFF
+
+// TUI session state
+typedef struct {
+    debugger_t dbg;
+    bool running;               // Executing instructions, otherwise paused
+    uint16_t mem_addr;          // First address of the memory pane
+    int stop_depth;             // Pause once the call depth is down to this, -1 when not stepping over or out
+    bool mem_follow_i;          // Memory pane tracks the I register
+    bool editing;               // Keys edit memory at edit_addr instead of pressing keypad keys
+    uint16_t edit_addr;         // Memory editor cursor
+    bool edit_low;              // The next hex digit typed is the low nibble
+    uint8_t escape;             // Position in an arrow key escape sequence
+    uint32_t frame;             // Frames run, for write highlighting
+    uint32_t *written;          // Frame each address was last written by the ROM, may be NULL
+    uint8_t key_frames[16];     // Frames left until a keypad key is released
+    uint32_t width;             // Resolution of the last drawn frame
+    char status[80];            // Message shown in the status line
+} tui_t;
+
+static struct termios saved_termios;
+
+static void tui_restore_on_signal(int sig) {
+    // Only async-signal-safe calls here
+    tcsetattr(STDIN_FILENO, TCSANOW, &saved_termios);
+    (void)!write(STDOUT_FILENO, TUI_RESTORE, sizeof TUI_RESTORE - 1);
+    _exit(128 + sig);
+}
+
+static bool tui_init(void) {
+    if(!isatty(STDIN_FILENO) || !isatty(STDOUT_FILENO)) {
+        fprintf(stderr, "TUI debugger requires a terminal\n");
+        return false;
+    }
+
+    if(tcgetattr(STDIN_FILENO, &saved_termios) != 0) {
+        perror("tcgetattr");
+        return false;
+    }
+
+    // Raw mode, read single key presses without echo
+    struct termios raw = saved_termios;
+    raw.c_lflag &= ~(ICANON | ECHO);
+    raw.c_cc[VMIN] = 0;
+    raw.c_cc[VTIME] = 0;
+    tcsetattr(STDIN_FILENO, TCSANOW, &raw);
+
+    signal(SIGINT, tui_restore_on_signal);
+    signal(SIGTERM, tui_restore_on_signal);
+
+    fputs(ANSI_ALT_SCREEN_ON ANSI_CURSOR_HIDE ANSI_CLEAR, stdout);
+    fflush(stdout);
+
+    return true;
+}
+
+static void tui_cleanup(void) {
+    fputs(TUI_RESTORE, stdout);
+    fflush(stdout);
+
+    tcsetattr(STDIN_FILENO, TCSANOW, &saved_termios);
+    signal(SIGINT, SIG_DFL);
+    signal(SIGTERM, SIG_DFL);
+}
+
+static uint16_t read_word(const chip8_t *chip8, uint32_t addr) {
+    return (chip8->ram[addr % chip8->ram_size] << 8) | chip8->ram[(addr + 1) % chip8->ram_size];
+}
+
+// Disassembly around PC, instructions can't be decoded backwards so start a few words before PC
+static void disasm_pane(const tui_t *tui, const chip8_t *chip8, char lines[][64]) {
+    uint32_t addr = chip8->PC >= 8 * 2 ? chip8->PC - 8 * 2 : 0;
+
+    for(int i = 0; i < DISASM_LINES; i++) {
+        char mnemonic[44];
+        const uint16_t opcode = read_word(chip8, addr);
+        const uint8_t len = disasm_instruction_named(opcode, read_word(chip8, addr + 2), DISASM_RAW, NULL,
+                                                     &tui->dbg.symbols, mnemonic, sizeof mnemonic);
+
+        snprintf(lines[i], 64, "%c%c %04X  %04X  %s",
+                 addr == chip8->PC ? '>' : ' ',
+                 debugger_is_breakpoint(&tui->dbg, addr) ? '*' : ' ',
+                 addr % chip8->ram_size, opcode, mnemonic);
+
+        addr += len;
+    }
+}
+
+// Registers, timers and the call stack
+static void register_pane(const chip8_t *chip8, char lines[][64]) {
+    int line = 0;
+
+    snprintf(lines[line++], 64, "PC 0x%04X   I  0x%04X", chip8->PC, chip8->I);
+    snprintf(lines[line++], 64, "DT %-6u   ST %u", chip8->delay_timer, chip8->sound_timer);
+    line++;
+
+    for(int row = 0; row < 4; row++) {
+        snprintf(lines[line++], 64, "V%X %02X  V%X %02X  V%X %02X  V%X %02X",
+                 row * 4, chip8->V[row * 4], row * 4 + 1, chip8->V[row * 4 + 1],
+                 row * 4 + 2, chip8->V[row * 4 + 2], row * 4 + 3, chip8->V[row * 4 + 3]);
+    }
+    line++;
+
+    const size_t depth = chip8->stack_ptr - chip8->stack;
+    snprintf(lines[line++], 64, "Stack (%zu)", depth);
+
+    // Innermost return address first, as many as fit in the pane
+    for(size_t i = depth; i > 0 && line < PANE_LINES; i--)
+        snprintf(lines[line++], 64, "  0x%04X", chip8->stack[i - 1]);
+}
+
+// Records ROM writes for the memory pane, the TUI has the memory hooks to itself
+static uint8_t tui_write_hook(void *userdata, uint16_t addr, uint8_t value) {
+    tui_t *tui = userdata;
+    tui->written[addr] = tui->frame;
+    return value;
+}
+
+// Hex dump with recent writes highlighted and the editor cursor in reverse video
+static void memory_pane(const tui_t *tui, const chip8_t *chip8, char lines[][MEMORY_LINE_SIZE]) {
+    for(int row = 0; row < MEMORY_LINES; row++) {
+        const uint32_t addr = (tui->mem_addr + row * 16) % chip8->ram_size;
+        int len = snprintf(lines[row], MEMORY_LINE_SIZE, "%04X:", addr);
+
+        for(uint32_t i = 0; i < 16 && len < MEMORY_LINE_SIZE; i++) {
+            const uint32_t byte_addr = (addr + i) % chip8->ram_size;
+            const bool cursor = tui->editing && byte_addr == tui->edit_addr;
+            const bool recent = tui->written && tui->written[byte_addr] &&
+                                tui->frame - tui->written[byte_addr] < WRITE_HIGHLIGHT_FRAMES;
+
+            len += snprintf(&lines[row][len], MEMORY_LINE_SIZE - len, " %s%02X%s",
+                            cursor ? ANSI_REVERSE : recent ? ANSI_HIGHLIGHT : "", chip8->ram[byte_addr],
+                            cursor || recent ? ANSI_RESET : "");
+        }
+    }
+}
+
+// What a DXYN would draw from I, most drawing bugs are I pointing somewhere else than the ROM meant
+static void sprite_pane(const chip8_t *chip8, char lines[][MEMORY_LINE_SIZE]) {
+    debugger_sprite_t sprite;
+    debugger_sprite(chip8, SPRITE_ROWS, &sprite);
+
+    int line = SPRITE_TOP;
+    snprintf(lines[line++], MEMORY_LINE_SIZE, "Sprite at 0x%04X, %ux%u%s", sprite.addr, sprite.width, sprite.rows,
+             sprite.at_draw ? " for the DXYN at PC" : "");
+
+    for(uint32_t row = 0; row < sprite.rows; row += 2) {
+        const bool pair = row + 1 < sprite.rows;
+        int len = snprintf(lines[line], MEMORY_LINE_SIZE, "  ");
+
+        for(int bit = sprite.width - 1; bit >= 0; bit--) {
+            const bool top = sprite.bits[row] >> bit & 1;
+            const bool bottom = pair && (sprite.bits[row + 1] >> bit & 1);
+            len += snprintf(&lines[line][len], MEMORY_LINE_SIZE - len, "%s",
+                            top && bottom ? "█" : top ? "▀" : bottom ? "▄" : "·");
+        }
+
+        const int digits = sprite.width / 4;
+        len += snprintf(&lines[line][len], MEMORY_LINE_SIZE - len, "  %0*X", digits, sprite.bits[row]);
+        if(pair) snprintf(&lines[line][len], MEMORY_LINE_SIZE - len, " %0*X", digits, sprite.bits[row + 1]);
+        line++;
+    }
+
+    char bcd[32];
+    debugger_describe_bcd(chip8, bcd, sizeof bcd);
+    snprintf(lines[PANE_LINES - 1], MEMORY_LINE_SIZE, "BCD at I: %s", bcd);
+}
+
+// Framebuffer with 2 pixels per terminal cell using half-block characters
+static void draw_screen(FILE *out, const chip8_t *chip8) {
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t height = chip8_display_height(chip8);
+
+    for(uint32_t y = 0; y < height; y += 2) {
+        for(uint32_t x = 0; x < width; x++) {
+            const bool top = chip8_pixel(chip8, x, y);
+            const bool bottom = chip8_pixel(chip8, x, y + 1);
+
+            fputs(top && bottom ? "█" : top ? "▀" : bottom ? "▄" : " ", out);
+        }
+
+        fputs(ANSI_CLEAR_EOL "\n", out);
+    }
+}
+
+static void tui_draw(tui_t *tui, const chip8_t *chip8) {
+    char disasm[PANE_LINES][64] = {{0}};
+    char regs[PANE_LINES][64] = {{0}};
+    char mem[PANE_LINES][MEMORY_LINE_SIZE] = {{0}};
+
+    if(tui->mem_follow_i && !tui->editing) tui->mem_addr = chip8->I & ~0xF;
+
+    disasm_pane(tui, chip8, disasm);
+    register_pane(chip8, regs);
+    memory_pane(tui, chip8, mem);
+    sprite_pane(chip8, mem);
+
+    // Build the whole frame in memory and write it in one go to avoid flicker
+    char *frame = NULL;
+    size_t frame_len = 0;
+    FILE *out = open_memstream(&frame, &frame_len);
+    if(!out) return;
+
+    // Start over on resolution changes, the panes below the screen move
+    if(tui->width != chip8_display_width(chip8)) fputs(ANSI_CLEAR, out);
+    tui->width = chip8_display_width(chip8);
+
+    fputs(ANSI_HOME, out);
+    draw_screen(out, chip8);
+
+    fprintf(out, ANSI_REVERSE "%-32s%-28s%-56s" ANSI_RESET ANSI_CLEAR_EOL "\n",
+            " Disassembly", "Registers",
+            tui->editing ? "Memory (editing)" : tui->mem_follow_i ? "Memory (follows I)" : "Memory");
+
+    for(int i = 0; i < PANE_LINES; i++)
+        fprintf(out, "%-32s%-28s%s" ANSI_CLEAR_EOL "\n", disasm[i], regs[i], mem[i]);
+
+    fprintf(out, ANSI_REVERSE " %-8s %-40s" ANSI_RESET ANSI_CLEAR_EOL "\n",
+            tui->running ? "RUNNING" : "PAUSED", tui->status);
+    if(tui->editing) {
+        fputs("arrows/hjkl move  0-9 a-f type hex  [ ] page  e or esc stop editing  q quit" ANSI_CLEAR_EOL, out);
+    } else {
+        fputs("space run/pause  n step  o step over  u step out  p toggle breakpoint at PC  [ ] memory  i follow I  e edit memory  "
+              "0-9 a-f keypad  q quit" ANSI_CLEAR_EOL, out);
+    }
+
+    fclose(out);
+    fwrite(frame, 1, frame_len, stdout);
+    fflush(stdout);
+    free(frame);
+}
+
+// Pause at a fault, the faulting instruction stays at PC
+static void tui_check_fault(tui_t *tui, chip8_t *chip8) {
+    if(chip8->fault == CHIP8_FAULT_NONE) return;
+
+    tui->running = false;
+    snprintf(tui->status, sizeof tui->status, "Fault: %s at 0x%04X", chip8_fault_name(chip8->fault), chip8->PC);
+    chip8_clear_fault(chip8);
+}
+
+// Move the editor cursor, scrolling the memory pane to keep it visible
+static void tui_move_cursor(tui_t *tui, const chip8_t *chip8, int offset) {
+    tui->edit_addr = (tui->edit_addr + chip8->ram_size + offset) % chip8->ram_size;
+    tui->edit_low = false;
+
+    const uint16_t row = tui->edit_addr & ~0xF;
+    if((uint16_t)(row - tui->mem_addr) >= MEMORY_LINES * 16) {
+        tui->mem_addr = offset < 0 ? row : (uint16_t)(row - (MEMORY_LINES - 1) * 16);
+    }
+}
+
+static void tui_stop_editing(tui_t *tui) {
+    tui->editing = false;
+    tui->escape = 0;
+}
+
+// Handle a key press in the memory editor, returns false if the key isn't an editor key
+static bool tui_edit_key(tui_t *tui, chip8_t *chip8, char key) {
+    // Arrow keys arrive as ESC [ A-D, a lone ESC stops editing
+    if(tui->escape == 1) {
+        tui->escape = key == '[' ? 2 : 0;
+        if(tui->escape) return true;
+
+        tui_stop_editing(tui);
+        return false;
+    }
+
+    if(tui->escape == 2) {
+        tui->escape = 0;
+        key = key == 'A' ? 'k' : key == 'B' ? 'j' : key == 'C' ? 'l' : key == 'D' ? 'h' : '\0';
+    }
+
+    int nibble = -1;
+    if(key >= '0' && key <= '9') nibble = key - '0';
+    if(key >= 'a' && key <= 'f') nibble = key - 'a' + 10;
+    if(key >= 'A' && key <= 'F') nibble = key - 'A' + 10;
+
+    if(nibble >= 0) {
+        // Typed bytes go through chip8_poke so decoded instructions see them
+        const uint8_t old = chip8->ram[tui->edit_addr];
+        const uint8_t value = tui->edit_low ? (old & 0xF0) | nibble : (old & 0x0F) | (nibble << 4);
+        chip8_poke(chip8, tui->edit_addr, value);
+
+        if(tui->edit_low) {
+            tui_move_cursor(tui, chip8, 1);
+        } else {
+            tui->edit_low = true;
+        }
+        return true;
+    }
+
+    switch(key) {
+        case '\x1b': tui->escape = 1; return true;
+        case 'e':    tui_stop_editing(tui); return true;
+        case 'h':    tui_move_cursor(tui, chip8, -1); return true;
+        case 'l':    tui_move_cursor(tui, chip8, 1); return true;
+        case 'k':    tui_move_cursor(tui, chip8, -16); return true;
+        case 'j':    tui_move_cursor(tui, chip8, 16); return true;
+        case '[':    tui_move_cursor(tui, chip8, -MEMORY_LINES * 16); return true;
+        case ']':    tui_move_cursor(tui, chip8, MEMORY_LINES * 16); return true;
+        case '\0':   return true;
+        default:     return false;
+    }
+}
+
+static void tui_step(tui_t *tui, chip8_t *chip8) {
+    tui->running = false;
+    tui->stop_depth = -1;
+    tui->frame++;
+    debugger_step(&tui->dbg, chip8);
+    tui_check_fault(tui, chip8);
+}
+
+// Handle a key press, returns false to quit
+static bool tui_key(tui_t *tui, chip8_t *chip8, char key) {
+    tui->status[0] = '\0';
+
+    if(tui->editing && tui_edit_key(tui, chip8, key)) return true;
+
+    switch(key) {
+        case 'q':
+            return false;
+
+        case ' ':
+            tui->running = !tui->running;
+            tui->stop_depth = -1;
+            if(tui->running) tui_stop_editing(tui);
+            break;
+
+        case 'n':
+            tui_step(tui, chip8);
+            break;
+
+        case 'o':
+            // Runs over 2NNN calls until they return, anything else is a single step
+            if(debugger_at_call(chip8)) {
+                tui->stop_depth = debugger_call_depth(chip8);
+                tui->running = true;
+            } else {
+                tui_step(tui, chip8);
+            }
+            break;
+
+        case 'u':
+            if(debugger_call_depth(chip8) == 0) {
+                snprintf(tui->status, sizeof tui->status, "Not in a subroutine");
+                break;
+            }
+            tui->stop_depth = debugger_call_depth(chip8) - 1;
+            tui->running = true;
+            break;
+
+        case 'p':
+            if(debugger_delete_breakpoint(&tui->dbg, chip8->PC)) {
+                snprintf(tui->status, sizeof tui->status, "Breakpoint at 0x%04X deleted", chip8->PC);
+            } else if(debugger_add_breakpoint(&tui->dbg, chip8->PC)) {
+                snprintf(tui->status, sizeof tui->status, "Breakpoint set at 0x%04X", chip8->PC);
+            } else {
+                snprintf(tui->status, sizeof tui->status, "Too many breakpoints");
+            }
+            break;
+
+        case '[':
+            tui->mem_follow_i = false;
+            tui->mem_addr -= MEMORY_LINES * 16;
+            break;
+
+        case ']':
+            tui->mem_follow_i = false;
+            tui->mem_addr += MEMORY_LINES * 16;
+            break;
+
+        case 'i':
+            tui->mem_follow_i = true;
+            break;
+
+        case 'e':
+            // Memory is only edited while paused, the cursor starts at the top of the pane
+            tui->running = false;
+            tui->editing = true;
+            tui->mem_follow_i = false;
+            tui->mem_addr %= chip8->ram_size;
+            tui->edit_addr = tui->mem_addr;
+            tui->edit_low = false;
+            break;
+
+        default:
+            // Hex digits press the CHIP8 keypad key for a few frames
+            if(key >= '0' && key <= '9') {
+                tui->key_frames[key - '0'] = KEY_HOLD_FRAMES;
+                chip8_set_key(chip8, key - '0', true);
+            } else if(key >= 'a' && key <= 'f') {
+                tui->key_frames[key - 'a' + 10] = KEY_HOLD_FRAMES;
+                chip8_set_key(chip8, key - 'a' + 10, true);
+            }
+            break;
+    }
+
+    return true;
+}
+
+// Run one 60Hz frame worth of instructions, stopping at breakpoints and faults
+static void tui_run_frame(tui_t *tui, chip8_t *chip8) {
+    tui->frame++;
+
+    for(uint32_t i = 0; i < tui->dbg.steps_per_frame; i++) {
+        if(!debugger_step(&tui->dbg, chip8)) {
+            tui_check_fault(tui, chip8);
+            return;
+        }
+
+        if(debugger_should_break(&tui->dbg, chip8)) {
+            tui->running = false;
+            snprintf(tui->status, sizeof tui->status, "Breakpoint at 0x%04X", chip8->PC);
+            return;
+        }
+
+        if(tui->stop_depth >= 0 && debugger_call_depth(chip8) <= (size_t)tui->stop_depth) {
+            tui->running = false;
+            tui->stop_depth = -1;
+            return;
+        }
+    }
+}
+
+bool debugger_tui(chip8_t *chip8, const config_t *config) {
+    tui_t tui = {
+        .stop_depth = -1,
+        .mem_follow_i = true,
+        .frame = 1,
+        .width = chip8_display_width(chip8),
+    };
+
+    debugger_init(&tui.dbg, config);
+
+    if(!tui_init()) {
+        debugger_free(&tui.dbg);
+        return false;
+    }
+
+    // Without the memory the pane just doesn't highlight writes
+    tui.written = calloc(CHIP8_XO_RAM_SIZE, sizeof *tui.written);
+    if(tui.written) chip8_set_memory_hooks(chip8, NULL, tui_write_hook, &tui);
+
+    tui_check_fault(&tui, chip8);
+
+    bool quit = false;
+    while(!quit && chip8->state != QUIT) {
+        if(tui.running) tui_run_frame(&tui, chip8);
+
+        // Release keypad keys that were held long enough
+        for(uint8_t key = 0; key < 16; key++)
+            if(tui.key_frames[key] > 0 && --tui.key_frames[key] == 0) chip8_set_key(chip8, key, false);
+
+        tui_draw(&tui, chip8);
+
+        // Wait for input until the next frame is due
+        struct pollfd pfd = {.fd = STDIN_FILENO, .events = POLLIN};
+        if(poll(&pfd, 1, 16) > 0) {
+            char keys[16];
+            const ssize_t count = read(STDIN_FILENO, keys, sizeof keys);
+
+            for(ssize_t i = 0; i < count && !quit; i++)
+                quit = !tui_key(&tui, chip8, keys[i]);
+
+            if(tui.escape == 1) tui_stop_editing(&tui);
+        }
+    }
+
+    tui_cleanup();
+
+    chip8_set_memory_hooks(chip8, NULL, NULL, NULL);
+    free(tui.written);
+    debugger_free(&tui.dbg);
+
+    if(chip8->state == QUIT) puts("Program exited");
+    return true;
+}
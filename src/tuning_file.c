@@ -0,0 +1,134 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <stdlib.h>
+#include <stddef.h>
+
+#include "tuning_file.h"
+#include "datadir.h"
+
+#define LINE_SIZE 256
+
+bool tuning_file_default_path(char *path, size_t size) {
+    return datadir_path("tuning", path, size);
+}
+
+// "shift,vf_reset" turns those two on and the others off, "" turns all of them off
+static bool parse_quirks(char *names, quirks_t *quirks) {
+    *quirks = (quirks_t) {0};
+
+    char *save = NULL;
+    for(char *name = strtok_r(names, ",", &save); name; name = strtok_r(NULL, ",", &save))
+        if(!chip8_set_quirk(quirks, name, true)) return false;
+
+    return true;
+}
+
+static bool parse_colors(const char *text, uint32_t colors[4]) {
+    char *end;
+
+    for(int i = 0; i < 4; i++) {
+        colors[i] = (uint32_t)strtoul(text, &end, 16);
+        if(end - text != 8 || (i < 3 && *end != ',') || (i == 3 && *end)) return false;
+        text = end + 1;
+    }
+
+    return true;
+}
+
+bool tuning_parse_deflicker(const char *text, uint32_t *frames, bool *average) {
+    if(strcmp(text, "off") == 0) {
+        *frames = 1;
+        *average = false;
+        return true;
+    }
+
+    const char *colon = strchr(text, ':');
+    const size_t len = colon ? (size_t)(colon - text) : strlen(text);
+    if(len == 2 && strncmp(text, "or", len) == 0) {
+        *average = false;
+    } else if(len == 7 && strncmp(text, "average", len) == 0) {
+        *average = true;
+    } else {
+        return false;
+    }
+
+    *frames = 2;
+    if(colon) {
+        char *end;
+        const unsigned long count = strtoul(colon + 1, &end, 10);
+        if(*end || end == colon + 1 || count < 2 || count > TUNING_DEFLICKER_MAX_FRAMES) return false;
+        *frames = (uint32_t)count;
+    }
+
+    return true;
+}
+
+bool tuning_file_load(const char *path, const char *sha1, tuning_t *tuning) {
+    char line[LINE_SIZE];
+    if(!datadir_find_line(path, sha1, line, sizeof line)) return false;
+
+    // All or nothing, like the RPL flags
+    tuning_t loaded = {0};
+    char *save = NULL;
+    for(char *part = strtok_r(line, " ", &save); part; part = strtok_r(NULL, " ", &save)) {
+        char *value = strchr(part, '=');
+        if(!value) return false;
+        *value++ = '\0';
+
+        char *end;
+        if(strcmp(part, "speed") == 0) {
+            loaded.has_speed = true;
+            loaded.insts_per_second = (uint32_t)strtoul(value, &end, 10);
+            if(*end || end == value || loaded.insts_per_second < 60) return false;
+        } else if(strcmp(part, "quirks") == 0) {
+            loaded.has_quirks = true;
+            if(!parse_quirks(value, &loaded.quirks)) return false;
+        } else if(strcmp(part, "colors") == 0) {
+            loaded.has_colors = true;
+            if(!parse_colors(value, loaded.colors)) return false;
+        } else if(strcmp(part, "deflicker") == 0) {
+            loaded.has_deflicker = true;
+            if(!tuning_parse_deflicker(value, &loaded.deflicker_frames, &loaded.deflicker_average)) return false;
+        } else {
+            return false;
+        }
+    }
+
+    *tuning = loaded;
+    return true;
+}
+
+bool tuning_file_save(const char *path, const char *sha1, const tuning_t *tuning) {
+    char line[LINE_SIZE] = "";
+    size_t len = 0;
+
+    if(tuning->has_speed)
+        len += snprintf(&line[len], sizeof line - len, " speed=%u", tuning->insts_per_second);
+
+    if(tuning->has_quirks) {
+        len += snprintf(&line[len], sizeof line - len, " quirks=");
+        bool first = true;
+        for(size_t i = 0; chip8_quirk_name(i); i++) {
+            if(!chip8_quirk_enabled(&tuning->quirks, i)) continue;
+
+            len += snprintf(&line[len], sizeof line - len, "%s%s", first ? "" : ",", chip8_quirk_name(i));
+            first = false;
+        }
+    }
+
+    if(tuning->has_colors)
+        len += snprintf(&line[len], sizeof line - len, " colors=%08X,%08X,%08X,%08X", tuning->colors[0],
+                        tuning->colors[1], tuning->colors[2], tuning->colors[3]);
+
+    if(tuning->has_deflicker && tuning->deflicker_frames < 2)
+        len += snprintf(&line[len], sizeof line - len, " deflicker=off");
+    else if(tuning->has_deflicker)
+        len += snprintf(&line[len], sizeof line - len, " deflicker=%s:%u",
+                        tuning->deflicker_average ? "average" : "or", tuning->deflicker_frames);
+
+    return datadir_replace_line(path, sha1, len ? line + 1 : NULL);
+}
@@ -0,0 +1,42 @@
+#ifndef TUNING_FILE_H
+#define TUNING_FILE_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+// Most frames --deflicker blends together
+#define TUNING_DEFLICKER_MAX_FRAMES 3
+
+// Speed, quirks, colors and frame blending given for a ROM on the command line, used again on its next runs
+// One line per ROM by SHA-1 like the RPL flags, each part is optional:
+//   "<sha1> speed=<n> quirks=<names of the quirks that are on> colors=<fg>,<bg>,<plane2>,<blend>
+//    deflicker=<off|or:<frames>|average:<frames>>"
+// Default location is $XDG_DATA_HOME/chip8/tuning or ~/.local/share/chip8/tuning
+typedef struct {
+    bool has_speed;
+    uint32_t insts_per_second;
+    bool has_quirks;
+    quirks_t quirks;
+    bool has_colors;
+    uint32_t colors[4];     // Foreground, background, XO-CHIP plane 2 and blend as RRGGBBAA
+    bool has_deflicker;
+    uint32_t deflicker_frames; // 1 is off
+    bool deflicker_average;
+} tuning_t;
+
+bool tuning_file_default_path(char *path, size_t size);
+
+// --deflicker's "off", "or" or "average", with an optional ":<frames>" from 2 to TUNING_DEFLICKER_MAX_FRAMES
+// ("or" is 2 frames). The tuning file keeps it the same way
+bool tuning_parse_deflicker(const char *text, uint32_t *frames, bool *average);
+
+// Returns false and leaves tuning alone if there's nothing for the ROM or its line is damaged
+bool tuning_file_load(const char *path, const char *sha1, tuning_t *tuning);
+
+// Replace or add the line for the ROM, with nothing to keep it's removed
+bool tuning_file_save(const char *path, const char *sha1, const tuning_t *tuning);
+
+#endif // TUNING_FILE_H
@@ -0,0 +1,38 @@
+#include <stdio.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "volume_file.h"
+#include "datadir.h"
+
+bool volume_file_default_path(char *path, size_t size) {
+    return datadir_path("volume", path, size);
+}
+
+bool volume_file_load(const char *path, int16_t *volume, bool *muted) {
+    FILE *file = fopen(path, "r");
+    if(!file) return false;
+
+    int loaded_volume, loaded_muted;
+    const bool found = fscanf(file, "%d %d", &loaded_volume, &loaded_muted) == 2 &&
+                       loaded_volume >= 0 && loaded_volume <= INT16_MAX;
+    fclose(file);
+
+    if(found) {
+        *volume = (int16_t)loaded_volume;
+        *muted = loaded_muted != 0;
+    }
+    return found;
+}
+
+bool volume_file_save(const char *path, int16_t volume, bool muted) {
+    if(!datadir_make_parents(path)) return false;
+
+    FILE *out = fopen(path, "w");
+    if(!out) return false;
+
+    fprintf(out, "%d %d\n", volume, muted ? 1 : 0);
+
+    const bool written = !ferror(out);
+    return fclose(out) == 0 && written;
+}
@@ -0,0 +1,18 @@
+#ifndef VOLUME_FILE_H
+#define VOLUME_FILE_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+// Buzzer volume set with the hotkeys, kept for the next run as one line: "<volume> <muted 0|1>"
+// Default location is $XDG_DATA_HOME/chip8/volume or ~/.local/share/chip8/volume
+bool volume_file_default_path(char *path, size_t size);
+
+// Returns false and leaves volume and muted alone if there's no file or it's damaged
+bool volume_file_load(const char *path, int16_t *volume, bool *muted);
+
+// Missing directories on the way to path are created
+bool volume_file_save(const char *path, int16_t volume, bool muted);
+
+#endif // VOLUME_FILE_H
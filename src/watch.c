@@ -0,0 +1,51 @@
+#define _POSIX_C_SOURCE 200809L
+
+#include <stdio.h>
+#include <string.h>
+#include <strings.h>
+#include <sys/stat.h>
+
+#include "watch.h"
+#include "romload.h"
+
+// Read the file's stamp into watch, true if it differs from the one there before
+static bool update(watch_t *watch) {
+    struct stat info;
+    const bool exists = stat(watch->path, &info) == 0;
+    const int64_t mtime_ns = exists ? (int64_t)info.st_mtim.tv_sec * 1000000000 + info.st_mtim.tv_nsec : 0;
+    const int64_t size = exists ? (int64_t)info.st_size : 0;
+    const uint64_t inode = exists ? (uint64_t)info.st_ino : 0;
+
+    const bool changed = exists != watch->exists || mtime_ns != watch->mtime_ns || size != watch->size ||
+                         inode != watch->inode;
+    watch->exists = exists;
+    watch->mtime_ns = mtime_ns;
+    watch->size = size;
+    watch->inode = inode;
+    return changed;
+}
+
+bool watch_init(watch_t *watch, const char *source) {
+    memset(watch, 0, sizeof *watch);
+    if(romload_is_stdin(source) || romload_is_url(source)) return false;
+
+    // The archive changes when an entry in it does
+    snprintf(watch->path, sizeof watch->path, "%s", source);
+    char *colon = strrchr(watch->path, ':');
+    if(colon && colon - watch->path >= 4 && strncasecmp(colon - 4, ".zip", 4) == 0) *colon = '\0';
+
+    update(watch);
+    return watch->exists;
+}
+
+bool watch_poll(watch_t *watch) {
+    // A file that's gone is being replaced, wait for it to come back
+    if(update(watch)) {
+        watch->pending = true;
+        return false;
+    }
+
+    const bool finished = watch->pending && watch->exists;
+    if(finished) watch->pending = false;
+    return finished;
+}
@@ -0,0 +1,26 @@
+#ifndef WATCH_H
+#define WATCH_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <stdio.h>
+
+// --watch, notices when the ROM file is saved again by checking its size and modification time
+// Editors write files in pieces, a change is only reported once a check finds it finished
+typedef struct {
+    char path[FILENAME_MAX];    // The file, or the archive for "<archive>.zip:<name>"
+    bool exists;
+    int64_t mtime_ns;
+    int64_t size;
+    uint64_t inode;             // Editors that save to a new file and rename it change only this
+    bool pending;               // Changed at the last check
+} watch_t;
+
+// False for ROMs that don't come from a file, like stdin and downloads
+bool watch_init(watch_t *watch, const char *source);
+
+// Check the file again, true when it changed and has stayed the same since the last check
+bool watch_poll(watch_t *watch);
+
+#endif // WATCH_H
@@ -0,0 +1,700 @@
+#define _POSIX_C_SOURCE 200809L
+
+// Browser frontend: a small HTTP server with one page and a WebSocket the page connects to
+//
+// GET / serves the page, GET /ws upgrades to a WebSocket carrying
+//   server -> page  text {"rom": name, "colors": [bg, fg, plane2, blend], "freq": Hz, "viewer": bool}
+//                   once after connecting, viewers only watch and get no keypad
+//                   text {"sound": true|false} when the tone starts or stops
+//                   text {"exited": true} when the ROM exits, then the socket is closed
+//                   binary screen updates: u8 width, u8 height, u8 first row, then one plane bitmask byte
+//                   per pixel of the rows from there on, row major. A width of 0 is 256, Mega-Chip frames
+//                   are sent in the plane 1 color only. Each update has one run of rows that changed,
+//                   the first one after connecting and after the resolution changed has all of them
+//   page -> server  text "d<key>" and "u<key>" to press and release hex keypad key 0-f
+// GET /metrics has counters for monitoring in the Prometheus text format: instructions and frames run,
+//   screen updates sent, faults, connected clients and connections
+// With --serve every viewer sees the same machine and can press keys, the ROM only runs while someone
+// is watching. With --broadcast the window session goes on as usual and viewers only watch it
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+#include <strings.h>
+#include <errno.h>
+#include <signal.h>
+#include <poll.h>
+#include <unistd.h>
+#include <sys/socket.h>
+
+#include "web_server.h"
+#include "net.h"
+#include "romdb.h"
+#include "log.h"
+
+#define WEB_MAX_CLIENTS 16
+#define WEB_MAX_INPUT   4096
+
+// Fixed by RFC 6455 for the handshake
+#define WEBSOCKET_GUID "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+typedef enum {
+    WS_CONTINUATION = 0x0,
+    WS_TEXT         = 0x1,
+    WS_BINARY       = 0x2,
+    WS_CLOSE        = 0x8,
+    WS_PING         = 0x9,
+    WS_PONG         = 0xA,
+} ws_opcode_t;
+
+typedef struct {
+    int fd;                 // -1 for a free slot
+    bool websocket;         // Upgraded, otherwise it's still sending its HTTP request
+    bool dirty[CHIP8_MEGA_HEIGHT]; // Rows changed since they were last sent to it
+    uint32_t width;         // Resolution it was last sent, 0 before the first update
+    uint32_t height;
+    uint16_t keys;          // Keypad keys held down from this client
+    char input[WEB_MAX_INPUT + 1];  // Room for a terminator to search HTTP requests with
+    size_t input_len;
+} web_client_t;
+
+struct web_server {
+    int listen_fd;
+    web_client_t clients[WEB_MAX_CLIENTS];
+    bool sound;             // Tone state last sent to the clients
+    bool read_only;         // Broadcasting, key presses from viewers are ignored
+    void (*old_sigpipe)(int);
+    uint64_t started;       // net_now_ms() when the server opened
+    uint64_t instructions;  // For /metrics, the window session's with --broadcast
+    uint64_t frames;
+    uint64_t screen_updates; // Binary screen messages sent
+    uint64_t faults;
+    uint64_t restarts;      // --serve-restart starting the ROM over after it exited or faulted
+    uint64_t connections;   // Accepted, and turned away with all slots taken
+    uint64_t rejected;
+};
+
+static const char page[] =
+    "<!DOCTYPE html>\n"
+    "<html><head><meta charset=\"utf-8\"><meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n"
+    "<title>CHIP8</title>\n"
+    "<style>\n"
+    "body { background: #202020; color: #c0c0c0; font-family: sans-serif; text-align: center; margin: 1em; }\n"
+    "canvas { width: 100%; max-width: 768px; image-rendering: pixelated; border: 1px solid #505050; }\n"
+    "#keys { display: grid; grid-template-columns: repeat(4, 4em); gap: 0.4em; justify-content: center; margin: 1em; }\n"
+    "#keys button { height: 3em; font-size: 1.2em; touch-action: none; }\n"
+    "</style></head><body>\n"
+    "<canvas id=\"screen\" width=\"64\" height=\"32\"></canvas>\n"
+    "<div id=\"status\">Connecting...</div>\n"
+    "<div id=\"keys\"></div>\n"
+    "<script>\n"
+    "// Keypad layout and the matching keys of a QWERTY keyboard\n"
+    "const layout = \"123C456D789EA0BF\", keyboard = \"1234qwerasdfzxcv\";\n"
+    "const canvas = document.getElementById(\"screen\"), ctx = canvas.getContext(\"2d\");\n"
+    "const status = document.getElementById(\"status\");\n"
+    "let colors = [[0, 0, 0], [255, 255, 255], [255, 255, 255], [255, 255, 255]], freq = 440;\n"
+    "let audio = null, gain = null, beeping = false, viewer = false, image = null;\n"
+    "\n"
+    "const ws = new WebSocket((location.protocol == \"https:\" ? \"wss://\" : \"ws://\") + location.host + \"/ws\");\n"
+    "ws.binaryType = \"arraybuffer\";\n"
+    "const send = (key, down) => { if(!viewer && ws.readyState == WebSocket.OPEN) ws.send((down ? \"d\" : \"u\") + key.toLowerCase()); };\n"
+    "\n"
+    "for(const key of layout) {\n"
+    "  const button = document.createElement(\"button\");\n"
+    "  button.textContent = key;\n"
+    "  button.onpointerdown = e => { button.setPointerCapture(e.pointerId); send(key, true); };\n"
+    "  button.onpointerup = button.onpointercancel = () => send(key, false);\n"
+    "  document.getElementById(\"keys\").appendChild(button);\n"
+    "}\n"
+    "\n"
+    "const held = {};\n"
+    "onkeydown = e => {\n"
+    "  const i = keyboard.indexOf(e.key.toLowerCase());\n"
+    "  if(i >= 0 && !held[i]) { held[i] = true; send(layout[i], true); }\n"
+    "};\n"
+    "onkeyup = e => {\n"
+    "  const i = keyboard.indexOf(e.key.toLowerCase());\n"
+    "  if(i >= 0) { held[i] = false; send(layout[i], false); }\n"
+    "};\n"
+    "\n"
+    "// Browsers only allow sound after the user did something on the page\n"
+    "function unlock() {\n"
+    "  if(audio) return;\n"
+    "  audio = new AudioContext();\n"
+    "  const osc = audio.createOscillator();\n"
+    "  osc.type = \"square\";\n"
+    "  osc.frequency.value = freq;\n"
+    "  gain = audio.createGain();\n"
+    "  gain.gain.value = beeping ? 0.1 : 0;\n"
+    "  osc.connect(gain).connect(audio.destination);\n"
+    "  osc.start();\n"
+    "}\n"
+    "addEventListener(\"pointerdown\", unlock);\n"
+    "addEventListener(\"keydown\", unlock);\n"
+    "\n"
+    "ws.onopen = () => status.textContent = \"Connected\";\n"
+    "ws.onclose = () => { if(status.textContent != \"The ROM exited\") status.textContent = \"Disconnected\"; };\n"
+    "ws.onmessage = e => {\n"
+    "  if(typeof e.data == \"string\") {\n"
+    "    const msg = JSON.parse(e.data);\n"
+    "    if(msg.rom !== undefined) {\n"
+    "      document.title = status.textContent = msg.rom;\n"
+    "      viewer = msg.viewer;\n"
+    "      if(viewer) { status.textContent = \"Watching \" + msg.rom; document.getElementById(\"keys\").hidden = true; }\n"
+    "      colors = msg.colors.map(c => [1, 3, 5].map(i => parseInt(c.substr(i, 2), 16)));\n"
+    "      freq = msg.freq;\n"
+    "    }\n"
+    "    if(msg.sound !== undefined) {\n"
+    "      beeping = msg.sound;\n"
+    "      if(gain) gain.gain.value = beeping ? 0.1 : 0;\n"
+    "    }\n"
+    "    if(msg.exited) status.textContent = \"The ROM exited\";\n"
+    "    return;\n"
+    "  }\n"
+    "\n"
+    "  // Only the rows that changed, the rest of the image stays as it was\n"
+    "  const data = new Uint8Array(e.data), width = data[0] || 256, height = data[1], start = data[2] * width;\n"
+    "  if(!image || canvas.width != width || canvas.height != height) {\n"
+    "    canvas.width = width;\n"
+    "    canvas.height = height;\n"
+    "    image = ctx.createImageData(width, height);\n"
+    "  }\n"
+    "  for(let i = 0; i < data.length - 3; i++) image.data.set([...colors[data[3 + i] & 3], 255], (start + i) * 4);\n"
+    "  ctx.putImageData(image, 0, 0);\n"
+    "};\n"
+    "</script>\n"
+    "</body></html>\n";
+
+static void base64_encode(const uint8_t *data, size_t size, char *out) {
+    const char *digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+
+    for(size_t i = 0; i < size; i += 3) {
+        const uint32_t n = data[i] << 16 | (i + 1 < size ? data[i + 1] << 8 : 0) | (i + 2 < size ? data[i + 2] : 0);
+        *out++ = digits[n >> 18];
+        *out++ = digits[(n >> 12) & 0x3F];
+        *out++ = i + 1 < size ? digits[(n >> 6) & 0x3F] : '=';
+        *out++ = i + 2 < size ? digits[n & 0x3F] : '=';
+    }
+
+    *out = '\0';
+}
+
+// Sec-WebSocket-Accept for a Sec-WebSocket-Key, base64 of the SHA-1 of the key and the GUID
+static void websocket_accept(const char *key, char out[29]) {
+    char joined[128];
+    char hex[ROMDB_SHA1_HEX_SIZE];
+    uint8_t digest[20];
+
+    const int len = snprintf(joined, sizeof joined, "%s" WEBSOCKET_GUID, key);
+    romdb_sha1((const uint8_t *)joined, len, hex);
+    for(int i = 0; i < 20; i++) {
+        const char byte[3] = {hex[i * 2], hex[i * 2 + 1], '\0'};
+        digest[i] = strtoul(byte, NULL, 16);
+    }
+
+    base64_encode(digest, sizeof digest, out);
+}
+
+// Release the keys a client held, a key stays down while any other client holds it
+static void apply_keys(web_server_t *server, chip8_t *chip8) {
+    uint16_t keys = 0;
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++)
+        if(server->clients[i].fd >= 0) keys |= server->clients[i].keys;
+
+    for(uint8_t key = 0; key < 16; key++) {
+        const bool pressed = keys & (1 << key);
+        if(chip8_key(chip8, key) != pressed) chip8_set_key(chip8, key, pressed);
+    }
+}
+
+static void drop_client(web_server_t *server, web_client_t *client, chip8_t *chip8) {
+    close(client->fd);
+    client->fd = -1;
+    client->keys = 0;
+    if(!server->read_only) apply_keys(server, chip8);
+}
+
+// Server frames are never masked or fragmented
+static bool ws_send(web_client_t *client, ws_opcode_t opcode, const void *data, size_t len) {
+    uint8_t header[4] = {0x80 | opcode};
+    size_t header_len = 2;
+
+    if(len < 126) {
+        header[1] = len;
+    } else {
+        // Frames are at most a hires screen, 16 bit lengths are plenty
+        header[1] = 126;
+        header[2] = len >> 8;
+        header[3] = len & 0xFF;
+        header_len = 4;
+    }
+
+    return net_send(client->fd, header, header_len) && net_send(client->fd, data, len);
+}
+
+static bool ws_send_text(web_client_t *client, const char *text) {
+    return ws_send(client, WS_TEXT, text, strlen(text));
+}
+
+// The client has a row it hasn't seen, or the resolution changed since its last update
+static bool client_stale(const web_client_t *client, const chip8_t *chip8) {
+    const uint32_t height = chip8_display_height(chip8);
+    if(client->width != chip8_display_width(chip8) || client->height != height) return true;
+
+    for(uint32_t y = 0; y < height; y++)
+        if(client->dirty[y]) return true;
+    return false;
+}
+
+// One update per run of changed rows, everything for a client that hasn't seen this resolution yet
+static bool send_screen(web_client_t *client, const chip8_t *chip8) {
+    static uint8_t frame[3 + CHIP8_MEGA_WIDTH * CHIP8_MEGA_HEIGHT];
+    const uint32_t width = chip8_display_width(chip8);
+    const uint32_t height = chip8_display_height(chip8);
+    const bool all = client->width != width || client->height != height;
+
+    client->width = width;
+    client->height = height;
+    frame[0] = width & 0xFF;
+    frame[1] = height;
+
+    for(uint32_t y = 0; y < height; ) {
+        if(!all && !client->dirty[y]) {
+            y++;
+            continue;
+        }
+
+        const uint32_t first = y;
+        for(; y < height && (all || client->dirty[y]); y++) {
+            for(uint32_t x = 0; x < width; x++) frame[3 + (y - first) * width + x] = chip8_pixel_planes(chip8, x, y);
+            client->dirty[y] = false;
+        }
+
+        frame[2] = first;
+        if(!ws_send(client, WS_BINARY, frame, 3 + (y - first) * width)) return false;
+    }
+
+    memset(client->dirty, 0, sizeof client->dirty);
+    return true;
+}
+
+static bool send_hello(web_client_t *client, const chip8_t *chip8, const config_t *config, bool sound,
+                       bool viewer) {
+    const uint32_t colors[] = {config->bg_color, config->fg_color, config->plane2_color, config->blend_color};
+    char hello[512];
+    int len = 0;
+
+    // Path separators and quotes are all that could break the JSON, so only the base name is sent
+    const char *name = chip8->rom_name ? chip8->rom_name : "";
+    const char *slash = strrchr(name, '/');
+    if(slash) name = slash + 1;
+
+    len += snprintf(&hello[len], sizeof hello - len, "{\"rom\": \"");
+    for(const char *c = name; *c && len < 300; c++)
+        if(*c != '"' && *c != '\\' && (unsigned char)*c >= 0x20) hello[len++] = *c;
+
+    len += snprintf(&hello[len], sizeof hello - len, "\", \"colors\": [");
+    for(int i = 0; i < 4; i++)
+        len += snprintf(&hello[len], sizeof hello - len, "%s\"#%06X\"", i ? ", " : "", (colors[i] >> 8) & 0xFFFFFF);
+    snprintf(&hello[len], sizeof hello - len, "], \"freq\": %u, \"viewer\": %s}", config->square_wave_freq,
+             viewer ? "true" : "false");
+
+    return ws_send_text(client, hello) && ws_send_text(client, sound ? "{\"sound\": true}" : "{\"sound\": false}");
+}
+
+static void http_reply(web_client_t *client, const char *status, const char *type, const char *body) {
+    char header[256];
+    snprintf(header, sizeof header,
+             "HTTP/1.1 %s\r\nContent-Type: %s\r\nContent-Length: %zu\r\nConnection: close\r\n\r\n",
+             status, type, strlen(body));
+
+    if(net_send(client->fd, header, strlen(header))) net_send(client->fd, body, strlen(body));
+}
+
+// Value of a header in a request, NULL if it's missing
+static const char *find_header(char *request, const char *name, char *value, size_t size) {
+    const size_t name_len = strlen(name);
+
+    for(char *line = strstr(request, "\r\n"); line && line[2] != '\r'; line = strstr(line + 2, "\r\n")) {
+        if(strncasecmp(&line[2], name, name_len) != 0 || line[2 + name_len] != ':') continue;
+
+        const char *start = &line[3 + name_len];
+        while(*start == ' ') start++;
+        const size_t len = strcspn(start, "\r");
+        if(len >= size) return NULL;
+
+        memcpy(value, start, len);
+        value[len] = '\0';
+        return value;
+    }
+
+    return NULL;
+}
+
+// Prometheus text exposition format, one HELP and TYPE line per metric
+static void append_metric(char *body, size_t size, size_t *len, const char *name, const char *type, const char *help,
+                          uint64_t value) {
+    if(*len >= size) return;
+
+    const int n = snprintf(&body[*len], size - *len, "# HELP %s %s\n# TYPE %s %s\n%s %llu\n", name, help, name, type,
+                           name, (unsigned long long)value);
+    if(n > 0) *len += n;
+}
+
+static void send_metrics(web_server_t *server, web_client_t *client) {
+    uint64_t viewers = 0, pending = 0;
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++) {
+        if(server->clients[i].fd < 0) continue;
+        if(server->clients[i].websocket) viewers++;
+        else pending++;
+    }
+
+    char body[2048];
+    size_t len = 0;
+    append_metric(body, sizeof body, &len, "chip8_instructions_total", "counter", "CHIP8 instructions executed.",
+                  server->instructions);
+    append_metric(body, sizeof body, &len, "chip8_frames_total", "counter", "60Hz frames emulated.", server->frames);
+    append_metric(body, sizeof body, &len, "chip8_screen_updates_total", "counter",
+                  "Screen updates sent to viewers.", server->screen_updates);
+    append_metric(body, sizeof body, &len, "chip8_faults_total", "counter", "Machine faults.", server->faults);
+    append_metric(body, sizeof body, &len, "chip8_restarts_total", "counter",
+                  "Times the ROM was started over after it exited or faulted.", server->restarts);
+    append_metric(body, sizeof body, &len, "chip8_viewers", "gauge", "Browsers connected to the WebSocket.", viewers);
+    // This request is one of them
+    append_metric(body, sizeof body, &len, "chip8_http_clients", "gauge", "Connections still sending a request.",
+                  pending);
+    append_metric(body, sizeof body, &len, "chip8_connections_total", "counter", "Connections accepted.",
+                  server->connections);
+    append_metric(body, sizeof body, &len, "chip8_rejected_connections_total", "counter",
+                  "Connections turned away with all client slots taken.", server->rejected);
+    append_metric(body, sizeof body, &len, "chip8_uptime_seconds", "gauge", "Seconds since the server started.",
+                  (net_now_ms() - server->started) / 1000);
+
+    http_reply(client, "200 OK", "text/plain; version=0.0.4; charset=utf-8", body);
+}
+
+// Answer a complete HTTP request, false if the connection is done with
+static bool handle_http(web_server_t *server, web_client_t *client, const chip8_t *chip8, const config_t *config) {
+    char *request = client->input;
+    char path[256] = "";
+    char upgrade[64];
+    char key[64];
+
+    if(sscanf(request, "GET %255s HTTP/1.", path) != 1) {
+        http_reply(client, "405 Method Not Allowed", "text/plain", "Only GET is supported\n");
+        return false;
+    }
+
+    if(strcmp(path, "/") == 0 || strcmp(path, "/index.html") == 0) {
+        http_reply(client, "200 OK", "text/html; charset=utf-8", page);
+        return false;
+    }
+
+    if(strcmp(path, "/metrics") == 0) {
+        send_metrics(server, client);
+        return false;
+    }
+
+    if(strcmp(path, "/ws") != 0) {
+        http_reply(client, "404 Not Found", "text/plain", "Not found\n");
+        return false;
+    }
+
+    if(!find_header(request, "Upgrade", upgrade, sizeof upgrade) || strcasecmp(upgrade, "websocket") != 0 ||
+       !find_header(request, "Sec-WebSocket-Key", key, sizeof key)) {
+        http_reply(client, "400 Bad Request", "text/plain", "Expected a WebSocket connection\n");
+        return false;
+    }
+
+    char accept[29];
+    char reply[256];
+    websocket_accept(key, accept);
+    snprintf(reply, sizeof reply,
+             "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"
+             "Sec-WebSocket-Accept: %s\r\n\r\n", accept);
+
+    client->websocket = true;
+    client->input_len = 0;
+    return net_send(client->fd, reply, strlen(reply)) &&
+           send_hello(client, chip8, config, server->sound, server->read_only);
+}
+
+// Key presses are the only messages pages send, viewers of a broadcast can't press any
+static void handle_message(web_server_t *server, web_client_t *client, chip8_t *chip8, const char *text, size_t len) {
+    if(server->read_only || len != 2 || (text[0] != 'd' && text[0] != 'u')) return;
+
+    char *end;
+    const char digit[2] = {text[1], '\0'};
+    const unsigned long key = strtoul(digit, &end, 16);
+    if(*end != '\0') return;
+
+    if(text[0] == 'd') client->keys |= 1 << key;
+    else client->keys &= ~(1 << key);
+    apply_keys(server, chip8);
+}
+
+// Handle the complete frames received so far, false if the connection is done with
+static bool handle_frames(web_server_t *server, web_client_t *client, chip8_t *chip8) {
+    const uint8_t *data = (const uint8_t *)client->input;
+    size_t pos = 0;
+
+    while(client->input_len - pos >= 2) {
+        const ws_opcode_t opcode = data[pos] & 0x0F;
+        const size_t len = data[pos + 1] & 0x7F;
+
+        // Browsers mask everything they send, and nothing the page sends needs a long frame
+        if(!(data[pos + 1] & 0x80) || len > 125) return false;
+        if(client->input_len - pos < 6 + len) break;
+
+        char payload[126];
+        const uint8_t *mask = &data[pos + 2];
+        for(size_t i = 0; i < len; i++) payload[i] = data[pos + 6 + i] ^ mask[i % 4];
+        pos += 6 + len;
+
+        switch(opcode) {
+            case WS_TEXT:
+                handle_message(server, client, chip8, payload, len);
+                break;
+            case WS_PING:
+                if(!ws_send(client, WS_PONG, payload, len)) return false;
+                break;
+            case WS_CLOSE:
+                ws_send(client, WS_CLOSE, payload, len < 2 ? len : 2);
+                return false;
+            case WS_CONTINUATION:
+            case WS_BINARY:
+            case WS_PONG:
+                break;
+        }
+    }
+
+    memmove(client->input, &client->input[pos], client->input_len - pos);
+    client->input_len -= pos;
+    return true;
+}
+
+// Read what arrived from a client, false if the connection is done with
+static bool read_client(web_server_t *server, web_client_t *client, chip8_t *chip8, const config_t *config) {
+    const ssize_t n = recv(client->fd, &client->input[client->input_len], WEB_MAX_INPUT - client->input_len, 0);
+    if(n < 0 && errno == EINTR) return true;
+    if(n <= 0) return false;
+    client->input_len += n;
+
+    if(client->websocket) return handle_frames(server, client, chip8);
+
+    // Wait for the whole request, the page never sends a body
+    client->input[client->input_len] = '\0';
+    if(!strstr(client->input, "\r\n\r\n")) return client->input_len < WEB_MAX_INPUT;
+
+    return handle_http(server, client, chip8, config);
+}
+
+static void accept_client(web_server_t *server) {
+    const int fd = accept(server->listen_fd, NULL, NULL);
+    if(fd < 0) return;
+
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++) {
+        if(server->clients[i].fd < 0) {
+            server->clients[i] = (web_client_t) {.fd = fd};
+            server->connections++;
+            return;
+        }
+    }
+
+    server->rejected++;
+    const char *busy = "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 0\r\nConnection: close\r\n\r\n";
+    net_send(fd, busy, strlen(busy));
+    close(fd);
+}
+
+static bool has_viewers(const web_server_t *server) {
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++)
+        if(server->clients[i].fd >= 0 && server->clients[i].websocket) return true;
+
+    return false;
+}
+
+// Remember the rows the last frame changed for every viewer, until each one is sent them
+static void mark_dirty(web_server_t *server, const chip8_t *chip8) {
+    const uint32_t height = chip8_display_height(chip8);
+
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++) {
+        web_client_t *client = &server->clients[i];
+        if(client->fd < 0 || !client->websocket) continue;
+
+        for(uint32_t y = 0; y < height; y++)
+            if(chip8_row_dirty(chip8, y)) client->dirty[y] = true;
+    }
+}
+
+// Push screen and sound changes to the viewers, a viewer that isn't keeping up skips frames and
+// gets the rows it missed with a later one
+static void update_viewers(web_server_t *server, chip8_t *chip8, bool sound) {
+    const bool sound_changed = sound != server->sound;
+    server->sound = sound;
+
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++) {
+        web_client_t *client = &server->clients[i];
+        if(client->fd < 0 || !client->websocket) continue;
+
+        bool ok = !sound_changed || ws_send_text(client, sound ? "{\"sound\": true}" : "{\"sound\": false}");
+
+        struct pollfd writable = {.fd = client->fd, .events = POLLOUT};
+        if(ok && client_stale(client, chip8) && poll(&writable, 1, 0) == 1 && (writable.revents & POLLOUT)) {
+            ok = send_screen(client, chip8);
+            if(ok) server->screen_updates++;
+        }
+
+        if(!ok) drop_client(server, client, chip8);
+    }
+}
+
+// Tell the viewers the ROM is done and hang up on everyone
+static void close_clients(web_server_t *server, chip8_t *chip8) {
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++) {
+        web_client_t *client = &server->clients[i];
+        if(client->fd < 0) continue;
+
+        if(client->websocket && chip8->state == QUIT && chip8->fault == CHIP8_FAULT_NONE) {
+            send_screen(client, chip8);
+            ws_send_text(client, "{\"exited\": true}");
+            ws_send(client, WS_CLOSE, "\x03\xE8", 2);   // 1000, normal closure
+        }
+        close(client->fd);
+        client->fd = -1;
+    }
+}
+
+// Same defaults as net_listen()
+static void print_url(const char *address, const char *what) {
+    const char *colon = strrchr(address, ':');
+    if(colon && colon > address) log_write(CHIP8_LOG_INFO, "web", "%s http://%s/ in a browser", what, address);
+    else log_write(CHIP8_LOG_INFO, "web", "%s http://localhost:%s/ in a browser", what, colon ? colon + 1 : address);
+}
+
+// Accept and read from clients, waiting up to timeout ms for something to happen, -1 waits for good
+static bool poll_clients(web_server_t *server, chip8_t *chip8, const config_t *config, int timeout) {
+    struct pollfd fds[1 + WEB_MAX_CLIENTS];
+    web_client_t *polled[1 + WEB_MAX_CLIENTS];
+    nfds_t count = 1;
+
+    fds[0] = (struct pollfd) {.fd = server->listen_fd, .events = POLLIN};
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++) {
+        if(server->clients[i].fd < 0) continue;
+        polled[count] = &server->clients[i];
+        fds[count++] = (struct pollfd) {.fd = server->clients[i].fd, .events = POLLIN};
+    }
+
+    if(poll(fds, count, timeout) < 0 && errno != EINTR) {
+        log_write(CHIP8_LOG_ERROR, "web", "Web server poll failed: %s", strerror(errno));
+        return false;
+    }
+
+    for(nfds_t i = 1; i < count; i++) {
+        if((fds[i].revents & (POLLIN | POLLHUP | POLLERR)) && !read_client(server, polled[i], chip8, config))
+            drop_client(server, polled[i], chip8);
+    }
+    if(fds[0].revents & POLLIN) accept_client(server);
+
+    return true;
+}
+
+// A browser closing its tab while we write to it shouldn't kill the emulator
+static bool open_server(web_server_t *server, const char *address, bool read_only) {
+    *server = (web_server_t) {.read_only = read_only, .started = net_now_ms()};
+    for(int i = 0; i < WEB_MAX_CLIENTS; i++) server->clients[i].fd = -1;
+    if((server->listen_fd = net_listen(address)) < 0) return false;
+
+    server->old_sigpipe = signal(SIGPIPE, SIG_IGN);
+    return true;
+}
+
+static void close_server(web_server_t *server, chip8_t *chip8) {
+    close_clients(server, chip8);
+    close(server->listen_fd);
+    signal(SIGPIPE, server->old_sigpipe);
+}
+
+bool web_server_run(chip8_t *chip8, const config_t *config) {
+    web_server_t server;
+    if(!open_server(&server, config->serve, false)) return false;
+    print_url(config->serve, "Open");
+
+    uint64_t next_frame = net_now_ms();
+    uint32_t frames = 0;
+    bool ok = true;
+
+    while(chip8->state != QUIT) {
+        // Nobody watching, wait for a viewer without running the ROM
+        const bool running = has_viewers(&server);
+        const uint64_t now = net_now_ms();
+        const int timeout = !running ? -1 : next_frame > now ? (int)(next_frame - now) : 0;
+
+        if(!poll_clients(&server, chip8, config, timeout)) {
+            ok = false;
+            break;
+        }
+
+        if(!running) {
+            next_frame = net_now_ms();
+            continue;
+        }
+
+        if(net_now_ms() >= next_frame) {
+            // What chip8_run_frame() runs unless the ROM stops halfway
+            server.instructions += (chip8->insts_per_second + chip8->frame_remainder) / 60;
+            server.frames++;
+            chip8_run_frame(chip8);
+            if(chip8->fault != CHIP8_FAULT_NONE) server.faults++;
+            mark_dirty(&server, chip8);
+            update_viewers(&server, chip8, chip8_sound_active(chip8));
+            chip8_clear_dirty(chip8);
+
+            // A kiosk keeps going, the viewers get the whole screen of the new run
+            if(chip8->state == QUIT && config->serve_restart) {
+                if(chip8->fault != CHIP8_FAULT_NONE) log_fault(chip8);
+                else log_write(CHIP8_LOG_INFO, "web", "The ROM exited, starting it over");
+
+                chip8_reset(chip8);
+                apply_keys(&server, chip8);
+                for(int i = 0; i < WEB_MAX_CLIENTS; i++) server.clients[i].width = 0;
+                server.restarts++;
+            }
+
+            // 1000 / 60 ms per frame, spread over three frames to stay at 60Hz on average
+            next_frame += ++frames % 3 == 0 ? 16 : 17;
+            if(net_now_ms() > next_frame + 100) next_frame = net_now_ms();  // Too far behind to catch up
+        }
+    }
+
+    close_server(&server, chip8);
+    return ok;
+}
+
+web_server_t *web_broadcast_open(const char *address) {
+    web_server_t *server = malloc(sizeof *server);
+    if(!server || !open_server(server, address, true)) {
+        free(server);
+        return NULL;
+    }
+
+    print_url(address, "Viewers can watch at");
+    return server;
+}
+
+void web_broadcast_frame(web_server_t *server, chip8_t *chip8, const config_t *config, bool new_frame, bool sound,
+                         uint64_t instructions, uint64_t frames) {
+    server->instructions = instructions;
+    server->frames = frames;
+    poll_clients(server, chip8, config, 0);
+    if(new_frame) mark_dirty(server, chip8);
+    update_viewers(server, chip8, sound);
+}
+
+void web_broadcast_close(web_server_t *server, chip8_t *chip8) {
+    if(!server) return;
+
+    close_server(server, chip8);
+    free(server);
+}
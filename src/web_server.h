@@ -0,0 +1,31 @@
+#ifndef WEB_SERVER_H
+#define WEB_SERVER_H
+
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+#include "config.h"
+
+// Run the ROM on a server and show it in browsers, see the top of web_server.c for the protocol
+// Serves a page with the screen and a keypad on config->serve ("[host:]port", host defaults
+// to 127.0.0.1) until the ROM exits, returns false if it faulted or the address can't be listened on
+// With config->serve_restart the ROM starts over instead and the server runs until it's killed
+bool web_server_run(chip8_t *chip8, const config_t *config);
+
+// --broadcast, the same page for any number of viewers watching a window session without a keypad
+typedef struct web_server web_server_t;
+
+// NULL if the address can't be listened on
+web_server_t *web_broadcast_open(const char *address);
+
+// Call once per window frame without waiting, lets viewers in and sends them what changed
+// new_frame says chip8 was copied from the machine since the last call, so its dirty rows are new
+// instructions and frames are the session's totals so far, for /metrics
+void web_broadcast_frame(web_server_t *server, chip8_t *chip8, const config_t *config, bool new_frame, bool sound,
+                         uint64_t instructions, uint64_t frames);
+
+// chip8 is the machine, viewers get its last screen and hear that the ROM exited if it did
+void web_broadcast_close(web_server_t *server, chip8_t *chip8);
+
+#endif // WEB_SERVER_H
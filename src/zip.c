@@ -0,0 +1,334 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "zip.h"
+
+#define ZIP_LOCAL_SIGNATURE   0x04034B50
+#define ZIP_CENTRAL_SIGNATURE 0x02014B50
+#define ZIP_END_SIGNATURE     0x06054B50
+#define ZIP_END_SIZE          22
+
+#define MAX_CODE_BITS 15
+
+// Canonical Huffman code, symbols ordered by code length
+typedef struct {
+    uint16_t count[MAX_CODE_BITS + 1];  // Codes of each length
+    uint16_t symbol[288];
+} huffman_t;
+
+// Deflate decoder state, bits are read least significant first
+typedef struct {
+    const uint8_t *in;
+    size_t in_size;
+    size_t in_pos;
+    uint32_t bit_buffer;
+    int bit_count;
+    uint8_t *out;
+    size_t out_size;
+    size_t out_pos;
+    bool error;             // Ran out of input or hit invalid data
+} inflate_t;
+
+static uint16_t read16(const uint8_t *p) {
+    return p[0] | p[1] << 8;
+}
+
+static uint32_t read32(const uint8_t *p) {
+    return (uint32_t)p[0] | (uint32_t)p[1] << 8 | (uint32_t)p[2] << 16 | (uint32_t)p[3] << 24;
+}
+
+static uint32_t crc32(const uint8_t *data, size_t size) {
+    uint32_t crc = 0xFFFFFFFF;
+
+    for(size_t i = 0; i < size; i++) {
+        crc ^= data[i];
+        for(int bit = 0; bit < 8; bit++) crc = crc & 1 ? (crc >> 1) ^ 0xEDB88320 : crc >> 1;
+    }
+
+    return ~crc;
+}
+
+static uint32_t get_bits(inflate_t *state, int need) {
+    uint32_t value = state->bit_buffer;
+
+    while(state->bit_count < need) {
+        if(state->in_pos == state->in_size) {
+            state->error = true;
+            return 0;
+        }
+
+        value |= (uint32_t)state->in[state->in_pos++] << state->bit_count;
+        state->bit_count += 8;
+    }
+
+    state->bit_buffer = value >> need;
+    state->bit_count -= need;
+    return value & ((1u << need) - 1);
+}
+
+// Build a code from the code length of each symbol, false for over-subscribed lengths
+static bool build_huffman(huffman_t *huffman, const uint8_t *lengths, int symbols) {
+    uint16_t offsets[MAX_CODE_BITS + 1];
+
+    memset(huffman->count, 0, sizeof huffman->count);
+    for(int i = 0; i < symbols; i++) huffman->count[lengths[i]]++;
+    if(huffman->count[0] == symbols) return true;
+
+    int left = 1;
+    for(int len = 1; len <= MAX_CODE_BITS; len++) {
+        left = (left << 1) - huffman->count[len];
+        if(left < 0) return false;
+    }
+
+    offsets[1] = 0;
+    for(int len = 1; len < MAX_CODE_BITS; len++) offsets[len + 1] = offsets[len] + huffman->count[len];
+
+    for(int i = 0; i < symbols; i++)
+        if(lengths[i]) huffman->symbol[offsets[lengths[i]]++] = i;
+
+    return true;
+}
+
+// Next symbol, -1 on errors
+static int decode(inflate_t *state, const huffman_t *huffman) {
+    int code = 0, first = 0, index = 0;
+
+    for(int len = 1; len <= MAX_CODE_BITS; len++) {
+        code |= get_bits(state, 1);
+        const int count = huffman->count[len];
+
+        if(code - count < first) return huffman->symbol[index + (code - first)];
+
+        index += count;
+        first = (first + count) << 1;
+        code <<= 1;
+    }
+
+    return -1;
+}
+
+// Literals and back references up to the end of block symbol
+static bool inflate_codes(inflate_t *state, const huffman_t *lengths, const huffman_t *distances) {
+    static const uint16_t length_base[29] = {3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+                                             35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258};
+    static const uint8_t length_extra[29] = {0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+                                             3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0};
+    static const uint16_t distance_base[30] = {1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+                                               257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145,
+                                               8193, 12289, 16385, 24577};
+    static const uint8_t distance_extra[30] = {0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+                                               7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13};
+
+    for(;;) {
+        int symbol = decode(state, lengths);
+        if(symbol < 0 || state->error) return false;
+        if(symbol == 256) return true;
+
+        if(symbol < 256) {
+            if(state->out_pos == state->out_size) return false;
+            state->out[state->out_pos++] = symbol;
+            continue;
+        }
+
+        symbol -= 257;
+        if(symbol >= 29) return false;
+        const size_t length = length_base[symbol] + get_bits(state, length_extra[symbol]);
+
+        symbol = decode(state, distances);
+        if(symbol < 0 || symbol >= 30) return false;
+        const size_t distance = distance_base[symbol] + get_bits(state, distance_extra[symbol]);
+
+        if(state->error || distance > state->out_pos || length > state->out_size - state->out_pos) return false;
+        for(size_t i = 0; i < length; i++, state->out_pos++)
+            state->out[state->out_pos] = state->out[state->out_pos - distance];
+    }
+}
+
+static bool inflate_stored(inflate_t *state) {
+    // Stored blocks start on a byte boundary
+    state->bit_buffer = 0;
+    state->bit_count = 0;
+
+    if(state->in_size - state->in_pos < 4) return false;
+    const uint16_t length = read16(&state->in[state->in_pos]);
+    const uint16_t check = read16(&state->in[state->in_pos + 2]);
+    state->in_pos += 4;
+
+    if((length ^ check) != 0xFFFF) return false;
+    if(length > state->in_size - state->in_pos || length > state->out_size - state->out_pos) return false;
+
+    memcpy(&state->out[state->out_pos], &state->in[state->in_pos], length);
+    state->in_pos += length;
+    state->out_pos += length;
+    return true;
+}
+
+static bool inflate_fixed(inflate_t *state) {
+    uint8_t lengths[288];
+    huffman_t literal, distance;
+    int i = 0;
+
+    for(; i < 144; i++) lengths[i] = 8;
+    for(; i < 256; i++) lengths[i] = 9;
+    for(; i < 280; i++) lengths[i] = 7;
+    for(; i < 288; i++) lengths[i] = 8;
+    build_huffman(&literal, lengths, 288);
+
+    for(i = 0; i < 30; i++) lengths[i] = 5;
+    build_huffman(&distance, lengths, 30);
+
+    return inflate_codes(state, &literal, &distance);
+}
+
+// Block with its own codes, sent as code lengths that are Huffman coded themselves
+static bool inflate_dynamic(inflate_t *state) {
+    static const uint8_t order[19] = {16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15};
+    uint8_t lengths[286 + 30] = {0};
+    huffman_t literal, distance;
+
+    const int literals = get_bits(state, 5) + 257;
+    const int distances = get_bits(state, 5) + 1;
+    const int code_lengths = get_bits(state, 4) + 4;
+    if(state->error || literals > 286 || distances > 30) return false;
+
+    for(int i = 0; i < code_lengths; i++) lengths[order[i]] = get_bits(state, 3);
+    if(!build_huffman(&literal, lengths, 19)) return false;
+
+    for(int index = 0; index < literals + distances;) {
+        int symbol = decode(state, &literal);
+        if(symbol < 0 || state->error) return false;
+
+        if(symbol < 16) {
+            lengths[index++] = symbol;
+            continue;
+        }
+
+        uint8_t value = 0;
+        int repeat;
+        if(symbol == 16) {
+            if(index == 0) return false;
+            value = lengths[index - 1];
+            repeat = 3 + get_bits(state, 2);
+        } else if(symbol == 17) {
+            repeat = 3 + get_bits(state, 3);
+        } else {
+            repeat = 11 + get_bits(state, 7);
+        }
+
+        if(index + repeat > literals + distances) return false;
+        while(repeat--) lengths[index++] = value;
+    }
+
+    // A block without an end code could never finish
+    if(lengths[256] == 0) return false;
+    if(!build_huffman(&literal, lengths, literals)) return false;
+    if(!build_huffman(&distance, &lengths[literals], distances)) return false;
+
+    return inflate_codes(state, &literal, &distance);
+}
+
+static bool inflate(const uint8_t *in, size_t in_size, uint8_t *out, size_t out_size) {
+    inflate_t state = {.in = in, .in_size = in_size, .out = out, .out_size = out_size};
+    bool last;
+
+    do {
+        last = get_bits(&state, 1);
+        bool ok;
+
+        switch(get_bits(&state, 2)) {
+            case 0: ok = inflate_stored(&state); break;
+            case 1: ok = inflate_fixed(&state); break;
+            case 2: ok = inflate_dynamic(&state); break;
+            default: ok = false; break;
+        }
+
+        if(!ok || state.error) return false;
+    } while(!last);
+
+    return state.out_pos == out_size;
+}
+
+bool zip_is_archive(const uint8_t *data, size_t size) {
+    return size >= 4 && read32(data) == ZIP_LOCAL_SIGNATURE;
+}
+
+// The end of central directory record is at the end, before an optional comment of up to 64KB
+static const uint8_t *find_end_record(const uint8_t *zip, size_t zip_size) {
+    if(zip_size < ZIP_END_SIZE) return NULL;
+
+    for(size_t pos = zip_size - ZIP_END_SIZE + 1; pos-- > 0 && zip_size - pos <= ZIP_END_SIZE + 0xFFFF;)
+        if(read32(&zip[pos]) == ZIP_END_SIGNATURE) return &zip[pos];
+
+    return NULL;
+}
+
+bool zip_entry(const uint8_t *zip, size_t zip_size, size_t index, zip_entry_t *entry) {
+    const uint8_t *end = find_end_record(zip, zip_size);
+    if(!end || index >= read16(&end[10])) return false;
+
+    size_t pos = read32(&end[16]);
+
+    for(size_t i = 0;; i++) {
+        if(pos > zip_size || zip_size - pos < 46 || read32(&zip[pos]) != ZIP_CENTRAL_SIGNATURE) return false;
+
+        const uint8_t *header = &zip[pos];
+        const uint16_t name_length = read16(&header[28]);
+        const size_t header_size = 46 + name_length + read16(&header[30]) + read16(&header[32]);
+        if(zip_size - pos < header_size) return false;
+
+        if(i == index) {
+            const size_t length = name_length < sizeof entry->name ? name_length : sizeof entry->name - 1;
+            memcpy(entry->name, &header[46], length);
+            entry->name[length] = '\0';
+
+            entry->method = read16(&header[10]);
+            entry->crc32 = read32(&header[16]);
+            entry->compressed_size = read32(&header[20]);
+            entry->size = read32(&header[24]);
+            entry->local_offset = read32(&header[42]);
+            return true;
+        }
+
+        pos += header_size;
+    }
+}
+
+uint8_t *zip_extract(const uint8_t *zip, size_t zip_size, const zip_entry_t *entry) {
+    // The data follows the local header, which has its own name and extra field lengths
+    const size_t pos = entry->local_offset;
+    if(pos > zip_size || zip_size - pos < 30 || read32(&zip[pos]) != ZIP_LOCAL_SIGNATURE) {
+        fprintf(stderr, "Broken zip archive, no local header for %s\n", entry->name);
+        return NULL;
+    }
+
+    const size_t data_pos = pos + 30 + read16(&zip[pos + 26]) + read16(&zip[pos + 28]);
+    if(data_pos > zip_size || zip_size - data_pos < entry->compressed_size) {
+        fprintf(stderr, "Broken zip archive, %s is cut off\n", entry->name);
+        return NULL;
+    }
+
+    const uint8_t *data = &zip[data_pos];
+    uint8_t *out = malloc(entry->size ? entry->size : 1);
+    if(!out) return NULL;
+
+    bool ok;
+    if(entry->method == 0) {
+        ok = entry->compressed_size == entry->size;
+        if(ok) memcpy(out, data, entry->size);
+    } else if(entry->method == 8) {
+        ok = inflate(data, entry->compressed_size, out, entry->size);
+    } else {
+        fprintf(stderr, "Unsupported compression method %u for %s\n", entry->method, entry->name);
+        free(out);
+        return NULL;
+    }
+
+    if(!ok || crc32(out, entry->size) != entry->crc32) {
+        fprintf(stderr, "Broken zip archive, %s doesn't decompress correctly\n", entry->name);
+        free(out);
+        return NULL;
+    }
+
+    return out;
+}
@@ -0,0 +1,27 @@
+#ifndef ZIP_H
+#define ZIP_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+// File in a .zip archive, enough of the central directory entry to extract it
+typedef struct {
+    char name[256];
+    uint16_t method;            // 0 stored, 8 deflated
+    uint32_t crc32;
+    uint32_t compressed_size;
+    uint32_t size;
+    uint32_t local_offset;      // Local file header
+} zip_entry_t;
+
+bool zip_is_archive(const uint8_t *data, size_t size);
+
+// Entry number index of the archive, false past the last entry or for broken archives
+bool zip_entry(const uint8_t *zip, size_t zip_size, size_t index, zip_entry_t *entry);
+
+// Decompress an entry into a malloc'd buffer of entry->size bytes, NULL on errors
+// Only stored and deflated entries are supported, no ZIP64 or encryption
+uint8_t *zip_extract(const uint8_t *zip, size_t zip_size, const zip_entry_t *entry);
+
+#endif // ZIP_H
@@ -0,0 +1,167 @@
+// Allocation tests: chip8_step() and chip8_run_frame() must not touch the heap, so the core runs the same
+// on targets with a tiny or no allocator (the browser build, microcontrollers)
+//
+// Build and run from src/ with "make test", the linker wraps malloc, calloc and realloc to count
+// the calls the core makes while ROMs run in each configuration
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+#define TESTS_DIR "../tests/"
+
+// Instructions per ROM and configuration, timers tick every 11 like in the golden tests
+#define CYCLES 200000
+
+typedef enum {
+    PLAIN,
+    DECODE_CACHE,
+    HOOKS,              // Every hook, a device and the instruction log, the paths tools outside the core take
+    SETUP_COUNT,
+} setup_t;
+
+static const char *const setup_names[SETUP_COUNT] = {"plain", "decode cache", "hooks"};
+
+static const char *const roms[] = {
+    "programs/IBM Logo.ch8",
+    "programs/test_opcode.ch8",
+    "programs/BC_test.ch8",
+    "roms/BRIX",
+    "roms/INVADERS",
+    "roms/BLINKY",
+};
+
+static bool counting;
+static uint32_t allocations;
+
+void *__real_malloc(size_t size);
+void *__real_calloc(size_t count, size_t size);
+void *__real_realloc(void *ptr, size_t size);
+
+void *__wrap_malloc(size_t size) {
+    if(counting) allocations++;
+    return __real_malloc(size);
+}
+
+void *__wrap_calloc(size_t count, size_t size) {
+    if(counting) allocations++;
+    return __real_calloc(count, size);
+}
+
+void *__wrap_realloc(void *ptr, size_t size) {
+    if(counting) allocations++;
+    return __real_realloc(ptr, size);
+}
+
+static uint8_t memory_hook(void *userdata, uint16_t addr, uint8_t value) {
+    (void)userdata;
+    (void)addr;
+    return value;
+}
+
+// Leaves 0NNN routines to the core, so ROMs behave like in the other setups
+static bool sys_hook(void *userdata, uint16_t addr) {
+    (void)userdata;
+    (void)addr;
+    return false;
+}
+
+static chip8_step_action_t step_hook(void *userdata, uint16_t pc, uint16_t opcode) {
+    (void)userdata;
+    (void)pc;
+    (void)opcode;
+    return CHIP8_STEP_RUN;
+}
+
+// Hold key 5 down half of the time so key waits finish
+static bool key_hook(void *userdata, uint8_t key, bool pressed) {
+    uint32_t *calls = userdata;
+    return pressed || (key == 5 && (++*calls & 0x400));
+}
+
+static void log_hook(void *userdata, chip8_log_level_t level, const char *subsystem, const char *message) {
+    (void)userdata;
+    (void)level;
+    (void)subsystem;
+    (void)message;
+}
+
+// Allocations the core made while running the ROM, -1 if it couldn't be set up
+static int64_t run_rom(const char *rom, setup_t setup) {
+    chip8_t *chip8 = malloc(sizeof *chip8);
+    uint32_t key_calls = 0;
+    if(!chip8) return -1;
+
+    chip8_init(chip8);
+    chip8_quirks_preset("modern", &chip8->quirks);
+
+    char path[256];
+    snprintf(path, sizeof path, TESTS_DIR "../%s", rom);
+    if((setup == DECODE_CACHE && !chip8_set_decode_cache(chip8, true)) || !chip8_load_rom_file(chip8, path)) {
+        chip8_set_decode_cache(chip8, false);
+        free(chip8);
+        return -1;
+    }
+
+    if(setup == HOOKS) {
+        const chip8_device_t device = {.first = 0x000, .last = 0xFFF, .read = memory_hook, .write = memory_hook};
+        chip8_set_memory_hooks(chip8, memory_hook, memory_hook, NULL);
+        chip8_add_device(chip8, &device);
+        chip8_set_sys_hook(chip8, sys_hook, NULL);
+        chip8_set_step_hook(chip8, step_hook, NULL);
+        chip8_set_key_hook(chip8, key_hook, &key_calls);
+        chip8_set_log(chip8, log_hook, NULL);
+        chip8_set_instruction_log(chip8, true);
+    }
+
+    // Half the instructions one at a time, the rest in 60Hz frames, ROMs that quit are restarted
+    allocations = 0;
+    counting = true;
+    for(uint32_t i = 0; i < CYCLES / 2 && chip8->fault == CHIP8_FAULT_NONE; i++) {
+        chip8_step(chip8);
+        if((i + 1) % 11 == 0) chip8_update_timers(chip8);
+        if(chip8->state == QUIT) chip8_reset(chip8);
+    }
+    for(uint32_t i = 0; i < CYCLES / 2 / 11 && chip8->fault == CHIP8_FAULT_NONE; i++) {
+        chip8_run_frame(chip8);
+        if(chip8->state == QUIT) chip8_reset(chip8);
+    }
+    counting = false;
+
+    if(chip8->fault != CHIP8_FAULT_NONE) {
+        printf("     %s faulted: ", rom);
+        chip8_print_fault(chip8, stdout);
+    }
+
+    chip8_set_decode_cache(chip8, false);
+    free(chip8);
+    return allocations;
+}
+
+int main(void) {
+    uint32_t failed = 0;
+    uint32_t count = 0;
+
+    for(size_t i = 0; i < sizeof roms / sizeof roms[0]; i++) {
+        for(setup_t setup = PLAIN; setup < SETUP_COUNT; setup++) {
+            const int64_t made = run_rom(roms[i], setup);
+            count++;
+
+            if(made < 0) {
+                printf("FAIL %s (%s): could not run ROM\n", roms[i], setup_names[setup]);
+                failed++;
+            } else if(made > 0) {
+                printf("FAIL %s (%s): %lld allocations while running\n", roms[i], setup_names[setup],
+                       (long long)made);
+                failed++;
+            } else {
+                printf("ok   %s (%s), no allocations\n", roms[i], setup_names[setup]);
+            }
+        }
+    }
+
+    printf("%u allocation tests, %u failed\n", count, failed);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
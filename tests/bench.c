@@ -0,0 +1,116 @@
+#define _POSIX_C_SOURCE 200809L
+
+// Interpreter throughput benchmark: run ROMs headless for a fixed number of instructions
+// and print how many instructions per second chip8_step() gets through, with and without the decode cache
+//
+// Build and run from src/ with "make bench", the core is compiled with -O2 for it
+// "./bench <instructions>" changes the instructions per ROM, default 50 million
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <time.h>
+
+#include "chip8.h"
+
+#define TESTS_DIR "../tests/"
+
+typedef struct {
+    const char *rom;        // Relative to the repository root
+    const char *quirks;     // Quirks preset, see chip8_quirks_preset()
+} bench_rom_t;
+
+// A mix of arithmetic heavy test code, sprite drawing and games idling on the delay timer
+static const bench_rom_t roms[] = {
+    {"programs/test_opcode.ch8", "modern"},
+    {"programs/BC_test.ch8",     "modern"},
+    {"roms/BRIX",                "modern"},
+    {"roms/BLINKY",              "modern"},
+    {"roms/INVADERS",            "modern"},
+};
+
+static double seconds_now(void) {
+    struct timespec ts;
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    return ts.tv_sec + ts.tv_nsec / 1e9;
+}
+
+// Instructions per second for one ROM, 0 if it could not be loaded or faulted
+static double run_rom(const bench_rom_t *bench, uint64_t instructions, bool decode_cache) {
+    chip8_t *chip8 = malloc(sizeof *chip8);
+    if(!chip8) return 0;
+
+    chip8_init(chip8);
+    chip8_quirks_preset(bench->quirks, &chip8->quirks);
+    if(decode_cache && !chip8_set_decode_cache(chip8, true)) {
+        free(chip8);
+        return 0;
+    }
+
+    char path[256];
+    snprintf(path, sizeof path, TESTS_DIR "../%s", bench->rom);
+    if(!chip8_load_rom_file(chip8, path)) {
+        chip8_set_decode_cache(chip8, false);
+        free(chip8);
+        return 0;
+    }
+
+    // Timers tick every 11 instructions like in the golden tests, ROMs that quit are restarted
+    const double start = seconds_now();
+    uint32_t frame_insts = 0;
+    for(uint64_t i = 0; i < instructions; i++) {
+        chip8_step(chip8);
+        if(++frame_insts == 11) {
+            chip8_update_timers(chip8);
+            frame_insts = 0;
+        }
+
+        if(chip8->fault != CHIP8_FAULT_NONE) {
+            printf("FAIL %s: ", bench->rom);
+            chip8_print_fault(chip8, stdout);
+            chip8_set_decode_cache(chip8, false);
+            free(chip8);
+            return 0;
+        }
+        if(chip8->state == QUIT) chip8_reset(chip8);
+    }
+    const double seconds = seconds_now() - start;
+
+    chip8_set_decode_cache(chip8, false);
+    free(chip8);
+    return seconds > 0 ? instructions / seconds : 0;
+}
+
+int main(int argc, char **argv) {
+    uint64_t instructions = 50000000;
+    if(argc > 1) {
+        char *end;
+        instructions = strtoull(argv[1], &end, 10);
+        if(*end != '\0' || instructions == 0) {
+            fprintf(stderr, "Usage: %s [instructions per ROM]\n", argv[0]);
+            return EXIT_FAILURE;
+        }
+    }
+
+    double total = 0;
+    double total_cached = 0;
+    uint32_t failed = 0;
+
+    printf("%-26s %10s %10s  (M instructions/s)\n", "", "decode", "cached");
+    for(size_t i = 0; i < sizeof roms / sizeof roms[0]; i++) {
+        const double speed = run_rom(&roms[i], instructions, false);
+        const double cached = run_rom(&roms[i], instructions, true);
+        if(speed == 0 || cached == 0) {
+            failed++;
+            continue;
+        }
+
+        printf("%-26s %10.1f %10.1f\n", roms[i].rom, speed / 1e6, cached / 1e6);
+        total += speed;
+        total_cached += cached;
+    }
+
+    const size_t ran = sizeof roms / sizeof roms[0] - failed;
+    if(ran > 0) printf("%-26s %10.1f %10.1f\n", "average", total / ran / 1e6, total_cached / ran / 1e6);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
@@ -0,0 +1,230 @@
+// Fuzzing harness for the emulator core: random ROM bytes run for a bounded number of
+// instructions, aborting on out of bounds accesses (caught by the sanitizers) and on broken
+// machine invariants. The same bytes go through the ROM linter
+//
+// "make fuzz" inside src/ builds it with gcc and the address and undefined behaviour sanitizers
+// and runs random inputs, "./fuzz <runs> <seed>" picks how many and "./fuzz <file>..." replays
+// saved inputs. "make fuzz-libfuzzer" builds the same target for clang's libFuzzer instead.
+//
+// Input layout: flags byte, 2 bytes of keypad pattern, then the ROM
+//   flags bit 0 XO-CHIP, bit 1 strict memory, bits 2-3 quirks preset, bits 4-7 toggle the
+//   key_press, display_wait, clipping and jump quirks
+//
+// Note the PC is not checked for alignment, jumping to odd addresses is valid CHIP8
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "chip8.h"
+#include "lint.h"
+
+#define FUZZ_CYCLES 5000
+#define FUZZ_HEADER 3
+
+int LLVMFuzzerTestOneInput(const uint8_t *data, size_t size);
+
+static void fail(const char *what) {
+    fprintf(stderr, "Invariant broken: %s\n", what);
+    abort();
+}
+
+// Cheap checks after every instruction
+static void check_step(const chip8_t *chip8) {
+    if(chip8->stack_ptr < chip8->stack || chip8->stack_ptr > &chip8->stack[16]) fail("stack pointer out of range");
+    if(chip8->wait_key < -1 || chip8->wait_key > 0xF) fail("FX0A key out of range");
+    if(chip8->planes > 0x3) fail("XO-CHIP planes out of range");
+    if(chip8->fault != CHIP8_FAULT_NONE && chip8->state != QUIT) fail("faulted machine still running");
+    if(chip8->ram_size != CHIP8_RAM_SIZE && chip8->ram_size != CHIP8_XO_RAM_SIZE) fail("memory size changed");
+}
+
+// Checks on the final machine, too slow to do every instruction
+static void check_machine(const chip8_t *chip8) {
+    for(size_t i = 0; i < sizeof chip8->display; i++)
+        if(chip8->display[i] > 0x3) fail("pixel outside the XO-CHIP planes");
+
+    if(!chip8->xochip) {
+        for(size_t i = chip8->ram_size; i < sizeof chip8->ram; i++)
+            if(chip8->ram[i] != 0) fail("write past the end of CHIP8 memory");
+    }
+}
+
+// Run the input on a fresh machine and return its save state, NULL if the ROM was rejected
+static uint8_t *run(const uint8_t *data, size_t size, bool decode_cache, size_t *state_size) {
+    chip8_t *chip8 = calloc(1, sizeof *chip8);
+    if(!chip8) return NULL;
+
+    const uint8_t flags = data[0];
+    const uint16_t keys = (data[1] << 8) | data[2];
+    const char *presets[] = {"modern", "cosmac", "schip", "modern"};
+
+    chip8_init(chip8);
+    chip8_quirks_preset(presets[(flags >> 2) & 0x3], &chip8->quirks);
+    if(flags & 0x10) chip8->quirks.key_press = !chip8->quirks.key_press;
+    if(flags & 0x20) chip8->quirks.display_wait = !chip8->quirks.display_wait;
+    if(flags & 0x40) chip8->quirks.clip_sprites = !chip8->quirks.clip_sprites;
+    if(flags & 0x80) chip8->quirks.jump_vx = !chip8->quirks.jump_vx;
+    chip8_set_xochip(chip8, flags & 0x1);
+    chip8_set_strict_memory(chip8, flags & 0x2);
+
+    uint8_t *state = NULL;
+    if((!decode_cache || chip8_set_decode_cache(chip8, true)) &&
+       chip8_load_rom(chip8, &data[FUZZ_HEADER], size - FUZZ_HEADER)) {
+        chip8_reset(chip8);
+
+        // The keypad pattern rotates every frame so key waits and skips go both ways
+        for(uint32_t i = 0; i < FUZZ_CYCLES && chip8->state != QUIT; i++) {
+            if(i % 11 == 0) {
+                chip8_update_timers(chip8);
+
+                const uint16_t pattern = (keys << (i / 11 % 16)) | (keys >> (16 - i / 11 % 16));
+                for(uint8_t key = 0; key < 16; key++) chip8_set_key(chip8, key, pattern & (1 << key));
+            }
+
+            chip8_step(chip8);
+            check_step(chip8);
+        }
+
+        check_machine(chip8);
+
+        *state_size = chip8_state_size(chip8);
+        state = malloc(*state_size);
+        if(state && chip8_serialize(chip8, state, *state_size) != *state_size) fail("serialize size mismatch");
+    }
+
+    chip8_set_decode_cache(chip8, false);
+    free(chip8);
+    return state;
+}
+
+// A restored state has to serialize back to the same bytes
+static void check_state_round_trip(const uint8_t *state, size_t size) {
+    chip8_t *chip8 = calloc(1, sizeof *chip8);
+    if(!chip8) return;
+
+    chip8_init(chip8);
+    if(!chip8_deserialize(chip8, state, size)) fail("own save state rejected");
+
+    uint8_t *again = malloc(size);
+    if(again) {
+        if(chip8_serialize(chip8, again, size) != size || memcmp(state, again, size) != 0)
+            fail("save state changed after a round trip");
+        free(again);
+    }
+
+    free(chip8);
+}
+
+int LLVMFuzzerTestOneInput(const uint8_t *data, size_t size) {
+    if(size < FUZZ_HEADER) return 0;
+
+    size_t plain_size = 0;
+    size_t cached_size = 0;
+    uint8_t *plain = run(data, size, false, &plain_size);
+    uint8_t *cached = run(data, size, true, &cached_size);
+
+    // Both ways of running the ROM have to end up in the same place
+    if(!plain != !cached) fail("ROM loaded with only one of the decode modes");
+    if(plain && (plain_size != cached_size || memcmp(plain, cached, plain_size) != 0))
+        fail("decode cache changed the outcome");
+
+    if(plain) check_state_round_trip(plain, plain_size);
+
+    // The linter reads the same bytes without running them, with Mega-Chip decoding when the XO-CHIP flag is set
+    lint_t lint;
+    if(lint_rom(&data[FUZZ_HEADER], size - FUZZ_HEADER, CHIP8_PLATFORM_ANY, data[0] & 0x1, &lint)) lint_free(&lint);
+
+    free(plain);
+    free(cached);
+    return 0;
+}
+
+#ifndef FUZZ_LIBFUZZER
+static uint32_t next_random(uint32_t *state) {
+    uint32_t x = *state;
+    x ^= x << 13;
+    x ^= x >> 17;
+    x ^= x << 5;
+    return *state = x;
+}
+
+// Valid instruction with jump, call and I targets inside the ROM, so programs run for longer
+// and write over their own code more often than random bytes do
+static uint16_t random_instruction(uint32_t *seed, size_t rom_size) {
+    const uint8_t arithmetic[] = {0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0xE};
+    const uint8_t misc[] = {0x07, 0x0A, 0x15, 0x18, 0x1E, 0x29, 0x30, 0x33, 0x55, 0x65, 0x75, 0x85};
+    const uint16_t system[] = {0x00E0, 0x00EE, 0x00FB, 0x00FC, 0x00FE, 0x00FF, 0x00C4};
+
+    const uint16_t random = next_random(seed);
+    const uint16_t target = CHIP8_ENTRY_POINT + next_random(seed) % (rom_size ? rom_size : 1);
+
+    switch(random >> 12) {
+        case 0x0: return system[random % sizeof system / sizeof system[0]];
+        case 0x1: case 0x2: case 0xA: case 0xB: return (random & 0xF000) | (target & 0x0FFE);
+        case 0x5: case 0x9: return random & 0xFFF0;
+        case 0x8: return (random & 0xFFF0) | arithmetic[random % sizeof arithmetic];
+        case 0xE: return (random & 0xFF00) | (random & 1 ? 0x9E : 0xA1);
+        case 0xF: return (random & 0xFF00) | misc[random % sizeof misc];
+        default:  return random;
+    }
+}
+
+static int replay_file(const char *path) {
+    FILE *file = fopen(path, "rb");
+    if(!file) {
+        fprintf(stderr, "Could not open %s\n", path);
+        return EXIT_FAILURE;
+    }
+
+    static uint8_t data[FUZZ_HEADER + CHIP8_XO_RAM_SIZE];
+    const size_t size = fread(data, 1, sizeof data, file);
+    fclose(file);
+
+    LLVMFuzzerTestOneInput(data, size);
+    printf("ok   %s\n", path);
+    return EXIT_SUCCESS;
+}
+
+int main(int argc, char **argv) {
+    if(argc > 1 && strtoul(argv[1], NULL, 10) == 0) {
+        int result = EXIT_SUCCESS;
+        for(int i = 1; i < argc; i++)
+            if(replay_file(argv[i]) != EXIT_SUCCESS) result = EXIT_FAILURE;
+        return result;
+    }
+
+    const uint32_t runs = argc > 1 ? strtoul(argv[1], NULL, 10) : 1000;
+    uint32_t seed = argc > 2 ? strtoul(argv[2], NULL, 10) : 1;
+    if(seed == 0) seed = 1;
+
+    // Mostly small ROMs, every other one made of valid instructions
+    static uint8_t data[FUZZ_HEADER + CHIP8_RAM_SIZE];
+    for(uint32_t run = 0; run < runs; run++) {
+        const size_t size = FUZZ_HEADER + next_random(&seed) % (run % 10 == 0 ? CHIP8_RAM_SIZE - CHIP8_ENTRY_POINT : 256);
+        for(size_t i = 0; i < size; i++) data[i] = next_random(&seed);
+
+        if(run % 2) {
+            for(size_t i = FUZZ_HEADER; i + 1 < size; i += 2) {
+                const uint16_t opcode = random_instruction(&seed, size - FUZZ_HEADER);
+                data[i] = opcode >> 8;
+                data[i + 1] = opcode & 0xFF;
+            }
+        }
+
+        // The input is saved first so a crash leaves it behind for replaying
+        FILE *file = fopen("fuzz-input.bin", "wb");
+        if(file) {
+            fwrite(data, 1, size, file);
+            fclose(file);
+        }
+
+        LLVMFuzzerTestOneInput(data, size);
+        if((run + 1) % 100 == 0) printf("%u runs\n", run + 1);
+    }
+
+    remove("fuzz-input.bin");
+    printf("%u runs, no problems found\n", runs);
+    return EXIT_SUCCESS;
+}
+#endif
@@ -0,0 +1,161 @@
+#define _POSIX_C_SOURCE 200809L
+
+// Golden screen tests: run test ROMs for a fixed number of instructions and compare
+// the final framebuffer against the text dumps committed in tests/golden/
+//
+// Build and run from src/ with "make test", "make update-golden" rewrites the dumps
+// after an intentional change, check the new screens by eye before committing them
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "chip8.h"
+#include "image.h"
+
+#define TESTS_DIR "../tests/"
+
+typedef struct {
+    const char *rom;        // Relative to the repository root
+    const char *quirks;     // Quirks preset, see chip8_quirks_preset()
+    uint32_t cycles;        // Instructions to run, enough for the ROM to settle on its result screen
+    const char *golden;     // Expected image_write_text() output, relative to tests/golden
+} golden_test_t;
+
+// The quirks and flags test ROMs (Timendus chip8-test-suite) are not bundled yet,
+// drop them in programs/ and add an entry here to cover them too
+static const golden_test_t tests[] = {
+    {"programs/IBM Logo.ch8",    "modern", 1000,  "ibm_logo.txt"},
+    {"programs/test_opcode.ch8", "modern", 10000, "test_opcode.txt"},
+    {"programs/BC_test.ch8",     "modern", 10000, "bc_test.txt"},
+};
+
+// Run a test ROM and return its final screen as a malloc'd text dump
+static char *run_rom(const golden_test_t *test, bool decode_cache) {
+    chip8_t *chip8 = malloc(sizeof *chip8);
+    if(!chip8) return NULL;
+
+    chip8_init(chip8);
+    chip8_quirks_preset(test->quirks, &chip8->quirks);
+
+    char path[256];
+    snprintf(path, sizeof path, TESTS_DIR "../%s", test->rom);
+    if((decode_cache && !chip8_set_decode_cache(chip8, true)) || !chip8_load_rom_file(chip8, path)) {
+        chip8_set_decode_cache(chip8, false);
+        free(chip8);
+        return NULL;
+    }
+
+    // Timers tick every 11 instructions, the default 700 instructions per second at 60Hz
+    for(uint32_t i = 0; i < test->cycles && chip8->state != QUIT; i++) {
+        chip8_step(chip8);
+        if((i + 1) % 11 == 0) chip8_update_timers(chip8);
+    }
+
+    char *text = NULL;
+    size_t text_size = 0;
+    FILE *out = open_memstream(&text, &text_size);
+    if(out) {
+        image_write_text(chip8, out);
+        fclose(out);
+    }
+
+    chip8_set_decode_cache(chip8, false);
+    free(chip8);
+    return text;
+}
+
+static char *read_text(const char *path) {
+    FILE *file = fopen(path, "rb");
+    if(!file) return NULL;
+
+    char *text = NULL;
+    size_t text_size = 0;
+    FILE *out = open_memstream(&text, &text_size);
+    if(out) {
+        char buf[4096];
+        size_t n;
+        while((n = fread(buf, 1, sizeof buf, file)) > 0) fwrite(buf, 1, n, out);
+        fclose(out);
+    }
+
+    fclose(file);
+    return text;
+}
+
+// Print the first differing row to help spot what broke
+static void print_diff(const char *expected, const char *actual) {
+    for(uint32_t row = 0; *expected || *actual; row++) {
+        const size_t expected_len = strcspn(expected, "\n");
+        const size_t actual_len = strcspn(actual, "\n");
+
+        if(expected_len != actual_len || strncmp(expected, actual, expected_len) != 0) {
+            printf("  row %u\n", row);
+            printf("  expected: %.*s\n", (int)expected_len, expected);
+            printf("  actual:   %.*s\n", (int)actual_len, actual);
+            return;
+        }
+
+        expected += expected_len + (expected[expected_len] == '\n');
+        actual += actual_len + (actual[actual_len] == '\n');
+    }
+}
+
+int main(int argc, char **argv) {
+    const bool update = argc > 1 && strcmp(argv[1], "--update") == 0;
+    uint32_t failed = 0;
+
+    for(size_t i = 0; i < sizeof tests / sizeof tests[0]; i++) {
+        const golden_test_t *test = &tests[i];
+        char golden_path[256];
+        snprintf(golden_path, sizeof golden_path, TESTS_DIR "golden/%s", test->golden);
+
+        char *actual = run_rom(test, false);
+        if(!actual) {
+            printf("FAIL %s: could not run ROM\n", test->rom);
+            failed++;
+            continue;
+        }
+
+        if(update) {
+            FILE *file = fopen(golden_path, "wb");
+            if(!file || fputs(actual, file) == EOF) {
+                printf("FAIL %s: could not write %s\n", test->rom, golden_path);
+                failed++;
+            } else {
+                printf("WROTE %s\n", golden_path);
+            }
+            if(file) fclose(file);
+            free(actual);
+            continue;
+        }
+
+        char *expected = read_text(golden_path);
+        if(!expected) {
+            printf("FAIL %s: missing %s, run make update-golden\n", test->rom, golden_path);
+            failed++;
+        } else if(strcmp(expected, actual) != 0) {
+            printf("FAIL %s: screen differs from %s\n", test->rom, golden_path);
+            print_diff(expected, actual);
+            failed++;
+        } else {
+            printf("ok   %s\n", test->rom);
+        }
+
+        // The decode cache must not change what a ROM does
+        char *cached = expected ? run_rom(test, true) : NULL;
+        if(expected && (!cached || strcmp(expected, cached) != 0)) {
+            printf("FAIL %s: screen differs with the decode cache\n", test->rom);
+            if(cached) print_diff(expected, cached);
+            failed++;
+        }
+
+        free(cached);
+        free(expected);
+        free(actual);
+    }
+
+    printf("%zu tests, %u failed\n", sizeof tests / sizeof tests[0], failed);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
@@ -0,0 +1,146 @@
+// Opcode reference tests: every one of the 65536 opcodes runs once on a machine with XO-CHIP and Mega-Chip
+// enabled, so the table in opcodes.c can't drift from what chip8_step() does
+//  - opcodes in the table must not fault as invalid, and have the platform chip8_opcode_platform() gives them
+//  - opcodes that aren't must fault as invalid or do nothing at all
+//  - XO-CHIP opcodes must fault as invalid again on a machine without XO-CHIP, apart from the ones that
+//    widen an older instruction like FX75
+//  - the instruction log describes a 00EE on an empty stack without reading below it
+//
+// Build and run from src/ with "make test"
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+#include <string.h>
+
+#include "chip8.h"
+#include "opcodes.h"
+
+#define TEST_I 0x300
+#define MESSAGE_SIZE 192   // Longest instruction description kept
+
+typedef struct {
+    uint8_t V[16];
+    uint16_t I;
+    uint16_t *stack_ptr;
+    uint8_t planes;
+    bool hires;
+    bool mega;
+} registers_t;
+
+static void save_registers(const chip8_t *chip8, registers_t *registers) {
+    memcpy(registers->V, chip8->V, sizeof registers->V);
+    registers->I = chip8->I;
+    registers->stack_ptr = chip8->stack_ptr;
+    registers->planes = chip8->planes;
+    registers->hires = chip8->hires;
+    registers->mega = chip8->mega;
+}
+
+static bool same_registers(const registers_t *a, const registers_t *b) {
+    return memcmp(a->V, b->V, sizeof a->V) == 0 && a->I == b->I && a->stack_ptr == b->stack_ptr &&
+           a->planes == b->planes && a->hires == b->hires && a->mega == b->mega;
+}
+
+// Put opcode at the entry point with a known machine state, the word after it is 0
+static void set_up(chip8_t *chip8, uint16_t opcode) {
+    for(uint8_t i = 0; i < 16; i++) chip8->V[i] = i * 17;
+    chip8->I = TEST_I;
+    chip8->PC = CHIP8_ENTRY_POINT;
+    chip8->stack_ptr = chip8->stack;
+    chip8->state = RUNNING;
+    chip8->fault = CHIP8_FAULT_NONE;
+
+    chip8_poke(chip8, CHIP8_ENTRY_POINT, opcode >> 8);
+    chip8_poke(chip8, CHIP8_ENTRY_POINT + 1, opcode & 0xFF);
+    chip8_poke(chip8, CHIP8_ENTRY_POINT + 2, 0);
+    chip8_poke(chip8, CHIP8_ENTRY_POINT + 3, 0);
+}
+
+// Another entry has the same form on an older platform, the XO-CHIP one only takes more operands
+static bool older_form(const opcode_info_t *info) {
+    for(size_t i = 0; i < opcode_count; i++)
+        if(&opcode_table[i] != info && strcmp(opcode_table[i].form, info->form) == 0 &&
+           opcode_table[i].platform < info->platform)
+            return true;
+    return false;
+}
+
+// Keeps the last instruction description
+static void keep_message(void *userdata, chip8_log_level_t level, const char *subsystem, const char *message) {
+    (void)level, (void)subsystem;
+    snprintf(userdata, MESSAGE_SIZE, "%s", message);
+}
+
+int main(void) {
+    chip8_t *chip8 = malloc(sizeof *chip8);
+    uint32_t failed = 0;
+    uint32_t found = 0;
+
+    if(!chip8) return EXIT_FAILURE;
+    chip8_init(chip8);
+    chip8_set_xochip(chip8, true);
+    chip8_set_megachip(chip8, true);
+
+    for(uint32_t opcode = 0; opcode <= 0xFFFF; opcode++) {
+        const opcode_info_t *info = opcode_find(opcode, true);
+        registers_t before, after;
+
+        set_up(chip8, opcode);
+        save_registers(chip8, &before);
+        chip8_step(chip8);
+        save_registers(chip8, &after);
+        const bool invalid = chip8->fault == CHIP8_FAULT_INVALID_OPCODE;
+
+        if(info) {
+            found++;
+            if(invalid) {
+                printf("FAIL %04X (%s): the core doesn't implement it\n", opcode, info->form);
+                failed++;
+            } else if(!info->megachip && chip8_opcode_platform(opcode) != info->platform) {
+                printf("FAIL %04X (%s): listed for the %s, the core has it on the %s\n", opcode, info->form,
+                       chip8_platform_name(info->platform), chip8_platform_name(chip8_opcode_platform(opcode)));
+                failed++;
+            }
+            continue;
+        }
+
+        // Doing nothing but moving on to the next instruction is fine
+        if(!invalid && (chip8->fault != CHIP8_FAULT_NONE || chip8->PC != CHIP8_ENTRY_POINT + 2 ||
+                        !same_registers(&before, &after))) {
+            printf("FAIL %04X: the core runs it but it's missing from the table\n", opcode);
+            failed++;
+        }
+    }
+
+    // An XO-CHIP opcode quietly doing nothing elsewhere hides a ROM run on the wrong platform, and F000
+    // would go on to run its address word as an instruction
+    chip8_set_xochip(chip8, false);
+    chip8_set_megachip(chip8, false);
+    for(uint32_t opcode = 0; opcode <= 0xFFFF; opcode++) {
+        const opcode_info_t *info = opcode_find(opcode, true);
+        if(!info || info->megachip || info->platform != CHIP8_PLATFORM_XOCHIP || older_form(info)) continue;
+
+        set_up(chip8, opcode);
+        chip8_step(chip8);
+        if(chip8->fault != CHIP8_FAULT_INVALID_OPCODE) {
+            printf("FAIL %04X (%s): runs without XO-CHIP\n", opcode, info->form);
+            failed++;
+        }
+    }
+
+    // The return faults, its description comes first
+    char message[MESSAGE_SIZE] = "";
+    chip8_set_log(chip8, keep_message, message);
+    chip8_set_instruction_log(chip8, true);
+    set_up(chip8, 0x00EE);
+    chip8_step(chip8);
+    if(chip8->fault != CHIP8_FAULT_STACK_UNDERFLOW || !strstr(message, "stack empty")) {
+        printf("FAIL 00EE on an empty stack: \"%s\"\n", message);
+        failed++;
+    }
+
+    free(chip8);
+    printf("%u opcodes in the table, %u failed\n", found, failed);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
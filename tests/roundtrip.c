@@ -0,0 +1,99 @@
+// Disassembler round trip: every ROM in roms/ disassembled with disasm_program() and assembled again has
+// to give back the same bytes, in the raw syntax through asm_assemble() and in Octo syntax through
+// octo_assemble()
+//
+// Build and run from src/ with "make test"
+#define _POSIX_C_SOURCE 200809L
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "disasm.h"
+#include "asm.h"
+#include "octo.h"
+
+#define ROMS_DIR "../roms/"
+
+static const char *roms[] = {
+    "15PUZZLE", "BLINKY", "BLITZ", "BRIX", "CONNECT4", "GUESS", "HIDDEN", "INVADERS", "KALEID", "MAZE", "MERLIN",
+    "MISSILE", "PONG", "PONG2", "PUZZLE", "SYZYGY", "TANK", "TETRIS", "TICTAC", "UFO", "VBRIX", "VERS", "WIPEOFF",
+};
+
+static uint8_t *read_rom(const char *path, size_t *size) {
+    FILE *file = fopen(path, "rb");
+    if(!file) return NULL;
+
+    uint8_t *rom = malloc(4096);
+    *size = rom ? fread(rom, 1, 4096, file) : 0;
+    fclose(file);
+    return rom;
+}
+
+// The program as source in the given syntax, malloc'd and NUL terminated
+static char *disassemble(const uint8_t *rom, size_t size, disasm_syntax_t syntax) {
+    char *source = NULL;
+    size_t length = 0;
+    FILE *out = open_memstream(&source, &length);
+    if(!out) return NULL;
+
+    const bool ok = disasm_program(rom, size, syntax, NULL, out);
+    fclose(out);
+    if(ok) return source;
+
+    free(source);
+    return NULL;
+}
+
+// NULL if the ROM comes back unchanged, what went wrong otherwise
+static const char *round_trip(const char *name, const uint8_t *rom, size_t size, disasm_syntax_t syntax) {
+    char *source = disassemble(rom, size, syntax);
+    if(!source) return "did not disassemble";
+
+    uint8_t *assembled = NULL;
+    size_t assembled_size = 0;
+    const bool ok = syntax == DISASM_OCTO ? octo_assemble(source, name, &assembled, &assembled_size, NULL)
+                                          : asm_assemble(source, name, &assembled, &assembled_size, NULL);
+    free(source);
+    if(!ok) return "did not assemble again";
+
+    const bool same = assembled_size == size && memcmp(assembled, rom, size) == 0;
+    free(assembled);
+    return same ? NULL : "assembled into other bytes";
+}
+
+static bool run_test(const char *name, const uint8_t *rom, size_t size, disasm_syntax_t syntax) {
+    const char *how = syntax == DISASM_OCTO ? "Octo syntax" : "raw syntax";
+    const char *failure = round_trip(name, rom, size, syntax);
+
+    if(failure) printf("FAIL %s in %s %s\n", name, how, failure);
+    else printf("ok   %s in %s\n", name, how);
+    return !failure;
+}
+
+int main(void) {
+    uint32_t failed = 0;
+    uint32_t count = 0;
+
+    for(size_t i = 0; i < sizeof roms / sizeof roms[0]; i++, count += 2) {
+        char path[256];
+        snprintf(path, sizeof path, ROMS_DIR "%s", roms[i]);
+
+        size_t size = 0;
+        uint8_t *rom = read_rom(path, &size);
+        if(!rom || size == 0) {
+            printf("FAIL %s could not be read\n", path);
+            failed += 2;
+            free(rom);
+            continue;
+        }
+
+        failed += !run_test(path, rom, size, DISASM_RAW);
+        failed += !run_test(path, rom, size, DISASM_OCTO);
+        free(rom);
+    }
+
+    printf("%u round trips, %u failed\n", count, failed);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
@@ -0,0 +1,208 @@
+// Save state tests: a machine saved partway through a ROM and restored into a fresh one has to go on
+// exactly like the original, through chip8_serialize() as well as chip8_snapshot(). Rewind and netplay
+// rollback restore states all the time, anything the state leaves out makes them drift
+//
+// Build and run from src/ with "make test"
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+#define TESTS_DIR "../tests/"
+#define FRAMES_AFTER 60     // Frames both machines run after the restore
+
+typedef struct {
+    const char *rom;        // Relative to the repository root
+    uint32_t speed;         // Instructions per second, ones that aren't a multiple of 60 carry a remainder
+    uint32_t frames;        // Frames run before saving
+    chip8_timing_t timing;  // VIP timing carries machine cycles over instead
+} state_test_t;
+
+static const state_test_t tests[] = {
+    {"roms/BRIX",                700,  31, CHIP8_TIMING_FLAT},
+    {"roms/TETRIS",              700,  44, CHIP8_TIMING_FLAT},
+    {"programs/test_opcode.ch8", 1000, 7,  CHIP8_TIMING_FLAT},
+    {"roms/BRIX",                700,  30, CHIP8_TIMING_VIP},
+    {"roms/INVADERS",            700,  50, CHIP8_TIMING_VIP},
+};
+
+static chip8_t *new_machine(const state_test_t *test) {
+    chip8_t *chip8 = malloc(sizeof *chip8);
+    if(!chip8) return NULL;
+
+    char path[256];
+    snprintf(path, sizeof path, TESTS_DIR "../%s", test->rom);
+
+    chip8_init(chip8);
+    chip8_seed(chip8, 1);
+    if(!chip8_load_rom_file(chip8, path)) {
+        free(chip8);
+        return NULL;
+    }
+
+    chip8_set_speed(chip8, test->speed);
+    chip8_set_timing(chip8, test->timing);
+    return chip8;
+}
+
+// Copy the machine's state from one machine to the other through a save state
+static bool copy_serialized(const chip8_t *from, chip8_t *to) {
+    const size_t size = chip8_state_size(from);
+    uint8_t *data = malloc(size);
+    const bool ok = data && chip8_serialize(from, data, size) == size && chip8_deserialize(to, data, size);
+
+    free(data);
+    return ok;
+}
+
+static bool copy_snapshot(const chip8_t *from, chip8_t *to) {
+    chip8_snapshot_t *snapshot = malloc(sizeof *snapshot);
+    const bool ok = snapshot && (chip8_snapshot(from, snapshot), chip8_restore(to, snapshot));
+
+    free(snapshot);
+    return ok;
+}
+
+// Save, restore into the fresh machine, then run both on, NULL if they still agree
+static const char *restore_and_run(const state_test_t *test, bool (*copy)(const chip8_t *, chip8_t *),
+                                   chip8_t *original, chip8_t *restored, chip8_snapshot_t *a, chip8_snapshot_t *b) {
+    for(uint32_t frame = 0; frame < test->frames; frame++) chip8_run_frame(original);
+    if(!copy(original, restored)) return "did not restore";
+
+    for(uint32_t frame = 0; frame < FRAMES_AFTER; frame++) {
+        chip8_run_frame(original);
+        chip8_run_frame(restored);
+    }
+
+    chip8_snapshot(original, a);
+    chip8_snapshot(restored, b);
+    return chip8_snapshot_equal(a, b) ? NULL : "went another way than the original";
+}
+
+static bool run_test(const state_test_t *test, bool (*copy)(const chip8_t *, chip8_t *), const char *how) {
+    chip8_t *original = new_machine(test);
+    chip8_t *restored = new_machine(test);
+    chip8_snapshot_t *a = malloc(sizeof *a);
+    chip8_snapshot_t *b = malloc(sizeof *b);
+
+    const char *failure = original && restored && a && b ?
+                          restore_and_run(test, copy, original, restored, a, b) : "could not run the ROM";
+    const char *timing = test->timing == CHIP8_TIMING_VIP ? " with VIP timing" : "";
+    if(failure) printf("FAIL %s%s: the machine restored through %s %s\n", test->rom, timing, how, failure);
+    else printf("ok   %s%s through %s\n", test->rom, timing, how);
+
+    free(b);
+    free(a);
+    free(restored);
+    free(original);
+    return !failure;
+}
+
+// The states refused on purpose would report themselves as corrupt
+static void ignore_log(void *userdata, chip8_log_level_t level, const char *subsystem, const char *message) {
+    (void)userdata, (void)level, (void)subsystem, (void)message;
+}
+
+// VIP cycle balances a frame can't end with, anything from a state has to stay in these bounds
+static const int32_t bad_balances[] = {1, CHIP8_VIP_FRAME_CYCLES, 50000000, INT32_MAX - 100, -100000, INT32_MIN};
+
+// A state with a balance out of bounds would run a frame of millions of instructions or overflow
+static bool run_bad_balance_test(int32_t balance, bool (*copy)(const chip8_t *, chip8_t *), const char *how) {
+    const state_test_t test = {"roms/BRIX", 700, 0, CHIP8_TIMING_VIP};
+    chip8_t *original = new_machine(&test);
+    chip8_t *restored = new_machine(&test);
+
+    bool ok = original && restored;
+    if(ok) {
+        chip8_set_log(restored, ignore_log, NULL);
+        original->cycle_balance = balance;
+        ok = !copy(original, restored) && restored->cycle_balance == 0;
+    }
+
+    if(ok) printf("ok   a VIP cycle balance of %d doesn't restore through %s\n", balance, how);
+    else printf("FAIL a VIP cycle balance of %d restored through %s\n", balance, how);
+
+    free(restored);
+    free(original);
+    return ok;
+}
+
+// Keys FX0A can't be waiting on, both ways of restoring have to refuse the same ones
+static const int8_t bad_wait_keys[] = {0x10, 0x7F, -2, -128};
+
+static bool run_bad_wait_key_test(int8_t key, bool (*copy)(const chip8_t *, chip8_t *), const char *how) {
+    const state_test_t test = {"roms/BRIX", 700, 0, CHIP8_TIMING_FLAT};
+    chip8_t *original = new_machine(&test);
+    chip8_t *restored = new_machine(&test);
+
+    bool ok = original && restored;
+    if(ok) {
+        chip8_set_log(restored, ignore_log, NULL);
+        original->wait_key = key;
+        ok = !copy(original, restored) && restored->wait_key == -1;
+    }
+
+    if(ok) printf("ok   FX0A waiting on key %d doesn't restore through %s\n", key, how);
+    else printf("FAIL FX0A waiting on key %d restored through %s\n", key, how);
+
+    free(restored);
+    free(original);
+    return ok;
+}
+
+// A digitized sound running past the end of memory would have the audio backend read past it too
+static bool run_bad_sound_test(bool megachip, bool (*copy)(const chip8_t *, chip8_t *), const char *how) {
+    const state_test_t test = {"roms/BRIX", 700, 0, CHIP8_TIMING_FLAT};
+    chip8_t *original = new_machine(&test);
+    chip8_t *restored = new_machine(&test);
+
+    bool ok = original && restored;
+    if(ok) {
+        chip8_set_log(restored, ignore_log, NULL);
+        chip8_set_megachip(original, megachip);
+        original->sound = (chip8_sound_t) {.addr = 0xFF00, .length = 0x100000, .rate = 8000, .playing = true};
+        ok = !copy(original, restored) || (!restored->sound.playing && restored->sound.length == 0);
+    }
+
+    const char *machine = megachip ? "Mega-Chip" : "CHIP8";
+    if(ok) printf("ok   a %s sound past the end of memory doesn't restore through %s\n", machine, how);
+    else printf("FAIL a %s sound past the end of memory restored through %s\n", machine, how);
+
+    free(restored);
+    free(original);
+    return ok;
+}
+
+int main(void) {
+    uint32_t failed = 0;
+    uint32_t count = 0;
+
+    for(size_t i = 0; i < sizeof tests / sizeof tests[0]; i++) {
+        failed += !run_test(&tests[i], copy_serialized, "a save state");
+        failed += !run_test(&tests[i], copy_snapshot, "a snapshot");
+        count += 2;
+    }
+
+    for(size_t i = 0; i < sizeof bad_balances / sizeof bad_balances[0]; i++) {
+        failed += !run_bad_balance_test(bad_balances[i], copy_serialized, "a save state");
+        failed += !run_bad_balance_test(bad_balances[i], copy_snapshot, "a snapshot");
+        count += 2;
+    }
+
+    for(size_t i = 0; i < sizeof bad_wait_keys / sizeof bad_wait_keys[0]; i++) {
+        failed += !run_bad_wait_key_test(bad_wait_keys[i], copy_serialized, "a save state");
+        failed += !run_bad_wait_key_test(bad_wait_keys[i], copy_snapshot, "a snapshot");
+        count += 2;
+    }
+
+    for(int megachip = 0; megachip < 2; megachip++) {
+        failed += !run_bad_sound_test(megachip, copy_serialized, "a save state");
+        failed += !run_bad_sound_test(megachip, copy_snapshot, "a snapshot");
+        count += 2;
+    }
+
+    printf("%u state tests, %u failed\n", count, failed);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
@@ -0,0 +1,147 @@
+// Frame timing tests: the machine cycles chip8_vip_cycles() gives a few instructions, how many instructions
+// chip8_run_frame() fits in a frame with CHIP8_TIMING_VIP, and the flat frames frontends run through a callback
+//
+// Build and run from src/ with "make test"
+#include <stdio.h>
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+#define FETCH 40            // Every instruction's fetch and decode
+
+typedef struct {
+    uint16_t opcode;
+    uint8_t vx;             // V[X] before the instruction runs
+    uint32_t cycles;
+    const char *what;
+} cycles_test_t;
+
+static const cycles_test_t cycle_tests[] = {
+    {0x00E0, 0,   FETCH + 24 + 256 * 6,  "00E0 clears all 256 display bytes"},
+    {0x6012, 0,   FETCH + 6,             "6XNN"},
+    {0x7001, 0,   FETCH + 10,            "7XNN"},
+    {0x3000, 0,   FETCH + 14,            "3XNN that skips"},
+    {0x3001, 0,   FETCH + 10,            "3XNN that doesn't skip"},
+    {0x8010, 0,   FETCH + 12,            "8XY0"},
+    {0x8014, 0,   FETCH + 44,            "8XY4 runs from memory"},
+    {0xD005, 8,   FETCH + 26 + 5 * 46,   "DXYN on a byte boundary"},
+    {0xD005, 3,   FETCH + 26 + 5 * 70,   "DXYN across two bytes"},
+    {0xF033, 123, FETCH + 80 + 16 * 6,   "FX33 subtracts once for each unit of a digit"},
+    {0xF355, 0,   FETCH + 14 + 14 * 4,   "FX55 with X = 3"},
+};
+
+static void load(chip8_t *chip8, const uint8_t *rom, size_t size) {
+    chip8_init(chip8);
+    chip8_quirks_preset("vip", &chip8->quirks);
+    chip8->quirks.display_wait = false;
+    chip8_load_rom(chip8, rom, size);
+}
+
+static bool run_cycles_test(chip8_t *chip8, const cycles_test_t *test) {
+    const uint8_t rom[] = {test->opcode >> 8, test->opcode & 0xFF, 0x12, 0x02};
+    load(chip8, rom, sizeof rom);
+    chip8->V[(test->opcode >> 8) & 0xF] = test->vx;
+    chip8->I = 0x300;
+
+    const uint16_t inst_addr = chip8->PC;
+    chip8_step(chip8);
+    const uint32_t cycles = chip8_vip_cycles(chip8, inst_addr);
+
+    if(cycles == test->cycles) printf("ok   %04X: %s\n", test->opcode, test->what);
+    else printf("FAIL %04X: %s, %u cycles instead of %u\n", test->opcode, test->what, cycles, test->cycles);
+    return cycles == test->cycles;
+}
+
+// A loop of 7001 and a jump back costs 50 + 52 cycles a turn, a frame fits 25 or 26 of them and the cycles
+// an instruction runs over come off the next frame. 60 frames of 2598 cycles make 1529 turns
+static bool run_loop_test(chip8_t *chip8) {
+    const uint8_t rom[] = {0x70, 0x01, 0x12, 0x00};
+    load(chip8, rom, sizeof rom);
+    chip8_set_timing(chip8, CHIP8_TIMING_VIP);
+
+    // V0 wraps around, a frame adds far less than 256 to it
+    uint32_t adds = 0;
+    for(int frame = 0; frame < 60; frame++) {
+        const uint8_t before = chip8->V[0];
+        chip8_run_frame(chip8);
+        adds += (uint8_t)(chip8->V[0] - before);
+    }
+
+    if(adds == 1529) printf("ok   60 frames of VIP cycles run the loop 1529 times\n");
+    else printf("FAIL 60 frames of VIP cycles run the loop %u times instead of 1529\n", adds);
+    return adds == 1529;
+}
+
+// With display_wait a sprite waits for the display interrupt, which ends the frame there
+static bool run_display_wait_test(chip8_t *chip8) {
+    const uint8_t rom[] = {0xA0, 0x00, 0xD0, 0x11, 0x71, 0x01, 0x12, 0x02};
+    load(chip8, rom, sizeof rom);
+    chip8->quirks.display_wait = true;
+    chip8_set_timing(chip8, CHIP8_TIMING_VIP);
+
+    for(int frame = 0; frame < 60; frame++) chip8_run_frame(chip8);
+
+    // The first sprite waits for the interrupt that ends the first frame
+    const bool ok = chip8->V[1] == 59;
+    if(ok) printf("ok   a sprite waiting for the display ends the frame\n");
+    else printf("FAIL a sprite waiting for the display ends the frame, %u sprites in 60 frames\n", chip8->V[1]);
+    return ok;
+}
+
+static void count_instruction(void *userdata, chip8_t *chip8) {
+    (*(uint32_t *)userdata)++;
+    chip8_step(chip8);
+}
+
+// At 700 instructions per second the flat frames run 11 or 12 instructions, the machine keeps the remainder
+static bool run_flat_test(chip8_t *chip8) {
+    const uint8_t rom[] = {0x70, 0x01, 0x12, 0x00};
+    load(chip8, rom, sizeof rom);
+    chip8_set_speed(chip8, 700);
+
+    uint32_t counted = 0, insts = 0;
+    for(int frame = 0; frame < 60; frame++) insts += chip8_run_flat_frame(chip8, count_instruction, &counted);
+
+    const bool ok = insts == 700 && counted == 700 && chip8->frame_remainder == 0;
+    if(ok) printf("ok   60 flat frames at 700 instructions/s run 700 instructions through the callback\n");
+    else printf("FAIL 60 flat frames at 700 instructions/s ran %u instructions, %u through the callback\n", insts,
+                counted);
+    return ok;
+}
+
+// A machine paused partway through a frame starts the next one without the cycles it didn't use
+static bool run_pause_test(chip8_t *chip8) {
+    const uint8_t rom[] = {0x70, 0x01, 0x12, 0x00};
+    load(chip8, rom, sizeof rom);
+    chip8_set_timing(chip8, CHIP8_TIMING_VIP);
+    chip8_set_paused(chip8, true);
+
+    const uint32_t insts = chip8_run_vip_frame(chip8, NULL, NULL);
+    const bool ok = insts == 0 && chip8->cycle_balance == 0;
+    if(ok) printf("ok   a paused machine doesn't keep the frame's cycles\n");
+    else printf("FAIL a paused machine ran %u instructions and kept %d cycles\n", insts, chip8->cycle_balance);
+    return ok;
+}
+
+int main(void) {
+    chip8_t *chip8 = malloc(sizeof *chip8);
+    uint32_t failed = 0;
+    uint32_t count = 0;
+
+    if(!chip8) return EXIT_FAILURE;
+
+    for(size_t i = 0; i < sizeof cycle_tests / sizeof cycle_tests[0]; i++, count++)
+        failed += !run_cycles_test(chip8, &cycle_tests[i]);
+
+    failed += !run_loop_test(chip8);
+    failed += !run_display_wait_test(chip8);
+    failed += !run_pause_test(chip8);
+    failed += !run_flat_test(chip8);
+    count += 4;
+
+    free(chip8);
+    printf("%u timing tests, %u failed\n", count, failed);
+    return failed ? EXIT_FAILURE : EXIT_SUCCESS;
+}
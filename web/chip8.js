@@ -0,0 +1,196 @@
+// Browser frontend for the WebAssembly build, see chip8_web.c
+"use strict";
+
+// Same layout as the desktop default keymap (keymap.c)
+const KEYMAP = {
+    "1": 0x1, "2": 0x2, "3": 0x3, "4": 0xC,
+    "q": 0x4, "w": 0x5, "e": 0x6, "r": 0xD,
+    "a": 0x7, "s": 0x8, "d": 0x9, "f": 0xE,
+    "z": 0xA, "x": 0x0, "c": 0xB, "v": 0xF,
+};
+
+// The COSMAC VIP's keypad, row by row
+const KEYPAD = [0x1, 0x2, 0x3, 0xC, 0x4, 0x5, 0x6, 0xD, 0x7, 0x8, 0x9, 0xE, 0xA, 0x0, 0xB, 0xF];
+
+// Background, plane 1, plane 2 and both planes, matching the desktop defaults
+const PALETTE = [[0x00, 0x00, 0x00], [0xFF, 0xFF, 0xFF], [0xFF, 0x66, 0x00], [0x66, 0x22, 0x00]];
+
+const FRAME_MS = 1000 / 60;
+
+createChip8().then((chip8) => {
+    const loadRom = chip8.cwrap("web_load_rom", "boolean", ["number", "boolean", "string", "number"]);
+    const canvas = document.getElementById("screen");
+    const context = canvas.getContext("2d");
+    let running = false;
+    let lastTime = 0;
+    let pending = 0;        // Milliseconds of emulation owed, frames run at 60Hz whatever the display rate
+    let audio = null;
+    let oscillator = null;
+    const typed = new Array(16).fill(false);  // Keys held on the keyboard
+    const touches = new Map();                  // Keypad key under each finger or the mouse, by pointer id
+    const buttons = [];                         // Touch keypad buttons by CHIP8 key
+
+    function start(rom) {
+        if(rom.length > chip8._web_rom_buffer_size()) {
+            alert("ROM is too big");
+            return;
+        }
+
+        chip8.HEAPU8.set(rom, chip8._web_rom_buffer());
+
+        // Too big for 4KB without XO-CHIP is reported by web_load_rom()
+        const quirks = document.getElementById("quirks").value;
+        const xochip = document.getElementById("xochip").checked;
+        if(!loadRom(rom.length, xochip, quirks, Date.now() >>> 0)) {
+            alert("Could not load ROM, try enabling XO-CHIP for ROMs over 3.5KB");
+            return;
+        }
+
+        chip8._web_set_speed(Number(document.getElementById("speed").value));
+        draw();
+
+        if(!running) {
+            running = true;
+            lastTime = performance.now();
+            requestAnimationFrame(tick);
+        }
+    }
+
+    function draw() {
+        const width = chip8._web_display_width();
+        const height = chip8._web_display_height();
+        if(canvas.width !== width || canvas.height !== height) {
+            canvas.width = width;
+            canvas.height = height;
+        }
+
+        const display = chip8.HEAPU8.subarray(chip8._web_display(), chip8._web_display() + width * height);
+        const image = context.createImageData(width, height);
+        for(let i = 0; i < display.length; i++) {
+            const color = PALETTE[display[i] & 0x3];
+            image.data[i * 4 + 0] = color[0];
+            image.data[i * 4 + 1] = color[1];
+            image.data[i * 4 + 2] = color[2];
+            image.data[i * 4 + 3] = 0xFF;
+        }
+
+        context.putImageData(image, 0, 0);
+    }
+
+    // Square wave buzzer, browsers only allow audio after a user gesture so it starts on the first key press
+    function setSound(active) {
+        if(!audio) return;
+
+        if(active && !oscillator) {
+            oscillator = audio.createOscillator();
+            oscillator.type = "square";
+            oscillator.frequency.value = 440;
+            const gain = audio.createGain();
+            gain.gain.value = 0.1;
+            oscillator.connect(gain).connect(audio.destination);
+            oscillator.start();
+        } else if(!active && oscillator) {
+            oscillator.stop();
+            oscillator = null;
+        }
+    }
+
+    function tick(now) {
+        pending += now - lastTime;
+        lastTime = now;
+
+        // Don't try to catch up after the tab was in the background
+        if(pending > FRAME_MS * 5) pending = FRAME_MS;
+
+        let changed = false;
+        while(pending >= FRAME_MS) {
+            changed = chip8._web_run_frame() || changed;
+            pending -= FRAME_MS;
+        }
+
+        if(changed) draw();
+        setSound(chip8._web_sound_active());
+        requestAnimationFrame(tick);
+    }
+
+    // A key is down while it's held on the keyboard or any finger is on its button
+    function updateKey(key) {
+        const pressed = typed[key] || [...touches.values()].includes(key);
+        chip8._web_set_key(key, pressed);
+        if(buttons[key]) buttons[key].classList.toggle("down", pressed);
+    }
+
+    function onKey(event, pressed) {
+        const key = KEYMAP[event.key.toLowerCase()];
+        if(key === undefined) return;
+
+        if(!audio) audio = new AudioContext();
+        typed[key] = pressed;
+        updateKey(key);
+        event.preventDefault();
+    }
+
+    // Each pointer presses the button it's on, sliding a finger to the next button moves the press along
+    // Several fingers at once press several keys, for games that need diagonals or move and fire together
+    function onPointer(event) {
+        const previous = touches.get(event.pointerId);
+        const ended = event.type === "pointerup" || event.type === "pointercancel";
+        if(event.type !== "pointerdown" && previous === undefined) return;
+
+        const button = ended ? null : document.elementFromPoint(event.clientX, event.clientY);
+        const key = button && button.dataset.key !== undefined ? Number(button.dataset.key) : undefined;
+
+        if(key === undefined) touches.delete(event.pointerId);
+        else touches.set(event.pointerId, key);
+
+        if(previous !== undefined && previous !== key) updateKey(previous);
+        if(key !== undefined && key !== previous) updateKey(key);
+        if(event.type === "pointerdown" && !audio) audio = new AudioContext();
+        event.preventDefault();
+    }
+
+    const keypad = document.getElementById("keypad");
+    for(const key of KEYPAD) {
+        const button = document.createElement("button");
+        button.textContent = key.toString(16).toUpperCase();
+        button.dataset.key = key;
+        buttons[key] = button;
+        keypad.appendChild(button);
+    }
+    // Presses start on the keypad, the rest is followed everywhere so a finger lifted off it still lets go
+    keypad.addEventListener("pointerdown", onPointer);
+    for(const type of ["pointermove", "pointerup", "pointercancel"]) document.addEventListener(type, onPointer);
+
+    // Pointer capture would keep every move on the first button, the presses follow the finger instead
+    keypad.addEventListener("gotpointercapture", (event) => event.target.releasePointerCapture(event.pointerId));
+    keypad.addEventListener("contextmenu", (event) => event.preventDefault());
+
+    // On by default on phones and tablets, ?keypad=0 or 1 overrides that
+    const showKeypad = document.getElementById("show-keypad");
+    const keypadParam = new URLSearchParams(window.location.search).get("keypad");
+    showKeypad.checked = keypadParam !== null ? keypadParam === "1" : window.matchMedia("(pointer: coarse)").matches;
+    keypad.hidden = !showKeypad.checked;
+    showKeypad.addEventListener("change", () => {
+        keypad.hidden = !showKeypad.checked;
+    });
+
+    document.addEventListener("keydown", (event) => onKey(event, true));
+    document.addEventListener("keyup", (event) => onKey(event, false));
+
+    document.getElementById("rom-file").addEventListener("change", (event) => {
+        const file = event.target.files[0];
+        if(file) file.arrayBuffer().then((data) => start(new Uint8Array(data)));
+    });
+
+    document.getElementById("speed").addEventListener("change", (event) => {
+        chip8._web_set_speed(Number(event.target.value));
+    });
+
+    const url = new URLSearchParams(window.location.search).get("rom");
+    if(url) {
+        fetch(url)
+            .then((response) => response.ok ? response.arrayBuffer() : Promise.reject(response.statusText))
+            .then((data) => start(new Uint8Array(data)))
+            .catch((error) => alert(`Could not fetch ${url}: ${error}`));
+    }
+});
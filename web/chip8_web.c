@@ -0,0 +1,67 @@
+// WebAssembly entry points for the browser frontend in chip8.js, built with "make web" in src/
+// The page owns timing, input and drawing, this only wraps the emulator core
+#include <stdint.h>
+#include <stdbool.h>
+
+#include "chip8.h"
+
+#ifdef __EMSCRIPTEN__
+#include <emscripten.h>
+#else
+#define EMSCRIPTEN_KEEPALIVE
+#endif
+
+static chip8_t chip8;
+static uint8_t rom_buffer[CHIP8_XO_RAM_SIZE - CHIP8_ENTRY_POINT];
+
+// JS copies ROM files here before calling web_load_rom()
+EMSCRIPTEN_KEEPALIVE uint8_t *web_rom_buffer(void) {
+    return rom_buffer;
+}
+
+EMSCRIPTEN_KEEPALIVE uint32_t web_rom_buffer_size(void) {
+    return sizeof rom_buffer;
+}
+
+// Reset the machine and load size bytes from the ROM buffer
+// quirks is a preset name, see chip8_quirks_preset()
+EMSCRIPTEN_KEEPALIVE bool web_load_rom(uint32_t size, bool xochip, const char *quirks, uint32_t seed) {
+    chip8_init(&chip8);
+    chip8_set_xochip(&chip8, xochip);
+    chip8_seed(&chip8, seed);
+    if(quirks && !chip8_quirks_preset(quirks, &chip8.quirks)) return false;
+
+    return chip8_load_rom(&chip8, rom_buffer, size);
+}
+
+EMSCRIPTEN_KEEPALIVE void web_set_speed(uint32_t speed) {
+    if(speed >= 60) chip8_set_speed(&chip8, speed);
+}
+
+// Run one 60Hz frame, returns whether the display changed since the last call
+EMSCRIPTEN_KEEPALIVE bool web_run_frame(void) {
+    const bool draw = chip8_run_frame(&chip8);
+    chip8_clear_dirty(&chip8);
+    return draw;
+}
+
+// Plane bitmask per pixel, row major, web_display_width() x web_display_height()
+EMSCRIPTEN_KEEPALIVE const uint8_t *web_display(void) {
+    return chip8_display(&chip8);
+}
+
+EMSCRIPTEN_KEEPALIVE uint32_t web_display_width(void) {
+    return chip8_display_width(&chip8);
+}
+
+EMSCRIPTEN_KEEPALIVE uint32_t web_display_height(void) {
+    return chip8_display_height(&chip8);
+}
+
+EMSCRIPTEN_KEEPALIVE void web_set_key(uint8_t key, bool pressed) {
+    chip8_set_key(&chip8, key, pressed);
+}
+
+EMSCRIPTEN_KEEPALIVE bool web_sound_active(void) {
+    return chip8_sound_active(&chip8);
+}